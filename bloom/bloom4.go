@@ -81,6 +81,44 @@ func InsertV1(region []byte, filterIdx uint8, elem []byte) error {
 	return EncodeHeaderV1(region, h)
 }
 
+// InsertOffsetsV1 returns the offsets, in region, of the bitset bytes InsertV1
+// sets for elem in filterIdx. InsertV1 also updates the header, the first
+// HeaderBytesV1 of the region. Saving these bytes first lets a caller undo the
+// insert without a copy of the region.
+func InsertOffsetsV1(region []byte, filterIdx uint8, elem []byte) ([]uint64, error) {
+	if filterIdx >= Filters {
+		return nil, ErrBadFilterIndex
+	}
+	if len(elem) != ValueBytes {
+		return nil, ErrBadElemSize
+	}
+
+	h, ok, err := DecodeHeaderV1(region)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotInitialized
+	}
+
+	bitsetBytes := BitsetBytesV1(h.MBits)
+	off, err := filterBitsetOffV1(filterIdx, bitsetBytes)
+	if err != nil {
+		return nil, err
+	}
+	end := uint64(off) + uint64(bitsetBytes)
+	if uint64(len(region)) < end {
+		return nil, ErrBadRegionSize
+	}
+
+	h1, h2 := hashPairV1(filterIdx, elem)
+	offsets := make([]uint64, 0, h.K)
+	for _, byteIdx := range bitBytesLSB0(uint64(h.MBits), h.K, h1, h2) {
+		offsets = append(offsets, uint64(off)+byteIdx)
+	}
+	return offsets, nil
+}
+
 // MaybeContainsV1 checks membership for elem in filterIdx.
 //
 // Returns (false,nil) if the filter says "definitely not present".
@@ -140,6 +178,16 @@ func setBitsLSB0(bitset []byte, mBits uint64, k uint8, h1, h2 uint64) {
 	}
 }
 
+// bitBytesLSB0 returns the index, in the bitset, of the byte of each bit
+// setBitsLSB0 sets
+func bitBytesLSB0(mBits uint64, k uint8, h1, h2 uint64) []uint64 {
+	indices := make([]uint64, 0, k)
+	for i := uint64(0); i < uint64(k); i++ {
+		indices = append(indices, ((h1+i*h2)%mBits)>>3)
+	}
+	return indices
+}
+
 func testBitsLSB0(bitset []byte, mBits uint64, k uint8, h1, h2 uint64) bool {
 	for i := uint64(0); i < uint64(k); i++ {
 		j := (h1 + i*h2) % mBits
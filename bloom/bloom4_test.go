@@ -135,3 +135,36 @@ func TestBloomV1RegionTooSmallAfterHeader(t *testing.T) {
 	_, err = MaybeContainsV1(region, 0, make([]byte, ValueBytes))
 	require.ErrorIs(t, err, ErrBadRegionSize)
 }
+
+func TestBloomV1InsertOffsets(t *testing.T) {
+	leafCount := uint64(128)
+	mBits := MBitsSafeCast(MBitsV1(leafCount, 10))
+	region := make([]byte, RegionBytesV1(mBits))
+	require.NoError(t, InitV1(region, leafCount, 10, 7))
+	before := append([]byte(nil), region...)
+
+	elem := make([]byte, ValueBytes)
+	elem[0] = 3
+	offsets, err := InsertOffsetsV1(region, 2, elem)
+	require.NoError(t, err)
+	require.Len(t, offsets, 7)
+	require.NoError(t, InsertV1(region, 2, elem))
+
+	// restoring the header and the offsets undoes the insert
+	for off := range region {
+		if off < HeaderBytesV1 {
+			continue
+		}
+		if region[off] != before[off] {
+			require.Contains(t, offsets, uint64(off))
+		}
+	}
+	copy(region[:HeaderBytesV1], before[:HeaderBytesV1])
+	for _, off := range offsets {
+		region[off] = before[off]
+	}
+	require.Equal(t, before, region)
+
+	_, err = InsertOffsetsV1(region, Filters, elem)
+	require.ErrorIs(t, err, ErrBadFilterIndex)
+}
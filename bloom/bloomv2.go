@@ -0,0 +1,230 @@
+package bloom
+
+import "bytes"
+
+// The V2 format has the layout of V1, but the number of filters and the bits
+// per element are chosen when the region is initialized and recorded in the
+// header, rather than fixed by the format:
+//
+//	[0:4]   magic "BLM2"
+//	[4]     version 2
+//	[5]     bitOrder
+//	[6]     k
+//	[7]     filters
+//	[8:12]  mBits
+//	[12:16] nInserted
+//	[16:20] bitsPerElement
+//	[20:32] zero
+//
+// Bit indices are derived by the V1 double-hashing, so a V2 region with the
+// V1 parameters holds the same bits.
+
+// DecodeHeaderV2 decodes a V2 header from region.
+//
+// ok=false indicates the region is zero-filled / uninitialized.
+func DecodeHeaderV2(region []byte) (h HeaderV2, ok bool, err error) {
+	if len(region) < HeaderBytesV2 {
+		return HeaderV2{}, false, ErrBadRegionSize
+	}
+
+	if bytes.Equal(region[0:4], []byte{0, 0, 0, 0}) {
+		return HeaderV2{}, false, nil
+	}
+
+	if string(region[0:4]) != MagicV2 {
+		return HeaderV2{}, false, ErrBadMagic
+	}
+	if region[4] != VersionV2 {
+		return HeaderV2{}, false, ErrBadVersion
+	}
+
+	h.BitOrder = region[5]
+	h.K = region[6]
+	h.Filters = region[7]
+	h.MBits = readU32BE(region[8:12])
+	h.NInserted = readU32BE(region[12:16])
+	h.BitsPerElement = readU32BE(region[16:20])
+
+	if err := checkHeaderV2(h); err != nil {
+		return HeaderV2{}, false, err
+	}
+	return h, true, nil
+}
+
+// EncodeHeaderV2 writes a V2 header into region.
+func EncodeHeaderV2(region []byte, h HeaderV2) error {
+	if len(region) < HeaderBytesV2 {
+		return ErrBadRegionSize
+	}
+	if err := checkHeaderV2(h); err != nil {
+		return err
+	}
+
+	copy(region[0:4], []byte(MagicV2))
+	region[4] = VersionV2
+	region[5] = h.BitOrder
+	region[6] = h.K
+	region[7] = h.Filters
+	writeU32BE(region[8:12], h.MBits)
+	writeU32BE(region[12:16], h.NInserted)
+	writeU32BE(region[16:20], h.BitsPerElement)
+	clear(region[20:HeaderBytesV2])
+	return nil
+}
+
+func checkHeaderV2(h HeaderV2) error {
+	if h.BitOrder != BitOrderLSB0 {
+		return ErrBadBitOrder
+	}
+	if h.Filters == 0 {
+		return ErrBadFilters
+	}
+	if h.K == 0 {
+		return ErrBadK
+	}
+	if h.BitsPerElement == 0 || h.MBits == 0 {
+		return ErrBadMBits
+	}
+	return nil
+}
+
+// MBitsV2 returns the bits of each filter for leafCount leaves, or
+// ErrMBitsOverflow if they do not fit the header.
+func MBitsV2(leafCount uint64, p BloomParams) (uint32, error) {
+	if leafCount == 0 {
+		return 0, ErrBadMBits
+	}
+	if err := p.Validate(); err != nil {
+		return 0, err
+	}
+	bpe := uint64(p.BitsPerElement)
+	mBits64 := MBitsV1(leafCount, bpe)
+	if mBits64/leafCount != bpe {
+		return 0, ErrMBitsOverflow
+	}
+	mBits := MBitsSafeCast(mBits64)
+	if mBits == 0 {
+		return 0, ErrMBitsOverflow
+	}
+	return mBits, nil
+}
+
+// RegionBytesV2 returns the required byte length for a V2 region with filters
+// bitsets of mBits:
+//
+//	HeaderBytesV2 + filters*ceil(mBits/8)
+func RegionBytesV2(mBits uint32, filters uint8) uint64 {
+	return uint64(HeaderBytesV2) + uint64(filters)*uint64(BitsetBytesV1(mBits))
+}
+
+// InitV2 initializes a zero-filled region with a V2 header for leafCount
+// leaves and the parameters p.
+//
+// The caller must allocate region with at least RegionBytesV2(mBits,
+// p.Filters), where mBits is from MBitsV2.
+func InitV2(region []byte, leafCount uint64, p BloomParams) error {
+	mBits, err := MBitsV2(leafCount, p)
+	if err != nil {
+		return err
+	}
+	need := RegionBytesV2(mBits, p.Filters)
+	if uint64(len(region)) < need {
+		return ErrBadRegionSize
+	}
+
+	// Ensure clean initialization even if region is reused.
+	clear(region[:need])
+
+	return EncodeHeaderV2(region, HeaderV2{
+		BitOrder:       BitOrderLSB0,
+		K:              p.K,
+		Filters:        p.Filters,
+		BitsPerElement: p.BitsPerElement,
+		MBits:          mBits,
+	})
+}
+
+// InsertV2 inserts elem into filterIdx and increments NInserted in the header.
+func InsertV2(region []byte, filterIdx uint8, elem []byte) error {
+	h, bitset, err := filterBitsetV2(region, filterIdx, elem)
+	if err != nil {
+		return err
+	}
+
+	h1, h2 := hashPairV1(filterIdx, elem)
+	setBitsLSB0(bitset, uint64(h.MBits), h.K, h1, h2)
+
+	// Update optional counter.
+	h.NInserted++
+	return EncodeHeaderV2(region, h)
+}
+
+// InsertOffsetsV2 returns the offsets, in region, of the bitset bytes InsertV2
+// sets for elem in filterIdx. As for InsertOffsetsV1, the header, the first
+// HeaderBytesV2 of the region, is also updated.
+func InsertOffsetsV2(region []byte, filterIdx uint8, elem []byte) ([]uint64, error) {
+	h, _, err := filterBitsetV2(region, filterIdx, elem)
+	if err != nil {
+		return nil, err
+	}
+	off := uint64(HeaderBytesV2) + uint64(filterIdx)*uint64(BitsetBytesV1(h.MBits))
+
+	h1, h2 := hashPairV1(filterIdx, elem)
+	offsets := make([]uint64, 0, h.K)
+	for _, byteIdx := range bitBytesLSB0(uint64(h.MBits), h.K, h1, h2) {
+		offsets = append(offsets, off+byteIdx)
+	}
+	return offsets, nil
+}
+
+// MaybeContainsV2 checks membership for elem in filterIdx.
+//
+// Returns (false,nil) if the filter says "definitely not present".
+// Returns (true,nil) if the filter says "maybe present".
+func MaybeContainsV2(region []byte, filterIdx uint8, elem []byte) (bool, error) {
+	h, bitset, err := filterBitsetV2(region, filterIdx, elem)
+	if err != nil {
+		return false, err
+	}
+
+	h1, h2 := hashPairV1(filterIdx, elem)
+	return testBitsLSB0(bitset, uint64(h.MBits), h.K, h1, h2), nil
+}
+
+// ParamsV2 returns the parameters a V2 region was initialized with.
+func ParamsV2(region []byte) (BloomParams, error) {
+	h, ok, err := DecodeHeaderV2(region)
+	if err != nil {
+		return BloomParams{}, err
+	}
+	if !ok {
+		return BloomParams{}, ErrNotInitialized
+	}
+	return BloomParams{Filters: h.Filters, K: h.K, BitsPerElement: h.BitsPerElement}, nil
+}
+
+// filterBitsetV2 checks the inputs and returns the header and the bitset of
+// filterIdx.
+func filterBitsetV2(region []byte, filterIdx uint8, elem []byte) (HeaderV2, []byte, error) {
+	if len(elem) != ValueBytes {
+		return HeaderV2{}, nil, ErrBadElemSize
+	}
+
+	h, ok, err := DecodeHeaderV2(region)
+	if err != nil {
+		return HeaderV2{}, nil, err
+	}
+	if !ok {
+		return HeaderV2{}, nil, ErrNotInitialized
+	}
+	if filterIdx >= h.Filters {
+		return HeaderV2{}, nil, ErrBadFilterIndex
+	}
+
+	bitsetBytes := uint64(BitsetBytesV1(h.MBits))
+	off := uint64(HeaderBytesV2) + uint64(filterIdx)*bitsetBytes
+	if uint64(len(region)) < off+bitsetBytes {
+		return HeaderV2{}, nil, ErrBadRegionSize
+	}
+	return h, region[off : off+bitsetBytes], nil
+}
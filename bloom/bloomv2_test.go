@@ -0,0 +1,191 @@
+package bloom
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBloomV2InsertAndQuery(t *testing.T) {
+	leafCount := uint64(128)
+	p := BloomParams{Filters: 2, K: 5, BitsPerElement: 12}
+
+	mBits, err := MBitsV2(leafCount, p)
+	require.NoError(t, err)
+	require.Equal(t, uint32(128*12), mBits)
+	region := make([]byte, RegionBytesV2(mBits, p.Filters))
+	require.Equal(t, HeaderBytesV2+2*128*12/8, len(region))
+	require.NoError(t, InitV2(region, leafCount, p))
+
+	got, err := ParamsV2(region)
+	require.NoError(t, err)
+	require.Equal(t, p, got)
+
+	elem := func(b byte) []byte {
+		x := make([]byte, ValueBytes)
+		x[0] = b
+		x[1] = b ^ 0x5A
+		return x
+	}
+
+	ok, err := MaybeContainsV2(region, 1, elem(1))
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	for i := byte(0); i < 10; i++ {
+		require.NoError(t, InsertV2(region, 1, elem(i)))
+	}
+	for i := byte(0); i < 10; i++ {
+		ok, err := MaybeContainsV2(region, 1, elem(i))
+		require.NoError(t, err)
+		require.True(t, ok)
+	}
+	// the filters are independent
+	ok, err = MaybeContainsV2(region, 0, elem(1))
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	h, ok, err := DecodeHeaderV2(region)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint32(10), h.NInserted)
+
+	// only the configured filters exist
+	require.ErrorIs(t, InsertV2(region, 2, elem(1)), ErrBadFilterIndex)
+	_, err = MaybeContainsV2(region, 2, elem(1))
+	require.ErrorIs(t, err, ErrBadFilterIndex)
+	require.ErrorIs(t, InsertV2(region, 0, elem(1)[:ValueBytes-1]), ErrBadElemSize)
+	require.ErrorIs(t, InsertV2(region[:len(region)-1], 1, elem(1)), ErrBadRegionSize)
+}
+
+func TestBloomV2MatchesV1(t *testing.T) {
+	leafCount := uint64(64)
+	bitsPerElement := uint64(10)
+	k := uint8(7)
+
+	mBits := MBitsSafeCast(MBitsV1(leafCount, bitsPerElement))
+	v1 := make([]byte, RegionBytesV1(mBits))
+	require.NoError(t, InitV1(v1, leafCount, bitsPerElement, k))
+	v2 := make([]byte, RegionBytesV2(mBits, Filters))
+	require.NoError(t, InitV2(v2, leafCount, BloomParams{Filters: Filters, K: k, BitsPerElement: uint32(bitsPerElement)}))
+
+	for i := range 20 {
+		elem := make([]byte, ValueBytes)
+		elem[0] = byte(i)
+		require.NoError(t, InsertV1(v1, uint8(i)%Filters, elem))
+		require.NoError(t, InsertV2(v2, uint8(i)%Filters, elem))
+	}
+	require.Equal(t, v1[HeaderBytesV1:], v2[HeaderBytesV2:])
+
+	// the formats do not read each other's regions
+	_, err := MaybeContainsV2(v1, 0, make([]byte, ValueBytes))
+	require.ErrorIs(t, err, ErrBadMagic)
+	_, err = MaybeContainsV1(v2, 0, make([]byte, ValueBytes))
+	require.ErrorIs(t, err, ErrBadMagic)
+}
+
+func TestHeaderV2_EncodeDecode(t *testing.T) {
+	region := make([]byte, HeaderBytesV2)
+	want := HeaderV2{
+		BitOrder:       BitOrderLSB0,
+		K:              3,
+		Filters:        6,
+		BitsPerElement: 9,
+		MBits:          900,
+		NInserted:      42,
+	}
+	require.NoError(t, EncodeHeaderV2(region, want))
+	got, ok, err := DecodeHeaderV2(region)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, want, got)
+
+	for _, tc := range []struct {
+		name   string
+		mutate func(*HeaderV2)
+		want   error
+	}{
+		{"bad bit order", func(h *HeaderV2) { h.BitOrder++ }, ErrBadBitOrder},
+		{"bad filters", func(h *HeaderV2) { h.Filters = 0 }, ErrBadFilters},
+		{"bad k", func(h *HeaderV2) { h.K = 0 }, ErrBadK},
+		{"bad bits per element", func(h *HeaderV2) { h.BitsPerElement = 0 }, ErrBadMBits},
+		{"bad mBits", func(h *HeaderV2) { h.MBits = 0 }, ErrBadMBits},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := want
+			tc.mutate(&h)
+			require.ErrorIs(t, EncodeHeaderV2(make([]byte, HeaderBytesV2), h), tc.want)
+		})
+	}
+
+	_, ok, err = DecodeHeaderV2(make([]byte, HeaderBytesV2))
+	require.NoError(t, err)
+	require.False(t, ok)
+	region[4] = VersionV1
+	_, _, err = DecodeHeaderV2(region)
+	require.ErrorIs(t, err, ErrBadVersion)
+}
+
+func TestParamsForFalsePositiveRate(t *testing.T) {
+	for _, rate := range []float64{0.1, 0.01, 0.001, 1e-6} {
+		p, err := ParamsForFalsePositiveRate(4, rate)
+		require.NoError(t, err)
+		require.NoError(t, p.Validate())
+		require.LessOrEqual(t, p.FalsePositiveRate(), rate)
+	}
+
+	p, err := ParamsForFalsePositiveRate(4, 0.01)
+	require.NoError(t, err)
+	require.Equal(t, BloomParams{Filters: 4, K: 7, BitsPerElement: 10}, p)
+
+	for _, rate := range []float64{0, 1, -0.5, 2} {
+		_, err := ParamsForFalsePositiveRate(4, rate)
+		require.ErrorIs(t, err, ErrBadFalsePositiveRate)
+	}
+	_, err = ParamsForFalsePositiveRate(0, 0.01)
+	require.ErrorIs(t, err, ErrBadFilters)
+
+	_, err = MBitsV2(1<<40, BloomParams{Filters: 4, K: 7, BitsPerElement: 10})
+	require.ErrorIs(t, err, ErrMBitsOverflow)
+}
+
+func TestBloomDispatchByMagic(t *testing.T) {
+	leafCount := uint64(64)
+	elem := make([]byte, ValueBytes)
+	elem[0] = 7
+
+	v1 := make([]byte, RegionBytesV1(MBitsSafeCast(MBitsV1(leafCount, 10))))
+	require.NoError(t, InitV1(v1, leafCount, 10, 7))
+
+	p := BloomParams{Filters: 4, K: 9, BitsPerElement: 14}
+	mBits, err := MBitsV2(leafCount, p)
+	require.NoError(t, err)
+	v2 := make([]byte, RegionBytesV2(mBits, p.Filters))
+	require.NoError(t, InitV2(v2, leafCount, p))
+	require.False(t, IsV2(v1))
+	require.True(t, IsV2(v2))
+
+	for _, region := range [][]byte{v1, v2} {
+		before := append([]byte(nil), region...)
+		offsets, err := InsertOffsets(region, 3, elem)
+		require.NoError(t, err)
+		require.NoError(t, Insert(region, 3, elem))
+		ok, err := MaybeContains(region, 3, elem)
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		// restoring the header and the offsets undoes the insert
+		copy(region[:HeaderBytesV2], before[:HeaderBytesV2])
+		for _, off := range offsets {
+			region[off] = before[off]
+		}
+		require.Equal(t, before, region)
+	}
+	// the V2 region was read with its own k
+	offsets, err := InsertOffsets(v2, 0, elem)
+	require.NoError(t, err)
+	require.Len(t, offsets, 9)
+
+	_, err = MaybeContains(make([]byte, len(v1)), 0, elem)
+	require.ErrorIs(t, err, ErrNotInitialized)
+}
@@ -62,4 +62,15 @@ This is deliberate: it allows future incompatible changes (a new header layout,
 a different hash scheme, a different bit order, etc.) to be introduced as `V2`
 side-by-side, without silently breaking previously persisted data.
 
+## V2: tunable parameters
+
+The V1 format fixes the number of filters, and regions are sized with a single
+bits-per-element constant. V2 (`InitV2`, `InsertV2`, `MaybeContainsV2`) keeps
+the V1 layout and hashing, but records the number of filters, k and the bits
+per element in its header, so each log can choose its own false positive rate.
+`ParamsForFalsePositiveRate` returns the `BloomParams` for a target rate.
+V2 regions are identified by their own magic, and V1 regions are unaffected.
+Readers holding regions of either format use `Insert`, `InsertOffsets` and
+`MaybeContains`, which select the format by the magic.
+
 */
@@ -0,0 +1,69 @@
+package bloom
+
+import "math"
+
+// BloomParams are the tunable parameters of a V2 region. The false positive
+// rate of each filter depends only on BitsPerElement and K, when the filter
+// holds the leafCount elements it was sized for.
+type BloomParams struct {
+	// Filters is the number of parallel filters, each sized for every leaf
+	Filters uint8
+	// K is the number of bits set for each element
+	K uint8
+	// BitsPerElement is the bits of each filter per leaf
+	BitsPerElement uint32
+}
+
+// ParamsForFalsePositiveRate returns the parameters giving, for a full
+// filter, a false positive rate of at most rate with the fewest bits. The
+// bits per element are -ln(rate)/ln(2)^2, rounded up, and k is the optimum
+// for them, ln(2) bits per element, rounded.
+func ParamsForFalsePositiveRate(filters uint8, rate float64) (BloomParams, error) {
+	if !(rate > 0 && rate < 1) {
+		return BloomParams{}, ErrBadFalsePositiveRate
+	}
+	if filters == 0 {
+		return BloomParams{}, ErrBadFilters
+	}
+	bpe := math.Ceil(-math.Log(rate) / (math.Ln2 * math.Ln2))
+	if bpe > math.MaxUint32 {
+		return BloomParams{}, ErrMBitsOverflow
+	}
+	k := math.Round(bpe * math.Ln2)
+	p := BloomParams{
+		Filters:        filters,
+		K:              uint8(min(max(k, 1), math.MaxUint8)),
+		BitsPerElement: uint32(bpe),
+	}
+
+	// Rounding k may leave the rate a little above the target, the next bit
+	// per element brings it back under.
+	for p.FalsePositiveRate() > rate && p.BitsPerElement < math.MaxUint32 {
+		p.BitsPerElement++
+	}
+	return p, nil
+}
+
+// FalsePositiveRate returns the expected false positive rate of a filter
+// holding the leafCount elements it was sized for, (1 - e^(-k/bpe))^k.
+func (p BloomParams) FalsePositiveRate() float64 {
+	if p.K == 0 || p.BitsPerElement == 0 {
+		return 1
+	}
+	k := float64(p.K)
+	return math.Pow(1-math.Exp(-k/float64(p.BitsPerElement)), k)
+}
+
+// Validate returns an error if the parameters can not describe a region
+func (p BloomParams) Validate() error {
+	if p.Filters == 0 {
+		return ErrBadFilters
+	}
+	if p.K == 0 {
+		return ErrBadK
+	}
+	if p.BitsPerElement == 0 {
+		return ErrBadMBits
+	}
+	return nil
+}
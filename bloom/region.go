@@ -0,0 +1,47 @@
+package bloom
+
+// A region written by InitV1 or InitV2 is identified by its magic, so readers
+// holding a region of either format can use the functions below rather than
+// know the format in advance. A zero-filled region is uninitialized.
+
+// IsV2 returns true if region has a V2 header
+func IsV2(region []byte) bool {
+	return len(region) >= HeaderBytesV2 && string(region[0:4]) == MagicV2
+}
+
+// Insert inserts elem into filterIdx of a V1 or V2 region.
+func Insert(region []byte, filterIdx uint8, elem []byte) error {
+	if IsV2(region) {
+		return InsertV2(region, filterIdx, elem)
+	}
+	return InsertV1(region, filterIdx, elem)
+}
+
+// InsertOffsets returns the offsets, in region, of the bitset bytes Insert
+// sets for elem in filterIdx. The header, HeaderBytesV1 or HeaderBytesV2 for
+// either format, is also updated.
+func InsertOffsets(region []byte, filterIdx uint8, elem []byte) ([]uint64, error) {
+	if IsV2(region) {
+		return InsertOffsetsV2(region, filterIdx, elem)
+	}
+	return InsertOffsetsV1(region, filterIdx, elem)
+}
+
+// MaybeContains checks membership for elem in filterIdx of a V1 or V2 region.
+func MaybeContains(region []byte, filterIdx uint8, elem []byte) (bool, error) {
+	if IsV2(region) {
+		return MaybeContainsV2(region, filterIdx, elem)
+	}
+	return MaybeContainsV1(region, filterIdx, elem)
+}
+
+// Initialized returns true if region has a V1 or V2 header, false if it is
+// zero-filled.
+func Initialized(region []byte) (bool, error) {
+	if IsV2(region) {
+		_, ok, err := DecodeHeaderV2(region)
+		return ok, err
+	}
+	_, ok, err := DecodeHeaderV1(region)
+	return ok, err
+}
@@ -15,6 +15,12 @@ const (
 	MagicV1         = "BLM1"
 	VersionV1 uint8 = 1
 
+	// HeaderBytesV2 is the fixed header size for BloomHeaderV2.
+	HeaderBytesV2 = 32
+
+	MagicV2         = "BLM2"
+	VersionV2 uint8 = 2
+
 	// BitOrderLSB0 means bit 0 is the least-significant bit of byte 0.
 	BitOrderLSB0 uint8 = 0
 )
@@ -33,6 +39,8 @@ var (
 	ErrBadMBits    = errors.New("bloom: header mBits invalid")
 
 	ErrMBitsOverflow = errors.New("bloom: mBits overflows supported range")
+
+	ErrBadFalsePositiveRate = errors.New("bloom: false positive rate must be between 0 and 1")
 )
 
 type HeaderV1 struct {
@@ -41,3 +49,14 @@ type HeaderV1 struct {
 	MBits     uint32
 	NInserted uint32
 }
+
+// HeaderV2 is the V2 header. Unlike V1 it records the number of filters and
+// the bits per element the region was sized with.
+type HeaderV2 struct {
+	BitOrder       uint8
+	K              uint8
+	Filters        uint8
+	BitsPerElement uint32
+	MBits          uint32
+	NInserted      uint32
+}
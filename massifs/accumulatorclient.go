@@ -0,0 +1,262 @@
+package massifs
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	commoncose "github.com/forestrie/go-merklelog/massifs/cose"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/veraison/go-cose"
+)
+
+var (
+	ErrTrustedStateInvalid = errors.New("the trusted state is not a valid mmr state")
+	ErrNoTrustedState      = errors.New("the proof does not start from a trusted state")
+	ErrNotTrusted          = errors.New("the proof does not verify against a trusted state")
+)
+
+// AccumulatorClient verifies proofs against trusted MMRState values alone. It
+// never reads log data: inclusion proofs, receipts, consistency proofs and
+// checkpoints are supplied by the caller, typically in a bundle from a
+// service the client does not trust. Only the states, a few peak hashes
+// each, are kept, which suits constrained verifiers.
+//
+// The trusted states are those the client was created with, and those of
+// the checkpoints it has verified as consistent with them. The client is
+// safe for concurrent use.
+type AccumulatorClient struct {
+	mu       sync.RWMutex
+	verifier cose.Verifier
+	// states is ordered by ascending size, one per size
+	states []MMRState
+}
+
+// NewAccumulatorClient creates a client trusting the states. The verifier is
+// the log's, obtained from a trusted store. It is only needed to verify
+// checkpoints and the signatures of receipts, and may be nil otherwise.
+func NewAccumulatorClient(verifier cose.Verifier, trusted ...MMRState) (*AccumulatorClient, error) {
+	c := &AccumulatorClient{verifier: verifier}
+	for _, state := range trusted {
+		if err := c.trust(state); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// States returns the trusted states in ascending size order
+func (c *AccumulatorClient) States() []MMRState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return slices.Clone(c.states)
+}
+
+// Latest returns the largest trusted state. ok is false if there is none.
+func (c *AccumulatorClient) Latest() (state MMRState, ok bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if len(c.states) == 0 {
+		return MMRState{}, false
+	}
+	return c.states[len(c.states)-1], true
+}
+
+// VerifyInclusion verifies the node value is at mmrIndex in the trusted state
+// of size mmrSize, by the inclusion proof for that size.
+func (c *AccumulatorClient) VerifyInclusion(mmrSize, mmrIndex uint64, nodeHash []byte, proof [][]byte) error {
+	state, ok := c.state(mmrSize)
+	if !ok {
+		return fmt.Errorf("%w: size %d", ErrNoTrustedState, mmrSize)
+	}
+	if mmrIndex >= mmrSize {
+		return fmt.Errorf("%w: mmr index %d is not in MMR(%d)", ErrNotTrusted, mmrIndex, mmrSize)
+	}
+	root := mmr.IncludedRoot(sha256.New(), mmrIndex, nodeHash, proof)
+	if !bytes.Equal(root, state.Peaks[committingPeak(mmrSize, mmrIndex)]) {
+		return fmt.Errorf("%w: %v: mmr index %d in MMR(%d)",
+			ErrNotTrusted, mmr.ErrVerifyInclusionFailed, mmrIndex, mmrSize)
+	}
+	return nil
+}
+
+// VerifyReceipt verifies a receipt of inclusion, as minted by NewReceipt, for
+// the node value. The root the receipt's inclusion proof produces must be a
+// peak of a trusted state, and if the client has a verifier, the receipt
+// signature must verify over it. Returns the trusted state the proof reaches.
+func (c *AccumulatorClient) VerifyReceipt(receipt *commoncose.CoseSign1Message, nodeHash []byte) (MMRState, error) {
+	var header MMRiverVerifiableProofsHeader
+	if err := cbor.Unmarshal(receipt.Headers.RawUnprotected, &header); err != nil {
+		return MMRState{}, fmt.Errorf("MMRIVER receipt proofs malformed: %w", err)
+	}
+	if len(header.VerifiableProofs.InclusionProofs) != 1 {
+		return MMRState{}, fmt.Errorf("MMRIVER receipt has %d inclusion proofs, one is required",
+			len(header.VerifiableProofs.InclusionProofs))
+	}
+	proof := header.VerifiableProofs.InclusionProofs[0]
+	root := mmr.IncludedRoot(sha256.New(), proof.Index, nodeHash, proof.InclusionPath)
+
+	state, ok := c.peakState(proof.Index, root)
+	if !ok {
+		return MMRState{}, fmt.Errorf("%w: the receipt for mmr index %d proves a root which is not a trusted peak",
+			ErrNotTrusted, proof.Index)
+	}
+	if c.verifier != nil {
+		receipt.Payload = root
+		if err := receipt.Verify(nil, c.verifier); err != nil {
+			return MMRState{}, fmt.Errorf("%w: receipt for mmr index %d: %v", ErrSealVerifyFailed, proof.Index, err)
+		}
+	}
+	return state, nil
+}
+
+// VerifyConsistency verifies the proof carries the trusted state of its
+// tree-size-1 to the trusted state of its tree-size-2. Use it to check two
+// states obtained independently are of the same log.
+func (c *AccumulatorClient) VerifyConsistency(proof ConsistencyProof) error {
+	to, ok := c.state(proof.TreeSize2)
+	if !ok {
+		return fmt.Errorf("%w: size %d", ErrNoTrustedState, proof.TreeSize2)
+	}
+	accumulator, err := c.prove(proof)
+	if err != nil {
+		return err
+	}
+	if !peaksEqual(accumulator, to.Peaks) {
+		return fmt.Errorf("%w: %v: %d -> %d", ErrNotTrusted, mmr.ErrConsistencyCheck, proof.TreeSize1, proof.TreeSize2)
+	}
+	return nil
+}
+
+// VerifyCheckpoint verifies a checkpoint, the stored bytes, and trusts the
+// state it seals. The accumulator is reconstructed from its consistency
+// proof, which must start from a trusted state, or, only while the client
+// trusts none, from the empty log. A checkpoint for a size already trusted
+// must agree with it. Returns the state.
+func (c *AccumulatorClient) VerifyCheckpoint(data []byte) (MMRState, error) {
+	if c.verifier == nil {
+		return MMRState{}, ErrVerifierRequired
+	}
+	check, err := NewCheckpoint(data)
+	if err != nil {
+		return MMRState{}, err
+	}
+	accumulator, err := c.prove(check.Receipt.Proof)
+	if err != nil {
+		return MMRState{}, err
+	}
+	err = c.verifier.Verify(
+		SigStructure(check.Receipt.ProtectedHeader, DetachedPayload(accumulator)),
+		check.Receipt.Signature,
+	)
+	if err != nil {
+		return MMRState{}, fmt.Errorf(
+			"%w: checkpoint receipt for sealed size %d: %v", ErrSealVerifyFailed, check.MMRSize, err)
+	}
+	state := MMRState{MMRSize: check.MMRSize, Peaks: accumulator}
+	if err = c.trust(state); err != nil {
+		return MMRState{}, err
+	}
+	return state, nil
+}
+
+// prove returns the accumulator of the proof's tree-size-2, reconstructed
+// from the trusted state of its tree-size-1.
+func (c *AccumulatorClient) prove(proof ConsistencyProof) ([][]byte, error) {
+	var from [][]byte
+	if proof.TreeSize1 > 0 {
+		state, ok := c.state(proof.TreeSize1)
+		if !ok {
+			return nil, fmt.Errorf("%w: size %d", ErrNoTrustedState, proof.TreeSize1)
+		}
+		from = state.Peaks
+	} else if _, ok := c.Latest(); ok {
+		return nil, fmt.Errorf("%w: the proof is from the empty log", ErrNoTrustedState)
+	}
+	accumulator, err := CheckpointAccumulator(from, proof)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotTrusted, err)
+	}
+	return accumulator, nil
+}
+
+// state returns the trusted state of the size
+func (c *AccumulatorClient) state(mmrSize uint64) (MMRState, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	i, ok := slices.BinarySearchFunc(c.states, mmrSize, func(s MMRState, size uint64) int {
+		return cmp.Compare(s.MMRSize, size)
+	})
+	if !ok {
+		return MMRState{}, false
+	}
+	return c.states[i], true
+}
+
+// peakState returns the smallest trusted state with root as the peak
+// committing mmrIndex.
+func (c *AccumulatorClient) peakState(mmrIndex uint64, root []byte) (MMRState, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, state := range c.states {
+		if mmrIndex >= state.MMRSize {
+			continue
+		}
+		if bytes.Equal(state.Peaks[committingPeak(state.MMRSize, mmrIndex)], root) {
+			return state, true
+		}
+	}
+	return MMRState{}, false
+}
+
+// trust adds the state, which must agree with any already trusted for its
+// size.
+func (c *AccumulatorClient) trust(state MMRState) error {
+	if state.MMRSize == 0 || mmr.FirstMMRSize(state.MMRSize-1) != state.MMRSize ||
+		len(state.Peaks) != len(mmr.Peaks(state.MMRSize-1)) {
+		return fmt.Errorf("%w: size %d with %d peaks", ErrTrustedStateInvalid, state.MMRSize, len(state.Peaks))
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i, ok := slices.BinarySearchFunc(c.states, state.MMRSize, func(s MMRState, size uint64) int {
+		return cmp.Compare(s.MMRSize, size)
+	})
+	if ok {
+		if !peaksEqual(c.states[i].Peaks, state.Peaks) {
+			return fmt.Errorf("%w: two different states of size %d", ErrSourceLogInconsistentRootState, state.MMRSize)
+		}
+		return nil
+	}
+	c.states = slices.Insert(c.states, i, MMRState{MMRSize: state.MMRSize, Peaks: clonePeaks(state.Peaks)})
+	return nil
+}
+
+// committingPeak returns the accumulator index of the peak committing
+// mmrIndex, which must be less than mmrSize. Peaks ascend in position and
+// each covers the range between its predecessor and itself.
+func committingPeak(mmrSize, mmrIndex uint64) int {
+	peaks := mmr.Peaks(mmrSize - 1)
+	for i, position := range peaks {
+		if mmrIndex <= position {
+			return i
+		}
+	}
+	return len(peaks) - 1
+}
+
+func peaksEqual(a, b [][]byte) bool {
+	return slices.EqualFunc(a, b, bytes.Equal)
+}
+
+func clonePeaks(peaks [][]byte) [][]byte {
+	cloned := make([][]byte, len(peaks))
+	for i, peak := range peaks {
+		cloned[i] = bytes.Clone(peak)
+	}
+	return cloned
+}
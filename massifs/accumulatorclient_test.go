@@ -0,0 +1,114 @@
+package massifs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	commoncbor "github.com/forestrie/go-merklelog/massifs/cbor"
+	commoncose "github.com/forestrie/go-merklelog/massifs/cose"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccumulatorClient(t *testing.T) {
+	store, sizes := newFixtureMMR(t, 7)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer := commoncose.NewTestCoseSigner(t, *key)
+	verifier := newES256Verifier(t, &key.PublicKey)
+
+	sign := func(fromSize, toSize uint64) []byte {
+		proof, err := BuildConsistencyProof(store, fromSize, toSize)
+		require.NoError(t, err)
+		accumulator, err := mmr.PeakHashes(store, toSize-1)
+		require.NoError(t, err)
+		data, err := SignCheckpointReceipt(signer, proof, accumulator)
+		require.NoError(t, err)
+		return data
+	}
+	first, second := sign(0, sizes[2]), sign(sizes[2], sizes[6])
+
+	// the second checkpoint is only accepted once the first is trusted
+	client, err := NewAccumulatorClient(verifier)
+	require.NoError(t, err)
+	_, err = client.VerifyCheckpoint(second)
+	require.ErrorIs(t, err, ErrNoTrustedState)
+	_, err = client.VerifyCheckpoint(first)
+	require.NoError(t, err)
+	state, err := client.VerifyCheckpoint(second)
+	require.NoError(t, err)
+	require.Equal(t, sizes[6], state.MMRSize)
+	require.Len(t, client.States(), 2)
+	latest, ok := client.Latest()
+	require.True(t, ok)
+	require.Equal(t, state, latest)
+
+	// once a state is trusted, a checkpoint from the empty log is not
+	_, err = client.VerifyCheckpoint(sign(0, sizes[4]))
+	require.ErrorIs(t, err, ErrNoTrustedState)
+
+	for i := range sizes[6] {
+		proof, err := mmr.InclusionProof(store, sizes[6]-1, i)
+		require.NoError(t, err)
+		node, err := store.Get(i)
+		require.NoError(t, err)
+		require.NoError(t, client.VerifyInclusion(sizes[6], i, node, proof))
+
+		tampered := append([]byte(nil), node...)
+		tampered[0] ^= 0x01
+		require.ErrorIs(t, client.VerifyInclusion(sizes[6], i, tampered, proof), ErrNotTrusted)
+	}
+	require.ErrorIs(t, client.VerifyInclusion(sizes[4], 0, nil, nil), ErrNoTrustedState)
+
+	proof, err := BuildConsistencyProof(store, sizes[2], sizes[6])
+	require.NoError(t, err)
+	require.NoError(t, client.VerifyConsistency(proof))
+	proof.RightPeaks[0][0] ^= 0x01
+	require.ErrorIs(t, client.VerifyConsistency(proof), ErrNotTrusted)
+
+	// a trusted state must be a complete mmr
+	_, err = NewAccumulatorClient(nil, MMRState{MMRSize: 2, Peaks: [][]byte{{1}}})
+	require.ErrorIs(t, err, ErrTrustedStateInvalid)
+}
+
+func TestAccumulatorClientVerifyReceipt(t *testing.T) {
+	mc := buildLegacyBlobMassif0(t, 1 /*blobVersion*/, 3 /*massifHeight*/, 3 /*leaves*/)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer := commoncose.NewTestCoseSigner(t, *key)
+	verifier := newES256Verifier(t, &key.PublicKey)
+
+	proof, err := BuildConsistencyProof(&mc, 0, mc.RangeCount())
+	require.NoError(t, err)
+	accumulator, err := mmr.PeakHashes(&mc, mc.RangeCount()-1)
+	require.NoError(t, err)
+	signed, err := SignCheckpointReceipt(signer, proof, accumulator, WithPeakReceipts([]byte("log-key-1")))
+	require.NoError(t, err)
+	store := newMemStore(mc.Data, signed)
+
+	client, err := NewAccumulatorClient(verifier, MMRState{MMRSize: mc.RangeCount(), Peaks: accumulator})
+	require.NoError(t, err)
+	for mmrIndex := range mc.RangeCount() {
+		node, err := mc.Get(mmrIndex)
+		require.NoError(t, err)
+		minted, err := NewReceipt(context.Background(), store, verifier, 3, mmrIndex)
+		require.NoError(t, err)
+		encoded, err := minted.MarshalCBOR()
+		require.NoError(t, err)
+		receipt, err := commoncose.NewCoseSign1MessageFromCBOR(
+			encoded, commoncose.WithDecOptions(commoncbor.DecOptions))
+		require.NoError(t, err)
+
+		state, err := client.VerifyReceipt(receipt, node)
+		require.NoError(t, err, "receipt for mmr index %d", mmrIndex)
+		require.Equal(t, mc.RangeCount(), state.MMRSize)
+
+		tampered := append([]byte(nil), node...)
+		tampered[0] ^= 0x01
+		_, err = client.VerifyReceipt(receipt, tampered)
+		require.ErrorIs(t, err, ErrNotTrusted)
+	}
+}
@@ -0,0 +1,75 @@
+package massifs
+
+import (
+	"errors"
+	"fmt"
+
+	commoncose "github.com/forestrie/go-merklelog/massifs/cose"
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/google/uuid"
+)
+
+var ErrNoSealIdentity = errors.New("the checkpoint protected header carries no cwt issuer or subject")
+
+// anonymousLogIDNameFmt is the name (in the URL namespace) hashed to derive a
+// placeholder log identity. It is fixed so that placeholders are stable
+// across tools and releases.
+const anonymousLogIDNameFmt = "urn:forestrie:merklelog:anonymous:%s:%s"
+
+// SealIdentity returns the CWT issuer and subject claims from a checkpoint's
+// protected header (label 15, or the pre-registration draft label 13). Sealers
+// add these claims when they know the log's identity; format-v3 checkpoints
+// that omit them return ErrNoSealIdentity.
+func SealIdentity(protectedHeader []byte) (string, string, error) {
+	var header map[int64]cbor.RawMessage
+	if err := cbor.Unmarshal(protectedHeader, &header); err != nil {
+		return "", "", fmt.Errorf("decode protected header: %w", err)
+	}
+	raw, ok := header[commoncose.HeaderLabelCWTClaims]
+	if !ok {
+		raw, ok = header[commoncose.HeaderLabelCWTClaimsDraft]
+	}
+	if !ok {
+		return "", "", ErrNoSealIdentity
+	}
+	var claims map[int64]cbor.RawMessage
+	if err := cbor.Unmarshal(raw, &claims); err != nil {
+		return "", "", fmt.Errorf("decode cwt claims: %w", err)
+	}
+
+	var issuer, subject string
+	if v, ok := claims[1]; ok {
+		if err := cbor.Unmarshal(v, &issuer); err != nil {
+			return "", "", fmt.Errorf("decode cwt issuer: %w", err)
+		}
+	}
+	if v, ok := claims[2]; ok {
+		if err := cbor.Unmarshal(v, &subject); err != nil {
+			return "", "", fmt.Errorf("decode cwt subject: %w", err)
+		}
+	}
+	if issuer == "" && subject == "" {
+		return "", "", ErrNoSealIdentity
+	}
+	return issuer, subject, nil
+}
+
+// AnonymousLogID synthesizes a stable placeholder log identity for a log whose
+// storage path does not encode one (for example, a bare directory of .log and
+// .sth files handed to an auditor). The identity is a name based (v5) uuid of
+// the seal's issuer and subject, so every checkpoint from the same log yields
+// the same placeholder. It is a label for caches and reports, it is not
+// authenticated by anything other than the checkpoint signature.
+func AnonymousLogID(receipt *CheckpointReceipt) (storage.LogID, error) {
+	issuer, subject, err := SealIdentity(receipt.ProtectedHeader)
+	if err != nil {
+		return nil, err
+	}
+	return anonymousLogID(issuer, subject), nil
+}
+
+func anonymousLogID(issuer, subject string) storage.LogID {
+	id := uuid.NewSHA1(uuid.NameSpaceURL, fmt.Appendf(nil, anonymousLogIDNameFmt, issuer, subject))
+	return storage.LogID(id[:])
+}
@@ -0,0 +1,99 @@
+package massifs
+
+import (
+	"github.com/forestrie/go-merklelog/bloom"
+	"github.com/forestrie/go-merklelog/urkle"
+)
+
+// appendUndo rolls back a failed AddHashedLeaves. The log region is only
+// appended to, so it is restored by its length. The start header, and the
+// bloom and urkle bytes each leaf changes in place, are saved before they
+// change, so the cost is that of the batch rather than of the massif.
+type appendUndo struct {
+	dataLen      int
+	start        MassifStart
+	nextAncestor int
+
+	// saved holds the bytes of each range, in the order they were saved
+	saved    []byte
+	ranges   []undoRange
+	frontier bool
+}
+
+// undoRange is n bytes of the data at off, saved at saved[at:]
+type undoRange struct {
+	off, n, at uint64
+}
+
+func newAppendUndo(mc *MassifContext) *appendUndo {
+	u := &appendUndo{dataLen: len(mc.Data), start: mc.Start, nextAncestor: mc.nextAncestor}
+	// the last idtimestamp and the urkle root are start header words
+	u.save(mc.Data, 0, StartHeaderEnd)
+	return u
+}
+
+// save records data[off:off+n]
+func (u *appendUndo) save(data []byte, off, n uint64) {
+	u.ranges = append(u.ranges, undoRange{off: off, n: n, at: uint64(len(u.saved))})
+	u.saved = append(u.saved, data[off:off+n]...)
+}
+
+// saveRegion records all of region, a slice of mc.Data
+func (u *appendUndo) saveRegion(mc *MassifContext, region []byte) {
+	u.save(mc.Data, dataOffset(mc, region), uint64(len(region)))
+}
+
+// saveBloomInsert records the bytes of region, the bloom region of mc, which
+// bloom.Insert changes for elem
+func (u *appendUndo) saveBloomInsert(mc *MassifContext, region []byte, filterIdx uint8, elem []byte) error {
+	offsets, err := bloom.InsertOffsets(region, filterIdx, elem)
+	if err != nil {
+		return err
+	}
+	base := dataOffset(mc, region)
+	// the V1 and V2 headers are the same size
+	u.save(mc.Data, base, bloom.HeaderBytesV2)
+	for _, off := range offsets {
+		u.save(mc.Data, base+off, 1)
+	}
+	return nil
+}
+
+// saveUrkleInsert records the urkle bytes an insert, and the finalize which
+// may follow it, can change: the frontier, the next leaf record and the node
+// records after the last emitted. Nodes are only appended, one for the leaf
+// and one for each frame closed, and at most one frame is opened.
+func (u *appendUndo) saveUrkleInsert(
+	mc *MassifContext, st urkle.FrontierStateV1, frontier, leafTable, nodeStore []byte,
+) {
+	if !u.frontier {
+		u.saveRegion(mc, frontier)
+		u.frontier = true
+	}
+	if off := urkle.LeafRecordOffset(st.NextLeaf); off+urkle.LeafRecordBytes <= uint64(len(leafTable)) {
+		u.save(mc.Data, dataOffset(mc, leafTable)+off, urkle.LeafRecordBytes)
+	}
+	first := uint64(st.Next) * urkle.NodeRecordBytes
+	end := min(first+(uint64(st.Depth)+2)*urkle.NodeRecordBytes, uint64(len(nodeStore)))
+	if first < end {
+		u.save(mc.Data, dataOffset(mc, nodeStore)+first, end-first)
+	}
+}
+
+// restore puts back the saved bytes, the latest first so that the earliest
+// save of any byte wins, then the length of the data and the context state.
+func (u *appendUndo) restore(mc *MassifContext) {
+	for i := len(u.ranges) - 1; i >= 0; i-- {
+		r := u.ranges[i]
+		copy(mc.Data[r.off:r.off+r.n], u.saved[r.at:r.at+r.n])
+	}
+	mc.Data = mc.Data[:u.dataLen]
+	mc.Start, mc.nextAncestor = u.start, u.nextAncestor
+	clear(mc.peakMemo)
+}
+
+// dataOffset returns the offset in mc.Data of region, which must be a slice of
+// it, as the index region accessors return
+func dataOffset(mc *MassifContext, region []byte) uint64 {
+	return uint64(cap(mc.Data) - cap(region))
+}
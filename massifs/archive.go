@@ -0,0 +1,325 @@
+package massifs
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/veraison/go-cose"
+)
+
+// ArchiveManifestName is the name of the manifest entry, the last entry of an
+// archive
+const ArchiveManifestName = "manifest.json"
+
+// ArchiveVersion is the version of the archive layout ExportArchive writes
+const ArchiveVersion = 1
+
+// ErrArchiveInvalid is returned by ImportArchive for an archive which is not
+// in the layout ExportArchive writes, or which does not match its manifest.
+var ErrArchiveInvalid = errors.New("the log archive is invalid")
+
+const (
+	// MaxArchiveCheckpointBytes bounds the checkpoint entries ImportArchive
+	// reads. A checkpoint holds a consistency proof, and a receipt for each
+	// peak, of at most MaxMMRHeight hashes each.
+	MaxArchiveCheckpointBytes = 1 << 20
+	// maxArchiveManifestMassifBytes bounds the manifest bytes of each massif
+	// imported, the hex of two digests with the field names is well under.
+	maxArchiveManifestMassifBytes = 512
+)
+
+// ArchiveMassif is the manifest entry of one massif and its checkpoint
+type ArchiveMassif struct {
+	MassifIndex uint32 `json:"massifIndex"`
+	// MMRSize is the size sealed by the checkpoint
+	MMRSize          uint64 `json:"mmrSize"`
+	MassifSHA256     []byte `json:"massifSHA256"`
+	CheckpointSHA256 []byte `json:"checkpointSHA256"`
+}
+
+// ArchiveManifest describes the contents of a log archive
+type ArchiveManifest struct {
+	Version int `json:"version"`
+	// Tenant is the tenant the checkpoints were checked to be issued by, if
+	// one was given to ExportArchive
+	Tenant     string          `json:"tenant,omitempty"`
+	ExportedAt time.Time       `json:"exportedAt"`
+	Massifs    []ArchiveMassif `json:"massifs"`
+}
+
+// ExportArchive writes every sealed massif of the log, and its checkpoint, to
+// w as a tar archive, for offline escrow or to move a log between storage
+// backends, see ImportArchive. Each massif is followed by its checkpoint,
+// named as they are in a log directory, so an unpacked archive can be read
+// with NewDirReader. The manifest is the last entry, it lists the digests of
+// the objects written.
+//
+// Every massif up to the last checkpoint must be sealed. If tenant is not
+// empty the checkpoints must be issued by it, as for ListCheckpoints. Nothing
+// is verified on export, ImportArchive verifies the whole log.
+func ExportArchive(ctx context.Context, reader ObjectReader, tenant string, w io.Writer) (*ArchiveManifest, error) {
+	infos, err := ListCheckpoints(ctx, reader, tenant)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &ArchiveManifest{Version: ArchiveVersion, Tenant: tenant, ExportedAt: time.Now().UTC()}
+	tw := tar.NewWriter(w)
+	for i, info := range infos {
+		if info.MassifIndex != uint32(i) {
+			return nil, fmt.Errorf("%w: massif %d has no checkpoint", ErrSealNotFound, i)
+		}
+		data, err := GetMassifData(ctx, reader, info.MassifIndex)
+		if err != nil {
+			return nil, fmt.Errorf("massif %d: %w", info.MassifIndex, err)
+		}
+		if err = writeArchiveEntry(tw, storage.FmtMassifPath("", info.MassifIndex), data, manifest.ExportedAt); err != nil {
+			return nil, err
+		}
+		raw := info.Checkpoint.Raw
+		if err = writeArchiveEntry(tw, storage.FmtCheckpointPath("", info.MassifIndex), raw, manifest.ExportedAt); err != nil {
+			return nil, err
+		}
+		massifSum, checkpointSum := sha256.Sum256(data), sha256.Sum256(raw)
+		manifest.Massifs = append(manifest.Massifs, ArchiveMassif{
+			MassifIndex:      info.MassifIndex,
+			MMRSize:          info.MMRSize,
+			MassifSHA256:     massifSum[:],
+			CheckpointSHA256: checkpointSum[:],
+		})
+	}
+	encoded, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	if err = writeArchiveEntry(tw, ArchiveManifestName, encoded, manifest.ExportedAt); err != nil {
+		return nil, err
+	}
+	if err = tw.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func writeArchiveEntry(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg, Name: name, Size: int64(len(data)), Mode: 0o644, ModTime: modTime,
+	})
+	if err != nil {
+		return fmt.Errorf("archive %s: %w", name, err)
+	}
+	if _, err = tw.Write(data); err != nil {
+		return fmt.Errorf("archive %s: %w", name, err)
+	}
+	return nil
+}
+
+// ImportArchive reads an archive written by ExportArchive and puts its
+// objects to sink as it unpacks them. Each massif is verified against its
+// checkpoint, with verifier and the verification options in opts, and as
+// consistent with the massif before it, before it is put. The digests of
+// the objects are checked against the manifest once it is read. An archive
+// which fails part way has put the massifs verified before the failure.
+// Entries are size checked before they are read: a massif can be no larger
+// than a complete massif of its height, a checkpoint no larger than
+// MaxArchiveCheckpointBytes.
+//
+// Returns the manifest of the archive.
+func ImportArchive(
+	ctx context.Context, r io.Reader, sink ObjectWriter, verifier cose.Verifier, opts ...Option,
+) (*ArchiveManifest, error) {
+	tr := tar.NewReader(r)
+	var imported []ArchiveMassif
+	var objects *archiveObjects
+	var trusted *MMRState
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w: there is no manifest", ErrArchiveInvalid)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Name == ArchiveManifestName {
+			limit := uint64(len(imported)+1) * maxArchiveManifestMassifBytes
+			data, err := readArchiveEntry(tr, header, limit)
+			if err != nil {
+				return nil, err
+			}
+			return checkArchiveManifest(data, imported, tr)
+		}
+
+		otype, massifIndex, err := storage.ObjectIndexFromPath(header.Name)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unexpected entry %s", ErrArchiveInvalid, header.Name)
+		}
+		next := uint32(len(imported))
+		switch {
+		case otype == storage.ObjectMassifData && objects == nil && massifIndex == next:
+			data, err := readArchiveMassif(tr, header, massifIndex)
+			if err != nil {
+				return nil, err
+			}
+			objects = &archiveObjects{massifIndex: massifIndex, massif: data}
+			continue
+		case otype == storage.ObjectCheckpoint && objects != nil && massifIndex == next:
+			if objects.checkpoint, err = readArchiveEntry(tr, header, MaxArchiveCheckpointBytes); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("%w: unexpected entry %s, massif %d is next", ErrArchiveInvalid, header.Name, next)
+		}
+
+		verifyOpts := opts
+		if trusted != nil {
+			verifyOpts = append(verifyOpts[:len(verifyOpts):len(verifyOpts)], WithVerifyTrustedState(*trusted))
+		}
+		vc, err := GetContextVerified(ctx, objects, verifier, massifIndex, verifyOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("massif %d: %w", massifIndex, err)
+		}
+		if vc.Start.MassifIndex != massifIndex {
+			return nil, fmt.Errorf("%w: entry %d holds massif %d", ErrArchiveInvalid, massifIndex, vc.Start.MassifIndex)
+		}
+		if err = ReplaceVerifiedContext(ctx, sink, vc); err != nil {
+			return nil, fmt.Errorf("massif %d: %w", massifIndex, err)
+		}
+		trusted = &MMRState{MMRSize: vc.Checkpoint.MMRSize, Peaks: vc.Accumulator}
+		massifSum, checkpointSum := sha256.Sum256(objects.massif), sha256.Sum256(objects.checkpoint)
+		imported = append(imported, ArchiveMassif{
+			MassifIndex:      massifIndex,
+			MMRSize:          vc.Checkpoint.MMRSize,
+			MassifSHA256:     massifSum[:],
+			CheckpointSHA256: checkpointSum[:],
+		})
+		objects = nil
+	}
+}
+
+// readArchiveMassif reads a massif entry. The size of a massif is fixed by
+// the version and height in its start header, a larger entry is refused
+// before the rest of it is read.
+func readArchiveMassif(tr *tar.Reader, header *tar.Header, massifIndex uint32) ([]byte, error) {
+	if header.Size < StartHeaderEnd {
+		return nil, fmt.Errorf("%w: entry %s has no start header", ErrArchiveInvalid, header.Name)
+	}
+	start := make([]byte, StartHeaderEnd)
+	if _, err := io.ReadFull(tr, start); err != nil {
+		return nil, fmt.Errorf("archive %s: %w", header.Name, err)
+	}
+	ms := MakeMassifStart(start)
+	// Bounds the size for every version, not only those with the v2 index
+	if err := CheckMassifHeightV2(ms.MassifHeight); err != nil {
+		return nil, fmt.Errorf("%w: entry %s: %w", ErrArchiveInvalid, header.Name, err)
+	}
+	// The size of the massif the entry is named for, with the bloom sizing
+	// its start records
+	ms.MassifIndex = massifIndex
+	ms.FirstIndex = MassifFirstLeaf(ms.MassifHeight, massifIndex)
+	ms.PeakStackLen = PeakStackLen(uint64(massifIndex))
+	f, err := ms.Format()
+	if err != nil {
+		return nil, fmt.Errorf("%w: entry %s: %w", ErrArchiveInvalid, header.Name, err)
+	}
+	limit := f.Size()
+	if uint64(header.Size) > limit {
+		return nil, fmt.Errorf("%w: entry %s is %d bytes, a massif is at most %d",
+			ErrArchiveInvalid, header.Name, header.Size, limit)
+	}
+	data := make([]byte, header.Size)
+	copy(data, start)
+	if _, err := io.ReadFull(tr, data[StartHeaderEnd:]); err != nil {
+		return nil, fmt.Errorf("archive %s: %w", header.Name, err)
+	}
+	return data, nil
+}
+
+// readArchiveEntry reads an entry, refusing one larger than limit before it
+// is read
+func readArchiveEntry(tr *tar.Reader, header *tar.Header, limit uint64) ([]byte, error) {
+	if header.Size < 0 || uint64(header.Size) > limit {
+		return nil, fmt.Errorf("%w: entry %s is %d bytes, the limit is %d",
+			ErrArchiveInvalid, header.Name, header.Size, limit)
+	}
+	data := make([]byte, header.Size)
+	if _, err := io.ReadFull(tr, data); err != nil {
+		return nil, fmt.Errorf("archive %s: %w", header.Name, err)
+	}
+	return data, nil
+}
+
+// checkArchiveManifest decodes the manifest and checks it lists exactly the
+// massifs imported, and that it is the last entry
+func checkArchiveManifest(data []byte, imported []ArchiveMassif, tr *tar.Reader) (*ArchiveManifest, error) {
+	var manifest ArchiveManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("%w: the manifest: %v", ErrArchiveInvalid, err)
+	}
+	if manifest.Version != ArchiveVersion {
+		return nil, fmt.Errorf("%w: archive version %d", ErrArchiveInvalid, manifest.Version)
+	}
+	if _, err := tr.Next(); !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: the manifest is not the last entry", ErrArchiveInvalid)
+	}
+	if len(manifest.Massifs) != len(imported) {
+		return nil, fmt.Errorf("%w: the manifest lists %d massifs, the archive has %d",
+			ErrArchiveInvalid, len(manifest.Massifs), len(imported))
+	}
+	for i, m := range manifest.Massifs {
+		got := imported[i]
+		if m.MassifIndex != got.MassifIndex || m.MMRSize != got.MMRSize ||
+			!bytes.Equal(m.MassifSHA256, got.MassifSHA256) || !bytes.Equal(m.CheckpointSHA256, got.CheckpointSHA256) {
+			return nil, fmt.Errorf("%w: massif %d does not match the manifest", ErrArchiveInvalid, got.MassifIndex)
+		}
+	}
+	return &manifest, nil
+}
+
+// archiveObjects is an ObjectReader over the massif, and its checkpoint, read
+// from an archive, so it is verified exactly as a stored massif is
+type archiveObjects struct {
+	massifIndex uint32
+	massif      []byte
+	checkpoint  []byte
+}
+
+func (a *archiveObjects) HeadIndex(ctx context.Context, otype storage.ObjectType) (uint32, error) {
+	return a.massifIndex, nil
+}
+
+func (a *archiveObjects) MassifData(massifIndex uint32) ([]byte, bool, error) {
+	if massifIndex != a.massifIndex {
+		return nil, false, storage.NewNotFoundError(nil, storage.ObjectMassifData, massifIndex)
+	}
+	return a.massif, true, nil
+}
+
+func (a *archiveObjects) CheckpointData(massifIndex uint32) ([]byte, bool, error) {
+	if massifIndex != a.massifIndex {
+		return nil, false, storage.NewNotFoundError(nil, storage.ObjectCheckpoint, massifIndex)
+	}
+	return a.checkpoint, true, nil
+}
+
+func (a *archiveObjects) MassifReadN(ctx context.Context, massifIndex uint32, n int) ([]byte, error) {
+	data, _, err := a.MassifData(massifIndex)
+	if err != nil {
+		return nil, err
+	}
+	if n >= 0 && n < len(data) {
+		return data[:n], nil
+	}
+	return data, nil
+}
+
+func (a *archiveObjects) CheckpointRead(ctx context.Context, massifIndex uint32) ([]byte, error) {
+	data, _, err := a.CheckpointData(massifIndex)
+	return data, err
+}
@@ -0,0 +1,119 @@
+package massifs
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/stretchr/testify/require"
+)
+
+type archiveEntry struct {
+	name string
+	data []byte
+}
+
+func readArchive(t *testing.T, archive []byte) []archiveEntry {
+	t.Helper()
+	var entries []archiveEntry
+	tr := tar.NewReader(bytes.NewReader(archive))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return entries
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		entries = append(entries, archiveEntry{name: header.Name, data: data})
+	}
+}
+
+func writeArchive(t *testing.T, entries []archiveEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: e.name, Size: int64(len(e.data)), Mode: 0o644}))
+		_, err := tw.Write(e.data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func TestExportImportArchive(t *testing.T) {
+	ctx := context.Background()
+	source, verifier := buildSealedLog(t, 3, 10)
+	head, err := source.HeadIndex(ctx, storage.ObjectCheckpoint)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	manifest, err := ExportArchive(ctx, source, "", &buf)
+	require.NoError(t, err)
+	require.Len(t, manifest.Massifs, int(head)+1)
+	archive := buf.Bytes()
+
+	entries := readArchive(t, archive)
+	require.Len(t, entries, 2*len(manifest.Massifs)+1)
+	require.Equal(t, storage.FmtMassifPath("", 0), entries[0].name)
+	require.Equal(t, storage.FmtCheckpointPath("", 0), entries[1].name)
+	require.Equal(t, ArchiveManifestName, entries[len(entries)-1].name)
+
+	sink := newMemStore(nil, nil)
+	imported, err := ImportArchive(ctx, bytes.NewReader(archive), sink, verifier)
+	require.NoError(t, err)
+	require.Equal(t, manifest.Massifs, imported.Massifs)
+	for i := range head + 1 {
+		want, err := source.MassifReadN(ctx, i, -1)
+		require.NoError(t, err)
+		got, err := sink.MassifReadN(ctx, i, -1)
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+		_, err = GetContextVerified(ctx, sink, verifier, i)
+		require.NoError(t, err)
+	}
+
+	// the checkpoints must be issued by the tenant named
+	_, err = ExportArchive(ctx, source, "someone-else", io.Discard)
+	require.ErrorIs(t, err, ErrCheckpointTenantMismatch)
+
+	// a tampered massif fails verification
+	tampered := readArchive(t, archive)
+	tampered[2].data = bytes.Clone(tampered[2].data)
+	tampered[2].data[len(tampered[2].data)-1] ^= 1
+	_, err = ImportArchive(ctx, bytes.NewReader(writeArchive(t, tampered)), newMemStore(nil, nil), verifier)
+	require.Error(t, err)
+
+	// an entry larger than the object it holds can be is refused unread
+	oversized := readArchive(t, archive)
+	oversized[0].data = append(bytes.Clone(oversized[0].data), make([]byte, len(oversized[0].data))...)
+	_, err = ImportArchive(ctx, bytes.NewReader(writeArchive(t, oversized)), newMemStore(nil, nil), verifier)
+	require.ErrorIs(t, err, ErrArchiveInvalid)
+	oversized = readArchive(t, archive)
+	oversized[1].data = make([]byte, MaxArchiveCheckpointBytes+1)
+	_, err = ImportArchive(ctx, bytes.NewReader(writeArchive(t, oversized)), newMemStore(nil, nil), verifier)
+	require.ErrorIs(t, err, ErrArchiveInvalid)
+
+	// the massifs must be in order, each followed by its checkpoint
+	reordered := readArchive(t, archive)
+	reordered[0], reordered[1] = reordered[1], reordered[0]
+	_, err = ImportArchive(ctx, bytes.NewReader(writeArchive(t, reordered)), newMemStore(nil, nil), verifier)
+	require.ErrorIs(t, err, ErrArchiveInvalid)
+
+	// and match the manifest, which must be present
+	var altered ArchiveManifest
+	entries = readArchive(t, archive)
+	require.NoError(t, json.Unmarshal(entries[len(entries)-1].data, &altered))
+	altered.Massifs = altered.Massifs[1:]
+	entries[len(entries)-1].data, err = json.Marshal(altered)
+	require.NoError(t, err)
+	_, err = ImportArchive(ctx, bytes.NewReader(writeArchive(t, entries)), newMemStore(nil, nil), verifier)
+	require.ErrorIs(t, err, ErrArchiveInvalid)
+	_, err = ImportArchive(ctx, bytes.NewReader(writeArchive(t, entries[:len(entries)-1])), newMemStore(nil, nil), verifier)
+	require.ErrorIs(t, err, ErrArchiveInvalid)
+}
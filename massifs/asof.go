@@ -0,0 +1,170 @@
+package massifs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/forestrie/go-merklelog/urkle"
+)
+
+// ErrNoLeafAsOf is returned by OpenAsOf when every leaf of the log is later
+// than the requested idtimestamp.
+var ErrNoLeafAsOf = errors.New("the log has no leaf at or before the idtimestamp")
+
+// AsOfContext is the state of the log as it was when the last leaf at or
+// before an idtimestamp was added.
+type AsOfContext struct {
+	// MassifContext holds the massif containing the leaf, truncated to
+	// MMRSize. Only the mmr nodes are truncated, the v2 index region still
+	// describes every leaf of the massif.
+	MassifContext
+
+	// LeafIndex, MMRIndex and IDTimestamp identify the last leaf at or before
+	// the requested idtimestamp
+	LeafIndex   uint64
+	MMRIndex    uint64
+	IDTimestamp uint64
+
+	// MMRSize is the size of the log once the leaf was added
+	MMRSize uint64
+
+	// Checkpoint is the earliest checkpoint covering MMRSize, it is nil if the
+	// state has not been sealed yet. Its accumulator commits the state, so
+	// the leaves can be verified against it.
+	Checkpoint *Checkpoint
+}
+
+// OpenAsOf locates the last leaf whose idtimestamp is at or before
+// idTimestamp and returns the log as it was once that leaf was added. The
+// reader identifies the log, as for GetMassifContext.
+//
+// The massif is found by a binary search of the massif start headers, whose
+// last id is non decreasing across the log, and the leaf by a binary search
+// of the massif's Urkle leaf table. Only massifs in the current format can be
+// searched.
+func OpenAsOf(ctx context.Context, reader ObjectReader, idTimestamp uint64) (*AsOfContext, error) {
+	head, err := reader.HeadIndex(ctx, storage.ObjectMassifData)
+	if err != nil {
+		return nil, err
+	}
+
+	// The first massif whose last id is at or after idTimestamp holds the
+	// leaf, unless all its leaves are later, in which case it is the last
+	// leaf of the massif before. If there is no such massif every leaf is
+	// before idTimestamp.
+	massifCount, err := ReadLen(uint64(head) + 1)
+	if err != nil {
+		return nil, err
+	}
+	var searchErr error
+	massifIndex := uint32(sort.Search(massifCount, func(i int) bool {
+		if searchErr != nil {
+			return true
+		}
+		header, err := reader.MassifReadN(ctx, uint32(i), StartHeaderEnd)
+		if err != nil {
+			searchErr = err
+			return true
+		}
+		if len(header) < StartHeaderEnd {
+			searchErr = fmt.Errorf("%w: massif %d start header incomplete", ErrMassifDataLengthInvalid, i)
+			return true
+		}
+		return MakeMassifStart(header).LastID >= idTimestamp
+	}))
+	if searchErr != nil {
+		return nil, searchErr
+	}
+	massifIndex = min(massifIndex, head)
+
+	for {
+		asOf, err := openAsOfMassif(ctx, reader, massifIndex, idTimestamp)
+		if err != nil {
+			return nil, err
+		}
+		if asOf != nil {
+			asOf.Checkpoint, err = coveringCheckpoint(ctx, reader, massifIndex, asOf.MMRSize)
+			if err != nil {
+				return nil, err
+			}
+			return asOf, nil
+		}
+		if massifIndex == 0 {
+			return nil, fmt.Errorf("%w: %d", ErrNoLeafAsOf, idTimestamp)
+		}
+		massifIndex--
+	}
+}
+
+// openAsOfMassif returns the state as of the last leaf of the massif at or
+// before idTimestamp, or nil if there is no such leaf in the massif.
+func openAsOfMassif(
+	ctx context.Context, reader ObjectReader, massifIndex uint32, idTimestamp uint64,
+) (*AsOfContext, error) {
+	mc, err := GetMassifContext(ctx, reader, massifIndex)
+	if err != nil {
+		return nil, err
+	}
+	if err = mc.requireV2Index(); err != nil {
+		return nil, err
+	}
+	leafTable, err := mc.UrkleLeafTableRegion()
+	if err != nil {
+		return nil, err
+	}
+	leafCount, err := ReadLen(mc.MassifLeafCount())
+	if err != nil {
+		return nil, err
+	}
+	ordinal := sort.Search(leafCount, func(i int) bool {
+		return urkle.LeafKey(leafTable, uint32(i)) > idTimestamp
+	}) - 1
+	if ordinal < 0 {
+		return nil, nil
+	}
+
+	leafIndex := mmr.LeafCount(mc.Start.FirstIndex) + uint64(ordinal)
+	mmrIndex := mmr.MMRIndex(leafIndex)
+	mmrSize := mmr.FirstMMRSize(mmrIndex)
+	end := mc.LogStart() + (mmrSize-mc.Start.FirstIndex)*ValueBytes
+	mc.Data = mc.Data[:end:end]
+
+	return &AsOfContext{
+		MassifContext: mc,
+		LeafIndex:     leafIndex,
+		MMRIndex:      mmrIndex,
+		IDTimestamp:   urkle.LeafKey(leafTable, uint32(ordinal)),
+		MMRSize:       mmrSize,
+	}, nil
+}
+
+// coveringCheckpoint returns the checkpoint of the first massif, from
+// massifIndex, that covers mmrSize. It returns nil if none does.
+func coveringCheckpoint(
+	ctx context.Context, reader ObjectReader, massifIndex uint32, mmrSize uint64,
+) (*Checkpoint, error) {
+	head, err := reader.HeadIndex(ctx, storage.ObjectCheckpoint)
+	if storage.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i := massifIndex; i <= head; i++ {
+		check, err := GetCheckpoint(ctx, reader, i)
+		if storage.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if check.MMRSize >= mmrSize {
+			return &check, nil
+		}
+	}
+	return nil, nil
+}
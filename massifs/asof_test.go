@@ -0,0 +1,68 @@
+package massifs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAsOf(t *testing.T) {
+	ctx := context.Background()
+	// leaf i has idtimestamp i+1, massifs hold 4 leaves
+	store, _ := buildSealedLog(t, 3, 11)
+
+	_, err := OpenAsOf(ctx, store, 0)
+	require.ErrorIs(t, err, ErrNoLeafAsOf)
+
+	for _, tc := range []struct {
+		idTimestamp uint64
+		leafIndex   uint64
+	}{
+		{1, 0},
+		{4, 3},   // the last leaf of massif 0
+		{5, 4},   // the first leaf of massif 1
+		{9, 8},   // the first leaf of the head massif
+		{11, 10}, // the last leaf
+		{1000, 10},
+	} {
+		asOf, err := OpenAsOf(ctx, store, tc.idTimestamp)
+		require.NoError(t, err)
+		require.Equal(t, tc.leafIndex, asOf.LeafIndex)
+		require.Equal(t, tc.leafIndex+1, asOf.IDTimestamp)
+		require.Equal(t, mmr.MMRIndex(tc.leafIndex), asOf.MMRIndex)
+		require.Equal(t, mmr.FirstMMRSize(asOf.MMRIndex), asOf.MMRSize)
+		require.Equal(t, asOf.MMRSize, asOf.RangeCount())
+		require.Equal(t, uint64(MassifIndexFromLeafIndex(3, tc.leafIndex)), uint64(asOf.Start.MassifIndex))
+
+		full, err := GetMassifContext(ctx, store, asOf.Start.MassifIndex)
+		require.NoError(t, err)
+		want, err := mmr.PeakHashes(&full, asOf.MMRSize-1)
+		require.NoError(t, err)
+		got, err := mmr.PeakHashes(&asOf.MassifContext, asOf.MMRSize-1)
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+		_, err = asOf.Get(asOf.MMRSize)
+		require.ErrorIs(t, err, ErrIndexNotInMassif)
+
+		require.NotNil(t, asOf.Checkpoint)
+		require.GreaterOrEqual(t, asOf.Checkpoint.MMRSize, asOf.MMRSize)
+	}
+}
+
+func TestOpenAsOfUnsealed(t *testing.T) {
+	ctx := context.Background()
+	store, _ := buildSealedLog(t, 3, 6)
+	delete(store.checkpoint, 1)
+
+	asOf, err := OpenAsOf(ctx, store, 6)
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), asOf.LeafIndex)
+	require.Nil(t, asOf.Checkpoint)
+
+	// the sealed state of massif 0 is still found
+	asOf, err = OpenAsOf(ctx, store, 2)
+	require.NoError(t, err)
+	require.NotNil(t, asOf.Checkpoint)
+}
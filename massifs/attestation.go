@@ -0,0 +1,283 @@
+package massifs
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/veraison/go-cose"
+)
+
+// AttestationContentType is the protected header content type (label 3) of a
+// signed attestation report.
+const AttestationContentType = "application/vnd.forestrie.merklelog-attestation+cbor"
+
+var (
+	ErrAttestationLogIDRequired = errors.New("a log id is required to attest a log")
+	ErrAttestationInvalid       = errors.New("the attestation report is invalid")
+)
+
+// AttestedRange records a range of bytes read from one object during a
+// verification pass, and the digest of those bytes. Anyone holding the same
+// object can confirm they have the same content the attester checked.
+type AttestedRange struct {
+	MassifIndex uint32             `cbor:"1,keyasint"`
+	Type        storage.ObjectType `cbor:"2,keyasint"`
+	Offset      uint64             `cbor:"3,keyasint"`
+	Length      uint64             `cbor:"4,keyasint"`
+	SHA256      []byte             `cbor:"5,keyasint"`
+}
+
+// AttestationReport is the signed payload of a log integrity attestation: the
+// statement that the attester verified the log, identified by LogID, up to and
+// including the checkpoint for MassifIndex, using the log key VerifierKey.
+type AttestationReport struct {
+	LogID       storage.LogID `cbor:"1,keyasint"`
+	MassifIndex uint32        `cbor:"2,keyasint"`
+	// MMRSize is the size sealed by the verified checkpoint
+	MMRSize uint64 `cbor:"3,keyasint"`
+	// CheckpointSHA256 is the digest of the checkpoint object verified
+	CheckpointSHA256 []byte `cbor:"4,keyasint"`
+	// Accumulator is the verified accumulator for MMRSize
+	Accumulator [][]byte        `cbor:"5,keyasint"`
+	ReadRanges  []AttestedRange `cbor:"6,keyasint"`
+	// VerifierKey is the PKIX (SubjectPublicKeyInfo) DER encoding of the log
+	// key the checkpoints were verified with.
+	VerifierKey []byte `cbor:"7,keyasint"`
+	// VerifiedAt is the unix time, in milliseconds, the verification pass
+	// completed.
+	VerifiedAt int64 `cbor:"8,keyasint"`
+}
+
+// Attester runs full verification passes over a log and signs attestation
+// reports of the outcome, so that third party auditors can publish machine
+// verifiable statements that they checked a log at a point in time.
+type Attester struct {
+	// Signer is the attester's own key, it signs the report.
+	Signer cose.Signer
+	// LogKey is the public key of the log, it verifies the checkpoints. The
+	// COSE algorithm is read from each checkpoint's protected header.
+	LogKey crypto.PublicKey
+	// Now defaults to time.Now
+	Now func() time.Time
+}
+
+// AttestLog verifies every massif in the log, from massif 0 to the head, each
+// against its checkpoint and each consistent with its predecessor. On success
+// it returns the signed report, a COSE_Sign1 with the CBOR encoded
+// AttestationReport as its attached payload, and the report itself.
+//
+// If logID is nil and reader implements LogID (see DirReader), the reader
+// provides it.
+func (a *Attester) AttestLog(
+	ctx context.Context, reader ObjectReader, logID storage.LogID,
+) ([]byte, *AttestationReport, error) {
+	verifierKey, err := x509.MarshalPKIXPublicKey(a.LogKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("encode log key: %w", err)
+	}
+	if logID == nil {
+		if identified, ok := reader.(interface {
+			LogID(ctx context.Context) (storage.LogID, error)
+		}); ok {
+			if logID, err = identified.LogID(ctx); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	if logID == nil {
+		return nil, nil, ErrAttestationLogIDRequired
+	}
+
+	recorder := newRecordingReader(reader)
+	head, err := recorder.HeadIndex(ctx, storage.ObjectCheckpoint)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var vc *VerifiedContext
+	for i := uint32(0); i <= head; i++ {
+		// fetch the seal before the massif, so we can't lose a race with the
+		// builder
+		check, err := GetCheckpoint(ctx, recorder, i)
+		if err != nil {
+			return nil, nil, err
+		}
+		alg, err := ProtectedHeaderAlgorithm(check.Receipt.ProtectedHeader)
+		if err != nil {
+			return nil, nil, err
+		}
+		verifier, err := cose.NewVerifier(cose.Algorithm(alg), a.LogKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("massif %d: %w", i, err)
+		}
+
+		opts := []Option{WithVerifyCheckpoint(&check)}
+		if vc != nil {
+			opts = append(opts, WithVerifyTrustedState(MMRState{
+				MMRSize: vc.Checkpoint.MMRSize,
+				Peaks:   vc.Accumulator,
+			}))
+		}
+		vc, err = GetContextVerified(ctx, recorder, verifier, i, opts...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("massif %d: %w", i, err)
+		}
+	}
+
+	now := time.Now
+	if a.Now != nil {
+		now = a.Now
+	}
+	checkpointSum := sha256.Sum256(vc.Checkpoint.Raw)
+	report := &AttestationReport{
+		LogID:            logID,
+		MassifIndex:      head,
+		MMRSize:          vc.Checkpoint.MMRSize,
+		CheckpointSHA256: checkpointSum[:],
+		Accumulator:      vc.Accumulator,
+		ReadRanges:       recorder.ranges(),
+		VerifierKey:      verifierKey,
+		VerifiedAt:       now().UnixMilli(),
+	}
+	signed, err := SignAttestationReport(a.Signer, report)
+	if err != nil {
+		return nil, nil, err
+	}
+	return signed, report, nil
+}
+
+// SignAttestationReport signs the report as a tagged COSE_Sign1 with the
+// encoded report attached.
+func SignAttestationReport(signer cose.Signer, report *AttestationReport) ([]byte, error) {
+	payload, err := canonicalReceiptCBOR.Marshal(report)
+	if err != nil {
+		return nil, fmt.Errorf("encode attestation report: %w", err)
+	}
+	msg := cose.NewSign1Message()
+	msg.Headers.Protected.SetAlgorithm(signer.Algorithm())
+	msg.Headers.Protected[cose.HeaderLabelContentType] = AttestationContentType
+	msg.Payload = payload
+	if err = msg.Sign(rand.Reader, nil, signer); err != nil {
+		return nil, fmt.Errorf("sign attestation report: %w", err)
+	}
+	return msg.MarshalCBOR()
+}
+
+// VerifyAttestationReport verifies the attester's signature and returns the
+// report. It does not re-verify the log, the ReadRanges digests support doing
+// so independently.
+func VerifyAttestationReport(data []byte, verifier cose.Verifier) (*AttestationReport, error) {
+	if verifier == nil {
+		return nil, ErrVerifierRequired
+	}
+	var msg cose.Sign1Message
+	if err := msg.UnmarshalCBOR(data); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAttestationInvalid, err)
+	}
+	if ct, _ := msg.Headers.Protected[cose.HeaderLabelContentType].(string); ct != AttestationContentType {
+		return nil, fmt.Errorf("%w: content type %v", ErrAttestationInvalid, msg.Headers.Protected[cose.HeaderLabelContentType])
+	}
+	if err := msg.Verify(nil, verifier); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAttestationInvalid, err)
+	}
+	var report AttestationReport
+	if err := cbor.Unmarshal(msg.Payload, &report); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAttestationInvalid, err)
+	}
+	return &report, nil
+}
+
+type recordedObject struct {
+	massifIndex uint32
+	ty          storage.ObjectType
+}
+
+// recordingReader is an ObjectReader which keeps the longest data returned
+// for each object. All reads are from the start of the object, so that is the
+// range read.
+type recordingReader struct {
+	ObjectReader
+	mu   sync.Mutex
+	read map[recordedObject][]byte
+}
+
+func newRecordingReader(reader ObjectReader) *recordingReader {
+	return &recordingReader{ObjectReader: reader, read: map[recordedObject][]byte{}}
+}
+
+func (r *recordingReader) record(massifIndex uint32, ty storage.ObjectType, data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := recordedObject{massifIndex: massifIndex, ty: ty}
+	if len(data) > len(r.read[key]) {
+		r.read[key] = data
+	}
+}
+
+func (r *recordingReader) MassifData(massifIndex uint32) ([]byte, bool, error) {
+	data, ok, err := r.ObjectReader.MassifData(massifIndex)
+	if err == nil {
+		r.record(massifIndex, storage.ObjectMassifData, data)
+	}
+	return data, ok, err
+}
+
+func (r *recordingReader) CheckpointData(massifIndex uint32) ([]byte, bool, error) {
+	data, ok, err := r.ObjectReader.CheckpointData(massifIndex)
+	if err == nil {
+		r.record(massifIndex, storage.ObjectCheckpoint, data)
+	}
+	return data, ok, err
+}
+
+func (r *recordingReader) MassifReadN(ctx context.Context, massifIndex uint32, n int) ([]byte, error) {
+	data, err := r.ObjectReader.MassifReadN(ctx, massifIndex, n)
+	if err == nil {
+		r.record(massifIndex, storage.ObjectMassifData, data)
+	}
+	return data, err
+}
+
+func (r *recordingReader) CheckpointRead(ctx context.Context, massifIndex uint32) ([]byte, error) {
+	data, err := r.ObjectReader.CheckpointRead(ctx, massifIndex)
+	if err == nil {
+		r.record(massifIndex, storage.ObjectCheckpoint, data)
+	}
+	return data, err
+}
+
+// ranges returns the recorded ranges ordered by massif then object type
+func (r *recordingReader) ranges() []AttestedRange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ranges := make([]AttestedRange, 0, len(r.read))
+	for key, data := range r.read {
+		if len(data) == 0 {
+			continue
+		}
+		sum := sha256.Sum256(data)
+		ranges = append(ranges, AttestedRange{
+			MassifIndex: key.massifIndex,
+			Type:        key.ty,
+			Length:      uint64(len(data)),
+			SHA256:      sum[:],
+		})
+	}
+	sort.Slice(ranges, func(i, j int) bool {
+		if ranges[i].MassifIndex != ranges[j].MassifIndex {
+			return ranges[i].MassifIndex < ranges[j].MassifIndex
+		}
+		return ranges[i].Type < ranges[j].Type
+	})
+	return ranges
+}
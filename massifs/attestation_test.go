@@ -0,0 +1,98 @@
+package massifs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+func TestAttestLog(t *testing.T) {
+	ctx := context.Background()
+
+	logKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	store := buildSealedLogWithKey(t, logKey, 2, 7)
+
+	attesterKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := cose.NewSigner(cose.AlgorithmES256, attesterKey)
+	require.NoError(t, err)
+
+	verifiedAt := time.UnixMilli(1760000000000)
+	attester := &Attester{
+		Signer: signer,
+		LogKey: &logKey.PublicKey,
+		Now:    func() time.Time { return verifiedAt },
+	}
+	logID := storage.LogID("a log to attest")
+
+	signed, report, err := attester.AttestLog(ctx, store, logID)
+	require.NoError(t, err)
+
+	head, err := store.HeadIndex(ctx, storage.ObjectCheckpoint)
+	require.NoError(t, err)
+	require.Equal(t, head, report.MassifIndex)
+	require.Equal(t, verifiedAt.UnixMilli(), report.VerifiedAt)
+
+	check, err := GetCheckpoint(ctx, store, head)
+	require.NoError(t, err)
+	require.Equal(t, check.MMRSize, report.MMRSize)
+	sum := sha256.Sum256(check.Raw)
+	require.Equal(t, sum[:], report.CheckpointSHA256)
+
+	verifierKey, err := x509.MarshalPKIXPublicKey(&logKey.PublicKey)
+	require.NoError(t, err)
+	require.Equal(t, verifierKey, report.VerifierKey)
+
+	// every massif and checkpoint was read in full
+	require.Len(t, report.ReadRanges, 2*int(head+1))
+	for _, r := range report.ReadRanges {
+		var data []byte
+		if r.Type == storage.ObjectMassifData {
+			data = store.massifs[r.MassifIndex]
+		} else {
+			data = store.checkpoint[r.MassifIndex]
+		}
+		require.Equal(t, uint64(len(data)), r.Length)
+		sum := sha256.Sum256(data)
+		require.Equal(t, sum[:], r.SHA256)
+	}
+
+	verifier, err := cose.NewVerifier(cose.AlgorithmES256, &attesterKey.PublicKey)
+	require.NoError(t, err)
+	verified, err := VerifyAttestationReport(signed, verifier)
+	require.NoError(t, err)
+	require.Equal(t, report, verified)
+
+	// The report is not verifiable with the log key
+	logVerifier, err := cose.NewVerifier(cose.AlgorithmES256, &logKey.PublicKey)
+	require.NoError(t, err)
+	_, err = VerifyAttestationReport(signed, logVerifier)
+	require.True(t, errors.Is(err, ErrAttestationInvalid))
+}
+
+func TestAttestLogWrongLogKey(t *testing.T) {
+	store, _ := buildSealedLog(t, 2, 3)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := cose.NewSigner(cose.AlgorithmES256, key)
+	require.NoError(t, err)
+
+	attester := &Attester{Signer: signer, LogKey: &key.PublicKey}
+	_, _, err = attester.AttestLog(context.Background(), store, storage.LogID("log"))
+	require.True(t, errors.Is(err, ErrSealVerifyFailed))
+
+	_, _, err = attester.AttestLog(context.Background(), store, nil)
+	require.True(t, errors.Is(err, ErrAttestationLogIDRequired))
+}
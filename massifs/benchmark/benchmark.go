@@ -0,0 +1,249 @@
+// Package benchmark is the throughput benchmark suite of the hot paths of the
+// library: appending leaves, generating inclusion proofs, checking
+// consistency and verified replication. The benchmarks are exported so a
+// downstream module can run them against the version of the library it
+// builds with,
+//
+//	func BenchmarkMerklelog(b *testing.B) { benchmark.Suite(b) }
+//
+// and gate its CI on regressions with ParseResults and CheckRegressions.
+// Storage is the in memory object store of the simulation package, so the
+// results measure the library rather than a backend.
+package benchmark
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/massifs"
+	"github.com/forestrie/go-merklelog/massifs/simulation"
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/veraison/go-cose"
+)
+
+var (
+	// MassifHeights are the massif heights Suite measures append throughput
+	// for
+	MassifHeights = []uint8{3, 8, 14}
+	// LogSizes are the log sizes, in leaves, Suite measures proofs and
+	// consistency checks for
+	LogSizes = []uint64{1 << 10, 1 << 14, 1 << 17}
+	// ReplicationSizes are the log sizes, in leaves, Suite measures
+	// replication for. The logs have massif height 8.
+	ReplicationSizes = []int{1 << 8, 1 << 11}
+)
+
+// Suite runs every benchmark of the package, over the sizes above, as sub
+// benchmarks of b.
+func Suite(b *testing.B) {
+	for _, height := range MassifHeights {
+		b.Run(fmt.Sprintf("Append/height=%d", height), func(b *testing.B) { Append(b, height) })
+	}
+	for _, size := range LogSizes {
+		b.Run(fmt.Sprintf("InclusionProof/leaves=%d", size), func(b *testing.B) { InclusionProof(b, size) })
+	}
+	for _, size := range LogSizes {
+		b.Run(fmt.Sprintf("ConsistencyCheck/leaves=%d", size), func(b *testing.B) { ConsistencyCheck(b, size) })
+	}
+	for _, size := range ReplicationSizes {
+		b.Run(fmt.Sprintf("Replicate/leaves=%d", size), func(b *testing.B) { Replicate(b, 8, size) })
+	}
+}
+
+// Append measures appending leaves to a log of the massif height, one leaf
+// per operation, and reports leaves/sec. Each massif is committed once it is
+// full, so the cost of the commits is spread over the leaves of a massif.
+func Append(b *testing.B, massifHeight uint8) {
+	ctx := context.Background()
+	store := simulation.NewStore().As("builder")
+	mc, err := massifs.GetAppendContext(ctx, store, 1, massifHeight)
+	if err != nil {
+		b.Fatal(err)
+	}
+	hasher := sha256.New()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := range b.N {
+		if mc.Count() >= massifs.TreeCount(massifHeight) {
+			if err = massifs.CommitContext(ctx, store, &mc); err != nil {
+				b.Fatal(err)
+			}
+			if mc, err = massifs.GetAppendContext(ctx, store, 1, massifHeight); err != nil {
+				b.Fatal(err)
+			}
+		}
+		leaf := leafHash(uint64(i))
+		if _, err = mc.AddHashedLeaf(hasher, uint64(i+1), nil, nil, nil, leaf); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "leaves/sec")
+}
+
+// InclusionProof measures generating the inclusion proof of a leaf in a log
+// of leafCount leaves. The leaves proven are spread over the log.
+func InclusionProof(b *testing.B, leafCount uint64) {
+	store, mmrSize := buildNodes(b, leafCount)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := range b.N {
+		leafIndex := (uint64(i) * 7919) % leafCount
+		if _, err := mmr.InclusionProof(store, mmrSize-1, mmr.MMRIndex(leafIndex)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// ConsistencyCheck measures checking a log of leafCount leaves is consistent
+// with the accumulator of its first half.
+func ConsistencyCheck(b *testing.B, leafCount uint64) {
+	store, mmrSize := buildNodes(b, leafCount)
+	fromSize := mmr.FirstMMRSize(mmr.MMRIndex(leafCount / 2))
+	peaks, err := mmr.PeakHashes(store, fromSize-1)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		ok, _, err := mmr.CheckConsistency(store, sha256.New(), fromSize, mmrSize, peaks)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if !ok {
+			b.Fatal(mmr.ErrConsistencyCheck)
+		}
+	}
+}
+
+// Replicate measures the verified replication of a sealed log of leafCount
+// leaves, and the massif height, to an empty replica. The bytes reported are
+// those of the massifs replicated.
+func Replicate(b *testing.B, massifHeight uint8, leafCount int) {
+	ctx := context.Background()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		b.Fatal(err)
+	}
+	signer, err := cose.NewSigner(cose.AlgorithmES256, key)
+	if err != nil {
+		b.Fatal(err)
+	}
+	verifier, err := cose.NewVerifier(cose.AlgorithmES256, &key.PublicKey)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	source := simulation.NewStore()
+	head, size := buildSealedLog(b, source.As("builder"), signer, massifHeight, leafCount)
+	b.SetBytes(size)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		v := massifs.VerifyingReplicator{
+			COSEVerifier: verifier,
+			Source:       source.As("replicator"),
+			Sink:         simulation.NewStore().As("replicator"),
+		}
+		if err = v.ReplicateVerifiedUpdates(ctx, 0, head); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// nodes is an in memory mmr, as the node store of the proof benchmarks
+type nodes [][]byte
+
+func (n *nodes) Get(i uint64) ([]byte, error) {
+	if i >= uint64(len(*n)) {
+		return nil, massifs.ErrIndexNotInMassif
+	}
+	return (*n)[i], nil
+}
+
+func (n *nodes) Append(value []byte) (uint64, error) {
+	*n = append(*n, value)
+	return uint64(len(*n)), nil
+}
+
+// buildNodes returns an mmr of leafCount leaves, and its size
+func buildNodes(b *testing.B, leafCount uint64) (*nodes, uint64) {
+	b.Helper()
+	store := &nodes{}
+	hasher := sha256.New()
+	var mmrSize uint64
+	for i := range leafCount {
+		var err error
+		if mmrSize, err = mmr.AddHashedLeaf(store, hasher, leafHash(i)); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return store, mmrSize
+}
+
+// buildSealedLog builds a log of leafCount leaves, sealing each massif as it
+// is completed, and the last. Returns the index of the last massif and the
+// total size of the massifs.
+func buildSealedLog(
+	b *testing.B, store massifs.ObjectReaderWriter, signer cose.Signer, massifHeight uint8, leafCount int,
+) (uint32, int64) {
+	b.Helper()
+	ctx := context.Background()
+	hasher := sha256.New()
+
+	var sealedSize uint64
+	var size int64
+	commit := func(mc *massifs.MassifContext) {
+		if err := massifs.CommitContext(ctx, store, mc); err != nil {
+			b.Fatal(err)
+		}
+		size += int64(len(mc.Data))
+		proof, err := massifs.BuildConsistencyProof(mc, sealedSize, mc.RangeCount())
+		if err != nil {
+			b.Fatal(err)
+		}
+		accumulator, err := mmr.PeakHashes(mc, mc.RangeCount()-1)
+		if err != nil {
+			b.Fatal(err)
+		}
+		data, err := massifs.SignCheckpointReceipt(signer, proof, accumulator)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err = store.Put(ctx, mc.Start.MassifIndex, storage.ObjectCheckpoint, data, false); err != nil {
+			b.Fatal(err)
+		}
+		sealedSize = mc.RangeCount()
+	}
+
+	mc, err := massifs.GetAppendContext(ctx, store, 1, massifHeight)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := range leafCount {
+		if mc.Count() >= massifs.TreeCount(massifHeight) {
+			commit(&mc)
+			if mc, err = massifs.GetAppendContext(ctx, store, 1, massifHeight); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if _, err = mc.AddHashedLeaf(hasher, uint64(i+1), nil, nil, nil, leafHash(uint64(i))); err != nil {
+			b.Fatal(err)
+		}
+	}
+	commit(&mc)
+	return mc.Start.MassifIndex, size
+}
+
+func leafHash(i uint64) []byte {
+	leaf := sha256.Sum256(binary.BigEndian.AppendUint64(nil, i))
+	return leaf[:]
+}
@@ -0,0 +1,40 @@
+package benchmark
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func BenchmarkSuite(b *testing.B) {
+	Suite(b)
+}
+
+func TestParseResults(t *testing.T) {
+	output := `goos: linux
+goarch: amd64
+pkg: github.com/forestrie/go-merklelog/massifs/benchmark
+BenchmarkSuite/Append/height=3-8         	  100000	     10250 ns/op	     97560 leaves/sec	    2048 B/op	      12 allocs/op
+BenchmarkSuite/Append/height=3-8         	  100000	     10010 ns/op	     99900 leaves/sec	    2048 B/op	      12 allocs/op
+BenchmarkSuite/InclusionProof/leaves=1024-8	 1000000	      1020 ns/op
+BenchmarkSuite/Replicate/leaves=256      	     100	  12000000 ns/op	 100.00 MB/s
+PASS
+ok  	github.com/forestrie/go-merklelog/massifs/benchmark	12.345s
+`
+	results, err := ParseResults(strings.NewReader(output))
+	require.NoError(t, err)
+	require.Equal(t, Results{
+		"BenchmarkSuite/Append/height=3":            10010,
+		"BenchmarkSuite/InclusionProof/leaves=1024": 1020,
+		"BenchmarkSuite/Replicate/leaves=256":       12000000,
+	}, results)
+}
+
+func TestCheckRegressions(t *testing.T) {
+	baseline := Results{"a": 100, "b": 100, "c": 100}
+	current := Results{"a": 109, "b": 150, "c": 50, "d": 1000}
+	regressions := CheckRegressions(baseline, current, 0.1)
+	require.Equal(t, []Regression{{Name: "b", Baseline: 100, Current: 150}}, regressions)
+	require.Equal(t, "b: 150 ns/op, baseline 100 ns/op (+50.0%)", regressions[0].String())
+}
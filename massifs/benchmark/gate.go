@@ -0,0 +1,75 @@
+package benchmark
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Results maps the name of a benchmark, without its GOMAXPROCS suffix, to its
+// time per operation in nanoseconds.
+type Results map[string]float64
+
+// Regression is a benchmark which got slower than its baseline allows
+type Regression struct {
+	Name     string
+	Baseline float64
+	Current  float64
+}
+
+func (r Regression) String() string {
+	return fmt.Sprintf("%s: %.0f ns/op, baseline %.0f ns/op (%+.1f%%)",
+		r.Name, r.Current, r.Baseline, 100*(r.Current-r.Baseline)/r.Baseline)
+}
+
+// benchmarkLine matches the name and ns/op of a line of go test -bench output
+var benchmarkLine = regexp.MustCompile(`^(Benchmark\S+?)(?:-\d+)?\s+\d+\s+([0-9.]+) ns/op`)
+
+// ParseResults reads the output of go test -bench. A benchmark reported more
+// than once, with -count for example, takes its fastest result, which is the
+// least sensitive to a noisy CI host. Lines which are not results are
+// ignored.
+func ParseResults(r io.Reader) (Results, error) {
+	results := Results{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		m := benchmarkLine.FindStringSubmatch(strings.TrimSpace(scanner.Text()))
+		if m == nil {
+			continue
+		}
+		ns, err := strconv.ParseFloat(m[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("benchmark %s: %w", m[1], err)
+		}
+		if prev, ok := results[m[1]]; !ok || ns < prev {
+			results[m[1]] = ns
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// CheckRegressions returns the benchmarks of current which are slower than
+// their baseline by more than tolerance, a fraction, so 0.1 allows 10%. They
+// are sorted by name. Benchmarks missing from either results are not
+// compared.
+func CheckRegressions(baseline, current Results, tolerance float64) []Regression {
+	var regressions []Regression
+	for name, ns := range current {
+		base, ok := baseline[name]
+		if !ok || base <= 0 {
+			continue
+		}
+		if ns > base*(1+tolerance) {
+			regressions = append(regressions, Regression{Name: name, Baseline: base, Current: ns})
+		}
+	}
+	slices.SortFunc(regressions, func(a, b Regression) int { return strings.Compare(a.Name, b.Name) })
+	return regressions
+}
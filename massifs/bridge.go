@@ -0,0 +1,199 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/fxamacker/cbor/v2"
+)
+
+var (
+	ErrBridgeInvalid          = errors.New("the massif bridge is not a valid consistency proof")
+	ErrBridgeMassifIncomplete = errors.New("a bridge can only be made for a completed massif")
+	ErrBridgeStateMismatch    = errors.New("the massif bridge does not start from the trusted state")
+)
+
+// MassifBridge is the consistency proof across the start of a massif: from
+// the accumulator of the log when the previous massif was completed, Before,
+// to the accumulator when this massif was completed, After. It is derived
+// from the massif when it is completed, see PutMassifBridge, and stored
+// alongside the seals as the storage.ObjectMassifBridge object.
+//
+// The proof only needs nodes of its own massif, and the Before peaks, so a
+// verifier holding the state at the end of one massif can carry it to the end
+// of the next without reading the data of either. Chained bridges carry a
+// trusted state across any number of massifs. The bridge is not signed, it is
+// only as trusted as the state it is verified from, see VerifyMassifBridge.
+type MassifBridge struct {
+	MassifIndex uint32 `cbor:"1,keyasint"`
+	// BeforeSize is the first mmr index of the massif, zero for the first
+	BeforeSize uint64   `cbor:"2,keyasint"`
+	Before     [][]byte `cbor:"3,keyasint"`
+	// AfterSize is the mmr size when the massif was completed
+	AfterSize uint64   `cbor:"4,keyasint"`
+	After     [][]byte `cbor:"5,keyasint"`
+	// Paths is the inclusion path from each peak of Before to its peak in
+	// After, as mmr.IndexConsistencyProof produces
+	Paths [][][]byte `cbor:"6,keyasint"`
+}
+
+// MassifBridgeReader is implemented by readers which can read the
+// storage.ObjectMassifBridge objects of a log.
+type MassifBridgeReader interface {
+	// MassifBridgeRead returns the bridge object of the massif. A
+	// NotFoundError is returned if there is none.
+	MassifBridgeRead(ctx context.Context, massifIndex uint32) ([]byte, error)
+}
+
+// NewMassifBridge derives the bridge of a completed massif
+func NewMassifBridge(mc *MassifContext) (*MassifBridge, error) {
+	if mc.Count() < TreeCount(mc.Start.MassifHeight) {
+		return nil, fmt.Errorf("%w: massif %d has %d of %d nodes",
+			ErrBridgeMassifIncomplete, mc.Start.MassifIndex, mc.Count(), TreeCount(mc.Start.MassifHeight))
+	}
+	proof, err := BuildConsistencyProof(mc, mc.Start.FirstIndex, mc.RangeCount())
+	if err != nil {
+		return nil, err
+	}
+	after, err := mmr.PeakHashes(mc, mc.RangeCount()-1)
+	if err != nil {
+		return nil, err
+	}
+	bridge := &MassifBridge{
+		MassifIndex: mc.Start.MassifIndex,
+		BeforeSize:  mc.Start.FirstIndex,
+		AfterSize:   mc.RangeCount(),
+		After:       after,
+		Paths:       proof.Paths,
+	}
+	if mc.Start.FirstIndex > 0 {
+		if bridge.Before, err = mmr.PeakHashes(mc, mc.Start.FirstIndex-1); err != nil {
+			return nil, err
+		}
+	}
+	return bridge, nil
+}
+
+// BeforeState returns the state the bridge starts from
+func (b *MassifBridge) BeforeState() MMRState {
+	return MMRState{MMRSize: b.BeforeSize, Peaks: b.Before}
+}
+
+// AfterState returns the state the bridge proves consistent with BeforeState
+func (b *MassifBridge) AfterState() MMRState {
+	return MMRState{MMRSize: b.AfterSize, Peaks: b.After}
+}
+
+// MarshalBinary encodes the bridge as the storage.ObjectMassifBridge object
+func (b *MassifBridge) MarshalBinary() ([]byte, error) {
+	// the conversion drops the methods, cbor would otherwise call this one
+	type plain MassifBridge
+	return cbor.Marshal((*plain)(b))
+}
+
+// DecodeMassifBridge decodes a bridge produced by MarshalBinary
+func DecodeMassifBridge(data []byte) (*MassifBridge, error) {
+	type plain MassifBridge
+	var b plain
+	if err := cbor.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBridgeInvalid, err)
+	}
+	return (*MassifBridge)(&b), nil
+}
+
+// Verify checks the bridge is a consistency proof from BeforeState to
+// AfterState. It says nothing about whether either state is the log's, see
+// VerifyMassifBridge.
+func (b *MassifBridge) Verify() error {
+	if b.AfterSize <= b.BeforeSize {
+		return fmt.Errorf("%w: size %d does not extend size %d", ErrBridgeInvalid, b.AfterSize, b.BeforeSize)
+	}
+	if len(b.After) != len(mmr.Peaks(b.AfterSize-1)) {
+		return fmt.Errorf("%w: %d peaks for size %d", ErrBridgeInvalid, len(b.After), b.AfterSize)
+	}
+	if b.BeforeSize == 0 {
+		if len(b.Before) != 0 || len(b.Paths) != 0 {
+			return fmt.Errorf("%w: the first massif has no state before it", ErrBridgeInvalid)
+		}
+		return nil
+	}
+	if len(b.Before) != len(mmr.Peaks(b.BeforeSize-1)) {
+		return fmt.Errorf("%w: %d peaks for size %d", ErrBridgeInvalid, len(b.Before), b.BeforeSize)
+	}
+	roots, err := mmr.ConsistentRoots(sha256.New(), b.BeforeSize-1, b.Before, b.Paths)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBridgeInvalid, err)
+	}
+	if len(roots) > len(b.After) {
+		return fmt.Errorf("%w: %d roots proven for %d peaks", ErrBridgeInvalid, len(roots), len(b.After))
+	}
+	for i := range roots {
+		if !bytes.Equal(roots[i], b.After[i]) {
+			return fmt.Errorf("%w: proven root %d is not peak %d of size %d", ErrBridgeInvalid, i, i, b.AfterSize)
+		}
+	}
+	return nil
+}
+
+// VerifyMassifBridge verifies the bridge starts from the trusted state and
+// is a valid consistency proof, and returns the state after the massif, which
+// is then as trusted as the state given. The trusted state is typically one
+// verified from a checkpoint sealing the whole of the previous massif, or the
+// state returned for the bridge of the previous massif.
+func VerifyMassifBridge(bridge *MassifBridge, trusted MMRState) (MMRState, error) {
+	if trusted.MMRSize != bridge.BeforeSize || len(trusted.Peaks) != len(bridge.Before) {
+		return MMRState{}, fmt.Errorf("%w: the bridge of massif %d starts from size %d, not %d",
+			ErrBridgeStateMismatch, bridge.MassifIndex, bridge.BeforeSize, trusted.MMRSize)
+	}
+	for i := range trusted.Peaks {
+		if !bytes.Equal(trusted.Peaks[i], bridge.Before[i]) {
+			return MMRState{}, fmt.Errorf("%w: peak %d differs", ErrBridgeStateMismatch, i)
+		}
+	}
+	if err := bridge.Verify(); err != nil {
+		return MMRState{}, err
+	}
+	return bridge.AfterState(), nil
+}
+
+// GetMassifBridge reads and decodes the bridge of the massif.
+// storage.ErrUnsupportedCap is returned if the reader is not a
+// MassifBridgeReader.
+func GetMassifBridge(ctx context.Context, reader ObjectReader, massifIndex uint32) (*MassifBridge, error) {
+	bridges, ok := reader.(MassifBridgeReader)
+	if !ok {
+		return nil, fmt.Errorf("%w: the reader can not read massif bridges", storage.ErrUnsupportedCap)
+	}
+	data, err := bridges.MassifBridgeRead(ctx, massifIndex)
+	if err != nil {
+		return nil, err
+	}
+	bridge, err := DecodeMassifBridge(data)
+	if err != nil {
+		return nil, err
+	}
+	if bridge.MassifIndex != massifIndex {
+		return nil, fmt.Errorf("%w: the bridge for massif %d is stored as massif %d",
+			ErrBridgeInvalid, bridge.MassifIndex, massifIndex)
+	}
+	return bridge, nil
+}
+
+// PutMassifBridge derives the bridge of the completed massif and puts it as
+// its storage.ObjectMassifBridge object.
+func PutMassifBridge(ctx context.Context, writer ObjectWriter, mc *MassifContext) error {
+	bridge, err := NewMassifBridge(mc)
+	if err != nil {
+		return err
+	}
+	data, err := bridge.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return writer.Put(ctx, mc.Start.MassifIndex, storage.ObjectMassifBridge, data, false)
+}
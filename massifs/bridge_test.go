@@ -0,0 +1,97 @@
+package massifs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+func (m *memStore) MassifBridgeRead(ctx context.Context, massifIndex uint32) ([]byte, error) {
+	b, ok := m.bridges[massifIndex]
+	if !ok {
+		return nil, storage.NewNotFoundError(nil, storage.ObjectMassifBridge, massifIndex)
+	}
+	return b, nil
+}
+
+func TestMassifBridge(t *testing.T) {
+	ctx := context.Background()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := cose.NewSigner(cose.AlgorithmES256, key)
+	require.NoError(t, err)
+
+	store := newMemStore(nil, nil)
+	l, err := OpenLog(ctx, store, WithLogMassifHeight(3), WithLogSigner(signer), WithLogBridges())
+	require.NoError(t, err)
+	var entries []LogEntry
+	for i := range 10 {
+		leaf := sha256.Sum256(fmt.Appendf(nil, "bridge-leaf-%d", i))
+		entries = append(entries, LogEntry{IDTimestamp: uint64(i+1) * 10, Value: leaf[:]})
+	}
+	_, err = l.Append(ctx, entries...)
+	require.NoError(t, err)
+	_, err = l.Seal(ctx)
+	require.NoError(t, err)
+	// massif 2 is not complete
+	require.Len(t, store.bridges, 2)
+
+	// the bridges carry the empty state to the end of massif 1 without
+	// reading either massif
+	b0, err := GetMassifBridge(ctx, store, 0)
+	require.NoError(t, err)
+	state, err := VerifyMassifBridge(b0, MMRState{})
+	require.NoError(t, err)
+	b1, err := GetMassifBridge(ctx, store, 1)
+	require.NoError(t, err)
+	state, err = VerifyMassifBridge(b1, state)
+	require.NoError(t, err)
+
+	// which is the state the checkpoint of the completed massif seals
+	mc1, err := GetMassifContext(ctx, store, 1)
+	require.NoError(t, err)
+	check, err := GetCheckpoint(ctx, store, 1)
+	require.NoError(t, err)
+	accumulator, err := VerifyCheckpointReceipt(&mc1, &check.Receipt, newES256Verifier(t, &key.PublicKey))
+	require.NoError(t, err)
+	require.Equal(t, check.MMRSize, state.MMRSize)
+	require.Equal(t, accumulator, state.Peaks)
+
+	_, err = VerifyMassifBridge(b1, MMRState{})
+	require.ErrorIs(t, err, ErrBridgeStateMismatch)
+	trusted := b0.AfterState()
+	trusted.Peaks = [][]byte{make([]byte, ValueBytes)}
+	_, err = VerifyMassifBridge(b1, trusted)
+	require.ErrorIs(t, err, ErrBridgeStateMismatch)
+
+	b1.Paths[0][0][0] ^= 0xff
+	_, err = VerifyMassifBridge(b1, b0.AfterState())
+	require.ErrorIs(t, err, ErrBridgeInvalid)
+
+	mc2, err := GetMassifContext(ctx, store, 2)
+	require.NoError(t, err)
+	_, err = NewMassifBridge(&mc2)
+	require.ErrorIs(t, err, ErrBridgeMassifIncomplete)
+
+	// a local replica reads the bridges put alongside the seals
+	dir := t.TempDir()
+	writer, err := NewDirWriter(dir)
+	require.NoError(t, err)
+	require.NoError(t, PutMassifBridge(ctx, writer, &mc1))
+	reader, err := NewDirReader(dir)
+	require.NoError(t, err)
+	b1, err = GetMassifBridge(ctx, reader, 1)
+	require.NoError(t, err)
+	_, err = VerifyMassifBridge(b1, b0.AfterState())
+	require.NoError(t, err)
+	_, err = GetMassifBridge(ctx, reader, 0)
+	require.True(t, storage.IsNotFound(err))
+}
@@ -29,6 +29,9 @@ func NewCheckpoint(data []byte) (Checkpoint, error) {
 	if err != nil {
 		return Checkpoint{}, err
 	}
+	if err = checkSealMMRSize(&receipt); err != nil {
+		return Checkpoint{}, err
+	}
 	return Checkpoint{
 		Raw:     data,
 		Receipt: receipt,
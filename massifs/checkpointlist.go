@@ -0,0 +1,154 @@
+package massifs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/veraison/go-cose"
+)
+
+var (
+	ErrCheckpointsNotMonotonic  = errors.New("the checkpoint mmr sizes do not increase with the massif index")
+	ErrCheckpointTenantMismatch = errors.New("the checkpoint was not issued by the tenant")
+)
+
+// CheckpointInfo is the metadata of a stored checkpoint, as returned by
+// ListCheckpoints.
+type CheckpointInfo struct {
+	MassifIndex uint32
+	// MMRSize is the sealed size
+	MMRSize uint64
+	// Timestamp is the time of the last sealed leaf, from its idtimestamp.
+	// It is zero where that is not recorded in the massif, which is the case
+	// for leaves other than the last of a v1 massif.
+	Timestamp time.Time
+	// Issuer and Subject are the seal's CWT claims, empty if it has none
+	Issuer  string
+	Subject string
+	// Kid is the key id of the seal. It is read from the protected header of
+	// the checkpoint, or failing that from its first peak receipt. It is nil
+	// if neither carries one.
+	Kid []byte
+
+	Checkpoint Checkpoint
+}
+
+// ListCheckpoints decodes every checkpoint object of the log, in massif
+// order, and returns their metadata. Massifs without a checkpoint are
+// skipped, and a log with none returns an empty list. The sealed sizes must
+// strictly increase with the massif index, otherwise
+// ErrCheckpointsNotMonotonic is returned.
+//
+// If tenant is not empty, each checkpoint must carry the conventional issuer
+// claim for it, see SealClaims, otherwise ErrCheckpointTenantMismatch is
+// returned.
+//
+// The signatures are not verified, the results are for presentation and
+// indexing. Use GetContextVerified before relying on a checkpoint.
+func ListCheckpoints(ctx context.Context, reader ObjectReader, tenant string) ([]CheckpointInfo, error) {
+	head, err := reader.HeadIndex(ctx, storage.ObjectCheckpoint)
+	if storage.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []CheckpointInfo
+	for i := uint32(0); i <= head; i++ {
+		data, err := reader.CheckpointRead(ctx, i)
+		if storage.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("massif %d: %w", i, err)
+		}
+		check, err := NewCheckpoint(data)
+		if err != nil {
+			return nil, fmt.Errorf("massif %d: %w", i, err)
+		}
+		if n := len(infos); n > 0 && check.MMRSize <= infos[n-1].MMRSize {
+			return nil, fmt.Errorf("%w: massif %d seals %d, massif %d sealed %d",
+				ErrCheckpointsNotMonotonic, i, check.MMRSize, infos[n-1].MassifIndex, infos[n-1].MMRSize)
+		}
+		info, err := newCheckpointInfo(ctx, reader, i, check, tenant)
+		if err != nil {
+			return nil, fmt.Errorf("massif %d: %w", i, err)
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func newCheckpointInfo(
+	ctx context.Context, reader ObjectReader, massifIndex uint32, check Checkpoint, tenant string,
+) (CheckpointInfo, error) {
+	info := CheckpointInfo{MassifIndex: massifIndex, MMRSize: check.MMRSize, Checkpoint: check}
+
+	var err error
+	info.Issuer, info.Subject, err = SealIdentity(check.Receipt.ProtectedHeader)
+	if err != nil && !errors.Is(err, ErrNoSealIdentity) {
+		return CheckpointInfo{}, err
+	}
+	if tenant != "" {
+		issued, err := SealClaims{Issuer: info.Issuer}.Tenant()
+		if err != nil || issued != tenant {
+			return CheckpointInfo{}, fmt.Errorf("%w: issuer %q, tenant %q", ErrCheckpointTenantMismatch, info.Issuer, tenant)
+		}
+	}
+
+	info.Kid, err = protectedHeaderKid(check.Receipt.ProtectedHeader)
+	if err != nil {
+		return CheckpointInfo{}, err
+	}
+	if info.Kid == nil && len(check.Receipt.PeakReceipts) > 0 {
+		var receipt cose.Sign1Message
+		if err = receipt.UnmarshalCBOR(check.Receipt.PeakReceipts[0]); err != nil {
+			return CheckpointInfo{}, fmt.Errorf("decode peak receipt: %w", err)
+		}
+		info.Kid, _ = receipt.Headers.Protected[cose.HeaderLabelKeyID].([]byte)
+	}
+
+	leafCount := mmr.LeafCount(check.MMRSize)
+	if leafCount == 0 {
+		return info, nil
+	}
+	mc, err := GetMassifContext(ctx, reader, massifIndex)
+	if err != nil {
+		return CheckpointInfo{}, err
+	}
+	if mc.requireV2Index() != nil && leafCount != mmr.LeafCount(mc.RangeCount()) {
+		return info, nil
+	}
+	id, err := leafIDTimestamp(&mc, leafCount-1)
+	if err != nil {
+		return CheckpointInfo{}, err
+	}
+	if info.Timestamp, err = idTimestampTime(id, mc.Start.CommitmentEpoch); err != nil {
+		return CheckpointInfo{}, err
+	}
+	return info, nil
+}
+
+// protectedHeaderKid reads the key id (label 4) from a protected header, it
+// returns nil if there is none.
+func protectedHeaderKid(protectedHeader []byte) ([]byte, error) {
+	var m map[int64]cbor.RawMessage
+	if err := cbor.Unmarshal(protectedHeader, &m); err != nil {
+		return nil, fmt.Errorf("decode protected header: %w", err)
+	}
+	raw, ok := m[cose.HeaderLabelKeyID]
+	if !ok {
+		return nil, nil
+	}
+	var kid []byte
+	if err := cbor.Unmarshal(raw, &kid); err != nil {
+		return nil, fmt.Errorf("decode kid: %w", err)
+	}
+	return kid, nil
+}
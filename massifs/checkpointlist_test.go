@@ -0,0 +1,71 @@
+package massifs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+func TestListCheckpoints(t *testing.T) {
+	ctx := context.Background()
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	// massif 1 is not sealed, massif 2 is sealed before its last leaf
+	store := buildTimedLog(t, base, 11, 3, 9)
+
+	// re-seal massif 2 with claims and peak receipts
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := cose.NewSigner(cose.AlgorithmES256, key)
+	require.NoError(t, err)
+	check, err := NewCheckpoint(store.checkpoint[2])
+	require.NoError(t, err)
+	mc, err := GetMassifContext(ctx, store, 2)
+	require.NoError(t, err)
+	proof, err := BuildConsistencyProof(&mc, 0, check.MMRSize)
+	require.NoError(t, err)
+	accumulator, err := mmr.PeakHashes(&mc, check.MMRSize-1)
+	require.NoError(t, err)
+	claims, err := NewSealClaims("acme", storage.LogID(make([]byte, 16)), 1)
+	require.NoError(t, err)
+	store.checkpoint[2], err = SignCheckpointReceipt(signer, proof, accumulator,
+		WithSealClaims(claims), WithPeakReceipts([]byte("seal-kid")))
+	require.NoError(t, err)
+
+	infos, err := ListCheckpoints(ctx, store, "")
+	require.NoError(t, err)
+	require.Len(t, infos, 2)
+
+	require.Equal(t, uint32(0), infos[0].MassifIndex)
+	require.Equal(t, uint64(7), infos[0].MMRSize)
+	require.Equal(t, base.Add(3*time.Minute), infos[0].Timestamp)
+	require.Empty(t, infos[0].Issuer)
+	require.Nil(t, infos[0].Kid)
+
+	require.Equal(t, uint32(2), infos[1].MassifIndex)
+	require.Equal(t, check.MMRSize, infos[1].MMRSize)
+	require.Equal(t, base.Add(9*time.Minute), infos[1].Timestamp)
+	require.Equal(t, claims.Issuer, infos[1].Issuer)
+	require.Equal(t, claims.Subject, infos[1].Subject)
+	require.Equal(t, []byte("seal-kid"), infos[1].Kid)
+
+	// massif 0 has no issuer, so it is not attributed to any tenant
+	_, err = ListCheckpoints(ctx, store, "acme")
+	require.ErrorIs(t, err, ErrCheckpointTenantMismatch)
+
+	// a seal which goes backwards is rejected
+	store.checkpoint[2] = store.checkpoint[0]
+	_, err = ListCheckpoints(ctx, store, "")
+	require.ErrorIs(t, err, ErrCheckpointsNotMonotonic)
+
+	infos, err = ListCheckpoints(ctx, newMemStore(nil, nil), "")
+	require.NoError(t, err)
+	require.Empty(t, infos)
+}
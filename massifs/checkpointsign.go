@@ -1,11 +1,14 @@
 package massifs
 
 import (
+	"bytes"
 	"crypto/elliptic"
 	"crypto/rand"
 	"fmt"
+	"maps"
 	"math/big"
 
+	commoncose "github.com/forestrie/go-merklelog/massifs/cose"
 	"github.com/fxamacker/cbor/v2"
 	"github.com/veraison/go-cose"
 )
@@ -37,12 +40,76 @@ func normalizeSignatureLowS(alg cose.Algorithm, sig []byte) []byte {
 }
 
 // CheckpointSignOption configures optional checkpoint receipt content.
-type CheckpointSignOption func(*checkpointSignOptions)
+type CheckpointSignOption func(*CheckpointSignOptions)
 
-type checkpointSignOptions struct {
-	peakReceipts bool
-	kid          []byte
-	extras       map[int64]cbor.RawMessage
+// CheckpointSignOptions is the optional checkpoint receipt content, as set by
+// the CheckpointSignOption constructors. See NewCheckpointSignOptions.
+type CheckpointSignOptions struct {
+	// PeakReceipts requests the pre-signed peak receipts, see WithPeakReceipts
+	PeakReceipts bool
+	// KID identifies the signing key in the peak receipts, it may be nil
+	KID []byte
+	// SealKID puts KID in the checkpoint protected header too, see
+	// WithSealKID
+	SealKID           bool
+	UnprotectedExtras map[int64]cbor.RawMessage
+	// PreviousPeakReceipts maps the peak value of a previous seal to its
+	// peak receipt, see WithPreviousPeakReceipts.
+	PreviousPeakReceipts map[string][]byte
+	// PreviousPeakReceiptsVerifier verifies a previous receipt was signed by
+	// the key signing now, before it is reused
+	PreviousPeakReceiptsVerifier cose.Verifier
+	// PeakReceiptCache, if set, records the peak receipts verified for
+	// reuse, and those signed, see WithPeakReceiptCache
+	PeakReceiptCache *SignatureCache
+	// Concurrency is the number of seals SignCheckpointReceipts signs at
+	// once, values < 2 sign one at a time.
+	Concurrency int
+	Claims      *SealClaims
+	Version     *SealVersion
+	// IndexCommitment, if set, is carried under SealIndexCommitmentLabel
+	IndexCommitment []byte
+	// IndexConfig, if set, is carried under SealIndexConfigLabel
+	IndexConfig *IndexConfig
+	// SignMMRSize signs the size of each seal under SealMMRSizeLabel, see
+	// WithSealMMRSize
+	SignMMRSize bool
+}
+
+// NewCheckpointSignOptions returns the options record opts configure
+func NewCheckpointSignOptions(opts ...CheckpointSignOption) (CheckpointSignOptions, error) {
+	var options CheckpointSignOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options, options.Validate()
+}
+
+// Validate returns an error wrapping ErrInvalidOptions if the options can not
+// be signed with.
+func (o CheckpointSignOptions) Validate() error {
+	if o.Concurrency < 0 {
+		return fmt.Errorf("%w: sign concurrency %d", ErrInvalidOptions, o.Concurrency)
+	}
+	for label := range o.UnprotectedExtras {
+		if label == checkpointLabelVDP || label == SealPeakReceiptsLabel {
+			return fmt.Errorf("%w: unprotected extra label %d is reserved", ErrInvalidOptions, label)
+		}
+	}
+	return nil
+}
+
+// WithCheckpointSignOptions adapts checkpoint sign options to the generic
+// Option, for the entry points configured with ApplyOptions, see
+// ApplyOptions. They apply to CheckpointSignOptions records.
+func WithCheckpointSignOptions(opts ...CheckpointSignOption) Option {
+	return func(a any) {
+		if options, ok := a.(*CheckpointSignOptions); ok {
+			for _, opt := range opts {
+				opt(options)
+			}
+		}
+	}
 }
 
 // WithPeakReceipts requests one pre-signed peak inclusion receipt per
@@ -50,9 +117,9 @@ type checkpointSignOptions struct {
 // checkpoint's unprotected header. kid identifies the signing key in each
 // receipt's protected header (label 4); it may be nil. See SignPeakReceipts.
 func WithPeakReceipts(kid []byte) CheckpointSignOption {
-	return func(o *checkpointSignOptions) {
-		o.peakReceipts = true
-		o.kid = kid
+	return func(o *CheckpointSignOptions) {
+		o.PeakReceipts = true
+		o.KID = kid
 	}
 }
 
@@ -60,11 +127,124 @@ func WithPeakReceipts(kid []byte) CheckpointSignOption {
 // encoded checkpoint (delegation material, certificates). The values are
 // carried verbatim and do not affect the checkpoint signature.
 func WithUnprotectedExtras(extras map[int64]cbor.RawMessage) CheckpointSignOption {
-	return func(o *checkpointSignOptions) {
-		o.extras = extras
+	return func(o *CheckpointSignOptions) {
+		o.UnprotectedExtras = extras
+	}
+}
+
+// WithSealClaims adds the CWT issuer and subject claims (label 15) to the
+// checkpoint protected header, so the signature binds the seal to its log.
+// See NewSealClaims for the conventions, the claims are not checked here.
+func WithSealClaims(claims SealClaims) CheckpointSignOption {
+	return func(o *CheckpointSignOptions) {
+		o.Claims = &claims
+	}
+}
+
+// WithPreviousPeakReceipts provides the accumulator and peak receipts of the
+// previous seal of the same log. A peak receipt is over the peak value alone,
+// so where a peak is unchanged its receipt is reused rather than signed again.
+// Consecutive seals of the same massif typically share all but the smallest
+// peaks.
+//
+// verifier is for the public key of the signer signing now. A previous
+// receipt is only reused if its protected header is the one that would be
+// signed now and verifier verifies its signature over the peak, so a receipt
+// signed before a key rotation, or one which is corrupt, is signed again
+// rather than carried into the new seal. Without a verifier nothing is
+// reused.
+func WithPreviousPeakReceipts(verifier cose.Verifier, accumulator [][]byte, receipts [][]byte) CheckpointSignOption {
+	return func(o *CheckpointSignOptions) {
+		if verifier == nil || len(accumulator) != len(receipts) {
+			return
+		}
+		o.PreviousPeakReceiptsVerifier = verifier
+		o.PreviousPeakReceipts = make(map[string][]byte, len(receipts))
+		for i, peak := range accumulator {
+			o.PreviousPeakReceipts[string(peak)] = receipts[i]
+		}
+	}
+}
+
+// WithPeakReceiptCache records the peak receipts verified for reuse by
+// WithPreviousPeakReceipts in cache, and those signed, as verified by its
+// verifier. The first seal of a log, with no previous receipts, can give the
+// verifier with empty receipts. A peak changes ever less often as the log grows, so most receipts
+// are carried through many seals, with the cache each is verified at most
+// once rather than once per seal. Keep one cache for the life of the sealer.
+func WithPeakReceiptCache(cache *SignatureCache) CheckpointSignOption {
+	return func(o *CheckpointSignOptions) {
+		o.PeakReceiptCache = cache
 	}
 }
 
+// WithSignConcurrency sets the number of seals SignCheckpointReceipts signs
+// at once. The signer must be safe for concurrent use. The default is 1.
+func WithSignConcurrency(n int) CheckpointSignOption {
+	return func(o *CheckpointSignOptions) {
+		o.Concurrency = n
+	}
+}
+
+// checkpointSigner holds the encoding work which is the same for every seal
+// made with one signer.
+type checkpointSigner struct {
+	signer cose.Signer
+	// protected is the checkpoint protected header
+	protected []byte
+	// peakProtected is the peak receipt protected header
+	peakProtected []byte
+	// headers are the checkpoint protected headers, re-encoded with the size
+	// of each seal if signMMRSize is set
+	headers     map[int64]any
+	signMMRSize bool
+}
+
+// newCheckpointSigner encodes the protected headers selected by the options
+func newCheckpointSigner(signer cose.Signer, options *CheckpointSignOptions) (*checkpointSigner, error) {
+	checkpointHeaders := map[int64]any{
+		checkpointLabelAlg: int64(signer.Algorithm()),
+		checkpointLabelVDS: CheckpointVDSConsistency,
+	}
+	if options.Claims != nil {
+		checkpointHeaders[commoncose.HeaderLabelCWTClaims] = map[int64]string{
+			cwtClaimIssuer:  options.Claims.Issuer,
+			cwtClaimSubject: options.Claims.Subject,
+		}
+	}
+	if options.Version != nil {
+		checkpointHeaders[SealVersionLabel] = options.Version.encoded()
+	}
+	if options.IndexCommitment != nil {
+		checkpointHeaders[SealIndexCommitmentLabel] = options.IndexCommitment
+	}
+	if options.IndexConfig != nil && !options.IndexConfig.IsZero() {
+		checkpointHeaders[SealIndexConfigLabel] = *options.IndexConfig
+	}
+	if options.SealKID && len(options.KID) > 0 {
+		checkpointHeaders[int64(cose.HeaderLabelKeyID)] = options.KID
+	}
+	protected, err := canonicalReceiptCBOR.Marshal(checkpointHeaders)
+	if err != nil {
+		return nil, fmt.Errorf("encode protected header: %w", err)
+	}
+	headers := map[int64]any{
+		checkpointLabelAlg: int64(signer.Algorithm()),
+		checkpointLabelVDS: CheckpointVDSConsistency,
+	}
+	if len(options.KID) > 0 {
+		headers[int64(cose.HeaderLabelKeyID)] = options.KID
+	}
+	peakProtected, err := canonicalReceiptCBOR.Marshal(headers)
+	if err != nil {
+		return nil, fmt.Errorf("encode peak receipt protected header: %w", err)
+	}
+	return &checkpointSigner{
+		signer: signer, protected: protected, peakProtected: peakProtected,
+		headers: checkpointHeaders, signMMRSize: options.SignMMRSize,
+	}, nil
+}
+
 // SignCheckpointReceipt produces a format-v3 checkpoint object (draft-bryce
 // COSE Receipt of Consistency, ADR-0046): it signs the detached raw-concat
 // payload of the accumulator for the seal's mmr size, over the COSE
@@ -74,8 +254,11 @@ func WithUnprotectedExtras(extras map[int64]cbor.RawMessage) CheckpointSignOptio
 // The signer is the log's COSE signer (the sealer's delegated ES256/KMS key,
 // or a root key). The protected header is {1: alg, 395: vds=3}; the contract
 // reads the algorithm from label 1 and derives the same detached payload from
-// the proof, so the signature verifies on-chain. The delegation proof and CWT
-// claims are added by the sealer/consumer layers as needed.
+// the proof, so the signature verifies on-chain. The delegation proof is added
+// by the sealer/consumer layers as needed, CWT claims with WithSealClaims, the
+// seal version attestation with WithSealVersion, the index commitment with
+// WithSealIndexCommitment, the index configuration with WithSealIndexConfig
+// and the mmr size with WithSealMMRSize.
 //
 // With WithPeakReceipts, one additional detached-payload COSE_Sign1 is signed
 // per accumulator peak and carried in the unprotected header, enabling any
@@ -85,35 +268,47 @@ func SignCheckpointReceipt(
 	signer cose.Signer, proof ConsistencyProof, accumulator [][]byte,
 	opts ...CheckpointSignOption,
 ) ([]byte, error) {
-	var options checkpointSignOptions
-	for _, opt := range opts {
-		opt(&options)
+	options, err := NewCheckpointSignOptions(opts...)
+	if err != nil {
+		return nil, err
 	}
-
-	protected, err := canonicalReceiptCBOR.Marshal(map[int64]int64{
-		checkpointLabelAlg: int64(signer.Algorithm()),
-		checkpointLabelVDS: CheckpointVDSConsistency,
-	})
+	cs, err := newCheckpointSigner(signer, &options)
 	if err != nil {
-		return nil, fmt.Errorf("encode protected header: %w", err)
+		return nil, err
+	}
+	return cs.sign(proof, accumulator, &options)
+}
+
+func (cs *checkpointSigner) sign(
+	proof ConsistencyProof, accumulator [][]byte, options *CheckpointSignOptions,
+) ([]byte, error) {
+	protected := cs.protected
+	if cs.signMMRSize {
+		headers := maps.Clone(cs.headers)
+		headers[SealMMRSizeLabel] = proof.TreeSize2
+		var err error
+		if protected, err = canonicalReceiptCBOR.Marshal(headers); err != nil {
+			return nil, fmt.Errorf("encode protected header: %w", err)
+		}
 	}
 
 	// The signature is over Sig_structure(protected, detached payload); the
 	// COSE signer applies the algorithm's hash before signing, matching the
 	// contract's sha256/keccak of the same Sig_structure bytes.
 	sigStructure := SigStructure(protected, DetachedPayload(accumulator))
-	signature, err := signer.Sign(rand.Reader, sigStructure)
+	signature, err := cs.signer.Sign(rand.Reader, sigStructure)
 	if err != nil {
 		return nil, fmt.Errorf("sign checkpoint receipt: %w", err)
 	}
-	signature = normalizeSignatureLowS(signer.Algorithm(), signature)
+	signature = normalizeSignatureLowS(cs.signer.Algorithm(), signature)
 
 	extras := map[int64]cbor.RawMessage{}
-	for label, value := range options.extras {
+	for label, value := range options.UnprotectedExtras {
 		extras[label] = value
 	}
-	if options.peakReceipts {
-		receipts, err := SignPeakReceipts(signer, options.kid, accumulator)
+	if options.PeakReceipts {
+		receipts, err := cs.signPeakReceipts(
+			accumulator, options.PreviousPeakReceipts, options.PreviousPeakReceiptsVerifier, options.PeakReceiptCache)
 		if err != nil {
 			return nil, err
 		}
@@ -146,26 +341,39 @@ func SignCheckpointReceipt(
 // material; verifiers obtain the log's public key the same way as for the
 // checkpoint itself. kid may be nil, in which case label 4 is omitted.
 func SignPeakReceipts(signer cose.Signer, kid []byte, accumulator [][]byte) ([][]byte, error) {
-	headers := map[int64]any{
-		checkpointLabelAlg: int64(signer.Algorithm()),
-		checkpointLabelVDS: CheckpointVDSConsistency,
-	}
-	if len(kid) > 0 {
-		headers[int64(cose.HeaderLabelKeyID)] = kid
-	}
-	protected, err := canonicalReceiptCBOR.Marshal(headers)
+	cs, err := newCheckpointSigner(signer, &CheckpointSignOptions{KID: kid})
 	if err != nil {
-		return nil, fmt.Errorf("encode peak receipt protected header: %w", err)
+		return nil, err
 	}
+	return cs.signPeakReceipts(accumulator, nil, nil, nil)
+}
 
+// signPeakReceipts signs the peak receipts, reusing those in previous which
+// are reusable, see isPeakReceiptReusable. With a cache, the verifications
+// are cached, and the receipts signed are recorded as verified by verifier,
+// which is for the key signing them.
+func (cs *checkpointSigner) signPeakReceipts(
+	accumulator [][]byte, previous map[string][]byte, verifier cose.Verifier, cache *SignatureCache,
+) ([][]byte, error) {
+	if cache != nil && verifier != nil {
+		verifier = cache.Verifier(verifier)
+	}
 	receipts := make([][]byte, len(accumulator))
 	for i, peak := range accumulator {
-		signature, err := signer.Sign(rand.Reader, SigStructure(protected, peak))
+		if prev, ok := previous[string(peak)]; ok && cs.isPeakReceiptReusable(peak, prev, verifier) {
+			receipts[i] = prev
+			continue
+		}
+		sigStructure := SigStructure(cs.peakProtected, peak)
+		signature, err := cs.signer.Sign(rand.Reader, sigStructure)
 		if err != nil {
 			return nil, fmt.Errorf("sign peak receipt %d: %w", i, err)
 		}
-		signature = normalizeSignatureLowS(signer.Algorithm(), signature)
-		sign1 := []any{protected, map[int64]cbor.RawMessage{}, nil, signature}
+		signature = normalizeSignatureLowS(cs.signer.Algorithm(), signature)
+		if cached, ok := verifier.(*cachingVerifier); ok {
+			cached.cache.Record(cached.Verifier, sigStructure, signature)
+		}
+		sign1 := []any{cs.peakProtected, map[int64]cbor.RawMessage{}, nil, signature}
 		receipts[i], err = canonicalReceiptCBOR.Marshal(cbor.Tag{Number: 18, Content: sign1})
 		if err != nil {
 			return nil, fmt.Errorf("encode peak receipt %d: %w", i, err)
@@ -174,6 +382,34 @@ func SignPeakReceipts(signer cose.Signer, kid []byte, accumulator [][]byte) ([][
 	return receipts, nil
 }
 
+// isPeakReceiptReusable returns true if receipt has the protected header this
+// signer would produce, and verifier, which is for the key of this signer,
+// verifies its signature over the peak.
+func (cs *checkpointSigner) isPeakReceiptReusable(peak []byte, receipt []byte, verifier cose.Verifier) bool {
+	if verifier == nil || verifier.Algorithm() != cs.signer.Algorithm() {
+		return false
+	}
+	var tag cbor.RawTag
+	if err := cbor.Unmarshal(receipt, &tag); err != nil || tag.Number != 18 {
+		return false
+	}
+	var sign1 []cbor.RawMessage
+	if err := cbor.Unmarshal(tag.Content, &sign1); err != nil || len(sign1) != 4 {
+		return false
+	}
+	var protected, signature []byte
+	if err := cbor.Unmarshal(sign1[0], &protected); err != nil {
+		return false
+	}
+	if !bytes.Equal(protected, cs.peakProtected) {
+		return false
+	}
+	if err := cbor.Unmarshal(sign1[3], &signature); err != nil {
+		return false
+	}
+	return verifier.Verify(SigStructure(cs.peakProtected, peak), signature) == nil
+}
+
 // ProtectedHeaderAlgorithm reads the COSE algorithm from a checkpoint receipt's
 // protected header (label 1), as the contract does. Useful for consumers
 // selecting a verification path.
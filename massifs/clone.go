@@ -0,0 +1,188 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/veraison/go-cose"
+)
+
+// ForkBindingContentType is the protected header content type (label 3) of a
+// signed fork binding.
+const ForkBindingContentType = "application/vnd.forestrie.merklelog-fork-binding+cbor"
+
+var ErrForkBindingInvalid = errors.New("the fork binding is invalid")
+
+// ForkBinding links the seal of a log under its original issuer to the seal
+// of a clone under a new issuer, at the fork point. Both seals sign the same
+// accumulator, which is what makes the logs equivalent up to MMRSize.
+type ForkBinding struct {
+	// MassifIndex is the last massif cloned
+	MassifIndex uint32 `cbor:"1,keyasint"`
+	// MMRSize is the size sealed by both checkpoints
+	MMRSize     uint64   `cbor:"2,keyasint"`
+	Accumulator [][]byte `cbor:"3,keyasint"`
+	// SourceCheckpointSHA256 is the digest of the original issuer's
+	// checkpoint object for MassifIndex
+	SourceCheckpointSHA256 []byte `cbor:"4,keyasint"`
+	// CloneCheckpointSHA256 is the digest of the new issuer's checkpoint
+	// object for MassifIndex
+	CloneCheckpointSHA256 []byte `cbor:"5,keyasint"`
+}
+
+// CloneLog copies the sealed massifs of the source log to the sink unchanged,
+// and seals each under the new issuer's signer. Every massif is verified
+// against its source checkpoint, and consistent with its predecessor, before
+// it is copied. Massif data is not re-encoded, so the clone has the same
+// leaves, idtimestamps and index as the source. Data committed after the last
+// source checkpoint is not copied.
+//
+// The new checkpoints carry the source consistency proofs, and the opts
+// select their optional content as for SignCheckpointReceipt. On success the
+// fork binding for the last massif is returned, and the binding signed by the
+// new issuer, see SignForkBinding. The original issuer can countersign the
+// same binding to complete the cross-signature.
+func CloneLog(
+	ctx context.Context, source ObjectReader, sink ObjectWriter,
+	verifier cose.Verifier, signer cose.Signer, opts ...CheckpointSignOption,
+) ([]byte, *ForkBinding, error) {
+	head, err := source.HeadIndex(ctx, storage.ObjectCheckpoint)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var vc *VerifiedContext
+	var cloned Checkpoint
+	for i := uint32(0); i <= head; i++ {
+		var verifyOpts []Option
+		if vc != nil {
+			verifyOpts = append(verifyOpts, WithVerifyTrustedState(MMRState{
+				MMRSize: vc.Checkpoint.MMRSize,
+				Peaks:   vc.Accumulator,
+			}))
+		}
+		vc, err = GetContextVerified(ctx, source, verifier, i, verifyOpts...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("massif %d: %w", i, err)
+		}
+
+		raw, err := SignCheckpointReceipt(signer, vc.Checkpoint.Receipt.Proof, vc.Accumulator, opts...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("massif %d: %w", i, err)
+		}
+		if cloned, err = NewCheckpoint(raw); err != nil {
+			return nil, nil, fmt.Errorf("massif %d: %w", i, err)
+		}
+
+		clone := *vc
+		clone.Checkpoint = cloned
+		if err = ReplaceVerifiedContext(ctx, sink, &clone); err != nil {
+			return nil, nil, fmt.Errorf("massif %d: %w", i, err)
+		}
+	}
+
+	sourceSum := sha256.Sum256(vc.Checkpoint.Raw)
+	cloneSum := sha256.Sum256(cloned.Raw)
+	binding := &ForkBinding{
+		MassifIndex:            head,
+		MMRSize:                vc.Checkpoint.MMRSize,
+		Accumulator:            vc.Accumulator,
+		SourceCheckpointSHA256: sourceSum[:],
+		CloneCheckpointSHA256:  cloneSum[:],
+	}
+	signed, err := SignForkBinding(signer, binding)
+	if err != nil {
+		return nil, nil, err
+	}
+	return signed, binding, nil
+}
+
+// SignForkBinding signs the binding as a tagged COSE_Sign1 with the encoded
+// binding attached. The original and the new issuer each sign it.
+func SignForkBinding(signer cose.Signer, binding *ForkBinding) ([]byte, error) {
+	payload, err := canonicalReceiptCBOR.Marshal(binding)
+	if err != nil {
+		return nil, fmt.Errorf("encode fork binding: %w", err)
+	}
+	msg := cose.NewSign1Message()
+	msg.Headers.Protected.SetAlgorithm(signer.Algorithm())
+	msg.Headers.Protected[cose.HeaderLabelContentType] = ForkBindingContentType
+	msg.Payload = payload
+	if err = msg.Sign(rand.Reader, nil, signer); err != nil {
+		return nil, fmt.Errorf("sign fork binding: %w", err)
+	}
+	return msg.MarshalCBOR()
+}
+
+// VerifyForkBinding verifies a signature over a fork binding and returns the
+// binding. The checkpoints it names are not checked, VerifyForkCheckpoints
+// does that.
+func VerifyForkBinding(data []byte, verifier cose.Verifier) (*ForkBinding, error) {
+	if verifier == nil {
+		return nil, ErrVerifierRequired
+	}
+	var msg cose.Sign1Message
+	if err := msg.UnmarshalCBOR(data); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrForkBindingInvalid, err)
+	}
+	if ct, _ := msg.Headers.Protected[cose.HeaderLabelContentType].(string); ct != ForkBindingContentType {
+		return nil, fmt.Errorf("%w: content type %v", ErrForkBindingInvalid, msg.Headers.Protected[cose.HeaderLabelContentType])
+	}
+	if err := msg.Verify(nil, verifier); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrForkBindingInvalid, err)
+	}
+	var binding ForkBinding
+	if err := cbor.Unmarshal(msg.Payload, &binding); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrForkBindingInvalid, err)
+	}
+	return &binding, nil
+}
+
+// VerifyForkCheckpoints checks the source and clone checkpoint objects are
+// those named by the binding, and that each issuer's signature is over the
+// binding's accumulator.
+func VerifyForkCheckpoints(
+	binding *ForkBinding,
+	sourceCheckpoint []byte, sourceVerifier cose.Verifier,
+	cloneCheckpoint []byte, cloneVerifier cose.Verifier,
+) error {
+	for _, c := range []struct {
+		raw      []byte
+		verifier cose.Verifier
+		sum      []byte
+		name     string
+	}{
+		{sourceCheckpoint, sourceVerifier, binding.SourceCheckpointSHA256, "source"},
+		{cloneCheckpoint, cloneVerifier, binding.CloneCheckpointSHA256, "clone"},
+	} {
+		sum := sha256.Sum256(c.raw)
+		if !bytes.Equal(sum[:], c.sum) {
+			return fmt.Errorf("%w: %s checkpoint digest differs", ErrForkBindingInvalid, c.name)
+		}
+		check, err := NewCheckpoint(c.raw)
+		if err != nil {
+			return err
+		}
+		if check.MMRSize != binding.MMRSize {
+			return fmt.Errorf("%w: %s checkpoint size %d, binding %d",
+				ErrForkBindingInvalid, c.name, check.MMRSize, binding.MMRSize)
+		}
+		if c.verifier == nil {
+			return ErrVerifierRequired
+		}
+		err = c.verifier.Verify(
+			SigStructure(check.Receipt.ProtectedHeader, DetachedPayload(binding.Accumulator)),
+			check.Receipt.Signature,
+		)
+		if err != nil {
+			return fmt.Errorf("%w: %s checkpoint: %v", ErrForkBindingInvalid, c.name, err)
+		}
+	}
+	return nil
+}
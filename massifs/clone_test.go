@@ -0,0 +1,61 @@
+package massifs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+func TestCloneLog(t *testing.T) {
+	ctx := context.Background()
+	oldKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	oldSigner, err := cose.NewSigner(cose.AlgorithmES256, oldKey)
+	require.NoError(t, err)
+	newSigner, err := cose.NewSigner(cose.AlgorithmES256, newKey)
+	require.NoError(t, err)
+	oldVerifier := newES256Verifier(t, &oldKey.PublicKey)
+	newVerifier := newES256Verifier(t, &newKey.PublicKey)
+
+	source := buildSealedLogWithKey(t, oldKey, 3, 10)
+	sink := newMemStore(nil, nil)
+	signed, binding, err := CloneLog(ctx, source, sink, oldVerifier, newSigner)
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), binding.MassifIndex)
+
+	for i := range uint32(3) {
+		require.Equal(t, source.massifs[i], sink.massifs[i])
+		_, err = GetContextVerified(ctx, sink, newVerifier, i)
+		require.NoError(t, err)
+		_, err = GetContextVerified(ctx, sink, oldVerifier, i)
+		require.Error(t, err)
+	}
+
+	got, err := VerifyForkBinding(signed, newVerifier)
+	require.NoError(t, err)
+	require.Equal(t, binding, got)
+	_, err = VerifyForkBinding(signed, oldVerifier)
+	require.ErrorIs(t, err, ErrForkBindingInvalid)
+
+	// the original issuer countersigns the same binding
+	countersigned, err := SignForkBinding(oldSigner, binding)
+	require.NoError(t, err)
+	_, err = VerifyForkBinding(countersigned, oldVerifier)
+	require.NoError(t, err)
+
+	require.NoError(t, VerifyForkCheckpoints(
+		binding, source.checkpoint[2], oldVerifier, sink.checkpoint[2], newVerifier))
+	err = VerifyForkCheckpoints(
+		binding, source.checkpoint[1], oldVerifier, sink.checkpoint[2], newVerifier)
+	require.ErrorIs(t, err, ErrForkBindingInvalid)
+	err = VerifyForkCheckpoints(
+		binding, source.checkpoint[2], newVerifier, sink.checkpoint[2], newVerifier)
+	require.ErrorIs(t, err, ErrForkBindingInvalid)
+}
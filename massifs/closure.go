@@ -0,0 +1,193 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/veraison/go-cose"
+)
+
+// ClosureStatementContentType is the protected header content type (label 3)
+// of a signed closure statement.
+const ClosureStatementContentType = "application/vnd.forestrie.merklelog-closure+cbor"
+
+var (
+	ErrClosureStatementInvalid = errors.New("the closure statement is invalid")
+	ErrClosureUnsealed         = errors.New("the log has data which is not sealed, it can not be closed")
+	ErrClosureMassifMismatch   = errors.New("the massif data is not the data the log was closed with")
+)
+
+// ClosureStatement is the tombstone of a deleted log. It records the final
+// sealed state of the log, and a digest of every massif, so that once the
+// log data is deleted there remains signed evidence that the log existed and
+// was intact when it was closed. Anyone retaining a copy of a massif can
+// check it against the statement, see CheckMassif.
+type ClosureStatement struct {
+	MassifHeight uint8 `cbor:"1,keyasint"`
+	// MassifIndex is the last massif of the log
+	MassifIndex uint32 `cbor:"2,keyasint"`
+	// MMRSize is the size of the log, every node is sealed
+	MMRSize     uint64   `cbor:"3,keyasint"`
+	Accumulator [][]byte `cbor:"4,keyasint"`
+	// MassifSHA256 is the digest of each massif's data, in massif order
+	MassifSHA256 [][]byte `cbor:"5,keyasint"`
+	// CheckpointSHA256 is the digest of the last checkpoint object
+	CheckpointSHA256 []byte `cbor:"6,keyasint"`
+	// ClosedAt is the time the log was closed, in unix milliseconds
+	ClosedAt int64 `cbor:"7,keyasint"`
+}
+
+// LogClosureReader is implemented by readers which can recognize a closed
+// log. Such readers report the objects of a closed log as not found with
+// storage.ErrLogClosed, rather than storage.ErrDoesNotExist.
+type LogClosureReader interface {
+	// LogClosure returns the signed closure statement object. A NotFoundError
+	// is returned if the log has not been closed.
+	LogClosure(ctx context.Context) ([]byte, error)
+}
+
+// NewClosureStatement verifies every massif of the log, each against its
+// checkpoint and consistent with its predecessor, and returns the statement
+// for closing it at closedAt. The last checkpoint must seal all of the log
+// data, otherwise ErrClosureUnsealed is returned.
+func NewClosureStatement(
+	ctx context.Context, reader ObjectReader, verifier cose.Verifier, closedAt time.Time,
+) (*ClosureStatement, error) {
+	head, err := reader.HeadIndex(ctx, storage.ObjectMassifData)
+	if err != nil {
+		return nil, err
+	}
+
+	statement := &ClosureStatement{
+		MassifIndex: head,
+		ClosedAt:    closedAt.UnixMilli(),
+	}
+	var vc *VerifiedContext
+	for i := uint32(0); i <= head; i++ {
+		var verifyOpts []Option
+		if vc != nil {
+			verifyOpts = append(verifyOpts, WithVerifyTrustedState(MMRState{
+				MMRSize: vc.Checkpoint.MMRSize,
+				Peaks:   vc.Accumulator,
+			}))
+		}
+		vc, err = GetContextVerified(ctx, reader, verifier, i, verifyOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("massif %d: %w", i, err)
+		}
+		sum := sha256.Sum256(vc.Data)
+		statement.MassifSHA256 = append(statement.MassifSHA256, sum[:])
+	}
+	if vc.Checkpoint.MMRSize != vc.RangeCount() {
+		return nil, fmt.Errorf("%w: sealed %d of %d nodes", ErrClosureUnsealed, vc.Checkpoint.MMRSize, vc.RangeCount())
+	}
+
+	sum := sha256.Sum256(vc.Checkpoint.Raw)
+	statement.MassifHeight = vc.Start.MassifHeight
+	statement.MMRSize = vc.Checkpoint.MMRSize
+	statement.Accumulator = vc.Accumulator
+	statement.CheckpointSHA256 = sum[:]
+	return statement, nil
+}
+
+// CloseLog produces the signed closure statement for the log and puts it
+// under storage.ObjectLogClosure, named for the last massif. It fails if the
+// log has already been closed. Once CloseLog returns, the massif and
+// checkpoint objects of the log may be deleted, that is left to the caller as
+// it is specific to the storage backend.
+func CloseLog(
+	ctx context.Context, reader ObjectReader, writer ObjectWriter, verifier cose.Verifier, signer cose.Signer,
+) ([]byte, *ClosureStatement, error) {
+	statement, err := NewClosureStatement(ctx, reader, verifier, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	signed, err := SignClosureStatement(signer, statement)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = writer.Put(ctx, statement.MassifIndex, storage.ObjectLogClosure, signed, true); err != nil {
+		return nil, nil, err
+	}
+	return signed, statement, nil
+}
+
+// SignClosureStatement signs the statement as a tagged COSE_Sign1 with the
+// encoded statement attached.
+func SignClosureStatement(signer cose.Signer, statement *ClosureStatement) ([]byte, error) {
+	payload, err := canonicalReceiptCBOR.Marshal(statement)
+	if err != nil {
+		return nil, fmt.Errorf("encode closure statement: %w", err)
+	}
+	msg := cose.NewSign1Message()
+	msg.Headers.Protected.SetAlgorithm(signer.Algorithm())
+	msg.Headers.Protected[cose.HeaderLabelContentType] = ClosureStatementContentType
+	msg.Payload = payload
+	if err = msg.Sign(rand.Reader, nil, signer); err != nil {
+		return nil, fmt.Errorf("sign closure statement: %w", err)
+	}
+	return msg.MarshalCBOR()
+}
+
+// VerifyClosureStatement verifies a signature over a closure statement and
+// returns the statement.
+func VerifyClosureStatement(data []byte, verifier cose.Verifier) (*ClosureStatement, error) {
+	if verifier == nil {
+		return nil, ErrVerifierRequired
+	}
+	var msg cose.Sign1Message
+	if err := msg.UnmarshalCBOR(data); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrClosureStatementInvalid, err)
+	}
+	if ct, _ := msg.Headers.Protected[cose.HeaderLabelContentType].(string); ct != ClosureStatementContentType {
+		return nil, fmt.Errorf("%w: content type %v", ErrClosureStatementInvalid, msg.Headers.Protected[cose.HeaderLabelContentType])
+	}
+	if err := msg.Verify(nil, verifier); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrClosureStatementInvalid, err)
+	}
+	var statement ClosureStatement
+	if err := cbor.Unmarshal(msg.Payload, &statement); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrClosureStatementInvalid, err)
+	}
+	// compared as uint64, int(MassifIndex)+1 wraps on 32 bit platforms
+	if uint64(len(statement.MassifSHA256)) != uint64(statement.MassifIndex)+1 {
+		return nil, fmt.Errorf("%w: %d massif digests for %d massifs",
+			ErrClosureStatementInvalid, len(statement.MassifSHA256), statement.MassifIndex+1)
+	}
+	return &statement, nil
+}
+
+// GetLogClosure returns the verified closure statement of a closed log. If
+// the log has not been closed the reader's NotFoundError is returned, and
+// storage.ErrUnsupportedCap if the reader is not a LogClosureReader.
+func GetLogClosure(ctx context.Context, reader ObjectReader, verifier cose.Verifier) (*ClosureStatement, error) {
+	closures, ok := reader.(LogClosureReader)
+	if !ok {
+		return nil, fmt.Errorf("%w: the reader can not read log closures", storage.ErrUnsupportedCap)
+	}
+	data, err := closures.LogClosure(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return VerifyClosureStatement(data, verifier)
+}
+
+// CheckMassif returns an error unless data is the massif the log was closed
+// with.
+func (s *ClosureStatement) CheckMassif(massifIndex uint32, data []byte) error {
+	if massifIndex > s.MassifIndex {
+		return fmt.Errorf("%w: massif %d is after the last massif %d", ErrClosureMassifMismatch, massifIndex, s.MassifIndex)
+	}
+	sum := sha256.Sum256(data)
+	if !bytes.Equal(sum[:], s.MassifSHA256[massifIndex]) {
+		return fmt.Errorf("%w: massif %d", ErrClosureMassifMismatch, massifIndex)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package massifs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+func TestCloseLog(t *testing.T) {
+	ctx := context.Background()
+	source, verifier := buildSealedLog(t, 3, 11)
+
+	dir := t.TempDir()
+	w, err := NewDirWriter(dir)
+	require.NoError(t, err)
+	for i := range uint32(len(source.massifs)) {
+		require.NoError(t, w.Put(ctx, i, storage.ObjectMassifData, source.massifs[i], true))
+		require.NoError(t, w.Put(ctx, i, storage.ObjectCheckpoint, source.checkpoint[i], true))
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := cose.NewSigner(cose.AlgorithmES256, key)
+	require.NoError(t, err)
+	operator := newES256Verifier(t, &key.PublicKey)
+
+	r, err := NewDirReader(dir)
+	require.NoError(t, err)
+	signed, statement, err := CloseLog(ctx, r, w, verifier, signer)
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), statement.MassifIndex)
+	require.Len(t, statement.MassifSHA256, 3)
+	head, err := GetMassifContext(ctx, r, 2)
+	require.NoError(t, err)
+	require.Equal(t, head.RangeCount(), statement.MMRSize)
+	peaks, err := mmr.PeakHashes(&head, statement.MMRSize-1)
+	require.NoError(t, err)
+	require.Equal(t, peaks, statement.Accumulator)
+
+	// a log can only be closed once
+	_, _, err = CloseLog(ctx, r, w, verifier, signer)
+	require.ErrorIs(t, err, storage.ErrExistsOC)
+
+	// delete the log, leaving only the closure statement
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		if filepath.Ext(entry.Name()) != "."+storage.V1MMRClosureExt {
+			require.NoError(t, os.Remove(filepath.Join(dir, entry.Name())))
+		}
+	}
+
+	closed, err := NewDirReader(dir)
+	require.NoError(t, err)
+	_, err = closed.HeadIndex(ctx, storage.ObjectMassifData)
+	require.ErrorIs(t, err, storage.ErrLogClosed)
+	require.True(t, storage.IsNotFound(err))
+	_, err = GetMassifContext(ctx, closed, 1)
+	require.ErrorIs(t, err, storage.ErrLogClosed)
+
+	got, err := GetLogClosure(ctx, closed, operator)
+	require.NoError(t, err)
+	require.Equal(t, statement, got)
+	_, err = GetLogClosure(ctx, closed, verifier)
+	require.ErrorIs(t, err, ErrClosureStatementInvalid)
+	_, err = VerifyClosureStatement(signed, operator)
+	require.NoError(t, err)
+
+	// the digest count check must not wrap, as int(MassifIndex)+1 does for
+	// the last massif index on 32 bit platforms
+	forged := *statement
+	forged.MassifIndex = math.MaxUint32
+	forged.MassifSHA256 = nil
+	forgedData, err := SignClosureStatement(signer, &forged)
+	require.NoError(t, err)
+	_, err = VerifyClosureStatement(forgedData, operator)
+	require.ErrorIs(t, err, ErrClosureStatementInvalid)
+
+	// retained copies of the massifs can be checked against the statement
+	require.NoError(t, got.CheckMassif(1, source.massifs[1]))
+	require.ErrorIs(t, got.CheckMassif(0, source.massifs[1]), ErrClosureMassifMismatch)
+	require.ErrorIs(t, got.CheckMassif(3, source.massifs[1]), ErrClosureMassifMismatch)
+
+	// a log which never existed is not reported as closed
+	missing, err := NewDirReader(t.TempDir())
+	require.NoError(t, err)
+	_, err = missing.HeadIndex(ctx, storage.ObjectMassifData)
+	require.ErrorIs(t, err, storage.ErrLogEmpty)
+	require.NotErrorIs(t, err, storage.ErrLogClosed)
+	_, err = GetLogClosure(ctx, missing, operator)
+	require.ErrorIs(t, err, storage.ErrDoesNotExist)
+}
+
+func TestNewClosureStatementRequiresSealedLog(t *testing.T) {
+	ctx := context.Background()
+	store, verifier := buildSealedLog(t, 3, 5)
+
+	// commit a leaf past the seal
+	mc, err := GetAppendContext(ctx, store, 1, 3)
+	require.NoError(t, err)
+	leaf := sha256.Sum256([]byte("unsealed"))
+	_, err = mc.AddHashedLeaf(sha256.New(), 6, nil, nil, nil, leaf[:])
+	require.NoError(t, err)
+	require.NoError(t, CommitContext(ctx, store, &mc))
+
+	_, err = NewClosureStatement(ctx, store, verifier, time.Now())
+	require.ErrorIs(t, err, ErrClosureUnsealed)
+}
@@ -0,0 +1,133 @@
+package massifs
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrCommitDeadline is returned by CommitBatches when it stops short of the
+// context deadline. The result says which batches were committed.
+var ErrCommitDeadline = errors.New("the commit stopped at the context deadline")
+
+// BatchLeaf is a leaf to append, its fields are the arguments of the same
+// name to AddHashedLeaf.
+type BatchLeaf struct {
+	IDTimestamp uint64
+	ExtraBytes0 []byte
+	LogID       []byte
+	AppID       []byte
+	Value       []byte
+	ExtraBytes  [][]byte
+}
+
+// LeafBatch is the unit of handoff from an ingestion queue.
+type LeafBatch struct {
+	Leaves []BatchLeaf
+}
+
+// BatchCommitResult describes how far CommitBatches got. Batches before
+// Committed are durable. The first PartialLeaves leaves of batch Committed
+// are also durable, that happens when a batch spans massifs. Everything after
+// is pending, it is not in the log and must be handed back for a retry.
+type BatchCommitResult struct {
+	Committed     int
+	PartialLeaves int
+	// MMRSize is the size of the log once the durable leaves were committed
+	MMRSize uint64
+}
+
+// Pending returns the leaves of the batches which were not committed, in
+// order. The part of a partially committed batch is its uncommitted tail.
+func (r BatchCommitResult) Pending(batches []LeafBatch) []LeafBatch {
+	if r.Committed >= len(batches) {
+		return nil
+	}
+	pending := append([]LeafBatch(nil), batches[r.Committed:]...)
+	pending[0].Leaves = pending[0].Leaves[r.PartialLeaves:]
+	return pending
+}
+
+// CommitBatches appends the batches, in order, to the log and commits them,
+// as CommitContext does, stopping early if the context deadline approaches.
+// Massifs are only written when one fills, mid batch if necessary, and once
+// at the end, so a slow store costs a write per massif, not per batch.
+//
+// Before each batch is started, the time remaining before the context
+// deadline is compared with the margin set by WithCommitDeadlineMargin. If it
+// is less, the batches appended so far are written and CommitBatches returns
+// ErrCommitDeadline with a result saying exactly what is durable, so the
+// ingestion queue can take back the rest without duplicating any leaf.
+//
+// Any other error leaves the result describing the last successful write. If
+// that error is from the store, the failed write may still have landed and
+// the log must be re-read to find which leaves are durable.
+func CommitBatches(
+	ctx context.Context, store ObjectReaderWriter, epoch uint32, massifHeight uint8,
+	batches []LeafBatch, opts ...Option,
+) (BatchCommitResult, error) {
+	options := CommitOptions{}
+	if err := ApplyOptions(&options, opts...); err != nil {
+		return BatchCommitResult{}, err
+	}
+	now := time.Now
+	if options.Clock != nil {
+		now = options.Clock.Wall
+	}
+	deadline, hasDeadline := ctx.Deadline()
+
+	var result BatchCommitResult
+	mc, err := GetAppendContext(ctx, store, epoch, massifHeight, opts...)
+	if err != nil {
+		return result, err
+	}
+	result.MMRSize = mc.RangeCount()
+
+	// the position after the last leaf appended
+	appendedBatch, appendedLeaf := 0, 0
+	commit := func() error {
+		if err := CommitContext(ctx, store, &mc, opts...); err != nil {
+			return err
+		}
+		result.Committed, result.PartialLeaves = appendedBatch, appendedLeaf
+		result.MMRSize = mc.RangeCount()
+		return nil
+	}
+
+	stopped := false
+	for b, batch := range batches {
+		if hasDeadline && deadline.Sub(now()) < options.DeadlineMargin {
+			stopped = true
+			break
+		}
+		for l, leaf := range batch.Leaves {
+			if mc.Count() >= TreeCount(mc.Start.MassifHeight) {
+				if err = commit(); err != nil {
+					return result, err
+				}
+				if err = InitAppendContext(ctx, store, &mc); err != nil {
+					return result, err
+				}
+			}
+			_, err = mc.AddHashedLeaf(
+				sha256.New(), leaf.IDTimestamp, leaf.ExtraBytes0, leaf.LogID, leaf.AppID, leaf.Value, leaf.ExtraBytes...)
+			if err != nil {
+				return result, fmt.Errorf("batch %d leaf %d: %w", b, l, err)
+			}
+			appendedBatch, appendedLeaf = b, l+1
+		}
+		appendedBatch, appendedLeaf = b+1, 0
+	}
+
+	if appendedBatch != result.Committed || appendedLeaf != result.PartialLeaves {
+		if err = commit(); err != nil {
+			return result, err
+		}
+	}
+	if stopped {
+		return result, ErrCommitDeadline
+	}
+	return result, nil
+}
@@ -0,0 +1,82 @@
+package massifs
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs/snowflakeid"
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/stretchr/testify/require"
+)
+
+// slowStore takes a minute, on the manual clock, for every write
+type slowStore struct {
+	*memStore
+	clock *snowflakeid.ManualClock
+}
+
+func (s *slowStore) Put(ctx context.Context, massifIndex uint32, ty storage.ObjectType, data []byte, failIfExists bool) error {
+	s.clock.Advance(time.Minute)
+	return s.memStore.Put(ctx, massifIndex, ty, data, failIfExists)
+}
+
+func TestCommitBatches_Deadline(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := snowflakeid.NewManualClock(start)
+	store := &slowStore{memStore: newMemStore(nil, nil), clock: clock}
+
+	var batches []LeafBatch
+	for b := range 5 {
+		var batch LeafBatch
+		for l := range 3 {
+			id := uint64(b*3 + l + 1)
+			value := sha256.Sum256(fmt.Appendf(nil, "leaf-%d", id))
+			batch.Leaves = append(batch.Leaves, BatchLeaf{IDTimestamp: id, Value: value[:]})
+		}
+		batches = append(batches, batch)
+	}
+
+	ctx, cancel := context.WithDeadline(context.Background(), start.Add(150*time.Second))
+	defer cancel()
+	opts := []Option{WithCommitClock(clock), WithCommitDeadlineMargin(time.Minute)}
+
+	// massifs of height 2 hold 2 leaves, so batch 0 and the first leaf of
+	// batch 1 are written as the first two massifs fill. Batch 2 would start
+	// inside the margin, so the rest of batch 1 is written and the commit
+	// stops.
+	result, err := CommitBatches(ctx, store, 1, 2, batches, opts...)
+	require.ErrorIs(t, err, ErrCommitDeadline)
+	require.Equal(t, 2, result.Committed)
+	require.Equal(t, 0, result.PartialLeaves)
+	require.Equal(t, uint64(6), mmr.LeafCount(result.MMRSize))
+
+	mc, err := GetMassifHeadContext(context.Background(), store)
+	require.NoError(t, err)
+	require.Equal(t, result.MMRSize, mc.RangeCount())
+
+	pending := result.Pending(batches)
+	require.Len(t, pending, 3)
+
+	// the pending batches are handed back, nothing is duplicated
+	result, err = CommitBatches(context.Background(), store, 1, 2, pending, opts...)
+	require.NoError(t, err)
+	require.Equal(t, 3, result.Committed)
+	require.Nil(t, result.Pending(pending))
+	require.Equal(t, uint64(15), mmr.LeafCount(result.MMRSize))
+}
+
+func TestBatchCommitResult_Pending(t *testing.T) {
+	batches := []LeafBatch{
+		{Leaves: make([]BatchLeaf, 2)},
+		{Leaves: make([]BatchLeaf, 3)},
+	}
+	pending := BatchCommitResult{Committed: 1, PartialLeaves: 2}.Pending(batches)
+	require.Len(t, pending, 1)
+	require.Len(t, pending[0].Leaves, 1)
+	// the callers batches are not changed
+	require.Len(t, batches[1].Leaves, 3)
+}
@@ -0,0 +1,131 @@
+package massifs
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/forestrie/go-merklelog/massifs/logformat"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/forestrie/go-merklelog/urkle"
+)
+
+// The committed length marker occupies start header reserved word 5. It is
+// the length of the massif data at the last commit, and it is written after
+// everything else, so a reader which sees the data of a commit in progress
+// can discard the part beyond the last complete commit.
+//
+//	| version | unused | committed length | unused  |
+//	| 0       | 1 - 7  | 8 - 15           | 16 - 31 |
+//	| 1       | 7      | 8                | 16      |
+const (
+	massifCommittedLengthWord = logformat.CommittedLengthWord
+
+	MassifCommittedLengthVersion = uint8(1)
+
+	massifCommittedLengthVersionByte = 0
+	massifCommittedLengthStart       = 8
+	massifCommittedLengthEnd         = 16
+)
+
+// CommittedLength returns the length of the massif data at its last commit.
+// ok is false if the marker has never been written, which is the case for
+// massifs committed before it was introduced, and for earlier versions.
+func (mc MassifContext) CommittedLength() (length uint64, ok bool, err error) {
+	if mc.Start.Version != MassifCurrentVersion {
+		return 0, false, nil
+	}
+	start, end, err := startHeaderWordRange(massifCommittedLengthWord)
+	if err != nil {
+		return 0, false, err
+	}
+	if end > uint64(len(mc.Data)) {
+		return 0, false, fmt.Errorf("start header out of range: end=%d len=%d", end, len(mc.Data))
+	}
+	raw := mc.Data[start:end]
+	if isAllZero(raw) {
+		return 0, false, nil
+	}
+	if raw[massifCommittedLengthVersionByte] != MassifCommittedLengthVersion {
+		return 0, false, fmt.Errorf("unsupported massif committed length version %d", raw[massifCommittedLengthVersionByte])
+	}
+	return binary.BigEndian.Uint64(raw[massifCommittedLengthStart:massifCommittedLengthEnd]), true, nil
+}
+
+// setCommittedLength writes the current data length through to the marker,
+// it is called by CommitContext.
+func (mc *MassifContext) setCommittedLength() error {
+	if err := mc.checkWritable("committed length"); err != nil {
+		return err
+	}
+	start, end, err := startHeaderWordRange(massifCommittedLengthWord)
+	if err != nil {
+		return err
+	}
+	if end > uint64(len(mc.Data)) {
+		return fmt.Errorf("start header out of range: end=%d len=%d", end, len(mc.Data))
+	}
+	raw := mc.Data[start:end]
+	clear(raw)
+	raw[massifCommittedLengthVersionByte] = MassifCommittedLengthVersion
+	binary.BigEndian.PutUint64(raw[massifCommittedLengthStart:massifCommittedLengthEnd], uint64(len(mc.Data)))
+	return nil
+}
+
+// truncateToCommitted limits the view of the data to the committed length.
+// Log nodes, or parts of them, past the marker belong to a commit which is
+// still in progress. Data shorter than the marker is left alone, the reader
+// has a stale copy, as is data whose marker is before the log, and the layout
+// checks decide whether it is usable. So is data which is complete past the
+// marker, the marker is then stale: an older writer, or a Put which did not go
+// through CommitContext, appended without updating it.
+func (mc *MassifContext) truncateToCommitted() error {
+	length, ok, err := mc.CommittedLength()
+	if err != nil || !ok {
+		return err
+	}
+	if length < mc.LogStart() || length >= uint64(len(mc.Data)) || mc.logMatchesIndex() {
+		return nil
+	}
+	mc.stored = mc.Data
+	mc.Data = mc.Data[:length]
+	return nil
+}
+
+// logMatchesIndex returns true if the log holds exactly the nodes of the
+// leaves the urkle index records, and the last of them is Start.LastID. A
+// commit writes the index before the log, so while one is in progress the
+// log is short of the index.
+func (mc MassifContext) logMatchesIndex() bool {
+	frontier, err := mc.UrkleFrontierRegion()
+	if err != nil {
+		return false
+	}
+	st, ok, err := urkle.DecodeFrontierV1(frontier)
+	if err != nil || !ok || uint64(st.NextLeaf) > mc.urkleLeafCountV2() {
+		return false
+	}
+	leafTable, err := mc.UrkleLeafTableRegion()
+	if err != nil || urkle.LeafKey(leafTable, st.NextLeaf-1) != mc.Start.LastID {
+		return false
+	}
+	size := mmr.MMRIndex(mmr.LeafCount(mc.Start.FirstIndex) + uint64(st.NextLeaf))
+	return uint64(len(mc.Data)) == mc.LogStart()+(size-mc.Start.FirstIndex)*ValueBytes
+}
+
+// extendToSealed restores the data truncateToCommitted cut, as far as the
+// node count of mmrSize, the size of the massif's checkpoint. Sealed nodes
+// were committed, so a marker before them is stale.
+func (mc *MassifContext) extendToSealed(mmrSize uint64) {
+	if mc.stored == nil || mmrSize <= mc.RangeCount() {
+		return
+	}
+	end := mc.LogStart() + (mmrSize-mc.Start.FirstIndex)*ValueBytes
+	mc.Data = mc.stored[:min(end, uint64(len(mc.stored)))]
+}
+
+// committedLengthRange returns the byte range of the marker, the append
+// writes it last.
+func committedLengthRange() (start, end uint64) {
+	start, end, _ = startHeaderWordRange(massifCommittedLengthWord)
+	return start, end
+}
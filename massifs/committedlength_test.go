@@ -0,0 +1,92 @@
+package massifs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommittedLength(t *testing.T) {
+	ctx := context.Background()
+	store, verifier := buildSealedLog(t, 3, 6)
+
+	mc, err := GetMassifContext(ctx, store, 1)
+	require.NoError(t, err)
+	length, ok, err := mc.CommittedLength()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint64(len(store.massifs[1])), length)
+
+	// a reader which sees part of a commit in progress has its view limited
+	// to the last complete commit
+	committed := store.massifs[1]
+	store.massifs[1] = append(append([]byte(nil), committed...), make([]byte, ValueBytes+7)...)
+	mc, err = GetMassifContext(ctx, store, 1)
+	require.NoError(t, err)
+	require.Equal(t, committed, mc.Data)
+	_, err = GetContextVerified(ctx, store, verifier, 1)
+	require.NoError(t, err)
+
+	// legacy massifs have no marker
+	legacy := buildLegacyBlobMassif0(t, 1, 3, 2)
+	_, ok, err = legacy.CommittedLength()
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestCommittedLengthStaleMarker(t *testing.T) {
+	ctx := context.Background()
+	store, verifier := buildSealedLog(t, 3, 6)
+	committed := append([]byte(nil), store.massifs[1]...)
+
+	// An older writer appended the second leaf of the massif without
+	// updating the marker, which still records the first.
+	mc, err := GetMassifContext(ctx, store, 1)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), mc.Count())
+	markerStart, _ := committedLengthRange()
+	binary.BigEndian.PutUint64(
+		store.massifs[1][markerStart+massifCommittedLengthStart:], mc.LogStart()+ValueBytes)
+
+	mc, err = GetMassifContext(ctx, store, 1)
+	require.NoError(t, err)
+	require.Equal(t, len(committed), len(mc.Data), "the data is consistent with the index past the marker")
+	vc, err := GetContextVerified(ctx, store, verifier, 1)
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), vc.RangeCount())
+
+	// With the index out of step too, only the seal shows the data past the
+	// marker was committed.
+	binary.BigEndian.PutUint64(store.massifs[1][MassifStartKeyLastIDFirstByte:], 0)
+	mc, err = GetMassifContext(ctx, store, 1)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), mc.Count())
+	vc, err = GetContextVerified(ctx, store, verifier, 1)
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), vc.RangeCount())
+}
+
+func TestAppendWritesCommittedLengthLast(t *testing.T) {
+	ctx := context.Background()
+	store, _ := buildSealedLog(t, 3, 5)
+	mc, err := GetAppendContext(ctx, store, 1, 3)
+	require.NoError(t, err)
+	mc.markCommitted()
+
+	leaf := sha256.Sum256([]byte("committed-length-last"))
+	_, err = mc.AddHashedLeaf(sha256.New(), 6, nil, nil, nil, leaf[:])
+	require.NoError(t, err)
+	require.NoError(t, mc.setCommittedLength())
+
+	base, writes, ok := mc.appendWrites()
+	require.True(t, ok)
+	require.GreaterOrEqual(t, len(writes), 2)
+	markerStart, markerEnd := committedLengthRange()
+	last := writes[len(writes)-1]
+	require.Equal(t, markerStart, last.Offset)
+	require.Len(t, last.Data, int(markerEnd-markerStart))
+	require.Equal(t, base.Size, writes[len(writes)-2].Offset)
+}
@@ -0,0 +1,228 @@
+package massifs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/bits"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+)
+
+// indexRegions are the regions of the current format which are preallocated
+// for the leaf capacity of the massif
+var indexRegions = []string{RegionBloomBitsets, RegionUrkleFrontier, RegionUrkleLeafTable, RegionUrkleNodeStore}
+
+// MassifFill is the fill of one massif, see CompactionReport
+type MassifFill struct {
+	MassifIndex  uint32
+	MassifHeight uint8
+	Version      uint16
+	Leaves       uint64
+	LeafCapacity uint64
+	// StoredBytes is the size of the massif data
+	StoredBytes uint64
+	// IndexBytes is the size of the index regions, which are preallocated
+	// for LeafCapacity leaves. Zero for massifs before the current format.
+	IndexBytes uint64
+	// WastedIndexBytes is the share of IndexBytes preallocated for the leaves
+	// the massif does not have
+	WastedIndexBytes uint64
+}
+
+// FillRatio returns the fraction of the leaf capacity used
+func (f MassifFill) FillRatio() float64 {
+	if f.LeafCapacity == 0 {
+		return 0
+	}
+	return float64(f.Leaves) / float64(f.LeafCapacity)
+}
+
+// HeightProjection is the storage the log would take in massifs of another
+// height, see CompactionReport
+type HeightProjection struct {
+	MassifHeight uint8
+	Massifs      uint64
+	// StoredBytes is the total size of the massif data
+	StoredBytes      uint64
+	IndexBytes       uint64
+	WastedIndexBytes uint64
+}
+
+// CompactionReport describes how efficiently a log's massifs use the storage
+// preallocated for them. The index regions of a massif are sized for a full
+// massif when it is created, so a log whose head massif is mostly empty, or
+// which was written with a massif height too large for its rate of growth,
+// pays for index space it does not use. The projections give the storage the
+// same leaves would take at other heights, in the current format, for
+// operators deciding whether a migration is worth it.
+type CompactionReport struct {
+	Massifs []MassifFill
+	// MMRSize is the size of the log
+	MMRSize          uint64
+	Leaves           uint64
+	StoredBytes      uint64
+	IndexBytes       uint64
+	WastedIndexBytes uint64
+	// Projections are in the order of the heights requested
+	Projections []HeightProjection
+}
+
+// NewCompactionReport reports the fill of every massif of the log, and the
+// storage projected for each of the heights. Only the start headers of the
+// complete massifs are read, the head massif is read in full.
+func NewCompactionReport(ctx context.Context, reader ObjectReader, heights ...uint8) (*CompactionReport, error) {
+	head, err := reader.HeadIndex(ctx, storage.ObjectMassifData)
+	if err != nil {
+		return nil, err
+	}
+	headContext, err := GetMassifContext(ctx, reader, head)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &CompactionReport{MMRSize: headContext.RangeCount()}
+	report.Leaves = mmr.LeafCount(report.MMRSize)
+
+	// each massif ends where the next starts, so the headers are enough
+	// for all but the head
+	starts := make([]MassifStart, 0, uint64(head)+1)
+	for i := range head {
+		header, err := reader.MassifReadN(ctx, i, StartHeaderEnd)
+		if err != nil {
+			return nil, err
+		}
+		if len(header) < StartHeaderEnd {
+			return nil, fmt.Errorf("%w: massif %d start header incomplete", ErrMassifDataLengthInvalid, i)
+		}
+		starts = append(starts, MakeMassifStart(header))
+	}
+	starts = append(starts, headContext.Start)
+
+	for i, start := range starts {
+		end, storedEnd := headContext.RangeCount(), uint64(len(headContext.Data))
+		if i+1 < len(starts) {
+			end = starts[i+1].FirstIndex
+		}
+		fill, err := massifFill(start, end)
+		if err != nil {
+			return nil, fmt.Errorf("massif %d: %w", i, err)
+		}
+		if i+1 == len(starts) {
+			fill.StoredBytes = storedEnd
+		}
+		report.Massifs = append(report.Massifs, fill)
+		report.StoredBytes += fill.StoredBytes
+		report.IndexBytes += fill.IndexBytes
+		report.WastedIndexBytes += fill.WastedIndexBytes
+	}
+
+	for _, height := range heights {
+		projection, err := projectHeight(height, report.MMRSize, report.Leaves)
+		if err != nil {
+			return nil, err
+		}
+		report.Projections = append(report.Projections, projection)
+	}
+	return report, nil
+}
+
+// massifFill returns the fill of the massif whose log ends before mmr index
+// end. StoredBytes is that of the massif data written up to end.
+func massifFill(start MassifStart, end uint64) (MassifFill, error) {
+	f, err := start.Format()
+	if err != nil {
+		return MassifFill{}, err
+	}
+	if end < start.FirstIndex {
+		return MassifFill{}, fmt.Errorf("%w: the massif ends at %d, before its first index %d",
+			ErrMassifDataLengthInvalid, end, start.FirstIndex)
+	}
+	log, _ := f.Region(RegionLog)
+	fill := MassifFill{
+		MassifIndex:  start.MassifIndex,
+		MassifHeight: start.MassifHeight,
+		Version:      start.Version,
+		Leaves:       mmr.LeafCount(end) - mmr.LeafCount(start.FirstIndex),
+		LeafCapacity: f.LeafCapacity,
+		StoredBytes:  log.Offset + (end-start.FirstIndex)*ValueBytes,
+		IndexBytes:   formatIndexBytes(f),
+	}
+	unused := fill.LeafCapacity - min(fill.Leaves, fill.LeafCapacity)
+	fill.WastedIndexBytes = wastedIndexBytes(fill.IndexBytes, fill.LeafCapacity, unused)
+	return fill, nil
+}
+
+// projectHeight returns the storage the leaves of a log of mmrSize would take
+// in current format massifs of the height. Every node of the log is stored
+// once, whatever the height, so the heights differ only in the fixed size of
+// each massif ahead of its log region, and in how many massifs there are.
+func projectHeight(height uint8, mmrSize uint64, leaves uint64) (HeightProjection, error) {
+	if err := CheckMassifHeightV2(height); err != nil {
+		return HeightProjection{}, err
+	}
+	f, err := MassifStart{Version: MassifCurrentVersion, MassifHeight: height}.Format()
+	if err != nil {
+		return HeightProjection{}, err
+	}
+	log, _ := f.Region(RegionLog)
+	projection := HeightProjection{
+		MassifHeight: height,
+		Massifs:      max(1, (leaves+f.LeafCapacity-1)/f.LeafCapacity),
+	}
+	projection.StoredBytes = projection.Massifs*log.Offset + mmrSize*ValueBytes
+	projection.IndexBytes = projection.Massifs * formatIndexBytes(f)
+	projection.WastedIndexBytes = wastedIndexBytes(
+		formatIndexBytes(f), f.LeafCapacity, projection.Massifs*f.LeafCapacity-leaves)
+	return projection, nil
+}
+
+// formatIndexBytes returns the size of the preallocated index regions
+func formatIndexBytes(f MassifFormat) uint64 {
+	var n uint64
+	for _, name := range indexRegions {
+		if r, ok := f.Region(name); ok {
+			n += r.Size
+		}
+	}
+	return n
+}
+
+// wastedIndexBytes returns the share of the index bytes, of a massif with
+// capacity leaves, for the leaves it does not have. The index regions are
+// accounted in proportion to the leaves, though the bloom bitsets are really
+// sized for the false positive rate of a full massif.
+func wastedIndexBytes(indexBytes uint64, capacity uint64, unused uint64) uint64 {
+	if capacity == 0 {
+		return 0
+	}
+	// the product may not fit 64 bits for the tallest massifs, the quotient
+	// always does as unused <= capacity
+	hi, lo := bits.Mul64(indexBytes, min(unused, capacity))
+	wasted, _ := bits.Div64(hi, lo, capacity)
+	return wasted
+}
+
+// Write writes the report to w as text, one line per massif followed by the
+// totals and one line per projection.
+func (r *CompactionReport) Write(w io.Writer) error {
+	for _, m := range r.Massifs {
+		if _, err := fmt.Fprintf(w, "massif %d height %d v%d: %d/%d leaves (%.1f%%), %d bytes, %d index bytes wasted\n",
+			m.MassifIndex, m.MassifHeight, m.Version, m.Leaves, m.LeafCapacity, 100*m.FillRatio(),
+			m.StoredBytes, m.WastedIndexBytes); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(w, "total: %d leaves, %d bytes, %d index bytes, %d wasted\n",
+		r.Leaves, r.StoredBytes, r.IndexBytes, r.WastedIndexBytes); err != nil {
+		return err
+	}
+	for _, p := range r.Projections {
+		if _, err := fmt.Fprintf(w, "height %d: %d massifs, %d bytes, %d index bytes, %d wasted\n",
+			p.MassifHeight, p.Massifs, p.StoredBytes, p.IndexBytes, p.WastedIndexBytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
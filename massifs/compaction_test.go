@@ -0,0 +1,56 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompactionReport(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore(nil, nil)
+	l, err := OpenLog(ctx, store, WithLogMassifHeight(3))
+	require.NoError(t, err)
+	var entries []LogEntry
+	for i := range 6 {
+		leaf := sha256.Sum256(fmt.Appendf(nil, "compaction-leaf-%d", i))
+		entries = append(entries, LogEntry{IDTimestamp: uint64(i+1) * 10, Value: leaf[:]})
+	}
+	mmrSize, err := l.Append(ctx, entries...)
+	require.NoError(t, err)
+
+	report, err := NewCompactionReport(ctx, store, 3, 4)
+	require.NoError(t, err)
+	require.Equal(t, mmrSize, report.MMRSize)
+	require.Equal(t, uint64(6), report.Leaves)
+	require.Len(t, report.Massifs, 2)
+
+	full, head := report.Massifs[0], report.Massifs[1]
+	require.Equal(t, 1.0, full.FillRatio())
+	require.Zero(t, full.WastedIndexBytes)
+	require.Equal(t, uint64(len(store.massifs[0])), full.StoredBytes)
+	require.Equal(t, 0.5, head.FillRatio())
+	require.Equal(t, head.IndexBytes/2, head.WastedIndexBytes)
+	require.Equal(t, uint64(len(store.massifs[1])), head.StoredBytes)
+	require.Equal(t, full.StoredBytes+head.StoredBytes, report.StoredBytes)
+	require.Equal(t, head.WastedIndexBytes, report.WastedIndexBytes)
+
+	// every node is stored once whatever the height, so the projection for
+	// the log's own height is what it takes now
+	same, taller := report.Projections[0], report.Projections[1]
+	require.Equal(t, uint64(2), same.Massifs)
+	require.Equal(t, report.StoredBytes, same.StoredBytes)
+	require.Equal(t, report.WastedIndexBytes, same.WastedIndexBytes)
+	require.Equal(t, uint64(1), taller.Massifs)
+
+	_, err = NewCompactionReport(ctx, store, MaxMassifHeightV2+1)
+	require.ErrorIs(t, err, ErrOffsetOverflow)
+
+	var out bytes.Buffer
+	require.NoError(t, report.Write(&out))
+	require.Contains(t, out.String(), "massif 1 height 3 v2: 2/4 leaves (50.0%)")
+}
@@ -0,0 +1,363 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/forestrie/go-merklelog/urkle"
+	"github.com/veraison/go-cose"
+)
+
+// provenanceDomain prefixes the pre-image of a provenance leaf value, so that
+// it can not collide with an application leaf value.
+const provenanceDomain = "forestrie/merklelog/provenance/v1"
+
+var (
+	ErrComposeTargetNotEmpty = errors.New("the composed log must be created in an empty store")
+	ErrComposeSourceEmpty    = errors.New("a composed source log has no sealed leaves")
+	ErrLinkageInvalid        = errors.New("the linkage proof is invalid")
+)
+
+// ComposeSource is one of the logs merged by ComposeLogs. The log is verified,
+// massif by massif, with Verifier before any of it is used.
+type ComposeSource struct {
+	LogID    storage.LogID
+	Reader   ObjectReader
+	Verifier cose.Verifier
+}
+
+// SourceProvenance is the final verified state of a source log. The composed
+// log commits it in a provenance leaf, see LeafValue.
+type SourceProvenance struct {
+	LogID storage.LogID
+	State MMRState
+}
+
+// LeafValue returns the provenance leaf value,
+//
+//	H(domain || len(logID) || logID || mmrSize || peak0 || ... || peakN)
+//
+// where the length is a single byte and the size is big endian.
+func (p SourceProvenance) LeafValue() []byte {
+	h := sha256.New()
+	h.Write([]byte(provenanceDomain))
+	h.Write([]byte{byte(len(p.LogID))})
+	h.Write(p.LogID)
+	var size [8]byte
+	binary.BigEndian.PutUint64(size[:], p.State.MMRSize)
+	h.Write(size[:])
+	for _, peak := range p.State.Peaks {
+		h.Write(peak)
+	}
+	return h.Sum(nil)
+}
+
+// ComposedEntry maps a source leaf to its copy in the composed log.
+type ComposedEntry struct {
+	// Source is 0 or 1, the position of the source in the ComposeLogs call
+	Source int
+	// SourceIndex is the mmr index of the leaf in the source log
+	SourceIndex uint64
+	// Index is the mmr index of the leaf in the composed log
+	Index uint64
+	// IDTimestamp is the key of the leaf in the composed log. It is the source
+	// idtimestamp unless that would not be strictly increasing, in which case
+	// it is the previous key + 1.
+	IDTimestamp uint64
+}
+
+// Composition describes a log created by ComposeLogs.
+type Composition struct {
+	Provenance [2]SourceProvenance
+	// ProvenanceIndices are the mmr indices of the provenance leaves, always
+	// the first two leaves of the composed log.
+	ProvenanceIndices [2]uint64
+	// Entries are ordered by composed index
+	Entries []ComposedEntry
+	// MMRSize is the size of the composed log
+	MMRSize uint64
+}
+
+type composeLeaf struct {
+	source      int
+	sourceIndex uint64
+	idTimestamp uint64
+	value       []byte
+}
+
+// ComposeLogs creates a new log, in the empty store dst, from two independent
+// source logs. Its first two leaves are the provenance leaves committing the
+// final verified accumulators of sources a and b. The sealed leaves of both
+// sources follow, merged in idtimestamp order, with ties taken from a first.
+//
+// Each copied leaf has the same value as its source leaf. Its urkle record
+// carries the source log id and the big endian source mmr index as extras.
+// The source log ids must be at most 32 bytes.
+//
+// The composed log is committed but not sealed, sealing is the caller's
+// responsibility. Use ProveLinkage to show a source leaf is in the composed
+// log.
+func ComposeLogs(
+	ctx context.Context, dst ObjectReaderWriter, epoch uint32, massifHeight uint8, a, b ComposeSource,
+) (*Composition, error) {
+	if _, err := GetMassifHeadContext(ctx, dst); !errors.Is(err, storage.ErrLogEmpty) {
+		if err == nil {
+			return nil, ErrComposeTargetNotEmpty
+		}
+		return nil, err
+	}
+
+	comp := &Composition{}
+	var leaves []composeLeaf
+	for i, source := range []ComposeSource{a, b} {
+		state, sourceLeaves, err := readComposeSource(ctx, source, i)
+		if err != nil {
+			return nil, fmt.Errorf("source %d: %w", i, err)
+		}
+		comp.Provenance[i] = SourceProvenance{LogID: source.LogID, State: state}
+		leaves = append(leaves, sourceLeaves...)
+	}
+	sort.SliceStable(leaves, func(i, j int) bool {
+		return leaves[i].idTimestamp < leaves[j].idTimestamp
+	})
+
+	mc, err := GetAppendContext(ctx, dst, epoch, massifHeight)
+	if err != nil {
+		return nil, err
+	}
+	var lastID uint64
+	add := func(id uint64, value []byte, extras ...[]byte) (uint64, uint64, error) {
+		if mc.Count() >= TreeCount(mc.Start.MassifHeight) {
+			if err := CommitContext(ctx, dst, &mc); err != nil {
+				return 0, 0, err
+			}
+			if err := InitAppendContext(ctx, dst, &mc); err != nil {
+				return 0, 0, err
+			}
+		}
+		if id <= lastID {
+			id = lastID + 1
+		}
+		index := mc.RangeCount()
+		if _, err := mc.AddHashedLeaf(sha256.New(), id, nil, nil, nil, value, extras...); err != nil {
+			return 0, 0, err
+		}
+		lastID = id
+		return index, id, nil
+	}
+
+	for i := range comp.Provenance {
+		if comp.ProvenanceIndices[i], _, err = add(lastID+1, comp.Provenance[i].LeafValue()); err != nil {
+			return nil, fmt.Errorf("provenance leaf %d: %w", i, err)
+		}
+	}
+	comp.Entries = make([]ComposedEntry, 0, len(leaves))
+	for _, leaf := range leaves {
+		var sourceIndex [8]byte
+		binary.BigEndian.PutUint64(sourceIndex[:], leaf.sourceIndex)
+		index, id, err := add(leaf.idTimestamp, leaf.value, comp.Provenance[leaf.source].LogID, sourceIndex[:])
+		if err != nil {
+			return nil, fmt.Errorf("source %d leaf %d: %w", leaf.source, leaf.sourceIndex, err)
+		}
+		comp.Entries = append(comp.Entries, ComposedEntry{
+			Source:      leaf.source,
+			SourceIndex: leaf.sourceIndex,
+			Index:       index,
+			IDTimestamp: id,
+		})
+	}
+	if err = CommitContext(ctx, dst, &mc); err != nil {
+		return nil, err
+	}
+	comp.MMRSize = mc.RangeCount()
+	return comp, nil
+}
+
+// readComposeSource verifies every massif of the source log, each consistent
+// with its predecessor, and returns the state sealed by the last checkpoint
+// and the leaves that state commits.
+func readComposeSource(ctx context.Context, source ComposeSource, sourceNo int) (MMRState, []composeLeaf, error) {
+	head, err := source.Reader.HeadIndex(ctx, storage.ObjectCheckpoint)
+	if err != nil {
+		return MMRState{}, nil, err
+	}
+
+	var leaves []composeLeaf
+	var vc *VerifiedContext
+	for i := uint32(0); i <= head; i++ {
+		var opts []Option
+		if vc != nil {
+			opts = append(opts, WithVerifyTrustedState(MMRState{
+				MMRSize: vc.Checkpoint.MMRSize,
+				Peaks:   vc.Accumulator,
+			}))
+		}
+		vc, err = GetContextVerified(ctx, source.Reader, source.Verifier, i, opts...)
+		if err != nil {
+			return MMRState{}, nil, fmt.Errorf("massif %d: %w", i, err)
+		}
+		if err = vc.requireV2Index(); err != nil {
+			return MMRState{}, nil, fmt.Errorf("massif %d: %w", i, err)
+		}
+		leafTable, err := vc.UrkleLeafTableRegion()
+		if err != nil {
+			return MMRState{}, nil, fmt.Errorf("massif %d: %w", i, err)
+		}
+		firstLeaf := mmr.LeafCount(vc.Start.FirstIndex)
+		for ord := range vc.MassifLeafCount() {
+			mmrIndex := mmr.MMRIndex(firstLeaf + ord)
+			value, err := vc.Get(mmrIndex)
+			if err != nil {
+				return MMRState{}, nil, fmt.Errorf("massif %d: %w", i, err)
+			}
+			leaves = append(leaves, composeLeaf{
+				source:      sourceNo,
+				sourceIndex: mmrIndex,
+				idTimestamp: urkle.LeafKey(leafTable, uint32(ord)),
+				value:       append([]byte(nil), value...),
+			})
+		}
+	}
+	if vc == nil || vc.Checkpoint.MMRSize == 0 {
+		return MMRState{}, nil, ErrComposeSourceEmpty
+	}
+
+	// leaves appended after the last seal are not committed by it
+	state := MMRState{MMRSize: vc.Checkpoint.MMRSize, Peaks: vc.Accumulator}
+	n := sort.Search(len(leaves), func(i int) bool { return leaves[i].sourceIndex >= state.MMRSize })
+	return state, leaves[:n], nil
+}
+
+// LinkageProof shows that a leaf of a source log is present, with the same
+// value, in a composed log, and that the source accumulator it is proven
+// against is the one committed by the composed log's provenance leaf.
+type LinkageProof struct {
+	Provenance      SourceProvenance
+	ProvenanceIndex uint64
+	// ProvenanceProof proves the provenance leaf in the composed log
+	ProvenanceProof [][]byte
+	SourceIndex     uint64
+	// SourceProof proves the leaf in the source accumulator
+	SourceProof [][]byte
+	Index       uint64
+	// Proof proves the leaf in the composed log
+	Proof [][]byte
+}
+
+// ProveLinkage returns the linkage proof for entry, which must be from comp.
+// The composed log proofs are against the accumulator for composedSize, which
+// is typically the size of a verified composed log checkpoint. source must
+// read the log identified by comp.Provenance[entry.Source].
+func ProveLinkage(
+	ctx context.Context, composed ObjectReader, source ObjectReader,
+	comp *Composition, entry ComposedEntry, composedSize uint64,
+) (*LinkageProof, error) {
+	if entry.Source != 0 && entry.Source != 1 {
+		return nil, fmt.Errorf("%w: source %d", ErrLinkageInvalid, entry.Source)
+	}
+	composedStore := newLogNodeStore(ctx, composed)
+	proof := &LinkageProof{
+		Provenance:      comp.Provenance[entry.Source],
+		ProvenanceIndex: comp.ProvenanceIndices[entry.Source],
+		SourceIndex:     entry.SourceIndex,
+		Index:           entry.Index,
+	}
+	var err error
+	if proof.ProvenanceProof, err = mmr.InclusionProof(composedStore, composedSize-1, proof.ProvenanceIndex); err != nil {
+		return nil, fmt.Errorf("provenance leaf: %w", err)
+	}
+	if proof.Proof, err = mmr.InclusionProof(composedStore, composedSize-1, proof.Index); err != nil {
+		return nil, fmt.Errorf("composed leaf: %w", err)
+	}
+	sourceStore := newLogNodeStore(ctx, source)
+	if proof.SourceProof, err = mmr.InclusionProof(
+		sourceStore, proof.Provenance.State.MMRSize-1, proof.SourceIndex); err != nil {
+		return nil, fmt.Errorf("source leaf: %w", err)
+	}
+	return proof, nil
+}
+
+// VerifyLinkage verifies that nodeHash is in the source log named by the
+// proof, as committed by the composed log's provenance leaf, and in the
+// composed log. composedPeaks is the trusted accumulator for composedSize.
+func VerifyLinkage(proof *LinkageProof, nodeHash []byte, composedSize uint64, composedPeaks [][]byte) error {
+	if err := verifyAccumulatorInclusion(
+		composedSize, composedPeaks, proof.ProvenanceIndex, proof.Provenance.LeafValue(), proof.ProvenanceProof,
+	); err != nil {
+		return fmt.Errorf("%w: provenance leaf: %v", ErrLinkageInvalid, err)
+	}
+	if err := verifyAccumulatorInclusion(
+		proof.Provenance.State.MMRSize, proof.Provenance.State.Peaks, proof.SourceIndex, nodeHash, proof.SourceProof,
+	); err != nil {
+		return fmt.Errorf("%w: source leaf: %v", ErrLinkageInvalid, err)
+	}
+	if err := verifyAccumulatorInclusion(
+		composedSize, composedPeaks, proof.Index, nodeHash, proof.Proof,
+	); err != nil {
+		return fmt.Errorf("%w: composed leaf: %v", ErrLinkageInvalid, err)
+	}
+	return nil
+}
+
+func verifyAccumulatorInclusion(mmrSize uint64, peaks [][]byte, mmrIndex uint64, nodeHash []byte, proof [][]byte) error {
+	if mmrSize == 0 || mmrIndex >= mmrSize || len(peaks) != len(mmr.Peaks(mmrSize-1)) {
+		return fmt.Errorf("%w: accumulator does not match the mmr size", mmr.ErrVerifyInclusionFailed)
+	}
+	ipeak := mmr.PeakIndex(mmr.LeafCount(mmrSize), len(proof))
+	if ipeak >= len(peaks) {
+		return fmt.Errorf(
+			"%w: accumulator index for proof out of range for the mmr size", mmr.ErrVerifyInclusionFailed)
+	}
+	root := mmr.IncludedRoot(sha256.New(), mmrIndex, nodeHash, proof)
+	if !bytes.Equal(root, peaks[ipeak]) {
+		return fmt.Errorf("%w: proven root not present in the accumulator", mmr.ErrVerifyInclusionFailed)
+	}
+	return nil
+}
+
+// logNodeStore reads node values from any massif of a log, so that proofs can
+// span massifs. Massif contexts are read on first use.
+type logNodeStore struct {
+	ctx     context.Context
+	reader  ObjectReader
+	height  uint8
+	massifs map[uint32]*MassifContext
+}
+
+func newLogNodeStore(ctx context.Context, reader ObjectReader) *logNodeStore {
+	return &logNodeStore{ctx: ctx, reader: reader, massifs: map[uint32]*MassifContext{}}
+}
+
+func (s *logNodeStore) Get(i uint64) ([]byte, error) {
+	if s.height == 0 {
+		mc, err := s.massif(0)
+		if err != nil {
+			return nil, err
+		}
+		s.height = mc.Start.MassifHeight
+	}
+	mc, err := s.massif(uint32(MassifIndexFromMMRIndex(s.height, i)))
+	if err != nil {
+		return nil, err
+	}
+	return mc.Get(i)
+}
+
+func (s *logNodeStore) massif(massifIndex uint32) (*MassifContext, error) {
+	if mc, ok := s.massifs[massifIndex]; ok {
+		return mc, nil
+	}
+	mc, err := GetMassifContext(s.ctx, s.reader, massifIndex)
+	if err != nil {
+		return nil, err
+	}
+	s.massifs[massifIndex] = &mc
+	return &mc, nil
+}
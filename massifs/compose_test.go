@@ -0,0 +1,68 @@
+package massifs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComposeLogs(t *testing.T) {
+	ctx := context.Background()
+
+	storeA, verifierA := buildSealedLog(t, 2, 5)
+	storeB, verifierB := buildSealedLog(t, 2, 3)
+	a := ComposeSource{LogID: storage.LogID("tenant-a-log-id!"), Reader: storeA, Verifier: verifierA}
+	b := ComposeSource{LogID: storage.LogID("tenant-b-log-id!"), Reader: storeB, Verifier: verifierB}
+
+	dst := newMemStore(nil, nil)
+	comp, err := ComposeLogs(ctx, dst, 1, 2, a, b)
+	require.NoError(t, err)
+	require.Len(t, comp.Entries, 8)
+	require.Equal(t, [2]uint64{0, 1}, comp.ProvenanceIndices)
+	// 2 provenance leaves + 5 + 3 source leaves
+	require.Equal(t, uint64(18), comp.MMRSize)
+
+	// both sources use idtimestamps 1..n, a wins the ties and b is bumped
+	require.Equal(t, 0, comp.Entries[0].Source)
+	require.Equal(t, 1, comp.Entries[1].Source)
+	for i := 1; i < len(comp.Entries); i++ {
+		require.Greater(t, comp.Entries[i].IDTimestamp, comp.Entries[i-1].IDTimestamp)
+		require.Greater(t, comp.Entries[i].Index, comp.Entries[i-1].Index)
+	}
+
+	// a second composition into the same store is refused
+	_, err = ComposeLogs(ctx, dst, 1, 2, a, b)
+	require.ErrorIs(t, err, ErrComposeTargetNotEmpty)
+
+	composedPeaks, err := mmr.PeakHashes(newLogNodeStore(ctx, dst), comp.MMRSize-1)
+	require.NoError(t, err)
+
+	sources := []*memStore{storeA, storeB}
+	for _, entry := range comp.Entries {
+		source := sources[entry.Source]
+		value, err := newLogNodeStore(ctx, source).Get(entry.SourceIndex)
+		require.NoError(t, err)
+
+		proof, err := ProveLinkage(ctx, dst, source, comp, entry, comp.MMRSize)
+		require.NoError(t, err)
+		require.NoError(t, VerifyLinkage(proof, value, comp.MMRSize, composedPeaks))
+	}
+
+	// a proof against the other source's provenance fails
+	entry := comp.Entries[0]
+	value, err := newLogNodeStore(ctx, storeA).Get(entry.SourceIndex)
+	require.NoError(t, err)
+	proof, err := ProveLinkage(ctx, dst, storeA, comp, entry, comp.MMRSize)
+	require.NoError(t, err)
+	proof.Provenance = comp.Provenance[1]
+	require.ErrorIs(t, VerifyLinkage(proof, value, comp.MMRSize, composedPeaks), ErrLinkageInvalid)
+
+	// as does a value that is not the source leaf
+	proof, err = ProveLinkage(ctx, dst, storeA, comp, entry, comp.MMRSize)
+	require.NoError(t, err)
+	value[0] ^= 1
+	require.ErrorIs(t, VerifyLinkage(proof, value, comp.MMRSize, composedPeaks), ErrLinkageInvalid)
+}
@@ -1,8 +1,6 @@
 package massifs
 
 import (
-	"bytes"
-	"crypto/sha256"
 	"fmt"
 
 	"github.com/forestrie/go-merklelog/mmr"
@@ -24,44 +22,45 @@ func BuildConsistencyProof(store ConsistencyNodeStore, fromSize, toSize uint64)
 	if toSize <= fromSize {
 		return ConsistencyProof{}, fmt.Errorf("toSize %d must be greater than fromSize %d", toSize, fromSize)
 	}
-	peaksTo, err := mmr.PeakHashes(store, toSize-1)
-	if err != nil {
-		return ConsistencyProof{}, fmt.Errorf("peaks of target size %d: %w", toSize, err)
-	}
-
-	proof := ConsistencyProof{
-		TreeSize1: fromSize,
-		TreeSize2: toSize,
-		Paths:     [][][]byte{},
-	}
 
 	if fromSize == 0 {
-		proof.RightPeaks = peaksTo
-		return proof, nil
+		peaksTo, err := mmr.PeakHashes(store, toSize-1)
+		if err != nil {
+			return ConsistencyProof{}, fmt.Errorf("peaks of target size %d: %w", toSize, err)
+		}
+		return ConsistencyProof{TreeSize2: toSize, Paths: [][][]byte{}, RightPeaks: peaksTo}, nil
 	}
 
-	cp, err := mmr.IndexConsistencyProof(store, fromSize-1, toSize-1)
+	cp, err := mmr.ProveConsistency(store, fromSize, toSize)
 	if err != nil {
 		return ConsistencyProof{}, fmt.Errorf("consistency proof %d -> %d: %w", fromSize, toSize, err)
 	}
-	peaksFrom, err := mmr.PeakHashes(store, fromSize-1)
-	if err != nil {
-		return ConsistencyProof{}, fmt.Errorf("peaks of origin size %d: %w", fromSize, err)
-	}
+	return NewConsistencyProof(cp), nil
+}
 
-	// The proven roots are a prefix of the target accumulator; whatever the
-	// paths do not reach is carried explicitly as right-peaks.
-	roots, err := mmr.ConsistentRoots(sha256.New(), fromSize-1, peaksFrom, cp.Path)
-	if err != nil {
-		return ConsistencyProof{}, fmt.Errorf("consistent roots %d -> %d: %w", fromSize, toSize, err)
+// NewConsistencyProof returns the format-v3 form of a proof from
+// mmr.ProveConsistency, for EncodeConsistencyProof.
+func NewConsistencyProof(cp mmr.ConsistencyProof) ConsistencyProof {
+	proof := ConsistencyProof{
+		TreeSize1:  cp.MMRSizeA,
+		TreeSize2:  cp.MMRSizeB,
+		Paths:      cp.Path,
+		RightPeaks: cp.RightPeaks,
 	}
-	for i := range roots {
-		if !bytes.Equal(roots[i], peaksTo[i]) {
-			return ConsistencyProof{}, fmt.Errorf("proven root %d does not match target accumulator", i)
-		}
+	if proof.Paths == nil {
+		proof.Paths = [][][]byte{}
 	}
+	return proof
+}
 
-	proof.Paths = cp.Path
-	proof.RightPeaks = peaksTo[len(roots):]
-	return proof, nil
+// MMRProof returns the proof in the form mmr.VerifyConsistencyProof checks,
+// which needs only the accumulator of MMR(TreeSize1). A proof with no
+// TreeSize1 has nothing to verify.
+func (p ConsistencyProof) MMRProof() mmr.ConsistencyProof {
+	return mmr.ConsistencyProof{
+		MMRSizeA:   p.TreeSize1,
+		MMRSizeB:   p.TreeSize2,
+		Path:       p.Paths,
+		RightPeaks: p.RightPeaks,
+	}
 }
@@ -23,7 +23,7 @@ func (m *memNodes) Append(value []byte) (uint64, error) {
 	return uint64(len(m.nodes)), nil
 }
 
-func newFixtureMMR(t *testing.T, nLeaves int) (*memNodes, []uint64) {
+func newFixtureMMR(t testing.TB, nLeaves int) (*memNodes, []uint64) {
 	t.Helper()
 	store := &memNodes{}
 	sizes := make([]uint64, 0, nLeaves)
@@ -65,6 +65,28 @@ func TestBuildConsistencyProofReachesTargetAccumulator(t *testing.T) {
 	require.Equal(t, peaksB, reconstructAccumulator(t, store, proof))
 }
 
+func TestConsistencyProofVerifiesFromEncoding(t *testing.T) {
+	store, sizes := newFixtureMMR(t, 8)
+	sizeA, sizeB := sizes[2], sizes[7]
+
+	proof, err := BuildConsistencyProof(store, sizeA, sizeB)
+	require.NoError(t, err)
+	encoded, err := EncodeConsistencyProof(proof)
+	require.NoError(t, err)
+
+	// the auditor has only the encoded proof and the MMR(A) accumulator
+	decoded, err := DecodeConsistencyProof(encoded)
+	require.NoError(t, err)
+	peaksA, err := mmr.PeakHashes(store, sizeA-1)
+	require.NoError(t, err)
+	accumulator, err := mmr.VerifyConsistencyProof(sha256.New(), decoded.MMRProof(), peaksA)
+	require.NoError(t, err)
+
+	peaksB, err := mmr.PeakHashes(store, sizeB-1)
+	require.NoError(t, err)
+	require.Equal(t, peaksB, accumulator)
+}
+
 func TestBuildConsistencyProofFirstCheckpointIsRightPeaksOnly(t *testing.T) {
 	store, sizes := newFixtureMMR(t, 2)
 
@@ -0,0 +1,159 @@
+package massifs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	commoncose "github.com/forestrie/go-merklelog/massifs/cose"
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/veraison/go-cose"
+)
+
+// The conventions of the DataTrails production deployment. Everything here
+// is a default for the generic primitives, HTTPReader, DataTrailsPathScheme
+// and GetContextVerified, any of which can be used directly instead.
+const (
+	// DataTrailsHost is the host serving the public logs
+	DataTrailsHost = "app.datatrails.ai"
+	// DataTrailsPathPrefix is the path, under the host, at which the objects
+	// are published, named as storage.DataTrailsPathScheme names them.
+	DataTrailsPathPrefix = "verifiabledata"
+	// DataTrailsMassifHeight is the massif height of the production logs
+	DataTrailsMassifHeight uint8 = 14
+	// DataTrailsKeyPath is the path, relative to the published objects, of
+	// the COSE_Key the checkpoints are signed with.
+	DataTrailsKeyPath = "v2/merklelog/keys/checkpoint.cbor"
+	// DataTrailsIssuer is the issuer claimed by the production sealer
+	DataTrailsIssuer = SealIssuerPrefix + "datatrails"
+)
+
+var ErrDataTrailsKey = errors.New("the published checkpoint key could not be used")
+
+// DataTrailsLog is a public DataTrails log opened by OpenDataTrailsLog.
+type DataTrailsLog struct {
+	LogID  storage.LogID
+	Reader *HTTPReader
+	// Verifier verifies the checkpoint signatures
+	Verifier cose.Verifier
+	// Issuer is the issuer the checkpoints must claim, it is DataTrailsIssuer
+	// unless changed. Empty disables the check.
+	Issuer string
+}
+
+// OpenDataTrailsLog returns the public log logID served by host, or by
+// DataTrailsHost if host is empty. host may instead be a base URL, with a
+// scheme, for deployments which serve the objects elsewhere.
+//
+// Unless WithCOSEVerifier is provided the checkpoint key is fetched from
+// DataTrailsKeyPath. Fetching the key over TLS from the operator's host makes
+// the operator the root of trust, auditors with an independently obtained
+// key should provide it. WithHTTPClient and WithPathScheme are also honoured,
+// the default path scheme is storage.DataTrailsPathScheme with
+// DataTrailsMassifHeight.
+func OpenDataTrailsLog(ctx context.Context, host string, logID storage.LogID, opts ...Option) (*DataTrailsLog, error) {
+	options := StorageOptions{}
+	if err := ApplyOptions(&options, opts...); err != nil {
+		return nil, err
+	}
+	if host == "" {
+		host = DataTrailsHost
+	}
+	baseURL := host
+	if !strings.Contains(host, "://") {
+		baseURL = "https://" + host + "/" + DataTrailsPathPrefix
+	}
+	if options.PathScheme == nil {
+		opts = append(opts, WithPathScheme(storage.DataTrailsPathScheme{}, logID, DataTrailsMassifHeight))
+	}
+	reader, err := NewHTTPReader(baseURL, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	verifier := options.COSEVerifier
+	if verifier == nil {
+		var err error
+		if verifier, err = fetchDataTrailsVerifier(ctx, reader); err != nil {
+			return nil, err
+		}
+	}
+	return &DataTrailsLog{LogID: logID, Reader: reader, Verifier: verifier, Issuer: DataTrailsIssuer}, nil
+}
+
+// VerifiedHead verifies the head massif of the log against its checkpoint,
+// and that the checkpoint names the log, and the expected issuer. The
+// options are passed to GetContextVerified, a trusted state from an earlier
+// call, WithVerifyTrustedState, additionally proves the log has only grown
+// since.
+func (l *DataTrailsLog) VerifiedHead(ctx context.Context, opts ...Option) (*VerifiedContext, error) {
+	head, err := l.Reader.HeadIndex(ctx, storage.ObjectCheckpoint)
+	if err != nil {
+		return nil, err
+	}
+	opts = append([]Option{WithVerifySealSubject(l.LogID)}, opts...)
+	vc, err := GetContextVerified(ctx, l.Reader, l.Verifier, head, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if l.Issuer == "" {
+		return vc, nil
+	}
+	claims, err := ReadSealClaims(vc.Checkpoint.Receipt.ProtectedHeader)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSealSubjectMismatch, err)
+	}
+	if claims.Issuer != l.Issuer {
+		return nil, fmt.Errorf("%w: issued by %q, not %q", ErrSealSubjectMismatch, claims.Issuer, l.Issuer)
+	}
+	return vc, nil
+}
+
+// fetchDataTrailsVerifier reads the published COSE_Key and returns an ES256
+// verifier for it.
+func fetchDataTrailsVerifier(ctx context.Context, reader *HTTPReader) (cose.Verifier, error) {
+	target := strings.TrimSuffix(reader.BaseURL, "/") + "/" + DataTrailsKeyPath
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := reader.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDataTrailsKey, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDataTrailsKey, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s: %s", ErrDataTrailsKey, target, resp.Status)
+	}
+
+	var coseKey map[int64]any
+	if err = cbor.Unmarshal(data, &coseKey); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDataTrailsKey, err)
+	}
+	key, err := commoncose.NewECCoseKey(coseKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDataTrailsKey, err)
+	}
+	publicKey, err := key.PublicKey()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDataTrailsKey, err)
+	}
+	ecKey, ok := publicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: not an ecdsa key", ErrDataTrailsKey)
+	}
+	verifier, err := cose.NewVerifier(cose.AlgorithmES256, ecKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDataTrailsKey, err)
+	}
+	return verifier, nil
+}
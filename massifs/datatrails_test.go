@@ -0,0 +1,141 @@
+package massifs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+// publishDataTrailsLog writes a log, sealed with the production claims, and
+// its checkpoint key, to dir as they are served.
+func publishDataTrailsLog(t *testing.T, dir string, logID storage.LogID, issuer string, leafCount int) {
+	t.Helper()
+	ctx := context.Background()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := cose.NewSigner(cose.AlgorithmES256, key)
+	require.NoError(t, err)
+	claims := SealClaims{Issuer: issuer}
+	base, err := NewSealClaims("datatrails", logID, 1)
+	require.NoError(t, err)
+	claims.Subject = base.Subject
+
+	store := newMemStore(nil, nil)
+	var sealedSize uint64
+	var mc MassifContext
+	seal := func() {
+		proof, err := BuildConsistencyProof(&mc, sealedSize, mc.RangeCount())
+		require.NoError(t, err)
+		accumulator, err := mmr.PeakHashes(&mc, mc.RangeCount()-1)
+		require.NoError(t, err)
+		store.checkpoint[mc.Start.MassifIndex], err = SignCheckpointReceipt(signer, proof, accumulator, WithSealClaims(claims))
+		require.NoError(t, err)
+		sealedSize = mc.RangeCount()
+	}
+	for i := range leafCount {
+		mc, err = GetAppendContext(ctx, store, 1, 3)
+		require.NoError(t, err)
+		leaf := sha256.Sum256(fmt.Appendf(nil, "datatrails-leaf-%d", i))
+		_, err = mc.AddHashedLeaf(sha256.New(), uint64(i+1), nil, nil, nil, leaf[:])
+		require.NoError(t, err)
+		require.NoError(t, CommitContext(ctx, store, &mc))
+		if mc.Count() >= TreeCount(3) {
+			seal()
+		}
+	}
+	if mc.RangeCount() != sealedSize {
+		seal()
+	}
+
+	writer, err := NewDirWriter(dir, WithPathScheme(storage.DataTrailsPathScheme{}, logID, 3))
+	require.NoError(t, err)
+	for i, data := range store.massifs {
+		require.NoError(t, writer.Put(ctx, i, storage.ObjectMassifData, data, true))
+	}
+	for i, data := range store.checkpoint {
+		require.NoError(t, writer.Put(ctx, i, storage.ObjectCheckpoint, data, true))
+	}
+
+	coseKey, err := cbor.Marshal(map[int64]any{
+		1: 2, 3: int64(cose.AlgorithmES256), -1: 1,
+		-2: key.X.FillBytes(make([]byte, 32)), -3: key.Y.FillBytes(make([]byte, 32)),
+	})
+	require.NoError(t, err)
+	keyPath := filepath.Join(dir, filepath.FromSlash(DataTrailsKeyPath))
+	require.NoError(t, os.MkdirAll(filepath.Dir(keyPath), 0o755))
+	require.NoError(t, os.WriteFile(keyPath, coseKey, 0o644))
+}
+
+func TestOpenDataTrailsLog(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	id := uuid.New()
+	logID := storage.LogID(id[:])
+	publishDataTrailsLog(t, dir, logID, DataTrailsIssuer, 13)
+	server := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer server.Close()
+
+	heightOpt := WithPathScheme(storage.DataTrailsPathScheme{}, logID, 3)
+	log, err := OpenDataTrailsLog(ctx, server.URL, logID, heightOpt)
+	require.NoError(t, err)
+	head, err := log.Reader.HeadIndex(ctx, storage.ObjectMassifData)
+	require.NoError(t, err)
+	require.Equal(t, uint32(3), head)
+
+	vc, err := log.VerifiedHead(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint32(3), vc.Start.MassifIndex)
+	require.Equal(t, mmr.FirstMMRSize(mmr.MMRIndex(12)), vc.Checkpoint.MMRSize)
+
+	// the seal must name this log
+	other := uuid.New()
+	log.LogID = storage.LogID(other[:])
+	_, err = log.VerifiedHead(ctx)
+	require.ErrorIs(t, err, ErrSealSubjectMismatch)
+
+	// an unknown log is not found
+	missing, err := OpenDataTrailsLog(ctx, server.URL, storage.LogID(other[:]),
+		WithPathScheme(storage.DataTrailsPathScheme{}, storage.LogID(other[:]), 3))
+	require.NoError(t, err)
+	_, err = missing.Reader.HeadIndex(ctx, storage.ObjectMassifData)
+	require.ErrorIs(t, err, storage.ErrLogEmpty)
+}
+
+func TestOpenDataTrailsLogIssuer(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	id := uuid.New()
+	logID := storage.LogID(id[:])
+	publishDataTrailsLog(t, dir, logID, SealIssuerPrefix+"impostor", 3)
+	server := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer server.Close()
+
+	log, err := OpenDataTrailsLog(ctx, server.URL, logID, WithPathScheme(storage.DataTrailsPathScheme{}, logID, 3))
+	require.NoError(t, err)
+	_, err = log.VerifiedHead(ctx)
+	require.ErrorIs(t, err, ErrSealSubjectMismatch)
+
+	log.Issuer = SealIssuerPrefix + "impostor"
+	_, err = log.VerifiedHead(ctx)
+	require.NoError(t, err)
+
+	// without the published key the log can not be opened
+	require.NoError(t, os.Remove(filepath.Join(dir, filepath.FromSlash(DataTrailsKeyPath))))
+	_, err = OpenDataTrailsLog(ctx, server.URL, logID)
+	require.ErrorIs(t, err, ErrDataTrailsKey)
+}
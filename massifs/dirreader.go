@@ -0,0 +1,411 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+)
+
+// errMemoryMapUnsupported is returned where files can not be memory mapped
+var errMemoryMapUnsupported = errors.New("memory mapped files are not supported on this platform")
+
+// DirReader is a read-only ObjectReader over a single local directory holding
+// the massif (.log), checkpoint (.sth), V0 seal (.sth0), timestamp index
+// (.tsidx) and bridge (.bridge) objects of one log, and its closure statement
+// (.closure) once it has been closed, named as they are in storage (see
+// storage.FmtMassifPath).
+// No log identity is required:
+// auditors are frequently given exactly such a directory, with the tenant or
+// log uuid that the storage path would have carried stripped away.
+//
+// Objects are read lazily and cached for the life of the reader. With
+// WithMemoryMap the massifs are memory mapped, and Close releases them. With
+// WithFS the directory is read from an fs.FS rather than the local file
+// system.
+type DirReader struct {
+	Dir string
+
+	// fsys is set if the reader was configured with WithFS
+	fsys      fs.FS
+	memoryMap bool
+	// mapped are the memory mapped massifs, a massif which is read again
+	// after its file has grown is mapped again, the earlier mapping remains
+	// until Close.
+	mapped [][]byte
+
+	// logID is set if the reader was configured with a path scheme
+	logID storage.LogID
+
+	massifPaths         map[uint32]string
+	checkpointPaths     map[uint32]string
+	timestampIndexPaths map[uint32]string
+	legacySealPaths     map[uint32]string
+	bridgePaths         map[uint32]string
+	// closurePath is set if the log has been closed
+	closurePath string
+
+	massifs     map[uint32][]byte
+	checkpoints map[uint32][]byte
+}
+
+// NewDirReader lists dir and indexes the massif and checkpoint objects found.
+// Files whose names are not recognizable log objects are ignored.
+//
+// By default the objects are expected directly in dir. WithPathScheme selects
+// a layout of many logs under dir, and the log to read from it.
+func NewDirReader(dir string, opts ...Option) (*DirReader, error) {
+	options := StorageOptions{}
+	if err := ApplyOptions(&options, opts...); err != nil {
+		return nil, err
+	}
+	r := &DirReader{
+		Dir:                 dir,
+		fsys:                options.FS,
+		memoryMap:           options.MemoryMap,
+		logID:               options.LogID,
+		massifPaths:         map[uint32]string{},
+		checkpointPaths:     map[uint32]string{},
+		timestampIndexPaths: map[uint32]string{},
+		legacySealPaths:     map[uint32]string{},
+		bridgePaths:         map[uint32]string{},
+		massifs:             map[uint32][]byte{},
+		checkpoints:         map[uint32][]byte{},
+	}
+	if options.PathScheme == nil {
+		return r, r.index(dir, false)
+	}
+	for _, otype := range []storage.ObjectType{storage.ObjectPathMassifs, storage.ObjectPathCheckpoints} {
+		prefix, err := options.PathScheme.ObjectPrefix(options.LogID, options.MassifHeight, otype)
+		if err != nil {
+			return nil, err
+		}
+		// a log with no objects yet has no directories either
+		if err = r.index(r.join(dir, prefix), true); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// index adds the log objects found in dir
+func (r *DirReader) index(dir string, missingOk bool) error {
+	var entries []fs.DirEntry
+	var err error
+	if r.fsys != nil {
+		entries, err = fs.ReadDir(r.fsys, dir)
+	} else {
+		entries, err = os.ReadDir(dir)
+	}
+	if missingOk && errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		otype, massifIndex, err := storage.ObjectIndexFromPath(entry.Name())
+		if err != nil {
+			continue
+		}
+		switch otype {
+		case storage.ObjectMassifData:
+			r.massifPaths[massifIndex] = r.join(dir, entry.Name())
+		case storage.ObjectCheckpoint:
+			r.checkpointPaths[massifIndex] = r.join(dir, entry.Name())
+		case storage.ObjectLogClosure:
+			r.closurePath = r.join(dir, entry.Name())
+		case storage.ObjectTimestampIndex:
+			r.timestampIndexPaths[massifIndex] = r.join(dir, entry.Name())
+		case storage.ObjectLegacyCheckpoint:
+			r.legacySealPaths[massifIndex] = r.join(dir, entry.Name())
+		case storage.ObjectMassifBridge:
+			r.bridgePaths[massifIndex] = r.join(dir, entry.Name())
+		}
+	}
+	return nil
+}
+
+// join joins the slash separated name to dir, as a path of the local file
+// system or of fsys.
+func (r *DirReader) join(dir string, name string) string {
+	if r.fsys != nil {
+		return path.Join(dir, name)
+	}
+	return filepath.Join(dir, filepath.FromSlash(name))
+}
+
+// readFile reads the file from the local file system or from fsys
+func (r *DirReader) readFile(name string) ([]byte, error) {
+	if r.fsys != nil {
+		return fs.ReadFile(r.fsys, name)
+	}
+	return os.ReadFile(name)
+}
+
+func (r *DirReader) HeadIndex(ctx context.Context, otype storage.ObjectType) (uint32, error) {
+	var paths map[uint32]string
+	switch otype {
+	case storage.ObjectMassifData, storage.ObjectMassifStart:
+		paths = r.massifPaths
+	case storage.ObjectCheckpoint:
+		paths = r.checkpointPaths
+	default:
+		return 0, fmt.Errorf("%w: object type %v", storage.ErrUnsupportedCap, otype)
+	}
+	if len(paths) == 0 {
+		if r.closurePath != "" {
+			return 0, storage.NewLogClosedError(r.logID, otype, storage.HeadMassifIndex)
+		}
+		if otype == storage.ObjectCheckpoint {
+			return 0, storage.NewNotFoundError(r.logID, otype, storage.HeadMassifIndex)
+		}
+		return 0, storage.NewLogEmptyError(r.logID)
+	}
+	var head uint32
+	for massifIndex := range paths {
+		head = max(head, massifIndex)
+	}
+	return head, nil
+}
+
+// List lists the objects indexed when the reader was created
+func (r *DirReader) List(ctx context.Context, otype storage.ObjectType, fromIndex uint32, limit int) (ObjectPage, error) {
+	otype, err := listObjectType(otype)
+	if err != nil {
+		return ObjectPage{}, err
+	}
+	paths := r.massifPaths
+	if otype == storage.ObjectCheckpoint {
+		paths = r.checkpointPaths
+	}
+	return pageIndices(sortedIndices(paths), otype, fromIndex, limit), nil
+}
+
+// MassifData returns the cached massif data, or nil if it exists but has not
+// been read yet.
+func (r *DirReader) MassifData(massifIndex uint32) ([]byte, bool, error) {
+	if _, ok := r.massifPaths[massifIndex]; !ok {
+		return nil, false, r.notFound(storage.ObjectMassifData, massifIndex)
+	}
+	data, ok := r.massifs[massifIndex]
+	return data, ok, nil
+}
+
+// CheckpointData returns the cached checkpoint data, or nil if it exists but
+// has not been read yet.
+func (r *DirReader) CheckpointData(massifIndex uint32) ([]byte, bool, error) {
+	if _, ok := r.checkpointPaths[massifIndex]; !ok {
+		return nil, false, r.notFound(storage.ObjectCheckpoint, massifIndex)
+	}
+	data, ok := r.checkpoints[massifIndex]
+	return data, ok, nil
+}
+
+func (r *DirReader) MassifReadN(ctx context.Context, massifIndex uint32, n int) ([]byte, error) {
+	path, ok := r.massifPaths[massifIndex]
+	if !ok {
+		return nil, r.notFound(storage.ObjectMassifData, massifIndex)
+	}
+	data, err := r.readMassif(path)
+	if err != nil {
+		return nil, err
+	}
+	r.massifs[massifIndex] = data
+	if n >= 0 && n < len(data) {
+		return data[:n], nil
+	}
+	return data, nil
+}
+
+func (r *DirReader) CheckpointRead(ctx context.Context, massifIndex uint32) ([]byte, error) {
+	path, ok := r.checkpointPaths[massifIndex]
+	if !ok {
+		return nil, r.notFound(storage.ObjectCheckpoint, massifIndex)
+	}
+	data, err := r.readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r.checkpoints[massifIndex] = data
+	return data, nil
+}
+
+// MassifWindow opens the massif file for reading only the pages used, see
+// MassifWindowReader. Files which can not be read at an offset, possible only
+// for readers created WithFS, are read in full. The window does not use, or
+// fill, the reader's cache.
+func (r *DirReader) MassifWindow(ctx context.Context, massifIndex uint32) (*MassifWindow, error) {
+	path, ok := r.massifPaths[massifIndex]
+	if !ok {
+		return nil, r.notFound(storage.ObjectMassifData, massifIndex)
+	}
+	var f fs.File
+	var err error
+	if r.fsys != nil {
+		f, err = r.fsys.Open(path)
+	} else {
+		f, err = os.Open(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return nil, errors.Join(err, f.Close())
+	}
+	readerAt, ok := f.(io.ReaderAt)
+	if !ok {
+		data, err := io.ReadAll(f)
+		if err = errors.Join(err, f.Close()); err != nil {
+			return nil, err
+		}
+		return NewMassifWindow(bytes.NewReader(data), uint64(len(data)))
+	}
+	// the file is closed by the window
+	return NewMassifWindow(struct {
+		io.ReaderAt
+		io.Closer
+	}{readerAt, f}, uint64(info.Size()))
+}
+
+// readMassif reads the file, or maps it if the reader was created with
+// WithMemoryMap. Empty files, and platforms which can not map files, are read.
+func (r *DirReader) readMassif(path string) ([]byte, error) {
+	if !r.memoryMap || r.fsys != nil {
+		return r.readFile(path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size, err := ReadLen(uint64(info.Size()))
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 {
+		return []byte{}, nil
+	}
+	data, err := mapFile(f, size)
+	if errors.Is(err, errMemoryMapUnsupported) {
+		return os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("memory map %s: %w", path, err)
+	}
+	r.mapped = append(r.mapped, data)
+	return data, nil
+}
+
+// Close releases the memory mapped massifs. The massif data returned by the
+// reader, and the contexts created from it, must not be used after Close.
+// It does nothing for readers which do not memory map.
+func (r *DirReader) Close() error {
+	var errs []error
+	for _, data := range r.mapped {
+		errs = append(errs, unmapFile(data))
+	}
+	r.mapped = nil
+	clear(r.massifs)
+	return errors.Join(errs...)
+}
+
+// LogClosure reads the closure statement of a closed log, see
+// LogClosureReader.
+func (r *DirReader) LogClosure(ctx context.Context) ([]byte, error) {
+	if r.closurePath == "" {
+		return nil, storage.NewNotFoundError(r.logID, storage.ObjectLogClosure, storage.HeadMassifIndex)
+	}
+	return r.readFile(r.closurePath)
+}
+
+// TimestampIndexRead reads the timestamp index of the massif, see
+// TimestampIndexReader.
+func (r *DirReader) TimestampIndexRead(ctx context.Context, massifIndex uint32) ([]byte, error) {
+	path, ok := r.timestampIndexPaths[massifIndex]
+	if !ok {
+		return nil, r.notFound(storage.ObjectTimestampIndex, massifIndex)
+	}
+	return r.readFile(path)
+}
+
+// LegacySealRead reads the V0 seal of the massif, see LegacySealReader.
+func (r *DirReader) LegacySealRead(ctx context.Context, massifIndex uint32) ([]byte, error) {
+	path, ok := r.legacySealPaths[massifIndex]
+	if !ok {
+		return nil, r.notFound(storage.ObjectLegacyCheckpoint, massifIndex)
+	}
+	return r.readFile(path)
+}
+
+// MassifBridgeRead reads the bridge of the massif, see MassifBridgeReader.
+func (r *DirReader) MassifBridgeRead(ctx context.Context, massifIndex uint32) ([]byte, error) {
+	path, ok := r.bridgePaths[massifIndex]
+	if !ok {
+		return nil, r.notFound(storage.ObjectMassifBridge, massifIndex)
+	}
+	return r.readFile(path)
+}
+
+// notFound reports a missing object, distinguishing the objects of a closed
+// log from those which never existed.
+func (r *DirReader) notFound(otype storage.ObjectType, massifIndex uint32) error {
+	if r.closurePath != "" {
+		return storage.NewLogClosedError(r.logID, otype, massifIndex)
+	}
+	return storage.NewNotFoundError(r.logID, otype, massifIndex)
+}
+
+// LogID returns the log id the reader was configured with, see
+// WithPathScheme. Otherwise it returns a stable placeholder identity for the
+// anonymous log in the directory. It is derived from the issuer and subject of the head checkpoint
+// (see AnonymousLogID). If the seals carry no identity claims it falls back
+// to the first leaf of massif zero, which is immutable for the life of the
+// log.
+func (r *DirReader) LogID(ctx context.Context) (storage.LogID, error) {
+	if r.logID != nil {
+		return r.logID, nil
+	}
+	head, err := r.HeadIndex(ctx, storage.ObjectCheckpoint)
+	if err == nil {
+		var check Checkpoint
+		check, err = GetCheckpoint(ctx, r, head)
+		if err != nil {
+			return nil, err
+		}
+		var logID storage.LogID
+		logID, err = AnonymousLogID(&check.Receipt)
+		if err == nil {
+			return logID, nil
+		}
+	}
+	if !errors.Is(err, ErrNoSealIdentity) && !storage.IsNotFound(err) {
+		return nil, err
+	}
+
+	mc, err := GetMassifContext(ctx, r, 0)
+	if err != nil {
+		return nil, err
+	}
+	first, err := mc.Get(0)
+	if err != nil {
+		return nil, err
+	}
+	return anonymousLogID("", hex.EncodeToString(first)), nil
+}
@@ -0,0 +1,104 @@
+package massifs
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	commoncose "github.com/forestrie/go-merklelog/massifs/cose"
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirReader_VerifiesAnonymousDirectory(t *testing.T) {
+	mc := buildLegacyBlobMassif0(t, 1 /*blobVersion*/, 3 /*massifHeight*/, 2 /*leaves*/)
+	signed, verifier := signCheckpointV3(t, &mc)
+
+	// A bare directory: no tenant or log uuid anywhere in the path.
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, storage.FmtMassifPath("", 0)), mc.Data, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, storage.FmtCheckpointPath("", 0)), signed, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README"), []byte("ignored"), 0o644))
+
+	reader, err := NewDirReader(dir)
+	require.NoError(t, err)
+
+	vc, err := GetContextVerified(context.Background(), reader, verifier, 0)
+	require.NoError(t, err)
+	require.Equal(t, mc.RangeCount(), vc.Checkpoint.MMRSize)
+
+	// The seal carries no cwt claims, so the identity falls back to the
+	// first leaf, and is stable across readers.
+	logID, err := reader.LogID(context.Background())
+	require.NoError(t, err)
+	require.Len(t, logID, 16)
+
+	other, err := NewDirReader(dir)
+	require.NoError(t, err)
+	again, err := other.LogID(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, logID, again)
+}
+
+func TestAnonymousLogID(t *testing.T) {
+	header := func(claims map[int64]string) []byte {
+		h := map[int64]any{checkpointLabelAlg: int64(-7), checkpointLabelVDS: CheckpointVDSConsistency}
+		if claims != nil {
+			h[commoncose.HeaderLabelCWTClaims] = claims
+		}
+		b, err := canonicalReceiptCBOR.Marshal(h)
+		require.NoError(t, err)
+		return b
+	}
+
+	a, err := AnonymousLogID(&CheckpointReceipt{ProtectedHeader: header(map[int64]string{1: "iss", 2: "sub"})})
+	require.NoError(t, err)
+	b, err := AnonymousLogID(&CheckpointReceipt{ProtectedHeader: header(map[int64]string{1: "iss", 2: "sub"})})
+	require.NoError(t, err)
+	require.Equal(t, a, b)
+
+	c, err := AnonymousLogID(&CheckpointReceipt{ProtectedHeader: header(map[int64]string{1: "iss", 2: "other"})})
+	require.NoError(t, err)
+	require.NotEqual(t, a, c)
+
+	_, err = AnonymousLogID(&CheckpointReceipt{ProtectedHeader: header(nil)})
+	require.True(t, errors.Is(err, ErrNoSealIdentity))
+}
+
+func TestDirReader_MemoryMap(t *testing.T) {
+	ctx := context.Background()
+	source, verifier := buildSealedLog(t, 3, 6)
+	dir := t.TempDir()
+	for i, data := range source.massifs {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, storage.FmtMassifPath("", i)), data, 0o644))
+	}
+	for i, data := range source.checkpoint {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, storage.FmtCheckpointPath("", i)), data, 0o644))
+	}
+
+	reader, err := NewDirReader(dir, WithMemoryMap())
+	require.NoError(t, err)
+	vc, err := GetContextVerified(ctx, reader, verifier, 1)
+	require.NoError(t, err)
+	require.Equal(t, source.massifs[1], vc.Data)
+
+	// the mapping is private, appending to the context leaves the file as it
+	// was
+	mc, err := GetAppendContext(ctx, reader, 1, 3)
+	require.NoError(t, err)
+	value := sha256.Sum256([]byte("memory-mapped"))
+	_, err = mc.AddHashedLeaf(sha256.New(), 7, nil, nil, nil, value[:])
+	require.NoError(t, err)
+	stored, err := os.ReadFile(filepath.Join(dir, storage.FmtMassifPath("", 1)))
+	require.NoError(t, err)
+	require.Equal(t, source.massifs[1], stored)
+
+	require.NoError(t, reader.Close())
+	data, ok, err := reader.MassifData(1)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Nil(t, data)
+}
@@ -0,0 +1,259 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+)
+
+// Durability selects how hard DirWriter works to ensure a stored object
+// survives a crash or power loss.
+type Durability int
+
+const (
+	// DurabilityNone leaves flushing to the operating system. After a power
+	// loss an object may be missing or empty, even though Put returned.
+	DurabilityNone Durability = iota
+	// DurabilityFsync syncs each object file before it is renamed into place,
+	// and the directory after. Once Put returns the object is durable, and
+	// objects become durable in the order they are Put.
+	DurabilityFsync
+	// DurabilitySync is DurabilityFsync, but additionally opens the object
+	// file with O_SYNC so each write is durable before it returns.
+	DurabilitySync
+)
+
+// DirWriter is an ObjectWriter for a local directory replica, laid out as
+// DirReader expects. Objects are replaced atomically (write a temporary file
+// then rename it over the target) so readers never see a partial object.
+//
+// DirWriter implements ObjectLocker using a FileLock per massif, so
+// independent replicator processes (typically cron scheduled) can safely
+// target the same directory.
+type DirWriter struct {
+	Dir string
+	// Durability defaults to DurabilityNone. A replica which is relied on as
+	// verified should use DurabilityFsync, otherwise a checkpoint can survive a
+	// power loss that the massif data it verifies does not.
+	Durability Durability
+	// PathScheme, if set, names the objects of the log LogID under Dir. By
+	// default they are put directly in Dir.
+	PathScheme   storage.PathScheme
+	LogID        storage.LogID
+	MassifHeight uint8
+}
+
+// NewDirWriter creates the directory if necessary. The options honoured are
+// WithDurability and WithPathScheme.
+func NewDirWriter(dir string, opts ...Option) (*DirWriter, error) {
+	options := StorageOptions{}
+	if err := ApplyOptions(&options, opts...); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &DirWriter{
+		Dir:          dir,
+		Durability:   options.Durability,
+		PathScheme:   options.PathScheme,
+		LogID:        options.LogID,
+		MassifHeight: options.MassifHeight,
+	}, nil
+}
+
+// Lock acquires the advisory lock for massifIndex, waiting until it is
+// available or ctx is done.
+func (w *DirWriter) Lock(ctx context.Context, massifIndex uint32) (func() error, error) {
+	massifPath, err := w.objectPath(massifIndex, storage.ObjectMassifData)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(massifPath)
+	if err = os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%016d.lock", massifIndex))
+	lock, err := AcquireFileLock(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return lock.Release, nil
+}
+
+func (w *DirWriter) Put(
+	ctx context.Context, massifIndex uint32, ty storage.ObjectType, data []byte, failIfExists bool,
+) error {
+	path, err := w.objectPath(massifIndex, ty)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	if dir != filepath.Clean(w.Dir) {
+		if err = os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+
+	tmp, err := w.writeTemp(dir, filepath.Base(path), data)
+	if err != nil {
+		return err
+	}
+	if failIfExists {
+		// Linking the temporary file to the object fails if the object
+		// exists, so the check and the write are one step
+		err = os.Link(tmp, path)
+		_ = os.Remove(tmp)
+		if errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("%w: %s", storage.ErrExistsOC, path)
+		}
+	} else if err = os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+	}
+	if err != nil {
+		return err
+	}
+	if w.Durability != DurabilityNone {
+		// The rename is only durable once the directory entry is
+		return syncDir(dir)
+	}
+	return nil
+}
+
+// AppendMassif implements ObjectAppender. The writes are made in place, so
+// unlike Put a reader may see a partially updated massif, and a crash part
+// way through can leave the file inconsistent. Use Put based commits for a
+// replica where that matters.
+//
+// The massif lock, see Lock, is held across the check of the base and the
+// writes, so concurrent appenders can not both pass the check. The caller
+// must not already hold it.
+func (w *DirWriter) AppendMassif(
+	ctx context.Context, massifIndex uint32, base MassifBase, writes []ManifestRange,
+) (err error) {
+	path, err := w.objectPath(massifIndex, storage.ObjectMassifData)
+	if err != nil {
+		return err
+	}
+	unlock, err := w.Lock(ctx, massifIndex)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if uerr := unlock(); err == nil {
+			err = uerr
+		}
+	}()
+
+	flag := os.O_RDWR
+	if w.Durability == DurabilitySync {
+		flag |= os.O_SYNC
+	}
+	f, err := os.OpenFile(path, flag, 0)
+	if err != nil {
+		return err
+	}
+	err = appendFile(f, base, writes)
+	if err == nil && w.Durability != DurabilityNone {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// appendFile checks the file is the base of the append then makes the writes
+func appendFile(f *os.File, base MassifBase, writes []ManifestRange) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if uint64(info.Size()) != base.Size {
+		return fmt.Errorf("%w: size %d, expected %d", ErrAppendBaseMismatch, info.Size(), base.Size)
+	}
+	if len(base.Tail) > 0 {
+		tail := make([]byte, len(base.Tail))
+		if _, err = f.ReadAt(tail, int64(base.Size)-int64(len(tail))); err != nil {
+			return err
+		}
+		if !bytes.Equal(tail, base.Tail) {
+			return fmt.Errorf("%w: last log node differs", ErrAppendBaseMismatch)
+		}
+	}
+	for _, write := range writes {
+		if _, err = f.WriteAt(write.Data, int64(write.Offset)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeTemp writes data to a new temporary file alongside the object and
+// returns its name. The file is synced according to w.Durability.
+func (w *DirWriter) writeTemp(dir, base string, data []byte) (string, error) {
+	f, err := os.CreateTemp(dir, base+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	tmp := f.Name()
+	if w.Durability == DurabilitySync {
+		// CreateTemp does not take flags, so re-open the (empty) file
+		_ = f.Close()
+		f, err = os.OpenFile(tmp, os.O_WRONLY|os.O_SYNC, 0)
+		if err != nil {
+			_ = os.Remove(tmp)
+			return "", err
+		}
+	}
+	_, err = f.Write(data)
+	if err == nil && w.Durability != DurabilityNone {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return "", err
+	}
+	return tmp, nil
+}
+
+// syncDir makes the directory entries of dir, and so any renames into it,
+// durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (w *DirWriter) objectPath(massifIndex uint32, ty storage.ObjectType) (string, error) {
+	switch ty {
+	case storage.ObjectMassifData, storage.ObjectCheckpoint, storage.ObjectMassifSpine, storage.ObjectLogClosure,
+		storage.ObjectTimestampIndex, storage.ObjectLegacyCheckpoint, storage.ObjectMassifBridge:
+	default:
+		return "", fmt.Errorf("%w: object type %v", storage.ErrUnsupportedCap, ty)
+	}
+	scheme := w.PathScheme
+	if scheme == nil {
+		scheme = storage.FlatPathScheme{}
+	}
+	path, err := storage.SchemeObjectPath(scheme, w.LogID, w.MassifHeight, massifIndex, ty)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(w.Dir, filepath.FromSlash(path)), nil
+}
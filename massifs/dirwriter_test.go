@@ -0,0 +1,305 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirWriter_ReplaceVerifiedContext(t *testing.T) {
+	ctx := context.Background()
+	mc := buildLegacyBlobMassif0(t, 1 /*blobVersion*/, 3 /*massifHeight*/, 2 /*leaves*/)
+	signed, verifier := signCheckpointV3(t, &mc)
+	source := newMemStore(mc.Data, signed)
+
+	vc, err := GetContextVerified(ctx, source, verifier, 0)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	w, err := NewDirWriter(dir)
+	require.NoError(t, err)
+	require.NoError(t, ReplaceVerifiedContext(ctx, w, vc))
+
+	// The lock is released and no temporary files are left behind.
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	r, err := NewDirReader(dir)
+	require.NoError(t, err)
+	_, err = GetContextVerified(ctx, r, verifier, 0)
+	require.NoError(t, err)
+
+	err = w.Put(ctx, 0, storage.ObjectCheckpoint, signed, true)
+	require.True(t, errors.Is(err, storage.ErrExistsOC))
+}
+
+func TestDirWriter_LockExcludesOtherWriters(t *testing.T) {
+	w, err := NewDirWriter(t.TempDir())
+	require.NoError(t, err)
+
+	unlock, err := w.Lock(context.Background(), 0)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*lockRetryInterval)
+	defer cancel()
+	_, err = w.Lock(ctx, 0)
+	require.True(t, errors.Is(err, ErrLocked))
+
+	// Other massifs are not affected.
+	unlock1, err := w.Lock(context.Background(), 1)
+	require.NoError(t, err)
+	require.NoError(t, unlock1())
+
+	require.NoError(t, unlock())
+	unlock, err = w.Lock(context.Background(), 0)
+	require.NoError(t, err)
+	require.NoError(t, unlock())
+}
+
+func TestAcquireFileLock_LeftoverFileIsNotHeld(t *testing.T) {
+	// a writer which dies holding the lock leaves the file, but not the lock
+	path := filepath.Join(t.TempDir(), "leftover.lock")
+	require.NoError(t, os.WriteFile(path, []byte("12345\n"), 0o644))
+
+	lock, err := AcquireFileLock(context.Background(), path)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*lockRetryInterval)
+	defer cancel()
+	_, err = AcquireFileLock(ctx, path)
+	require.ErrorIs(t, err, ErrLocked)
+
+	require.NoError(t, lock.Release())
+	lock, err = AcquireFileLock(context.Background(), path)
+	require.NoError(t, err)
+	require.NoError(t, lock.Release())
+}
+
+func TestAcquireFileLock_Contended(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "contended.lock")
+	var held atomic.Int32
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				lock, err := AcquireFileLock(context.Background(), path)
+				if !assert.NoError(t, err) {
+					return
+				}
+				assert.Equal(t, int32(1), held.Add(1))
+				held.Add(-1)
+				assert.NoError(t, lock.Release())
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestDirWriter_PutFailIfExistsIsExclusive(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	w, err := NewDirWriter(dir)
+	require.NoError(t, err)
+
+	const writers = 8
+	errs := make(chan error, writers)
+	for i := range writers {
+		go func() {
+			errs <- w.Put(ctx, 0, storage.ObjectCheckpoint, []byte{byte(i)}, true)
+		}()
+	}
+	created := 0
+	for range writers {
+		err := <-errs
+		if err == nil {
+			created++
+			continue
+		}
+		require.ErrorIs(t, err, storage.ErrExistsOC)
+	}
+	require.Equal(t, 1, created)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+func TestDirWriter_Durability(t *testing.T) {
+	ctx := context.Background()
+	for _, durability := range []Durability{DurabilityNone, DurabilityFsync, DurabilitySync} {
+		dir := t.TempDir()
+		w, err := NewDirWriter(dir, WithDurability(durability))
+		require.NoError(t, err)
+		require.Equal(t, durability, w.Durability)
+
+		data := []byte("massif data")
+		require.NoError(t, w.Put(ctx, 1, storage.ObjectMassifData, data, false))
+		require.NoError(t, w.Put(ctx, 1, storage.ObjectMassifData, data[:6], false))
+
+		got, err := os.ReadFile(filepath.Join(dir, storage.FmtMassifPath("", 1)))
+		require.NoError(t, err)
+		require.Equal(t, data[:6], got)
+
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+	}
+}
+
+func TestDirWriter_PathScheme(t *testing.T) {
+	ctx := context.Background()
+	mc := buildLegacyBlobMassif0(t, 1 /*blobVersion*/, 3 /*massifHeight*/, 2 /*leaves*/)
+	signed, verifier := signCheckpointV3(t, &mc)
+	source := newMemStore(mc.Data, signed)
+
+	vc, err := GetContextVerified(ctx, source, verifier, 0)
+	require.NoError(t, err)
+
+	logID := storage.LogID{15: 1}
+	for _, scheme := range []storage.PathScheme{
+		storage.DataTrailsPathScheme{}, storage.HashShardedPathScheme{}, storage.EpochPathScheme{Epoch: 1},
+	} {
+		dir := t.TempDir()
+		w, err := NewDirWriter(dir, WithPathScheme(scheme, logID, 3))
+		require.NoError(t, err)
+		require.NoError(t, ReplaceVerifiedContext(ctx, w, vc))
+
+		path, err := storage.SchemeObjectPath(scheme, logID, 3, 0, storage.ObjectCheckpoint)
+		require.NoError(t, err)
+		_, err = os.Stat(filepath.Join(dir, filepath.FromSlash(path)))
+		require.NoError(t, err)
+
+		r, err := NewDirReader(dir, WithPathScheme(scheme, logID, 3))
+		require.NoError(t, err)
+		_, err = GetContextVerified(ctx, r, verifier, 0)
+		require.NoError(t, err)
+		got, err := r.LogID(ctx)
+		require.NoError(t, err)
+		require.Equal(t, logID, got)
+
+		// another log in the same tree is empty
+		r, err = NewDirReader(dir, WithPathScheme(scheme, storage.LogID{15: 2}, 3))
+		require.NoError(t, err)
+		_, err = r.HeadIndex(ctx, storage.ObjectMassifData)
+		require.ErrorIs(t, err, storage.ErrLogEmpty)
+	}
+}
+
+// countingAppender records the bytes each commit writes
+type countingAppender struct {
+	*DirWriter
+	puts     int
+	appended int
+}
+
+func (a *countingAppender) Put(
+	ctx context.Context, massifIndex uint32, ty storage.ObjectType, data []byte, failIfExists bool,
+) error {
+	a.puts++
+	return a.DirWriter.Put(ctx, massifIndex, ty, data, failIfExists)
+}
+
+func (a *countingAppender) AppendMassif(
+	ctx context.Context, massifIndex uint32, base MassifBase, writes []ManifestRange,
+) error {
+	for _, write := range writes {
+		a.appended += len(write.Data)
+	}
+	return a.DirWriter.AppendMassif(ctx, massifIndex, base, writes)
+}
+
+func TestDirWriter_AppendMassif(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	w, err := NewDirWriter(dir, WithDurability(DurabilityFsync))
+	require.NoError(t, err)
+	writer := &countingAppender{DirWriter: w}
+	path := filepath.Join(dir, storage.FmtMassifPath("", 0))
+
+	mc, err := CreateFirstMassifContext(ctx, 1, 4)
+	require.NoError(t, err)
+	for i := range 4 {
+		value := sha256.Sum256(fmt.Appendf(nil, "append-leaf-%d", i))
+		_, err = mc.AddHashedLeaf(sha256.New(), uint64(i+1), nil, nil, nil, value[:])
+		require.NoError(t, err)
+		writer.appended = 0
+		require.NoError(t, CommitContext(ctx, writer, &mc))
+
+		got, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, mc.Data, got)
+		if i > 0 {
+			// only the new nodes and the changed header and index words
+			require.Positive(t, writer.appended)
+			require.Less(t, writer.appended, len(mc.Data)/2)
+		}
+	}
+	require.Equal(t, 1, writer.puts)
+
+	// an unexpected change to the stored massif is detected
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.Write(make([]byte, ValueBytes))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	value := sha256.Sum256([]byte("append-leaf-4"))
+	_, err = mc.AddHashedLeaf(sha256.New(), 5, nil, nil, nil, value[:])
+	require.NoError(t, err)
+	require.ErrorIs(t, CommitContext(ctx, writer, &mc), ErrAppendBaseMismatch)
+
+	// and the next commit replaces it
+	require.NoError(t, CommitContext(ctx, writer, &mc))
+	require.Equal(t, 2, writer.puts)
+	got, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, mc.Data, got)
+}
+
+func TestDirWriter_AppendMassifExcludesConcurrentAppenders(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	w, err := NewDirWriter(dir)
+	require.NoError(t, err)
+	data := make([]byte, 2*ValueBytes)
+	require.NoError(t, w.Put(ctx, 0, storage.ObjectMassifData, data, false))
+
+	// every appender extends the same base, only one can apply
+	base := MassifBase{Size: uint64(len(data)), Tail: data[len(data)-ValueBytes:]}
+	const appenders = 8
+	errs := make(chan error, appenders)
+	for i := range appenders {
+		go func() {
+			value := bytes.Repeat([]byte{byte(i + 1)}, ValueBytes)
+			errs <- w.AppendMassif(ctx, 0, base, []ManifestRange{{Offset: base.Size, Data: value}})
+		}()
+	}
+	applied := 0
+	for range appenders {
+		err := <-errs
+		if err == nil {
+			applied++
+			continue
+		}
+		require.ErrorIs(t, err, ErrAppendBaseMismatch)
+	}
+	require.Equal(t, 1, applied)
+
+	got, err := os.ReadFile(filepath.Join(dir, storage.FmtMassifPath("", 0)))
+	require.NoError(t, err)
+	require.Len(t, got, len(data)+ValueBytes)
+}
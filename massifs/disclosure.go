@@ -0,0 +1,211 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	commoncose "github.com/forestrie/go-merklelog/massifs/cose"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/forestrie/go-merklelog/urkle"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/veraison/go-cose"
+)
+
+const (
+	// ReceiptDisclosuresLabel is the private-use unprotected header label
+	// under which a receipt carries the salted commitments to the extra
+	// fields of the leaf it proves, see NewDisclosingReceipt. The 1004 offset
+	// follows the seal index configuration label.
+	ReceiptDisclosuresLabel int64 = COSEPrivateStart - 1004
+
+	// DisclosureSaltBytes is the size of the random salt of each committed
+	// field. It stops a relying party confirming guesses of the fields which
+	// are not disclosed to it.
+	DisclosureSaltBytes = 16
+)
+
+var (
+	ErrNoDisclosures      = errors.New("the receipt carries no disclosure commitments")
+	ErrDisclosureMismatch = errors.New("the disclosure does not match the receipt's commitment")
+)
+
+// SlotCommitment is the salted commitment to one extra field, see
+// DisclosureDigest.
+type SlotCommitment struct {
+	Slot   uint8  `cbor:"1,keyasint"`
+	Digest []byte `cbor:"2,keyasint"`
+}
+
+// ReceiptDisclosures is the receipt extension carried under
+// ReceiptDisclosuresLabel. Index is the mmr index of the leaf, it is that of
+// the receipt's inclusion proof.
+type ReceiptDisclosures struct {
+	Index uint64           `cbor:"1,keyasint"`
+	Slots []SlotCommitment `cbor:"2,keyasint"`
+}
+
+// Disclosure reveals one extra field of a leaf. The holder of a disclosing
+// receipt is given one for each committed field, and passes those it chooses
+// to reveal, with the receipt, to a relying party.
+type Disclosure struct {
+	Slot  uint8  `cbor:"1,keyasint"`
+	Salt  []byte `cbor:"2,keyasint"`
+	Value []byte `cbor:"3,keyasint"`
+}
+
+// DisclosureDigest returns the commitment to the disclosed field of the leaf
+// at mmrIndex,
+//
+//	SHA-256(mmrIndex as 8 bytes big endian || slot || salt || value)
+//
+// Value is the field as stored, 24 bytes for slot 0 and ValueBytes for the
+// others.
+func DisclosureDigest(mmrIndex uint64, d Disclosure) []byte {
+	h := sha256.New()
+	var index [8]byte
+	binary.BigEndian.PutUint64(index[:], mmrIndex)
+	h.Write(index[:])
+	h.Write([]byte{d.Slot})
+	h.Write(d.Salt)
+	h.Write(d.Value)
+	return h.Sum(nil)
+}
+
+// NewDisclosingReceipt mints the receipt of inclusion for the leaf at
+// mmrIndex, as NewReceipt does, extended with salted commitments to the
+// extra fields of the leaf named by slots. The disclosures returned open the
+// commitments, they are for the holder of the receipt, who reveals any of
+// them to a relying party without revealing the others. The relying party
+// checks each with VerifyDisclosure, having verified the receipt with
+// VerifySignedInclusionReceipt.
+//
+// The log signature covers the leaf hash, not the extension, which is in the
+// unprotected header as the inclusion proof is. So a disclosure shows the
+// field is the one the minter read from the verified massif, and is bound to
+// the log itself only where the application commits the extras in the leaf
+// hash.
+func NewDisclosingReceipt(
+	ctx context.Context,
+	reader ObjectReader,
+	verifier cose.Verifier,
+	massifHeight uint8,
+	mmrIndex uint64,
+	slots []uint8,
+) (*commoncose.CoseSign1Message, []Disclosure, error) {
+	if mmr.IndexHeight(mmrIndex) != 0 {
+		return nil, nil, fmt.Errorf("%w: mmr index %d is not a leaf", ErrTrieExtraRange, mmrIndex)
+	}
+	for _, slot := range slots {
+		if slot >= urkle.LeafExtraFields {
+			return nil, nil, fmt.Errorf("%w: field %d", ErrTrieExtraRange, slot)
+		}
+	}
+	massifIndex := uint32(MassifIndexFromMMRIndex(massifHeight, mmrIndex))
+	verified, err := GetContextVerified(ctx, reader, verifier, massifIndex)
+	if err != nil {
+		return nil, nil, fmt.Errorf(
+			"%w: failed to get verified context %d", err, massifIndex)
+	}
+	receipt, err := newVerifiedReceipt(verified, mmrIndex)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	leafTable, err := verified.UrkleLeafTableRegion()
+	if err != nil {
+		return nil, nil, err
+	}
+	ordinal, err := verified.GetMassifLeafIndex(mmr.LeafIndex(mmrIndex))
+	if err != nil {
+		return nil, nil, err
+	}
+	extension := ReceiptDisclosures{Index: mmrIndex}
+	disclosures := make([]Disclosure, 0, len(slots))
+	for _, slot := range slots {
+		extra := urkle.LeafExtra(leafTable, uint32(ordinal), slot)
+		d := Disclosure{
+			Slot:  slot,
+			Salt:  make([]byte, DisclosureSaltBytes),
+			Value: extra[:trieExtraFieldBytes(slot)],
+		}
+		if _, err = rand.Read(d.Salt); err != nil {
+			return nil, nil, err
+		}
+		disclosures = append(disclosures, d)
+		extension.Slots = append(extension.Slots, SlotCommitment{Slot: slot, Digest: DisclosureDigest(mmrIndex, d)})
+	}
+	receipt.Headers.Unprotected[ReceiptDisclosuresLabel] = extension
+	return receipt, disclosures, nil
+}
+
+// ReadReceiptDisclosures returns the disclosure extension of the receipt,
+// ErrNoDisclosures if it has none.
+func ReadReceiptDisclosures(receipt *commoncose.CoseSign1Message) (ReceiptDisclosures, error) {
+	header, err := unprotectedHeader(receipt)
+	if err != nil {
+		return ReceiptDisclosures{}, err
+	}
+	raw, ok := header[ReceiptDisclosuresLabel]
+	if !ok {
+		return ReceiptDisclosures{}, ErrNoDisclosures
+	}
+	var extension ReceiptDisclosures
+	if err = cbor.Unmarshal(raw, &extension); err != nil {
+		return ReceiptDisclosures{}, fmt.Errorf("decode receipt disclosures: %w", err)
+	}
+	return extension, nil
+}
+
+// VerifyDisclosure checks the disclosed field against the commitment carried
+// by the receipt, for the leaf the receipt proves. It does not verify the
+// receipt itself.
+func VerifyDisclosure(receipt *commoncose.CoseSign1Message, d Disclosure) error {
+	extension, err := ReadReceiptDisclosures(receipt)
+	if err != nil {
+		return err
+	}
+	header, err := unprotectedHeader(receipt)
+	if err != nil {
+		return err
+	}
+	var proofs MMRiverVerifiableProofs
+	if err = cbor.Unmarshal(header[checkpointLabelVDP], &proofs); err != nil || len(proofs.InclusionProofs) == 0 {
+		return fmt.Errorf("%w: the receipt has no inclusion proof", ErrDisclosureMismatch)
+	}
+	if proofs.InclusionProofs[0].Index != extension.Index {
+		return fmt.Errorf("%w: the commitments are for mmr index %d, the receipt proves %d",
+			ErrDisclosureMismatch, extension.Index, proofs.InclusionProofs[0].Index)
+	}
+	for _, slot := range extension.Slots {
+		if slot.Slot != d.Slot {
+			continue
+		}
+		if !bytes.Equal(slot.Digest, DisclosureDigest(extension.Index, d)) {
+			return fmt.Errorf("%w: field %d", ErrDisclosureMismatch, d.Slot)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: field %d is not committed", ErrDisclosureMismatch, d.Slot)
+}
+
+// unprotectedHeader returns the unprotected header of a receipt, whether it
+// was decoded or is being built.
+func unprotectedHeader(receipt *commoncose.CoseSign1Message) (map[int64]cbor.RawMessage, error) {
+	raw := receipt.Headers.RawUnprotected
+	if len(raw) == 0 {
+		var err error
+		if raw, err = cbor.Marshal(receipt.Headers.Unprotected); err != nil {
+			return nil, fmt.Errorf("encode unprotected header: %w", err)
+		}
+	}
+	var header map[int64]cbor.RawMessage
+	if err := cbor.Unmarshal(raw, &header); err != nil {
+		return nil, fmt.Errorf("decode unprotected header: %w", err)
+	}
+	return header, nil
+}
@@ -0,0 +1,76 @@
+package massifs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"testing"
+
+	commoncbor "github.com/forestrie/go-merklelog/massifs/cbor"
+	commoncose "github.com/forestrie/go-merklelog/massifs/cose"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+func TestDisclosingReceipt(t *testing.T) {
+	ctx := context.Background()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := cose.NewSigner(cose.AlgorithmES256, key)
+	require.NoError(t, err)
+	verifier := newES256Verifier(t, &key.PublicKey)
+
+	store := newMemStore(nil, nil)
+	l, err := OpenLog(ctx, store, WithLogMassifHeight(3),
+		WithLogSigner(signer, WithPeakReceipts([]byte("log-key-1"))))
+	require.NoError(t, err)
+	var entries []LogEntry
+	for i := range 3 {
+		leaf := sha256.Sum256([]byte{byte(i)})
+		entries = append(entries, LogEntry{IDTimestamp: uint64(i + 1), Value: leaf[:], Extras: [][]byte{
+			[]byte("tenant"), []byte("confirmed"), []byte("private"),
+		}})
+	}
+	_, err = l.Append(ctx, entries...)
+	require.NoError(t, err)
+	_, err = l.Seal(ctx)
+	require.NoError(t, err)
+
+	mmrIndex := mmr.MMRIndex(2)
+	minted, disclosures, err := NewDisclosingReceipt(ctx, store, verifier, 3, mmrIndex, []uint8{1, 2})
+	require.NoError(t, err)
+	require.Len(t, disclosures, 2)
+	require.Equal(t, []byte("confirmed"), disclosures[0].Value[:len("confirmed")])
+
+	// Round-trip the receipt as a relying party would receive it.
+	encoded, err := minted.MarshalCBOR()
+	require.NoError(t, err)
+	receipt, err := commoncose.NewCoseSign1MessageFromCBOR(encoded, commoncose.WithDecOptions(commoncbor.DecOptions))
+	require.NoError(t, err)
+
+	node, err := newLogNodeStore(ctx, store).Get(mmrIndex)
+	require.NoError(t, err)
+	ok, _, err := VerifySignedInclusionReceipt(ctx, receipt, verifier, node)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// the confirmation status is revealed alone
+	require.NoError(t, VerifyDisclosure(receipt, disclosures[0]))
+
+	altered := disclosures[0]
+	altered.Value = []byte("rejected")
+	require.ErrorIs(t, VerifyDisclosure(receipt, altered), ErrDisclosureMismatch)
+	uncommitted := Disclosure{Slot: 0, Salt: disclosures[0].Salt, Value: []byte("tenant")}
+	require.ErrorIs(t, VerifyDisclosure(receipt, uncommitted), ErrDisclosureMismatch)
+
+	// a plain receipt carries no commitments
+	plain, err := NewReceipt(ctx, store, verifier, 3, mmrIndex)
+	require.NoError(t, err)
+	require.ErrorIs(t, VerifyDisclosure(plain, disclosures[0]), ErrNoDisclosures)
+
+	_, _, err = NewDisclosingReceipt(ctx, store, verifier, 3, 2, []uint8{1})
+	require.ErrorIs(t, err, ErrTrieExtraRange)
+}
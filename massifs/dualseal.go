@@ -0,0 +1,156 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/veraison/go-cose"
+)
+
+// ErrDualSealMismatch is returned when the V0 seal and the checkpoint of a
+// massif do not describe the same log.
+var ErrDualSealMismatch = errors.New("the V0 seal and the checkpoint of the massif are not consistent")
+
+// LegacySealReader is implemented by readers which can read the
+// storage.ObjectLegacyCheckpoint objects of a log.
+type LegacySealReader interface {
+	// LegacySealRead returns the V0 seal of the massif. A NotFoundError is
+	// returned if there is none.
+	LegacySealRead(ctx context.Context, massifIndex uint32) ([]byte, error)
+}
+
+// SignLegacySeal signs a V0 seal of the accumulator for mmrSize: the bagged
+// root of the accumulator, attached as a LegacySealState. It is for the
+// migration window, when verifiers which only read V0 seals must still be
+// served, see WithLogDualSeal. lastID is the idtimestamp of the last leaf
+// sealed.
+func SignLegacySeal(
+	signer cose.Signer, mmrSize uint64, accumulator [][]byte, commitmentEpoch uint32, lastID uint64,
+) ([]byte, error) {
+	if mmrSize == 0 || len(accumulator) != len(mmr.Peaks(mmrSize-1)) {
+		return nil, fmt.Errorf("%w: %d peaks for sealed size %d", ErrLegacySealRootMismatch, len(accumulator), mmrSize)
+	}
+	payload, err := cbor.Marshal(LegacySealState{
+		MMRSize:         mmrSize,
+		LegacySealRoot:  mmr.HashPeaksRHS(sha256.New(), accumulator),
+		Timestamp:       time.Now().UnixMilli(),
+		IDTimestamp:     lastID,
+		CommitmentEpoch: commitmentEpoch,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("encode legacy seal state: %w", err)
+	}
+	msg := cose.NewSign1Message()
+	msg.Headers.Protected.SetAlgorithm(signer.Algorithm())
+	msg.Payload = payload
+	if err = msg.Sign(rand.Reader, nil, signer); err != nil {
+		return nil, fmt.Errorf("sign legacy seal: %w", err)
+	}
+	return msg.MarshalCBOR()
+}
+
+// DualSealState is the sealed state of a massif read by VerifyDualSeal
+type DualSealState struct {
+	MMRState
+	// Checkpoint is the checkpoint the state was verified from, nil if the
+	// massif only has a V0 seal
+	Checkpoint *Checkpoint
+	// Legacy is the V0 seal, nil if the massif has none
+	Legacy *LegacySealState
+}
+
+// VerifyDualSeal verifies the seals of a massif sealed during the V0 to
+// current format migration. The checkpoint is preferred, the V0 seal is only
+// relied on if the massif has no checkpoint. Where there are both, both are
+// verified against the massif, and the smaller must be consistent with the
+// larger: the two objects are not written atomically, so one may be ahead of
+// the other. If they seal the same size, the checkpoint's accumulator must
+// bag to the V0 root. Readers which are not LegacySealReaders are read as
+// having no V0 seals.
+//
+// ErrSealNotFound is returned if the massif has neither.
+func VerifyDualSeal(
+	ctx context.Context, reader ObjectReader, verifier cose.Verifier, massifIndex uint32,
+) (DualSealState, error) {
+	mc, err := GetMassifContext(ctx, reader, massifIndex)
+	if err != nil {
+		return DualSealState{}, err
+	}
+
+	var sealed DualSealState
+	check, err := GetCheckpoint(ctx, reader, massifIndex)
+	if err != nil && !storage.IsNotFound(err) {
+		return DualSealState{}, err
+	}
+	if err == nil {
+		accumulator, err := VerifyCheckpointReceipt(&mc, &check.Receipt, verifier)
+		if err != nil {
+			return DualSealState{}, err
+		}
+		sealed.Checkpoint = &check
+		sealed.MMRState = MMRState{MMRSize: check.MMRSize, Peaks: accumulator}
+	}
+
+	var data []byte
+	if legacy, ok := reader.(LegacySealReader); ok {
+		data, err = legacy.LegacySealRead(ctx, massifIndex)
+		if err != nil && !storage.IsNotFound(err) {
+			return DualSealState{}, err
+		}
+	}
+	if data == nil {
+		if sealed.Checkpoint == nil {
+			return DualSealState{}, fmt.Errorf("%w: massif %d has no checkpoint or V0 seal", ErrSealNotFound, massifIndex)
+		}
+		return sealed, nil
+	}
+	state, accumulator, err := VerifyLegacySeal(&mc, data, verifier)
+	if err != nil {
+		return DualSealState{}, err
+	}
+	sealed.Legacy = &state
+	if sealed.Checkpoint == nil {
+		sealed.MMRState = MMRState{MMRSize: state.MMRSize, Peaks: accumulator}
+		return sealed, nil
+	}
+
+	if err = checkDualSeal(&mc, sealed.MMRState, state, accumulator); err != nil {
+		return DualSealState{}, fmt.Errorf("massif %d: %w", massifIndex, err)
+	}
+	return sealed, nil
+}
+
+// checkDualSeal cross checks a verified checkpoint state with a verified V0
+// seal of the same massif
+func checkDualSeal(mc *MassifContext, current MMRState, legacy LegacySealState, legacyAccumulator [][]byte) error {
+	if legacy.CommitmentEpoch != 0 && legacy.CommitmentEpoch != mc.Start.CommitmentEpoch {
+		return fmt.Errorf("%w: the V0 seal is for epoch %d, the massif is epoch %d",
+			ErrDualSealMismatch, legacy.CommitmentEpoch, mc.Start.CommitmentEpoch)
+	}
+	if current.MMRSize == legacy.MMRSize {
+		if !bytes.Equal(mmr.HashPeaksRHS(sha256.New(), current.Peaks), legacy.LegacySealRoot) {
+			return fmt.Errorf("%w: the checkpoint accumulator does not bag to the V0 root", ErrDualSealMismatch)
+		}
+		return nil
+	}
+	from, to := MMRState{MMRSize: legacy.MMRSize, Peaks: legacyAccumulator}, current
+	if from.MMRSize > to.MMRSize {
+		from, to = to, from
+	}
+	ok, _, err := mmr.CheckConsistency(mc, sha256.New(), from.MMRSize, to.MMRSize, from.Peaks)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDualSealMismatch, err)
+	}
+	if !ok {
+		return fmt.Errorf("%w: sizes %d and %d are not consistent", ErrDualSealMismatch, from.MMRSize, to.MMRSize)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package massifs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+func (m *memStore) LegacySealRead(ctx context.Context, massifIndex uint32) ([]byte, error) {
+	b, ok := m.legacySeals[massifIndex]
+	if !ok {
+		return nil, storage.NewNotFoundError(nil, storage.ObjectLegacyCheckpoint, massifIndex)
+	}
+	return b, nil
+}
+
+func TestVerifyDualSeal(t *testing.T) {
+	ctx := context.Background()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := cose.NewSigner(cose.AlgorithmES256, key)
+	require.NoError(t, err)
+	verifier := newES256Verifier(t, &key.PublicKey)
+
+	store := newMemStore(nil, nil)
+	l, err := OpenLog(ctx, store, WithLogMassifHeight(3), WithLogSigner(signer), WithLogDualSeal())
+	require.NoError(t, err)
+	appendSealed := func(first, n int) {
+		var entries []LogEntry
+		for i := first; i < first+n; i++ {
+			leaf := sha256.Sum256(fmt.Appendf(nil, "dual-seal-leaf-%d", i))
+			entries = append(entries, LogEntry{IDTimestamp: uint64(i + 1), Value: leaf[:]})
+		}
+		_, err := l.Append(ctx, entries...)
+		require.NoError(t, err)
+		_, err = l.Seal(ctx)
+		require.NoError(t, err)
+	}
+	appendSealed(0, 6)
+	require.Len(t, store.legacySeals, 2)
+
+	sealed, err := VerifyDualSeal(ctx, store, verifier, 1)
+	require.NoError(t, err)
+	require.NotNil(t, sealed.Checkpoint)
+	require.NotNil(t, sealed.Legacy)
+	require.Equal(t, sealed.Checkpoint.MMRSize, sealed.Legacy.MMRSize)
+
+	// a V0 seal behind the checkpoint is consistent with it
+	previous := store.legacySeals[1]
+	appendSealed(6, 1)
+	store.legacySeals[1] = previous
+	sealed, err = VerifyDualSeal(ctx, store, verifier, 1)
+	require.NoError(t, err)
+	require.Less(t, sealed.Legacy.MMRSize, sealed.MMRSize)
+
+	// without the checkpoint the V0 seal is relied on
+	delete(store.checkpoint, 1)
+	sealed, err = VerifyDualSeal(ctx, store, verifier, 1)
+	require.NoError(t, err)
+	require.Nil(t, sealed.Checkpoint)
+	require.Equal(t, sealed.Legacy.MMRSize, sealed.MMRSize)
+	delete(store.legacySeals, 1)
+	_, err = VerifyDualSeal(ctx, store, verifier, 1)
+	require.ErrorIs(t, err, ErrSealNotFound)
+
+	// a V0 seal for another epoch is not the same log
+	mc, err := GetMassifContext(ctx, store, 0)
+	require.NoError(t, err)
+	accumulator, err := mmr.PeakHashes(&mc, mc.RangeCount()-1)
+	require.NoError(t, err)
+	store.legacySeals[0], err = SignLegacySeal(signer, mc.RangeCount(), accumulator, 2, mc.GetLastIDTimestamp())
+	require.NoError(t, err)
+	_, err = VerifyDualSeal(ctx, store, verifier, 0)
+	require.ErrorIs(t, err, ErrDualSealMismatch)
+}
@@ -0,0 +1,244 @@
+package massifs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/veraison/go-cose"
+)
+
+var (
+	ErrEquivocation             = errors.New("the log has signed two different accumulators for the same mmr size")
+	ErrEquivocationProofInvalid = errors.New("the equivocation proof is invalid")
+)
+
+// EquivocationProof is the evidence that a log equivocated: two seals, by
+// the same log key, of different accumulators for the same MMRSize. It is
+// compact, the unprotected headers of the checkpoints are dropped, as the
+// signatures are over the protected headers and the accumulators alone. See
+// VerifyEquivocationProof.
+//
+// The mmr size of a checkpoint is in its unprotected consistency proof, so
+// only seals which also sign it, see WithSealMMRSize, are evidence. Honest
+// seals of different sizes with the same number of peaks have different
+// accumulators, and without the signed size they would pass as seals of the
+// same size.
+type EquivocationProof struct {
+	LogID   []byte             `cbor:"1,keyasint,omitempty"`
+	MMRSize uint64             `cbor:"2,keyasint"`
+	Seals   []EquivocatingSeal `cbor:"3,keyasint"`
+}
+
+// EquivocatingSeal is one of the two seals of an EquivocationProof
+type EquivocatingSeal struct {
+	ProtectedHeader []byte   `cbor:"1,keyasint"`
+	Signature       []byte   `cbor:"2,keyasint"`
+	Accumulator     [][]byte `cbor:"3,keyasint"`
+}
+
+// Encode returns the canonical CBOR encoding of the proof
+func (p *EquivocationProof) Encode() ([]byte, error) {
+	data, err := canonicalReceiptCBOR.Marshal(p)
+	if err != nil {
+		return nil, fmt.Errorf("encode equivocation proof: %w", err)
+	}
+	return data, nil
+}
+
+// VerifyEquivocationProof verifies both seals of the encoded proof with the
+// log's verifier, that both sign MMRSize and that their accumulators differ,
+// and returns the proof.
+func VerifyEquivocationProof(data []byte, verifier cose.Verifier) (*EquivocationProof, error) {
+	if verifier == nil {
+		return nil, ErrVerifierRequired
+	}
+	var proof EquivocationProof
+	if err := cbor.Unmarshal(data, &proof); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrEquivocationProofInvalid, err)
+	}
+	if len(proof.Seals) != 2 {
+		return nil, fmt.Errorf("%w: %d seals", ErrEquivocationProofInvalid, len(proof.Seals))
+	}
+	if proof.MMRSize == 0 || mmr.FirstMMRSize(proof.MMRSize-1) != proof.MMRSize {
+		return nil, fmt.Errorf("%w: %d is not a complete mmr size", ErrEquivocationProofInvalid, proof.MMRSize)
+	}
+	peakCount := len(mmr.Peaks(proof.MMRSize - 1))
+
+	logID := storage.LogID(proof.LogID)
+	for i, seal := range proof.Seals {
+		if len(seal.Accumulator) != peakCount {
+			return nil, fmt.Errorf("%w: seal %d has %d peaks, MMR(%d) has %d",
+				ErrEquivocationProofInvalid, i, len(seal.Accumulator), proof.MMRSize, peakCount)
+		}
+		err := verifier.Verify(SigStructure(seal.ProtectedHeader, DetachedPayload(seal.Accumulator)), seal.Signature)
+		if err != nil {
+			return nil, fmt.Errorf("%w: seal %d: %v", ErrEquivocationProofInvalid, i, err)
+		}
+		size, err := ReadSealMMRSize(seal.ProtectedHeader)
+		if err != nil {
+			return nil, fmt.Errorf("%w: seal %d: %v", ErrEquivocationProofInvalid, i, err)
+		}
+		if size != proof.MMRSize {
+			return nil, fmt.Errorf("%w: seal %d signs MMR size %d, not %d",
+				ErrEquivocationProofInvalid, i, size, proof.MMRSize)
+		}
+		claims, err := ReadSealClaims(seal.ProtectedHeader)
+		if err != nil || claims.Subject == "" {
+			continue
+		}
+		sealedLogID, _, err := claims.Log()
+		if err != nil {
+			return nil, fmt.Errorf("%w: seal %d: %v", ErrEquivocationProofInvalid, i, err)
+		}
+		if logID == nil {
+			logID = sealedLogID
+		}
+		if !bytes.Equal(logID, sealedLogID) {
+			return nil, fmt.Errorf("%w: seal %d is for log %x, not %x",
+				ErrEquivocationProofInvalid, i, []byte(sealedLogID), []byte(logID))
+		}
+	}
+	if peaksEqual(proof.Seals[0].Accumulator, proof.Seals[1].Accumulator) {
+		return nil, fmt.Errorf("%w: the accumulators are the same", ErrEquivocationProofInvalid)
+	}
+	return &proof, nil
+}
+
+// EquivocationCollector remembers the first verified checkpoint seen for
+// each log and mmr size. A later checkpoint for the same size with a
+// different accumulator is an equivocation, and the collector keeps the
+// evidence. See WithEquivocationCollector.
+//
+// The proofs of checkpoints signed without their size are collected, as the
+// log's own verification shows the size, but they do not satisfy
+// VerifyEquivocationProof. An in memory collector only keeps the proofs. A collector opened on a
+// directory also writes each proof there, with both checkpoints verbatim, as
+//
+//	equivocation-{log id hex}-{mmr size}.cbor
+//	equivocation-{log id hex}-{mmr size}-{0,1}.cose
+type EquivocationCollector struct {
+	mu     sync.Mutex
+	dir    string
+	seen   map[string]map[uint64]observedSeal
+	proofs []*EquivocationProof
+}
+
+type observedSeal struct {
+	raw         []byte
+	receipt     CheckpointReceipt
+	accumulator [][]byte
+}
+
+// NewEquivocationCollector returns an empty, in memory, collector.
+func NewEquivocationCollector() *EquivocationCollector {
+	return &EquivocationCollector{seen: map[string]map[uint64]observedSeal{}}
+}
+
+// OpenEquivocationCollector returns an empty collector which writes the
+// evidence it collects to dir, creating it if necessary.
+func OpenEquivocationCollector(dir string) (*EquivocationCollector, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	c := NewEquivocationCollector()
+	c.dir = dir
+	return c, nil
+}
+
+// Observe records a checkpoint whose signature over accumulator has been
+// verified. If a different accumulator has been observed for the log at the
+// same size, the proof is returned with ErrEquivocation. Observing the same
+// equivocation again returns it again, but it is only collected once.
+func (c *EquivocationCollector) Observe(
+	logID storage.LogID, check *Checkpoint, accumulator [][]byte,
+) (*EquivocationProof, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	bySize, ok := c.seen[string(logID)]
+	if !ok {
+		bySize = map[uint64]observedSeal{}
+		c.seen[string(logID)] = bySize
+	}
+	first, ok := bySize[check.MMRSize]
+	if !ok {
+		bySize[check.MMRSize] = observedSeal{
+			raw: bytes.Clone(check.Raw), receipt: check.Receipt, accumulator: clonePeaks(accumulator),
+		}
+		return nil, nil
+	}
+	if peaksEqual(first.accumulator, accumulator) {
+		return nil, nil
+	}
+
+	proof := &EquivocationProof{
+		LogID:   bytes.Clone(logID),
+		MMRSize: check.MMRSize,
+		Seals: []EquivocatingSeal{
+			{ProtectedHeader: first.receipt.ProtectedHeader, Signature: first.receipt.Signature, Accumulator: first.accumulator},
+			{ProtectedHeader: check.Receipt.ProtectedHeader, Signature: check.Receipt.Signature, Accumulator: clonePeaks(accumulator)},
+		},
+	}
+	err := fmt.Errorf("%w: log %x, MMR size %d", ErrEquivocation, []byte(logID), check.MMRSize)
+	for _, collected := range c.proofs {
+		if bytes.Equal(collected.LogID, proof.LogID) && collected.MMRSize == proof.MMRSize &&
+			peaksEqual(collected.Seals[1].Accumulator, accumulator) {
+			return collected, err
+		}
+	}
+	if werr := c.write(proof, first.raw, check.Raw); werr != nil {
+		return proof, errors.Join(err, werr)
+	}
+	c.proofs = append(c.proofs, proof)
+	return proof, err
+}
+
+// Proofs returns the proofs collected so far
+func (c *EquivocationCollector) Proofs() []*EquivocationProof {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*EquivocationProof(nil), c.proofs...)
+}
+
+// write persists the proof and both checkpoints, if the collector has a
+// directory. The proof is written last, so its presence means the evidence
+// is complete.
+func (c *EquivocationCollector) write(proof *EquivocationProof, checkpoints ...[]byte) error {
+	if c.dir == "" {
+		return nil
+	}
+	data, err := proof.Encode()
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("equivocation-%s-%d", hex.EncodeToString(proof.LogID), proof.MMRSize)
+	// a second equivocation at the same size does not replace the first
+	if _, err = os.Stat(filepath.Join(c.dir, name+".cbor")); err == nil {
+		sum := sha256.Sum256(data)
+		name += "-" + hex.EncodeToString(sum[:4])
+	}
+	for i, raw := range checkpoints {
+		if err = os.WriteFile(filepath.Join(c.dir, fmt.Sprintf("%s-%d.cose", name, i)), raw, 0o644); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(filepath.Join(c.dir, name+".cbor"), data, 0o644)
+}
+
+// observeEquivocation passes a verified checkpoint to the equivocation
+// collector, if there is one.
+func (options VerifyOptions) observeEquivocation(check *Checkpoint, accumulator [][]byte) error {
+	if options.Equivocations == nil {
+		return nil
+	}
+	_, err := options.Equivocations.Observe(options.LogID, check, accumulator)
+	return err
+}
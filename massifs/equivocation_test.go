@@ -0,0 +1,149 @@
+package massifs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+func TestEquivocationCollector(t *testing.T) {
+	ctx := context.Background()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := cose.NewSigner(cose.AlgorithmES256, key)
+	require.NoError(t, err)
+	verifier := newES256Verifier(t, &key.PublicKey)
+
+	// two views of the log, both sealed by its key, with different leaves
+	honest := buildSizeSealedLog(t, signer, "honest-leaf", 3)
+	forked := buildSizeSealedLog(t, signer, "forked-leaf", 3)
+
+	dir := t.TempDir()
+	collector, err := OpenEquivocationCollector(dir)
+	require.NoError(t, err)
+	logID := storage.LogID([]byte("log-1"))
+	opt := WithEquivocationCollector(collector, logID)
+
+	_, err = GetContextVerified(ctx, honest, verifier, 0, opt)
+	require.NoError(t, err)
+	_, err = GetContextVerified(ctx, honest, verifier, 0, opt)
+	require.NoError(t, err)
+	_, err = GetContextVerified(ctx, forked, verifier, 0, opt)
+	require.ErrorIs(t, err, ErrEquivocation)
+	_, err = GetContextVerified(ctx, forked, verifier, 0, opt)
+	require.ErrorIs(t, err, ErrEquivocation)
+
+	// the evidence is collected once, with both checkpoints verbatim
+	proofs := collector.Proofs()
+	require.Len(t, proofs, 1)
+	name := fmt.Sprintf("equivocation-%x-%d", []byte(logID), proofs[0].MMRSize)
+	for i, raw := range [][]byte{honest.checkpoint[0], forked.checkpoint[0]} {
+		stored, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("%s-%d.cose", name, i)))
+		require.NoError(t, err)
+		require.Equal(t, raw, stored)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, name+".cbor"))
+	require.NoError(t, err)
+
+	proof, err := VerifyEquivocationProof(data, verifier)
+	require.NoError(t, err)
+	require.Equal(t, proofs[0].MMRSize, proof.MMRSize)
+
+	// a proof must be of two different accumulators, signed by the log
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, err = VerifyEquivocationProof(data, newES256Verifier(t, &other.PublicKey))
+	require.ErrorIs(t, err, ErrEquivocationProofInvalid)
+	proof.Seals[1] = proof.Seals[0]
+	same, err := proof.Encode()
+	require.NoError(t, err)
+	_, err = VerifyEquivocationProof(same, verifier)
+	require.ErrorIs(t, err, ErrEquivocationProofInvalid)
+}
+
+func TestVerifyEquivocationProofRequiresSignedSize(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := cose.NewSigner(cose.AlgorithmES256, key)
+	require.NoError(t, err)
+	verifier := newES256Verifier(t, &key.PublicKey)
+
+	// Two honest checkpoints of one log, at sizes 3 and 7, each with a
+	// single peak, submitted as seals of size 3.
+	proofOf := func(opts ...CheckpointSignOption) []byte {
+		store := newMemStore(nil, nil)
+		var seals []EquivocatingSeal
+		for i := range 4 {
+			mc := appendSizeSealedLeaf(t, store, "honest-leaf", i)
+			if size := mc.RangeCount(); size == 3 || size == 7 {
+				check, err := NewCheckpoint(signCheckpointV3WithSigner(t, &mc, signer, 0, opts...))
+				require.NoError(t, err)
+				accumulator, err := mmr.PeakHashes(&mc, size-1)
+				require.NoError(t, err)
+				seals = append(seals, EquivocatingSeal{
+					ProtectedHeader: check.Receipt.ProtectedHeader,
+					Signature:       check.Receipt.Signature,
+					Accumulator:     accumulator,
+				})
+			}
+		}
+		proof := &EquivocationProof{MMRSize: 3, Seals: seals}
+		data, err := proof.Encode()
+		require.NoError(t, err)
+		return data
+	}
+
+	_, err = VerifyEquivocationProof(proofOf(), verifier)
+	require.ErrorIs(t, err, ErrEquivocationProofInvalid)
+	require.ErrorContains(t, err, ErrNoSealMMRSize.Error())
+
+	_, err = VerifyEquivocationProof(proofOf(WithSealMMRSize()), verifier)
+	require.ErrorIs(t, err, ErrEquivocationProofInvalid)
+	require.ErrorContains(t, err, "signs MMR size 7, not 3")
+
+	// nor can the unprotected proof of a checkpoint disagree with it
+	check, err := NewCheckpoint(buildSizeSealedLog(t, signer, "honest-leaf", 2).checkpoint[0])
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), check.MMRSize)
+	check.Receipt.Proof.TreeSize2 = 7
+	forged, err := EncodeCheckpointReceipt(check.Receipt.ProtectedHeader, check.Receipt.Proof, check.Receipt.Signature)
+	require.NoError(t, err)
+	_, err = NewCheckpoint(forged)
+	require.ErrorIs(t, err, ErrSealMMRSizeMismatch)
+}
+
+// buildSizeSealedLog appends leafCount leaves to a new log and seals them,
+// signing the mmr size
+func buildSizeSealedLog(t *testing.T, signer cose.Signer, prefix string, leafCount int) *memStore {
+	t.Helper()
+	store := newMemStore(nil, nil)
+	var mc MassifContext
+	for i := range leafCount {
+		mc = appendSizeSealedLeaf(t, store, prefix, i)
+	}
+	store.checkpoint[0] = signCheckpointV3WithSigner(t, &mc, signer, 0, WithSealMMRSize())
+	return store
+}
+
+func appendSizeSealedLeaf(t *testing.T, store *memStore, prefix string, i int) MassifContext {
+	t.Helper()
+	ctx := context.Background()
+	mc, err := GetAppendContext(ctx, store, 1, 3)
+	require.NoError(t, err)
+	leaf := sha256.Sum256(fmt.Appendf(nil, "%s-%d", prefix, i))
+	_, err = mc.AddHashedLeaf(sha256.New(), uint64(i+1), nil, nil, nil, leaf[:])
+	require.NoError(t, err)
+	require.NoError(t, CommitContext(ctx, store, &mc))
+	return mc
+}
@@ -13,6 +13,8 @@ var (
 	ErrAncestorStackUnderfilled = errors.New("the ancestor stack data is to short to be valid")
 	ErrAncestorStackInvalid     = errors.New("the ancestor stack is invalid due to bad header information")
 	ErrIndexNotInMassif         = errors.New("mmr index not in the massif")
+	ErrAppendVetoed             = errors.New("the append was vetoed by the validation hook")
+	ErrMassifReadOnly           = errors.New("the massif context is read only")
 	ErrStateRootMissing         = errors.New("the root field of a state struct was nil when it should have been provided")
 )
 
@@ -0,0 +1,254 @@
+// Package faultstore decorates an object store with the failures real storage
+// backends exhibit: latency, short reads, optimistic concurrency (HTTP 412)
+// failures, torn writes and stale listings. It is for the integration tests
+// of code built on this module, to check that retries and consistency
+// handling hold up against the storage contracts the massifs package relies
+// on. Unlike the simulation package, which schedules actors over its own in
+// memory store, a Store wraps any massifs.ObjectReaderWriter and acts at
+// random, reproducibly for a seed.
+package faultstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs"
+	"github.com/forestrie/go-merklelog/massifs/storage"
+)
+
+var (
+	// ErrTornWrite is returned by a Put which only stored part of the object
+	ErrTornWrite = errors.New("injected torn write, only part of the object was stored")
+	// ErrInvalidConfig is returned by New if the configuration is out of range
+	ErrInvalidConfig = errors.New("the fault configuration is invalid")
+)
+
+// Config selects the faults injected and how often. Each rate is the
+// probability, from 0 to 1, that an eligible operation is acted on.
+type Config struct {
+	// Seed makes the faults injected reproducible, for the same sequence of
+	// operations.
+	Seed uint64
+
+	// Latency delays every operation by at least Latency, and by up to
+	// LatencyJitter more. Operations taking a context return early, with the
+	// context's error, if it is done first.
+	Latency       time.Duration
+	LatencyJitter time.Duration
+
+	// PartialReadRate truncates the data returned by MassifReadN and
+	// CheckpointRead, as a read racing a replacement of the object, or an
+	// interrupted ranged read, may. No error is returned.
+	PartialReadRate float64
+
+	// PreconditionFailRate fails a Put without writing, as an If-Match or
+	// If-None-Match precondition failure does: storage.ErrExistsOC if
+	// failIfExists is set, storage.ErrContentOC otherwise.
+	PreconditionFailRate float64
+
+	// TornWriteRate stores a prefix of the data of a Put and returns
+	// ErrTornWrite.
+	TornWriteRate float64
+
+	// StaleHeadRate has HeadIndex return the head it returned before the
+	// current one, as a listing which has not caught up with the latest
+	// write does.
+	StaleHeadRate float64
+}
+
+// Validate returns an error wrapping ErrInvalidConfig if a rate is not a
+// probability or a duration is negative.
+func (c *Config) Validate() error {
+	for _, rate := range []float64{
+		c.PartialReadRate, c.PreconditionFailRate, c.TornWriteRate, c.StaleHeadRate,
+	} {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("%w: rate %v", ErrInvalidConfig, rate)
+		}
+	}
+	if c.Latency < 0 || c.LatencyJitter < 0 {
+		return fmt.Errorf("%w: negative latency", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// Counts are the faults a Store has injected
+type Counts struct {
+	Delays               int
+	PartialReads         int
+	PreconditionFailures int
+	TornWrites           int
+	StaleHeads           int
+}
+
+// Store is a massifs.ObjectReaderWriter which passes each operation to the
+// store it decorates, injecting faults as configured. It is safe for
+// concurrent use. The store does not implement massifs.ObjectAppender, so
+// commits through it are made with Put.
+type Store struct {
+	inner massifs.ObjectReaderWriter
+	cfg   Config
+
+	mu     sync.Mutex
+	rng    *rand.Rand
+	counts Counts
+	// heads are the last two distinct heads returned for each object type,
+	// the earlier first
+	heads map[storage.ObjectType][2]uint32
+}
+
+// New decorates inner with the configured faults
+func New(inner massifs.ObjectReaderWriter, cfg Config) (*Store, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &Store{
+		inner: inner,
+		cfg:   cfg,
+		rng:   rand.New(rand.NewPCG(cfg.Seed, cfg.Seed)),
+		heads: map[storage.ObjectType][2]uint32{},
+	}, nil
+}
+
+// Counts returns the faults injected so far
+func (s *Store) Counts() Counts {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counts
+}
+
+func (s *Store) HeadIndex(ctx context.Context, otype storage.ObjectType) (uint32, error) {
+	if err := s.delay(ctx); err != nil {
+		return 0, err
+	}
+	head, err := s.inner.HeadIndex(ctx, otype)
+	if err != nil {
+		return head, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	heads, seen := s.heads[otype]
+	if !seen {
+		heads = [2]uint32{head, head}
+	} else if head != heads[1] {
+		heads = [2]uint32{heads[1], head}
+	}
+	s.heads[otype] = heads
+	if heads[0] < head && s.chance(s.cfg.StaleHeadRate) {
+		s.counts.StaleHeads++
+		return heads[0], nil
+	}
+	return head, nil
+}
+
+func (s *Store) MassifData(massifIndex uint32) ([]byte, bool, error) {
+	if err := s.delay(context.Background()); err != nil {
+		return nil, false, err
+	}
+	return s.inner.MassifData(massifIndex)
+}
+
+func (s *Store) CheckpointData(massifIndex uint32) ([]byte, bool, error) {
+	if err := s.delay(context.Background()); err != nil {
+		return nil, false, err
+	}
+	return s.inner.CheckpointData(massifIndex)
+}
+
+func (s *Store) MassifReadN(ctx context.Context, massifIndex uint32, n int) ([]byte, error) {
+	if err := s.delay(ctx); err != nil {
+		return nil, err
+	}
+	data, err := s.inner.MassifReadN(ctx, massifIndex, n)
+	if err != nil {
+		return nil, err
+	}
+	return s.partial(data), nil
+}
+
+func (s *Store) CheckpointRead(ctx context.Context, massifIndex uint32) ([]byte, error) {
+	if err := s.delay(ctx); err != nil {
+		return nil, err
+	}
+	data, err := s.inner.CheckpointRead(ctx, massifIndex)
+	if err != nil {
+		return nil, err
+	}
+	return s.partial(data), nil
+}
+
+func (s *Store) Put(ctx context.Context, massifIndex uint32, ty storage.ObjectType, data []byte, failIfExists bool) error {
+	if err := s.delay(ctx); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	precondition := s.chance(s.cfg.PreconditionFailRate)
+	torn := !precondition && len(data) > 0 && s.chance(s.cfg.TornWriteRate)
+	var n int
+	if precondition {
+		s.counts.PreconditionFailures++
+	}
+	if torn {
+		s.counts.TornWrites++
+		n = s.rng.IntN(len(data))
+	}
+	s.mu.Unlock()
+
+	if precondition {
+		if failIfExists {
+			return fmt.Errorf("%w: injected for %v %d", storage.ErrExistsOC, ty, massifIndex)
+		}
+		return fmt.Errorf("%w: injected for %v %d", storage.ErrContentOC, ty, massifIndex)
+	}
+	if torn {
+		if err := s.inner.Put(ctx, massifIndex, ty, data[:n], failIfExists); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: %d of %d bytes of %v %d", ErrTornWrite, n, len(data), ty, massifIndex)
+	}
+	return s.inner.Put(ctx, massifIndex, ty, data, failIfExists)
+}
+
+// delay sleeps for the configured latency, or until ctx is done
+func (s *Store) delay(ctx context.Context) error {
+	if s.cfg.Latency == 0 && s.cfg.LatencyJitter == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	d := s.cfg.Latency
+	if s.cfg.LatencyJitter > 0 {
+		d += time.Duration(s.rng.Int64N(int64(s.cfg.LatencyJitter) + 1))
+	}
+	s.counts.Delays++
+	s.mu.Unlock()
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// partial returns a prefix of data, if a partial read is injected
+func (s *Store) partial(data []byte) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(data) == 0 || !s.chance(s.cfg.PartialReadRate) {
+		return data
+	}
+	s.counts.PartialReads++
+	return data[:s.rng.IntN(len(data))]
+}
+
+// chance returns true with probability rate, s.mu must be held
+func (s *Store) chance(rate float64) bool {
+	return rate > 0 && s.rng.Float64() < rate
+}
@@ -0,0 +1,78 @@
+package faultstore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs/simulation"
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	inner := simulation.NewStore().As("test")
+	data := []byte("0123456789abcdef")
+
+	s, err := New(inner, Config{PreconditionFailRate: 1})
+	require.NoError(t, err)
+	require.ErrorIs(t, s.Put(ctx, 0, storage.ObjectMassifData, data, false), storage.ErrContentOC)
+	require.ErrorIs(t, s.Put(ctx, 0, storage.ObjectMassifData, data, true), storage.ErrExistsOC)
+	_, err = inner.MassifReadN(ctx, 0, -1)
+	require.True(t, storage.IsNotFound(err), "a precondition failure writes nothing")
+	require.Equal(t, 2, s.Counts().PreconditionFailures)
+
+	s, err = New(inner, Config{TornWriteRate: 1})
+	require.NoError(t, err)
+	require.ErrorIs(t, s.Put(ctx, 0, storage.ObjectMassifData, data, false), ErrTornWrite)
+	stored, err := inner.MassifReadN(ctx, 0, -1)
+	require.NoError(t, err)
+	require.Less(t, len(stored), len(data))
+	require.Equal(t, data[:len(stored)], stored)
+	require.NoError(t, inner.Put(ctx, 0, storage.ObjectMassifData, data, false))
+
+	s, err = New(inner, Config{PartialReadRate: 1})
+	require.NoError(t, err)
+	read, err := s.MassifReadN(ctx, 0, -1)
+	require.NoError(t, err)
+	require.Less(t, len(read), len(data))
+	require.Equal(t, data[:len(read)], read)
+
+	// the head moves from 0 to 1, a stale listing still reports 0
+	s, err = New(inner, Config{StaleHeadRate: 1})
+	require.NoError(t, err)
+	head, err := s.HeadIndex(ctx, storage.ObjectMassifData)
+	require.NoError(t, err)
+	require.Equal(t, uint32(0), head)
+	require.NoError(t, inner.Put(ctx, 1, storage.ObjectMassifData, data, false))
+	head, err = s.HeadIndex(ctx, storage.ObjectMassifData)
+	require.NoError(t, err)
+	require.Equal(t, uint32(0), head)
+	require.Equal(t, 1, s.Counts().StaleHeads)
+
+	s, err = New(inner, Config{Latency: time.Hour})
+	require.NoError(t, err)
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = s.MassifReadN(cancelled, 0, -1)
+	require.ErrorIs(t, err, context.Canceled)
+
+	_, err = New(inner, Config{TornWriteRate: 1.5})
+	require.ErrorIs(t, err, ErrInvalidConfig)
+}
+
+func TestStoreSeed(t *testing.T) {
+	ctx := context.Background()
+	outcomes := func(seed uint64) []bool {
+		s, err := New(simulation.NewStore().As("test"), Config{Seed: seed, PreconditionFailRate: 0.5})
+		require.NoError(t, err)
+		var failed []bool
+		for i := range 32 {
+			failed = append(failed, s.Put(ctx, uint32(i), storage.ObjectCheckpoint, []byte{1}, false) != nil)
+		}
+		return failed
+	}
+	require.Equal(t, outcomes(7), outcomes(7))
+	require.NotEqual(t, outcomes(7), outcomes(8))
+}
@@ -0,0 +1,287 @@
+package massifs
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+)
+
+// ErrFenced is wrapped by the FencedError a fenced writer returns once a newer
+// builder has acquired the log. The builder holding the older token must stop
+// and re-read the log before it writes again.
+var ErrFenced = errors.New("the writer has been fenced by a newer builder of the log")
+
+// FencedError reports a write refused because the writer's fencing token is
+// no longer the current one for the log. It wraps ErrFenced.
+type FencedError struct {
+	LogID storage.LogID
+	// Token is the token of the writer refused
+	Token uint64
+	// Current is the token of the builder which now holds the log
+	Current uint64
+}
+
+func (e *FencedError) Error() string {
+	return fmt.Sprintf("%v: log %s, token %d, current %d",
+		ErrFenced, hex.EncodeToString(e.LogID), e.Token, e.Current)
+}
+
+func (e *FencedError) Unwrap() error {
+	return ErrFenced
+}
+
+// FenceStore records the fencing token of each log. A builder acquires a new
+// token when it starts, which fences every builder started before it: their
+// writes, through NewFencedWriter or NewFencedStore, are made with Fenced and
+// fail with a FencedError. Tokens only increase, and must be durable across
+// restarts.
+type FenceStore interface {
+	// Acquire issues the log a token greater than any issued before. It
+	// waits for any write made with Fenced to finish first.
+	Acquire(ctx context.Context, logID storage.LogID) (uint64, error)
+	// Current returns the last token issued for the log, 0 if there is none
+	Current(ctx context.Context, logID storage.LogID) (uint64, error)
+	// Fenced calls write if token is the current token of the log, and
+	// returns a FencedError if it is not. No newer token is issued until
+	// write returns, so a write is either refused or complete before the
+	// builder which fences the writer starts.
+	Fenced(ctx context.Context, logID storage.LogID, token uint64, write func(context.Context) error) error
+}
+
+// CheckFence returns a FencedError if token is not the current token of the
+// log.
+func CheckFence(ctx context.Context, fence FenceStore, logID storage.LogID, token uint64) error {
+	current, err := fence.Current(ctx, logID)
+	if err != nil {
+		return err
+	}
+	if current != token {
+		return &FencedError{LogID: logID, Token: token, Current: current}
+	}
+	return nil
+}
+
+// NewFencedWriter acquires a new token for the log and returns it, with a
+// writer which makes every write with FenceStore.Fenced, so once a newer
+// builder has its token no further write is made. The writer implements
+// ObjectAppender if writer does.
+func NewFencedWriter(
+	ctx context.Context, writer ObjectWriter, fence FenceStore, logID storage.LogID,
+) (ObjectWriter, uint64, error) {
+	token, err := fence.Acquire(ctx, logID)
+	if err != nil {
+		return nil, 0, err
+	}
+	return newFencedWriter(writer, fence, logID, token), token, nil
+}
+
+// NewFencedStore is NewFencedWriter for a store which is also read, such as
+// the store of a Log.
+func NewFencedStore(
+	ctx context.Context, store ObjectReaderWriter, fence FenceStore, logID storage.LogID,
+) (ObjectReaderWriter, uint64, error) {
+	writer, token, err := NewFencedWriter(ctx, store, fence, logID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if appender, ok := writer.(*fencedAppender); ok {
+		return &fencedAppendingStore{ObjectReader: store, fencedAppender: appender}, token, nil
+	}
+	return &fencedStore{ObjectReader: store, fencedWriter: writer.(*fencedWriter)}, token, nil
+}
+
+func newFencedWriter(writer ObjectWriter, fence FenceStore, logID storage.LogID, token uint64) ObjectWriter {
+	w := &fencedWriter{writer: writer, fence: fence, logID: logID, token: token}
+	if appender, ok := writer.(ObjectAppender); ok {
+		return &fencedAppender{fencedWriter: w, appender: appender}
+	}
+	return w
+}
+
+// fencedWriter makes each Put under the fence
+type fencedWriter struct {
+	writer ObjectWriter
+	fence  FenceStore
+	logID  storage.LogID
+	token  uint64
+}
+
+func (w *fencedWriter) Put(
+	ctx context.Context, massifIndex uint32, ty storage.ObjectType, data []byte, failIfExists bool,
+) error {
+	return w.fence.Fenced(ctx, w.logID, w.token, func(ctx context.Context) error {
+		return w.writer.Put(ctx, massifIndex, ty, data, failIfExists)
+	})
+}
+
+// fencedAppender is a fencedWriter of a store which appends in place
+type fencedAppender struct {
+	*fencedWriter
+	appender ObjectAppender
+}
+
+func (w *fencedAppender) AppendMassif(
+	ctx context.Context, massifIndex uint32, base MassifBase, writes []ManifestRange,
+) error {
+	return w.fence.Fenced(ctx, w.logID, w.token, func(ctx context.Context) error {
+		return w.appender.AppendMassif(ctx, massifIndex, base, writes)
+	})
+}
+
+// fencedStore and fencedAppendingStore read the store directly
+type fencedStore struct {
+	ObjectReader
+	*fencedWriter
+}
+
+type fencedAppendingStore struct {
+	ObjectReader
+	*fencedAppender
+}
+
+// MemoryFence is a FenceStore for builders in one process, and for tests.
+// The zero value is ready to use. Fenced writes, of every log, are made one
+// at a time.
+type MemoryFence struct {
+	mu     sync.Mutex
+	tokens map[string]uint64
+}
+
+func (f *MemoryFence) Acquire(ctx context.Context, logID storage.LogID) (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.tokens == nil {
+		f.tokens = map[string]uint64{}
+	}
+	f.tokens[string(logID)]++
+	return f.tokens[string(logID)], nil
+}
+
+func (f *MemoryFence) Current(ctx context.Context, logID storage.LogID) (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.tokens[string(logID)], nil
+}
+
+func (f *MemoryFence) Fenced(
+	ctx context.Context, logID storage.LogID, token uint64, write func(context.Context) error,
+) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if current := f.tokens[string(logID)]; current != token {
+		return &FencedError{LogID: logID, Token: token, Current: current}
+	}
+	return write(ctx)
+}
+
+// DirFence is a FenceStore keeping the token of each log in a file of Dir,
+// for builders which share a local file system. Tokens are issued, and
+// fenced writes made, under a FileLock of the log, so the writes of a log are
+// made one at a time. The token file is synced, with Dir, before Acquire
+// returns.
+type DirFence struct {
+	Dir string
+}
+
+func (f DirFence) Acquire(ctx context.Context, logID storage.LogID) (uint64, error) {
+	var token uint64
+	err := f.locked(ctx, logID, func(path string) error {
+		current, err := f.read(path)
+		if err != nil {
+			return err
+		}
+		token = current + 1
+		return f.write(path, token)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return token, nil
+}
+
+func (f DirFence) Current(ctx context.Context, logID storage.LogID) (uint64, error) {
+	return f.read(f.path(logID))
+}
+
+func (f DirFence) Fenced(
+	ctx context.Context, logID storage.LogID, token uint64, write func(context.Context) error,
+) error {
+	return f.locked(ctx, logID, func(path string) error {
+		current, err := f.read(path)
+		if err != nil {
+			return err
+		}
+		if current != token {
+			return &FencedError{LogID: logID, Token: token, Current: current}
+		}
+		return write(ctx)
+	})
+}
+
+// locked calls fn, with the token file of the log, under the lock of the log
+func (f DirFence) locked(ctx context.Context, logID storage.LogID, fn func(path string) error) error {
+	path := f.path(logID)
+	lock, err := AcquireFileLock(ctx, path+".lock")
+	if err != nil {
+		return err
+	}
+	err = fn(path)
+	if rerr := lock.Release(); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// path returns the token file of the log
+func (f DirFence) path(logID storage.LogID) string {
+	return filepath.Join(f.Dir, "fence-"+hex.EncodeToString(logID))
+}
+
+// read returns the token in the file, 0 if it does not exist
+func (f DirFence) read(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	token, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("fence %s: %w", path, err)
+	}
+	return token, nil
+}
+
+// write replaces the token file, durably. A token lost to a crash could be
+// issued again, to a second builder.
+func (f DirFence) write(path string, token uint64) error {
+	tmp, err := os.CreateTemp(f.Dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.WriteString(strconv.FormatUint(token, 10) + "\n")
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return syncDir(f.Dir)
+}
@@ -0,0 +1,135 @@
+package massifs
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFencedWriter(t *testing.T) {
+	ctx := context.Background()
+	logID := storage.LogID{15: 1}
+	store := newMemStore(nil, nil)
+	var fence MemoryFence
+
+	appendLeaf := func(w ObjectReaderWriter, id uint64) error {
+		mc, err := GetAppendContext(ctx, w, 1, 3)
+		require.NoError(t, err)
+		// memStore shares its data with the contexts it returns, a refused
+		// commit must not leave the append in the store
+		mc = mc.Writable()
+		leaf := sha256.Sum256([]byte{byte(id)})
+		_, err = mc.AddHashedLeaf(sha256.New(), id, nil, nil, nil, leaf[:])
+		require.NoError(t, err)
+		return CommitContext(ctx, w, &mc)
+	}
+
+	stale, token, err := NewFencedStore(ctx, store, &fence, logID)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), token)
+	require.NoError(t, appendLeaf(stale, 1))
+
+	// a second builder for the log fences the first
+	current, token, err := NewFencedStore(ctx, store, &fence, logID)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), token)
+
+	err = appendLeaf(stale, 2)
+	require.ErrorIs(t, err, ErrFenced)
+	var fenced *FencedError
+	require.True(t, errors.As(err, &fenced))
+	require.Equal(t, uint64(1), fenced.Token)
+	require.Equal(t, uint64(2), fenced.Current)
+
+	require.NoError(t, appendLeaf(current, 2))
+	mc, err := GetMassifContext(ctx, store, 0)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), mc.MassifLeafCount())
+
+	// the fence of another log is independent
+	_, token, err = NewFencedStore(ctx, store, &fence, storage.LogID{15: 2})
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), token)
+}
+
+func TestDirFence(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	logID := storage.LogID{15: 1}
+
+	writer, err := NewDirWriter(t.TempDir())
+	require.NoError(t, err)
+	fenced, token, err := NewFencedWriter(ctx, writer, DirFence{Dir: dir}, logID)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), token)
+	_, ok := fenced.(ObjectAppender)
+	require.True(t, ok, "the fenced writer keeps in place appends")
+
+	// tokens persist across instances, as across restarts
+	token, err = DirFence{Dir: dir}.Acquire(ctx, logID)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), token)
+	require.ErrorIs(t, fenced.Put(ctx, 0, storage.ObjectMassifData, nil, false), ErrFenced)
+	require.ErrorIs(t, fenced.(ObjectAppender).AppendMassif(ctx, 0, MassifBase{}, nil), ErrFenced)
+
+	// a token is not issued while a fenced write is in flight
+	err = DirFence{Dir: dir}.Fenced(ctx, logID, token, func(ctx context.Context) error {
+		acquireCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		_, err := DirFence{Dir: dir}.Acquire(acquireCtx, logID)
+		require.ErrorIs(t, err, ErrLocked)
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestGCSFence(t *testing.T) {
+	ctx := context.Background()
+	logID := storage.LogID{15: 1}
+	server := httptest.NewServer(&fakeGCS{objects: map[string]fakeGCSObject{}})
+	defer server.Close()
+	newFence := func() *GCSFence {
+		f, err := NewGCSFence("bucket")
+		require.NoError(t, err)
+		f.Endpoint = server.URL
+		f.LeaseDuration = time.Minute
+		return f
+	}
+
+	fence := newFence()
+	token, err := fence.Acquire(ctx, logID)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), token)
+
+	// a builder can not acquire the log while a fenced write is in flight
+	written := false
+	err = fence.Fenced(ctx, logID, token, func(ctx context.Context) error {
+		acquireCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		_, err := newFence().Acquire(acquireCtx, logID)
+		require.ErrorIs(t, err, ErrLocked)
+		written = true
+		return nil
+	})
+	require.NoError(t, err)
+	require.True(t, written)
+
+	// once the write is done it can, and the writer is fenced
+	token, err = newFence().Acquire(ctx, logID)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), token)
+	err = fence.Fenced(ctx, logID, 1, func(ctx context.Context) error {
+		t.Fatal("a fenced writer wrote")
+		return nil
+	})
+	require.ErrorIs(t, err, ErrFenced)
+	current, err := fence.Current(ctx, logID)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), current)
+}
@@ -0,0 +1,106 @@
+package massifs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"time"
+)
+
+var ErrLocked = errors.New("the lock is held by another writer")
+
+// errLockHeld is returned by tryLockFile when another file holds the lock
+var errLockHeld = errors.New("lock held")
+
+const lockRetryInterval = 50 * time.Millisecond
+
+// FileLock is an advisory, cross process, lock on a lock file. It is taken
+// with flock on unix and LockFileEx on windows, so it is held by the open
+// file rather than by the existence of the file. The kernel releases it when
+// the file is closed, including when the holder dies, so an abandoned lock
+// never needs to be detected and broken. Only cooperating writers (which use
+// FileLock) are excluded.
+//
+// Release removes the lock file while it is still locked. A writer which
+// opened the file before it was removed then locks a file no longer at the
+// path, so after locking it checks the file is still the one at the path, and
+// if not starts again.
+type FileLock struct {
+	path string
+	f    *os.File
+}
+
+// AcquireFileLock blocks until the lock at path is acquired, ctx is done, or
+// an unexpected file system error occurs.
+func AcquireFileLock(ctx context.Context, path string) (*FileLock, error) {
+	for {
+		f, err := lockFileAt(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		if f == nil {
+			// the lock file was released and removed while we waited
+			continue
+		}
+
+		// The content is informational only, it helps an operator looking
+		// for the holder of a lock.
+		holder := strconv.Itoa(os.Getpid()) + " " + time.Now().UTC().Format(time.RFC3339) + "\n"
+		if err = f.Truncate(0); err == nil {
+			_, err = f.WriteAt([]byte(holder), 0)
+		}
+		if err != nil {
+			return nil, errors.Join(err, unlockFile(f), f.Close())
+		}
+		return &FileLock{path: path, f: f}, nil
+	}
+}
+
+// lockFileAt opens and locks the file at path. It returns nil, and no error,
+// if the file locked is no longer the one at path.
+func lockFileAt(ctx context.Context, path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		err = tryLockFile(f)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, errLockHeld) {
+			_ = f.Close()
+			return nil, fmt.Errorf("lock %s: %w", path, err)
+		}
+		select {
+		case <-ctx.Done():
+			_ = f.Close()
+			return nil, fmt.Errorf("%w: %s: %v", ErrLocked, path, ctx.Err())
+		case <-time.After(lockRetryInterval):
+		}
+	}
+	locked, err := f.Stat()
+	if err != nil {
+		return nil, errors.Join(err, unlockFile(f), f.Close())
+	}
+	current, err := os.Stat(path)
+	if err == nil && os.SameFile(locked, current) {
+		return f, nil
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, errors.Join(err, unlockFile(f), f.Close())
+	}
+	return nil, errors.Join(unlockFile(f), f.Close())
+}
+
+// Release removes the lock file and releases the lock
+func (l *FileLock) Release() error {
+	// The file is removed before it is unlocked, so no writer can lock it
+	// and then find it was removed under it. A platform which can not remove
+	// an open file leaves it, which is harmless.
+	_ = os.Remove(l.path)
+	return errors.Join(unlockFile(l.f), l.f.Close())
+}
@@ -0,0 +1,18 @@
+//go:build !unix && !windows
+
+package massifs
+
+import (
+	"errors"
+	"os"
+)
+
+var errFileLockUnsupported = errors.New("file locks are not supported on this platform")
+
+func tryLockFile(f *os.File) error {
+	return errFileLockUnsupported
+}
+
+func unlockFile(f *os.File) error {
+	return errFileLockUnsupported
+}
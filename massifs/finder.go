@@ -0,0 +1,171 @@
+package massifs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/forestrie/go-merklelog/urkle"
+)
+
+// ErrIDTimestampNotFound is returned by Finder.Find when no leaf has the
+// idtimestamp.
+var ErrIDTimestampNotFound = errors.New("no leaf has the idtimestamp")
+
+// FoundLeaf is the location of a leaf found by its idtimestamp
+type FoundLeaf struct {
+	MassifIndex uint32
+	LeafIndex   uint64
+	MMRIndex    uint64
+}
+
+// Finder locates leaves by idtimestamp across the massifs of a log, without
+// scanning them. It is safe for concurrent use.
+//
+// The idtimestamps of a log increase with the leaves, so the massif is found
+// by a binary search of the massif start headers, on their last id, and the
+// leaf by a binary search of the massif's Urkle leaf table. Only the start
+// header and the index regions of a massif are read, never its log data. The
+// last ids of complete massifs never change, so the finder remembers them and
+// repeated lookups read only the headers they have not seen.
+//
+// The bloom filters index leaf values, not idtimestamps, so they can not
+// shortlist massifs here, the last ids do that exactly. Only massifs in the
+// current format can be searched.
+type Finder struct {
+	reader ObjectReader
+
+	mu sync.Mutex
+	// lastIDs are the last ids of the complete massifs read so far, by
+	// massif index
+	lastIDs map[uint32]uint64
+}
+
+// NewFinder returns a finder for the log the reader identifies, as for
+// GetMassifContext
+func NewFinder(reader ObjectReader) *Finder {
+	return &Finder{reader: reader, lastIDs: map[uint32]uint64{}}
+}
+
+// Find returns the location of the leaf whose idtimestamp is idTimestamp, or
+// ErrIDTimestampNotFound if there is none.
+func (f *Finder) Find(ctx context.Context, idTimestamp uint64) (FoundLeaf, error) {
+	head, err := f.reader.HeadIndex(ctx, storage.ObjectMassifData)
+	if err != nil {
+		return FoundLeaf{}, err
+	}
+	massifCount, err := ReadLen(uint64(head) + 1)
+	if err != nil {
+		return FoundLeaf{}, err
+	}
+
+	// The first massif whose last id is at or after idTimestamp is the only
+	// one which can hold it
+	var searchErr error
+	i := sort.Search(massifCount, func(i int) bool {
+		if searchErr != nil {
+			return true
+		}
+		lastID, err := f.lastID(ctx, uint32(i), head)
+		if err != nil {
+			searchErr = err
+			return true
+		}
+		return lastID >= idTimestamp
+	})
+	if searchErr != nil {
+		return FoundLeaf{}, searchErr
+	}
+	if i == massifCount {
+		return FoundLeaf{}, fmt.Errorf("%w: %d is after the last leaf", ErrIDTimestampNotFound, idTimestamp)
+	}
+	return f.findInMassif(ctx, uint32(i), idTimestamp)
+}
+
+// lastID returns the last id of the massif. Only the head massif's can
+// change, so the others are remembered.
+func (f *Finder) lastID(ctx context.Context, massifIndex uint32, head uint32) (uint64, error) {
+	f.mu.Lock()
+	lastID, ok := f.lastIDs[massifIndex]
+	f.mu.Unlock()
+	if ok {
+		return lastID, nil
+	}
+
+	header, err := f.reader.MassifReadN(ctx, massifIndex, StartHeaderEnd)
+	if err != nil {
+		return 0, err
+	}
+	if len(header) < StartHeaderEnd {
+		return 0, fmt.Errorf("%w: massif %d start header incomplete", ErrMassifDataLengthInvalid, massifIndex)
+	}
+	lastID = MakeMassifStart(header).LastID
+	if massifIndex < head {
+		f.mu.Lock()
+		f.lastIDs[massifIndex] = lastID
+		f.mu.Unlock()
+	}
+	return lastID, nil
+}
+
+// findInMassif searches the Urkle leaf table of the massif for idTimestamp,
+// reading only the massif's header and index.
+func (f *Finder) findInMassif(ctx context.Context, massifIndex uint32, idTimestamp uint64) (FoundLeaf, error) {
+	header, err := f.reader.MassifReadN(ctx, massifIndex, StartHeaderEnd)
+	if err != nil {
+		return FoundLeaf{}, err
+	}
+	if len(header) < StartHeaderEnd {
+		return FoundLeaf{}, fmt.Errorf("%w: massif %d start header incomplete", ErrMassifDataLengthInvalid, massifIndex)
+	}
+	mc := MassifContext{Start: MakeMassifStart(header)}
+	if err = mc.requireV2Index(); err != nil {
+		return FoundLeaf{}, err
+	}
+	n, err := ReadLen(mc.IndexEnd())
+	if err != nil {
+		return FoundLeaf{}, err
+	}
+	if mc.Data, err = f.reader.MassifReadN(ctx, massifIndex, n); err != nil {
+		return FoundLeaf{}, err
+	}
+
+	// The frontier counts the leaves in the trie, the leaf table is
+	// preallocated for the massif's capacity
+	frontier, err := mc.UrkleFrontierRegion()
+	if err != nil {
+		return FoundLeaf{}, err
+	}
+	st, ok, err := urkle.DecodeFrontierV1(frontier)
+	if err != nil {
+		return FoundLeaf{}, err
+	}
+	if !ok {
+		return FoundLeaf{}, fmt.Errorf("%w: massif %d has no leaves", ErrIDTimestampNotFound, massifIndex)
+	}
+	leafTable, err := mc.UrkleLeafTableRegion()
+	if err != nil {
+		return FoundLeaf{}, err
+	}
+	leafCount, err := ReadLen(min(uint64(st.NextLeaf), mc.urkleLeafCountV2()))
+	if err != nil {
+		return FoundLeaf{}, err
+	}
+
+	ordinal := sort.Search(leafCount, func(i int) bool {
+		return urkle.LeafKey(leafTable, uint32(i)) >= idTimestamp
+	})
+	if ordinal == leafCount || urkle.LeafKey(leafTable, uint32(ordinal)) != idTimestamp {
+		return FoundLeaf{}, fmt.Errorf("%w: %d", ErrIDTimestampNotFound, idTimestamp)
+	}
+	leafIndex := mmr.LeafCount(mc.Start.FirstIndex) + uint64(ordinal)
+	return FoundLeaf{
+		MassifIndex: massifIndex,
+		LeafIndex:   leafIndex,
+		MMRIndex:    mmr.MMRIndex(leafIndex),
+	}, nil
+}
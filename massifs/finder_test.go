@@ -0,0 +1,40 @@
+package massifs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFinder(t *testing.T) {
+	ctx := context.Background()
+	// leaf i has idtimestamp i+1, massifs hold 4 leaves
+	store, _ := buildSealedLog(t, 3, 30)
+	reader := &countingReader{memStore: store}
+	finder := NewFinder(reader)
+
+	for leafIndex := range uint64(30) {
+		found, err := finder.Find(ctx, leafIndex+1)
+		require.NoError(t, err)
+		require.Equal(t, FoundLeaf{
+			MassifIndex: uint32(leafIndex / 4),
+			LeafIndex:   leafIndex,
+			MMRIndex:    mmr.MMRIndex(leafIndex),
+		}, found)
+	}
+
+	for _, idTimestamp := range []uint64{0, 31, 1000} {
+		_, err := finder.Find(ctx, idTimestamp)
+		require.ErrorIs(t, err, ErrIDTimestampNotFound)
+	}
+
+	// the last ids of the complete massifs are remembered, so only the
+	// massif holding the leaf is read
+	reader.massifReads.Store(0)
+	found, err := finder.Find(ctx, 5)
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), found.MassifIndex)
+	require.Equal(t, int32(2), reader.massifReads.Load())
+}
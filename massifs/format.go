@@ -0,0 +1,254 @@
+package massifs
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/forestrie/go-merklelog/bloom"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/forestrie/go-merklelog/urkle"
+)
+
+// The names of the regions described by MassifFormat, in the order they occur
+// in the massif data.
+const (
+	RegionStartHeader    = "start-header"
+	RegionUrkleRoot      = "urkle-root"
+	RegionStats          = "stats"
+	RegionReserved       = "reserved"
+	RegionIndexHeader    = "index-header"
+	RegionBloomBitsets   = "bloom-bitsets"
+	RegionUrkleFrontier  = "urkle-frontier"
+	RegionUrkleLeafTable = "urkle-leaf-table"
+	RegionUrkleNodeStore = "urkle-node-store"
+	RegionPeakStack      = "peak-stack"
+	RegionLog            = "log"
+)
+
+// FormatRegion is a contiguous byte range of the massif data.
+type FormatRegion struct {
+	Name   string
+	Offset uint64
+	Size   uint64
+}
+
+// End returns the offset of the first byte after the region
+func (r FormatRegion) End() uint64 {
+	return r.Offset + r.Size
+}
+
+// MassifFormat describes the layout of a massif. It is computed from the
+// start header alone, so implementations in other languages can check their
+// offsets against it rather than derive them from this code.
+type MassifFormat struct {
+	Version      uint16
+	MassifHeight uint8
+	MassifIndex  uint32
+	// FirstIndex is the mmr index of the first node in the log region
+	FirstIndex uint64
+	// LeafCapacity is the number of leaves the massif holds once complete
+	LeafCapacity uint64
+	// NodeCapacity is the number of log nodes the massif holds once complete,
+	// including the nodes which bury the peaks of earlier massifs.
+	NodeCapacity uint64
+	// Regions cover the massif data, without gaps, in order. The log region
+	// is sized for a complete massif.
+	Regions []FormatRegion
+}
+
+// Region returns the region with the name, and false if the format has none.
+func (f MassifFormat) Region(name string) (FormatRegion, bool) {
+	for _, r := range f.Regions {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return FormatRegion{}, false
+}
+
+// Size returns the byte size of the massif once complete
+func (f MassifFormat) Size() uint64 {
+	if len(f.Regions) == 0 {
+		return 0
+	}
+	return f.Regions[len(f.Regions)-1].End()
+}
+
+// Format returns the layout of the massif described by the start header.
+// Versions 0, 1 and 2 are supported. Version 0 and 1 massifs have no index
+// data, the 32 byte index header is present but unused.
+func (ms MassifStart) Format() (MassifFormat, error) {
+	if ms.Version > MassifCurrentVersion {
+		return MassifFormat{}, fmt.Errorf("unsupported massif version %d", ms.Version)
+	}
+	if ms.MassifHeight == 0 || ms.MassifHeight > MaxMMRHeight {
+		return MassifFormat{}, fmt.Errorf("%w: massif height %d", ErrOffsetOverflow, ms.MassifHeight)
+	}
+
+	f := MassifFormat{
+		Version:      ms.Version,
+		MassifHeight: ms.MassifHeight,
+		MassifIndex:  ms.MassifIndex,
+		FirstIndex:   ms.FirstIndex,
+		LeafCapacity: (mmr.HeightSize(uint64(ms.MassifHeight)) + 1) >> 1,
+		NodeCapacity: massifMaxMMRSize(ms) - ms.FirstIndex,
+	}
+	offset := uint64(0)
+	add := func(name string, size uint64) {
+		f.Regions = append(f.Regions, FormatRegion{Name: name, Offset: offset, Size: size})
+		offset += size
+	}
+
+	add(RegionStartHeader, ValueBytes)
+	if ms.Version == MassifCurrentVersion {
+		add(RegionUrkleRoot, ValueBytes)
+		add(RegionStats, ValueBytes)
+		add(RegionReserved, StartHeaderSize-3*ValueBytes)
+	} else {
+		add(RegionReserved, StartHeaderSize-ValueBytes)
+	}
+	add(RegionIndexHeader, IndexHeaderBytes)
+
+	peakStackLen := uint64(MaxMMRHeight)
+	switch ms.Version {
+	case 0:
+		peakStackLen = ms.PeakStackLen
+	case MassifCurrentVersion:
+		if err := CheckMassifHeightV2(ms.MassifHeight); err != nil {
+			return MassifFormat{}, err
+		}
+		leafCount := urkle.LeafCountForMassifHeight(ms.MassifHeight)
+		bloomRegionBytes, err := ms.bloomRegionBytes()
+		if err != nil {
+			return MassifFormat{}, err
+		}
+		// The bloom header is the index header
+		add(RegionBloomBitsets, bloomRegionBytes-bloom.HeaderBytesV1)
+		add(RegionUrkleFrontier, urkle.FrontierStateV1Bytes)
+		add(RegionUrkleLeafTable, urkle.LeafTableBytes(leafCount))
+		add(RegionUrkleNodeStore, urkle.NodeStoreBytes(leafCount))
+	}
+	add(RegionPeakStack, peakStackLen*ValueBytes)
+	add(RegionLog, f.NodeCapacity*ValueBytes)
+
+	return f, nil
+}
+
+// Format returns the layout of the massif, see MassifStart.Format
+func (mc MassifContext) Format() (MassifFormat, error) {
+	return mc.Start.Format()
+}
+
+// DumpHeader writes every field of the massif's headers to w, one per line:
+// the start header, the reserved header words, and for the current format the
+// bloom header. It is followed by the region layout returned by Format.
+func DumpHeader(w io.Writer, data []byte) error {
+	if len(data) < StartHeaderEnd+IndexHeaderBytes {
+		return fmt.Errorf("%w: %d bytes", ErrMassifDataLengthInvalid, len(data))
+	}
+	var ms MassifStart
+	if err := DecodeMassifStart(&ms, data[:StartHeaderEnd]); err != nil {
+		return err
+	}
+	mc := MassifContext{MassifData: MassifData{Data: data}, Start: ms}
+
+	var err error
+	line := func(name string, value any) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, "%-20s %v\n", name, value)
+		}
+	}
+
+	line("version", ms.Version)
+	line("commitment-epoch", ms.CommitmentEpoch)
+	line("massif-height", ms.MassifHeight)
+	line("massif-index", ms.MassifIndex)
+	line("first-index", ms.FirstIndex)
+	line("last-id", ms.LastID)
+	line("peak-stack-len", ms.PeakStackLen)
+
+	if ms.Version == MassifCurrentVersion {
+		root, ok, rerr := mc.UrkleRootHash()
+		if rerr != nil {
+			return rerr
+		}
+		line("urkle-root", dumpWord(root, ok))
+
+		stats, ok, serr := mc.Stats()
+		if serr != nil {
+			return serr
+		}
+		if ok {
+			line("stats.builder", stats.BuilderVersion)
+			line("stats.leaf-count", stats.LeafCount)
+			line("stats.min-id", stats.MinIDTimestamp)
+			line("stats.max-id", stats.MaxIDTimestamp)
+			line("stats.build-duration", stats.BuildDuration)
+		} else {
+			line("stats", "unset")
+		}
+		commitment, ok, cerr := mc.StoredIndexCommitment()
+		if cerr != nil {
+			return cerr
+		}
+		line("index-commitment", dumpWord(commitment, ok))
+		length, ok, lerr := mc.CommittedLength()
+		if lerr != nil {
+			return lerr
+		}
+		if ok {
+			line("committed-length", length)
+		} else {
+			line("committed-length", "unset")
+		}
+		line("integrity", mc.HasIntegrity())
+
+		region := data[TrieHeaderStart():TrieHeaderEnd()]
+		if bloom.IsV2(region) {
+			h, _, berr := bloom.DecodeHeaderV2(region)
+			if berr != nil {
+				return berr
+			}
+			line("bloom.version", bloom.VersionV2)
+			line("bloom.bit-order", h.BitOrder)
+			line("bloom.k", h.K)
+			line("bloom.filters", h.Filters)
+			line("bloom.bits-per-elem", h.BitsPerElement)
+			line("bloom.m-bits", h.MBits)
+			line("bloom.n-inserted", h.NInserted)
+		} else {
+			h, ok, berr := bloom.DecodeHeaderV1(region)
+			if berr != nil {
+				return berr
+			}
+			if ok {
+				line("bloom.bit-order", h.BitOrder)
+				line("bloom.k", h.K)
+				line("bloom.m-bits", h.MBits)
+				line("bloom.n-inserted", h.NInserted)
+			} else {
+				line("bloom", "unset")
+			}
+		}
+	}
+
+	f, ferr := ms.Format()
+	if ferr != nil {
+		return ferr
+	}
+	line("leaf-capacity", f.LeafCapacity)
+	line("node-capacity", f.NodeCapacity)
+	line("log-nodes", mc.Count())
+	for _, r := range f.Regions {
+		line("region."+r.Name, fmt.Sprintf("offset=%d size=%d", r.Offset, r.Size))
+	}
+	return err
+}
+
+func dumpWord(word []byte, ok bool) string {
+	if !ok {
+		return "unset"
+	}
+	return hex.EncodeToString(word)
+}
@@ -0,0 +1,103 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMassifFormat(t *testing.T) {
+	ctx := context.Background()
+	// massifs 0 and 1 are complete
+	store, _ := buildSealedLog(t, 3, 11)
+
+	for massifIndex := range uint32(3) {
+		mc, err := GetMassifContext(ctx, store, massifIndex)
+		require.NoError(t, err)
+		f, err := mc.Format()
+		require.NoError(t, err)
+
+		offset := uint64(0)
+		for _, r := range f.Regions {
+			require.Equal(t, offset, r.Offset, r.Name)
+			offset = r.End()
+		}
+
+		bloomRegion, err := mc.BloomRegion()
+		require.NoError(t, err)
+		frontier, err := mc.UrkleFrontierRegion()
+		require.NoError(t, err)
+		leafTable, err := mc.UrkleLeafTableRegion()
+		require.NoError(t, err)
+		nodeStore, err := mc.UrkleNodeStoreRegion()
+		require.NoError(t, err)
+		for name, size := range map[string]int{
+			RegionBloomBitsets:   len(bloomRegion) - IndexHeaderBytes,
+			RegionUrkleFrontier:  len(frontier),
+			RegionUrkleLeafTable: len(leafTable),
+			RegionUrkleNodeStore: len(nodeStore),
+		} {
+			r, ok := f.Region(name)
+			require.True(t, ok)
+			require.Equal(t, uint64(size), r.Size, name)
+		}
+
+		r, ok := f.Region(RegionIndexHeader)
+		require.True(t, ok)
+		require.Equal(t, mc.IndexHeaderStart(), r.Offset)
+		r, ok = f.Region(RegionPeakStack)
+		require.True(t, ok)
+		require.Equal(t, mc.PeakStackStart(), r.Offset)
+		r, ok = f.Region(RegionLog)
+		require.True(t, ok)
+		require.Equal(t, mc.LogStart(), r.Offset)
+		require.Equal(t, uint64(4), f.LeafCapacity)
+
+		if massifIndex < 2 {
+			require.Equal(t, uint64(len(mc.Data)), f.Size())
+			require.Equal(t, mc.Count(), f.NodeCapacity)
+		}
+	}
+}
+
+func TestMassifFormatLegacy(t *testing.T) {
+	for _, version := range []uint16{0, 1} {
+		mc := buildLegacyBlobMassif0(t, version, 3, 2)
+		f, err := mc.Format()
+		require.NoError(t, err)
+		_, ok := f.Region(RegionBloomBitsets)
+		require.False(t, ok)
+		r, ok := f.Region(RegionLog)
+		require.True(t, ok)
+		require.Equal(t, mc.LogStart(), r.Offset)
+	}
+
+	_, err := MassifStart{Version: MassifCurrentVersion + 1, MassifHeight: 3}.Format()
+	require.Error(t, err)
+	_, err = MassifStart{Version: MassifCurrentVersion}.Format()
+	require.Error(t, err)
+}
+
+func TestDumpHeader(t *testing.T) {
+	ctx := context.Background()
+	store, _ := buildSealedLog(t, 3, 6)
+	mc, err := GetMassifContext(ctx, store, 1)
+	require.NoError(t, err)
+
+	var b bytes.Buffer
+	require.NoError(t, DumpHeader(&b, mc.Data))
+	out := b.String()
+	for _, want := range []string{
+		"version              2\n",
+		"massif-index         1\n",
+		"last-id              6\n",
+		"bloom.n-inserted     2\n",
+		"region.log           offset=",
+	} {
+		require.Contains(t, out, want)
+	}
+
+	require.ErrorIs(t, DumpHeader(&b, mc.Data[:StartHeaderEnd]), ErrMassifDataLengthInvalid)
+}
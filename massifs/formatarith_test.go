@@ -0,0 +1,85 @@
+package massifs
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestTallMassifOffsets checks the format arithmetic for massifs whose data
+// exceeds 4GiB. The data is never allocated, only the offsets are computed.
+func TestTallMassifOffsets(t *testing.T) {
+	for _, height := range []uint8{27, 28, MaxMassifHeightV2} {
+		mc := MassifContext{Start: MassifStart{Version: MassifCurrentVersion, MassifHeight: height}}
+
+		require.NotZero(t, mc.IndexSize(), "height %d", height)
+		require.Greater(t, mc.IndexEnd(), mc.IndexStart())
+		require.Equal(t, mc.IndexEnd()+ValueBytes*MaxMMRHeight, mc.LogStart())
+
+		// the end of a complete massif, which must not wrap
+		end := mc.LogStart() + TreeCount(height)*LogEntryBytes
+		require.Greater(t, end, mc.LogStart())
+		require.Greater(t, end, uint64(math.MaxUint32), "height %d", height)
+		require.Equal(t, TreeCount(height), (end-mc.LogStart())/LogEntryBytes)
+	}
+
+	require.ErrorIs(t, CheckMassifHeightV2(MaxMassifHeightV2+1), ErrOffsetOverflow)
+	require.ErrorIs(t, CheckMassifHeightV2(0), ErrOffsetOverflow)
+	_, err := CreateFirstMassifContext(context.Background(), 1, MaxMassifHeightV2+1)
+	require.ErrorIs(t, err, ErrOffsetOverflow)
+}
+
+func TestMassifContextOffsetGuards(t *testing.T) {
+	mc := MassifContext{Start: MassifStart{Version: MassifCurrentVersion, MassifHeight: 3}}
+	mc.Data = make([]byte, mc.LogStart()+2*LogEntryBytes)
+	require.Equal(t, uint64(2), mc.Count())
+
+	// data ending before the log start has no entries, not ~2^59
+	short := mc
+	short.Data = mc.Data[:StartHeaderEnd]
+	require.Zero(t, short.Count())
+	_, err := short.Get(0)
+	require.ErrorIs(t, err, ErrIndexNotInMassif)
+
+	_, err = mc.Get(1)
+	require.NoError(t, err)
+	for _, i := range []uint64{2, 1 << 59, math.MaxUint64} {
+		// (i * LogEntryBytes) wraps for the largest of these
+		_, err = mc.Get(i)
+		require.ErrorIs(t, err, ErrIndexNotInMassif, "index %d", i)
+	}
+
+	_, err = mc.GetStackedPeak(-1)
+	require.ErrorIs(t, err, ErrAncestorStackInvalid)
+	_, err = mc.GetStackedPeak(MaxMMRHeight)
+	require.ErrorIs(t, err, ErrAncestorStackInvalid)
+
+	corrupt := mc
+	corrupt.Start.PeakStackLen = 1 << 59
+	_, err = corrupt.GetAncestorPeakStack()
+	require.ErrorIs(t, err, ErrAncestorStackInvalid)
+
+	truncated := mc
+	truncated.Start.PeakStackLen = 2
+	truncated.Data = mc.Data[:mc.PeakStackStart()+ValueBytes]
+	_, err = truncated.GetAncestorPeakStack()
+	require.ErrorIs(t, err, ErrAncestorStackInvalid)
+}
+
+func TestReadLen(t *testing.T) {
+	n, err := ReadLen(StartHeaderEnd)
+	require.NoError(t, err)
+	require.Equal(t, StartHeaderEnd, n)
+
+	_, err = ReadLen(uint64(math.MaxInt) + 1)
+	require.ErrorIs(t, err, ErrOffsetOverflow)
+
+	if strconv.IntSize == 64 {
+		n, err = ReadLen(1<<32 + 1)
+		require.NoError(t, err)
+		require.Equal(t, uint64(1<<32+1), uint64(n))
+	}
+}
@@ -0,0 +1,235 @@
+package massifs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs/snowflakeid"
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/forestrie/go-merklelog/urkle"
+)
+
+type FreshnessOptions struct {
+	// MaxBuildLag is the longest the last entry of a log may be older than
+	// now, zero disables the check.
+	MaxBuildLag time.Duration
+	// MaxSealLag is the longest the last entry may be newer than the last
+	// sealed entry, zero disables the check.
+	MaxSealLag time.Duration
+	// Now is the current time, it defaults to time.Now()
+	Now time.Time
+}
+
+// Validate returns an error wrapping ErrInvalidOptions if a threshold is
+// negative.
+func (o *FreshnessOptions) Validate() error {
+	if o.MaxBuildLag < 0 || o.MaxSealLag < 0 {
+		return fmt.Errorf("%w: freshness lags %v, %v", ErrInvalidOptions, o.MaxBuildLag, o.MaxSealLag)
+	}
+	return nil
+}
+
+// WithMaxBuildLag flags logs whose last entry is older than lag
+func WithMaxBuildLag(lag time.Duration) Option {
+	return func(a any) {
+		if opts, ok := a.(*FreshnessOptions); ok {
+			opts.MaxBuildLag = lag
+		}
+	}
+}
+
+// WithMaxSealLag flags logs whose last entry is later than the last sealed
+// entry by more than lag.
+func WithMaxSealLag(lag time.Duration) Option {
+	return func(a any) {
+		if opts, ok := a.(*FreshnessOptions); ok {
+			opts.MaxSealLag = lag
+		}
+	}
+}
+
+// WithFreshnessNow sets the time the logs are checked at
+func WithFreshnessNow(now time.Time) Option {
+	return func(a any) {
+		if opts, ok := a.(*FreshnessOptions); ok {
+			opts.Now = now
+		}
+	}
+}
+
+// FreshnessSource is one of the logs checked by CheckFreshness
+type FreshnessSource struct {
+	LogID  storage.LogID
+	Reader ObjectReader
+}
+
+// LogFreshness is the outcome of CheckFreshness for one log. The times are
+// derived from idtimestamps, which are the times the entries were assigned
+// their ids, in the commitment epoch of their massif.
+type LogFreshness struct {
+	LogID storage.LogID
+
+	// LastEntry is the time of the last entry of the log
+	LastEntry time.Time
+	// LastSealed is the time of the last entry covered by the latest
+	// checkpoint, it is zero if the log has never been sealed.
+	LastSealed time.Time
+	// BuildLag is the time since the last entry
+	BuildLag time.Duration
+	// SealLag is the time from the last sealed entry to the last entry. If
+	// the log has never been sealed it is measured from the first entry.
+	SealLag time.Duration
+
+	BuildStale bool
+	SealStale  bool
+
+	// Err is set if the log could not be read, the other fields are then
+	// unset.
+	Err error
+}
+
+// Stale returns true if either threshold is exceeded, or the log could not
+// be checked.
+func (f LogFreshness) Stale() bool {
+	return f.BuildStale || f.SealStale || f.Err != nil
+}
+
+// CheckFreshness compares, for each log, the time of its last entry with the
+// current time, and with the time of the last entry covered by its latest
+// checkpoint, and flags the logs whose building or sealing lags by more than
+// the thresholds set by WithMaxBuildLag and WithMaxSealLag. The results are
+// in the order of the sources. A log which can not be read is reported with
+// Err set, it does not stop the others being checked.
+//
+// The checkpoints are not verified, this is for monitoring the services
+// which build and seal the logs. Only invalid options fail the check as a
+// whole.
+func CheckFreshness(ctx context.Context, sources []FreshnessSource, opts ...Option) ([]LogFreshness, error) {
+	options := FreshnessOptions{}
+	if err := ApplyOptions(&options, opts...); err != nil {
+		return nil, err
+	}
+	if options.Now.IsZero() {
+		options.Now = time.Now()
+	}
+
+	results := make([]LogFreshness, len(sources))
+	for i, source := range sources {
+		f, err := checkLogFreshness(ctx, source.Reader, options)
+		if err != nil {
+			f = LogFreshness{Err: err}
+		}
+		f.LogID = source.LogID
+		results[i] = f
+	}
+	return results, nil
+}
+
+func checkLogFreshness(ctx context.Context, reader ObjectReader, options FreshnessOptions) (LogFreshness, error) {
+	head, err := reader.HeadIndex(ctx, storage.ObjectMassifData)
+	if err != nil {
+		return LogFreshness{}, err
+	}
+	mc, err := GetMassifContext(ctx, reader, head)
+	if err != nil {
+		return LogFreshness{}, err
+	}
+	f := LogFreshness{}
+	if f.LastEntry, err = idTimestampTime(mc.Start.LastID, mc.Start.CommitmentEpoch); err != nil {
+		return LogFreshness{}, err
+	}
+
+	sealed, err := lastSealedIDTimestamp(ctx, reader)
+	if err != nil {
+		return LogFreshness{}, err
+	}
+	from, err := idTimestampTime(sealed.idTimestamp, sealed.epoch)
+	if err != nil {
+		return LogFreshness{}, err
+	}
+	if sealed.sealed {
+		f.LastSealed = from
+	}
+	f.SealLag = max(f.LastEntry.Sub(from), 0)
+	f.BuildLag = max(options.Now.Sub(f.LastEntry), 0)
+
+	f.BuildStale = options.MaxBuildLag > 0 && f.BuildLag > options.MaxBuildLag
+	f.SealStale = options.MaxSealLag > 0 && f.SealLag > options.MaxSealLag
+	return f, nil
+}
+
+type sealedIDTimestamp struct {
+	idTimestamp uint64
+	epoch       uint32
+	// sealed is false if the log has no checkpoint, the idtimestamp is then
+	// that of the first entry.
+	sealed bool
+}
+
+// lastSealedIDTimestamp returns the idtimestamp of the last leaf covered by
+// the latest checkpoint.
+func lastSealedIDTimestamp(ctx context.Context, reader ObjectReader) (sealedIDTimestamp, error) {
+	head, err := reader.HeadIndex(ctx, storage.ObjectCheckpoint)
+	if storage.IsNotFound(err) {
+		mc, err := GetMassifContext(ctx, reader, 0)
+		if err != nil {
+			return sealedIDTimestamp{}, err
+		}
+		id, err := leafIDTimestamp(&mc, 0)
+		return sealedIDTimestamp{idTimestamp: id, epoch: mc.Start.CommitmentEpoch}, err
+	}
+	if err != nil {
+		return sealedIDTimestamp{}, err
+	}
+	data, err := reader.CheckpointRead(ctx, head)
+	if err != nil {
+		return sealedIDTimestamp{}, err
+	}
+	check, err := NewCheckpoint(data)
+	if err != nil {
+		return sealedIDTimestamp{}, err
+	}
+	leafCount := mmr.LeafCount(check.MMRSize)
+	if leafCount == 0 {
+		return sealedIDTimestamp{}, fmt.Errorf("the checkpoint for massif %d covers no leaves", head)
+	}
+	mc, err := GetMassifContext(ctx, reader, head)
+	if err != nil {
+		return sealedIDTimestamp{}, err
+	}
+	id, err := leafIDTimestamp(&mc, leafCount-1)
+	return sealedIDTimestamp{idTimestamp: id, epoch: mc.Start.CommitmentEpoch, sealed: true}, err
+}
+
+// leafIDTimestamp returns the idtimestamp of the leaf, which must be in the
+// massif. The last leaf of the massif is in the start header, the others are
+// only found in the v2 index.
+func leafIDTimestamp(mc *MassifContext, leafIndex uint64) (uint64, error) {
+	firstLeaf := mmr.LeafCount(mc.Start.FirstIndex)
+	count := mc.MassifLeafCount()
+	if leafIndex < firstLeaf || leafIndex-firstLeaf >= count {
+		return 0, fmt.Errorf("%w: leaf %d is not in massif %d", ErrLeafRange, leafIndex, mc.Start.MassifIndex)
+	}
+	if leafIndex-firstLeaf == count-1 {
+		return mc.Start.LastID, nil
+	}
+	leafTable, err := mc.UrkleLeafTableRegion()
+	if err != nil {
+		return 0, err
+	}
+	return urkle.LeafKey(leafTable, uint32(leafIndex-firstLeaf)), nil
+}
+
+// idTimestampTime returns the wall clock time of the idtimestamp
+func idTimestampTime(id uint64, epoch uint32) (time.Time, error) {
+	if epoch > 255 {
+		return time.Time{}, fmt.Errorf("%w: %d", ErrEpochToLarge, epoch)
+	}
+	ms, err := snowflakeid.IDUnixMilli(id, uint8(epoch))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(ms).UTC(), nil
+}
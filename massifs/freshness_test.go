@@ -0,0 +1,99 @@
+package massifs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+// buildTimedLog adds a leaf a minute, from base, sealing the log after the
+// leaves in sealAfter.
+func buildTimedLog(t *testing.T, base time.Time, leafCount int, sealAfter ...int) *memStore {
+	t.Helper()
+	ctx := context.Background()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := cose.NewSigner(cose.AlgorithmES256, key)
+	require.NoError(t, err)
+
+	store := newMemStore(nil, nil)
+	for i := range leafCount {
+		mc, err := GetAppendContext(ctx, store, 1, 3)
+		require.NoError(t, err)
+		id, epoch := IDTimestampFromTime(base.Add(time.Duration(i) * time.Minute))
+		require.Equal(t, uint8(1), epoch)
+		leaf := sha256.Sum256(fmt.Appendf(nil, "timed-log-leaf-%d", i))
+		_, err = mc.AddHashedLeaf(sha256.New(), id, nil, nil, nil, leaf[:])
+		require.NoError(t, err)
+		require.NoError(t, CommitContext(ctx, store, &mc))
+		for _, sealed := range sealAfter {
+			if sealed == i {
+				store.checkpoint[mc.Start.MassifIndex] = signCheckpointV3WithSigner(t, &mc, signer, 0)
+			}
+		}
+	}
+	return store
+}
+
+func TestCheckFreshness(t *testing.T) {
+	ctx := context.Background()
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// the last sealed leaf, 5, is not the last of its massif
+	sealed := buildTimedLog(t, base, 11, 3, 5)
+	unsealed := buildTimedLog(t, base, 3)
+	sources := []FreshnessSource{
+		{LogID: storage.LogID("sealed"), Reader: sealed},
+		{LogID: storage.LogID("unsealed"), Reader: unsealed},
+		{LogID: storage.LogID("empty"), Reader: newMemStore(nil, nil)},
+	}
+
+	results, err := CheckFreshness(ctx, sources,
+		WithFreshnessNow(base.Add(12*time.Minute)),
+		WithMaxBuildLag(3*time.Minute), WithMaxSealLag(4*time.Minute))
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+
+	f := results[0]
+	require.NoError(t, f.Err)
+	require.Equal(t, storage.LogID("sealed"), f.LogID)
+	require.Equal(t, base.Add(10*time.Minute), f.LastEntry)
+	require.Equal(t, base.Add(5*time.Minute), f.LastSealed)
+	require.Equal(t, 2*time.Minute, f.BuildLag)
+	require.Equal(t, 5*time.Minute, f.SealLag)
+	require.False(t, f.BuildStale)
+	require.True(t, f.SealStale)
+	require.True(t, f.Stale())
+
+	// a log which was never sealed lags from its first entry
+	f = results[1]
+	require.NoError(t, f.Err)
+	require.True(t, f.LastSealed.IsZero())
+	require.Equal(t, 2*time.Minute, f.SealLag)
+	require.Equal(t, 10*time.Minute, f.BuildLag)
+	require.True(t, f.BuildStale)
+	require.False(t, f.SealStale)
+
+	f = results[2]
+	require.True(t, storage.IsNotFound(f.Err), "%v", f.Err)
+	require.True(t, f.Stale())
+
+	// with no thresholds nothing is flagged
+	results, err = CheckFreshness(ctx, sources[:2], WithFreshnessNow(base.Add(time.Hour)))
+	require.NoError(t, err)
+	for _, f := range results {
+		require.False(t, f.Stale())
+	}
+
+	_, err = CheckFreshness(ctx, sources, WithMaxSealLag(-time.Minute))
+	require.ErrorIs(t, err, ErrInvalidOptions)
+}
@@ -0,0 +1,248 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+)
+
+// DefaultFenceLeaseDuration is the GCSFence lease taken for each fenced write
+const DefaultFenceLeaseDuration = 30 * time.Second
+
+// errLeaseConflict is returned by GCSFence.put when the lease object was
+// updated since it was read
+var errLeaseConflict = errors.New("the lease was updated concurrently")
+
+// gcsLease is the content of the lease object of a log
+type gcsLease struct {
+	Token uint64 `json:"token"`
+	// Writing is set while a write of Token is in flight, until Until
+	Writing bool      `json:"writing,omitempty"`
+	Until   time.Time `json:"until,omitzero"`
+}
+
+// GCSFence is a FenceStore keeping the token of each log in a lease object
+// of a Google Cloud Storage bucket, for builders which write to cloud
+// storage. Every update of the lease object is conditional on the generation
+// read, so two builders can not both acquire the same token.
+//
+// A store can not make a write conditional on another object, so the
+// fenced write is bound to the token with a lease: Fenced records the write
+// in the lease object, conditional on the token still being current, and
+// Acquire waits for the lease to be released, or to expire, before it issues
+// the next token. The write is cancelled after half of LeaseDuration, the
+// other half allows for requests in flight and for the clocks of the
+// builders to differ.
+type GCSFence struct {
+	Bucket string
+	// Endpoint is the JSON API endpoint, DefaultGCSEndpoint unless set
+	Endpoint string
+	// Prefix is prepended to the lease object names, which are otherwise
+	// those of the DirFence token files.
+	Prefix string
+	// LeaseDuration bounds each fenced write, DefaultFenceLeaseDuration
+	// unless set.
+	LeaseDuration time.Duration
+
+	client *http.Client
+}
+
+// NewGCSFence returns a fence keeping its lease objects in bucket. The
+// option honoured is WithHTTPClient.
+func NewGCSFence(bucket string, opts ...Option) (*GCSFence, error) {
+	options := StorageOptions{}
+	if err := ApplyOptions(&options, opts...); err != nil {
+		return nil, err
+	}
+	if bucket == "" {
+		return nil, fmt.Errorf("%w: a bucket is required", ErrInvalidOptions)
+	}
+	f := &GCSFence{
+		Bucket:        bucket,
+		Endpoint:      DefaultGCSEndpoint,
+		LeaseDuration: DefaultFenceLeaseDuration,
+		client:        options.HTTPClient,
+	}
+	if f.client == nil {
+		f.client = http.DefaultClient
+	}
+	return f, nil
+}
+
+func (f *GCSFence) Acquire(ctx context.Context, logID storage.LogID) (uint64, error) {
+	for {
+		lease, generation, err := f.get(ctx, logID)
+		if err != nil {
+			return 0, err
+		}
+		if wait := time.Until(lease.Until); lease.Writing && wait > 0 {
+			// a write of the current token may still be made
+			select {
+			case <-ctx.Done():
+				return 0, fmt.Errorf("%w: fence %s: %v", ErrLocked, f.name(logID), ctx.Err())
+			case <-time.After(wait):
+			}
+			continue
+		}
+		next := gcsLease{Token: lease.Token + 1}
+		_, err = f.put(ctx, logID, next, generation)
+		if errors.Is(err, errLeaseConflict) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		return next.Token, nil
+	}
+}
+
+func (f *GCSFence) Current(ctx context.Context, logID storage.LogID) (uint64, error) {
+	lease, _, err := f.get(ctx, logID)
+	if err != nil {
+		return 0, err
+	}
+	return lease.Token, nil
+}
+
+func (f *GCSFence) Fenced(
+	ctx context.Context, logID storage.LogID, token uint64, write func(context.Context) error,
+) error {
+	duration := f.LeaseDuration
+	if duration <= 0 {
+		duration = DefaultFenceLeaseDuration
+	}
+	for {
+		lease, generation, err := f.get(ctx, logID)
+		if err != nil {
+			return err
+		}
+		if lease.Token != token {
+			return &FencedError{LogID: logID, Token: token, Current: lease.Token}
+		}
+		start := time.Now()
+		held, err := f.put(ctx, logID, gcsLease{Token: token, Writing: true, Until: start.Add(duration)}, generation)
+		if errors.Is(err, errLeaseConflict) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		writeCtx, cancel := context.WithDeadline(ctx, start.Add(duration/2))
+		err = write(writeCtx)
+		cancel()
+
+		// If the lease was taken again, by a concurrent write of the same
+		// builder, it is left to that write. Otherwise it would expire.
+		_, _ = f.put(context.WithoutCancel(ctx), logID, gcsLease{Token: token}, held)
+		return err
+	}
+}
+
+// name returns the lease object name of the log
+func (f *GCSFence) name(logID storage.LogID) string {
+	return f.Prefix + "fence-" + hex.EncodeToString(logID)
+}
+
+// get reads the lease of the log and its generation. A missing lease is the
+// zero lease, generation zero.
+func (f *GCSFence) get(ctx context.Context, logID storage.LogID) (gcsLease, int64, error) {
+	name := f.name(logID)
+	target := fmt.Sprintf("%s/storage/v1/b/%s/o/%s?alt=media",
+		strings.TrimSuffix(f.Endpoint, "/"), url.PathEscape(f.Bucket), url.PathEscape(name))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return gcsLease{}, 0, err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return gcsLease{}, 0, fmt.Errorf("%w: %v", ErrGCSRequest, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return gcsLease{}, 0, fmt.Errorf("%w: %v", ErrGCSRequest, err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return gcsLease{}, 0, nil
+	}
+	if err = f.statusError(resp, body, name); err != nil {
+		return gcsLease{}, 0, err
+	}
+	generation, err := strconv.ParseInt(resp.Header.Get(gcsGenerationHeader), 10, 64)
+	if err != nil {
+		return gcsLease{}, 0, fmt.Errorf("%w: fence %s has no generation", ErrGCSRequest, name)
+	}
+	var lease gcsLease
+	if err = json.Unmarshal(body, &lease); err != nil {
+		return gcsLease{}, 0, fmt.Errorf("fence %s: %w", name, err)
+	}
+	return lease, generation, nil
+}
+
+// put replaces the lease of the log if it is still at generation, and
+// returns the new generation. It returns errLeaseConflict if it is not.
+func (f *GCSFence) put(ctx context.Context, logID storage.LogID, lease gcsLease, generation int64) (int64, error) {
+	name := f.name(logID)
+	data, err := json.Marshal(lease)
+	if err != nil {
+		return 0, err
+	}
+	query := url.Values{
+		"uploadType": {"media"}, "name": {name}, "ifGenerationMatch": {strconv.FormatInt(generation, 10)},
+	}
+	target := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?%s",
+		strings.TrimSuffix(f.Endpoint, "/"), url.PathEscape(f.Bucket), query.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrGCSRequest, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrGCSRequest, err)
+	}
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		return 0, errLeaseConflict
+	}
+	if err = f.statusError(resp, body, name); err != nil {
+		return 0, err
+	}
+	var object struct {
+		Generation string `json:"generation"`
+	}
+	if err = json.Unmarshal(body, &object); err != nil {
+		return 0, fmt.Errorf("%w: the upload response: %v", ErrGCSRequest, err)
+	}
+	if generation, err = strconv.ParseInt(object.Generation, 10, 64); err != nil {
+		return 0, fmt.Errorf("%w: the upload response generation %q", ErrGCSRequest, object.Generation)
+	}
+	return generation, nil
+}
+
+// statusError is GCSStore.statusError for the lease objects
+func (f *GCSFence) statusError(resp *http.Response, body []byte, name string) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return fmt.Errorf("%w: fence %s: %s: %s", storage.ErrNotAvailable, name, resp.Status, bytes.TrimSpace(body))
+	}
+	return fmt.Errorf("%w: fence %s: %s: %s", ErrGCSRequest, name, resp.Status, bytes.TrimSpace(body))
+}
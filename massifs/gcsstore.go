@@ -0,0 +1,454 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+)
+
+// DefaultGCSEndpoint is the Google Cloud Storage JSON API endpoint
+const DefaultGCSEndpoint = "https://storage.googleapis.com"
+
+var ErrGCSRequest = errors.New("the google cloud storage request failed")
+
+// gcsGenerationHeader is the response header carrying the generation of the
+// object read
+const gcsGenerationHeader = "X-Goog-Generation"
+
+// gcsObjectKey identifies a stored object for the generation tracking
+type gcsObjectKey struct {
+	otype       storage.ObjectType
+	massifIndex uint32
+}
+
+// GCSStore is an ObjectReaderWriter over the objects of a log in a Google
+// Cloud Storage bucket, named by a PathScheme, so a VerifyingReplicator can
+// replicate into a bucket. It uses the JSON API directly, the client given by
+// WithHTTPClient is expected to authenticate the requests, typically with an
+// oauth2 transport.
+//
+// Every Put is conditional on the generation of the object, as last read or
+// written by the store. An object which was read as missing must still be
+// missing, and one which was read must not have been replaced since, so two
+// replicators, or sealers, racing to replace the same object can not both
+// succeed. The loser gets storage.ErrExistsOC or storage.ErrContentOC. An
+// object the store has not read is replaced unconditionally, unless the Put
+// is failIfExists.
+//
+// Objects GCS reports missing are storage.NotFoundError. Throttling and
+// server errors, which are expected to pass, wrap storage.ErrNotAvailable.
+//
+// Objects are cached for the life of the store, the head indices are listed
+// on every call. The store is not safe for concurrent use.
+type GCSStore struct {
+	Bucket string
+	// Endpoint is the JSON API endpoint, DefaultGCSEndpoint unless set, for
+	// example, to that of an emulator.
+	Endpoint string
+
+	client       *http.Client
+	scheme       storage.PathScheme
+	logID        storage.LogID
+	massifHeight uint8
+
+	massifs     map[uint32][]byte
+	checkpoints map[uint32][]byte
+	// generations are those of the objects last read or written, zero for
+	// those read as missing
+	generations map[gcsObjectKey]int64
+}
+
+// NewGCSStore returns a store for the log in bucket. The options honoured
+// are WithPathScheme, without which the objects are expected at the root of
+// the bucket, and WithHTTPClient.
+func NewGCSStore(bucket string, opts ...Option) (*GCSStore, error) {
+	options := StorageOptions{}
+	if err := ApplyOptions(&options, opts...); err != nil {
+		return nil, err
+	}
+	if bucket == "" {
+		return nil, fmt.Errorf("%w: a bucket is required", ErrInvalidOptions)
+	}
+	s := &GCSStore{
+		Bucket:       bucket,
+		Endpoint:     DefaultGCSEndpoint,
+		client:       options.HTTPClient,
+		scheme:       options.PathScheme,
+		logID:        options.LogID,
+		massifHeight: options.MassifHeight,
+		massifs:      map[uint32][]byte{},
+		checkpoints:  map[uint32][]byte{},
+		generations:  map[gcsObjectKey]int64{},
+	}
+	if s.client == nil {
+		s.client = http.DefaultClient
+	}
+	if s.scheme == nil {
+		s.scheme = storage.FlatPathScheme{}
+	}
+	return s, nil
+}
+
+// HeadIndex lists the objects of the type and returns the highest index
+func (s *GCSStore) HeadIndex(ctx context.Context, otype storage.ObjectType) (uint32, error) {
+	otype, err := listObjectType(otype)
+	if err != nil {
+		return 0, err
+	}
+	indices, err := s.list(ctx, otype)
+	if err != nil {
+		return 0, err
+	}
+	if len(indices) == 0 {
+		if otype == storage.ObjectCheckpoint {
+			return 0, storage.NewNotFoundError(s.logID, otype, storage.HeadMassifIndex)
+		}
+		return 0, storage.NewLogEmptyError(s.logID)
+	}
+	return indices[len(indices)-1], nil
+}
+
+// List lists the objects of the type in the bucket
+func (s *GCSStore) List(ctx context.Context, otype storage.ObjectType, fromIndex uint32, limit int) (ObjectPage, error) {
+	otype, err := listObjectType(otype)
+	if err != nil {
+		return ObjectPage{}, err
+	}
+	indices, err := s.list(ctx, otype)
+	if err != nil {
+		return ObjectPage{}, err
+	}
+	return pageIndices(indices, otype, fromIndex, limit), nil
+}
+
+func (s *GCSStore) MassifData(massifIndex uint32) ([]byte, bool, error) {
+	data, ok := s.massifs[massifIndex]
+	return data, ok, nil
+}
+
+func (s *GCSStore) CheckpointData(massifIndex uint32) ([]byte, bool, error) {
+	data, ok := s.checkpoints[massifIndex]
+	return data, ok, nil
+}
+
+func (s *GCSStore) MassifReadN(ctx context.Context, massifIndex uint32, n int) ([]byte, error) {
+	data, err := s.get(ctx, storage.ObjectMassifData, massifIndex)
+	if err != nil {
+		return nil, err
+	}
+	s.massifs[massifIndex] = data
+	if n >= 0 && n < len(data) {
+		return data[:n], nil
+	}
+	return data, nil
+}
+
+func (s *GCSStore) CheckpointRead(ctx context.Context, massifIndex uint32) ([]byte, error) {
+	data, err := s.get(ctx, storage.ObjectCheckpoint, massifIndex)
+	if err != nil {
+		return nil, err
+	}
+	s.checkpoints[massifIndex] = data
+	return data, nil
+}
+
+// LogID returns the log id the store was configured with
+func (s *GCSStore) LogID(ctx context.Context) (storage.LogID, error) {
+	if s.logID == nil {
+		return nil, storage.ErrLogIDRequired
+	}
+	return s.logID, nil
+}
+
+// Put uploads the object, conditional on its generation as described for
+// GCSStore. The cached massif and checkpoint data is updated, so the store
+// reads back what it wrote.
+func (s *GCSStore) Put(
+	ctx context.Context, massifIndex uint32, ty storage.ObjectType, data []byte, failIfExists bool,
+) error {
+	name, err := storage.SchemeObjectPath(s.scheme, s.logID, s.massifHeight, massifIndex, ty)
+	if err != nil {
+		return err
+	}
+	key := gcsObjectKey{otype: s.objectKeyType(ty), massifIndex: massifIndex}
+	query := url.Values{"uploadType": {"media"}, "name": {name}}
+	generation, known := s.generations[key]
+	if failIfExists {
+		generation, known = 0, true
+	}
+	if known {
+		query.Set("ifGenerationMatch", strconv.FormatInt(generation, 10))
+	}
+	target := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?%s",
+		strings.TrimSuffix(s.Endpoint, "/"), url.PathEscape(s.Bucket), query.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrGCSRequest, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrGCSRequest, err)
+	}
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		// the object is not the one the precondition was for, whatever it
+		// is now has to be read again
+		delete(s.generations, key)
+		if generation == 0 {
+			return fmt.Errorf("%w: %s", storage.ErrExistsOC, name)
+		}
+		return fmt.Errorf("%w: %s was replaced after generation %d", storage.ErrContentOC, name, generation)
+	}
+	if err = s.statusError(resp, body, ty, massifIndex); err != nil {
+		return err
+	}
+	var object struct {
+		Generation string `json:"generation"`
+	}
+	if err = json.Unmarshal(body, &object); err != nil {
+		return fmt.Errorf("%w: the upload response: %v", ErrGCSRequest, err)
+	}
+	if s.generations[key], err = strconv.ParseInt(object.Generation, 10, 64); err != nil {
+		delete(s.generations, key)
+		return fmt.Errorf("%w: the upload response generation %q", ErrGCSRequest, object.Generation)
+	}
+	switch key.otype {
+	case storage.ObjectMassifData:
+		s.massifs[massifIndex] = data
+	case storage.ObjectCheckpoint:
+		s.checkpoints[massifIndex] = data
+	}
+	return nil
+}
+
+// objectKeyType maps ObjectMassifStart to the massif data object it is read
+// from, so both share one generation.
+func (s *GCSStore) objectKeyType(otype storage.ObjectType) storage.ObjectType {
+	if otype == storage.ObjectMassifStart {
+		return storage.ObjectMassifData
+	}
+	return otype
+}
+
+// get reads an object and records its generation, a missing object is
+// reported as storage.NotFoundError and recorded as generation zero.
+func (s *GCSStore) get(ctx context.Context, otype storage.ObjectType, massifIndex uint32) ([]byte, error) {
+	name, err := storage.SchemeObjectPath(s.scheme, s.logID, s.massifHeight, massifIndex, otype)
+	if err != nil {
+		return nil, err
+	}
+	target := fmt.Sprintf("%s/storage/v1/b/%s/o/%s?alt=media",
+		strings.TrimSuffix(s.Endpoint, "/"), url.PathEscape(s.Bucket), url.PathEscape(name))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrGCSRequest, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrGCSRequest, err)
+	}
+	key := gcsObjectKey{otype: s.objectKeyType(otype), massifIndex: massifIndex}
+	if resp.StatusCode == http.StatusNotFound {
+		s.generations[key] = 0
+		return nil, storage.NewNotFoundError(s.logID, otype, massifIndex)
+	}
+	if err = s.statusError(resp, data, otype, massifIndex); err != nil {
+		return nil, err
+	}
+	generation, err := strconv.ParseInt(resp.Header.Get(gcsGenerationHeader), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v %d has no generation", ErrGCSRequest, otype, massifIndex)
+	}
+	s.generations[key] = generation
+	return data, nil
+}
+
+// MassifWindow reads only the pages of the massif used, with ranged reads,
+// see MassifWindowReader. Every read is of the generation the first read
+// found, so the window never mixes the data of a massif with that of its
+// replacement. The window does not use, or fill, the store's cache.
+func (s *GCSStore) MassifWindow(ctx context.Context, massifIndex uint32) (*MassifWindow, error) {
+	first, size, generation, err := s.getRange(ctx, massifIndex, 0, 0, MassifWindowPageBytes)
+	if err != nil {
+		return nil, err
+	}
+	return NewMassifWindow(&gcsRangeReader{
+		ctx: ctx, store: s, massifIndex: massifIndex, generation: generation, first: first,
+	}, size)
+}
+
+// gcsRangeReader is an io.ReaderAt over one generation of a massif object
+type gcsRangeReader struct {
+	ctx         context.Context
+	store       *GCSStore
+	massifIndex uint32
+	generation  int64
+	// first is the data read when the window was created
+	first []byte
+}
+
+func (r *gcsRangeReader) ReadAt(p []byte, off int64) (int, error) {
+	if off == 0 && len(p) <= len(r.first) {
+		return copy(p, r.first), nil
+	}
+	data, _, _, err := r.store.getRange(r.ctx, r.massifIndex, r.generation, uint64(off), uint64(len(p)))
+	if err != nil {
+		return 0, err
+	}
+	n := copy(p, data)
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// getRange reads up to n bytes of the massif at off, n must not be zero. A
+// non zero generation selects the generation read. It returns the data, the
+// size of the whole object and the generation read. Unlike get, the
+// generation is not recorded for the conditional writes.
+func (s *GCSStore) getRange(
+	ctx context.Context, massifIndex uint32, generation int64, off uint64, n uint64,
+) ([]byte, uint64, int64, error) {
+	otype := storage.ObjectMassifData
+	name, err := storage.SchemeObjectPath(s.scheme, s.logID, s.massifHeight, massifIndex, otype)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	query := url.Values{"alt": {"media"}}
+	if generation != 0 {
+		query.Set("generation", strconv.FormatInt(generation, 10))
+	}
+	target := fmt.Sprintf("%s/storage/v1/b/%s/o/%s?%s",
+		strings.TrimSuffix(s.Endpoint, "/"), url.PathEscape(s.Bucket), url.PathEscape(name), query.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+n-1))
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("%w: %v", ErrGCSRequest, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("%w: %v", ErrGCSRequest, err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, 0, 0, storage.NewNotFoundError(s.logID, otype, massifIndex)
+	}
+	if err = s.statusError(resp, data, otype, massifIndex); err != nil {
+		return nil, 0, 0, err
+	}
+	if generation, err = strconv.ParseInt(resp.Header.Get(gcsGenerationHeader), 10, 64); err != nil {
+		return nil, 0, 0, fmt.Errorf("%w: %v %d has no generation", ErrGCSRequest, otype, massifIndex)
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		// the range was ignored and the whole object returned
+		size := uint64(len(data))
+		return data[min(off, size):min(off+n, size)], size, generation, nil
+	}
+	var first, last, size uint64
+	if _, err = fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &first, &last, &size); err != nil {
+		return nil, 0, 0, fmt.Errorf("%w: %v %d content range %q",
+			ErrGCSRequest, otype, massifIndex, resp.Header.Get("Content-Range"))
+	}
+	return data, size, generation, nil
+}
+
+// list returns the ascending indices of the objects of otype. The objects of
+// other types sharing the prefix are skipped.
+func (s *GCSStore) list(ctx context.Context, otype storage.ObjectType) ([]uint32, error) {
+	prefix, err := s.scheme.ObjectPrefix(s.logID, s.massifHeight, otype)
+	if err != nil {
+		return nil, err
+	}
+	var indices []uint32
+	query := url.Values{"prefix": {prefix}, "fields": {"items(name),nextPageToken"}}
+	for {
+		target := fmt.Sprintf("%s/storage/v1/b/%s/o?%s",
+			strings.TrimSuffix(s.Endpoint, "/"), url.PathEscape(s.Bucket), query.Encode())
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrGCSRequest, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrGCSRequest, err)
+		}
+		if err = s.statusError(resp, body, otype, storage.HeadMassifIndex); err != nil {
+			return nil, err
+		}
+		var page struct {
+			Items []struct {
+				Name string `json:"name"`
+			} `json:"items"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		if err = json.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("%w: the list response: %v", ErrGCSRequest, err)
+		}
+		for _, item := range page.Items {
+			// objects directly under the prefix only, as a directory listing
+			rest := strings.TrimPrefix(item.Name, prefix)
+			if strings.Contains(rest, "/") {
+				continue
+			}
+			ty, massifIndex, err := storage.ObjectIndexFromPath(rest)
+			if err != nil || ty != otype {
+				continue
+			}
+			indices = append(indices, massifIndex)
+		}
+		if page.NextPageToken == "" {
+			break
+		}
+		query.Set("pageToken", page.NextPageToken)
+	}
+	// the names sort by index, but that is the scheme's business
+	slices.Sort(indices)
+	return indices, nil
+}
+
+// statusError returns nil for a successful response, otherwise an error
+// wrapping storage.ErrNotAvailable if the request may succeed if retried,
+// and ErrGCSRequest if not.
+func (s *GCSStore) statusError(resp *http.Response, body []byte, otype storage.ObjectType, massifIndex uint32) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	index := fmt.Sprint(massifIndex)
+	if massifIndex == storage.HeadMassifIndex {
+		index = "head"
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return fmt.Errorf("%w: %v %s: %s: %s",
+			storage.ErrNotAvailable, otype, index, resp.Status, bytes.TrimSpace(body))
+	}
+	return fmt.Errorf("%w: %v %s: %s: %s", ErrGCSRequest, otype, index, resp.Status, bytes.TrimSpace(body))
+}
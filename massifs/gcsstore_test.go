@@ -0,0 +1,154 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeGCSObject struct {
+	data       []byte
+	generation int64
+}
+
+// fakeGCS serves the parts of the GCS JSON API GCSStore uses, for one bucket.
+// Lists are paged two objects at a time.
+type fakeGCS struct {
+	objects    map[string]fakeGCSObject
+	generation int64
+	// status, if set, is the response to every request
+	status int
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if f.status != 0 {
+		w.WriteHeader(f.status)
+		return
+	}
+	const objects, uploads = "/storage/v1/b/bucket/o", "/upload/storage/v1/b/bucket/o"
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == uploads:
+		name := r.URL.Query().Get("name")
+		if match := r.URL.Query().Get("ifGenerationMatch"); match != "" {
+			if match != strconv.FormatInt(f.objects[name].generation, 10) {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+		}
+		data, _ := io.ReadAll(r.Body)
+		f.generation++
+		f.objects[name] = fakeGCSObject{data: data, generation: f.generation}
+		_ = json.NewEncoder(w).Encode(map[string]string{"name": name, "generation": fmt.Sprint(f.generation)})
+	case r.Method == http.MethodGet && r.URL.Path == objects:
+		var names []string
+		for name := range f.objects {
+			if strings.HasPrefix(name, r.URL.Query().Get("prefix")) {
+				names = append(names, name)
+			}
+		}
+		slices.Sort(names)
+		start, _ := strconv.Atoi(r.URL.Query().Get("pageToken"))
+		page := map[string]any{}
+		var items []map[string]string
+		for i := start; i < len(names) && i < start+2; i++ {
+			items = append(items, map[string]string{"name": names[i]})
+		}
+		page["items"] = items
+		if start+2 < len(names) {
+			page["nextPageToken"] = fmt.Sprint(start + 2)
+		}
+		_ = json.NewEncoder(w).Encode(page)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, objects+"/"):
+		object, ok := f.objects[strings.TrimPrefix(r.URL.Path, objects+"/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set(gcsGenerationHeader, fmt.Sprint(object.generation))
+		// serves the ranges of ranged reads
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(object.data))
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestGCSStore(t *testing.T) {
+	ctx := context.Background()
+	source, verifier := buildSealedLog(t, 3, 10)
+	sourceHead, err := source.HeadIndex(ctx, storage.ObjectMassifData)
+	require.NoError(t, err)
+
+	fake := &fakeGCS{objects: map[string]fakeGCSObject{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	logID := storage.LogID(make([]byte, 16))
+	newStore := func() *GCSStore {
+		s, err := NewGCSStore("bucket", WithPathScheme(storage.DataTrailsPathScheme{}, logID, 3))
+		require.NoError(t, err)
+		s.Endpoint = server.URL
+		return s
+	}
+
+	sink := newStore()
+	_, err = sink.HeadIndex(ctx, storage.ObjectMassifData)
+	require.ErrorIs(t, err, storage.ErrLogEmpty)
+	_, err = sink.CheckpointRead(ctx, 0)
+	require.True(t, storage.IsNotFound(err))
+
+	v := VerifyingReplicator{COSEVerifier: verifier, Source: source, Sink: sink}
+	require.NoError(t, v.ReplicateVerifiedUpdates(ctx, 0, sourceHead))
+
+	// a fresh store reads the replica from the bucket
+	replica := newStore()
+	head, err := replica.HeadIndex(ctx, storage.ObjectCheckpoint)
+	require.NoError(t, err)
+	require.Equal(t, sourceHead, head)
+	page, err := replica.List(ctx, storage.ObjectMassifData, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, page.Indices, int(sourceHead)+1)
+	_, err = GetContextVerified(ctx, replica, verifier, head)
+	require.NoError(t, err)
+
+	// of two stores replacing the seal both read, only the first succeeds
+	other := newStore()
+	_, err = other.CheckpointRead(ctx, head)
+	require.NoError(t, err)
+	checkpoint, err := replica.CheckpointRead(ctx, head)
+	require.NoError(t, err)
+	require.NoError(t, replica.Put(ctx, head, storage.ObjectCheckpoint, checkpoint, false))
+	err = other.Put(ctx, head, storage.ObjectCheckpoint, checkpoint, false)
+	require.ErrorIs(t, err, storage.ErrContentOC)
+	// and having read it again it may replace it
+	_, err = other.CheckpointRead(ctx, head)
+	require.NoError(t, err)
+	require.NoError(t, other.Put(ctx, head, storage.ObjectCheckpoint, checkpoint, false))
+
+	// an object read as missing must still be missing
+	_, err = other.CheckpointRead(ctx, head+1)
+	require.True(t, storage.IsNotFound(err))
+	require.NoError(t, replica.Put(ctx, head+1, storage.ObjectCheckpoint, checkpoint, true))
+	err = other.Put(ctx, head+1, storage.ObjectCheckpoint, checkpoint, false)
+	require.ErrorIs(t, err, storage.ErrExistsOC)
+	err = newStore().Put(ctx, head+1, storage.ObjectCheckpoint, checkpoint, true)
+	require.ErrorIs(t, err, storage.ErrExistsOC)
+
+	fake.status = http.StatusServiceUnavailable
+	_, err = newStore().MassifReadN(ctx, 0, -1)
+	require.ErrorIs(t, err, storage.ErrNotAvailable)
+	fake.status = http.StatusForbidden
+	_, err = newStore().MassifReadN(ctx, 0, -1)
+	require.ErrorIs(t, err, ErrGCSRequest)
+	require.False(t, storage.IsNotFound(err))
+}
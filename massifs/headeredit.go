@@ -0,0 +1,191 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrHeaderEditNotPermitted  = errors.New("the massif header edit is not permitted")
+	ErrHeaderEditReasonMissing = errors.New("a reason is required to edit a massif header")
+)
+
+// HeaderChangeRecord is the audit record of a massif header edit, returned by
+// EditMassifHeader for the operator to retain.
+type HeaderChangeRecord struct {
+	MassifIndex uint32    `json:"massifIndex"`
+	Field       string    `json:"field"`
+	Old         uint64    `json:"old"`
+	New         uint64    `json:"new"`
+	Reason      string    `json:"reason"`
+	EditedAt    time.Time `json:"editedAt"`
+	// BeforeSHA256 and AfterSHA256 are the digests of the complete massif data
+	// before and after the edit.
+	BeforeSHA256 [32]byte `json:"beforeSHA256"`
+	AfterSHA256  [32]byte `json:"afterSHA256"`
+	// Verified is true if the edited massif was verified against a checkpoint
+	Verified bool `json:"verified"`
+}
+
+// EditMassifHeader rewrites the start header of the massif to start, which is
+// typically mc.Start with a correction applied. It is for correcting metadata
+// recorded in error, such as the commitment epoch of a test deployment.
+//
+// Only the commitment epoch may change. It is not covered by any log or index
+// hash, nor by the checkpoint signatures, and it has no bearing on the
+// layout. Every other field either locates the massif in the log, determines
+// its layout, or is the last idtimestamp, which the index commits to, so a
+// change to any of them fails with ErrHeaderEditNotPermitted. After the edit
+// the data outside the epoch bytes, and the integrity block, is confirmed to
+// be unchanged. The integrity block is refreshed if the massif has one.
+//
+// The edited massif is then re-verified, against the checkpoint provided with
+// WithVerifyCheckpoint, using the verifier from VerifyWithCOSEVerifier and
+// any other verification options. Note that a seal with claims names the
+// commitment epoch in its subject, so WithVerifySealSubject will refuse an
+// edit which diverges from the seal. Without a checkpoint only the integrity
+// block is checked, and the record is not marked Verified.
+//
+// reason is required, it is carried in the record. The context is unchanged
+// if the edit fails. To persist the edit, commit the context with
+// CommitContext.
+func EditMassifHeader(
+	ctx context.Context, mc *MassifContext, start MassifStart, reason string, opts ...Option,
+) (*HeaderChangeRecord, error) {
+	if reason == "" {
+		return nil, ErrHeaderEditReasonMissing
+	}
+	if err := mc.checkWritable("start header"); err != nil {
+		return nil, err
+	}
+	if err := checkHeaderEdit(mc.Start, start); err != nil {
+		return nil, err
+	}
+	if uint64(len(mc.Data)) < ValueBytes {
+		return nil, fmt.Errorf("%w: %d bytes", ErrMassifDataLengthInvalid, len(mc.Data))
+	}
+
+	record := &HeaderChangeRecord{
+		MassifIndex:  mc.Start.MassifIndex,
+		Field:        "commitment-epoch",
+		Old:          uint64(mc.Start.CommitmentEpoch),
+		New:          uint64(start.CommitmentEpoch),
+		Reason:       reason,
+		EditedAt:     time.Now().UTC(),
+		BeforeSHA256: sha256.Sum256(mc.Data),
+	}
+
+	before := bytes.Clone(mc.Data)
+	previous := mc.Start
+	restore := func() {
+		copy(mc.Data, before)
+		mc.Start = previous
+	}
+
+	binary.BigEndian.PutUint32(mc.Data[MassifStartKeyEpochFirstByte:MassifStartKeyEpochEnd], start.CommitmentEpoch)
+	mc.Start.CommitmentEpoch = start.CommitmentEpoch
+	hadIntegrity := mc.HasIntegrity()
+	if hadIntegrity {
+		if err := mc.SetIntegrity(); err != nil {
+			restore()
+			return nil, err
+		}
+	}
+	if err := checkHeaderEditInvariant(before, mc.Data, hadIntegrity); err != nil {
+		restore()
+		return nil, err
+	}
+
+	if hadIntegrity {
+		ok, err := mc.CheckIntegrity()
+		if err == nil && !ok {
+			err = fmt.Errorf("%w: the integrity block was not refreshed", ErrIntegrityMismatch)
+		}
+		if err != nil {
+			restore()
+			return nil, err
+		}
+	}
+
+	options := VerifyOptions{}
+	if err := ApplyOptions(&options, opts...); err != nil {
+		restore()
+		return nil, err
+	}
+	if options.Check != nil {
+		if _, err := mc.VerifyContext(ctx, options); err != nil {
+			restore()
+			return nil, fmt.Errorf("the edited massif %d failed verification: %w", mc.Start.MassifIndex, err)
+		}
+		record.Verified = true
+	}
+
+	record.AfterSHA256 = sha256.Sum256(mc.Data)
+	return record, nil
+}
+
+// checkHeaderEdit refuses changes to any start header field other than the
+// commitment epoch, and an edit which changes nothing.
+func checkHeaderEdit(current, edited MassifStart) error {
+	refused := func(field string, was, now any) error {
+		return fmt.Errorf("%w: %s %v -> %v", ErrHeaderEditNotPermitted, field, was, now)
+	}
+	switch {
+	case edited.Reserved != current.Reserved:
+		return refused("reserved", current.Reserved, edited.Reserved)
+	case edited.LastID != current.LastID:
+		return refused("last-id", current.LastID, edited.LastID)
+	case edited.Version != current.Version:
+		return refused("version", current.Version, edited.Version)
+	case edited.MassifHeight != current.MassifHeight:
+		return refused("massif-height", current.MassifHeight, edited.MassifHeight)
+	case edited.MassifIndex != current.MassifIndex:
+		return refused("massif-index", current.MassifIndex, edited.MassifIndex)
+	case edited.DataEpoch != current.DataEpoch:
+		return refused("data-epoch", current.DataEpoch, edited.DataEpoch)
+	case edited.FirstIndex != current.FirstIndex:
+		return refused("first-index", current.FirstIndex, edited.FirstIndex)
+	case edited.PeakStackLen != current.PeakStackLen:
+		return refused("peak-stack-len", current.PeakStackLen, edited.PeakStackLen)
+	case edited.BloomK != current.BloomK:
+		return refused("bloom-k", current.BloomK, edited.BloomK)
+	case edited.BloomBitsPerElement != current.BloomBitsPerElement:
+		return refused("bloom-bits-per-element", current.BloomBitsPerElement, edited.BloomBitsPerElement)
+	case edited.CommitmentEpoch == current.CommitmentEpoch:
+		return fmt.Errorf("%w: nothing to change", ErrHeaderEditNotPermitted)
+	}
+	return nil
+}
+
+// checkHeaderEditInvariant confirms the only bytes which differ are the epoch
+// and, if the massif has one, the integrity block.
+func checkHeaderEditInvariant(before, after []byte, integrity bool) error {
+	if len(before) != len(after) {
+		return fmt.Errorf("%w: the massif length changed", ErrHeaderEditNotPermitted)
+	}
+	var skipStart, skipEnd uint64
+	if integrity {
+		var err error
+		if skipStart, skipEnd, err = integrityRange(); err != nil {
+			return err
+		}
+	}
+	for i := range before {
+		at := uint64(i)
+		if at >= MassifStartKeyEpochFirstByte && at < MassifStartKeyEpochEnd {
+			continue
+		}
+		if at >= skipStart && at < skipEnd {
+			continue
+		}
+		if before[i] != after[i] {
+			return fmt.Errorf("%w: byte %d changed", ErrHeaderEditNotPermitted, i)
+		}
+	}
+	return nil
+}
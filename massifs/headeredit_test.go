@@ -0,0 +1,70 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEditMassifHeader(t *testing.T) {
+	ctx := context.Background()
+	store, verifier := buildSealedLog(t, 2, 4)
+
+	mc, err := GetMassifContext(ctx, store, 0)
+	require.NoError(t, err)
+	require.NoError(t, mc.SetIntegrity())
+	check, err := GetCheckpoint(ctx, store, 0)
+	require.NoError(t, err)
+	original := bytes.Clone(mc.Data)
+
+	edited := mc.Start
+	edited.CommitmentEpoch = 2
+
+	_, err = EditMassifHeader(ctx, &mc, edited, "")
+	require.ErrorIs(t, err, ErrHeaderEditReasonMissing)
+
+	refused := mc.Start
+	refused.LastID++
+	_, err = EditMassifHeader(ctx, &mc, refused, "fix")
+	require.ErrorIs(t, err, ErrHeaderEditNotPermitted)
+	_, err = EditMassifHeader(ctx, &mc, mc.Start, "fix")
+	require.ErrorIs(t, err, ErrHeaderEditNotPermitted)
+
+	// a failed verification leaves the context as it was
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, err = EditMassifHeader(ctx, &mc, edited, "fix",
+		WithVerifyCheckpoint(&check), VerifyWithCOSEVerifier(newES256Verifier(t, &otherKey.PublicKey)))
+	require.Error(t, err)
+	require.Equal(t, original, mc.Data)
+	require.Equal(t, uint32(1), mc.Start.CommitmentEpoch)
+
+	record, err := EditMassifHeader(ctx, &mc, edited, "genesis recorded the wrong epoch",
+		WithVerifyCheckpoint(&check), VerifyWithCOSEVerifier(verifier))
+	require.NoError(t, err)
+	require.True(t, record.Verified)
+	require.Equal(t, "commitment-epoch", record.Field)
+	require.Equal(t, uint64(1), record.Old)
+	require.Equal(t, uint64(2), record.New)
+	require.Equal(t, sha256.Sum256(original), record.BeforeSHA256)
+	require.Equal(t, sha256.Sum256(mc.Data), record.AfterSHA256)
+
+	require.Equal(t, uint32(2), mc.Start.CommitmentEpoch)
+	require.Equal(t, uint32(2), MakeMassifStart(mc.Data).CommitmentEpoch)
+	ok, err := mc.CheckIntegrity()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, original[mc.LogStart():], mc.Data[mc.LogStart():])
+
+	// without a checkpoint the edit is made but not verified
+	edited.CommitmentEpoch = 1
+	record, err = EditMassifHeader(ctx, &mc, edited, "revert")
+	require.NoError(t, err)
+	require.False(t, record.Verified)
+}
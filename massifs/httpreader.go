@@ -0,0 +1,233 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+)
+
+var ErrHTTPRead = errors.New("the http object request failed")
+
+// HTTPReader is a read-only ObjectReader over log objects published at a
+// base URL, named by a PathScheme relative to it. It is for reading public
+// logs from plain HTTP(S) object hosting, which can not list objects, so the
+// head massif is found by probing, relying on the massifs of a log, and its
+// checkpoints, being contiguous from zero.
+//
+// Objects are read lazily and cached for the life of the reader, the head
+// indices are looked up on every call.
+type HTTPReader struct {
+	BaseURL string
+
+	client       *http.Client
+	scheme       storage.PathScheme
+	logID        storage.LogID
+	massifHeight uint8
+
+	massifs     map[uint32][]byte
+	checkpoints map[uint32][]byte
+}
+
+// NewHTTPReader returns a reader for the log under baseURL. The options
+// honoured are WithPathScheme, without which the objects are expected
+// directly under baseURL, and WithHTTPClient.
+func NewHTTPReader(baseURL string, opts ...Option) (*HTTPReader, error) {
+	options := StorageOptions{}
+	if err := ApplyOptions(&options, opts...); err != nil {
+		return nil, err
+	}
+	r := &HTTPReader{
+		BaseURL:      baseURL,
+		client:       options.HTTPClient,
+		scheme:       options.PathScheme,
+		logID:        options.LogID,
+		massifHeight: options.MassifHeight,
+		massifs:      map[uint32][]byte{},
+		checkpoints:  map[uint32][]byte{},
+	}
+	if r.client == nil {
+		r.client = http.DefaultClient
+	}
+	if r.scheme == nil {
+		r.scheme = storage.FlatPathScheme{}
+	}
+	return r, nil
+}
+
+// HeadIndex finds the last object of the type by probing for objects at
+// doubling indices, then bisecting between the last found and the first
+// missing.
+func (r *HTTPReader) HeadIndex(ctx context.Context, otype storage.ObjectType) (uint32, error) {
+	switch otype {
+	case storage.ObjectMassifData, storage.ObjectMassifStart:
+		otype = storage.ObjectMassifData
+	case storage.ObjectCheckpoint:
+	default:
+		return 0, fmt.Errorf("%w: object type %v", storage.ErrUnsupportedCap, otype)
+	}
+	ok, err := r.exists(ctx, otype, 0)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		if otype == storage.ObjectCheckpoint {
+			return 0, storage.NewNotFoundError(r.logID, otype, storage.HeadMassifIndex)
+		}
+		return 0, storage.NewLogEmptyError(r.logID)
+	}
+	// found exists, missing does not
+	found, missing := uint64(0), uint64(1)
+	for missing <= uint64(^uint32(0)) {
+		if ok, err = r.exists(ctx, otype, uint32(missing)); err != nil {
+			return 0, err
+		}
+		if !ok {
+			break
+		}
+		found, missing = missing, missing*2
+	}
+	for missing-found > 1 {
+		mid := found + (missing-found)/2
+		if ok, err = r.exists(ctx, otype, uint32(mid)); err != nil {
+			return 0, err
+		}
+		if ok {
+			found = mid
+		} else {
+			missing = mid
+		}
+	}
+	return uint32(found), nil
+}
+
+// List can not list the objects, it relies on them being contiguous from
+// zero, as HeadIndex does, and returns the indices up to the head.
+func (r *HTTPReader) List(ctx context.Context, otype storage.ObjectType, fromIndex uint32, limit int) (ObjectPage, error) {
+	otype, err := listObjectType(otype)
+	if err != nil {
+		return ObjectPage{}, err
+	}
+	head, err := r.HeadIndex(ctx, otype)
+	if storage.IsNotFound(err) {
+		return ObjectPage{}, nil
+	}
+	if err != nil {
+		return ObjectPage{}, err
+	}
+	var page ObjectPage
+	for i := uint64(fromIndex); i <= uint64(head); i++ {
+		if limit > 0 && len(page.Indices) == limit {
+			page.Continuation = encodeListToken(otype, uint32(i))
+			break
+		}
+		page.Indices = append(page.Indices, uint32(i))
+	}
+	return page, nil
+}
+
+func (r *HTTPReader) MassifData(massifIndex uint32) ([]byte, bool, error) {
+	data, ok := r.massifs[massifIndex]
+	return data, ok, nil
+}
+
+func (r *HTTPReader) CheckpointData(massifIndex uint32) ([]byte, bool, error) {
+	data, ok := r.checkpoints[massifIndex]
+	return data, ok, nil
+}
+
+func (r *HTTPReader) MassifReadN(ctx context.Context, massifIndex uint32, n int) ([]byte, error) {
+	data, err := r.get(ctx, storage.ObjectMassifData, massifIndex)
+	if err != nil {
+		return nil, err
+	}
+	r.massifs[massifIndex] = data
+	if n >= 0 && n < len(data) {
+		return data[:n], nil
+	}
+	return data, nil
+}
+
+func (r *HTTPReader) CheckpointRead(ctx context.Context, massifIndex uint32) ([]byte, error) {
+	data, err := r.get(ctx, storage.ObjectCheckpoint, massifIndex)
+	if err != nil {
+		return nil, err
+	}
+	r.checkpoints[massifIndex] = data
+	return data, nil
+}
+
+// LogID returns the log id the reader was configured with
+func (r *HTTPReader) LogID(ctx context.Context) (storage.LogID, error) {
+	if r.logID == nil {
+		return nil, storage.ErrLogIDRequired
+	}
+	return r.logID, nil
+}
+
+func (r *HTTPReader) objectURL(otype storage.ObjectType, massifIndex uint32) (string, error) {
+	path, err := storage.SchemeObjectPath(r.scheme, r.logID, r.massifHeight, massifIndex, otype)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(r.BaseURL, "/") + "/" + path, nil
+}
+
+func (r *HTTPReader) exists(ctx context.Context, otype storage.ObjectType, massifIndex uint32) (bool, error) {
+	resp, err := r.do(ctx, http.MethodHead, otype, massifIndex)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("%w: %v %d: %s", ErrHTTPRead, otype, massifIndex, resp.Status)
+	}
+}
+
+// get reads an object, a missing object is reported as storage.NotFoundError
+func (r *HTTPReader) get(ctx context.Context, otype storage.ObjectType, massifIndex uint32) ([]byte, error) {
+	resp, err := r.do(ctx, http.MethodGet, otype, massifIndex)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHTTPRead, err)
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return data, nil
+	case http.StatusNotFound:
+		return nil, storage.NewNotFoundError(r.logID, otype, massifIndex)
+	default:
+		return nil, fmt.Errorf("%w: %v %d: %s: %s",
+			ErrHTTPRead, otype, massifIndex, resp.Status, bytes.TrimSpace(data))
+	}
+}
+
+func (r *HTTPReader) do(ctx context.Context, method string, otype storage.ObjectType, massifIndex uint32) (*http.Response, error) {
+	target, err := r.objectURL(otype, massifIndex)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHTTPRead, err)
+	}
+	return resp, nil
+}
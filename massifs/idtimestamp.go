@@ -8,6 +8,7 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 
@@ -17,8 +18,54 @@ import (
 var (
 	ErrIDTimestampBytesToShort = errors.New("not enough bytes to represent an id time stamp")
 	ErrEpochToLarge            = errors.New("we only currently support an 8 bit epoch counter")
+	// ErrIDTimestampEpoch is wrapped by the IDTimestampEpochError returned
+	// when a leaf's idtimestamp is not from the commitment epoch of its massif
+	ErrIDTimestampEpoch = errors.New("the idtimestamp is not from the commitment epoch of the massif")
 )
 
+// IDTimestampEpochSkew is how far ahead of the builder's clock an idtimestamp
+// may be, and still be attributed to the current epoch, see IDTimestampEpoch.
+const IDTimestampEpochSkew = 5 * time.Minute
+
+// IDTimestampEpochError reports a leaf refused by AddHashedLeaf because its
+// idtimestamp was issued in a different epoch to the massif's. It wraps
+// ErrIDTimestampEpoch.
+type IDTimestampEpochError struct {
+	IDTimestamp uint64
+	// Epoch is the epoch the idtimestamp was attributed to
+	Epoch uint8
+	// MassifEpoch is the commitment epoch of the massif appended to
+	MassifEpoch uint32
+}
+
+func (e *IDTimestampEpochError) Error() string {
+	return fmt.Sprintf("%v: idtimestamp %x is from epoch %d, the massif is epoch %d",
+		ErrIDTimestampEpoch, e.IDTimestamp, e.Epoch, e.MassifEpoch)
+}
+
+func (e *IDTimestampEpochError) Unwrap() error {
+	return ErrIDTimestampEpoch
+}
+
+// IDTimestampEpoch returns the epoch the id timestamp was issued in, judged at
+// the time at. The epoch is not encoded in the id, and the same id denotes a
+// time in every epoch, but epochs are over 30 years long so only one of those
+// times is plausible: the latest which is not after at. Callers should allow
+// for clock skew by passing a time slightly ahead of their clock, see
+// IDTimestampEpochSkew. 0 is returned if the id is after at in every epoch.
+func IDTimestampEpoch(id uint64, at time.Time) uint8 {
+	ms := int64(id >> snowflakeid.TimeShift)
+	since := at.UnixMilli() - ms
+	if since < 0 {
+		return 0
+	}
+	epoch := since / snowflakeid.EpochMS(1)
+	if epoch > 0xff {
+		return 0xff
+	}
+	return uint8(epoch)
+}
+
 // IDTimestampToHex returns the hex encoding of the id timestamp with the epoch
 // pre-pended.  The epoch is the count of times we have overflowed 40 bits
 // worth of milliseconds since the standard unix epoch. This will be 1 until Jan
@@ -0,0 +1,205 @@
+package massifs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/forestrie/go-merklelog/massifs/logformat"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/forestrie/go-merklelog/urkle"
+	"github.com/fxamacker/cbor/v2"
+)
+
+// The index commitment occupies start header reserved word 6. The urkle trie
+// root is only written once the massif is complete, and nothing covers the
+// leaf records of a partial massif, so a replica could present altered
+// idtimestamps or extra bytes without any hash failing. The commitment is the
+// RFC 9162 merkle tree hash, with SHA-256, of the urkle leaf records, in leaf
+// order, each record verbatim. It is maintained by CommitContext, see
+// WithIndexCommitment, and a seal binds it with WithSealIndexCommitment.
+const (
+	massifIndexCommitmentWord = logformat.IndexCommitmentWord
+
+	// SealIndexCommitmentLabel is the private-use protected header label
+	// under which a checkpoint carries the index commitment of the leaves it
+	// seals. Being protected, it is covered by the checkpoint signature. The
+	// 1002 offset follows the seal version label.
+	SealIndexCommitmentLabel int64 = COSEPrivateStart - 1002
+)
+
+var (
+	ErrNoIndexCommitment       = errors.New("there is no index commitment")
+	ErrIndexCommitmentMismatch = errors.New("the urkle leaf records do not match the index commitment")
+)
+
+// IndexCommitment computes the commitment over the first leafCount urkle leaf
+// records of the massif.
+func (mc MassifContext) IndexCommitment(leafCount uint64) ([]byte, error) {
+	if err := mc.requireV2Index(); err != nil {
+		return nil, err
+	}
+	leafTable, err := mc.UrkleLeafTableRegion()
+	if err != nil {
+		return nil, err
+	}
+	if leafCount*urkle.LeafRecordBytes > uint64(len(leafTable)) {
+		return nil, fmt.Errorf("%w: %d leaves, the leaf table holds %d",
+			ErrIndexCommitmentMismatch, leafCount, len(leafTable)/urkle.LeafRecordBytes)
+	}
+	if leafCount == 0 {
+		root := sha256.Sum256(nil)
+		return root[:], nil
+	}
+
+	level := make([][]byte, leafCount)
+	for i := range level {
+		record := leafTable[uint64(i)*urkle.LeafRecordBytes : uint64(i+1)*urkle.LeafRecordBytes]
+		h := sha256.New()
+		h.Write([]byte{0x00})
+		h.Write(record)
+		level[i] = h.Sum(nil)
+	}
+	// Pairing bottom up, and carrying an odd last node up unchanged, gives
+	// the RFC 9162 tree hash.
+	for len(level) > 1 {
+		next := level[:0]
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			h := sha256.New()
+			h.Write([]byte{0x01})
+			h.Write(level[i])
+			h.Write(level[i+1])
+			next = append(next, h.Sum(nil))
+		}
+		level = next
+	}
+	return level[0], nil
+}
+
+// StoredIndexCommitment returns the index commitment recorded at the last
+// commit. ok is false if none has been recorded.
+func (mc MassifContext) StoredIndexCommitment() (commitment []byte, ok bool, err error) {
+	if mc.Start.Version != MassifCurrentVersion {
+		return nil, false, nil
+	}
+	start, end, err := startHeaderWordRange(massifIndexCommitmentWord)
+	if err != nil {
+		return nil, false, err
+	}
+	if end > uint64(len(mc.Data)) {
+		return nil, false, fmt.Errorf("start header out of range: end=%d len=%d", end, len(mc.Data))
+	}
+	raw := mc.Data[start:end]
+	if isAllZero(raw) {
+		return nil, false, nil
+	}
+	return bytes.Clone(raw), true, nil
+}
+
+// hasIndexCommitment returns true if the massif records an index commitment
+func (mc MassifContext) hasIndexCommitment() bool {
+	_, ok, err := mc.StoredIndexCommitment()
+	return err == nil && ok
+}
+
+// SetIndexCommitment computes the commitment over the leaves of the massif
+// and writes it through to the start header. CommitContext calls it if the
+// massif already has a commitment, or WithIndexCommitment is set.
+func (mc *MassifContext) SetIndexCommitment() error {
+	if err := mc.checkWritable("index commitment"); err != nil {
+		return err
+	}
+	commitment, err := mc.IndexCommitment(mc.MassifLeafCount())
+	if err != nil {
+		return err
+	}
+	start, end, err := startHeaderWordRange(massifIndexCommitmentWord)
+	if err != nil {
+		return err
+	}
+	if end > uint64(len(mc.Data)) {
+		return fmt.Errorf("start header out of range: end=%d len=%d", end, len(mc.Data))
+	}
+	copy(mc.Data[start:end], commitment)
+	return nil
+}
+
+// CheckIndexCommitment recomputes the commitment over the leaves of the
+// massif and compares it with the one recorded. ok is false, and the error
+// nil, if none is recorded. As for CheckIntegrity, a reader racing an in
+// place append may see a mismatch, and should read again before concluding
+// the index has been altered.
+func (mc MassifContext) CheckIndexCommitment() (ok bool, err error) {
+	stored, ok, err := mc.StoredIndexCommitment()
+	if err != nil || !ok {
+		return false, err
+	}
+	commitment, err := mc.IndexCommitment(mc.MassifLeafCount())
+	if err != nil {
+		return false, err
+	}
+	if !bytes.Equal(stored, commitment) {
+		return false, fmt.Errorf("%w: massif %d", ErrIndexCommitmentMismatch, mc.Start.MassifIndex)
+	}
+	return true, nil
+}
+
+// SealIndexCommitment computes the commitment a seal of the massif at mmrSize
+// should carry: over the leaves of this massif which the seal covers.
+func (mc MassifContext) SealIndexCommitment(mmrSize uint64) ([]byte, error) {
+	if mmrSize < mc.Start.FirstIndex || mmrSize > mc.RangeCount() {
+		return nil, fmt.Errorf("%w: sealed size %d, massif %d has range [%d, %d)",
+			ErrStateSizeExceedsData, mmrSize, mc.Start.MassifIndex, mc.Start.FirstIndex, mc.RangeCount())
+	}
+	return mc.IndexCommitment(mmr.LeafCount(mmrSize) - mmr.LeafCount(mc.Start.FirstIndex))
+}
+
+// WithSealIndexCommitment carries the index commitment, see
+// MassifContext.SealIndexCommitment, in the checkpoint protected header under
+// SealIndexCommitmentLabel.
+func WithSealIndexCommitment(commitment []byte) CheckpointSignOption {
+	return func(o *CheckpointSignOptions) {
+		o.IndexCommitment = commitment
+	}
+}
+
+// ReadSealIndexCommitment returns the index commitment carried by a
+// checkpoint's protected header, ErrNoIndexCommitment if there is none.
+func ReadSealIndexCommitment(protectedHeader []byte) ([]byte, error) {
+	var header map[int64]cbor.RawMessage
+	if err := cbor.Unmarshal(protectedHeader, &header); err != nil {
+		return nil, fmt.Errorf("decode protected header: %w", err)
+	}
+	raw, ok := header[SealIndexCommitmentLabel]
+	if !ok {
+		return nil, ErrNoIndexCommitment
+	}
+	var commitment []byte
+	if err := cbor.Unmarshal(raw, &commitment); err != nil {
+		return nil, fmt.Errorf("decode index commitment: %w", err)
+	}
+	return commitment, nil
+}
+
+// checkSealIndexCommitment returns an error unless the checkpoint carries the
+// commitment to the leaf records of the massif it seals.
+func checkSealIndexCommitment(check *Checkpoint, mc *MassifContext) error {
+	sealed, err := ReadSealIndexCommitment(check.Receipt.ProtectedHeader)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrIndexCommitmentMismatch, err)
+	}
+	commitment, err := mc.SealIndexCommitment(check.MMRSize)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(sealed, commitment) {
+		return fmt.Errorf("%w: the seal of massif %d commits to different leaf records",
+			ErrIndexCommitmentMismatch, mc.Start.MassifIndex)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/forestrie/go-merklelog/urkle"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+func TestIndexCommitment(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore(nil, nil)
+	var mc MassifContext
+	var err error
+	for i := range 3 {
+		mc, err = GetAppendContext(ctx, store, 1, 3)
+		require.NoError(t, err)
+		leaf := sha256.Sum256(fmt.Appendf(nil, "index-commitment-leaf-%d", i))
+		_, err = mc.AddHashedLeaf(sha256.New(), uint64(i+1), nil, []byte("log"), []byte("app"), leaf[:])
+		require.NoError(t, err)
+		// only the first commit asks for it, once present it is maintained
+		var opts []Option
+		if i == 0 {
+			opts = append(opts, WithIndexCommitment())
+		}
+		require.NoError(t, CommitContext(ctx, store, &mc, opts...))
+	}
+
+	// the RFC 9162 tree hash of the three leaf records
+	leafTable, err := mc.UrkleLeafTableRegion()
+	require.NoError(t, err)
+	node := func(prefix byte, parts ...[]byte) []byte {
+		h := sha256.New()
+		h.Write([]byte{prefix})
+		for _, p := range parts {
+			h.Write(p)
+		}
+		return h.Sum(nil)
+	}
+	record := func(i int) []byte {
+		return leafTable[i*urkle.LeafRecordBytes : (i+1)*urkle.LeafRecordBytes]
+	}
+	want := node(1, node(1, node(0, record(0)), node(0, record(1))), node(0, record(2)))
+	stored, ok, err := mc.StoredIndexCommitment()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, want, stored)
+	ok, err = mc.CheckIndexCommitment()
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// the seal binds the commitment of the leaves it covers
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := cose.NewSigner(cose.AlgorithmES256, key)
+	require.NoError(t, err)
+	verifier := newES256Verifier(t, &key.PublicKey)
+	sealedSize := mmr.FirstMMRSize(mmr.MMRIndex(1))
+	seal := func(opts ...CheckpointSignOption) *Checkpoint {
+		proof, err := BuildConsistencyProof(&mc, 0, sealedSize)
+		require.NoError(t, err)
+		accumulator, err := mmr.PeakHashes(&mc, sealedSize-1)
+		require.NoError(t, err)
+		data, err := SignCheckpointReceipt(signer, proof, accumulator, opts...)
+		require.NoError(t, err)
+		check, err := NewCheckpoint(data)
+		require.NoError(t, err)
+		return &check
+	}
+	commitment, err := mc.SealIndexCommitment(sealedSize)
+	require.NoError(t, err)
+	sealed := seal(WithSealIndexCommitment(commitment))
+	got, err := ReadSealIndexCommitment(sealed.Receipt.ProtectedHeader)
+	require.NoError(t, err)
+	require.Equal(t, commitment, got)
+
+	verify := func(check *Checkpoint) error {
+		_, err := mc.VerifyContext(ctx, VerifyOptions{
+			Check: check, COSEVerifier: verifier, RequireIndexCommitment: true,
+		})
+		return err
+	}
+	require.NoError(t, verify(sealed))
+	require.ErrorIs(t, verify(seal()), ErrIndexCommitmentMismatch)
+
+	// altering the extra bytes of a sealed leaf is detected, by the seal and
+	// by the stored commitment
+	original := bytes.Clone(record(0))
+	urkle.LeafSetExtra(leafTable, 0, 1, []byte("altered"))
+	require.ErrorIs(t, verify(sealed), ErrIndexCommitmentMismatch)
+	_, err = mc.CheckIndexCommitment()
+	require.ErrorIs(t, err, ErrIndexCommitmentMismatch)
+
+	// an unsealed leaf is only covered by the stored commitment
+	copy(record(0), original)
+	require.NoError(t, verify(sealed))
+	urkle.LeafSetExtra(leafTable, 2, 1, []byte("altered"))
+	require.NoError(t, verify(sealed))
+	_, err = mc.CheckIndexCommitment()
+	require.ErrorIs(t, err, ErrIndexCommitmentMismatch)
+}
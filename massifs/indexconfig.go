@@ -0,0 +1,141 @@
+package massifs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/forestrie/go-merklelog/bloom"
+	"github.com/forestrie/go-merklelog/urkle"
+	"github.com/fxamacker/cbor/v2"
+)
+
+// SealIndexConfigLabel is the private-use protected header label under which
+// a checkpoint carries the IndexConfig of the massif it seals. Being
+// protected, it is covered by the checkpoint signature. The 1003 offset
+// follows the index commitment label.
+const SealIndexConfigLabel int64 = COSEPrivateStart - 1003
+
+var (
+	ErrNoIndexConfig       = errors.New("the checkpoint protected header carries no index configuration")
+	ErrIndexConfigMismatch = errors.New("the massif index configuration does not match the seal")
+)
+
+// IndexConfig digests the configuration of the v2 index regions of a massif.
+// Neither the seal accumulator nor the index commitment covers how the bloom
+// and urkle regions are laid out and parameterised, so a replica could
+// substitute regions of a different format, for example bloom filters with
+// another k, without any hash failing. A seal carrying the digests, see
+// WithSealIndexConfig, lets a verifier detect that.
+//
+// Massifs without the v2 index have the zero IndexConfig, and a seal of one
+// carries nothing.
+type IndexConfig struct {
+	// Bloom is the SHA-256 of the bloom header fields which fix the filter
+	// parameters: the format version, bit order, k, filter count and bits
+	// per filter. The count of inserted elements is not included.
+	Bloom []byte `cbor:"1,keyasint,omitempty"`
+	// Urkle is the SHA-256 of the urkle frontier format version, the key
+	// width, and the leaf and node record sizes.
+	Urkle []byte `cbor:"2,keyasint,omitempty"`
+}
+
+// IsZero returns true if the config has no digests
+func (c IndexConfig) IsZero() bool {
+	return len(c.Bloom) == 0 && len(c.Urkle) == 0
+}
+
+// Equal returns true if the digests are the same
+func (c IndexConfig) Equal(other IndexConfig) bool {
+	return bytes.Equal(c.Bloom, other.Bloom) && bytes.Equal(c.Urkle, other.Urkle)
+}
+
+// IndexConfig returns the digests of the massif's index configuration, read
+// from the index regions. It is the zero IndexConfig for a massif without the
+// v2 index.
+func (mc MassifContext) IndexConfig() (IndexConfig, error) {
+	if mc.Start.Version != MassifCurrentVersion {
+		return IndexConfig{}, nil
+	}
+	region, err := mc.BloomRegion()
+	if err != nil {
+		return IndexConfig{}, err
+	}
+	ok, err := bloom.Initialized(region)
+	if err != nil {
+		return IndexConfig{}, fmt.Errorf("%w: %v", ErrIndexConfigMismatch, err)
+	}
+	if !ok {
+		return IndexConfig{}, fmt.Errorf("%w: the bloom header of massif %d is not initialized",
+			ErrIndexConfigMismatch, mc.Start.MassifIndex)
+	}
+	// The version, bit order, k, filters and mBits are at the same offsets in
+	// the V1 and V2 headers. The version distinguishes the formats, and the
+	// mBits the bits per element.
+	bloomDigest := sha256.Sum256(region[4:12])
+
+	frontier, err := mc.UrkleFrontierRegion()
+	if err != nil {
+		return IndexConfig{}, err
+	}
+	// the frontier is written by the first insert, until then it is the
+	// format this library writes
+	version, keyBits := byte(urkle.FrontierVersionV1), byte(urkle.FrontierKeyBitsV1)
+	if string(frontier[0:4]) == urkle.FrontierMagicV1 {
+		version, keyBits = frontier[4], frontier[5]
+	}
+	urkleDigest := sha256.Sum256([]byte{
+		version, keyBits, byte(urkle.LeafRecordBytes), byte(urkle.NodeRecordBytes),
+	})
+	return IndexConfig{Bloom: bloomDigest[:], Urkle: urkleDigest[:]}, nil
+}
+
+// WithSealIndexConfig carries the index configuration, see
+// MassifContext.IndexConfig, in the checkpoint protected header under
+// SealIndexConfigLabel. A zero config is omitted.
+func WithSealIndexConfig(config IndexConfig) CheckpointSignOption {
+	return func(o *CheckpointSignOptions) {
+		o.IndexConfig = &config
+	}
+}
+
+// ReadSealIndexConfig returns the index configuration carried by a
+// checkpoint's protected header, ErrNoIndexConfig if there is none.
+func ReadSealIndexConfig(protectedHeader []byte) (IndexConfig, error) {
+	var header map[int64]cbor.RawMessage
+	if err := cbor.Unmarshal(protectedHeader, &header); err != nil {
+		return IndexConfig{}, fmt.Errorf("decode protected header: %w", err)
+	}
+	raw, ok := header[SealIndexConfigLabel]
+	if !ok {
+		return IndexConfig{}, ErrNoIndexConfig
+	}
+	var config IndexConfig
+	if err := cbor.Unmarshal(raw, &config); err != nil {
+		return IndexConfig{}, fmt.Errorf("decode index configuration: %w", err)
+	}
+	return config, nil
+}
+
+// checkSealIndexConfig returns an error if the checkpoint carries an index
+// configuration which is not that of the massif. A checkpoint without one is
+// only refused if required is set.
+func checkSealIndexConfig(check *Checkpoint, mc *MassifContext, required bool) error {
+	sealed, err := ReadSealIndexConfig(check.Receipt.ProtectedHeader)
+	if errors.Is(err, ErrNoIndexConfig) && !required {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrIndexConfigMismatch, err)
+	}
+	config, err := mc.IndexConfig()
+	if err != nil {
+		return err
+	}
+	if !sealed.Equal(config) {
+		return fmt.Errorf("%w: the index regions of massif %d are not in the sealed format",
+			ErrIndexConfigMismatch, mc.Start.MassifIndex)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package massifs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+func TestSealIndexConfig(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore(nil, nil)
+	var mc MassifContext
+	var err error
+	for i := range 3 {
+		mc, err = GetAppendContext(ctx, store, 1, 3)
+		require.NoError(t, err)
+		leaf := sha256.Sum256(fmt.Appendf(nil, "index-config-leaf-%d", i))
+		_, err = mc.AddHashedLeaf(sha256.New(), uint64(i+1), nil, nil, nil, leaf[:])
+		require.NoError(t, err)
+		require.NoError(t, CommitContext(ctx, store, &mc))
+	}
+	config, err := mc.IndexConfig()
+	require.NoError(t, err)
+	require.Len(t, config.Bloom, sha256.Size)
+	require.Len(t, config.Urkle, sha256.Size)
+
+	// the count of inserted elements is not configuration
+	empty, err := GetAppendContext(ctx, newMemStore(nil, nil), 1, 3)
+	require.NoError(t, err)
+	emptyConfig, err := empty.IndexConfig()
+	require.NoError(t, err)
+	require.True(t, config.Equal(emptyConfig))
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := cose.NewSigner(cose.AlgorithmES256, key)
+	require.NoError(t, err)
+	verifier := newES256Verifier(t, &key.PublicKey)
+	seal := func(opts ...CheckpointSignOption) *Checkpoint {
+		proof, err := BuildConsistencyProof(&mc, 0, mc.RangeCount())
+		require.NoError(t, err)
+		accumulator, err := mmr.PeakHashes(&mc, mc.RangeCount()-1)
+		require.NoError(t, err)
+		data, err := SignCheckpointReceipt(signer, proof, accumulator, opts...)
+		require.NoError(t, err)
+		check, err := NewCheckpoint(data)
+		require.NoError(t, err)
+		return &check
+	}
+	sealed := seal(WithSealIndexConfig(config))
+	got, err := ReadSealIndexConfig(sealed.Receipt.ProtectedHeader)
+	require.NoError(t, err)
+	require.Equal(t, config, got)
+
+	verify := func(check *Checkpoint, opts ...Option) error {
+		options := VerifyOptions{Check: check, COSEVerifier: verifier}
+		for _, opt := range opts {
+			opt(&options)
+		}
+		_, err := mc.VerifyContext(ctx, options)
+		return err
+	}
+	require.NoError(t, verify(sealed, WithVerifyIndexConfig()))
+	require.NoError(t, verify(seal()))
+	require.ErrorIs(t, verify(seal(), WithVerifyIndexConfig()), ErrIndexConfigMismatch)
+
+	// bloom filters with a different k are detected, the config is always
+	// checked when the seal carries it
+	region, err := mc.BloomRegion()
+	require.NoError(t, err)
+	region[6]++
+	require.ErrorIs(t, verify(sealed), ErrIndexConfigMismatch)
+	region[6]--
+	require.NoError(t, verify(sealed))
+
+	// a massif without the v2 index has no config, and its seal carries none
+	legacy := buildLegacyBlobMassif0(t, 1 /*blobVersion*/, 3 /*massifHeight*/, 3 /*leaves*/)
+	legacyConfig, err := legacy.IndexConfig()
+	require.NoError(t, err)
+	require.True(t, legacyConfig.IsZero())
+	proof, err := BuildConsistencyProof(&legacy, 0, legacy.RangeCount())
+	require.NoError(t, err)
+	accumulator, err := mmr.PeakHashes(&legacy, legacy.RangeCount()-1)
+	require.NoError(t, err)
+	data, err := SignCheckpointReceipt(signer, proof, accumulator, WithSealIndexConfig(legacyConfig))
+	require.NoError(t, err)
+	check, err := NewCheckpoint(data)
+	require.NoError(t, err)
+	_, err = ReadSealIndexConfig(check.Receipt.ProtectedHeader)
+	require.ErrorIs(t, err, ErrNoIndexConfig)
+}
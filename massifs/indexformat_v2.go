@@ -1,9 +1,11 @@
 package massifs
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/forestrie/go-merklelog/bloom"
+	"github.com/forestrie/go-merklelog/massifs/logformat"
 	"github.com/forestrie/go-merklelog/urkle"
 )
 
@@ -11,23 +13,96 @@ const (
 	// BloomBitsPerElementV1 is the fixed sizing knob for the v2 massif BloomRegion.
 	//
 	// mBits = bitsPerElement * leafCount, per filter.
-	BloomBitsPerElementV1 uint64 = 10
+	BloomBitsPerElementV1 uint64 = logformat.BloomBitsPerElementV1
 
 	// BloomKV1 is the number of hash-derived bit positions set per inserted element.
 	//
 	// For b=10, k≈round(0.693*b)=7.
-	BloomKV1 uint8 = 7
+	BloomKV1 uint8 = logformat.BloomKV1
+
+	// MaxMassifHeightV2 is the tallest massif the v2 index supports. The
+	// bloom filter bit count for the leaves of a taller massif does not fit
+	// its uint32 encoding. A height 29 massif holds 2^28 leaves, its log data
+	// alone is 16GiB.
+	MaxMassifHeightV2 uint8 = logformat.MaxMassifHeightV2
 )
 
+// CheckMassifHeightV2 returns an error if the v2 index can not be laid out
+// for a massif of the given height. Without the check the index size of such
+// a massif reads as zero, and every subsequent offset is wrong.
+func CheckMassifHeightV2(massifHeight uint8) error {
+	if massifHeight == 0 || massifHeight > MaxMassifHeightV2 {
+		return fmt.Errorf("%w: massif height %d, the v2 index supports 1 to %d",
+			ErrOffsetOverflow, massifHeight, MaxMassifHeightV2)
+	}
+	return nil
+}
+
+// ErrBloomParams is returned for bloom parameters a massif index can not be
+// laid out with.
+var ErrBloomParams = errors.New("the bloom parameters are not supported by the massif index")
+
+// BloomParams returns the parameters of the bloom region of the index, and
+// true if it is a V2 region. A massif whose start records no bloom parameters
+// has the V1 region, sized by BloomBitsPerElementV1.
+func (ms MassifStart) BloomParams() (bloom.BloomParams, bool) {
+	if ms.BloomK == 0 && ms.BloomBitsPerElement == 0 {
+		return bloom.BloomParams{
+			Filters: bloom.Filters, K: BloomKV1, BitsPerElement: uint32(BloomBitsPerElementV1),
+		}, false
+	}
+	return bloom.BloomParams{Filters: bloom.Filters, K: ms.BloomK, BitsPerElement: ms.BloomBitsPerElement}, true
+}
+
+// SetBloomParams records p in the start, so that the index of the massif has
+// a V2 bloom region with those parameters. The massif index has a filter for
+// each of the leaf value and the three leaf extras, so p must have
+// bloom.Filters filters.
+func (ms *MassifStart) SetBloomParams(p bloom.BloomParams) error {
+	if err := CheckBloomParams(ms.MassifHeight, p); err != nil {
+		return err
+	}
+	ms.BloomK, ms.BloomBitsPerElement = p.K, p.BitsPerElement
+	return nil
+}
+
+// CheckBloomParams returns an error if the index of a massif of the given
+// height can not have a V2 bloom region with parameters p.
+func CheckBloomParams(massifHeight uint8, p bloom.BloomParams) error {
+	if err := p.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrBloomParams, err)
+	}
+	if p.Filters != bloom.Filters {
+		return fmt.Errorf("%w: %d filters, the massif index has %d", ErrBloomParams, p.Filters, bloom.Filters)
+	}
+	if _, err := bloom.MBitsV2(urkle.LeafCountForMassifHeight(massifHeight), p); err != nil {
+		return fmt.Errorf("%w: massif height %d: %v", ErrBloomParams, massifHeight, err)
+	}
+	return nil
+}
+
+// bloomRegionBytes returns the byte size of the bloom region of the index,
+// including the bloom header, which is the index header.
+func (ms MassifStart) bloomRegionBytes() (uint64, error) {
+	p, _ := ms.BloomParams()
+	mBits, err := bloomMBitsForLeafCount(urkle.LeafCountForMassifHeight(ms.MassifHeight), uint64(p.BitsPerElement))
+	if err != nil {
+		return 0, err
+	}
+	return bloom.RegionBytesV2(mBits, p.Filters), nil
+}
+
 // indexDataBytesV2 returns the byte size of the v2 index *data* region, excluding the fixed 32B index header.
 //
-// v2 index header (32B) is BloomHeaderV1, and the index data is:
+// v2 index header (32B) is the bloom header, and the index data is:
 //
 //	bloom bitsets || urkle frontier || urkle leaf table || urkle node store
-func indexDataBytesV2(leafCount uint64) (uint64, error) {
+//
+// The bloom bitsets have bitsPerElement bits per leaf in each filter.
+func indexDataBytesV2(leafCount uint64, bitsPerElement uint64) (uint64, error) {
 	// Bloom region bytes includes the 32B header; we exclude that here
 	// because the massif index header is fixed 32B.
-	mBits, err := bloomMBitsV1ForLeafCount(leafCount)
+	mBits, err := bloomMBitsForLeafCount(leafCount, bitsPerElement)
 	if err != nil {
 		return 0, err
 	}
@@ -49,13 +124,12 @@ func indexDataBytesV2(leafCount uint64) (uint64, error) {
 	return total, nil
 }
 
-// bloomMBitsV1ForLeafCount computes the Bloom mBits for the given
-// leafCount using the v2 index sizing knobs, and enforces both uint64
-// and uint32 bounds.
-func bloomMBitsV1ForLeafCount(leafCount uint64) (uint32, error) {
-	mBits64 := bloom.MBitsV1(leafCount, BloomBitsPerElementV1)
-	// Detect uint64 overflow in BloomBitsPerElementV1 * leafCount.
-	if leafCount > 0 && mBits64/leafCount != BloomBitsPerElementV1 {
+// bloomMBitsForLeafCount computes the Bloom mBits for the given leafCount
+// and bits per element, and enforces both uint64 and uint32 bounds.
+func bloomMBitsForLeafCount(leafCount uint64, bitsPerElement uint64) (uint32, error) {
+	mBits64 := bloom.MBitsV1(leafCount, bitsPerElement)
+	// Detect uint64 overflow in bitsPerElement * leafCount.
+	if leafCount > 0 && mBits64/leafCount != bitsPerElement {
 		return 0, bloom.ErrMBitsOverflow
 	}
 	mBits := bloom.MBitsSafeCast(mBits64)
@@ -11,6 +11,9 @@ import (
 //
 // It is safe to call this only when creating a new massif, where the index region is zero-filled.
 func (mc *MassifContext) initIndexV2() error {
+	if err := mc.checkWritable("index"); err != nil {
+		return err
+	}
 	if mc.Start.Version != MassifCurrentVersion {
 		return nil
 	}
@@ -18,22 +21,28 @@ func (mc *MassifContext) initIndexV2() error {
 	if mc.Start.MassifHeight == 0 {
 		return fmt.Errorf("invalid massifHeight=0")
 	}
-	// massifHeight is one-based (h). Leaf capacity is N = 2^(h-1).
-	leafCount := urkle.LeafCountForMassifHeight(mc.Start.MassifHeight)
-
-	mBits, err := bloomMBitsV1ForLeafCount(leafCount)
+	regionBytes, err := mc.Start.bloomRegionBytes()
 	if err != nil {
 		return err
 	}
-	regionBytes := bloom.RegionBytesV1(mBits)
 
 	start := mc.IndexHeaderStart()
 	end := start + regionBytes
 	if end > uint64(len(mc.Data)) {
 		return fmt.Errorf("bloom region exceeds buffer: end=%d len=%d", end, len(mc.Data))
 	}
-	region := mc.Data[start:end]
 
 	// Initialize the bloom region header and clear bitsets.
+	return mc.initBloomRegion(mc.Data[start:end])
+}
+
+// initBloomRegion initializes the bloom region of the index in the format,
+// and with the parameters, the start records, see MassifStart.BloomParams.
+func (mc *MassifContext) initBloomRegion(region []byte) error {
+	// massifHeight is one-based (h). Leaf capacity is N = 2^(h-1).
+	leafCount := urkle.LeafCountForMassifHeight(mc.Start.MassifHeight)
+	if p, v2 := mc.Start.BloomParams(); v2 {
+		return bloom.InitV2(region, leafCount, p)
+	}
 	return bloom.InitV1(region, leafCount, BloomBitsPerElementV1, BloomKV1)
 }
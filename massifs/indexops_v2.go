@@ -59,6 +59,9 @@ func (mc MassifContext) UrkleRootHash() (root []byte, ok bool, err error) {
 
 // SetUrkleRootHash stores the per-massif Urkle root hash in start-header reserved word1.
 func (mc *MassifContext) SetUrkleRootHash(root []byte) error {
+	if err := mc.checkWritable("urkle root"); err != nil {
+		return err
+	}
 	if len(root) != ValueBytes {
 		return fmt.Errorf("root must be %d bytes", ValueBytes)
 	}
@@ -117,12 +120,10 @@ func (mc MassifContext) BloomRegion() ([]byte, error) {
 		return nil, err
 	}
 
-	leafCount := urkle.LeafCountForMassifHeight(mc.Start.MassifHeight)
-	mBits, err := bloomMBitsV1ForLeafCount(leafCount)
+	regionBytes, err := mc.Start.bloomRegionBytes()
 	if err != nil {
 		return nil, err
 	}
-	regionBytes := bloom.RegionBytesV1(mBits)
 
 	start := mc.IndexHeaderStart()
 	end := start + regionBytes
@@ -138,12 +139,10 @@ func (mc MassifContext) UrkleFrontierRegion() ([]byte, error) {
 		return nil, err
 	}
 
-	leafCount := urkle.LeafCountForMassifHeight(mc.Start.MassifHeight)
-	mBits, err := bloomMBitsV1ForLeafCount(leafCount)
+	bloomRegionBytes, err := mc.Start.bloomRegionBytes()
 	if err != nil {
 		return nil, err
 	}
-	bloomRegionBytes := bloom.RegionBytesV1(mBits)
 
 	start := mc.IndexHeaderStart() + bloomRegionBytes
 	end := start + uint64(urkle.FrontierStateV1Bytes)
@@ -167,11 +166,10 @@ func (mc MassifContext) UrkleLeafTableRegion() ([]byte, error) {
 
 	// NOTE: We recompute offsets directly to avoid depending on slice
 	// lengths from other regions.
-	mBits, err := bloomMBitsV1ForLeafCount(leafCount)
+	bloomRegionBytes, err := mc.Start.bloomRegionBytes()
 	if err != nil {
 		return nil, err
 	}
-	bloomRegionBytes := bloom.RegionBytesV1(mBits)
 	frontierStart := mc.IndexHeaderStart() + bloomRegionBytes
 	leafTableStart := frontierStart + uint64(urkle.FrontierStateV1Bytes)
 	leafTableEnd := leafTableStart + urkle.LeafTableBytes(leafCount)
@@ -188,11 +186,10 @@ func (mc MassifContext) UrkleNodeStoreRegion() ([]byte, error) {
 	}
 
 	leafCount := mc.urkleLeafCountV2()
-	mBits, err := bloomMBitsV1ForLeafCount(leafCount)
+	bloomRegionBytes, err := mc.Start.bloomRegionBytes()
 	if err != nil {
 		return nil, err
 	}
-	bloomRegionBytes := bloom.RegionBytesV1(mBits)
 	frontierStart := mc.IndexHeaderStart() + bloomRegionBytes
 	leafTableStart := frontierStart + uint64(urkle.FrontierStateV1Bytes)
 	nodeStoreStart := leafTableStart + urkle.LeafTableBytes(leafCount)
@@ -204,6 +201,7 @@ func (mc MassifContext) UrkleNodeStoreRegion() ([]byte, error) {
 }
 
 // UpdateBloomFilters updates any combination of the 4 parallel bloom filters based on extraData.
+// The region is updated in the format its header records, V1 or V2.
 //
 // - Filter 0 is always updated:
 //   - if extraData[0] is nil or not provided, valueBytes is inserted
@@ -213,6 +211,9 @@ func (mc MassifContext) UrkleNodeStoreRegion() ([]byte, error) {
 //
 // Each inserted element must be exactly 32 bytes.
 func (mc *MassifContext) UpdateBloomFilters(valueBytes []byte, extraData ...[]byte) error {
+	if err := mc.checkWritable("bloom filters"); err != nil {
+		return err
+	}
 	if err := mc.requireV2Index(); err != nil {
 		return err
 	}
@@ -220,18 +221,19 @@ func (mc *MassifContext) UpdateBloomFilters(valueBytes []byte, extraData ...[]by
 		return fmt.Errorf("valueBytes must be %d bytes", ValueBytes)
 	}
 
-	leafCount := urkle.LeafCountForMassifHeight(mc.Start.MassifHeight)
-
 	region, err := mc.BloomRegion()
 	if err != nil {
 		return err
 	}
 
 	// Ensure initialized (should already be for freshly-created massifs).
-	if _, ok, err := bloom.DecodeHeaderV1(region); err != nil {
+	if ok, err := bloom.Initialized(region); err != nil {
 		return err
 	} else if !ok {
-		if err := bloom.InitV1(region, leafCount, BloomBitsPerElementV1, BloomKV1); err != nil {
+		if mc.undo != nil {
+			mc.undo.saveRegion(mc, region)
+		}
+		if err := mc.initBloomRegion(region); err != nil {
 			return err
 		}
 	}
@@ -241,7 +243,12 @@ func (mc *MassifContext) UpdateBloomFilters(valueBytes []byte, extraData ...[]by
 	if len(extraData) > 0 && extraData[0] != nil {
 		elem0 = extraData[0]
 	}
-	if err := bloom.InsertV1(region, 0, elem0); err != nil {
+	if mc.undo != nil {
+		if err := mc.undo.saveBloomInsert(mc, region, 0, elem0); err != nil {
+			return err
+		}
+	}
+	if err := bloom.Insert(region, 0, elem0); err != nil {
 		return err
 	}
 
@@ -251,7 +258,12 @@ func (mc *MassifContext) UpdateBloomFilters(valueBytes []byte, extraData ...[]by
 		if len(extraData) <= i || extraData[i] == nil {
 			continue
 		}
-		if err := bloom.InsertV1(region, filterIdx, extraData[i]); err != nil {
+		if mc.undo != nil {
+			if err := mc.undo.saveBloomInsert(mc, region, filterIdx, extraData[i]); err != nil {
+				return err
+			}
+		}
+		if err := bloom.Insert(region, filterIdx, extraData[i]); err != nil {
 			return err
 		}
 	}
@@ -265,7 +277,13 @@ func (mc *MassifContext) UpdateBloomFilters(valueBytes []byte, extraData ...[]by
 // extraData semantics:\n
 // - extraData[0] is reserved for bloom0 override and is NOT stored in the leaf record.\n
 // - extraData[1], extraData[2], extraData[3] (if provided and non-nil) are stored as extra1..extra3.\n
+//
+// If mc.BindUrkleExtras is set the extras are also committed by the leaf hash,
+// see urkle.LeafHashV2.
 func (mc *MassifContext) InsertUrkleMonotone(key uint64, valueBytes []byte, extraData ...[]byte) (uint32, error) {
+	if err := mc.checkWritable("urkle trie"); err != nil {
+		return 0, err
+	}
 	if err := mc.requireV2Index(); err != nil {
 		return 0, err
 	}
@@ -290,21 +308,35 @@ func (mc *MassifContext) InsertUrkleMonotone(key uint64, valueBytes []byte, extr
 	if err != nil {
 		return 0, err
 	}
-
-	leafOrdinal, err := b.InsertMonotone(key, valueBytes)
-	if err != nil {
-		return 0, err
+	if mc.undo != nil {
+		mc.undo.saveUrkleInsert(mc, b.Frontier(), frontier, leafTable, nodeStore)
 	}
 
-	// Store the last 3 extra fields (skip the first).
-	for i := 1; i <= 3; i++ {
-		if len(extraData) <= i || extraData[i] == nil {
-			continue
-		}
+	// The last 3 extra fields (skip the first) are stored in the leaf record.
+	var stored [][]byte
+	for i := 1; i <= urkle.LeafExtraFields && i < len(extraData); i++ {
 		if len(extraData[i]) > ValueBytes {
 			return 0, fmt.Errorf("extraData[%d] too large: %d", i, len(extraData[i]))
 		}
-		urkle.LeafSetExtra(leafTable, leafOrdinal, uint8(i-1), extraData[i])
+		stored = append(stored, extraData[i])
+	}
+
+	var leafOrdinal uint32
+	if mc.BindUrkleExtras {
+		leafOrdinal, err = b.InsertMonotoneExtras(key, valueBytes, stored...)
+	} else {
+		leafOrdinal, err = b.InsertMonotone(key, valueBytes)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if !mc.BindUrkleExtras {
+		for i, extra := range stored {
+			if extra == nil {
+				continue
+			}
+			urkle.LeafSetExtra(leafTable, leafOrdinal, uint8(i), extra)
+		}
 	}
 
 	// Persist frontier for resumption.
@@ -0,0 +1,161 @@
+package massifs
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+)
+
+var (
+	ErrCheckpointRollback      = errors.New("the checkpoint is older than one previously seen for the log")
+	ErrLatestSeenLogIDRequired = errors.New("a log id is required to consult the latest seen store")
+)
+
+// LatestSeenStore records, per log, the largest checkpoint MMRSize a verifier
+// has accepted. Verification consults it to refuse a checkpoint smaller than
+// one already seen, which is how a rollback of the log by its storage
+// provider shows up. See WithLatestSeenStore.
+type LatestSeenStore struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]uint64
+}
+
+// NewLatestSeenStore returns an empty, in memory, store.
+func NewLatestSeenStore() *LatestSeenStore {
+	return &LatestSeenStore{entries: map[string]uint64{}}
+}
+
+// OpenLatestSeenStore loads the store persisted at path, if there is one.
+// Save writes the store back to the same path.
+func OpenLatestSeenStore(path string) (*LatestSeenStore, error) {
+	s := NewLatestSeenStore()
+	s.path = path
+
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		logHex, sizeStr, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("latest seen store %s: bad entry %q", path, line)
+		}
+		logID, err := hex.DecodeString(logHex)
+		if err != nil {
+			return nil, fmt.Errorf("latest seen store %s: bad entry %q", path, line)
+		}
+		size, err := strconv.ParseUint(sizeStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("latest seen store %s: bad entry %q", path, line)
+		}
+		s.entries[string(logID)] = size
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// LatestSeen returns the largest MMRSize accepted for the log, ok is false if
+// none has been recorded.
+func (s *LatestSeenStore) LatestSeen(logID storage.LogID) (mmrSize uint64, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mmrSize, ok = s.entries[string(logID)]
+	return mmrSize, ok
+}
+
+// Observe records mmrSize for the log if it is larger than the latest seen.
+func (s *LatestSeenStore) Observe(logID storage.LogID, mmrSize uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if mmrSize > s.entries[string(logID)] {
+		s.entries[string(logID)] = mmrSize
+	}
+}
+
+// Reset replaces the latest seen MMRSize for the log, even if it is smaller.
+// It is for intentional restores, when the log has deliberately been rolled
+// back.
+func (s *LatestSeenStore) Reset(logID storage.LogID, mmrSize uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[string(logID)] = mmrSize
+}
+
+// check returns ErrCheckpointRollback if a checkpoint for massifIndex, sealing
+// mmrSize, is older than the latest seen. Checkpoints for earlier massifs
+// legitimately seal smaller sizes, so the latest seen is capped at the size of
+// the complete massif.
+func (s *LatestSeenStore) check(logID storage.LogID, massifHeight uint8, massifIndex uint32, mmrSize uint64) error {
+	latest, ok := s.LatestSeen(logID)
+	if !ok {
+		return nil
+	}
+	limit := min(latest, MassifFirstLeaf(massifHeight, massifIndex+1))
+	if mmrSize < limit {
+		return fmt.Errorf("%w: massif %d MMR size %d < %d", ErrCheckpointRollback, massifIndex, mmrSize, limit)
+	}
+	return nil
+}
+
+// Save persists the store to the path it was opened from, replacing the file
+// atomically. It is a no-op for an in memory store.
+func (s *LatestSeenStore) Save() error {
+	if s.path == "" {
+		return nil
+	}
+	s.mu.Lock()
+	lines := make([]string, 0, len(s.entries))
+	for logID, size := range s.entries {
+		lines = append(lines, hex.EncodeToString([]byte(logID))+" "+strconv.FormatUint(size, 10))
+	}
+	s.mu.Unlock()
+	sort.Strings(lines)
+
+	f, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	w := bufio.NewWriter(f)
+	for _, line := range lines {
+		if _, err = w.WriteString(line + "\n"); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, s.path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
+}
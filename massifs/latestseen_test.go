@@ -0,0 +1,82 @@
+package massifs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatestSeenStore_DetectsRollback(t *testing.T) {
+	ctx := context.Background()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	verifier := newES256Verifier(t, &key.PublicKey)
+
+	// The leaves are deterministic, so the shorter log is a prefix of the
+	// longer, and its head checkpoint is an older, valid, checkpoint for the
+	// longer log's head massif.
+	older := buildSealedLogWithKey(t, key, 3, 5)
+	store := buildSealedLogWithKey(t, key, 3, 6)
+	olderCheck, err := GetCheckpoint(ctx, older, 1)
+	require.NoError(t, err)
+
+	logID := []byte("log-1")
+	seen := NewLatestSeenStore()
+
+	vc, err := GetContextVerified(ctx, store, verifier, 1, WithLatestSeenStore(seen, logID))
+	require.NoError(t, err)
+	latest, ok := seen.LatestSeen(logID)
+	require.True(t, ok)
+	require.Equal(t, vc.Checkpoint.MMRSize, latest)
+	require.Greater(t, latest, olderCheck.MMRSize)
+
+	// A complete earlier massif legitimately seals a smaller size
+	_, err = GetContextVerified(ctx, store, verifier, 0, WithLatestSeenStore(seen, logID))
+	require.NoError(t, err)
+
+	_, err = GetContextVerified(ctx, store, verifier, 1,
+		WithLatestSeenStore(seen, logID), WithVerifyCheckpoint(&olderCheck))
+	require.ErrorIs(t, err, ErrCheckpointRollback)
+
+	// Other logs are unaffected
+	_, err = GetContextVerified(ctx, store, verifier, 1,
+		WithLatestSeenStore(seen, []byte("log-2")), WithVerifyCheckpoint(&olderCheck))
+	require.NoError(t, err)
+
+	// An intentional restore resets the latest seen state
+	_, err = GetContextVerified(ctx, store, verifier, 1,
+		WithLatestSeenStore(seen, logID), WithVerifyCheckpoint(&olderCheck), WithAllowRollback())
+	require.NoError(t, err)
+	latest, _ = seen.LatestSeen(logID)
+	require.Equal(t, olderCheck.MMRSize, latest)
+
+	_, err = GetContextVerified(ctx, store, verifier, 1, WithLatestSeenStore(seen, nil))
+	require.ErrorIs(t, err, ErrLatestSeenLogIDRequired)
+}
+
+func TestLatestSeenStore_SaveAndOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "latest-seen")
+
+	seen, err := OpenLatestSeenStore(path)
+	require.NoError(t, err)
+	seen.Observe([]byte("log-1"), 10)
+	seen.Observe([]byte("log-1"), 7)
+	seen.Observe([]byte("log-2"), 3)
+	require.NoError(t, seen.Save())
+
+	reopened, err := OpenLatestSeenStore(path)
+	require.NoError(t, err)
+	size, ok := reopened.LatestSeen([]byte("log-1"))
+	require.True(t, ok)
+	require.Equal(t, uint64(10), size)
+	size, ok = reopened.LatestSeen([]byte("log-2"))
+	require.True(t, ok)
+	require.Equal(t, uint64(3), size)
+	_, ok = reopened.LatestSeen([]byte("log-3"))
+	require.False(t, ok)
+}
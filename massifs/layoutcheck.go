@@ -0,0 +1,79 @@
+package massifs
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrRegionOverlap = errors.New("massif regions overlap")
+	ErrRegionBounds  = errors.New("massif region exceeds the data")
+)
+
+// RegionError identifies the region of a massif whose bounds, as derived from
+// the start header, are invalid, or whose content fails its integrity check.
+// It unwraps to ErrRegionOverlap, ErrRegionBounds or ErrIntegrityMismatch.
+type RegionError struct {
+	Err         error
+	MassifIndex uint32
+	Region      FormatRegion
+	// Other is the region overlapped, it is only set for ErrRegionOverlap
+	Other   *FormatRegion
+	DataLen uint64
+}
+
+func (e *RegionError) Error() string {
+	if e.Other != nil {
+		return fmt.Sprintf("%v: massif %d %s [%d, %d) overlaps %s [%d, %d)",
+			e.Err, e.MassifIndex, e.Region.Name, e.Region.Offset, e.Region.End(),
+			e.Other.Name, e.Other.Offset, e.Other.End())
+	}
+	return fmt.Sprintf("%v: massif %d %s [%d, %d), data length %d",
+		e.Err, e.MassifIndex, e.Region.Name, e.Region.Offset, e.Region.End(), e.DataLen)
+}
+
+func (e *RegionError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateLayout checks the regions of the massif, derived from its start
+// header by Format, are disjoint and fit the data. Every region before the
+// log must be wholly present, and the log must be whole entries no more than
+// the massif holds once complete. The offset arithmetic trusts the header
+// fields, so without this check a corrupt header can make regions alias each
+// other.
+func (mc MassifContext) ValidateLayout() error {
+	f, err := mc.Format()
+	if err != nil {
+		return fmt.Errorf("%w: massif %d: %v", ErrRegionBounds, mc.Start.MassifIndex, err)
+	}
+	dataLen := uint64(len(mc.Data))
+	regionErr := func(err error, r FormatRegion, other *FormatRegion) error {
+		return &RegionError{Err: err, MassifIndex: mc.Start.MassifIndex, Region: r, Other: other, DataLen: dataLen}
+	}
+
+	for i, r := range f.Regions {
+		// A region too large for the arithmetic wraps round onto the regions
+		// before it
+		if r.End() < r.Offset {
+			return regionErr(ErrRegionOverlap, r, &f.Regions[0])
+		}
+		if i > 0 && r.Offset < f.Regions[i-1].End() {
+			return regionErr(ErrRegionOverlap, r, &f.Regions[i-1])
+		}
+		if r.Name == RegionLog {
+			if dataLen < r.Offset || dataLen > r.End() || (dataLen-r.Offset)%ValueBytes != 0 {
+				return regionErr(ErrRegionBounds, r, nil)
+			}
+			continue
+		}
+		if r.End() > dataLen {
+			return regionErr(ErrRegionBounds, r, nil)
+		}
+	}
+	if logStart := f.Regions[len(f.Regions)-1].Offset; logStart != mc.LogStart() {
+		return fmt.Errorf("%w: massif %d log starts at %d, expected %d",
+			ErrRegionBounds, mc.Start.MassifIndex, mc.LogStart(), logStart)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package massifs
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateLayout(t *testing.T) {
+	ctx := context.Background()
+	store, _ := buildSealedLog(t, 3, 6)
+	for i := range uint32(2) {
+		mc, err := GetMassifContext(ctx, store, i)
+		require.NoError(t, err)
+		require.NoError(t, mc.ValidateLayout())
+	}
+
+	corrupt := func(massifIndex uint32, edit func([]byte) []byte) error {
+		data := edit(append([]byte(nil), store.massifs[massifIndex]...))
+		mc := MassifContext{MassifData: MassifData{Data: data}, Start: MakeMassifStart(data)}
+		return mc.ValidateLayout()
+	}
+	requireRegionErr := func(err, target error, region string) {
+		t.Helper()
+		require.ErrorIs(t, err, target)
+		var regionErr *RegionError
+		require.True(t, errors.As(err, &regionErr))
+		require.Equal(t, region, regionErr.Region.Name)
+	}
+
+	// a taller massif has a larger index, which runs past the data
+	err := corrupt(0, func(b []byte) []byte {
+		b[MassifStartKeyMassifHeightFirstByte] = 12
+		return b
+	})
+	requireRegionErr(err, ErrRegionBounds, RegionBloomBitsets)
+
+	err = corrupt(1, func(b []byte) []byte { return b[:StartHeaderEnd+IndexHeaderBytes+8] })
+	requireRegionErr(err, ErrRegionBounds, RegionBloomBitsets)
+
+	// massif 0 is complete, it can hold no more entries
+	err = corrupt(0, func(b []byte) []byte { return append(b, make([]byte, ValueBytes)...) })
+	requireRegionErr(err, ErrRegionBounds, RegionLog)
+
+	err = corrupt(1, func(b []byte) []byte { return b[:len(b)-1] })
+	requireRegionErr(err, ErrRegionBounds, RegionLog)
+
+	err = corrupt(1, func(b []byte) []byte {
+		b[MassifStartKeyMassifHeightFirstByte] = MaxMassifHeightV2 + 1
+		return b
+	})
+	require.ErrorIs(t, err, ErrRegionBounds)
+
+	// a legacy massif whose index implies a larger peak stack
+	legacy := buildLegacyBlobMassif0(t, 0, 3, 2)
+	require.NoError(t, legacy.ValidateLayout())
+	binary.BigEndian.PutUint32(legacy.Data[MassifStartKeyMassifFirstByte:MassifStartKeyMassifEnd], 1<<20-1)
+	legacy.Start = MakeMassifStart(legacy.Data)
+	requireRegionErr(legacy.ValidateLayout(), ErrRegionBounds, RegionPeakStack)
+
+	// the offsets of a legacy massif of the largest height overflow
+	legacy = buildLegacyBlobMassif0(t, 1, 3, 2)
+	legacy.Data[MassifStartKeyMassifHeightFirstByte] = MaxMMRHeight
+	legacy.Start = MakeMassifStart(legacy.Data)
+	requireRegionErr(legacy.ValidateLayout(), ErrRegionOverlap, RegionLog)
+
+	// GetMassifContext refuses the corrupt massif
+	store.massifs[0][MassifStartKeyMassifHeightFirstByte] = 12
+	_, err = GetMassifContext(ctx, store, 0)
+	require.ErrorIs(t, err, ErrRegionBounds)
+}
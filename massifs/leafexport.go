@@ -0,0 +1,484 @@
+package massifs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/forestrie/go-merklelog/urkle"
+	"github.com/veraison/go-cose"
+)
+
+// LeafExportFormat selects the encoding of a leaf export.
+type LeafExportFormat int
+
+const (
+	// LeafExportCSV writes a header row, a row per leaf, and a final row
+	// holding the footer, whose first field is LeafExportFooterTag.
+	LeafExportCSV LeafExportFormat = iota
+	// LeafExportJSONL writes a JSON object per leaf, one per line, followed
+	// by a line holding the footer object under the key "footer".
+	LeafExportJSONL
+)
+
+// LeafExportFooterTag marks the footer row of a CSV leaf export
+const LeafExportFooterTag = "#footer"
+
+var (
+	ErrLeafExportRange    = errors.New("the leaf range is not sealed in the log")
+	ErrLeafExportInvalid  = errors.New("the leaf export is malformed")
+	ErrLeafExportMismatch = errors.New("the leaf export does not match the log")
+)
+
+var leafExportCSVHeader = []string{"mmr_index", "leaf_index", "idtimestamp", "value", "extra0", "extra1", "extra2"}
+
+// LeafExportRow is one leaf of an export. Value is the leaf node, and
+// IDTimestamp and Extras are its Urkle trie entry. The trie key itself is
+// only in the export if the leaf stored it as an extra.
+type LeafExportRow struct {
+	MMRIndex    uint64
+	LeafIndex   uint64
+	IDTimestamp uint64
+	Value       []byte
+	Extras      [urkle.LeafExtraFields][]byte
+}
+
+// LeafExportFooter identifies the sealed state the rows were exported from.
+// Every row is included in the accumulator.
+type LeafExportFooter struct {
+	// MassifIndex is the massif of the checkpoint
+	MassifIndex uint32
+	MMRSize     uint64
+	Accumulator [][]byte
+	// CheckpointSHA256 is the digest of the checkpoint object
+	CheckpointSHA256 []byte
+}
+
+// ExportLeaves writes the leaves firstLeaf to lastLeaf, inclusive, to w in
+// the format, followed by the footer. The latest checkpoint is verified
+// first, and every leaf in the range must be sealed by it. The options are
+// those of GetContextVerified. Only massifs in the current format can be
+// exported.
+func ExportLeaves(
+	ctx context.Context, reader ObjectReader, verifier cose.Verifier,
+	w io.Writer, format LeafExportFormat, firstLeaf, lastLeaf uint64, opts ...Option,
+) (*LeafExportFooter, error) {
+	if lastLeaf < firstLeaf {
+		return nil, fmt.Errorf("%w: leaves %d to %d", ErrLeafExportRange, firstLeaf, lastLeaf)
+	}
+	head, err := reader.HeadIndex(ctx, storage.ObjectCheckpoint)
+	if err != nil {
+		return nil, err
+	}
+	verified, err := GetContextVerified(ctx, reader, verifier, head, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to get verified context %d", err, head)
+	}
+	if mmr.MMRIndex(lastLeaf) >= verified.Checkpoint.MMRSize {
+		return nil, fmt.Errorf("%w: leaf %d, sealed size %d",
+			ErrLeafExportRange, lastLeaf, verified.Checkpoint.MMRSize)
+	}
+
+	enc, err := newLeafExportEncoder(w, format)
+	if err != nil {
+		return nil, err
+	}
+	var mc MassifContext
+	for leafIndex := firstLeaf; leafIndex <= lastLeaf; leafIndex++ {
+		massifIndex := uint32(MassifIndexFromLeafIndex(verified.Start.MassifHeight, leafIndex))
+		if mc.Data == nil || mc.Start.MassifIndex != massifIndex {
+			if massifIndex == head {
+				mc = verified.MassifContext
+			} else if mc, err = GetMassifContext(ctx, reader, massifIndex); err != nil {
+				return nil, err
+			}
+		}
+		row, err := leafExportRow(&mc, leafIndex)
+		if err != nil {
+			return nil, err
+		}
+		if err = enc.row(row); err != nil {
+			return nil, err
+		}
+	}
+
+	sum := sha256.Sum256(verified.Checkpoint.Raw)
+	footer := &LeafExportFooter{
+		MassifIndex:      head,
+		MMRSize:          verified.Checkpoint.MMRSize,
+		Accumulator:      verified.Accumulator,
+		CheckpointSHA256: sum[:],
+	}
+	if err = enc.footer(footer); err != nil {
+		return nil, err
+	}
+	return footer, enc.flush()
+}
+
+// VerifyLeafExport re-checks an export against the log. The latest
+// checkpoint is verified, and the footer accumulator must be the log's
+// accumulator for the footer size. Then sample rows, chosen at random, are
+// checked against the Urkle trie entries of the log, and each leaf value is
+// proven included in the footer accumulator. If sample is zero, or not less
+// than the number of rows, every row is checked.
+//
+// The footer is returned. A row that does not match the log is reported with
+// ErrLeafExportMismatch.
+func VerifyLeafExport(
+	ctx context.Context, reader ObjectReader, verifier cose.Verifier,
+	r io.Reader, format LeafExportFormat, sample int, opts ...Option,
+) (*LeafExportFooter, error) {
+	rows, footer, err := decodeLeafExport(r, format)
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := reader.HeadIndex(ctx, storage.ObjectCheckpoint)
+	if err != nil {
+		return nil, err
+	}
+	verified, err := GetContextVerified(ctx, reader, verifier, head, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to get verified context %d", err, head)
+	}
+	if footer.MMRSize == 0 || footer.MMRSize > verified.Checkpoint.MMRSize {
+		return nil, fmt.Errorf("%w: footer size %d, sealed size %d",
+			ErrLeafExportMismatch, footer.MMRSize, verified.Checkpoint.MMRSize)
+	}
+	store := newLogNodeStore(ctx, reader)
+	store.massifs[head] = &verified.MassifContext
+	peaks, err := mmr.PeakHashes(store, footer.MMRSize-1)
+	if err != nil {
+		return nil, err
+	}
+	if len(peaks) != len(footer.Accumulator) {
+		return nil, fmt.Errorf("%w: footer accumulator", ErrLeafExportMismatch)
+	}
+	for i := range peaks {
+		if !bytes.Equal(peaks[i], footer.Accumulator[i]) {
+			return nil, fmt.Errorf("%w: footer accumulator", ErrLeafExportMismatch)
+		}
+	}
+
+	checked := rows
+	if sample > 0 && sample < len(rows) {
+		checked = make([]LeafExportRow, 0, sample)
+		for _, i := range rand.Perm(len(rows))[:sample] {
+			checked = append(checked, rows[i])
+		}
+	}
+	for _, row := range checked {
+		if row.MMRIndex != mmr.MMRIndex(row.LeafIndex) || row.MMRIndex >= footer.MMRSize {
+			return nil, fmt.Errorf("%w: leaf %d, mmr index %d", ErrLeafExportMismatch, row.LeafIndex, row.MMRIndex)
+		}
+		massifIndex := uint32(MassifIndexFromLeafIndex(verified.Start.MassifHeight, row.LeafIndex))
+		mc, err := store.massif(massifIndex)
+		if err != nil {
+			return nil, err
+		}
+		want, err := leafExportRow(mc, row.LeafIndex)
+		if err != nil {
+			return nil, err
+		}
+		if !leafExportRowEqual(row, want) {
+			return nil, fmt.Errorf("%w: leaf %d", ErrLeafExportMismatch, row.LeafIndex)
+		}
+		proof, err := mmr.InclusionProof(store, footer.MMRSize-1, row.MMRIndex)
+		if err != nil {
+			return nil, err
+		}
+		if err = verifyAccumulatorInclusion(
+			footer.MMRSize, footer.Accumulator, row.MMRIndex, row.Value, proof); err != nil {
+			return nil, fmt.Errorf("%w: leaf %d: %v", ErrLeafExportMismatch, row.LeafIndex, err)
+		}
+	}
+	return footer, nil
+}
+
+// leafExportRow reads the row for the leaf from its massif
+func leafExportRow(mc *MassifContext, leafIndex uint64) (LeafExportRow, error) {
+	if err := mc.requireV2Index(); err != nil {
+		return LeafExportRow{}, err
+	}
+	leafTable, err := mc.UrkleLeafTableRegion()
+	if err != nil {
+		return LeafExportRow{}, err
+	}
+	firstLeaf := mmr.LeafCount(mc.Start.FirstIndex)
+	if leafIndex < firstLeaf || leafIndex-firstLeaf >= mc.MassifLeafCount() {
+		return LeafExportRow{}, fmt.Errorf("%w: leaf %d is not in massif %d",
+			ErrLeafExportRange, leafIndex, mc.Start.MassifIndex)
+	}
+	ordinal := uint32(leafIndex - firstLeaf)
+	row := LeafExportRow{
+		MMRIndex:    mmr.MMRIndex(leafIndex),
+		LeafIndex:   leafIndex,
+		IDTimestamp: urkle.LeafKey(leafTable, ordinal),
+	}
+	node, err := mc.Get(row.MMRIndex)
+	if err != nil {
+		return LeafExportRow{}, err
+	}
+	row.Value = bytes.Clone(node)
+	for i, extra := range urkle.LeafExtras(leafTable, ordinal) {
+		row.Extras[i] = bytes.Clone(extra[:])
+	}
+	return row, nil
+}
+
+func leafExportRowEqual(a, b LeafExportRow) bool {
+	if a.MMRIndex != b.MMRIndex || a.LeafIndex != b.LeafIndex || a.IDTimestamp != b.IDTimestamp {
+		return false
+	}
+	if !bytes.Equal(a.Value, b.Value) {
+		return false
+	}
+	for i := range a.Extras {
+		if !bytes.Equal(a.Extras[i], b.Extras[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// leafExportJSON is the JSONL encoding of a row, with the bytes as hex
+type leafExportJSON struct {
+	MMRIndex    uint64   `json:"mmr_index"`
+	LeafIndex   uint64   `json:"leaf_index"`
+	IDTimestamp uint64   `json:"idtimestamp"`
+	Value       string   `json:"value"`
+	Extras      []string `json:"extras"`
+}
+
+// leafExportFooterJSON is the JSONL encoding of the footer
+type leafExportFooterJSON struct {
+	MassifIndex      uint32   `json:"massif_index"`
+	MMRSize          uint64   `json:"mmr_size"`
+	Accumulator      []string `json:"accumulator"`
+	CheckpointSHA256 string   `json:"checkpoint_sha256"`
+}
+
+type leafExportEncoder struct {
+	format LeafExportFormat
+	csv    *csv.Writer
+	buf    *bufio.Writer
+	json   *json.Encoder
+}
+
+func newLeafExportEncoder(w io.Writer, format LeafExportFormat) (*leafExportEncoder, error) {
+	enc := &leafExportEncoder{format: format}
+	switch format {
+	case LeafExportCSV:
+		enc.csv = csv.NewWriter(w)
+		return enc, enc.csv.Write(leafExportCSVHeader)
+	case LeafExportJSONL:
+		enc.buf = bufio.NewWriter(w)
+		enc.json = json.NewEncoder(enc.buf)
+		return enc, nil
+	default:
+		return nil, fmt.Errorf("%w: format %d", ErrLeafExportInvalid, format)
+	}
+}
+
+func (enc *leafExportEncoder) row(row LeafExportRow) error {
+	if enc.format == LeafExportCSV {
+		record := []string{
+			strconv.FormatUint(row.MMRIndex, 10),
+			strconv.FormatUint(row.LeafIndex, 10),
+			strconv.FormatUint(row.IDTimestamp, 10),
+			hex.EncodeToString(row.Value),
+		}
+		for _, extra := range row.Extras {
+			record = append(record, hex.EncodeToString(extra))
+		}
+		return enc.csv.Write(record)
+	}
+	out := leafExportJSON{
+		MMRIndex:    row.MMRIndex,
+		LeafIndex:   row.LeafIndex,
+		IDTimestamp: row.IDTimestamp,
+		Value:       hex.EncodeToString(row.Value),
+	}
+	for _, extra := range row.Extras {
+		out.Extras = append(out.Extras, hex.EncodeToString(extra))
+	}
+	return enc.json.Encode(out)
+}
+
+func (enc *leafExportEncoder) footer(footer *LeafExportFooter) error {
+	accumulator := make([]string, len(footer.Accumulator))
+	for i, peak := range footer.Accumulator {
+		accumulator[i] = hex.EncodeToString(peak)
+	}
+	if enc.format == LeafExportCSV {
+		return enc.csv.Write([]string{
+			LeafExportFooterTag,
+			strconv.FormatUint(uint64(footer.MassifIndex), 10),
+			strconv.FormatUint(footer.MMRSize, 10),
+			hex.EncodeToString(footer.CheckpointSHA256),
+			strings.Join(accumulator, " "),
+		})
+	}
+	return enc.json.Encode(map[string]leafExportFooterJSON{"footer": {
+		MassifIndex:      footer.MassifIndex,
+		MMRSize:          footer.MMRSize,
+		Accumulator:      accumulator,
+		CheckpointSHA256: hex.EncodeToString(footer.CheckpointSHA256),
+	}})
+}
+
+func (enc *leafExportEncoder) flush() error {
+	if enc.format == LeafExportCSV {
+		enc.csv.Flush()
+		return enc.csv.Error()
+	}
+	return enc.buf.Flush()
+}
+
+// decodeLeafExport reads all the rows and the footer of an export
+func decodeLeafExport(r io.Reader, format LeafExportFormat) ([]LeafExportRow, *LeafExportFooter, error) {
+	switch format {
+	case LeafExportCSV:
+		return decodeLeafExportCSV(r)
+	case LeafExportJSONL:
+		return decodeLeafExportJSONL(r)
+	default:
+		return nil, nil, fmt.Errorf("%w: format %d", ErrLeafExportInvalid, format)
+	}
+}
+
+func decodeLeafExportCSV(r io.Reader) ([]LeafExportRow, *LeafExportFooter, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrLeafExportInvalid, err)
+	}
+	if len(records) < 2 || strings.Join(records[0], ",") != strings.Join(leafExportCSVHeader, ",") {
+		return nil, nil, fmt.Errorf("%w: missing header or footer", ErrLeafExportInvalid)
+	}
+	last := records[len(records)-1]
+	if len(last) != 5 || last[0] != LeafExportFooterTag {
+		return nil, nil, fmt.Errorf("%w: missing footer", ErrLeafExportInvalid)
+	}
+	var massifIndex uint64
+	footer := &LeafExportFooter{}
+	massifIndex, err = strconv.ParseUint(last[1], 10, 32)
+	if err == nil {
+		footer.MassifIndex = uint32(massifIndex)
+		footer.MMRSize, err = strconv.ParseUint(last[2], 10, 64)
+	}
+	if err == nil {
+		footer.CheckpointSHA256, err = hex.DecodeString(last[3])
+	}
+	if err == nil {
+		footer.Accumulator, err = decodeHexList(strings.Fields(last[4]))
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: footer: %v", ErrLeafExportInvalid, err)
+	}
+
+	rows := make([]LeafExportRow, 0, len(records)-2)
+	for i, record := range records[1 : len(records)-1] {
+		if len(record) != len(leafExportCSVHeader) {
+			return nil, nil, fmt.Errorf("%w: row %d", ErrLeafExportInvalid, i)
+		}
+		var row LeafExportRow
+		row.MMRIndex, err = strconv.ParseUint(record[0], 10, 64)
+		if err == nil {
+			row.LeafIndex, err = strconv.ParseUint(record[1], 10, 64)
+		}
+		if err == nil {
+			row.IDTimestamp, err = strconv.ParseUint(record[2], 10, 64)
+		}
+		var values [][]byte
+		if err == nil {
+			values, err = decodeHexList(record[3:])
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: row %d: %v", ErrLeafExportInvalid, i, err)
+		}
+		row.Value = values[0]
+		copy(row.Extras[:], values[1:])
+		rows = append(rows, row)
+	}
+	return rows, footer, nil
+}
+
+func decodeLeafExportJSONL(r io.Reader) ([]LeafExportRow, *LeafExportFooter, error) {
+	var rows []LeafExportRow
+	var footer *LeafExportFooter
+	dec := json.NewDecoder(r)
+	for dec.More() {
+		if footer != nil {
+			return nil, nil, fmt.Errorf("%w: content after the footer", ErrLeafExportInvalid)
+		}
+		var line struct {
+			leafExportJSON
+			Footer *leafExportFooterJSON `json:"footer"`
+		}
+		if err := dec.Decode(&line); err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrLeafExportInvalid, err)
+		}
+		if line.Footer != nil {
+			accumulator, err := decodeHexList(line.Footer.Accumulator)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%w: footer: %v", ErrLeafExportInvalid, err)
+			}
+			sum, err := hex.DecodeString(line.Footer.CheckpointSHA256)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%w: footer: %v", ErrLeafExportInvalid, err)
+			}
+			footer = &LeafExportFooter{
+				MassifIndex:      line.Footer.MassifIndex,
+				MMRSize:          line.Footer.MMRSize,
+				Accumulator:      accumulator,
+				CheckpointSHA256: sum,
+			}
+			continue
+		}
+		if len(line.Extras) != urkle.LeafExtraFields {
+			return nil, nil, fmt.Errorf("%w: row %d extras", ErrLeafExportInvalid, len(rows))
+		}
+		values, err := decodeHexList(append([]string{line.Value}, line.Extras...))
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: row %d: %v", ErrLeafExportInvalid, len(rows), err)
+		}
+		row := LeafExportRow{
+			MMRIndex:    line.MMRIndex,
+			LeafIndex:   line.LeafIndex,
+			IDTimestamp: line.IDTimestamp,
+			Value:       values[0],
+		}
+		copy(row.Extras[:], values[1:])
+		rows = append(rows, row)
+	}
+	if footer == nil {
+		return nil, nil, fmt.Errorf("%w: missing footer", ErrLeafExportInvalid)
+	}
+	return rows, footer, nil
+}
+
+func decodeHexList(values []string) ([][]byte, error) {
+	out := make([][]byte, len(values))
+	for i, v := range values {
+		b, err := hex.DecodeString(v)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = b
+	}
+	return out, nil
+}
@@ -0,0 +1,51 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportLeaves(t *testing.T) {
+	ctx := context.Background()
+	store, verifier := buildTrieKeyLog(t, 3, 11)
+
+	for _, format := range []LeafExportFormat{LeafExportCSV, LeafExportJSONL} {
+		var b bytes.Buffer
+		footer, err := ExportLeaves(ctx, store, verifier, &b, format, 2, 9)
+		require.NoError(t, err)
+		require.Equal(t, uint32(2), footer.MassifIndex)
+		export := b.String()
+		require.Contains(t, export, hex.EncodeToString(testTrieKey(5)))
+
+		got, err := VerifyLeafExport(ctx, store, verifier, strings.NewReader(export), format, 0)
+		require.NoError(t, err)
+		require.Equal(t, footer, got)
+		_, err = VerifyLeafExport(ctx, store, verifier, strings.NewReader(export), format, 3)
+		require.NoError(t, err)
+
+		rows, _, err := decodeLeafExport(strings.NewReader(export), format)
+		require.NoError(t, err)
+		require.Len(t, rows, 8)
+		require.Equal(t, uint64(2), rows[0].LeafIndex)
+		require.Equal(t, uint64(3), rows[0].IDTimestamp)
+		require.Equal(t, testTrieKey(2), rows[0].Extras[1])
+
+		// a row which does not match the log is caught
+		tampered := strings.Replace(export, hex.EncodeToString(testTrieKey(5)), hex.EncodeToString(testTrieKey(6)), 1)
+		_, err = VerifyLeafExport(ctx, store, verifier, strings.NewReader(tampered), format, 0)
+		require.ErrorIs(t, err, ErrLeafExportMismatch)
+
+		// the footer is required
+		truncated := export[:strings.LastIndex(strings.TrimSuffix(export, "\n"), "\n")+1]
+		_, err = VerifyLeafExport(ctx, store, verifier, strings.NewReader(truncated), format, 0)
+		require.ErrorIs(t, err, ErrLeafExportInvalid)
+	}
+
+	_, err := ExportLeaves(ctx, store, verifier, &bytes.Buffer{}, LeafExportCSV, 0, 11)
+	require.ErrorIs(t, err, ErrLeafExportRange)
+}
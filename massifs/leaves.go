@@ -0,0 +1,69 @@
+package massifs
+
+import (
+	"fmt"
+	"iter"
+
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/forestrie/go-merklelog/urkle"
+)
+
+// MassifLeaf is a leaf of a massif with its Urkle trie entry, see
+// MassifContext.Leaves
+type MassifLeaf struct {
+	LeafIndex uint64
+	MMRIndex  uint64
+	// Value is the leaf node in the log. It aliases the massif data, clone it
+	// to keep it beyond changes to the massif.
+	Value []byte
+	// IDTimestamp is the key of the leaf's trie entry
+	IDTimestamp uint64
+	// TrieKey is the content hash stored in the trie entry, GetLeafByTrieKey
+	// finds leaves by it or by one of the Extras
+	TrieKey [urkle.HashBytes]byte
+	// Extras are the stored extra fields, zero if unset
+	Extras [urkle.LeafExtraFields][urkle.HashBytes]byte
+}
+
+// Leaves returns an iterator over the leaves of the massif, in order. Only
+// massifs in the current format have the trie entries it needs.
+func (mc *MassifContext) Leaves() (iter.Seq[MassifLeaf], error) {
+	firstLeaf := mmr.LeafCount(mc.Start.FirstIndex)
+	return mc.LeafRange(firstLeaf, firstLeaf+mc.MassifLeafCount())
+}
+
+// LeafRange returns an iterator over the leaves from, to to exclusive, in
+// order. from and to are leaf indices in the whole log, the range must be in
+// the massif, otherwise ErrLeafRange is returned.
+func (mc *MassifContext) LeafRange(from, to uint64) (iter.Seq[MassifLeaf], error) {
+	if err := mc.requireV2Index(); err != nil {
+		return nil, err
+	}
+	leafTable, err := mc.UrkleLeafTableRegion()
+	if err != nil {
+		return nil, err
+	}
+	firstLeaf := mmr.LeafCount(mc.Start.FirstIndex)
+	if from > to || from < firstLeaf || to-firstLeaf > mc.MassifLeafCount() {
+		return nil, fmt.Errorf("%w: leaves %d to %d are not in massif %d",
+			ErrLeafRange, from, to, mc.Start.MassifIndex)
+	}
+	logData := mc.Data[mc.LogStart():]
+
+	return func(yield func(MassifLeaf) bool) {
+		for leafIndex := from; leafIndex < to; leafIndex++ {
+			ordinal := uint32(leafIndex - firstLeaf)
+			leaf := MassifLeaf{
+				LeafIndex:   leafIndex,
+				MMRIndex:    mmr.MMRIndex(leafIndex),
+				IDTimestamp: urkle.LeafKey(leafTable, ordinal),
+				TrieKey:     urkle.LeafValue(leafTable, ordinal),
+				Extras:      urkle.LeafExtras(leafTable, ordinal),
+			}
+			leaf.Value = IndexedLogValue(logData, leaf.MMRIndex-mc.Start.FirstIndex)
+			if !yield(leaf) {
+				return
+			}
+		}
+	}, nil
+}
@@ -0,0 +1,47 @@
+package massifs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMassifContextLeaves(t *testing.T) {
+	ctx := context.Background()
+	store, _ := buildSealedLog(t, 3, 10)
+	mc, err := GetMassifContext(ctx, store, 1)
+	require.NoError(t, err)
+
+	leaves, err := mc.Leaves()
+	require.NoError(t, err)
+	var indices []uint64
+	for leaf := range leaves {
+		indices = append(indices, leaf.LeafIndex)
+		require.Equal(t, mmr.MMRIndex(leaf.LeafIndex), leaf.MMRIndex)
+		row, err := leafExportRow(&mc, leaf.LeafIndex)
+		require.NoError(t, err)
+		require.Equal(t, row.Value, leaf.Value)
+		require.Equal(t, row.IDTimestamp, leaf.IDTimestamp)
+		for i := range leaf.Extras {
+			require.Equal(t, row.Extras[i], leaf.Extras[i][:])
+		}
+	}
+	require.Equal(t, []uint64{4, 5, 6, 7}, indices)
+
+	// the range is of log leaf indices, and stops when the loop does
+	leaves, err = mc.LeafRange(5, 7)
+	require.NoError(t, err)
+	indices = nil
+	for leaf := range leaves {
+		indices = append(indices, leaf.LeafIndex)
+		break
+	}
+	require.Equal(t, []uint64{5}, indices)
+
+	for _, r := range [][2]uint64{{3, 5}, {5, 9}, {6, 5}} {
+		_, err = mc.LeafRange(r[0], r[1])
+		require.ErrorIs(t, err, ErrLeafRange)
+	}
+}
@@ -36,7 +36,7 @@ func (m *memReader) HeadIndex(ctx context.Context, otype storage.ObjectType) (ui
 			}
 		}
 		if !ok {
-			return 0, storage.ErrLogEmpty
+			return 0, storage.NewLogEmptyError(nil)
 		}
 		return max, nil
 	case storage.ObjectCheckpoint:
@@ -49,7 +49,7 @@ func (m *memReader) HeadIndex(ctx context.Context, otype storage.ObjectType) (ui
 			}
 		}
 		if !ok {
-			return 0, storage.ErrDoesNotExist
+			return 0, storage.NewNotFoundError(nil, otype, storage.HeadMassifIndex)
 		}
 		return max, nil
 	default:
@@ -60,7 +60,7 @@ func (m *memReader) HeadIndex(ctx context.Context, otype storage.ObjectType) (ui
 func (m *memReader) MassifData(massifIndex uint32) ([]byte, bool, error) {
 	b, ok := m.massifs[massifIndex]
 	if !ok {
-		return nil, false, storage.ErrDoesNotExist
+		return nil, false, storage.NewNotFoundError(nil, storage.ObjectMassifData, massifIndex)
 	}
 	return b, true, nil
 }
@@ -68,7 +68,7 @@ func (m *memReader) MassifData(massifIndex uint32) ([]byte, bool, error) {
 func (m *memReader) CheckpointData(massifIndex uint32) ([]byte, bool, error) {
 	b, ok := m.checkpoint[massifIndex]
 	if !ok {
-		return nil, false, storage.ErrDoesNotExist
+		return nil, false, storage.NewNotFoundError(nil, storage.ObjectCheckpoint, massifIndex)
 	}
 	return b, true, nil
 }
@@ -77,7 +77,7 @@ func (m *memReader) MassifReadN(ctx context.Context, massifIndex uint32, n int)
 	_ = ctx
 	b, ok := m.massifs[massifIndex]
 	if !ok {
-		return nil, storage.ErrDoesNotExist
+		return nil, storage.NewNotFoundError(nil, storage.ObjectMassifData, massifIndex)
 	}
 	if n == -1 || n >= len(b) {
 		return b, nil
@@ -89,7 +89,7 @@ func (m *memReader) CheckpointRead(ctx context.Context, massifIndex uint32) ([]b
 	_ = ctx
 	b, ok := m.checkpoint[massifIndex]
 	if !ok {
-		return nil, storage.ErrDoesNotExist
+		return nil, storage.NewNotFoundError(nil, storage.ObjectCheckpoint, massifIndex)
 	}
 	return b, nil
 }
@@ -0,0 +1,123 @@
+package massifs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/veraison/go-cose"
+)
+
+var (
+	ErrLegacySealRootMissing  = errors.New("the legacy seal has no bagged root")
+	ErrLegacySealRootMismatch = errors.New("the accumulator does not bag to the legacy seal root")
+)
+
+// LegacySealState is the signed payload of a V0 seal, the checkpoint format
+// that predates accumulator based seals. V0 seals committed to a single
+// "bagged" root for the mmr: the peaks hashed together right to left (see
+// mmr.HashPeaksRHS). Old replicas, and the holders of receipts issued against
+// them, still carry these. The field labels are those of the V0 encoding.
+type LegacySealState struct {
+	Version         int    `cbor:"7,keyasint,omitempty"`
+	MMRSize         uint64 `cbor:"1,keyasint"`
+	LegacySealRoot  []byte `cbor:"2,keyasint"`
+	Timestamp       int64  `cbor:"3,keyasint"`
+	IDTimestamp     uint64 `cbor:"4,keyasint,omitempty"`
+	CommitmentEpoch uint32 `cbor:"6,keyasint,omitempty"`
+}
+
+// DecodeLegacySeal decodes a V0 seal, a COSE_Sign1 whose attached payload is
+// the CBOR encoded LegacySealState. The signature is not checked, see
+// VerifyLegacySeal.
+func DecodeLegacySeal(data []byte) (*cose.Sign1Message, LegacySealState, error) {
+	var msg cose.Sign1Message
+	if err := msg.UnmarshalCBOR(data); err != nil {
+		// legacy seals were not always tagged
+		if err = (*cose.UntaggedSign1Message)(&msg).UnmarshalCBOR(data); err != nil {
+			return nil, LegacySealState{}, fmt.Errorf("decode legacy seal: %w", err)
+		}
+	}
+	var state LegacySealState
+	if err := cbor.Unmarshal(msg.Payload, &state); err != nil {
+		return nil, LegacySealState{}, fmt.Errorf("decode legacy seal state: %w", err)
+	}
+	if len(state.LegacySealRoot) == 0 {
+		return nil, LegacySealState{}, ErrLegacySealRootMissing
+	}
+	return &msg, state, nil
+}
+
+// VerifyLegacySeal verifies a V0 seal against the log data. The accumulator
+// for the sealed size is read from the store and bagged, the result must
+// match the signed root, and the signature must verify.
+//
+// Returns the accumulator on success. Because it bags to the signed root, it
+// is as trustworthy as a format-v3 checkpoint accumulator, and modern
+// accumulator based proofs can be verified against it (see
+// VerifyInclusionLegacySeal).
+func VerifyLegacySeal(
+	store ConsistencyNodeStore, data []byte, verifier cose.Verifier,
+) (LegacySealState, [][]byte, error) {
+	if verifier == nil {
+		return LegacySealState{}, nil, ErrVerifierRequired
+	}
+	msg, state, err := DecodeLegacySeal(data)
+	if err != nil {
+		return LegacySealState{}, nil, err
+	}
+	if state.MMRSize == 0 {
+		return LegacySealState{}, nil, fmt.Errorf("%w: legacy seal commits to an empty mmr", ErrSealVerifyFailed)
+	}
+	accumulator, err := mmr.PeakHashes(store, state.MMRSize-1)
+	if err != nil {
+		return LegacySealState{}, nil, fmt.Errorf("accumulator for sealed size %d: %w", state.MMRSize, err)
+	}
+	if err = checkLegacySealRoot(state, accumulator); err != nil {
+		return LegacySealState{}, nil, err
+	}
+	if err = msg.Verify(nil, verifier); err != nil {
+		return LegacySealState{}, nil, fmt.Errorf(
+			"%w: legacy seal for sealed size %d: %v", ErrSealVerifyFailed, state.MMRSize, err)
+	}
+	return state, accumulator, nil
+}
+
+// VerifyInclusionLegacySeal verifies a modern (accumulator based) inclusion
+// proof for the node at mmrIndex against a verified V0 seal. The accumulator
+// need not come from the log, it only has to bag to the sealed root, so the
+// holder of an old receipt needs just the seal state and the peaks.
+func VerifyInclusionLegacySeal(
+	state LegacySealState, accumulator [][]byte, mmrIndex uint64, nodeHash []byte, proof [][]byte,
+) (bool, error) {
+	if err := checkLegacySealRoot(state, accumulator); err != nil {
+		return false, err
+	}
+	ipeak := mmr.PeakIndex(mmr.LeafCount(state.MMRSize), len(proof))
+	if ipeak >= len(accumulator) {
+		return false, fmt.Errorf(
+			"%w: accumulator index for proof out of range for the sealed mmr size", mmr.ErrVerifyInclusionFailed)
+	}
+	root := mmr.IncludedRoot(sha256.New(), mmrIndex, nodeHash, proof)
+	if !bytes.Equal(root, accumulator[ipeak]) {
+		return false, fmt.Errorf("%w: proven root not present in the accumulator", mmr.ErrVerifyInclusionFailed)
+	}
+	return true, nil
+}
+
+func checkLegacySealRoot(state LegacySealState, accumulator [][]byte) error {
+	if len(state.LegacySealRoot) == 0 {
+		return ErrLegacySealRootMissing
+	}
+	if len(accumulator) != len(mmr.Peaks(state.MMRSize-1)) {
+		return fmt.Errorf("%w: accumulator has %d peaks, sealed size %d requires %d",
+			ErrLegacySealRootMismatch, len(accumulator), state.MMRSize, len(mmr.Peaks(state.MMRSize-1)))
+	}
+	if !bytes.Equal(mmr.HashPeaksRHS(sha256.New(), accumulator), state.LegacySealRoot) {
+		return ErrLegacySealRootMismatch
+	}
+	return nil
+}
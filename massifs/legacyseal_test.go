@@ -0,0 +1,76 @@
+package massifs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+// signLegacySealV0 produces a V0 (bagged root) seal for the current state of mc
+func signLegacySealV0(t *testing.T, mc *MassifContext, root []byte) ([]byte, cose.Verifier) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := cose.NewSigner(cose.AlgorithmES256, key)
+	require.NoError(t, err)
+
+	payload, err := cbor.Marshal(LegacySealState{
+		MMRSize:        mc.RangeCount(),
+		LegacySealRoot: root,
+		Timestamp:      1,
+	})
+	require.NoError(t, err)
+
+	msg := cose.NewSign1Message()
+	msg.Headers.Protected.SetAlgorithm(cose.AlgorithmES256)
+	msg.Payload = payload
+	require.NoError(t, msg.Sign(rand.Reader, nil, signer))
+	data, err := msg.MarshalCBOR()
+	require.NoError(t, err)
+	return data, newES256Verifier(t, &key.PublicKey)
+}
+
+func TestVerifyLegacySeal(t *testing.T) {
+	mc := buildLegacyBlobMassif0(t, 0 /*blobVersion*/, 3 /*massifHeight*/, 3 /*leaves*/)
+	root, err := mmr.GetRoot(mc.RangeCount(), &mc, sha256.New())
+	require.NoError(t, err)
+	data, verifier := signLegacySealV0(t, &mc, root)
+
+	state, accumulator, err := VerifyLegacySeal(&mc, data, verifier)
+	require.NoError(t, err)
+	require.Equal(t, mc.RangeCount(), state.MMRSize)
+
+	// Modern accumulator based proofs verify against the bagged seal.
+	for _, leafIndex := range []uint64{0, 1, 2} {
+		mmrIndex := mmr.MMRIndex(leafIndex)
+		proof, err := mmr.InclusionProof(&mc, mc.RangeCount()-1, mmrIndex)
+		require.NoError(t, err)
+		leaf, err := mc.Get(mmrIndex)
+		require.NoError(t, err)
+		ok, err := VerifyInclusionLegacySeal(state, accumulator, mmrIndex, leaf, proof)
+		require.NoError(t, err)
+		require.True(t, ok)
+	}
+
+	// An accumulator that does not bag to the sealed root is rejected.
+	tampered := append([][]byte(nil), accumulator...)
+	tampered[0] = make([]byte, 32)
+	_, err = VerifyInclusionLegacySeal(state, tampered, 0, tampered[0], nil)
+	require.True(t, errors.Is(err, ErrLegacySealRootMismatch))
+}
+
+func TestVerifyLegacySeal_RootMismatch(t *testing.T) {
+	mc := buildLegacyBlobMassif0(t, 0 /*blobVersion*/, 3 /*massifHeight*/, 2 /*leaves*/)
+	data, verifier := signLegacySealV0(t, &mc, make([]byte, 32))
+
+	_, _, err := VerifyLegacySeal(&mc, data, verifier)
+	require.True(t, errors.Is(err, ErrLegacySealRootMismatch))
+}
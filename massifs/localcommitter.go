@@ -0,0 +1,82 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+)
+
+// LocalCommitter builds a log in a local directory, laid out as DirReader
+// and DirWriter expect, so a log can be grown where there is no blob store at
+// all, for example air-gapped or at the edge. The directory can later be
+// replicated to a blob store, or read as any other local replica.
+//
+// Its lifecycle is that of GetAppendContext and CommitContext: get the
+// current context, add leaves to it, commit it, and repeat. Every commit
+// replaces the massif file atomically, by writing a temporary file and
+// renaming it into place, and syncs both the file and the directory, so a
+// crash leaves either the previous or the new massif, never a partial one.
+//
+// A LocalCommitter does not exclude other writers of the directory, use
+// DirWriter.Lock to serialise independent processes.
+type LocalCommitter struct {
+	Writer *DirWriter
+	// CommitmentEpoch and MassifHeight are those of a new log, an existing
+	// log's are read from its data
+	CommitmentEpoch uint32
+	MassifHeight    uint8
+
+	opts []Option
+}
+
+// NewLocalCommitter creates the directory if necessary. The options honoured
+// are those of NewDirWriter, WithPathScheme and WithDurability, except that
+// the durability is at least DurabilityFsync.
+func NewLocalCommitter(dir string, epoch uint32, massifHeight uint8, opts ...Option) (*LocalCommitter, error) {
+	if err := CheckMassifHeightV2(massifHeight); err != nil {
+		return nil, err
+	}
+	writer, err := NewDirWriter(dir, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if writer.Durability == DurabilityNone {
+		writer.Durability = DurabilityFsync
+	}
+	return &LocalCommitter{
+		Writer:          writer,
+		CommitmentEpoch: epoch,
+		MassifHeight:    massifHeight,
+		opts:            opts,
+	}, nil
+}
+
+// GetCurrentContext returns the context to append to, as GetAppendContext
+// does. The directory is read afresh, so commits made by others since the
+// last call are seen.
+func (c *LocalCommitter) GetCurrentContext(ctx context.Context) (MassifContext, error) {
+	reader, err := c.Reader()
+	if err != nil {
+		return MassifContext{}, err
+	}
+	defer reader.Close()
+	mc, err := GetAppendContext(ctx, reader, c.CommitmentEpoch, c.MassifHeight)
+	if err != nil {
+		return MassifContext{}, err
+	}
+	// The reader may have memory mapped the data, which Close releases
+	mc.Data = bytes.Clone(mc.Data)
+	return mc, nil
+}
+
+// CommitContext commits the context to the directory, as CommitContext does,
+// always replacing the whole massif file. The options are those of
+// CommitContext.
+func (c *LocalCommitter) CommitContext(ctx context.Context, mc *MassifContext, opts ...Option) error {
+	// Hide the writer's in place appends, which are not atomic
+	return CommitContext(ctx, struct{ ObjectWriter }{c.Writer}, mc, opts...)
+}
+
+// Reader returns a reader of the log in the directory as it is now
+func (c *LocalCommitter) Reader() (*DirReader, error) {
+	return NewDirReader(c.Writer.Dir, c.opts...)
+}
@@ -0,0 +1,67 @@
+package massifs
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalCommitter(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	c, err := NewLocalCommitter(dir, 1, 3, WithMemoryMap())
+	require.NoError(t, err)
+	require.Equal(t, DurabilityFsync, c.Writer.Durability)
+
+	// the same leaves built in memory, for comparison
+	mem := newMemStore(nil, nil)
+	for i := range 10 {
+		leaf := sha256.Sum256(fmt.Appendf(nil, "local-leaf-%d", i))
+
+		mc, err := c.GetCurrentContext(ctx)
+		require.NoError(t, err)
+		_, err = mc.AddHashedLeaf(sha256.New(), uint64(i+1), nil, nil, nil, leaf[:])
+		require.NoError(t, err)
+		require.NoError(t, c.CommitContext(ctx, &mc))
+
+		mc, err = GetAppendContext(ctx, mem, 1, 3)
+		require.NoError(t, err)
+		_, err = mc.AddHashedLeaf(sha256.New(), uint64(i+1), nil, nil, nil, leaf[:])
+		require.NoError(t, err)
+		require.NoError(t, CommitContext(ctx, mem, &mc))
+	}
+
+	reader, err := c.Reader()
+	require.NoError(t, err)
+	defer reader.Close()
+	head, err := reader.HeadIndex(ctx, storage.ObjectMassifData)
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), head)
+
+	mc, err := GetMassifContext(ctx, reader, head)
+	require.NoError(t, err)
+	require.Equal(t, mmr.FirstMMRSize(mmr.MMRIndex(9)), mc.RangeCount())
+	want, err := GetMassifContext(ctx, mem, head)
+	require.NoError(t, err)
+	got, err := mmr.PeakHashes(&mc, mc.RangeCount()-1)
+	require.NoError(t, err)
+	wantPeaks, err := mmr.PeakHashes(&want, want.RangeCount()-1)
+	require.NoError(t, err)
+	require.Equal(t, wantPeaks, got)
+
+	// only the massifs are left, no temporary files
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	for _, entry := range entries {
+		require.Equal(t, ".log", filepath.Ext(entry.Name()))
+	}
+
+}
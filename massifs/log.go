@@ -0,0 +1,430 @@
+package massifs
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/forestrie/go-merklelog/bloom"
+	"github.com/forestrie/go-merklelog/massifs/snowflakeid"
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/forestrie/go-merklelog/urkle"
+	"github.com/veraison/go-cose"
+)
+
+// DefaultMassifHeight is the massif height of a new Log if none is set with
+// WithLogMassifHeight. A massif then holds 8192 leaves.
+const DefaultMassifHeight uint8 = 14
+
+var (
+	ErrLogSignerRequired   = errors.New("a signer is required to seal the log, see WithLogSigner")
+	ErrLogNotSealed        = errors.New("the log has not been sealed")
+	ErrLogEntryExtraFields = errors.New("a log entry has more extra fields than a leaf record holds")
+)
+
+// LogOptions configures a Log, see OpenLog
+type LogOptions struct {
+	// MassifHeight is the height of the massifs of a new log. The height of
+	// an existing log is read from its data.
+	MassifHeight uint8
+	// CommitmentEpoch is the epoch of the idtimestamps of a new log, 1 if
+	// not set. The epoch of an existing log is read from its data.
+	CommitmentEpoch uint32
+	// Signer seals the log, it is only required by Seal
+	Signer      cose.Signer
+	SignOptions []CheckpointSignOption
+	// Verifier verifies the seals of the log, it is required by Prove, Verify
+	// and Replicate.
+	Verifier cose.Verifier
+	// TimestampIndex has Seal put the timestamp index of each massif it
+	// seals, see TimestampIndex.
+	TimestampIndex bool
+	// DualSeal has Seal put a V0 seal alongside each checkpoint, see
+	// WithLogDualSeal.
+	DualSeal bool
+	// Bridges has Append put the bridge of each massif it completes, see
+	// MassifBridge.
+	Bridges bool
+	// EpochClock is set on the contexts Append uses, see
+	// MassifContext.EpochClock.
+	EpochClock snowflakeid.Clock
+	// BloomParams, if set, sizes the bloom filters of a new log, see
+	// WithBloomParams. Those of an existing log are read from its data.
+	BloomParams *bloom.BloomParams
+}
+
+// Validate returns an error wrapping ErrInvalidOptions if the options are out
+// of range.
+func (o *LogOptions) Validate() error {
+	if o.MassifHeight == 0 || o.MassifHeight > MaxMMRHeight {
+		return fmt.Errorf("%w: massif height %d", ErrInvalidOptions, o.MassifHeight)
+	}
+	if o.BloomParams != nil {
+		if err := CheckBloomParams(o.MassifHeight, *o.BloomParams); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidOptions, err)
+		}
+	}
+	return nil
+}
+
+// WithLogMassifHeight sets the massif height of a new log
+func WithLogMassifHeight(massifHeight uint8) Option {
+	return func(a any) {
+		if opts, ok := a.(*LogOptions); ok {
+			opts.MassifHeight = massifHeight
+		}
+	}
+}
+
+// WithLogCommitmentEpoch sets the commitment epoch of a new log
+func WithLogCommitmentEpoch(epoch uint32) Option {
+	return func(a any) {
+		if opts, ok := a.(*LogOptions); ok {
+			opts.CommitmentEpoch = epoch
+		}
+	}
+}
+
+// WithLogBloomParams sizes the bloom filters of a new log, see
+// WithBloomParams
+func WithLogBloomParams(p bloom.BloomParams) Option {
+	return func(a any) {
+		if opts, ok := a.(*LogOptions); ok {
+			opts.BloomParams = &p
+		}
+	}
+}
+
+// WithLogSigner sets the signer, and the checkpoint options, Seal uses
+func WithLogSigner(signer cose.Signer, opts ...CheckpointSignOption) Option {
+	return func(a any) {
+		if o, ok := a.(*LogOptions); ok {
+			o.Signer = signer
+			o.SignOptions = opts
+		}
+	}
+}
+
+// WithLogVerifier sets the verifier of the log's seals
+func WithLogVerifier(verifier cose.Verifier) Option {
+	return func(a any) {
+		if opts, ok := a.(*LogOptions); ok {
+			opts.Verifier = verifier
+		}
+	}
+}
+
+// WithLogTimestampIndex has Seal maintain the timestamp index of each massif
+func WithLogTimestampIndex() Option {
+	return func(a any) {
+		if opts, ok := a.(*LogOptions); ok {
+			opts.TimestampIndex = true
+		}
+	}
+}
+
+// WithLogDualSeal has Seal put a V0 seal of each massif it seals, as the
+// storage.ObjectLegacyCheckpoint object, as well as the checkpoint. It is for
+// the migration window in which some verifiers can only read V0 seals.
+// Readers which can read both should use VerifyDualSeal.
+func WithLogDualSeal() Option {
+	return func(a any) {
+		if opts, ok := a.(*LogOptions); ok {
+			opts.DualSeal = true
+		}
+	}
+}
+
+// WithLogBridges has Append put the consistency bridge of each massif as it
+// is completed, see MassifBridge
+func WithLogBridges() Option {
+	return func(a any) {
+		if opts, ok := a.(*LogOptions); ok {
+			opts.Bridges = true
+		}
+	}
+}
+
+// WithLogEpochCheck has Append refuse idtimestamps from a commitment epoch
+// other than the log's, judged at the time of clock. Pass the clock the id
+// generator is configured with, nil selects the system clock.
+func WithLogEpochCheck(clock snowflakeid.Clock) Option {
+	return func(a any) {
+		if opts, ok := a.(*LogOptions); ok {
+			if clock == nil {
+				clock = snowflakeid.NewSystemClock()
+			}
+			opts.EpochClock = clock
+		}
+	}
+}
+
+// LogEntry is one leaf appended by Log.Append
+type LogEntry struct {
+	// IDTimestamp is the urkle key of the leaf, it must be greater than that
+	// of every leaf before it.
+	IDTimestamp uint64
+	// Value is the leaf hash, it must be ValueBytes long
+	Value []byte
+	// Extras are stored in the urkle leaf record, at most
+	// urkle.LeafExtraFields of them.
+	Extras [][]byte
+}
+
+// Log is the high level interface to a log, wiring together the append
+// contexts, seals, proofs, verification and replication of the package with
+// sane defaults. The primitives remain available for anything it does not
+// cover, and may be used on the same store.
+//
+// The options given to OpenLog are also passed to CommitContext and
+// GetContextVerified, so commit options, such as WithIndexCommitment, and
+// verification options, such as WithVerifySealSubject, apply to every
+// append and verification made through the Log.
+//
+// A Log serialises its own appends and seals, it does not exclude other
+// writers of the store.
+type Log struct {
+	mu      sync.Mutex
+	store   ObjectReaderWriter
+	options LogOptions
+	opts    []Option
+}
+
+// OpenLog opens the log in store, which may be empty.
+func OpenLog(ctx context.Context, store ObjectReaderWriter, opts ...Option) (*Log, error) {
+	l := &Log{store: store, options: LogOptions{MassifHeight: DefaultMassifHeight, CommitmentEpoch: 1}, opts: opts}
+	if err := ApplyOptions(&l.options, opts...); err != nil {
+		return nil, err
+	}
+	mc, err := GetMassifHeadContext(ctx, store)
+	if storage.IsNotFound(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	l.options.MassifHeight = mc.Start.MassifHeight
+	l.options.CommitmentEpoch = mc.Start.CommitmentEpoch
+	return l, nil
+}
+
+// MassifHeight returns the massif height of the log
+func (l *Log) MassifHeight() uint8 {
+	return l.options.MassifHeight
+}
+
+// Append adds the entries to the log, committing each massif as it is filled
+// and the last, and returns the size of the log. The entries are not sealed,
+// see Seal.
+func (l *Log) Append(ctx context.Context, entries ...LogEntry) (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	mc, err := l.appendContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	hasher := sha256.New()
+	for _, entry := range entries {
+		if len(entry.Extras) > urkle.LeafExtraFields {
+			return 0, fmt.Errorf("%w: %d", ErrLogEntryExtraFields, len(entry.Extras))
+		}
+		if mc.Count() >= TreeCount(l.options.MassifHeight) {
+			if err = l.commit(ctx, &mc); err != nil {
+				return 0, err
+			}
+			if mc, err = l.appendContext(ctx); err != nil {
+				return 0, err
+			}
+		}
+		extra := func(i int) []byte {
+			if i < len(entry.Extras) {
+				return entry.Extras[i]
+			}
+			return nil
+		}
+		var rest [][]byte
+		if len(entry.Extras) > 2 {
+			rest = entry.Extras[2:]
+		}
+		_, err = mc.AddHashedLeaf(hasher, entry.IDTimestamp, nil, extra(0), extra(1), entry.Value, rest...)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if err = l.commit(ctx, &mc); err != nil {
+		return 0, err
+	}
+	return mc.RangeCount(), nil
+}
+
+// commit commits the context, and puts its bridge if it is complete and the
+// log is configured with WithLogBridges.
+func (l *Log) commit(ctx context.Context, mc *MassifContext) error {
+	if err := CommitContext(ctx, l.store, mc, l.opts...); err != nil {
+		return err
+	}
+	if !l.options.Bridges || mc.Count() < TreeCount(l.options.MassifHeight) {
+		return nil
+	}
+	return PutMassifBridge(ctx, l.store, mc)
+}
+
+// Seal signs a checkpoint for every massif with unsealed entries, each
+// consistent with the checkpoint before it, and returns the last. If the log
+// is already sealed, the latest checkpoint is returned.
+func (l *Log) Seal(ctx context.Context) (*Checkpoint, error) {
+	if l.options.Signer == nil {
+		return nil, ErrLogSignerRequired
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	head, err := l.store.HeadIndex(ctx, storage.ObjectMassifData)
+	if err != nil {
+		return nil, err
+	}
+	massifIndex, sealed, err := l.sealedHead(ctx)
+	if err != nil && !errors.Is(err, ErrLogNotSealed) {
+		return nil, err
+	}
+	var sealedSize uint64
+	if sealed != nil {
+		sealedSize = sealed.MMRSize
+	}
+	for ; massifIndex <= head; massifIndex++ {
+		mc, err := GetMassifContext(ctx, l.store, massifIndex)
+		if err != nil {
+			return nil, err
+		}
+		if mc.RangeCount() == sealedSize {
+			continue
+		}
+		proof, err := BuildConsistencyProof(&mc, sealedSize, mc.RangeCount())
+		if err != nil {
+			return nil, err
+		}
+		accumulator, err := mmr.PeakHashes(&mc, mc.RangeCount()-1)
+		if err != nil {
+			return nil, err
+		}
+		data, err := SignCheckpointReceipt(l.options.Signer, proof, accumulator, l.options.SignOptions...)
+		if err != nil {
+			return nil, err
+		}
+		if err = l.store.Put(ctx, massifIndex, storage.ObjectCheckpoint, data, false); err != nil {
+			return nil, err
+		}
+		if l.options.DualSeal {
+			legacy, err := SignLegacySeal(
+				l.options.Signer, mc.RangeCount(), accumulator, mc.Start.CommitmentEpoch, mc.GetLastIDTimestamp())
+			if err != nil {
+				return nil, err
+			}
+			if err = l.store.Put(ctx, massifIndex, storage.ObjectLegacyCheckpoint, legacy, false); err != nil {
+				return nil, err
+			}
+		}
+		if l.options.TimestampIndex {
+			if err = PutTimestampIndex(ctx, l.store, &mc, mc.MassifLeafCount()); err != nil {
+				return nil, err
+			}
+		}
+		check, err := NewCheckpoint(data)
+		if err != nil {
+			return nil, err
+		}
+		sealed, sealedSize = &check, check.MMRSize
+	}
+	if sealed == nil {
+		return nil, ErrLogNotSealed
+	}
+	return sealed, nil
+}
+
+// Prove returns the inclusion proof of mmrIndex against the latest sealed
+// state of the log, after verifying the massif which holds the seal. The
+// state is returned with the proof, the caller verifies with it, for example
+// with AccumulatorClient.VerifyInclusion.
+func (l *Log) Prove(ctx context.Context, mmrIndex uint64) ([][]byte, MMRState, error) {
+	massifIndex, _, err := l.sealedHead(ctx)
+	if err != nil {
+		return nil, MMRState{}, err
+	}
+	vc, err := GetContextVerified(ctx, l.store, l.options.Verifier, massifIndex, l.opts...)
+	if err != nil {
+		return nil, MMRState{}, err
+	}
+	state := MMRState{MMRSize: vc.Checkpoint.MMRSize, Peaks: vc.Accumulator}
+	if mmrIndex >= state.MMRSize {
+		return nil, MMRState{}, fmt.Errorf("%w: mmr index %d, sealed size %d",
+			ErrLogNotSealed, mmrIndex, state.MMRSize)
+	}
+	proof, err := mmr.InclusionProof(newLogNodeStore(ctx, l.store), state.MMRSize-1, mmrIndex)
+	if err != nil {
+		return nil, MMRState{}, err
+	}
+	return proof, state, nil
+}
+
+// Verify verifies every sealed massif of the log against its checkpoint, and
+// returns the verified context of the last.
+func (l *Log) Verify(ctx context.Context) (*VerifiedContext, error) {
+	head, _, err := l.sealedHead(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var vc *VerifiedContext
+	for massifIndex := range head + 1 {
+		if vc, err = GetContextVerified(ctx, l.store, l.options.Verifier, massifIndex, l.opts...); err != nil {
+			return nil, err
+		}
+	}
+	return vc, nil
+}
+
+// Replicate copies the sealed massifs of the log to sink, verifying each, see
+// VerifyingReplicator.
+func (l *Log) Replicate(ctx context.Context, sink ObjectReaderWriter) error {
+	head, _, err := l.sealedHead(ctx)
+	if err != nil {
+		return err
+	}
+	v := VerifyingReplicator{COSEVerifier: l.options.Verifier, Source: l.store, Sink: sink}
+	return v.ReplicateVerifiedUpdates(ctx, 0, head)
+}
+
+// appendContext returns the context to append to, creating the log if it is
+// empty.
+func (l *Log) appendContext(ctx context.Context) (MassifContext, error) {
+	var opts []Option
+	if l.options.BloomParams != nil {
+		opts = append(opts, WithBloomParams(*l.options.BloomParams))
+	}
+	mc, err := GetAppendContext(ctx, l.store, l.options.CommitmentEpoch, l.options.MassifHeight, opts...)
+	if err != nil {
+		return MassifContext{}, err
+	}
+	mc.EpochClock = l.options.EpochClock
+	return mc, nil
+}
+
+// sealedHead returns the index of the last sealed massif, and its checkpoint.
+// ErrLogNotSealed is returned if there is none.
+func (l *Log) sealedHead(ctx context.Context) (uint32, *Checkpoint, error) {
+	head, err := l.store.HeadIndex(ctx, storage.ObjectCheckpoint)
+	if storage.IsNotFound(err) {
+		return 0, nil, ErrLogNotSealed
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	check, err := GetCheckpoint(ctx, l.store, head)
+	if err != nil {
+		return 0, nil, err
+	}
+	return head, &check, nil
+}
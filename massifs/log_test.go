@@ -0,0 +1,96 @@
+package massifs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+func TestLog(t *testing.T) {
+	ctx := context.Background()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := cose.NewSigner(cose.AlgorithmES256, key)
+	require.NoError(t, err)
+	verifier := newES256Verifier(t, &key.PublicKey)
+
+	entries := func(first, n int) []LogEntry {
+		var out []LogEntry
+		for i := first; i < first+n; i++ {
+			leaf := sha256.Sum256(fmt.Appendf(nil, "log-leaf-%d", i))
+			out = append(out, LogEntry{IDTimestamp: uint64(i + 1), Value: leaf[:]})
+		}
+		return out
+	}
+
+	store := newMemStore(nil, nil)
+	l, err := OpenLog(ctx, store, WithLogMassifHeight(3), WithLogSigner(signer), WithLogVerifier(verifier))
+	require.NoError(t, err)
+
+	_, _, err = l.Prove(ctx, 0)
+	require.ErrorIs(t, err, ErrLogNotSealed)
+
+	// 4 leaves fill a massif of height 3, so this spans three massifs
+	size, err := l.Append(ctx, entries(0, 5)...)
+	require.NoError(t, err)
+	require.Equal(t, mmr.MMRIndex(5), size)
+	check, err := l.Seal(ctx)
+	require.NoError(t, err)
+	require.Equal(t, size, check.MMRSize)
+
+	// a re-opened log takes its configuration from the data
+	l, err = OpenLog(ctx, store, WithLogSigner(signer), WithLogVerifier(verifier))
+	require.NoError(t, err)
+	require.Equal(t, uint8(3), l.MassifHeight())
+	size, err = l.Append(ctx, entries(5, 4)...)
+	require.NoError(t, err)
+	require.Equal(t, mmr.MMRIndex(9), size)
+	require.Len(t, store.massifs, 3)
+
+	// the appended leaves are not proven until sealed
+	_, _, err = l.Prove(ctx, size-1)
+	require.ErrorIs(t, err, ErrLogNotSealed)
+	check, err = l.Seal(ctx)
+	require.NoError(t, err)
+	require.Equal(t, size, check.MMRSize)
+
+	vc, err := l.Verify(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), vc.Start.MassifIndex)
+
+	for _, mmrIndex := range []uint64{0, mmr.MMRIndex(4), size - 1} {
+		proof, state, err := l.Prove(ctx, mmrIndex)
+		require.NoError(t, err)
+		client, err := NewAccumulatorClient(nil, state)
+		require.NoError(t, err)
+		node, err := newLogNodeStore(ctx, store).Get(mmrIndex)
+		require.NoError(t, err)
+		require.NoError(t, client.VerifyInclusion(state.MMRSize, mmrIndex, node, proof))
+	}
+
+	replica := newMemStore(nil, nil)
+	require.NoError(t, l.Replicate(ctx, replica))
+	require.Equal(t, store.massifs, replica.massifs)
+	require.Equal(t, store.checkpoint, replica.checkpoint)
+}
+
+func TestLogRefused(t *testing.T) {
+	ctx := context.Background()
+	l, err := OpenLog(ctx, newMemStore(nil, nil), WithLogMassifHeight(3))
+	require.NoError(t, err)
+
+	_, err = l.Seal(ctx)
+	require.ErrorIs(t, err, ErrLogSignerRequired)
+
+	leaf := sha256.Sum256([]byte("log-leaf"))
+	_, err = l.Append(ctx, LogEntry{IDTimestamp: 1, Value: leaf[:], Extras: make([][]byte, 4)})
+	require.ErrorIs(t, err, ErrLogEntryExtraFields)
+}
@@ -2,7 +2,10 @@ package massifs
 
 import (
 	"errors"
+	"fmt"
+	"math"
 
+	"github.com/forestrie/go-merklelog/massifs/logformat"
 	"github.com/forestrie/go-merklelog/mmr"
 	"github.com/forestrie/go-merklelog/urkle"
 )
@@ -10,35 +13,50 @@ import (
 const (
 	// These constants are used to derive the size of the mmrblob format sections described at
 	// https://github.com/datatrails/epic-8120-scalable-proof-mechanisms/blob/main/mmr/forestrie-mmrblobs.md#massif-basic-file-format
+	// They are defined by the dependency free logformat package.
 
 	// ValueBytes defines the width of ALL entries in the log. This fixed width
 	// makes it possible to compute mmr current sizes based on knowing only the
 	// massif height and the number of bytes in the file.
-	ValueBytes = 32
+	ValueBytes = logformat.ValueBytes
 	// ReservedHeaderSlots reserves a place to put the urkle trie root, used for
 	// data recovery and proofs of exclusion, and any related material. And it
 	// gives us a little flex in the data format for the initial launch of
 	// forestrie. It would be frustrating to need a data migration for want of a
 	// few bytes.
-	ReservedHeaderSlots = 7 // reserves n * ValueBytes at the front of the blob
-	StartHeaderSize     = ValueBytes + ValueBytes*ReservedHeaderSlots
+	ReservedHeaderSlots = logformat.ReservedHeaderSlots // reserves n * ValueBytes at the front of the blob
+	StartHeaderSize     = logformat.StartHeaderSize
 	StartHeaderEnd      = StartHeaderSize
 	// MaxMMRHeight no single log can by taller than this, and matches the allowable bit size of an mmrIndex.
 	// Note that the max height *index* is 63
-	MaxMMRHeight          = 64
-	IndexHeaderBytes      = 32
-	LogEntryBytes         = 32
-	EntryByteSizeLogBase2 = 5
-	ValueBitSizeLogBase2  = 8
-	ValueByteSizeLogBase2 = 5
+	MaxMMRHeight          = logformat.MaxMMRHeight
+	IndexHeaderBytes      = logformat.IndexHeaderBytes
+	LogEntryBytes         = logformat.LogEntryBytes
+	EntryByteSizeLogBase2 = logformat.EntryByteSizeLogBase2
+	ValueBitSizeLogBase2  = logformat.ValueBitSizeLogBase2
+	ValueByteSizeLogBase2 = logformat.ValueByteSizeLogBase2
 )
 
 var (
 	ErrLogEntryToSmall = errors.New("to few bytes to represent a valid log entry")
 	ErrLogValueToSmall = errors.New("to few bytes to represent a valid log value")
 	ErrLogValueBadSize = errors.New("log value size invalid")
+	ErrOffsetOverflow  = errors.New("the massif offset does not fit the arithmetic type")
 )
 
+// ReadLen converts a massif byte count, which is uint64 in all the format
+// arithmetic, to the int taken by ObjectReader.MassifReadN. Massifs larger
+// than 4GiB are representable on 64 bit platforms, on 32 bit platforms an
+// error is returned rather than a silently truncated read. It is used for
+// the other counts of the format which must become an int, such as the
+// length of a sort.Search, for the same reason.
+func ReadLen(n uint64) (int, error) {
+	if n > math.MaxInt {
+		return 0, fmt.Errorf("%w: read length %d", ErrOffsetOverflow, n)
+	}
+	return int(n), nil
+}
+
 func IndexFromBlobSize(size int) uint64 {
 	if size == 0 {
 		return 0
@@ -71,10 +89,12 @@ func TrieHeaderEnd() uint64 {
 	return TrieHeaderStart() + IndexHeaderBytes
 }
 
-// PeakStackStart returns the first byte of the massif ancestor peak stack data
+// PeakStackStart returns the first byte of the massif ancestor peak stack
+// data, for the V1 bloom sizing. See MassifContext.PeakStackStart for a massif
+// whose start records bloom parameters.
 func PeakStackStart(massifHeight uint8) uint64 {
 	leafCount := urkle.LeafCountForMassifHeight(massifHeight)
-	sz, err := indexDataBytesV2(leafCount)
+	sz, err := indexDataBytesV2(leafCount, BloomBitsPerElementV1)
 	if err != nil {
 		panic(err)
 	}
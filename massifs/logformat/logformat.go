@@ -0,0 +1,237 @@
+// Package logformat is the massif byte layout, as constants and pure
+// functions of the start header fields. It has no dependencies beyond the
+// standard library, so that implementations in other languages can generate
+// bindings from it, and check their arithmetic against it, without taking on
+// the rest of the module.
+//
+// A massif is, in order,
+//
+//	start header | index header | index data | peak stack | log
+//
+// The start header is StartHeaderSize bytes: the start key word, then
+// ReservedHeaderSlots words, of which the current version uses UrkleRootWord,
+// StatsWord, the IntegrityWordCount words from IntegrityWord,
+// CommittedLengthWord and IndexCommitmentWord. The index header is
+// IndexHeaderBytes, in version 2 it is the bloom header. Only version 2 has
+// index data, see IndexDataBytesV2.
+// The peak stack holds the peaks of earlier massifs needed to complete this
+// one, and the log holds the MMR nodes, each LogEntryBytes wide.
+//
+// The package massifs defines its own layout constants from these, so they
+// can not drift apart.
+package logformat
+
+import "math/bits"
+
+const (
+	// ValueBytes is the width of every log value, and of every header word
+	ValueBytes = 32
+	// LogEntryBytes is the width of every log entry. Entries are just values.
+	LogEntryBytes         = 32
+	EntryByteSizeLogBase2 = 5
+	ValueBitSizeLogBase2  = 8
+	ValueByteSizeLogBase2 = 5
+
+	// ReservedHeaderSlots is the number of words following the start key
+	ReservedHeaderSlots = 7
+	StartHeaderSize     = ValueBytes + ValueBytes*ReservedHeaderSlots
+	IndexHeaderBytes    = 32
+
+	// MaxMMRHeight is the height no log can exceed. It is also the number of
+	// peak stack entries reserved by versions 1 and 2.
+	MaxMMRHeight = 64
+
+	// CurrentVersion is the massif format version written by this module
+	CurrentVersion = uint16(2)
+)
+
+// The start key, the first word of the start header. Integers are big
+// endian.
+//
+//	| reserved | last id | bloom k | bloom bpe | version | epoch   | massif height | massif index |
+//	| 0 - 7    | 8 - 15  | 16      | 17 - 20   | 21 - 22 | 23 - 26 | 27            | 28 - 31      |
+//
+// The bloom k and bits per element are zero for the V1 bloom sizing,
+// BloomKV1 and BloomBitsPerElementV1. Otherwise the index holds a V2 bloom
+// region of BloomFilters filters with those parameters.
+const (
+	StartKeyLastIDFirstByte       = 8
+	StartKeyLastIDEnd             = 16
+	StartKeyBloomKByte            = 16
+	StartKeyBloomBPEFirstByte     = 17
+	StartKeyBloomBPEEnd           = 21
+	StartKeyVersionFirstByte      = 21
+	StartKeyVersionEnd            = 23
+	StartKeyEpochFirstByte        = 23
+	StartKeyEpochEnd              = 27
+	StartKeyMassifHeightFirstByte = 27
+	StartKeyMassifIndexFirstByte  = 28
+	StartKeyMassifIndexEnd        = 32
+)
+
+// The version 2 start header words, after the start key
+const (
+	// UrkleRootWord holds the root hash of the massif's urkle trie
+	UrkleRootWord = 1
+	// StatsWord holds the informational statistics block
+	StatsWord = 2
+	// IntegrityWord is the first of the words holding the region checksums
+	IntegrityWord      = 3
+	IntegrityWordCount = 2
+	// CommittedLengthWord holds the length of the data at the last commit
+	CommittedLengthWord = 5
+	// IndexCommitmentWord holds the merkle root of the urkle leaf records
+	IndexCommitmentWord = 6
+)
+
+// The version 2 index sizing
+const (
+	// MaxMassifHeightV2 is the tallest massif the version 2 index supports
+	MaxMassifHeightV2 = 29
+
+	// BloomFilters is the number of parallel bloom filters
+	BloomFilters = 4
+	// BloomHeaderBytesV1 is the bloom header, which is the index header
+	BloomHeaderBytesV1 = 32
+	// BloomBitsPerElementV1 is the bits per leaf of each bloom filter
+	BloomBitsPerElementV1 = 10
+	// BloomKV1 is the number of bits set per inserted element
+	BloomKV1 = 7
+
+	UrkleFrontierMaxDepth   = 64
+	UrkleFrontierFrameBytes = 8
+	UrkleFrontierBytesV1    = 32 + UrkleFrontierMaxDepth*UrkleFrontierFrameBytes
+	UrkleLeafRecordBytes    = 128
+	UrkleNodeRecordBytes    = 64
+)
+
+// LeafCount returns the number of leaves in a complete massif
+func LeafCount(massifHeight uint8) uint64 {
+	if massifHeight == 0 {
+		return 0
+	}
+	return uint64(1) << (massifHeight - 1)
+}
+
+// MMRIndex returns the mmr index of the leaf
+func MMRIndex(leafIndex uint64) uint64 {
+	return 2*leafIndex - uint64(bits.OnesCount64(leafIndex))
+}
+
+// FirstIndex returns the mmr index of the first leaf of the massif, which is
+// the first node of its log.
+func FirstIndex(massifHeight uint8, massifIndex uint32) uint64 {
+	return MMRIndex(LeafCount(massifHeight) * uint64(massifIndex))
+}
+
+// MaxMMRSize returns the mmr size once the massif is complete, this includes
+// the nodes which bury the peaks of earlier massifs.
+func MaxMMRSize(massifHeight uint8, massifIndex uint32) uint64 {
+	lastLeaf := LeafCount(massifHeight)*(uint64(massifIndex)+1) - 1
+	spurHeight := uint64(bits.TrailingZeros64(lastLeaf + 1))
+	return MMRIndex(lastLeaf) + spurHeight + 1
+}
+
+// NodeCapacity returns the number of log entries in the complete massif
+func NodeCapacity(massifHeight uint8, massifIndex uint32) uint64 {
+	return MaxMMRSize(massifHeight, massifIndex) - FirstIndex(massifHeight, massifIndex)
+}
+
+// PeakStackLen returns the number of peaks of earlier massifs the massif
+// needs. Version 0 stores exactly these, later versions reserve MaxMMRHeight
+// entries regardless.
+func PeakStackLen(massifIndex uint32) uint64 {
+	return uint64(bits.OnesCount32(massifIndex))
+}
+
+// BloomMBitsV1 returns the bit count of each bloom filter, 0 if it does not
+// fit its uint32 encoding.
+func BloomMBitsV1(leafCount uint64) uint32 {
+	return BloomMBits(leafCount, BloomBitsPerElementV1)
+}
+
+// BloomMBits returns the bit count of each bloom filter with bitsPerElement
+// bits per leaf, 0 if it does not fit its uint32 encoding.
+func BloomMBits(leafCount uint64, bitsPerElement uint32) uint32 {
+	bpe := uint64(bitsPerElement)
+	mBits := leafCount * bpe
+	if leafCount == 0 || bpe == 0 || mBits/leafCount != bpe || mBits > uint64(^uint32(0)) {
+		return 0
+	}
+	return uint32(mBits)
+}
+
+// BloomBitsetsBytesV1 returns the bytes of the bloom bitsets, excluding the
+// bloom header.
+func BloomBitsetsBytesV1(leafCount uint64) uint64 {
+	return BloomBitsetsBytes(leafCount, BloomBitsPerElementV1)
+}
+
+// BloomBitsetsBytes returns the bytes of the bloom bitsets with
+// bitsPerElement bits per leaf, excluding the bloom header.
+func BloomBitsetsBytes(leafCount uint64, bitsPerElement uint32) uint64 {
+	return BloomFilters * ((uint64(BloomMBits(leafCount, bitsPerElement)) + 7) / 8)
+}
+
+// UrkleLeafTableBytes returns the bytes of the urkle leaf table
+func UrkleLeafTableBytes(leafCount uint64) uint64 {
+	return leafCount * UrkleLeafRecordBytes
+}
+
+// UrkleNodeStoreBytes returns the bytes of the urkle node store, which has
+// room for the 2N-1 nodes of a trie of N keys.
+func UrkleNodeStoreBytes(leafCount uint64) uint64 {
+	if leafCount == 0 {
+		return 0
+	}
+	return (2*leafCount - 1) * UrkleNodeRecordBytes
+}
+
+// IndexDataBytesV2 returns the bytes of the version 2 index data, which
+// follows the index header,
+//
+//	bloom bitsets | urkle frontier | urkle leaf table | urkle node store
+//
+// It is 0 for a massif height the index does not support. The bloom bitsets
+// have the V1 sizing, see IndexDataBytes.
+func IndexDataBytesV2(massifHeight uint8) uint64 {
+	return IndexDataBytes(massifHeight, BloomBitsPerElementV1)
+}
+
+// IndexDataBytes is IndexDataBytesV2 for bloom filters of bitsPerElement
+// bits per leaf, as the start key records. It is 0 if the bloom filters for
+// the massif height do not fit their encoding.
+func IndexDataBytes(massifHeight uint8, bitsPerElement uint32) uint64 {
+	if massifHeight == 0 || massifHeight > MaxMassifHeightV2 {
+		return 0
+	}
+	leafCount := LeafCount(massifHeight)
+	if BloomMBits(leafCount, bitsPerElement) == 0 {
+		return 0
+	}
+	return BloomBitsetsBytes(leafCount, bitsPerElement) + UrkleFrontierBytesV1 +
+		UrkleLeafTableBytes(leafCount) + UrkleNodeStoreBytes(leafCount)
+}
+
+// PeakStackStart returns the offset of the peak stack
+func PeakStackStart(version uint16, massifHeight uint8) uint64 {
+	start := uint64(StartHeaderSize + IndexHeaderBytes)
+	if version == CurrentVersion {
+		start += IndexDataBytesV2(massifHeight)
+	}
+	return start
+}
+
+// LogStart returns the offset of the first log entry
+func LogStart(version uint16, massifHeight uint8, massifIndex uint32) uint64 {
+	stackLen := uint64(MaxMMRHeight)
+	if version == 0 {
+		stackLen = PeakStackLen(massifIndex)
+	}
+	return PeakStackStart(version, massifHeight) + stackLen*ValueBytes
+}
+
+// MassifSize returns the byte size of the complete massif
+func MassifSize(version uint16, massifHeight uint8, massifIndex uint32) uint64 {
+	return LogStart(version, massifHeight, massifIndex) + NodeCapacity(massifHeight, massifIndex)*LogEntryBytes
+}
@@ -0,0 +1,94 @@
+package logformat_test
+
+import (
+	"testing"
+
+	"github.com/forestrie/go-merklelog/bloom"
+	"github.com/forestrie/go-merklelog/massifs"
+	"github.com/forestrie/go-merklelog/massifs/logformat"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/forestrie/go-merklelog/urkle"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLayoutMatchesImplementation checks the dependency free arithmetic
+// against the implementation it documents.
+func TestLayoutMatchesImplementation(t *testing.T) {
+	require.Equal(t, uint64(urkle.FrontierStateV1Bytes), uint64(logformat.UrkleFrontierBytesV1))
+	require.Equal(t, uint64(urkle.LeafRecordBytes), uint64(logformat.UrkleLeafRecordBytes))
+	require.Equal(t, uint64(urkle.NodeRecordBytes), uint64(logformat.UrkleNodeRecordBytes))
+	require.Equal(t, uint64(bloom.Filters), uint64(logformat.BloomFilters))
+	require.Equal(t, uint64(bloom.HeaderBytesV1), uint64(logformat.BloomHeaderBytesV1))
+
+	for _, c := range [][2]int{
+		{massifs.MassifStartKeyLastIDFirstByte, logformat.StartKeyLastIDFirstByte},
+		{massifs.MassifStartKeyLastIDEnd, logformat.StartKeyLastIDEnd},
+		{massifs.MassifStartKeyBloomKByte, logformat.StartKeyBloomKByte},
+		{massifs.MassifStartKeyBloomBPEFirstByte, logformat.StartKeyBloomBPEFirstByte},
+		{massifs.MassifStartKeyBloomBPEEnd, logformat.StartKeyBloomBPEEnd},
+		{massifs.MassifStartKeyVersionFirstByte, logformat.StartKeyVersionFirstByte},
+		{massifs.MassifStartKeyVersionEnd, logformat.StartKeyVersionEnd},
+		{massifs.MassifStartKeyEpochFirstByte, logformat.StartKeyEpochFirstByte},
+		{massifs.MassifStartKeyEpochEnd, logformat.StartKeyEpochEnd},
+		{massifs.MassifStartKeyMassifHeightFirstByte, logformat.StartKeyMassifHeightFirstByte},
+		{massifs.MassifStartKeyMassifFirstByte, logformat.StartKeyMassifIndexFirstByte},
+		{massifs.MassifStartKeyMassifEnd, logformat.StartKeyMassifIndexEnd},
+	} {
+		require.Equal(t, c[0], c[1])
+	}
+
+	for _, leafIndex := range []uint64{0, 1, 2, 3, 7, 8, 1000, 1 << 40} {
+		require.Equal(t, mmr.MMRIndex(leafIndex), logformat.MMRIndex(leafIndex))
+	}
+
+	for _, version := range []uint16{0, 1, logformat.CurrentVersion} {
+		for _, height := range []uint8{1, 3, 14, logformat.MaxMassifHeightV2} {
+			for _, massifIndex := range []uint32{0, 1, 2, 7, 1000} {
+				require.Equal(t, urkle.LeafCountForMassifHeight(height), logformat.LeafCount(height))
+				require.Equal(t, massifs.MassifFirstLeaf(height, massifIndex), logformat.FirstIndex(height, massifIndex))
+				require.Equal(t, massifs.PeakStackLen(uint64(massifIndex)), logformat.PeakStackLen(massifIndex))
+
+				ms := massifs.MassifStart{
+					Version:      version,
+					MassifHeight: height,
+					MassifIndex:  massifIndex,
+					FirstIndex:   massifs.MassifFirstLeaf(height, massifIndex),
+					PeakStackLen: massifs.PeakStackLen(uint64(massifIndex)),
+				}
+				f, err := ms.Format()
+				require.NoError(t, err)
+				require.Equal(t, f.NodeCapacity, logformat.NodeCapacity(height, massifIndex))
+				stack, ok := f.Region(massifs.RegionPeakStack)
+				require.True(t, ok)
+				require.Equal(t, stack.Offset, logformat.PeakStackStart(version, height))
+				log, ok := f.Region(massifs.RegionLog)
+				require.True(t, ok)
+				require.Equal(t, log.Offset, logformat.LogStart(version, height, massifIndex))
+				require.Equal(t, f.Size(), logformat.MassifSize(version, height, massifIndex))
+				if version == logformat.CurrentVersion {
+					require.Equal(t, massifs.PeakStackStart(height), logformat.PeakStackStart(version, height))
+				}
+			}
+		}
+	}
+	require.Zero(t, logformat.IndexDataBytesV2(logformat.MaxMassifHeightV2+1))
+
+	// a start recording bloom parameters sizes the bloom bitsets with them
+	for _, height := range []uint8{1, 3, 14, 20} {
+		for _, bpe := range []uint32{1, 10, 16} {
+			ms := massifs.MassifStart{Version: logformat.CurrentVersion, MassifHeight: height}
+			require.NoError(t, ms.SetBloomParams(bloom.BloomParams{Filters: bloom.Filters, K: 7, BitsPerElement: bpe}))
+			f, err := ms.Format()
+			require.NoError(t, err)
+			stack, ok := f.Region(massifs.RegionPeakStack)
+			require.True(t, ok)
+			require.Equal(t, stack.Offset,
+				uint64(logformat.StartHeaderSize+logformat.IndexHeaderBytes)+logformat.IndexDataBytes(height, bpe))
+		}
+	}
+	// the bloom filters of the tallest massifs only fit the V1 sizing
+	ms := massifs.MassifStart{Version: logformat.CurrentVersion, MassifHeight: logformat.MaxMassifHeightV2}
+	require.ErrorIs(t, ms.SetBloomParams(bloom.BloomParams{Filters: bloom.Filters, K: 7, BitsPerElement: 16}),
+		massifs.ErrBloomParams)
+	require.Zero(t, logformat.IndexDataBytes(logformat.MaxMassifHeightV2, 16))
+}
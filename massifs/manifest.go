@@ -0,0 +1,236 @@
+package massifs
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/veraison/go-cose"
+)
+
+var (
+	ErrManifestIncomplete = errors.New("the manifest does not hold all the ranges required")
+	ErrManifestInvalid    = errors.New("the manifest is invalid")
+)
+
+// ByteRange identifies Length bytes of massif data from Offset.
+type ByteRange struct {
+	Offset uint64
+	Length uint64
+}
+
+func (r ByteRange) End() uint64 {
+	return r.Offset + r.Length
+}
+
+// ManifestRange is a range of massif data held by a manifest.
+type ManifestRange struct {
+	Offset uint64
+	Data   []byte
+}
+
+// MassifManifest is a partial copy of a massif: the byte ranges of the massif
+// data a verifier was given. For very large massifs it allows a leaf to be
+// verified against a checkpoint without transferring the whole massif, see
+// VerifyManifestLeaf.
+type MassifManifest struct {
+	Ranges []ManifestRange
+}
+
+// ManifestIncompleteError is returned by VerifyManifestLeaf when the manifest
+// lacks ranges the verification needs. Missing lists every one of them, so a
+// single additional fetch suffices.
+type ManifestIncompleteError struct {
+	Missing []ByteRange
+}
+
+func (e *ManifestIncompleteError) Error() string {
+	ranges := make([]string, len(e.Missing))
+	for i, r := range e.Missing {
+		ranges[i] = fmt.Sprintf("[%d, %d)", r.Offset, r.End())
+	}
+	return fmt.Sprintf("%v: missing %s", ErrManifestIncomplete, strings.Join(ranges, ", "))
+}
+
+func (e *ManifestIncompleteError) Unwrap() error {
+	return ErrManifestIncomplete
+}
+
+// NewMassifManifest copies the requested ranges out of the complete massif
+// data, it is what a server holding the massif sends a verifier.
+func NewMassifManifest(data []byte, ranges []ByteRange) (*MassifManifest, error) {
+	m := &MassifManifest{}
+	for _, r := range ranges {
+		if r.Offset > uint64(len(data)) || r.Length > uint64(len(data))-r.Offset {
+			return nil, fmt.Errorf("%w: range [%d, %d) exceeds the massif data", ErrManifestInvalid, r.Offset, r.End())
+		}
+		m.Ranges = append(m.Ranges, ManifestRange{
+			Offset: r.Offset,
+			Data:   append([]byte(nil), data[r.Offset:r.End()]...),
+		})
+	}
+	return m, nil
+}
+
+// read returns the n bytes at offset, if a single range holds all of them
+func (m *MassifManifest) read(offset, n uint64) ([]byte, bool) {
+	for _, r := range m.Ranges {
+		if offset >= r.Offset && offset-r.Offset <= uint64(len(r.Data)) && n <= uint64(len(r.Data))-(offset-r.Offset) {
+			start := offset - r.Offset
+			return r.Data[start : start+n], true
+		}
+	}
+	return nil, false
+}
+
+// ManifestHeaderRange is the range every manifest must hold: the massif start
+// header, from which the offsets of all other ranges are derived.
+func ManifestHeaderRange() ByteRange {
+	return ByteRange{Offset: 0, Length: StartHeaderEnd}
+}
+
+// ManifestRequiredRanges returns the ranges of the massif described by start
+// needed to verify the node at mmrIndex against a checkpoint for mmrSize: the
+// node itself, its inclusion proof and the accumulator the checkpoint
+// signature covers. Each is found in the massif log data or in its ancestor
+// peak stack. Adjacent ranges are coalesced, the header range is not
+// included.
+func ManifestRequiredRanges(start MassifStart, mmrSize uint64, mmrIndex uint64) ([]ByteRange, error) {
+	mc := MassifContext{Start: start}
+	if mmrSize == 0 || mmrIndex >= mmrSize {
+		return nil, fmt.Errorf("%w: mmr index %d is not in mmr size %d", ErrManifestInvalid, mmrIndex, mmrSize)
+	}
+	if mmrIndex < start.FirstIndex {
+		return nil, fmt.Errorf("%w: %d", ErrIndexNotInMassif, mmrIndex)
+	}
+	if mmrSize > massifMaxMMRSize(start) {
+		return nil, fmt.Errorf("%w: mmr size %d is beyond the massif", ErrManifestInvalid, mmrSize)
+	}
+
+	path, err := mmr.InclusionProofPath(mmrSize-1, mmrIndex)
+	if err != nil {
+		return nil, err
+	}
+	nodes := append(mmr.Peaks(mmrSize-1), path...)
+	nodes = append(nodes, mmrIndex)
+
+	var stackMap map[uint64]int
+	offsets := make([]uint64, 0, len(nodes))
+	for _, i := range nodes {
+		if i >= start.FirstIndex {
+			offsets = append(offsets, mc.LogStart()+(i-start.FirstIndex)*ValueBytes)
+			continue
+		}
+		if stackMap == nil {
+			if stackMap = PeakStackMap(start.MassifHeight, start.FirstIndex); stackMap == nil {
+				return nil, fmt.Errorf("%w: invalid massif height or first index", ErrManifestInvalid)
+			}
+		}
+		stackIndex, ok := stackMap[i]
+		if !ok {
+			return nil, fmt.Errorf("%w: %d is not in the peak stack", ErrAncestorStackInvalid, i)
+		}
+		offsets = append(offsets, mc.PeakStackStart()+uint64(stackIndex)*ValueBytes)
+	}
+	return coalesceValueRanges(offsets), nil
+}
+
+// coalesceValueRanges returns the ranges of the values at offsets, sorted and
+// with adjacent or duplicate values merged.
+func coalesceValueRanges(offsets []uint64) []ByteRange {
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	var ranges []ByteRange
+	for _, offset := range offsets {
+		if n := len(ranges); n > 0 && offset <= ranges[n-1].End() {
+			ranges[n-1].Length = max(ranges[n-1].Length, offset+ValueBytes-ranges[n-1].Offset)
+			continue
+		}
+		ranges = append(ranges, ByteRange{Offset: offset, Length: ValueBytes})
+	}
+	return ranges
+}
+
+// VerifyManifestLeaf verifies the node at mmrIndex against the checkpoint
+// using only the ranges held by the manifest, and returns the verified node
+// value. The checkpoint signature is verified over the accumulator read from
+// the manifest, and the node's inclusion proof, also read from the manifest,
+// is verified against that accumulator.
+//
+// If the manifest is insufficient a *ManifestIncompleteError lists exactly the
+// ranges which are missing. Without the header range only it can be listed.
+func VerifyManifestLeaf(
+	manifest *MassifManifest, check *Checkpoint, verifier cose.Verifier, mmrIndex uint64,
+) ([]byte, error) {
+	header, ok := manifest.read(0, StartHeaderEnd)
+	if !ok {
+		return nil, &ManifestIncompleteError{Missing: []ByteRange{ManifestHeaderRange()}}
+	}
+	start := MakeMassifStart(header)
+	required, err := ManifestRequiredRanges(start, check.MMRSize, mmrIndex)
+	if err != nil {
+		return nil, err
+	}
+	// the manifest ranges need not align with the coalesced ranges, so each
+	// value is checked on its own
+	var missing []uint64
+	for _, r := range required {
+		for offset := r.Offset; offset < r.End(); offset += ValueBytes {
+			if _, ok := manifest.read(offset, ValueBytes); !ok {
+				missing = append(missing, offset)
+			}
+		}
+	}
+	if missing != nil {
+		return nil, &ManifestIncompleteError{Missing: coalesceValueRanges(missing)}
+	}
+
+	store := &manifestNodeStore{manifest: manifest, mc: MassifContext{Start: start}}
+	accumulator, err := VerifyCheckpointReceipt(store, &check.Receipt, verifier)
+	if err != nil {
+		return nil, err
+	}
+	value, err := store.Get(mmrIndex)
+	if err != nil {
+		return nil, err
+	}
+	proof, err := mmr.InclusionProof(store, check.MMRSize-1, mmrIndex)
+	if err != nil {
+		return nil, err
+	}
+	if err = verifyAccumulatorInclusion(check.MMRSize, accumulator, mmrIndex, value, proof); err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), value...), nil
+}
+
+// manifestNodeStore reads node values from a manifest, it is only used once
+// the manifest is known to hold all the required ranges.
+type manifestNodeStore struct {
+	manifest *MassifManifest
+	mc       MassifContext
+}
+
+func (s *manifestNodeStore) Get(i uint64) ([]byte, error) {
+	var offset uint64
+	if i >= s.mc.Start.FirstIndex {
+		offset = s.mc.LogStart() + (i-s.mc.Start.FirstIndex)*ValueBytes
+	} else {
+		if s.mc.PeakStackMap == nil {
+			if err := s.mc.CreatePeakStackMap(); err != nil {
+				return nil, err
+			}
+		}
+		stackIndex, ok := s.mc.PeakStackMap[i]
+		if !ok {
+			return nil, fmt.Errorf("%w: %d is not in the peak stack", ErrAncestorStackInvalid, i)
+		}
+		offset = s.mc.PeakStackStart() + uint64(stackIndex)*ValueBytes
+	}
+	value, ok := s.manifest.read(offset, ValueBytes)
+	if !ok {
+		return nil, &ManifestIncompleteError{Missing: []ByteRange{{Offset: offset, Length: ValueBytes}}}
+	}
+	return value, nil
+}
@@ -0,0 +1,75 @@
+package massifs
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyManifestLeaf(t *testing.T) {
+	ctx := context.Background()
+	store, verifier := buildSealedLog(t, 3, 10)
+
+	// massif 2 holds leaves 8 and 9, its proofs need the ancestor peak stack
+	const massifIndex = 2
+	data := store.massifs[massifIndex]
+	check, err := GetCheckpoint(ctx, store, massifIndex)
+	require.NoError(t, err)
+	mc, err := GetMassifContext(ctx, store, massifIndex)
+	require.NoError(t, err)
+
+	for _, leafIndex := range []uint64{8, 9} {
+		mmrIndex := mmr.MMRIndex(leafIndex)
+		required, err := ManifestRequiredRanges(mc.Start, check.MMRSize, mmrIndex)
+		require.NoError(t, err)
+		require.Less(t, required[0].Offset, mc.LogStart(), "the peak stack is required")
+
+		manifest, err := NewMassifManifest(data, append([]ByteRange{ManifestHeaderRange()}, required...))
+		require.NoError(t, err)
+		value, err := VerifyManifestLeaf(manifest, &check, verifier, mmrIndex)
+		require.NoError(t, err)
+		want, err := mc.Get(mmrIndex)
+		require.NoError(t, err)
+		require.Equal(t, want, value)
+
+		// a manifest of single values, not aligned with the required ranges
+		var values []ByteRange
+		for _, r := range required {
+			for offset := r.Offset; offset < r.End(); offset += ValueBytes {
+				values = append(values, ByteRange{Offset: offset, Length: ValueBytes})
+			}
+		}
+		manifest, err = NewMassifManifest(data, append(values, ManifestHeaderRange()))
+		require.NoError(t, err)
+		_, err = VerifyManifestLeaf(manifest, &check, verifier, mmrIndex)
+		require.NoError(t, err)
+	}
+
+	mmrIndex := mmr.MMRIndex(9)
+	required, err := ManifestRequiredRanges(mc.Start, check.MMRSize, mmrIndex)
+	require.NoError(t, err)
+
+	// without the header only the header can be requested
+	_, err = VerifyManifestLeaf(&MassifManifest{}, &check, verifier, mmrIndex)
+	var incomplete *ManifestIncompleteError
+	require.True(t, errors.As(err, &incomplete))
+	require.Equal(t, []ByteRange{ManifestHeaderRange()}, incomplete.Missing)
+
+	// with the header, exactly the missing ranges are requested
+	manifest, err := NewMassifManifest(data, []ByteRange{ManifestHeaderRange(), required[0]})
+	require.NoError(t, err)
+	_, err = VerifyManifestLeaf(manifest, &check, verifier, mmrIndex)
+	require.ErrorIs(t, err, ErrManifestIncomplete)
+	require.True(t, errors.As(err, &incomplete))
+	require.Equal(t, required[1:], incomplete.Missing)
+
+	// a tampered value fails verification
+	manifest, err = NewMassifManifest(data, append([]ByteRange{ManifestHeaderRange()}, required...))
+	require.NoError(t, err)
+	manifest.Ranges[len(manifest.Ranges)-1].Data[0] ^= 1
+	_, err = VerifyManifestLeaf(manifest, &check, verifier, mmrIndex)
+	require.Error(t, err)
+}
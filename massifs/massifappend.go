@@ -0,0 +1,72 @@
+package massifs
+
+import "bytes"
+
+// committedMassif is the state of a massif in storage, enough to work out
+// the writes that bring it up to date with the context.
+type committedMassif struct {
+	massifIndex uint32
+	size        uint64
+	tail        []byte
+	// prefix is a copy of the data before the log, the start header, index
+	// and peak stack. These are the only bytes an append changes in place.
+	prefix []byte
+}
+
+// markCommitted records the context data as the stored state of the massif
+func (mc *MassifContext) markCommitted() {
+	size := uint64(len(mc.Data))
+	logStart := min(mc.LogStart(), size)
+	committed := &committedMassif{
+		massifIndex: mc.Start.MassifIndex,
+		size:        size,
+		prefix:      bytes.Clone(mc.Data[:logStart]),
+	}
+	if size >= logStart+ValueBytes {
+		committed.tail = bytes.Clone(mc.Data[size-ValueBytes:])
+	}
+	mc.committed = committed
+}
+
+// appendWrites returns the writes which bring the stored massif up to date
+// with the context. The words before the log that changed are coalesced into
+// ranges, and the new log nodes follow. The committed length marker is
+// written last, so a reader never sees it ahead of the data. It returns false
+// if the stored state is not known, or the context is not a continuation of
+// it.
+func (mc *MassifContext) appendWrites() (MassifBase, []ManifestRange, bool) {
+	committed := mc.committed
+	if committed == nil || committed.massifIndex != mc.Start.MassifIndex {
+		return MassifBase{}, nil, false
+	}
+	prefixLen := uint64(len(committed.prefix))
+	if prefixLen != min(mc.LogStart(), uint64(len(mc.Data))) || committed.size > uint64(len(mc.Data)) {
+		return MassifBase{}, nil, false
+	}
+
+	markerStart, markerEnd := committedLengthRange()
+	var marker *ManifestRange
+
+	var writes []ManifestRange
+	for offset := uint64(0); offset < prefixLen; offset += ValueBytes {
+		end := min(offset+ValueBytes, prefixLen)
+		if bytes.Equal(committed.prefix[offset:end], mc.Data[offset:end]) {
+			continue
+		}
+		if offset == markerStart && end == markerEnd {
+			marker = &ManifestRange{Offset: offset, Data: mc.Data[offset:end]}
+			continue
+		}
+		if n := len(writes); n > 0 && writes[n-1].Offset+uint64(len(writes[n-1].Data)) == offset {
+			writes[n-1].Data = mc.Data[writes[n-1].Offset:end]
+			continue
+		}
+		writes = append(writes, ManifestRange{Offset: offset, Data: mc.Data[offset:end]})
+	}
+	writes = append(writes, ManifestRange{Offset: committed.size, Data: mc.Data[committed.size:]})
+	if marker != nil {
+		writes = append(writes, *marker)
+	}
+
+	return MassifBase{Size: committed.size, Tail: committed.tail}, writes, true
+}
@@ -4,18 +4,21 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/forestrie/go-merklelog/massifs/storage"
 	"github.com/forestrie/go-merklelog/mmr"
 )
 
-// GetAppendContext implements the unified logic for getting an append context
+// GetAppendContext implements the unified logic for getting an append context.
+// If the log is empty the first massif is created with the options of
+// CreateFirstMassifContext, otherwise they are ignored.
 func GetAppendContext(
-	ctx context.Context, reader ObjectReader, epoch uint32, massifHeight uint8,
+	ctx context.Context, reader ObjectReader, epoch uint32, massifHeight uint8, opts ...Option,
 ) (MassifContext, error) {
 	mc, err := GetMassifHeadContext(ctx, reader)
 	if errors.Is(err, storage.ErrLogEmpty) {
-		mc, err := CreateFirstMassifContext(ctx, epoch, massifHeight)
+		mc, err := CreateFirstMassifContext(ctx, epoch, massifHeight, opts...)
 		if err != nil {
 			return MassifContext{}, fmt.Errorf("failed to create first massif context: %w", err)
 		}
@@ -33,21 +36,32 @@ func GetAppendContext(
 	if err = InitAppendContext(ctx, reader, &mc); err != nil {
 		return MassifContext{}, fmt.Errorf("failed to init append context: %w", err)
 	}
+	if _, ok := reader.(ObjectAppender); ok && !mc.Creating {
+		mc.markCommitted()
+	}
 	return mc, nil
 }
 
-// CommitContext implements the unified logic for committing a massif context
-func CommitContext(ctx context.Context, writer ObjectWriter, mc *MassifContext) error {
+// CommitContext implements the unified logic for committing a massif context.
+// For the current massif format it also refreshes the statistics block, see
+// MassifStats, WithBuilderVersion and WithCommitClock, the index commitment,
+// see WithIndexCommitment, the committed length marker, see
+// MassifContext.CommittedLength, and the integrity block, see
+// WithIntegrityChecksums.
+//
+// If the writer is an ObjectAppender, and the context was read from or last
+// committed to it, only the new log nodes and the changed words of the header
+// and index are written. Otherwise the whole massif is Put.
+func CommitContext(ctx context.Context, writer ObjectWriter, mc *MassifContext, opts ...Option) error {
+	if err := mc.checkWritable("stored massif"); err != nil {
+		return err
+	}
 	// Check we have not over filled the massif.
 	// Note that we need to account for the size based on the full range. When
 	// committing massifs after the first, additional nodes are always required to
 	// "bury", the previous massif's nodes.
 
-	// leaves that the height (not the height index) allows for.
-	maxLeafIndex := ((mmr.HeightSize(uint64(mc.Start.MassifHeight))+1)>>1)*uint64(mc.Start.MassifIndex+1) - 1
-	spurHeight := mmr.SpurHeightLeaf(maxLeafIndex)
-	// The overall size of the massif that contains that many leaves.
-	maxMMRSize := mmr.MMRIndex(maxLeafIndex) + spurHeight + 1
+	maxMMRSize := massifMaxMMRSize(mc.Start)
 
 	count := mc.Count()
 
@@ -58,22 +72,76 @@ func CommitContext(ctx context.Context, writer ObjectWriter, mc *MassifContext)
 		return ErrMassifFull
 	}
 
+	if mc.Start.Version == MassifCurrentVersion {
+		options := CommitOptions{}
+		if err := ApplyOptions(&options, opts...); err != nil {
+			return err
+		}
+		now := time.Now()
+		if options.Clock != nil {
+			now = options.Clock.Wall()
+		}
+		if err := mc.updateStats(options.BuilderVersion, now); err != nil {
+			return fmt.Errorf("failed to update massif stats: %w", err)
+		}
+		if options.IndexCommitment || mc.hasIndexCommitment() {
+			if err := mc.SetIndexCommitment(); err != nil {
+				return fmt.Errorf("failed to update massif index commitment: %w", err)
+			}
+		}
+		if err := mc.setCommittedLength(); err != nil {
+			return fmt.Errorf("failed to update massif committed length: %w", err)
+		}
+		// last, the checksums cover the stats and the committed length
+		if options.IntegrityChecksums || mc.HasIntegrity() {
+			if err := mc.SetIntegrity(); err != nil {
+				return fmt.Errorf("failed to update massif integrity: %w", err)
+			}
+		}
+	}
+
+	appender, canAppend := writer.(ObjectAppender)
+	if canAppend && !mc.Creating {
+		if base, writes, ok := mc.appendWrites(); ok {
+			err := appender.AppendMassif(ctx, mc.Start.MassifIndex, base, writes)
+			if err != nil {
+				// The stored state is unknown, the next commit must Put
+				mc.committed = nil
+				return err
+			}
+			mc.markCommitted()
+			return nil
+		}
+	}
+
 	err := writer.Put(ctx, mc.Start.MassifIndex, storage.ObjectMassifData, mc.Data, mc.Creating)
 
 	mc.Creating = false
+	mc.committed = nil
+	if err == nil && canAppend {
+		mc.markCommitted()
+	}
 
 	return err
 }
 
+// massifMaxMMRSize returns the mmr size once the massif is complete
+func massifMaxMMRSize(start MassifStart) uint64 {
+	// leaves that the height (not the height index) allows for.
+	maxLeafIndex := ((mmr.HeightSize(uint64(start.MassifHeight))+1)>>1)*uint64(start.MassifIndex+1) - 1
+	spurHeight := mmr.SpurHeightLeaf(maxLeafIndex)
+	// The overall size of the massif that contains that many leaves.
+	return mmr.MMRIndex(maxLeafIndex) + spurHeight + 1
+}
+
 // InitAppendContext checks if the massif context needs to be rolled over to a new
 // massif and does so if required.
 func InitAppendContext(ctx context.Context, reader ObjectReader, mc *MassifContext) error {
 	var err error
 
-	// Size checking logic (identical for all storages)
-	sz := TreeSize(mc.Start.MassifHeight)
-	start := mc.LogStart()
-	if uint64(len(mc.Data))-start < sz {
+	// Size checking logic (identical for all storages). Counting entries,
+	// rather than comparing byte sizes, can not overflow for tall massifs.
+	if mc.Count() < TreeCount(mc.Start.MassifHeight) {
 		return nil
 	}
 
@@ -92,9 +160,24 @@ func InitAppendContext(ctx context.Context, reader ObjectReader, mc *MassifConte
 	return nil
 }
 
-// CreateFirstMassifContext creates the context for the very first massif
-func CreateFirstMassifContext(ctx context.Context, epoch uint32, massifHeight uint8) (MassifContext, error) {
+// CreateFirstMassifContext creates the context for the very first massif. The
+// option honoured is WithBloomParams.
+func CreateFirstMassifContext(
+	ctx context.Context, epoch uint32, massifHeight uint8, opts ...Option,
+) (MassifContext, error) {
+	if err := CheckMassifHeightV2(massifHeight); err != nil {
+		return MassifContext{}, err
+	}
+	options := CreateOptions{}
+	if err := ApplyOptions(&options, opts...); err != nil {
+		return MassifContext{}, err
+	}
 	start := NewMassifStart(0, epoch, massifHeight, 0, 0)
+	if options.BloomParams != nil {
+		if err := start.SetBloomParams(*options.BloomParams); err != nil {
+			return MassifContext{}, err
+		}
+	}
 
 	data, err := start.MarshalBinary()
 	if err != nil {
@@ -0,0 +1,84 @@
+package massifs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/forestrie/go-merklelog/mmr"
+)
+
+var ErrNodeMismatch = errors.New("the mmr node is not the hash of its children")
+
+// NodeMismatchError identifies the first interior node of a massif which is
+// not the hash of its children. It unwraps to ErrNodeMismatch.
+type NodeMismatchError struct {
+	MassifIndex uint32
+	MMRIndex    uint64
+}
+
+func (e *NodeMismatchError) Error() string {
+	return fmt.Sprintf("%v: massif %d, mmr index %d", ErrNodeMismatch, e.MassifIndex, e.MMRIndex)
+}
+
+func (e *NodeMismatchError) Unwrap() error {
+	return ErrNodeMismatch
+}
+
+// AuditMassif re-derives every interior node of the massif from its children
+// and returns a *NodeMismatchError for the first, in mmr index order, which
+// does not match. The left children of the nodes which complete a peak of an
+// earlier massif are read from the peak stack. Unlike verifying the seal,
+// which only shows the peaks are wrong, this localizes silent corruption of a
+// replica to a node. A corrupt leaf is reported as its parent, and a corrupt
+// peak stack entry as the first node derived from it. The leaves can not be
+// re-derived from the massif, so a corrupt last leaf without a parent is not
+// found.
+//
+// Returns nil if every interior node matches.
+func AuditMassif(mc *MassifContext) error {
+	// The peak stack map is built here, rather than with CreatePeakStackMap,
+	// so the audit does not change the context
+	peakStackMap := mc.PeakStackMap
+	if peakStackMap == nil && mc.Start.FirstIndex > 0 {
+		if peakStackMap = PeakStackMap(mc.Start.MassifHeight, mc.Start.FirstIndex); peakStackMap == nil {
+			return fmt.Errorf("invalid massif height or first index in start record")
+		}
+	}
+	get := func(i uint64) ([]byte, error) {
+		if i >= mc.Start.FirstIndex {
+			return mc.Get(i)
+		}
+		peakStackIndex, ok := peakStackMap[i]
+		if !ok {
+			return nil, fmt.Errorf("%w: %d is not in the peak map", ErrAncestorStackInvalid, i)
+		}
+		return mc.GetStackedPeak(peakStackIndex)
+	}
+
+	hasher := sha256.New()
+	for i := mc.Start.FirstIndex; i < mc.RangeCount(); i++ {
+		height := mmr.IndexHeight(i)
+		if height == 0 {
+			continue
+		}
+		left, err := get(i - (uint64(1) << height))
+		if err != nil {
+			return err
+		}
+		right, err := get(i - 1)
+		if err != nil {
+			return err
+		}
+		value, err := mc.Get(i)
+		if err != nil {
+			return err
+		}
+		hasher.Reset()
+		if !bytes.Equal(value, mmr.HashPosPair64(hasher, i+1, left, right)) {
+			return &NodeMismatchError{MassifIndex: mc.Start.MassifIndex, MMRIndex: i}
+		}
+	}
+	return nil
+}
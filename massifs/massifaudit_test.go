@@ -0,0 +1,49 @@
+package massifs
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditMassif(t *testing.T) {
+	ctx := context.Background()
+	store, _ := buildSealedLog(t, 3, 12)
+	for massifIndex := range uint32(3) {
+		mc, err := GetMassifContext(ctx, store, massifIndex)
+		require.NoError(t, err)
+		require.NoError(t, AuditMassif(&mc))
+	}
+
+	corruptAt := func(off func(mc *MassifContext) uint64) MassifContext {
+		mc, err := GetMassifContext(ctx, store, 1)
+		require.NoError(t, err)
+		mc.Data = append([]byte(nil), mc.Data...)
+		mc.Data[off(&mc)] ^= 0x01
+		return mc
+	}
+	logOffset := func(i uint64) func(mc *MassifContext) uint64 {
+		return func(mc *MassifContext) uint64 {
+			return mc.LogStart() + (i-mc.Start.FirstIndex)*ValueBytes
+		}
+	}
+	requireMismatch := func(mc MassifContext, want uint64) {
+		t.Helper()
+		err := AuditMassif(&mc)
+		require.ErrorIs(t, err, ErrNodeMismatch)
+		var mismatch *NodeMismatchError
+		require.True(t, errors.As(err, &mismatch))
+		require.Equal(t, uint32(1), mismatch.MassifIndex)
+		require.Equal(t, want, mismatch.MMRIndex)
+	}
+
+	// massif 1 holds nodes 7 to 14, 14 completes the peak 6 from massif 0
+	requireMismatch(corruptAt(logOffset(9)), 9)
+	requireMismatch(corruptAt(logOffset(13)), 13)
+	// a leaf is found by its parent
+	requireMismatch(corruptAt(logOffset(10)), 12)
+	// as is the peak stack entry for 6
+	requireMismatch(corruptAt(func(mc *MassifContext) uint64 { return mc.PeakStackStart() }), 14)
+}
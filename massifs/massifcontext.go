@@ -1,11 +1,13 @@
 package massifs
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
 	"hash"
 	"maps"
+	"slices"
 
 	"github.com/forestrie/go-merklelog/massifs/snowflakeid"
 	"github.com/forestrie/go-merklelog/mmr"
@@ -83,6 +85,110 @@ type MassifContext struct {
 	nextAncestor int
 
 	PeakStackMap map[uint64]int
+
+	// BindUrkleExtras selects urkle.LeafHashV2 for the urkle leaves appended
+	// through this context, so the leaf record extras are committed by the
+	// urkle root and proven with the leaf. It is not persisted, set it on every
+	// context used to append.
+	BindUrkleExtras bool
+
+	// ValidationHook, if set, is called by AddHashedLeaf before the data is
+	// changed. It is not persisted, set it on every context used to append.
+	ValidationHook ValidationHook
+
+	// EpochClock, if set, has AddHashedLeaf check that each idtimestamp was
+	// issued in the commitment epoch of the massif, judged at the clock's wall
+	// time, see IDTimestampEpoch. Set the clock the id generator is configured
+	// with. Leave it nil for a controlled rollover of a log to a new epoch,
+	// when ids the check would attribute to the other epoch are appended
+	// deliberately. It is not persisted, set it on every context used to
+	// append.
+	EpochClock snowflakeid.Clock
+
+	// ReadOnly makes every helper which changes the massif data, the log and
+	// index appends and the header and trailer Set* methods, fail with
+	// ErrMassifReadOnly. Verification sets it, see WithVerifyReadOnly, so the
+	// bytes reported are the bytes verified. It does not stop direct writes to
+	// Data. It is not persisted, use Writable for a context which can change.
+	ReadOnly bool
+
+	// peakMemo is the peak hash memo, nil unless it is enabled with
+	// EnablePeakHashMemo
+	peakMemo map[uint64][][]byte
+
+	// committed is the stored state of the massif, recorded when the context
+	// is read or committed for an ObjectAppender. It lets CommitContext write
+	// only the changes.
+	committed *committedMassif
+
+	// stored is the data as read, if the view of it was limited to the
+	// committed length
+	stored []byte
+
+	// undo, set only during AddHashedLeaves, saves the index bytes each leaf
+	// changes so a failed batch can be rolled back
+	undo *appendUndo
+}
+
+// ValidationHook enforces application level invariants on the leaves appended
+// by AddHashedLeaf. It is called with the leaf's idtimestamp, the trie key
+// (the extraBytes0 argument), the leaf value and the auxiliary extras, in
+// order logID, appID, extraBytes... . Returning an error vetoes the append,
+// AddHashedLeaf returns it wrapped in ErrAppendVetoed and the context is
+// unchanged.
+type ValidationHook func(idTimestamp uint64, trieKey []byte, value []byte, extraBytes [][]byte) error
+
+// Writable returns a copy of the context which can be changed, with its own
+// copy of the data. The context itself, and the data it reports, are left as
+// they are.
+func (mc *MassifContext) Writable() MassifContext {
+	w := *mc
+	w.Data = bytes.Clone(mc.Data)
+	w.PeakStackMap = mc.CopyPeakStack()
+	w.ReadOnly = false
+	if mc.peakMemo != nil {
+		w.peakMemo = map[uint64][][]byte{}
+	}
+	return w
+}
+
+// EnablePeakHashMemo has the context remember the peak hashes computed from
+// it, by mmr.PeakHashes, mmr.GetRoot and the functions which use them, such
+// as mmr.CheckConsistency. So sealing, and repeated verification of the same
+// state, read the peaks once. The memo is cleared by Append and
+// StartNextMassif. Copies of the context share the memo, other than those
+// made by Writable, and it is not cleared by direct changes to Data.
+func (mc *MassifContext) EnablePeakHashMemo() {
+	if mc.peakMemo == nil {
+		mc.peakMemo = map[uint64][][]byte{}
+	}
+}
+
+// PeakHashesMemo returns the memoized peak hashes of the mmr ending at
+// mmrIndex, see EnablePeakHashMemo
+func (mc *MassifContext) PeakHashesMemo(mmrIndex uint64) ([][]byte, bool) {
+	if mmrIndex >= mc.RangeCount() {
+		return nil, false
+	}
+	peaks, ok := mc.peakMemo[mmrIndex]
+	return peaks, ok
+}
+
+// MemoizePeakHashes records the peak hashes of the mmr ending at mmrIndex, if
+// the memo is enabled, see EnablePeakHashMemo
+func (mc *MassifContext) MemoizePeakHashes(mmrIndex uint64, peaks [][]byte) {
+	if mc.peakMemo != nil {
+		mc.peakMemo[mmrIndex] = peaks
+	}
+}
+
+// checkWritable returns ErrMassifReadOnly, naming the region a helper would
+// change, if the context is read only.
+func (mc *MassifContext) checkWritable(region string) error {
+	if !mc.ReadOnly {
+		return nil
+	}
+	return fmt.Errorf("%w: refusing to change the %s of massif %d", ErrMassifReadOnly, region, mc.Start.MassifIndex)
 }
 
 func (mc *MassifContext) CopyPeakStack() map[uint64]int {
@@ -107,6 +213,9 @@ func (mc *MassifContext) CreatePeakStackMap() error {
 }
 
 func (mc *MassifContext) StartNextMassif() error {
+	if err := mc.checkWritable("massif data"); err != nil {
+		return err
+	}
 	// re-create Start for the new blob
 
 	var err error
@@ -126,6 +235,8 @@ func (mc *MassifContext) StartNextMassif() error {
 		// massif blob, so we can use it to compute the first index of the new
 		// blob we are about to create.
 		mc.Start.MassifIndex+1, mc.RangeCount())
+	// The index of every massif of the log is laid out the same
+	nextStart.BloomK, nextStart.BloomBitsPerElement = mc.Start.BloomK, mc.Start.BloomBitsPerElement
 
 	nextData, err := nextStart.MarshalBinary()
 	if err != nil {
@@ -158,6 +269,7 @@ func (mc *MassifContext) StartNextMassif() error {
 	// store the updated data and update the start configuration for the new stack
 	mc.Start = nextStart
 	mc.Data = nextData
+	clear(mc.peakMemo)
 
 	// Initialize v2 index regions for the new massif.
 	if err := mc.initIndexV2(); err != nil {
@@ -197,8 +309,9 @@ func (mc MassifContext) NextPeakStack() ([]byte, error) {
 
 	// do the stack pop, the append happens naturally when the last leaf is added
 	// due to our always collecting it from the end of the log (via GetPeakStack
-	// above)
-	peakStack = peakStack[:(stackLen-pop)*ValueBytes]
+	// above). The stack aliases the previous massif data, copy it so the
+	// append can not write through to it.
+	peakStack = append([]byte(nil), peakStack[:(stackLen-pop)*ValueBytes]...)
 
 	// Now we have popped the ancestors we are done with, we can push the last
 	// value from the previous massif.
@@ -251,7 +364,14 @@ func (mc *MassifContext) Get(i uint64) ([]byte, error) {
 func (mc *MassifContext) get(i uint64) ([]byte, error) {
 	// Normal case, reference to a node included in the current massif
 	if i >= mc.Start.FirstIndex {
-		return IndexedLogValue(mc.Data[mc.LogStart():], i-mc.Start.FirstIndex), nil
+		// The range check guards the (i - FirstIndex) * LogEntryBytes
+		// multiplication against wrapping, which would otherwise return the
+		// wrong value rather than panic.
+		logStart := mc.LogStart()
+		if logStart > uint64(len(mc.Data)) || i-mc.Start.FirstIndex >= (uint64(len(mc.Data))-logStart)/LogEntryBytes {
+			return nil, fmt.Errorf("%w: %d", ErrIndexNotInMassif, i)
+		}
+		return IndexedLogValue(mc.Data[logStart:], i-mc.Start.FirstIndex), nil
 	}
 
 	// Ok, its a reference to a peak carried over from a previous massif or this is an error case
@@ -275,15 +395,17 @@ func (mc *MassifContext) get(i uint64) ([]byte, error) {
 func (mc *MassifContext) GetStackedPeak(peakStackIndex int) ([]byte, error) {
 	stackTop := mc.LogStart()
 	stackStart := mc.PeakStackStart()
-	if stackStart > stackTop {
+	if stackStart > stackTop || stackTop > uint64(len(mc.Data)) {
 		return nil, ErrAncestorStackInvalid
 	}
 
-	valueStart := stackStart + uint64(peakStackIndex)*ValueBytes
-	valueEnd := valueStart + ValueBytes
-	if valueEnd > stackTop {
+	// Checking the index against the stack height first means the offset
+	// arithmetic can not wrap.
+	if peakStackIndex < 0 || uint64(peakStackIndex) >= (stackTop-stackStart)/ValueBytes {
 		return nil, fmt.Errorf("%w: exceeded the data range of the ancestor peak stack", ErrAncestorStackInvalid)
 	}
+	valueStart := stackStart + uint64(peakStackIndex)*ValueBytes
+	valueEnd := valueStart + ValueBytes
 
 	return mc.Data[valueStart:valueEnd], nil
 }
@@ -314,6 +436,9 @@ func (mc *MassifContext) peakStackIndex(i uint64) (int, error) {
 // Append adds the leaf value to the log and returns the MMR index of the _next_ node
 // This method satisfies the Append method of the MMR NodeAdder interface
 func (mc *MassifContext) Append(value []byte) (uint64, error) {
+	if err := mc.checkWritable("log data"); err != nil {
+		return 0, err
+	}
 	if len(value) != ValueBytes {
 		return 0, ErrLogValueBadSize
 	}
@@ -328,6 +453,7 @@ func (mc *MassifContext) Append(value []byte) (uint64, error) {
 	// basic mmr add is bust and that is extensively covered by unit tests.
 
 	mc.Data = append(mc.Data, value...)
+	clear(mc.peakMemo)
 	return mc.RangeCount(), nil
 }
 
@@ -343,6 +469,9 @@ func (mc *MassifContext) Append(value []byte) (uint64, error) {
 //     timestamp, they must call `mc.SetLastIDTimestamp(...)` after a successful
 //     append.
 func (mc *MassifContext) AddIndexedEntry(value []byte) (uint64, error) {
+	if err := mc.checkWritable("log data"); err != nil {
+		return 0, err
+	}
 	if len(value) != ValueBytes {
 		return 0, ErrLogValueBadSize
 	}
@@ -391,6 +520,9 @@ func (mc *MassifContext) AddHashedLeaf(
 	value []byte,
 	extraBytes ...[]byte,
 ) (uint64, error) {
+	if err := mc.checkWritable("log data"); err != nil {
+		return 0, err
+	}
 	_ = hasher // retained for signature compatibility; v2 append path uses sha256 consistently.
 	if len(value) != ValueBytes {
 		return 0, ErrLogValueBadSize
@@ -400,12 +532,120 @@ func (mc *MassifContext) AddHashedLeaf(
 		return 0, err
 	}
 
+	if mc.EpochClock != nil {
+		if err := mc.checkIDTimestampEpoch(idTimestamp); err != nil {
+			return 0, err
+		}
+	}
+
+	extrasAll := make([][]byte, 0, 2+len(extraBytes))
+	extrasAll = append(extrasAll, logID, appID)
+	extrasAll = append(extrasAll, extraBytes...)
+
+	if mc.ValidationHook != nil {
+		if err := mc.ValidationHook(idTimestamp, extraBytes0, value, extrasAll); err != nil {
+			return 0, fmt.Errorf("%w: %w", ErrAppendVetoed, err)
+		}
+	}
+
 	// Append the MMR leaf first.
 	mmrSize, err := mc.AddIndexedEntry(value)
 	if err != nil {
 		return 0, err
 	}
 
+	leafOrdinal, err := mc.indexHashedLeaf(idTimestamp, extraBytes0, value, extrasAll)
+	if err != nil {
+		return 0, err
+	}
+	// Best-effort consistency check: leafOrdinal should match the just-appended leaf index.
+	if mc.MassifLeafCount() > 0 {
+		want := uint32(mc.MassifLeafCount() - 1)
+		if leafOrdinal != want {
+			return 0, fmt.Errorf("urkle leaf ordinal mismatch: got=%d want=%d", leafOrdinal, want)
+		}
+	}
+
+	// Persist last idtimestamp in the massif start header.
+	if err := mc.SetLastIDTimestamp(idTimestamp); err != nil {
+		return 0, err
+	}
+	return mmrSize, nil
+}
+
+// AddHashedLeaves adds the leaves in order, as AddHashedLeaf does for each,
+// growing the data buffer once for the whole batch. It returns the resulting
+// MMR size and the mmr leaf index of the first leaf added. The batch is added
+// entirely or not at all: if any leaf fails, or the batch does not fit in the
+// massif, the context is left as it was before the call. ErrMassifFull is
+// returned, and nothing added, if the massif has room for only part of the
+// batch.
+func (mc *MassifContext) AddHashedLeaves(hasher hash.Hash, leaves []BatchLeaf) (uint64, uint64, error) {
+	if err := mc.checkWritable("log data"); err != nil {
+		return 0, 0, err
+	}
+	firstLeaf := mmr.LeafCount(mc.RangeCount())
+	if len(leaves) == 0 {
+		return mc.RangeCount(), firstLeaf, nil
+	}
+	if err := mc.requireV2Index(); err != nil {
+		return 0, 0, err
+	}
+	leafCapacity := uint64(1) << (mc.Start.MassifHeight - 1)
+	if mc.MassifLeafCount()+uint64(len(leaves)) > leafCapacity {
+		return 0, 0, fmt.Errorf("%w: %d leaves do not fit, massif %d has %d of %d",
+			ErrMassifFull, len(leaves), mc.Start.MassifIndex, mc.MassifLeafCount(), leafCapacity)
+	}
+	for i, leaf := range leaves {
+		if len(leaf.Value) != ValueBytes {
+			return 0, 0, fmt.Errorf("leaf %d: %w", i, ErrLogValueBadSize)
+		}
+	}
+
+	// The index regions are updated in place, each leaf saves the bytes it
+	// changes so a failure can be rolled back.
+	undo := newAppendUndo(mc)
+	mc.undo = undo
+	defer func() { mc.undo = nil }()
+
+	// Every leaf, and the interior nodes it completes, is appended to the log
+	// region, grow it once for the size after the last leaf.
+	added, err := ReadLen((mmr.MMRIndex(firstLeaf+uint64(len(leaves))) - mc.RangeCount()) * ValueBytes)
+	if err != nil {
+		return 0, 0, err
+	}
+	mc.Data = slices.Grow(mc.Data, added)
+
+	var mmrSize uint64
+	for i, leaf := range leaves {
+		mmrSize, err = mc.AddHashedLeaf(
+			hasher, leaf.IDTimestamp, leaf.ExtraBytes0, leaf.LogID, leaf.AppID, leaf.Value, leaf.ExtraBytes...)
+		if err != nil {
+			undo.restore(mc)
+			return 0, 0, fmt.Errorf("leaf %d: %w", i, err)
+		}
+	}
+	return mmrSize, firstLeaf, nil
+}
+
+// checkIDTimestampEpoch returns an IDTimestampEpochError if the idtimestamp
+// was not issued in the commitment epoch of the massif, at the time of
+// EpochClock. A producer configured with the wrong epoch issues ids which sort
+// out of time order with the rest of the log.
+func (mc *MassifContext) checkIDTimestampEpoch(idTimestamp uint64) error {
+	epoch := IDTimestampEpoch(idTimestamp, mc.EpochClock.Wall().Add(IDTimestampEpochSkew))
+	if uint32(epoch) == mc.Start.CommitmentEpoch {
+		return nil
+	}
+	return &IDTimestampEpochError{IDTimestamp: idTimestamp, Epoch: epoch, MassifEpoch: mc.Start.CommitmentEpoch}
+}
+
+// indexHashedLeaf updates the v2 index structures (Urkle + Bloom) for a leaf,
+// as AddHashedLeaf does once the leaf is appended, and returns the Urkle leaf
+// ordinal. extrasAll is (logID, appID, extraBytes...).
+func (mc *MassifContext) indexHashedLeaf(
+	idTimestamp uint64, extraBytes0 []byte, value []byte, extrasAll [][]byte,
+) (uint32, error) {
 	// Update v2 index structures (Urkle + Bloom).
 	//
 	// The valueBytes parameter is stored directly in the trie leaf record as the content-hash.
@@ -414,10 +654,6 @@ func (mc *MassifContext) AddHashedLeaf(
 	//
 	// We store the last 3 of (logID, appID, extraBytes...) in the Urkle leaf record,
 	// but only attempt to insert 32-byte extras into bloom filters 1..3.
-	extrasAll := make([][]byte, 0, 2+len(extraBytes))
-	extrasAll = append(extrasAll, logID, appID)
-	extrasAll = append(extrasAll, extraBytes...)
-
 	stored := extrasAll
 	if len(stored) > 3 {
 		stored = stored[len(stored)-3:]
@@ -429,13 +665,6 @@ func (mc *MassifContext) AddHashedLeaf(
 	if err != nil {
 		return 0, err
 	}
-	// Best-effort consistency check: leafOrdinal should match the just-appended leaf index.
-	if mc.MassifLeafCount() > 0 {
-		want := uint32(mc.MassifLeafCount() - 1)
-		if leafOrdinal != want {
-			return 0, fmt.Errorf("urkle leaf ordinal mismatch: got=%d want=%d", leafOrdinal, want)
-		}
-	}
 
 	// Bloom filters: only insert 32-byte extras for filters 1..3.
 	extraDataBloom := make([][]byte, 0, 1+len(stored))
@@ -450,10 +679,7 @@ func (mc *MassifContext) AddHashedLeaf(
 	if err := mc.UpdateBloomFilters(value, extraDataBloom...); err != nil {
 		return 0, err
 	}
-
-	// Persist last idtimestamp in the massif start header.
-	mc.SetLastIDTimestamp(idTimestamp)
-	return mmrSize, nil
+	return leafOrdinal, nil
 }
 
 // CheckConsistency checks that the data in the massif is consistent with the provided state.
@@ -507,11 +733,15 @@ func (mc *MassifContext) CheckConsistency(
 
 // SetLastIDTimestamp updates the massif start record with the idTimestamp of
 // the last entry appended to the log.
-func (mc *MassifContext) SetLastIDTimestamp(idTimestamp uint64) {
+func (mc *MassifContext) SetLastIDTimestamp(idTimestamp uint64) error {
+	if err := mc.checkWritable("last idtimestamp"); err != nil {
+		return err
+	}
 	mc.Start.LastID = idTimestamp
 	// Note: must 'write through' to the data, so commit only has to put the
 	// bytes and doesn't care about the details of the format and its maintenance
 	binary.BigEndian.PutUint64(mc.Data[MassifStartKeyLastIDFirstByte:MassifStartKeyLastIDEnd], idTimestamp)
+	return nil
 }
 
 // GetLastIDTimestamp returns the idTimestamp of the last entry in the log
@@ -530,6 +760,10 @@ func (mc *MassifContext) GetLastIDTimestamp() uint64 {
 func (mc MassifContext) GetAncestorPeakStack() ([]byte, error) {
 	peakStackStart := mc.PeakStackStart()
 
+	// A corrupt header must not be able to wrap the end offset.
+	if mc.Start.PeakStackLen > MaxMMRHeight {
+		return nil, fmt.Errorf("%w: peak stack length %d exceeds %d", ErrAncestorStackInvalid, mc.Start.PeakStackLen, MaxMMRHeight)
+	}
 	peakStackEnd := mc.IndexEnd() + ValueBytes*mc.Start.PeakStackLen
 	if peakStackStart == peakStackEnd {
 		return nil, nil
@@ -548,6 +782,9 @@ func (mc MassifContext) GetAncestorPeakStack() ([]byte, error) {
 	if mc.Data == nil {
 		return nil, fmt.Errorf("%w: no data available", ErrAncestorStackInvalid)
 	}
+	if peakStackEnd > uint64(len(mc.Data)) {
+		return nil, fmt.Errorf("%w: peak stack end %d exceeds the data length %d", ErrAncestorStackInvalid, peakStackEnd, len(mc.Data))
+	}
 
 	return mc.Data[peakStackStart:peakStackEnd], nil
 }
@@ -635,7 +872,8 @@ func (mc MassifContext) IndexSize() uint64 {
 		return 0
 	}
 	leafCount := urkle.LeafCountForMassifHeight(mc.Start.MassifHeight)
-	sz, err := indexDataBytesV2(leafCount)
+	p, _ := mc.Start.BloomParams()
+	sz, err := indexDataBytesV2(leafCount, uint64(p.BitsPerElement))
 	if err != nil {
 		return 0
 	}
@@ -673,7 +911,7 @@ func (mc MassifContext) GetLastValue() []byte {
 func (mc MassifContext) Count() uint64 {
 	logStart := mc.LogStart()
 	if logStart > uint64(len(mc.Data)) {
-		return (uint64(len(mc.Data)) - logStart) / LogEntryBytes
+		return 0
 	}
 	return (uint64(len(mc.Data)) - logStart) / LogEntryBytes
 }
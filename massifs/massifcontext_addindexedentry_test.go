@@ -1,11 +1,17 @@
 package massifs
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
+	"errors"
+	"fmt"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/forestrie/go-merklelog/bloom"
+	"github.com/forestrie/go-merklelog/massifs/snowflakeid"
 	"github.com/forestrie/go-merklelog/urkle"
 	"github.com/stretchr/testify/require"
 )
@@ -119,3 +125,213 @@ func TestMassifContext_IndexLeaf_UpdatesUrkleAndBloom(t *testing.T) {
 	require.NoError(t, err)
 	require.True(t, ok)
 }
+
+func TestMassifContext_BindUrkleExtras_ProvesExtras(t *testing.T) {
+	mc, err := CreateFirstMassifContext(context.Background(), 1, 3)
+	require.NoError(t, err)
+	mc.BindUrkleExtras = true
+
+	logID := sha256.Sum256([]byte("log"))
+	for i := range uint64(mc.urkleLeafCountV2()) {
+		value := sha256.Sum256([]byte{byte(i)})
+		appID := []byte{0xA0, byte(i)}
+		_, err = mc.AddHashedLeaf(sha256.New(), 0x010000+i, nil, logID[:], appID, value[:])
+		require.NoError(t, err)
+	}
+
+	rootHash, ok, err := mc.UrkleRootHash()
+	require.NoError(t, err)
+	require.True(t, ok)
+	frontier, err := mc.UrkleFrontierRegion()
+	require.NoError(t, err)
+	st, ok, err := urkle.DecodeFrontierV1(frontier)
+	require.NoError(t, err)
+	require.True(t, ok)
+	leafTable, err := mc.UrkleLeafTableRegion()
+	require.NoError(t, err)
+	nodeStore, err := mc.UrkleNodeStoreRegion()
+	require.NoError(t, err)
+
+	p, err := urkle.ProveInclusion(leafTable, nodeStore, st.Pending, 0x010001)
+	require.NoError(t, err)
+	require.Equal(t, urkle.LeafHashV2, p.LeafHash)
+	// logID is stored, and committed, as extra1 which keeps 24 bytes
+	require.Equal(t, logID[:24], p.Extras[0][:24])
+	require.Equal(t, []byte{0xA0, 1}, p.Extras[1][:2])
+
+	ok, _, _, err = urkle.VerifyInclusion(sha256.New(), [urkle.HashBytes]byte(rootHash), p)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	p.Extras[1][1] ^= 0xFF
+	ok, _, _, err = urkle.VerifyInclusion(sha256.New(), [urkle.HashBytes]byte(rootHash), p)
+	require.ErrorIs(t, err, urkle.ErrVerifyInclusionFailed)
+	require.False(t, ok)
+}
+
+func TestMassifContext_AddHashedLeaf_ValidationHookVeto(t *testing.T) {
+	mc, err := CreateFirstMassifContext(context.Background(), 1, 3)
+	require.NoError(t, err)
+
+	trieKey := sha256.Sum256([]byte("trie-key"))
+	errPolicy := errors.New("policy")
+	var calls int
+	mc.ValidationHook = func(idTimestamp uint64, key []byte, value []byte, extraBytes [][]byte) error {
+		calls++
+		require.Equal(t, trieKey[:], key)
+		require.Equal(t, [][]byte{[]byte("log"), []byte("app"), []byte("x")}, extraBytes)
+		if idTimestamp > 1 {
+			return errPolicy
+		}
+		return nil
+	}
+
+	leaf := sha256.Sum256([]byte("mmr-leaf"))
+	_, err = mc.AddHashedLeaf(sha256.New(), 1, trieKey[:], []byte("log"), []byte("app"), leaf[:], []byte("x"))
+	require.NoError(t, err)
+
+	before := append([]byte(nil), mc.Data...)
+	_, err = mc.AddHashedLeaf(sha256.New(), 2, trieKey[:], []byte("log"), []byte("app"), leaf[:], []byte("x"))
+	require.ErrorIs(t, err, ErrAppendVetoed)
+	require.ErrorIs(t, err, errPolicy)
+	require.Equal(t, before, mc.Data)
+	require.Equal(t, 2, calls)
+}
+
+func TestMassifContext_AddHashedLeaf_EpochCheck(t *testing.T) {
+	now := time.Now()
+	id1, epoch := IDTimestampFromTime(now)
+	require.Equal(t, uint8(1), epoch)
+	require.Equal(t, uint8(1), IDTimestampEpoch(id1, now))
+	// an id later than the clock, by more than the skew, can only be from the
+	// previous epoch
+	id0, _ := IDTimestampFromTime(now.Add(time.Hour))
+	require.Equal(t, uint8(0), IDTimestampEpoch(id0, now))
+
+	mc, err := CreateFirstMassifContext(context.Background(), 1, 3)
+	require.NoError(t, err)
+	mc.EpochClock = snowflakeid.NewManualClock(now)
+	leaf := sha256.Sum256([]byte("mmr-leaf"))
+	_, err = mc.AddHashedLeaf(sha256.New(), id1, nil, nil, nil, leaf[:])
+	require.NoError(t, err)
+
+	before := append([]byte(nil), mc.Data...)
+	_, err = mc.AddHashedLeaf(sha256.New(), id0, nil, nil, nil, leaf[:])
+	require.ErrorIs(t, err, ErrIDTimestampEpoch)
+	var epochErr *IDTimestampEpochError
+	require.ErrorAs(t, err, &epochErr)
+	require.Equal(t, uint8(0), epochErr.Epoch)
+	require.Equal(t, uint32(1), epochErr.MassifEpoch)
+	require.Equal(t, before, mc.Data)
+
+	// the check is made at the time of the clock, not of the host: an hour
+	// on, id0 is from the current epoch
+	mc.EpochClock = snowflakeid.NewManualClock(now.Add(time.Hour))
+	_, err = mc.AddHashedLeaf(sha256.New(), id0, nil, nil, nil, leaf[:])
+	require.NoError(t, err)
+
+	// and it is only made when a clock is set
+	mc.EpochClock = nil
+	id2, _ := IDTimestampFromTime(now.Add(2 * time.Hour))
+	_, err = mc.AddHashedLeaf(sha256.New(), id2, nil, nil, nil, leaf[:])
+	require.NoError(t, err)
+}
+
+func TestMassifContext_AddHashedLeaves(t *testing.T) {
+	now := time.Now()
+	var leaves []BatchLeaf
+	for i := range 3 {
+		id, _ := IDTimestampFromTime(now.Add(time.Duration(i) * time.Millisecond))
+		value := sha256.Sum256(fmt.Appendf(nil, "batch-leaf-%d", i))
+		leaves = append(leaves, BatchLeaf{IDTimestamp: id, Value: value[:]})
+	}
+
+	// the batch adds the same data as the leaves added one at a time
+	one, err := CreateFirstMassifContext(context.Background(), 1, 3)
+	require.NoError(t, err)
+	for _, leaf := range leaves {
+		_, err = one.AddHashedLeaf(sha256.New(), leaf.IDTimestamp, nil, nil, nil, leaf.Value)
+		require.NoError(t, err)
+	}
+	mc, err := CreateFirstMassifContext(context.Background(), 1, 3)
+	require.NoError(t, err)
+	mmrSize, firstLeaf, err := mc.AddHashedLeaves(sha256.New(), leaves[:1])
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), mmrSize)
+	require.Equal(t, uint64(0), firstLeaf)
+	mmrSize, firstLeaf, err = mc.AddHashedLeaves(sha256.New(), leaves[1:])
+	require.NoError(t, err)
+	require.Equal(t, one.RangeCount(), mmrSize)
+	require.Equal(t, uint64(1), firstLeaf)
+	require.Equal(t, one.Data, mc.Data)
+
+	// a failing leaf leaves the context as it was
+	before := bytes.Clone(mc.Data)
+	start := mc.Start
+	id, _ := IDTimestampFromTime(now.Add(time.Second))
+	value := sha256.Sum256([]byte("batch-leaf-ok"))
+	_, _, err = mc.AddHashedLeaves(sha256.New(), []BatchLeaf{
+		{IDTimestamp: id, Value: value[:]},
+		{IDTimestamp: leaves[0].IDTimestamp, Value: value[:]},
+	})
+	require.Error(t, err)
+	require.Equal(t, before, mc.Data)
+	require.Equal(t, start, mc.Start)
+
+	// as does a batch too large for the massif
+	_, _, err = mc.AddHashedLeaves(sha256.New(), slices.Repeat([]BatchLeaf{{IDTimestamp: id, Value: value[:]}}, 2))
+	require.ErrorIs(t, err, ErrMassifFull)
+	require.Equal(t, before, mc.Data)
+
+	// the context still takes the leaf which fits
+	_, firstLeaf, err = mc.AddHashedLeaves(sha256.New(), []BatchLeaf{{IDTimestamp: id, Value: value[:]}})
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), firstLeaf)
+}
+
+func TestMassifContext_AddHashedLeavesRollsBackIndexes(t *testing.T) {
+	now := time.Now()
+	batch := func(from, n int) []BatchLeaf {
+		var leaves []BatchLeaf
+		for i := from; i < from+n; i++ {
+			id, _ := IDTimestampFromTime(now.Add(time.Duration(i) * time.Millisecond))
+			value := sha256.Sum256(fmt.Appendf(nil, "batch-leaf-%d", i))
+			extra := sha256.Sum256(fmt.Appendf(nil, "batch-extra-%d", i))
+			leaves = append(leaves, BatchLeaf{
+				IDTimestamp: id, Value: value[:], LogID: extra[:], AppID: extra[:], ExtraBytes: [][]byte{extra[:]},
+			})
+		}
+		return leaves
+	}
+
+	mc, err := CreateFirstMassifContext(context.Background(), 1, 6)
+	require.NoError(t, err)
+	mc.BindUrkleExtras = true
+	_, _, err = mc.AddHashedLeaves(sha256.New(), batch(0, 5))
+	require.NoError(t, err)
+
+	// the last leaf of the batch is vetoed, after the others changed the
+	// bloom filters and the urkle trie in place
+	before := bytes.Clone(mc.Data)
+	vetoed := batch(5, 8)
+	mc.ValidationHook = func(idTimestamp uint64, trieKey []byte, value []byte, extraBytes [][]byte) error {
+		if idTimestamp == vetoed[len(vetoed)-1].IDTimestamp {
+			return errors.New("vetoed")
+		}
+		return nil
+	}
+	_, _, err = mc.AddHashedLeaves(sha256.New(), vetoed)
+	require.ErrorIs(t, err, ErrAppendVetoed)
+	require.Equal(t, before, mc.Data)
+
+	// and the context appends as if the batch was never tried
+	mc.ValidationHook = nil
+	_, _, err = mc.AddHashedLeaves(sha256.New(), vetoed)
+	require.NoError(t, err)
+	one, err := CreateFirstMassifContext(context.Background(), 1, 6)
+	require.NoError(t, err)
+	one.BindUrkleExtras = true
+	_, _, err = one.AddHashedLeaves(sha256.New(), append(batch(0, 5), vetoed...))
+	require.NoError(t, err)
+	require.Equal(t, one.Data, mc.Data)
+}
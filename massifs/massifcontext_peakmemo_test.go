@@ -0,0 +1,57 @@
+package massifs
+
+import (
+	"context"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMassifContextPeakHashMemo(t *testing.T) {
+	ctx := context.Background()
+	store, _ := buildSealedLog(t, 3, 10)
+	head, err := store.HeadIndex(ctx, storage.ObjectMassifData)
+	require.NoError(t, err)
+	mc, err := GetMassifContext(ctx, store, head)
+	require.NoError(t, err)
+	size := mc.RangeCount()
+	want, err := mmr.PeakHashes(&mc, size-1)
+	require.NoError(t, err)
+
+	mc.EnablePeakHashMemo()
+	got, err := mmr.PeakHashes(&mc, size-1)
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	// direct changes to the data are not seen, the peaks are not read again
+	last := mmr.Peaks(size - 1)
+	lastPeak := last[len(last)-1]
+	off := mc.LogStart() + (lastPeak-mc.Start.FirstIndex)*ValueBytes
+	mc.Data[off] ^= 1
+	got, err = mmr.PeakHashes(&mc, size-1)
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+	ok, _, err := mmr.CheckConsistency(&mc, sha256.New(), size, size, want)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// a writable copy has its own memo
+	w := mc.Writable()
+	got, err = mmr.PeakHashes(&w, size-1)
+	require.NoError(t, err)
+	require.NotEqual(t, want, got)
+
+	// an append clears the memo
+	_, err = mc.Append(make([]byte, ValueBytes))
+	require.NoError(t, err)
+	got, err = mmr.PeakHashes(&mc, size-1)
+	require.NoError(t, err)
+	require.NotEqual(t, want, got)
+
+	// and the sizes past the data are never memoized
+	_, ok = mc.PeakHashesMemo(mc.RangeCount())
+	require.False(t, ok)
+}
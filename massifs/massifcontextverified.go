@@ -43,22 +43,86 @@ func (mc *MassifContext) VerifyContext(
 		return nil, fmt.Errorf("%w: a checkpoint is required to verify a massif context", ErrSealNotFound)
 	}
 	check := options.Check
+	if options.ReadOnly {
+		mc.ReadOnly = true
+	}
 
 	if check.MMRSize > mc.RangeCount() {
 		return nil, fmt.Errorf("%w: MMR size %d < %d", ErrStateSizeExceedsData, mc.RangeCount(), check.MMRSize)
 	}
 
+	if options.RequireSealSubject {
+		if err := checkSealSubject(check, options.LogID, mc.Start.CommitmentEpoch); err != nil {
+			return nil, err
+		}
+	}
+
+	if options.RequireIndexCommitment {
+		if err := checkSealIndexCommitment(check, mc); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := checkSealIndexConfig(check, mc, options.RequireIndexConfig); err != nil {
+		return nil, err
+	}
+
+	if options.MinSealVersion != nil {
+		if err := checkSealVersion(check, *options.MinSealVersion, mc.Start.Version); err != nil {
+			return nil, err
+		}
+	}
+
+	if options.LatestSeen != nil {
+		if len(options.LogID) == 0 {
+			return nil, ErrLatestSeenLogIDRequired
+		}
+		if !options.AllowRollback {
+			err := options.LatestSeen.check(
+				options.LogID, mc.Start.MassifHeight, mc.Start.MassifIndex, check.MMRSize)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	// Verify the seal signature over the accumulator read from the store: we
 	// are checking the store against the sealed state, so any tampering with
 	// the sealed peaks is caught here. Of course the seal itself could have
 	// been replaced, but at that point the only defense is an independent
-	// replica.
-	accumulator, err := VerifyCheckpointReceipt(mc, &check.Receipt, options.COSEVerifier)
+	// replica. The signature is checked even for a massif in the
+	// verification cache, the cache does not know which keys the caller
+	// trusts.
+	verifier, err := options.checkpointVerifier(&check.Receipt)
+	if err != nil {
+		return nil, fmt.Errorf("%w: massif %d", err, mc.Start.MassifIndex)
+	}
+	if options.SignatureCache != nil && verifier != nil {
+		verifier = options.SignatureCache.Verifier(verifier)
+	}
+	accumulator, err := VerifyCheckpointReceipt(mc, &check.Receipt, verifier)
 	if err != nil {
 		return nil, fmt.Errorf(
 			"%w: failed to verify checkpoint for massif %d", err, mc.Start.MassifIndex)
 	}
 
+	// A completed massif is immutable, if its content has been verified
+	// against this checkpoint content before the consistency of the data past
+	// the seal is already established. The trusted base state is specific to
+	// the caller, so it is always checked in full.
+	cacheable := options.Cache != nil && check.Raw != nil && mc.Count() >= TreeCount(mc.Start.MassifHeight)
+	if cacheable && options.TrustedBaseState == nil && options.Cache.Verified(mc.Data, check.Raw) {
+		vc, err := mc.cachedVerifiedContext(check, accumulator)
+		if err != nil {
+			return nil, err
+		}
+		if err = options.observeEquivocation(check, vc.Accumulator); err != nil {
+			return nil, err
+		}
+		options.observeLatestSeen(check.MMRSize)
+		return vc, nil
+	}
+
 	// This verifies the sealed accumulator is consistent with any additional
 	// committed data in the massif beyond the seal.
 	ok, consistentRoots, err := mmr.CheckConsistency(
@@ -80,21 +144,19 @@ func (mc *MassifContext) VerifyContext(
 	// check the remote log is consistent with the log portion they have
 	// locally before replicating the new data.
 	if options.TrustedBaseState != nil {
-		ok, _, err = mmr.CheckConsistency(
-			mc, sha256.New(),
-			options.TrustedBaseState.MMRSize,
-			mc.RangeCount(),
-			options.TrustedBaseState.Peaks)
-		if err != nil {
+		if err = checkTrustedBaseState(mc, *options.TrustedBaseState); err != nil {
 			return nil, err
 		}
-		if !ok {
-			return nil, fmt.Errorf(
-				"%w: the accumulator produced for the trusted base state doesn't match the root produced for the seal state fetched from the log",
-				mmr.ErrConsistencyCheck)
-		}
 	}
 
+	if err = options.observeEquivocation(check, accumulator); err != nil {
+		return nil, err
+	}
+	if cacheable {
+		options.Cache.Record(mc.Data, check.Raw)
+	}
+	options.observeLatestSeen(check.MMRSize)
+
 	return &VerifiedContext{
 		MassifContext:   *mc,
 		Checkpoint:      *check,
@@ -102,3 +164,49 @@ func (mc *MassifContext) VerifyContext(
 		ConsistentRoots: consistentRoots,
 	}, nil
 }
+
+// checkTrustedBaseState returns an error unless the data of the massif is
+// consistent with the trusted state
+func checkTrustedBaseState(mc *MassifContext, trusted MMRState) error {
+	ok, _, err := mmr.CheckConsistency(mc, sha256.New(), trusted.MMRSize, mc.RangeCount(), trusted.Peaks)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf(
+			"%w: the accumulator produced for the trusted base state doesn't match the root produced for the seal state fetched from the log",
+			mmr.ErrConsistencyCheck)
+	}
+	return nil
+}
+
+// cachedVerifiedContext returns the VerifiedContext for a context whose
+// verification is recorded in a VerificationCache, and whose signed
+// accumulator has been verified. The consistent roots are read directly, the
+// recorded verification established they are consistent with the
+// accumulator.
+func (mc *MassifContext) cachedVerifiedContext(check *Checkpoint, accumulator [][]byte) (*VerifiedContext, error) {
+	consistentRoots, err := mmr.PeakHashes(mc, mc.RangeCount()-1)
+	if err != nil {
+		return nil, err
+	}
+	return &VerifiedContext{
+		MassifContext:   *mc,
+		Checkpoint:      *check,
+		Accumulator:     accumulator,
+		ConsistentRoots: consistentRoots,
+	}, nil
+}
+
+// observeLatestSeen records a verified checkpoint size in the latest seen
+// store, if there is one.
+func (options VerifyOptions) observeLatestSeen(mmrSize uint64) {
+	if options.LatestSeen == nil {
+		return
+	}
+	if options.AllowRollback {
+		options.LatestSeen.Reset(options.LogID, mmrSize)
+		return
+	}
+	options.LatestSeen.Observe(options.LogID, mmrSize)
+}
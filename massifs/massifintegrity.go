@@ -0,0 +1,173 @@
+package massifs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/forestrie/go-merklelog/massifs/logformat"
+)
+
+// The integrity block occupies start header reserved words 3 and 4. It holds
+// a CRC32C of each region of the massif, see MassifFormat, so corruption at
+// the storage layer is caught when the massif is read, without recomputing
+// the log hashes. It is not appended as a trailer because the log region
+// grows with every commit. Like the statistics block it is not covered by
+// the log's signatures, nor by any log or index hash.
+//
+//	| version | region count | unused | data length | region crc32c ... |
+//	| 0       | 1            | 2 - 3  | 4 - 11      | 12 - 4n+11        |
+//	| 1       | 1            | 2      | 8           | 4 each            |
+//
+// The checksums of the regions containing the block are computed with its
+// words zeroed. Only the bytes of the log region present, data length less
+// its offset, are summed.
+const (
+	massifIntegrityWord      = logformat.IntegrityWord
+	massifIntegrityWordCount = logformat.IntegrityWordCount
+
+	MassifIntegrityVersion = uint8(1)
+
+	massifIntegrityVersionByte  = 0
+	massifIntegrityCountByte    = 1
+	massifIntegrityLengthStart  = 4
+	massifIntegritySumsStart    = 12
+	massifIntegrityChecksumSize = 4
+)
+
+var ErrIntegrityMismatch = errors.New("the massif data does not match its integrity checksums")
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// integrityRange returns the byte range of the integrity block
+func integrityRange() (start, end uint64, err error) {
+	start, _, err = startHeaderWordRange(massifIntegrityWord)
+	if err != nil {
+		return 0, 0, err
+	}
+	_, end, err = startHeaderWordRange(massifIntegrityWord + massifIntegrityWordCount - 1)
+	return start, end, err
+}
+
+// HasIntegrity returns true if the massif carries the integrity block. It is
+// only supported by the current massif format.
+func (mc MassifContext) HasIntegrity() bool {
+	if mc.Start.Version != MassifCurrentVersion {
+		return false
+	}
+	start, end, err := integrityRange()
+	if err != nil || end > uint64(len(mc.Data)) {
+		return false
+	}
+	return !isAllZero(mc.Data[start:end])
+}
+
+// SetIntegrity computes the checksums of the massif data and writes the
+// integrity block through to it. CommitContext calls it if the massif already
+// has a block, or WithIntegrityChecksums is set.
+func (mc *MassifContext) SetIntegrity() error {
+	if err := mc.checkWritable("integrity block"); err != nil {
+		return err
+	}
+	if err := mc.requireV2Index(); err != nil {
+		return err
+	}
+	sums, err := mc.integritySums()
+	if err != nil {
+		return err
+	}
+	start, end, err := integrityRange()
+	if err != nil {
+		return err
+	}
+	if massifIntegritySumsStart+len(sums)*massifIntegrityChecksumSize > int(end-start) {
+		return fmt.Errorf("%d integrity checksums do not fit the start header", len(sums))
+	}
+	raw := mc.Data[start:end]
+	clear(raw)
+	raw[massifIntegrityVersionByte] = MassifIntegrityVersion
+	raw[massifIntegrityCountByte] = uint8(len(sums))
+	binary.BigEndian.PutUint64(raw[massifIntegrityLengthStart:massifIntegritySumsStart], uint64(len(mc.Data)))
+	for i, sum := range sums {
+		at := massifIntegritySumsStart + i*massifIntegrityChecksumSize
+		binary.BigEndian.PutUint32(raw[at:at+massifIntegrityChecksumSize], sum)
+	}
+	return nil
+}
+
+// CheckIntegrity checks the massif data against its integrity block. ok is
+// false, and the error nil, if there is no block to check against, or the
+// block was computed for a different data length. The latter is the case for
+// a massif committed by software which does not maintain the block, or read
+// while an in place append is in progress (see ObjectAppender). A reader
+// racing an in place append may also see ErrIntegrityMismatch, and should
+// read again before concluding the data is corrupt.
+func (mc MassifContext) CheckIntegrity() (ok bool, err error) {
+	if !mc.HasIntegrity() {
+		return false, nil
+	}
+	start, end, err := integrityRange()
+	if err != nil {
+		return false, err
+	}
+	raw := mc.Data[start:end]
+	if raw[massifIntegrityVersionByte] != MassifIntegrityVersion {
+		return false, fmt.Errorf("unsupported massif integrity version %d", raw[massifIntegrityVersionByte])
+	}
+	if binary.BigEndian.Uint64(raw[massifIntegrityLengthStart:massifIntegritySumsStart]) != uint64(len(mc.Data)) {
+		return false, nil
+	}
+	sums, err := mc.integritySums()
+	if err != nil {
+		return false, err
+	}
+	if int(raw[massifIntegrityCountByte]) != len(sums) {
+		return false, fmt.Errorf("%w: %d checksums, the massif has %d regions",
+			ErrIntegrityMismatch, raw[massifIntegrityCountByte], len(sums))
+	}
+	f, err := mc.Format()
+	if err != nil {
+		return false, err
+	}
+	for i, sum := range sums {
+		at := massifIntegritySumsStart + i*massifIntegrityChecksumSize
+		if binary.BigEndian.Uint32(raw[at:at+massifIntegrityChecksumSize]) != sum {
+			return false, &RegionError{
+				Err: ErrIntegrityMismatch, MassifIndex: mc.Start.MassifIndex,
+				Region: f.Regions[i], DataLen: uint64(len(mc.Data)),
+			}
+		}
+	}
+	return true, nil
+}
+
+// integritySums returns the checksum of each region, in format order
+func (mc MassifContext) integritySums() ([]uint32, error) {
+	f, err := mc.Format()
+	if err != nil {
+		return nil, err
+	}
+	start, end, err := integrityRange()
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(mc.Data)) < StartHeaderSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrMassifDataLengthInvalid, len(mc.Data))
+	}
+	header := make([]byte, StartHeaderSize)
+	copy(header, mc.Data[:StartHeaderSize])
+	clear(header[start:end])
+
+	n := uint64(len(mc.Data))
+	sums := make([]uint32, 0, len(f.Regions))
+	for _, r := range f.Regions {
+		src := mc.Data
+		if r.End() <= StartHeaderSize {
+			src = header
+		}
+		lo, hi := min(r.Offset, n), min(r.End(), n)
+		sums = append(sums, crc32.Checksum(src[lo:hi], castagnoli))
+	}
+	return sums, nil
+}
@@ -0,0 +1,68 @@
+package massifs
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMassifIntegrity(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore(nil, nil)
+	for i := range 3 {
+		mc, err := GetAppendContext(ctx, store, 1, 3)
+		require.NoError(t, err)
+		leaf := sha256.Sum256(fmt.Appendf(nil, "integrity-leaf-%d", i))
+		_, err = mc.AddHashedLeaf(sha256.New(), uint64(i+1), nil, nil, nil, leaf[:])
+		require.NoError(t, err)
+		var opts []Option
+		if i == 0 {
+			opts = append(opts, WithIntegrityChecksums())
+		}
+		// after the first commit the block is maintained without the option
+		require.NoError(t, CommitContext(ctx, store, &mc, opts...))
+	}
+
+	mc, err := GetMassifContext(ctx, store, 0)
+	require.NoError(t, err)
+	require.True(t, mc.HasIntegrity())
+	ok, err := mc.CheckIntegrity()
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	f, err := mc.Format()
+	require.NoError(t, err)
+	for _, name := range []string{RegionStats, RegionBloomBitsets, RegionUrkleLeafTable, RegionLog} {
+		r, ok := f.Region(name)
+		require.True(t, ok)
+		corrupt := cloneMemStore(store)
+		corrupt.massifs[0] = append([]byte(nil), store.massifs[0]...)
+		corrupt.massifs[0][r.Offset] ^= 0x01
+
+		_, err = GetMassifContext(ctx, corrupt, 0)
+		require.ErrorIs(t, err, ErrIntegrityMismatch, name)
+		var regionErr *RegionError
+		require.True(t, errors.As(err, &regionErr))
+		require.Equal(t, name, regionErr.Region.Name)
+	}
+
+	// data appended by a writer which does not maintain the block is not
+	// checked
+	mc.Data = append(mc.Data, make([]byte, ValueBytes)...)
+	ok, err = mc.CheckIntegrity()
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// nor is a massif without the block
+	plain, _ := buildSealedLog(t, 3, 2)
+	mc, err = GetMassifContext(ctx, plain, 0)
+	require.NoError(t, err)
+	require.False(t, mc.HasIntegrity())
+	ok, err = mc.CheckIntegrity()
+	require.NoError(t, err)
+	require.False(t, ok)
+}
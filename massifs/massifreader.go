@@ -18,8 +18,12 @@ func GetMassifContext(ctx context.Context, reader ObjectReader, massifIndex uint
 	// Allow for partial reads, its more efficient for some stores to read and cache the available start headers.
 	data, _, err := reader.MassifData(massifIndex)
 	if err != nil {
+		var notFound *storage.NotFoundError
+		if massifIndex == 0 && errors.As(err, &notFound) {
+			return MassifContext{}, storage.NewLogEmptyError(notFound.LogID)
+		}
 		if massifIndex == 0 && errors.Is(err, storage.ErrDoesNotExist) {
-			return MassifContext{}, fmt.Errorf("%w: no object for massif zero", storage.ErrLogEmpty)
+			return MassifContext{}, storage.NewLogEmptyError(nil)
 		}
 		return MassifContext{}, err
 	}
@@ -31,11 +35,9 @@ func GetMassifContext(ctx context.Context, reader ObjectReader, massifIndex uint
 		}
 	}
 
-	mc := MassifContext{
-		MassifData: MassifData{
-			Data: data,
-		},
-		Start: MakeMassifStart(data),
+	mc, err := newStoredMassifContext(data)
+	if err != nil {
+		return MassifContext{}, err
 	}
 
 	// Note: log writers don't need this due to how AddLeaf works, but almost
@@ -51,6 +53,39 @@ func GetMassifContext(ctx context.Context, reader ObjectReader, massifIndex uint
 	return mc, nil
 }
 
+// newStoredMassifContext returns a context over massif data read from
+// storage. Every reader of stored data goes through it. The view of the data
+// is limited to the committed length, so a reader never sees part of a commit
+// in progress, and the layout and integrity block are checked, so the offsets
+// of a corrupt header are never trusted.
+func newStoredMassifContext(data []byte) (MassifContext, error) {
+	if len(data) < StartHeaderEnd {
+		return MassifContext{}, fmt.Errorf("%w: start header incomplete", ErrMassifDataLengthInvalid)
+	}
+	mc := MassifContext{
+		MassifData: MassifData{
+			Data: data,
+		},
+		Start: MakeMassifStart(data),
+	}
+	if mc.Start.Version == MassifCurrentVersion {
+		if err := CheckMassifHeightV2(mc.Start.MassifHeight); err != nil {
+			return MassifContext{}, err
+		}
+		// Honour the committed length, a commit may be in progress
+		if err := mc.truncateToCommitted(); err != nil {
+			return MassifContext{}, err
+		}
+	}
+	if err := mc.ValidateLayout(); err != nil {
+		return MassifContext{}, err
+	}
+	if _, err := mc.CheckIntegrity(); err != nil {
+		return MassifContext{}, err
+	}
+	return mc, nil
+}
+
 // GetMassifHeadContext retrieves the current head context of a massif from the provided ObjectReader.
 // It obtains the latest massif index and then fetches the corresponding MassifContext.
 // Returns an error if the head index cannot be retrieved or if fetching the MassifContext fails.
@@ -190,12 +225,14 @@ func GetCheckpoint(
 // It applies any additional verification options supplied via opts. If a
 // checkpoint is not provided in the options, it fetches the checkpoint for the
 // specified massif index. The function returns a VerifiedContext if
-// verification succeeds, or an error if any step fails.
+// verification succeeds, or an error if any step fails. With WithSealRefresh
+// a stale replica is refreshed from the configured source.
 //
 // Parameters:
 //   - ctx: The context for controlling cancellation and deadlines.
 //   - reader: An ObjectReader used to access massif data.
-//   - verifier: The COSE verifier for the checkpoint receipt signature (required).
+//   - verifier: The COSE verifier for the checkpoint receipt signature, required
+//     unless the keys are given with WithTrustedKeys.
 //   - massifIndex: The index of the massif to verify.
 //   - opts: Optional verification options.
 //
@@ -211,9 +248,8 @@ func GetContextVerified(
 		COSEVerifier: verifier,
 	}
 
-	// Apply provided options
-	for _, opt := range opts {
-		opt(verifyOpts)
+	if err := ApplyOptions(verifyOpts, opts...); err != nil {
+		return nil, err
 	}
 
 	// Get the basic massif context
@@ -230,6 +266,12 @@ func GetContextVerified(
 		}
 		verifyOpts.Check = &check
 	}
+	// A seal past the committed length shows the marker is stale
+	mc.extendToSealed(verifyOpts.Check.MMRSize)
 
-	return mc.VerifyContext(ctx, *verifyOpts)
+	vc, err := mc.VerifyContext(ctx, *verifyOpts)
+	if err != nil || verifyOpts.RefreshSource == nil {
+		return vc, err
+	}
+	return refreshVerifiedContext(ctx, vc, *verifyOpts)
 }
@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 
 	"github.com/forestrie/go-merklelog/massifs/storage"
 	"github.com/veraison/go-cose"
@@ -19,7 +20,14 @@ var (
 // into the provided ObjectWriter. It first writes the massif data, then writes
 // the checkpoint object bytes verbatim. The checkpoint is copied rather than
 // re-encoded so unprotected header content the decoder does not model
-// survives replication. If any operation fails, an error is returned.
+// survives replication. If any operation fails, an error is returned. If
+// objectWriter implements ObjectLocker, the massif lock is held across both
+// writes.
+//
+// The checkpoint claims the massif data is verified, so it must never be
+// durable without the data. Writing in this order is only sufficient if the
+// writer makes each Put durable before it returns, for a DirWriter that
+// requires DurabilityFsync or DurabilitySync.
 //
 // Parameters:
 //
@@ -30,8 +38,19 @@ var (
 // Returns:
 //
 //	error - non-nil if storing the data fails
-func ReplaceVerifiedContext(ctx context.Context, objectWriter ObjectWriter, vc *VerifiedContext) error {
-	var err error
+func ReplaceVerifiedContext(ctx context.Context, objectWriter ObjectWriter, vc *VerifiedContext) (err error) {
+	if locker, ok := objectWriter.(ObjectLocker); ok {
+		var unlock func() error
+		unlock, err = locker.Lock(ctx, vc.MassifContext.Start.MassifIndex)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if uerr := unlock(); err == nil {
+				err = uerr
+			}
+		}()
+	}
 
 	// put the data first, a racy seal read will still be valid
 	err = objectWriter.Put(ctx, vc.MassifContext.Start.MassifIndex, storage.ObjectMassifData, vc.MassifContext.Data, false)
@@ -42,12 +61,41 @@ func ReplaceVerifiedContext(ctx context.Context, objectWriter ObjectWriter, vc *
 	return objectWriter.Put(ctx, vc.MassifContext.Start.MassifIndex, storage.ObjectCheckpoint, vc.Checkpoint.Raw, false)
 }
 
+// ReplicateOptions configures VerifyingReplicator.ReplicateVerifiedUpdates
+type ReplicateOptions struct {
+	// Concurrency is the number of source massifs read and verified at once,
+	// see WithConcurrency. Zero or one replicates a massif at a time.
+	Concurrency int
+}
+
+// Validate returns an error wrapping ErrInvalidOptions if the options are out
+// of range.
+func (o *ReplicateOptions) Validate() error {
+	if o.Concurrency < 0 {
+		return fmt.Errorf("%w: replication concurrency %d", ErrInvalidOptions, o.Concurrency)
+	}
+	return nil
+}
+
+// WithConcurrency has ReplicateVerifiedUpdates read and verify up to n source
+// massifs at once. The source reader must be safe for concurrent use. The
+// massifs are still checked for consistency with the sink, and written to
+// it, in order, so the result is the same as replicating one at a time.
+func WithConcurrency(n int) Option {
+	return func(a any) {
+		if opts, ok := a.(*ReplicateOptions); ok {
+			opts.Concurrency = n
+		}
+	}
+}
+
 type VerifyingReplicator struct {
 	COSEVerifier cose.Verifier
 
 	// Source provides the upstream (source of truth) log to replicate from.
 	Source ObjectReader
-	// Sink is the downstream replica where the log is replicated to.
+	// Sink is the downstream replica where the log is replicated to. Local
+	// replicas choose their object layout with WithPathScheme.
 	Sink ObjectReaderWriter
 }
 
@@ -64,6 +112,7 @@ type VerifyingReplicator struct {
 //	ctx         - Context for cancellation and deadlines.
 //	startMassif - The starting massif index to replicate (inclusive).
 //	endMassif   - The ending massif index to replicate (inclusive).
+//	opts        - WithConcurrency to read and verify source massifs in parallel.
 //
 // Returns:
 //
@@ -71,39 +120,25 @@ type VerifyingReplicator struct {
 func (v *VerifyingReplicator) ReplicateVerifiedUpdates(
 	ctx context.Context,
 	startMassif, endMassif uint32,
+	opts ...Option,
 ) error {
-	isNilOrNotFound := func(err error) bool {
-		if err == nil {
-			return true
-		}
-		if errors.Is(err, storage.ErrDoesNotExist) {
-			return true
-		}
-
-		if errors.Is(err, storage.ErrLogEmpty) {
-			return true
-		}
-
-		// SelectLog on the sink reader always primes the cache. So NotAvailable is equivalent to not found.
-		if errors.Is(err, storage.ErrNotAvailable) {
-			return true
-		}
-
-		return false
+	options := ReplicateOptions{}
+	if err := ApplyOptions(&options, opts...); err != nil {
+		return err
 	}
 
 	// Read the most recently verified state from the sink store. The
 	// verification ensures the sink replica has not been corrupted, but this
 	// check trusts the seal stored locally with the head massif
 	sinkHeadCheckpointIndex, err := v.Sink.HeadIndex(ctx, storage.ObjectCheckpoint)
-	if err != nil && !isNilOrNotFound(err) {
+	if err != nil && !storage.IsNotFound(err) {
 		return err
 	}
 
 	var sink *VerifiedContext
 	if err == nil {
 		sink, err = GetContextVerified(ctx, v.Sink, v.COSEVerifier, sinkHeadCheckpointIndex)
-		if !isNilOrNotFound(err) {
+		if err != nil && !storage.IsNotFound(err) {
 			return err
 		}
 	}
@@ -145,23 +180,19 @@ func (v *VerifyingReplicator) ReplicateVerifiedUpdates(
 		}
 	}
 
-	for i := startMassif; i <= endMassif; i++ {
-
-		// Note: we have to fetch the seal before the massif, otherwise we can lose a race with the builder
-		// See bug#10530
-		checkpt, err := GetCheckpoint(ctx, v.Source, i)
-		if err != nil {
-			return err
-		}
+	if options.Concurrency > 1 && endMassif > startMassif {
+		return v.replicateConcurrently(ctx, sink, startMassif, endMassif, options.Concurrency)
+	}
 
-		sourceOpts := []Option{WithVerifyCheckpoint(&checkpt)}
+	for i := startMassif; i <= endMassif; i++ {
+		var trusted *MMRState
 		if sink != nil {
 			// The sink's sealed accumulator was verified when the sink context
 			// was read; require the source to be consistent with it.
-			sourceOpts = append(sourceOpts, WithVerifyTrustedState(MMRState{
+			trusted = &MMRState{
 				MMRSize: sink.Checkpoint.MMRSize,
 				Peaks:   sink.Accumulator,
-			}))
+			}
 		}
 
 		// On the first iteration sink is *either* the predecessor to
@@ -169,25 +200,12 @@ func (v *VerifyingReplicator) ReplicateVerifiedUpdates(
 		// After the first iteration, sink is always the predecessor. (If the
 		// source is still incomplete it means there is no subsequent massif to
 		// read)
-		source, err := GetContextVerified(
-			ctx, v.Source, v.COSEVerifier, i, sourceOpts...)
+		source, err := v.getVerifiedSource(ctx, i, trusted)
 		if err != nil {
-			// both the source massif and its seal must be present for the
-			// verification to succeed, so we don't filter using isBlobNotFound
-			// here.
-			return err
-		}
-
-		// read the sink massif, if it exists, reading at the end of the loop
-		sink, err = GetContextVerified(ctx, v.Sink, v.COSEVerifier, i)
-		if !isNilOrNotFound(err) {
 			return err
 		}
 
-		// copy the source locally to the sink, safely replacing the corresponding sink if
-		// one exists. if the sink is replaced (or created) without error, the
-		// source verified context becomes the new sink.
-		sink, err = v.replicateVerifiedContext(ctx, sink, source)
+		sink, err = v.replicateSource(ctx, source)
 		if err != nil {
 			return err
 		}
@@ -196,6 +214,111 @@ func (v *VerifyingReplicator) ReplicateVerifiedUpdates(
 	return nil
 }
 
+// getVerifiedSource reads the source massif and verifies it against its
+// checkpoint, and against the trusted state if that is not nil.
+func (v *VerifyingReplicator) getVerifiedSource(
+	ctx context.Context, massifIndex uint32, trusted *MMRState,
+) (*VerifiedContext, error) {
+	// Note: we have to fetch the seal before the massif, otherwise we can lose a race with the builder
+	// See bug#10530
+	checkpt, err := GetCheckpoint(ctx, v.Source, massifIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceOpts := []Option{WithVerifyCheckpoint(&checkpt)}
+	if trusted != nil {
+		sourceOpts = append(sourceOpts, WithVerifyTrustedState(*trusted))
+	}
+
+	// both the source massif and its seal must be present for the
+	// verification to succeed, so we don't filter using isBlobNotFound
+	// here.
+	return GetContextVerified(ctx, v.Source, v.COSEVerifier, massifIndex, sourceOpts...)
+}
+
+// replicateSource replicates the verified source massif to the sink and
+// returns the verified context which is then the sink replica.
+func (v *VerifyingReplicator) replicateSource(ctx context.Context, source *VerifiedContext) (*VerifiedContext, error) {
+	// read the sink massif, if it exists
+	sink, err := GetContextVerified(ctx, v.Sink, v.COSEVerifier, source.Start.MassifIndex)
+	if err != nil && !storage.IsNotFound(err) {
+		return nil, err
+	}
+
+	// copy the source locally to the sink, safely replacing the corresponding sink if
+	// one exists. if the sink is replaced (or created) without error, the
+	// source verified context becomes the new sink.
+	return v.replicateVerifiedContext(ctx, sink, source)
+}
+
+// replicatedFetch is a source massif, verified against its own checkpoint,
+// waiting its turn to be replicated
+type replicatedFetch struct {
+	source *VerifiedContext
+	err    error
+}
+
+// replicateConcurrently is the loop of ReplicateVerifiedUpdates with up to
+// concurrency source massifs read and verified, against their checkpoints, at
+// once. The consistency of each with the sink replica of its predecessor, and
+// the writes to the sink, are made in massif order as they are without
+// concurrency. Fetching stops short of concurrency massifs ahead of the one
+// being replicated.
+func (v *VerifyingReplicator) replicateConcurrently(
+	ctx context.Context, sink *VerifiedContext, startMassif, endMassif uint32, concurrency int,
+) error {
+	// the fetches are waited for after they are cancelled
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// the buffered fetches, and the one being replicated, are the ones in
+	// flight
+	pending := make(chan chan replicatedFetch, concurrency-1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(pending)
+		for i := uint64(startMassif); i <= uint64(endMassif); i++ {
+			result := make(chan replicatedFetch, 1)
+			select {
+			case pending <- result:
+			case <-ctx.Done():
+				return
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				source, err := v.getVerifiedSource(ctx, uint32(i), nil)
+				result <- replicatedFetch{source: source, err: err}
+			}()
+		}
+	}()
+
+	for result := range pending {
+		fetch := <-result
+		if fetch.err != nil {
+			return fetch.err
+		}
+		if sink != nil {
+			err := checkTrustedBaseState(&fetch.source.MassifContext, MMRState{
+				MMRSize: sink.Checkpoint.MMRSize,
+				Peaks:   sink.Accumulator,
+			})
+			if err != nil {
+				return fmt.Errorf("massif %d: %w", fetch.source.Start.MassifIndex, err)
+			}
+		}
+		var err error
+		if sink, err = v.replicateSource(ctx, fetch.source); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
 // replicateVerifiedContext is used to replicate a source massif which may be an
 // extension of a previously verified sink copy.
 //
@@ -206,7 +329,8 @@ func (v *VerifyingReplicator) ReplicateVerifiedUpdates(
 // sink before replacing the previously verified sink.
 //
 // This method has no side effects in the case where the source and the sink are
-// verified to be identical, the original sink instance is retained.
+// verified to be identical, and sealed to the same size, the original sink
+// instance is retained.
 func (v *VerifyingReplicator) replicateVerifiedContext(
 	ctx context.Context,
 	sink *VerifiedContext, source *VerifiedContext,
@@ -239,6 +363,16 @@ func (v *VerifyingReplicator) replicateVerifiedContext(
 		if !verifiedStateEqual(sink, source) {
 			return nil, fmt.Errorf("%w: massif=%d", ErrSourceLogInconsistentRootState, massifIndex)
 		}
+		// The source may have sealed the same data again since the sink was
+		// replicated, or a previous replication may have stored the data but
+		// failed to store its checkpoint. The successor massif is verified
+		// against the sink seal, so it must not be left behind.
+		if source.Checkpoint.MMRSize > sink.Checkpoint.MMRSize {
+			if err := ReplaceVerifiedContext(ctx, v.Sink, source); err != nil {
+				return nil, err
+			}
+			return source, nil
+		}
 		return sink, nil
 	}
 
@@ -1,6 +1,7 @@
 package massifs
 
 import (
+	"bytes"
 	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
@@ -19,6 +20,10 @@ import (
 // memStore extends memReader with writes, for replicator sinks.
 type memStore struct {
 	memReader
+	spines           map[uint32][]byte
+	timestampIndexes map[uint32][]byte
+	legacySeals      map[uint32][]byte
+	bridges          map[uint32][]byte
 }
 
 func (m *memStore) Put(ctx context.Context, massifIndex uint32, ty storage.ObjectType, data []byte, failIfExists bool) error {
@@ -29,6 +34,14 @@ func (m *memStore) Put(ctx context.Context, massifIndex uint32, ty storage.Objec
 		m.massifs[massifIndex] = append([]byte(nil), data...)
 	case storage.ObjectCheckpoint:
 		m.checkpoint[massifIndex] = append([]byte(nil), data...)
+	case storage.ObjectMassifSpine:
+		m.spines[massifIndex] = append([]byte(nil), data...)
+	case storage.ObjectTimestampIndex:
+		m.timestampIndexes[massifIndex] = append([]byte(nil), data...)
+	case storage.ObjectLegacyCheckpoint:
+		m.legacySeals[massifIndex] = append([]byte(nil), data...)
+	case storage.ObjectMassifBridge:
+		m.bridges[massifIndex] = append([]byte(nil), data...)
 	default:
 		return fmt.Errorf("unsupported object type: %v", ty)
 	}
@@ -36,10 +49,16 @@ func (m *memStore) Put(ctx context.Context, massifIndex uint32, ty storage.Objec
 }
 
 func newMemStore(massifData, checkpointData []byte) *memStore {
-	s := &memStore{memReader{
-		massifs:    map[uint32][]byte{},
-		checkpoint: map[uint32][]byte{},
-	}}
+	s := &memStore{
+		memReader: memReader{
+			massifs:    map[uint32][]byte{},
+			checkpoint: map[uint32][]byte{},
+		},
+		spines:           map[uint32][]byte{},
+		timestampIndexes: map[uint32][]byte{},
+		legacySeals:      map[uint32][]byte{},
+		bridges:          map[uint32][]byte{},
+	}
 	if massifData != nil {
 		s.massifs[0] = massifData
 	}
@@ -51,13 +70,15 @@ func newMemStore(massifData, checkpointData []byte) *memStore {
 
 // signCheckpointV3WithSigner seals mc's current range with the provided
 // signer, chaining from fromSize (0 for a first seal).
-func signCheckpointV3WithSigner(t *testing.T, mc *MassifContext, signer cose.Signer, fromSize uint64) []byte {
+func signCheckpointV3WithSigner(
+	t *testing.T, mc *MassifContext, signer cose.Signer, fromSize uint64, opts ...CheckpointSignOption,
+) []byte {
 	t.Helper()
 	proof, err := BuildConsistencyProof(mc, fromSize, mc.RangeCount())
 	require.NoError(t, err)
 	accumulator, err := mmr.PeakHashes(mc, mc.RangeCount()-1)
 	require.NoError(t, err)
-	signed, err := SignCheckpointReceipt(signer, proof, accumulator)
+	signed, err := SignCheckpointReceipt(signer, proof, accumulator, opts...)
 	require.NoError(t, err)
 	return signed
 }
@@ -85,6 +106,30 @@ func TestReplicateVerifiedUpdatesBootstrapsEmptySink(t *testing.T) {
 		"the checkpoint object must be replicated verbatim")
 }
 
+// unavailableSink fails the sink head read as a throttled store does
+type unavailableSink struct {
+	*memStore
+}
+
+func (s unavailableSink) HeadIndex(ctx context.Context, otype storage.ObjectType) (uint32, error) {
+	return 0, fmt.Errorf("%w: 503 Service Unavailable", storage.ErrNotAvailable)
+}
+
+func TestReplicateVerifiedUpdatesStopsOnUnavailableSink(t *testing.T) {
+	mc, signer, verifier := newReplicatorFixture(t, 2)
+	signed := signCheckpointV3WithSigner(t, mc, signer, 0)
+
+	source := newMemStore(mc.Data, signed)
+	sink := newMemStore(nil, nil)
+
+	// A sink which can not be read is not an empty sink, replicating over
+	// it would skip the consistency check against the replica.
+	v := &VerifyingReplicator{COSEVerifier: verifier, Source: source, Sink: unavailableSink{sink}}
+	err := v.ReplicateVerifiedUpdates(context.Background(), 0, 0)
+	require.ErrorIs(t, err, storage.ErrNotAvailable)
+	require.Empty(t, sink.massifs)
+}
+
 func TestReplicateVerifiedUpdatesExtendsSinkReplica(t *testing.T) {
 	mc, signer, verifier := newReplicatorFixture(t, 2)
 	sealedSize := mc.RangeCount()
@@ -147,3 +192,31 @@ func TestReplicateVerifiedUpdatesRejectsTruncatedSource(t *testing.T) {
 	require.Error(t, err)
 	require.Equal(t, mc.Data, sink.massifs[0], "the sink replica must be untouched")
 }
+
+func TestReplicateVerifiedUpdatesConcurrently(t *testing.T) {
+	ctx := context.Background()
+	source, verifier := buildSealedLog(t, 3, 30)
+	head, err := source.HeadIndex(ctx, storage.ObjectMassifData)
+	require.NoError(t, err)
+	require.Equal(t, uint32(7), head)
+
+	// a replica of the first massifs is extended to the head
+	sink := newMemStore(nil, nil)
+	v := &VerifyingReplicator{COSEVerifier: verifier, Source: source, Sink: sink}
+	require.NoError(t, v.ReplicateVerifiedUpdates(ctx, 0, 1))
+	require.NoError(t, v.ReplicateVerifiedUpdates(ctx, 0, head, WithConcurrency(3)))
+	require.Equal(t, source.massifs, sink.massifs)
+	require.Equal(t, source.checkpoint, sink.checkpoint)
+
+	// a massif which fails verification stops the replication, the massifs
+	// before it are replicated
+	source.massifs[4] = bytes.Clone(source.massifs[4])
+	source.massifs[4][len(source.massifs[4])-1] ^= 0xff
+	sink = newMemStore(nil, nil)
+	v.Sink = sink
+	require.Error(t, v.ReplicateVerifiedUpdates(ctx, 0, head, WithConcurrency(3)))
+	require.Len(t, sink.massifs, 4)
+
+	err = v.ReplicateVerifiedUpdates(ctx, 0, head, WithConcurrency(-1))
+	require.ErrorIs(t, err, ErrInvalidOptions)
+}
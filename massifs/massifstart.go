@@ -19,6 +19,7 @@ import (
 	"encoding/binary"
 	"errors"
 
+	"github.com/forestrie/go-merklelog/massifs/logformat"
 	"github.com/forestrie/go-merklelog/mmr"
 )
 
@@ -46,9 +47,9 @@ const (
 
 	// MassifStart layout
 	//
-	// .         | reserved | idtimestamp| reserved |  version | epoch  |massif height| massif i |
-	// .         | 0        | 8        15|          |  21 - 22 | 23   26|27         27| 28 -  31 |
-	// bytes     | 1        |     8      |     5    |      2   |    4   |      1      |     4    |
+	// .         | reserved | idtimestamp| bloom k | bloom bpe |  version | epoch  |massif height| massif i |
+	// .         | 0        | 8        15|    16   |  17 - 20  |  21 - 22 | 23   26|27         27| 28 -  31 |
+	// bytes     | 1        |     8      |    1    |     4     |      2   |    4   |      1      |     4    |
 	//
 	// Note this layout produces a sequentially valued key. The value is always
 	// considered as a big endian large integer. Lexical ordering is defined
@@ -60,13 +61,18 @@ const (
 	MassifStartKeyLastIDFirstByte = 8
 	MassifStartKeyLastIDSize      = 8 // 64 bits
 	MassifStartKeyLastIDEnd       = MassifStartKeyLastIDFirstByte + MassifStartKeyLastIDSize
-	// gap 16 - 21
-	MassifStartKeyVersionFirstByte = 21
-	MassifStartKeyVersionSize      = 2 // 16 bit
-	MassifStartKeyVersionEnd       = MassifStartKeyVersionFirstByte + MassifStartKeyVersionSize
-	MassifStartKeyEpochFirstByte   = MassifStartKeyVersionEnd
-	MassifStartKeyEpochSize        = 4 // 32 bit
-	MassifStartKeyEpochEnd         = MassifStartKeyEpochFirstByte + MassifStartKeyEpochSize
+	// The bloom parameters are zero for the V1 bloom sizing, see
+	// MassifStart.BloomParams
+	MassifStartKeyBloomKByte        = MassifStartKeyLastIDEnd
+	MassifStartKeyBloomBPEFirstByte = MassifStartKeyBloomKByte + 1
+	MassifStartKeyBloomBPESize      = 4 // 32 bit
+	MassifStartKeyBloomBPEEnd       = MassifStartKeyBloomBPEFirstByte + MassifStartKeyBloomBPESize
+	MassifStartKeyVersionFirstByte  = 21
+	MassifStartKeyVersionSize       = 2 // 16 bit
+	MassifStartKeyVersionEnd        = MassifStartKeyVersionFirstByte + MassifStartKeyVersionSize
+	MassifStartKeyEpochFirstByte    = MassifStartKeyVersionEnd
+	MassifStartKeyEpochSize         = 4 // 32 bit
+	MassifStartKeyEpochEnd          = MassifStartKeyEpochFirstByte + MassifStartKeyEpochSize
 	// Note the massif height is purposefully ahead of the index, it can't be
 	// changed without also incrementing the EPOCH, so we never care about it's
 	// effect on the  sort order with respect to the first index
@@ -80,7 +86,7 @@ const (
 	MassifStartKeyFirstIndexFirstByte = MassifStartKeyMassifEnd
 
 	Epoch2038            = uint32(1)
-	MassifCurrentVersion = uint16(2)
+	MassifCurrentVersion = logformat.CurrentVersion
 	// Version 0 was/is produced by the datatrails implementation, currently operated by OnID
 	// Version 1 introduced:
 	// - a fixed 64 entries are always reserved for the peak stack, regardless of how many are
@@ -114,6 +120,10 @@ type MassifStart struct {
 	FirstIndex      uint64
 	LastID          uint64
 	PeakStackLen    uint64
+	// BloomK and BloomBitsPerElement are the parameters of the V2 bloom region
+	// of the index, both zero for the V1 bloom region, see BloomParams.
+	BloomK              uint8
+	BloomBitsPerElement uint32
 }
 
 func NewMassifStart(lastID uint64, commitmentEpoch uint32, massifHeight uint8, massifIndex uint32, firstIndex uint64) MassifStart {
@@ -154,7 +164,10 @@ func MassifFirstLeaf(massifHeight uint8, massifIndex uint32) uint64 {
 }
 
 func (ms MassifStart) MarshalBinary() ([]byte, error) {
-	return EncodeMassifStart(ms.LastID, ms.Version, ms.CommitmentEpoch, ms.MassifHeight, ms.MassifIndex), nil
+	start := EncodeMassifStart(ms.LastID, ms.Version, ms.CommitmentEpoch, ms.MassifHeight, ms.MassifIndex)
+	start[MassifStartKeyBloomKByte] = ms.BloomK
+	binary.BigEndian.PutUint32(start[MassifStartKeyBloomBPEFirstByte:MassifStartKeyBloomBPEEnd], ms.BloomBitsPerElement)
+	return start, nil
 }
 
 func (ms *MassifStart) UnmarshalBinary(b []byte) error {
@@ -164,9 +177,12 @@ func (ms *MassifStart) UnmarshalBinary(b []byte) error {
 // EncodeMassifStart encodes the massif details in the prescribed massif header
 // record format
 //
-// .         | <reserved>|lastid |<reserved>|   version| epoch  |massif height| massif i |
-// .         |           | 8-16  |          |  21 - 22 | 23   26|27         27| 28 -  31 |
-// bytes     |           |       |          |      2   |    4   |      1      |     4    |
+// .         | <reserved>|lastid |<bloom>|   version| epoch  |massif height| massif i |
+// .         |           | 8-16  | 16-20 |  21 - 22 | 23   26|27         27| 28 -  31 |
+// bytes     |           |       |       |      2   |    4   |      1      |     4    |
+//
+// The bloom parameters are left zero, for the V1 bloom sizing, see
+// MassifStart.MarshalBinary.
 func EncodeMassifStart(lastID uint64, version uint16, epoch uint32, massifHeight uint8, massifIndex uint32) []byte {
 
 	start := make([]byte, StartHeaderSize)
@@ -189,6 +205,8 @@ func MakeMassifStart(data []byte) MassifStart {
 	ms := MassifStart{}
 	ms.Reserved = binary.BigEndian.Uint64(data[0:MassifStartKeyLastIDFirstByte])
 	ms.LastID = binary.BigEndian.Uint64(data[MassifStartKeyLastIDFirstByte:MassifStartKeyLastIDEnd])
+	ms.BloomK = data[MassifStartKeyBloomKByte]
+	ms.BloomBitsPerElement = binary.BigEndian.Uint32(data[MassifStartKeyBloomBPEFirstByte:MassifStartKeyBloomBPEEnd])
 	ms.Version = binary.BigEndian.Uint16(data[MassifStartKeyVersionFirstByte:MassifStartKeyVersionEnd])
 	ms.CommitmentEpoch = binary.BigEndian.Uint32(data[MassifStartKeyEpochFirstByte:MassifStartKeyEpochEnd])
 	ms.MassifHeight = data[MassifStartKeyMassifHeightFirstByte]
@@ -212,6 +230,8 @@ func DecodeMassifStart(ms *MassifStart, start []byte) error {
 
 	ms.Reserved = binary.BigEndian.Uint64(start[0:MassifStartKeyLastIDFirstByte])
 	ms.LastID = binary.BigEndian.Uint64(start[MassifStartKeyLastIDFirstByte:MassifStartKeyLastIDEnd])
+	ms.BloomK = start[MassifStartKeyBloomKByte]
+	ms.BloomBitsPerElement = binary.BigEndian.Uint32(start[MassifStartKeyBloomBPEFirstByte:MassifStartKeyBloomBPEEnd])
 	ms.Version = binary.BigEndian.Uint16(start[MassifStartKeyVersionFirstByte:MassifStartKeyVersionEnd])
 	ms.CommitmentEpoch = binary.BigEndian.Uint32(start[MassifStartKeyEpochFirstByte:MassifStartKeyEpochEnd])
 	ms.MassifHeight = start[MassifStartKeyMassifHeightFirstByte]
@@ -0,0 +1,139 @@
+package massifs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs/logformat"
+	"github.com/forestrie/go-merklelog/massifs/snowflakeid"
+	"github.com/forestrie/go-merklelog/urkle"
+)
+
+// The statistics block occupies start header reserved word 2. The 32 byte
+// index header can not be used: in v2 it is the bloom header, which is
+// re-encoded on every insert.
+//
+//	| version | builder version | leaf count | min idtimestamp | max idtimestamp | build duration ms |
+//	| 0       | 1 - 3           | 4 - 7      | 8 - 15          | 16 - 23         | 24 - 31           |
+//	| 1       | 3               | 4          | 8               | 8               | 8                 |
+const (
+	massifStatsWord = logformat.StatsWord
+
+	MassifStatsVersion = uint8(1)
+
+	massifStatsVersionByte          = 0
+	massifStatsBuilderVersionStart  = 1
+	massifStatsLeafCountStart       = 4
+	massifStatsMinIDTimestampStart  = 8
+	massifStatsMaxIDTimestampStart  = 16
+	massifStatsBuildDurationMSStart = 24
+)
+
+// BuilderVersion identifies the release of the software which committed a
+// massif.
+type BuilderVersion struct {
+	Major, Minor, Patch uint8
+}
+
+func (v BuilderVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// MassifStats is the per massif statistics block, maintained by
+// CommitContext. It makes operational queries answerable from the start
+// header alone. The block is not covered by the log's signatures, it is
+// informational only.
+type MassifStats struct {
+	BuilderVersion BuilderVersion
+	// LeafCount is the count of leaves at the last commit. Once the massif is
+	// complete this is also the count when it was sealed.
+	LeafCount      uint32
+	MinIDTimestamp uint64
+	MaxIDTimestamp uint64
+	// BuildDuration is the time from the first leaf's idtimestamp to the last
+	// commit, as measured by the committer.
+	BuildDuration time.Duration
+}
+
+// Stats returns the statistics block. ok is false if the block has never been
+// written, which is the case for massifs committed before it was introduced.
+func (mc MassifContext) Stats() (stats MassifStats, ok bool, err error) {
+	start, end, err := startHeaderWordRange(massifStatsWord)
+	if err != nil {
+		return MassifStats{}, false, err
+	}
+	if end > uint64(len(mc.Data)) {
+		return MassifStats{}, false, fmt.Errorf("start header out of range: end=%d len=%d", end, len(mc.Data))
+	}
+	raw := mc.Data[start:end]
+	if isAllZero(raw) {
+		return MassifStats{}, false, nil
+	}
+	if raw[massifStatsVersionByte] != MassifStatsVersion {
+		return MassifStats{}, false, fmt.Errorf("unsupported massif stats version %d", raw[massifStatsVersionByte])
+	}
+	stats.BuilderVersion = BuilderVersion{
+		Major: raw[massifStatsBuilderVersionStart],
+		Minor: raw[massifStatsBuilderVersionStart+1],
+		Patch: raw[massifStatsBuilderVersionStart+2],
+	}
+	stats.LeafCount = binary.BigEndian.Uint32(raw[massifStatsLeafCountStart:massifStatsMinIDTimestampStart])
+	stats.MinIDTimestamp = binary.BigEndian.Uint64(raw[massifStatsMinIDTimestampStart:massifStatsMaxIDTimestampStart])
+	stats.MaxIDTimestamp = binary.BigEndian.Uint64(raw[massifStatsMaxIDTimestampStart:massifStatsBuildDurationMSStart])
+	stats.BuildDuration = time.Duration(binary.BigEndian.Uint64(raw[massifStatsBuildDurationMSStart:])) * time.Millisecond
+	return stats, true, nil
+}
+
+// SetStats writes the statistics block through to the massif data.
+func (mc *MassifContext) SetStats(stats MassifStats) error {
+	if err := mc.checkWritable("statistics block"); err != nil {
+		return err
+	}
+	start, end, err := startHeaderWordRange(massifStatsWord)
+	if err != nil {
+		return err
+	}
+	if end > uint64(len(mc.Data)) {
+		return fmt.Errorf("start header out of range: end=%d len=%d", end, len(mc.Data))
+	}
+	raw := mc.Data[start:end]
+	raw[massifStatsVersionByte] = MassifStatsVersion
+	raw[massifStatsBuilderVersionStart] = stats.BuilderVersion.Major
+	raw[massifStatsBuilderVersionStart+1] = stats.BuilderVersion.Minor
+	raw[massifStatsBuilderVersionStart+2] = stats.BuilderVersion.Patch
+	binary.BigEndian.PutUint32(raw[massifStatsLeafCountStart:massifStatsMinIDTimestampStart], stats.LeafCount)
+	binary.BigEndian.PutUint64(raw[massifStatsMinIDTimestampStart:massifStatsMaxIDTimestampStart], stats.MinIDTimestamp)
+	binary.BigEndian.PutUint64(raw[massifStatsMaxIDTimestampStart:massifStatsBuildDurationMSStart], stats.MaxIDTimestamp)
+	binary.BigEndian.PutUint64(raw[massifStatsBuildDurationMSStart:], uint64(stats.BuildDuration.Milliseconds()))
+	return nil
+}
+
+// updateStats refreshes the statistics block from the massif content, it is
+// called by CommitContext. The minimum idtimestamp is the key of the first
+// urkle leaf, the idtimestamps are strictly increasing.
+func (mc *MassifContext) updateStats(builder BuilderVersion, now time.Time) error {
+	leafCount := mc.MassifLeafCount()
+	stats := MassifStats{
+		BuilderVersion: builder,
+		LeafCount:      uint32(leafCount),
+		MaxIDTimestamp: mc.GetLastIDTimestamp(),
+	}
+	if leafCount > 0 && mc.requireV2Index() == nil {
+		leafTable, err := mc.UrkleLeafTableRegion()
+		if err != nil {
+			return err
+		}
+		stats.MinIDTimestamp = urkle.LeafKey(leafTable, 0)
+	}
+	if stats.MinIDTimestamp != 0 {
+		firstMS, err := snowflakeid.IDUnixMilli(stats.MinIDTimestamp, uint8(mc.Start.CommitmentEpoch))
+		if err != nil {
+			return err
+		}
+		if d := now.Sub(time.UnixMilli(firstMS)); d > 0 {
+			stats.BuildDuration = d
+		}
+	}
+	return mc.SetStats(stats)
+}
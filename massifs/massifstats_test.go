@@ -0,0 +1,83 @@
+package massifs
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs/snowflakeid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMassifStatsRoundTrip(t *testing.T) {
+	mc := MassifContext{MassifData: MassifData{Data: make([]byte, StartHeaderEnd)}}
+
+	_, ok, err := mc.Stats()
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	want := MassifStats{
+		BuilderVersion: BuilderVersion{Major: 1, Minor: 2, Patch: 3},
+		LeafCount:      4,
+		MinIDTimestamp: 5,
+		MaxIDTimestamp: 6,
+		BuildDuration:  7 * time.Second,
+	}
+	require.NoError(t, mc.SetStats(want))
+	got, ok, err := mc.Stats()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, want, got)
+	require.Equal(t, "1.2.3", got.BuilderVersion.String())
+}
+
+func TestCommitContextMaintainsStats(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore(nil, nil)
+
+	const massifHeight = 2
+	wall := time.UnixMilli(snowflakeid.EpochMS(1) + 1_000_000)
+	clock := snowflakeid.NewManualClock(wall)
+	version := BuilderVersion{Major: 0, Minor: 9, Patch: 1}
+
+	var ids []uint64
+	for i := range 3 {
+		mc, err := GetAppendContext(ctx, store, 1, massifHeight)
+		require.NoError(t, err)
+
+		id := uint64(1_000_000+i*1000)<<snowflakeid.TimeShift | uint64(i)
+		ids = append(ids, id)
+		leaf := sha256.Sum256(fmt.Appendf(nil, "stats-leaf-%d", i))
+		_, err = mc.AddHashedLeaf(sha256.New(), id, nil, nil, nil, leaf[:])
+		require.NoError(t, err)
+
+		clock.SetWall(wall.Add(time.Duration(i+1) * 5 * time.Second))
+		require.NoError(t, CommitContext(ctx, store, &mc, WithBuilderVersion(version), WithCommitClock(clock)))
+	}
+
+	// massif 0 holds leaves 0 and 1, massif 1 holds leaf 2
+	mc0, err := GetMassifContext(ctx, store, 0)
+	require.NoError(t, err)
+	stats, ok, err := mc0.Stats()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, MassifStats{
+		BuilderVersion: version,
+		LeafCount:      2,
+		MinIDTimestamp: ids[0],
+		MaxIDTimestamp: ids[1],
+		BuildDuration:  10 * time.Second,
+	}, stats)
+
+	mc1, err := GetMassifContext(ctx, store, 1)
+	require.NoError(t, err)
+	stats, ok, err = mc1.Stats()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint32(1), stats.LeafCount)
+	require.Equal(t, ids[2], stats.MinIDTimestamp)
+	require.Equal(t, ids[2], stats.MaxIDTimestamp)
+	require.Equal(t, 13*time.Second, stats.BuildDuration)
+}
@@ -0,0 +1,215 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/forestrie/go-merklelog/urkle"
+)
+
+// MassifWindowPageBytes is the size of the pages a MassifWindow reads. Every
+// read is of whole pages, so neighbouring nodes of a proof are usually read
+// together.
+const MassifWindowPageBytes = 4096
+
+// MassifWindowReader is implemented by readers which can read parts of a
+// massif without reading all of it, see GetMassifWindow.
+type MassifWindowReader interface {
+	// MassifWindow returns a window on the massif as it is stored now. The
+	// window must be closed when it is no longer needed.
+	MassifWindow(ctx context.Context, massifIndex uint32) (*MassifWindow, error)
+}
+
+// MassifWindow is a read only view of a massif which reads, and caches, only
+// the pages of the massif data that are asked for. A single proof needs the
+// start header, a few log nodes and perhaps the peak stack and one leaf table
+// record, which for a tall massif is a small fraction of its data.
+//
+// The window reads the data as it was when the window was created, data
+// appended since is not seen. It is not safe for concurrent use.
+type MassifWindow struct {
+	Start MassifStart
+
+	r      io.ReaderAt
+	closer io.Closer
+	size   uint64
+	pages  map[uint64][]byte
+	// peakStackMap locates the peaks carried over from earlier massifs
+	peakStackMap map[uint64]int
+	// PageReads counts the pages read from the underlying reader
+	PageReads int
+}
+
+// NewMassifWindow creates a window over the size bytes of massif data read
+// by r. If r is an io.Closer, Close closes it.
+func NewMassifWindow(r io.ReaderAt, size uint64) (*MassifWindow, error) {
+	w := &MassifWindow{r: r, size: size, pages: map[uint64][]byte{}}
+	if closer, ok := r.(io.Closer); ok {
+		w.closer = closer
+	}
+	if size < StartHeaderEnd {
+		return nil, errors.Join(fmt.Errorf("%w: start header incomplete", ErrMassifDataLengthInvalid), w.Close())
+	}
+	header, err := w.ReadRange(0, StartHeaderEnd)
+	if err != nil {
+		return nil, errors.Join(err, w.Close())
+	}
+	w.Start = MakeMassifStart(header)
+	w.peakStackMap = PeakStackMap(w.Start.MassifHeight, w.Start.FirstIndex)
+	if w.peakStackMap == nil {
+		return nil, errors.Join(fmt.Errorf("invalid massif height or first index in start record"), w.Close())
+	}
+	return w, nil
+}
+
+// GetMassifWindow returns a window on the massif. Readers which implement
+// MassifWindowReader read only the pages used, for other readers the whole
+// massif is read and the window is over that.
+func GetMassifWindow(ctx context.Context, reader ObjectReader, massifIndex uint32) (*MassifWindow, error) {
+	if windowReader, ok := reader.(MassifWindowReader); ok {
+		return windowReader.MassifWindow(ctx, massifIndex)
+	}
+	data, err := GetMassifData(ctx, reader, massifIndex)
+	if err != nil {
+		return nil, err
+	}
+	return NewMassifWindow(bytes.NewReader(data), uint64(len(data)))
+}
+
+// Size returns the size of the massif data
+func (w *MassifWindow) Size() uint64 {
+	return w.size
+}
+
+// RangeCount returns the mmr size at the end of the massif data
+func (w *MassifWindow) RangeCount() uint64 {
+	logStart := w.context().LogStart()
+	if logStart > w.size {
+		return w.Start.FirstIndex
+	}
+	return w.Start.FirstIndex + (w.size-logStart)/ValueBytes
+}
+
+// ReadRange returns the n bytes of massif data at off, reading the pages
+// which cover them that have not been read already. A range within one page
+// aliases the window's cache, it must not be modified.
+func (w *MassifWindow) ReadRange(off uint64, n uint64) ([]byte, error) {
+	if off > w.size || n > w.size-off {
+		return nil, fmt.Errorf("%w: %d bytes at %d, the massif has %d",
+			ErrMassifDataLengthInvalid, n, off, w.size)
+	}
+	p := off / MassifWindowPageBytes
+	page, err := w.page(p)
+	if err != nil {
+		return nil, err
+	}
+	start := off - p*MassifWindowPageBytes
+	if start+n <= uint64(len(page)) {
+		return page[start : start+n], nil
+	}
+	data := append(make([]byte, 0, n), page[start:]...)
+	for p++; uint64(len(data)) < n; p++ {
+		if page, err = w.page(p); err != nil {
+			return nil, err
+		}
+		data = append(data, page[:min(uint64(len(page)), n-uint64(len(data)))]...)
+	}
+	return data, nil
+}
+
+// page returns the page, which is short if it is the last
+func (w *MassifWindow) page(p uint64) ([]byte, error) {
+	if page, ok := w.pages[p]; ok {
+		return page, nil
+	}
+	off := p * MassifWindowPageBytes
+	page := make([]byte, min(MassifWindowPageBytes, w.size-off))
+	// io.ReaderAt may return io.EOF with a full read of the last page
+	if n, err := w.r.ReadAt(page, int64(off)); n < len(page) {
+		return nil, fmt.Errorf("read massif %d at %d: %w", w.Start.MassifIndex, off, err)
+	}
+	w.PageReads++
+	w.pages[p] = page
+	return page, nil
+}
+
+// Get returns the value of the node at mmr index i. The nodes of earlier
+// massifs which are peaks in this one are read from its peak stack, others
+// return ErrGetIndexUnavailable. Get satisfies the store interface of the mmr
+// proof functions, so proofs of the nodes in the massif read only what they
+// use.
+func (w *MassifWindow) Get(i uint64) ([]byte, error) {
+	mc := w.context()
+	if i >= w.Start.FirstIndex {
+		if i >= w.RangeCount() {
+			return nil, fmt.Errorf("%w: %d", ErrIndexNotInMassif, i)
+		}
+		return w.ReadRange(mc.LogStart()+(i-w.Start.FirstIndex)*ValueBytes, ValueBytes)
+	}
+	if w.Start.FirstIndex == 0 {
+		return nil, fmt.Errorf("%w: the first massif has no ancestors", ErrGetIndexUnavailable)
+	}
+	peakStackIndex, ok := w.peakStackMap[i]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d is not in the peak map", ErrAncestorStackInvalid, i)
+	}
+	off := mc.PeakStackStart() + uint64(peakStackIndex)*ValueBytes
+	if off+ValueBytes > mc.LogStart() {
+		return nil, fmt.Errorf("%w: exceeded the data range of the ancestor peak stack", ErrAncestorStackInvalid)
+	}
+	return w.ReadRange(off, ValueBytes)
+}
+
+// Leaf returns the leaf at leafIndex in the whole log with its trie entry,
+// reading only its log node and its record in the leaf table. Only massifs
+// in the current format have the trie entries it needs.
+func (w *MassifWindow) Leaf(leafIndex uint64) (MassifLeaf, error) {
+	mc := w.context()
+	if err := mc.requireV2Index(); err != nil {
+		return MassifLeaf{}, err
+	}
+	f, err := w.Start.Format()
+	if err != nil {
+		return MassifLeaf{}, err
+	}
+	leafTable, _ := f.Region(RegionUrkleLeafTable)
+	firstLeaf := mmr.LeafCount(w.Start.FirstIndex)
+	if leafIndex < firstLeaf || mmr.MMRIndex(leafIndex) >= w.RangeCount() {
+		return MassifLeaf{}, fmt.Errorf("%w: leaf %d is not in massif %d",
+			ErrLeafRange, leafIndex, w.Start.MassifIndex)
+	}
+	ordinal := uint32(leafIndex - firstLeaf)
+	record, err := w.ReadRange(leafTable.Offset+urkle.LeafRecordOffset(ordinal), urkle.LeafRecordBytes)
+	if err != nil {
+		return MassifLeaf{}, err
+	}
+	leaf := MassifLeaf{
+		LeafIndex:   leafIndex,
+		MMRIndex:    mmr.MMRIndex(leafIndex),
+		IDTimestamp: urkle.LeafKey(record, 0),
+		TrieKey:     urkle.LeafValue(record, 0),
+		Extras:      urkle.LeafExtras(record, 0),
+	}
+	if leaf.Value, err = w.Get(leaf.MMRIndex); err != nil {
+		return MassifLeaf{}, err
+	}
+	return leaf, nil
+}
+
+// Close releases the underlying reader, if it needs releasing
+func (w *MassifWindow) Close() error {
+	if w.closer == nil {
+		return nil
+	}
+	return w.closer.Close()
+}
+
+// context returns a MassifContext with no data, for the offset arithmetic
+// which depends only on the start header
+func (w *MassifWindow) context() MassifContext {
+	return MassifContext{Start: w.Start}
+}
@@ -0,0 +1,133 @@
+package massifs
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/stretchr/testify/require"
+)
+
+// requireWindowMatches checks every node and leaf of the window against the
+// massif read in full
+func requireWindowMatches(t *testing.T, w *MassifWindow, mc *MassifContext) {
+	t.Helper()
+	require.Equal(t, mc.Start, w.Start)
+	require.Equal(t, uint64(len(mc.Data)), w.Size())
+	require.Equal(t, mc.RangeCount(), w.RangeCount())
+	require.NoError(t, mc.CreatePeakStackMap())
+	for i := range mc.PeakStackMap {
+		want, err := mc.Get(i)
+		require.NoError(t, err)
+		got, err := w.Get(i)
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+	}
+	for i := mc.Start.FirstIndex; i < mc.RangeCount(); i++ {
+		want, err := mc.Get(i)
+		require.NoError(t, err)
+		got, err := w.Get(i)
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+	}
+	_, err := w.Get(mc.RangeCount())
+	require.ErrorIs(t, err, ErrIndexNotInMassif)
+
+	leaves, err := mc.Leaves()
+	require.NoError(t, err)
+	for want := range leaves {
+		got, err := w.Leaf(want.LeafIndex)
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+	}
+	_, err = w.Leaf(mmr.LeafCount(mc.RangeCount()))
+	require.ErrorIs(t, err, ErrLeafRange)
+}
+
+func TestMassifWindow(t *testing.T) {
+	ctx := context.Background()
+	source, _ := buildSealedLog(t, 8, 300)
+	head, err := source.HeadIndex(ctx, storage.ObjectMassifData)
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), head)
+
+	dir := t.TempDir()
+	writer, err := NewDirWriter(dir)
+	require.NoError(t, err)
+	for i := range head + 1 {
+		data, err := source.MassifReadN(ctx, i, -1)
+		require.NoError(t, err)
+		require.NoError(t, writer.Put(ctx, i, storage.ObjectMassifData, data, true))
+	}
+	reader, err := NewDirReader(dir)
+	require.NoError(t, err)
+
+	for i := range head + 1 {
+		mc, err := GetMassifContext(ctx, source, i)
+		require.NoError(t, err)
+
+		w, err := GetMassifWindow(ctx, reader, i)
+		require.NoError(t, err)
+		requireWindowMatches(t, w, &mc)
+		require.NoError(t, w.Close())
+
+		// readers which can not read ranges have the whole massif windowed
+		w, err = GetMassifWindow(ctx, source, i)
+		require.NoError(t, err)
+		requireWindowMatches(t, w, &mc)
+	}
+
+	// a proof of a leaf in the head massif reads a few pages, not the massif
+	mc, err := GetMassifContext(ctx, source, head)
+	require.NoError(t, err)
+	require.NoError(t, mc.CreatePeakStackMap())
+	w, err := GetMassifWindow(ctx, reader, head)
+	require.NoError(t, err)
+	defer w.Close()
+	leafIndex := mmr.MMRIndex(mmr.LeafCount(mc.Start.FirstIndex) + 5)
+	want, err := mmr.InclusionProof(&mc, mc.RangeCount()-1, leafIndex)
+	require.NoError(t, err)
+	got, err := mmr.InclusionProof(w, w.RangeCount()-1, leafIndex)
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+	_, err = w.Leaf(mmr.LeafCount(leafIndex))
+	require.NoError(t, err)
+	pages := (w.Size() + MassifWindowPageBytes - 1) / MassifWindowPageBytes
+	require.Less(t, uint64(w.PageReads)*2, pages)
+
+	// a massif too short for its start header has no window
+	require.NoError(t, writer.Put(ctx, head+1, storage.ObjectMassifData, make([]byte, StartHeaderEnd-1), true))
+	reader, err = NewDirReader(dir)
+	require.NoError(t, err)
+	_, err = GetMassifWindow(ctx, reader, head+1)
+	require.ErrorIs(t, err, ErrMassifDataLengthInvalid)
+}
+
+func TestGCSStoreMassifWindow(t *testing.T) {
+	ctx := context.Background()
+	source, _ := buildSealedLog(t, 8, 150)
+
+	fake := &fakeGCS{objects: map[string]fakeGCSObject{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	store, err := NewGCSStore("bucket")
+	require.NoError(t, err)
+	store.Endpoint = server.URL
+	for i := range uint32(2) {
+		data, err := source.MassifReadN(ctx, i, -1)
+		require.NoError(t, err)
+		require.NoError(t, store.Put(ctx, i, storage.ObjectMassifData, data, true))
+		mc, err := GetMassifContext(ctx, source, i)
+		require.NoError(t, err)
+
+		w, err := GetMassifWindow(ctx, store, i)
+		require.NoError(t, err)
+		requireWindowMatches(t, w, &mc)
+		require.NoError(t, w.Close())
+	}
+
+	_, err = store.MassifWindow(ctx, 2)
+	require.True(t, storage.IsNotFound(err))
+}
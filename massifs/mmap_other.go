@@ -0,0 +1,15 @@
+//go:build !unix
+
+package massifs
+
+import (
+	"os"
+)
+
+func mapFile(f *os.File, size int) ([]byte, error) {
+	return nil, errMemoryMapUnsupported
+}
+
+func unmapFile(data []byte) error {
+	return errMemoryMapUnsupported
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package massifs
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile maps the file privately. The mapping is writable, but copy on
+// write, so changes made to the data are never written back to the file.
+func mapFile(f *os.File, size int) ([]byte, error) {
+	return syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE)
+}
+
+func unmapFile(data []byte) error {
+	return syscall.Munmap(data)
+}
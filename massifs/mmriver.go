@@ -156,7 +156,29 @@ func NewReceipt(
 		return nil, fmt.Errorf(
 			"%w: failed to get verified context %d", err, massifIndex)
 	}
-	check := verified.Checkpoint
+	return newVerifiedReceipt(verified, mmrIndex)
+}
+
+// newVerifiedReceipt mints the receipt for mmrIndex from the massif which
+// holds it, once verified, see NewReceipt.
+func newVerifiedReceipt(verified *VerifiedContext, mmrIndex uint64) (*commoncose.CoseSign1Message, error) {
+	return NewContextReceipt(&verified.MassifContext, mmrIndex, &verified.Checkpoint)
+}
+
+// NewContextReceipt mints the receipt of inclusion for mmrIndex, as NewReceipt
+// does, from a massif context and its checkpoint the caller already holds. The
+// inclusion proof is computed from the massif data against the sealed size of
+// the checkpoint, and attached to the pre-signed receipt of the peak which
+// commits mmrIndex.
+//
+// The massif is not verified against the checkpoint. A receipt minted from
+// data the checkpoint did not seal will not verify for a relying party, use
+// NewReceipt, or VerifyContext first, to find that out before handing it on.
+func NewContextReceipt(mc *MassifContext, mmrIndex uint64, check *Checkpoint) (*commoncose.CoseSign1Message, error) {
+	if check == nil {
+		return nil, fmt.Errorf("%w: a checkpoint is required to mint a receipt", ErrSealNotFound)
+	}
+	massifIndex := mc.Start.MassifIndex
 
 	if mmrIndex >= check.MMRSize {
 		return nil, fmt.Errorf(
@@ -169,7 +191,7 @@ func NewReceipt(
 			massifIndex, SealPeakReceiptsLabel)
 	}
 
-	proof, err := mmr.InclusionProof(&verified.MassifContext, check.MMRSize-1, mmrIndex)
+	proof, err := mmr.InclusionProof(mc, check.MMRSize-1, mmrIndex)
 	if err != nil {
 		return nil, fmt.Errorf(
 			"failed to generate inclusion proof: %d in MMR(%d), %v",
@@ -207,16 +229,21 @@ func NewReceipt(
 			err, mmrIndex, check.MMRSize)
 	}
 
-	signed.Headers.RawUnprotected = nil
-	if signed.Headers.Unprotected == nil {
-		signed.Headers.Unprotected = cose.UnprotectedHeader{}
+	attachInclusionProof(signed, mmrIndex, proof)
+	return signed, nil
+}
+
+// attachInclusionProof sets the inclusion proof of mmrIndex on a pre-signed
+// peak receipt, replacing any proof it already carries.
+func attachInclusionProof(receipt *commoncose.CoseSign1Message, mmrIndex uint64, proof [][]byte) {
+	receipt.Headers.RawUnprotected = nil
+	if receipt.Headers.Unprotected == nil {
+		receipt.Headers.Unprotected = cose.UnprotectedHeader{}
 	}
-	signed.Headers.Unprotected[checkpointLabelVDP] = MMRiverVerifiableProofs{
+	receipt.Headers.Unprotected[checkpointLabelVDP] = MMRiverVerifiableProofs{
 		InclusionProofs: []MMRiverInclusionProof{{
 			Index:         mmrIndex,
 			InclusionPath: proof,
 		}},
 	}
-
-	return signed, nil
 }
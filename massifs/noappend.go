@@ -0,0 +1,145 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/veraison/go-cose"
+)
+
+// NoAppendStatementContentType is the protected header content type (label
+// 3) of a signed no-append statement.
+const NoAppendStatementContentType = "application/vnd.forestrie.merklelog-noappend+cbor"
+
+var (
+	ErrNoAppendStatementInvalid = errors.New("the no-append statement is invalid")
+	ErrNoAppendUnsealed         = errors.New("the log has data which is not sealed, a checkpoint is due rather than a no-append statement")
+	ErrNoAppendStateMismatch    = errors.New("the no-append statement is not for the trusted log state")
+	ErrNoAppendExpired          = errors.New("the latest no-append statement is too old, the log may be withheld")
+)
+
+// NoAppendStatement is a proof of no append: the sealer's signed statement
+// that the log was still at MMRSize, with the same accumulator, at IssuedAt.
+// A sealer which has nothing new to seal issues these periodically, in place
+// of a checkpoint, so that relying parties can tell a quiet log from one
+// whose growth is being withheld from them. A growth checkpoint is never
+// accepted as a no-append statement, or the reverse, as the protected content
+// types differ.
+type NoAppendStatement struct {
+	MMRSize     uint64   `cbor:"1,keyasint"`
+	Accumulator [][]byte `cbor:"2,keyasint"`
+	// IssuedAt is the time the state was attested, in unix milliseconds
+	IssuedAt int64 `cbor:"3,keyasint"`
+}
+
+// NewNoAppendStatement verifies the head massif of the log against its
+// checkpoint and returns the statement that the sealed state is current at
+// issuedAt. If the log has data after the checkpoint, ErrNoAppendUnsealed is
+// returned, the log has grown and must be sealed instead.
+func NewNoAppendStatement(
+	ctx context.Context, reader ObjectReader, verifier cose.Verifier, issuedAt time.Time,
+) (*NoAppendStatement, error) {
+	head, err := reader.HeadIndex(ctx, storage.ObjectMassifData)
+	if err != nil {
+		return nil, err
+	}
+	vc, err := GetContextVerified(ctx, reader, verifier, head)
+	if err != nil {
+		return nil, err
+	}
+	if vc.Checkpoint.MMRSize != vc.RangeCount() {
+		return nil, fmt.Errorf("%w: sealed %d of %d nodes", ErrNoAppendUnsealed, vc.Checkpoint.MMRSize, vc.RangeCount())
+	}
+	return &NoAppendStatement{
+		MMRSize:     vc.Checkpoint.MMRSize,
+		Accumulator: vc.Accumulator,
+		IssuedAt:    issuedAt.UnixMilli(),
+	}, nil
+}
+
+// SignNoAppendStatement signs the statement as a tagged COSE_Sign1 with the
+// encoded statement attached.
+func SignNoAppendStatement(signer cose.Signer, statement *NoAppendStatement) ([]byte, error) {
+	payload, err := canonicalReceiptCBOR.Marshal(statement)
+	if err != nil {
+		return nil, fmt.Errorf("encode no-append statement: %w", err)
+	}
+	msg := cose.NewSign1Message()
+	msg.Headers.Protected.SetAlgorithm(signer.Algorithm())
+	msg.Headers.Protected[cose.HeaderLabelContentType] = NoAppendStatementContentType
+	msg.Payload = payload
+	if err = msg.Sign(rand.Reader, nil, signer); err != nil {
+		return nil, fmt.Errorf("sign no-append statement: %w", err)
+	}
+	return msg.MarshalCBOR()
+}
+
+// IsNoAppendStatement returns true if data is a COSE_Sign1 with the no-append
+// statement content type. It does not verify the signature, it is for
+// routing seal objects to VerifyNoAppendStatement or VerifyCheckpointReceipt.
+func IsNoAppendStatement(data []byte) bool {
+	var msg cose.Sign1Message
+	if err := msg.UnmarshalCBOR(data); err != nil {
+		return false
+	}
+	ct, _ := msg.Headers.Protected[cose.HeaderLabelContentType].(string)
+	return ct == NoAppendStatementContentType
+}
+
+// VerifyNoAppendStatement verifies a signature over a no-append statement,
+// and that it attests to the trusted state, and returns the statement. The
+// trusted state is normally that of the latest verified checkpoint. A
+// statement for a different state fails with ErrNoAppendStateMismatch: if it
+// is larger the relying party is missing checkpoints, otherwise the log is
+// equivocating.
+func VerifyNoAppendStatement(data []byte, verifier cose.Verifier, trusted MMRState) (*NoAppendStatement, error) {
+	if verifier == nil {
+		return nil, ErrVerifierRequired
+	}
+	var msg cose.Sign1Message
+	if err := msg.UnmarshalCBOR(data); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoAppendStatementInvalid, err)
+	}
+	if ct, _ := msg.Headers.Protected[cose.HeaderLabelContentType].(string); ct != NoAppendStatementContentType {
+		return nil, fmt.Errorf("%w: content type %v", ErrNoAppendStatementInvalid, msg.Headers.Protected[cose.HeaderLabelContentType])
+	}
+	if err := msg.Verify(nil, verifier); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoAppendStatementInvalid, err)
+	}
+	var statement NoAppendStatement
+	if err := cbor.Unmarshal(msg.Payload, &statement); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoAppendStatementInvalid, err)
+	}
+	if statement.MMRSize != trusted.MMRSize {
+		return nil, fmt.Errorf("%w: statement size %d, trusted size %d",
+			ErrNoAppendStateMismatch, statement.MMRSize, trusted.MMRSize)
+	}
+	if len(statement.Accumulator) != len(trusted.Peaks) {
+		return nil, fmt.Errorf("%w: %d peaks, trusted state has %d",
+			ErrNoAppendStateMismatch, len(statement.Accumulator), len(trusted.Peaks))
+	}
+	for i := range trusted.Peaks {
+		if !bytes.Equal(statement.Accumulator[i], trusted.Peaks[i]) {
+			return nil, fmt.Errorf("%w: peak %d differs at size %d", ErrNoAppendStateMismatch, i, trusted.MMRSize)
+		}
+	}
+	return &statement, nil
+}
+
+// CheckAge returns ErrNoAppendExpired if the statement was issued more than
+// maxAge before now. Relying parties expecting statements at a known interval
+// use this to detect that they have stopped, which, with no new checkpoint,
+// means growth of the log may be being withheld from them.
+func (s *NoAppendStatement) CheckAge(now time.Time, maxAge time.Duration) error {
+	issued := time.UnixMilli(s.IssuedAt)
+	if age := now.Sub(issued); age > maxAge {
+		return fmt.Errorf("%w: issued %s, %s ago", ErrNoAppendExpired, issued.UTC().Format(time.RFC3339), age)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package massifs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+func TestNoAppendStatement(t *testing.T) {
+	ctx := context.Background()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := cose.NewSigner(cose.AlgorithmES256, key)
+	require.NoError(t, err)
+	verifier := newES256Verifier(t, &key.PublicKey)
+	store := buildSealedLogWithKey(t, key, 3, 5)
+
+	vc, err := GetContextVerified(ctx, store, verifier, 1)
+	require.NoError(t, err)
+	trusted := MMRState{MMRSize: vc.Checkpoint.MMRSize, Peaks: vc.Accumulator}
+
+	issuedAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	statement, err := NewNoAppendStatement(ctx, store, verifier, issuedAt)
+	require.NoError(t, err)
+	require.Equal(t, trusted.MMRSize, statement.MMRSize)
+	signed, err := SignNoAppendStatement(signer, statement)
+	require.NoError(t, err)
+	require.True(t, IsNoAppendStatement(signed))
+
+	got, err := VerifyNoAppendStatement(signed, verifier, trusted)
+	require.NoError(t, err)
+	require.Equal(t, statement, got)
+	require.NoError(t, got.CheckAge(issuedAt.Add(time.Hour), time.Hour))
+	require.ErrorIs(t, got.CheckAge(issuedAt.Add(time.Hour+time.Millisecond), time.Hour), ErrNoAppendExpired)
+
+	// a statement for any other state is rejected
+	_, err = VerifyNoAppendStatement(signed, verifier, MMRState{MMRSize: trusted.MMRSize + 1, Peaks: trusted.Peaks})
+	require.ErrorIs(t, err, ErrNoAppendStateMismatch)
+	forked := MMRState{MMRSize: trusted.MMRSize, Peaks: [][]byte{make([]byte, 32)}}
+	_, err = VerifyNoAppendStatement(signed, verifier, forked)
+	require.ErrorIs(t, err, ErrNoAppendStateMismatch)
+
+	// statements and growth checkpoints are not interchangeable
+	require.False(t, IsNoAppendStatement(vc.Checkpoint.Raw))
+	_, err = VerifyNoAppendStatement(vc.Checkpoint.Raw, verifier, trusted)
+	require.ErrorIs(t, err, ErrNoAppendStatementInvalid)
+	_, err = NewCheckpoint(signed)
+	require.Error(t, err)
+
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, err = VerifyNoAppendStatement(signed, newES256Verifier(t, &other.PublicKey), trusted)
+	require.ErrorIs(t, err, ErrNoAppendStatementInvalid)
+}
+
+func TestNewNoAppendStatementRequiresSealedLog(t *testing.T) {
+	ctx := context.Background()
+	store, verifier := buildSealedLog(t, 3, 5)
+
+	mc, err := GetAppendContext(ctx, store, 1, 3)
+	require.NoError(t, err)
+	leaf := sha256.Sum256([]byte("unsealed"))
+	_, err = mc.AddHashedLeaf(sha256.New(), 6, nil, nil, nil, leaf[:])
+	require.NoError(t, err)
+	require.NoError(t, CommitContext(ctx, store, &mc))
+
+	_, err = NewNoAppendStatement(ctx, store, verifier, time.Now())
+	require.ErrorIs(t, err, ErrNoAppendUnsealed)
+}
@@ -0,0 +1,119 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/forestrie/go-merklelog/bloom"
+	"github.com/forestrie/go-merklelog/massifs/storage"
+)
+
+type LookupOptions struct {
+	// ScanAll disables the bloom filter shortlist, every massif is scanned.
+	ScanAll bool
+}
+
+// WithLookupScanAll disables the bloom filter shortlist for LookupNodeValue.
+// It is necessary to find interior nodes, and leaves added with a bloom
+// override (extraBytes0 in AddHashedLeaf), as only the leaf values are
+// inserted into the bloom filters.
+func WithLookupScanAll() Option {
+	return func(a any) {
+		opts, ok := a.(*LookupOptions)
+		if !ok {
+			return
+		}
+		opts.ScanAll = true
+	}
+}
+
+// LookupNodeValue finds every mmr index whose node value is value, in every
+// massif from the first to the head.
+//
+// Bloom filter 0 of v2 massifs holds the leaf values, so by default only
+// massifs whose filter may contain value are read in full and scanned. Massif
+// formats without a bloom index are always scanned. All the node data of a
+// scanned massif is checked, so matching interior nodes are found there too.
+// See WithLookupScanAll for finding values which are not leaves.
+//
+// Returns the matching indices in ascending order, or an empty result if the
+// value does not appear.
+func LookupNodeValue(ctx context.Context, reader ObjectReader, value []byte, opts ...Option) ([]uint64, error) {
+	if len(value) != ValueBytes {
+		return nil, ErrLogValueBadSize
+	}
+	options := LookupOptions{}
+	if err := ApplyOptions(&options, opts...); err != nil {
+		return nil, err
+	}
+
+	head, err := reader.HeadIndex(ctx, storage.ObjectMassifData)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []uint64
+	for i := uint32(0); i <= head; i++ {
+		if !options.ScanAll {
+			maybe, err := massifMaybeContains(ctx, reader, i, value)
+			if err != nil {
+				return nil, err
+			}
+			if !maybe {
+				continue
+			}
+		}
+
+		// the shortlist read may have left a partial massif cached
+		data, err := reader.MassifReadN(ctx, i, -1)
+		if err != nil {
+			return nil, err
+		}
+		mc, err := newStoredMassifContext(data)
+		if err != nil {
+			return nil, fmt.Errorf("massif %d: %w", i, err)
+		}
+		logStart := mc.LogStart()
+		for off := logStart; off+ValueBytes <= uint64(len(mc.Data)); off += ValueBytes {
+			if bytes.Equal(mc.Data[off:off+ValueBytes], value) {
+				found = append(found, mc.Start.FirstIndex+(off-logStart)/ValueBytes)
+			}
+		}
+	}
+	return found, nil
+}
+
+// massifMaybeContains consults the massif bloom filter, reading only the
+// massif header and index. It returns true if the massif must be scanned.
+func massifMaybeContains(ctx context.Context, reader ObjectReader, massifIndex uint32, value []byte) (bool, error) {
+	header, err := reader.MassifReadN(ctx, massifIndex, StartHeaderEnd)
+	if err != nil {
+		return false, err
+	}
+	if len(header) < StartHeaderEnd {
+		return false, fmt.Errorf("%w: massif %d start header incomplete", ErrMassifDataLengthInvalid, massifIndex)
+	}
+	mc := MassifContext{Start: MakeMassifStart(header)}
+	if mc.requireV2Index() != nil {
+		return true, nil
+	}
+	n, err := ReadLen(mc.IndexEnd())
+	if err != nil {
+		return false, err
+	}
+	mc.Data, err = reader.MassifReadN(ctx, massifIndex, n)
+	if err != nil {
+		return false, err
+	}
+	region, err := mc.BloomRegion()
+	if err != nil {
+		return false, err
+	}
+	maybe, err := bloom.MaybeContains(region, 0, value)
+	if errors.Is(err, bloom.ErrNotInitialized) {
+		return true, nil
+	}
+	return maybe, err
+}
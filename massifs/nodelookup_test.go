@@ -0,0 +1,144 @@
+package massifs
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/bloom"
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupNodeValue(t *testing.T) {
+	ctx := context.Background()
+	store, _ := buildSealedLog(t, 2, 7)
+
+	for _, leafIndex := range []uint64{0, 3, 6} {
+		leaf := sha256.Sum256(fmt.Appendf(nil, "sealed-log-leaf-%d", leafIndex))
+		found, err := LookupNodeValue(ctx, store, leaf[:])
+		require.NoError(t, err)
+		require.Equal(t, []uint64{mmr.MMRIndex(leafIndex)}, found)
+	}
+
+	absent := sha256.Sum256([]byte("never added"))
+	found, err := LookupNodeValue(ctx, store, absent[:], WithLookupScanAll())
+	require.NoError(t, err)
+	require.Empty(t, found)
+
+	// Interior nodes are not in the bloom filters, scanning finds them
+	mc, err := GetMassifContext(ctx, store, 1)
+	require.NoError(t, err)
+	interior := mc.Start.FirstIndex + 2
+	require.Equal(t, uint64(1), mmr.IndexHeight(interior))
+	value, err := mc.Get(interior)
+	require.NoError(t, err)
+	found, err = LookupNodeValue(ctx, store, value, WithLookupScanAll())
+	require.NoError(t, err)
+	require.Equal(t, []uint64{interior}, found)
+
+	_, err = LookupNodeValue(ctx, store, value[:31])
+	require.ErrorIs(t, err, ErrLogValueBadSize)
+}
+
+func TestLookupNodeValueDirReader(t *testing.T) {
+	ctx := context.Background()
+	store, _ := buildSealedLog(t, 2, 5)
+
+	dir := t.TempDir()
+	w, err := NewDirWriter(dir)
+	require.NoError(t, err)
+	for i, data := range store.massifs {
+		require.NoError(t, w.Put(ctx, i, storage.ObjectMassifData, data, false))
+	}
+	r, err := NewDirReader(dir)
+	require.NoError(t, err)
+
+	leaf := sha256.Sum256([]byte("sealed-log-leaf-4"))
+	found, err := LookupNodeValue(ctx, r, leaf[:])
+	require.NoError(t, err)
+	require.Equal(t, []uint64{mmr.MMRIndex(4)}, found)
+}
+
+func TestLookupNodeValueChecksStoredData(t *testing.T) {
+	ctx := context.Background()
+	store, _ := buildSealedLog(t, 2, 7)
+
+	// a node written by a commit in progress is not found
+	pending := sha256.Sum256([]byte("pending"))
+	committed := store.massifs[1]
+	store.massifs[1] = append(append([]byte(nil), committed...), pending[:]...)
+	found, err := LookupNodeValue(ctx, store, pending[:], WithLookupScanAll())
+	require.NoError(t, err)
+	require.Empty(t, found)
+
+	// a corrupt header is refused
+	corrupt := append([]byte(nil), committed...)
+	corrupt[MassifStartKeyMassifHeightFirstByte] = 12
+	store.massifs[1] = corrupt
+	_, err = LookupNodeValue(ctx, store, pending[:], WithLookupScanAll())
+	require.ErrorIs(t, err, ErrRegionBounds)
+}
+
+// TestLookupNodeValueBloomV2 round trips a log whose massifs have V2 bloom
+// regions through append, storage and the bloom shortlisted lookup.
+func TestLookupNodeValueBloomV2(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore(nil, nil)
+	p := bloom.BloomParams{Filters: bloom.Filters, K: 11, BitsPerElement: 16}
+
+	leafBatch := func(first, n int) []LeafBatch {
+		var batch LeafBatch
+		for id := first; id < first+n; id++ {
+			value := sha256.Sum256(fmt.Appendf(nil, "v2-leaf-%d", id))
+			batch.Leaves = append(batch.Leaves, BatchLeaf{IDTimestamp: uint64(id), Value: value[:]})
+		}
+		return []LeafBatch{batch}
+	}
+	_, err := CommitBatches(ctx, store, 1, 2, leafBatch(1, 5), WithBloomParams(p))
+	require.NoError(t, err)
+	// the parameters of an existing log are read from it
+	_, err = CommitBatches(ctx, store, 1, 2, leafBatch(6, 2))
+	require.NoError(t, err)
+
+	head, err := store.HeadIndex(ctx, storage.ObjectMassifData)
+	require.NoError(t, err)
+	require.Equal(t, uint32(3), head)
+	for i := range head + 1 {
+		mc, err := GetMassifContext(ctx, store, i)
+		require.NoError(t, err)
+		got, v2 := mc.Start.BloomParams()
+		require.True(t, v2)
+		require.Equal(t, p, got)
+
+		region, err := mc.BloomRegion()
+		require.NoError(t, err)
+		require.True(t, bloom.IsV2(region))
+		got, err = bloom.ParamsV2(region)
+		require.NoError(t, err)
+		require.Equal(t, p, got)
+
+		// the index is sized for the parameters
+		f, err := mc.Format()
+		require.NoError(t, err)
+		bitsets, ok := f.Region(RegionBloomBitsets)
+		require.True(t, ok)
+		require.Equal(t, uint64(bloom.Filters)*2*16/8, bitsets.Size)
+		stack, ok := f.Region(RegionPeakStack)
+		require.True(t, ok)
+		require.Equal(t, mc.PeakStackStart(), stack.Offset)
+	}
+
+	for id := 1; id <= 7; id++ {
+		leaf := sha256.Sum256(fmt.Appendf(nil, "v2-leaf-%d", id))
+		found, err := LookupNodeValue(ctx, store, leaf[:])
+		require.NoError(t, err)
+		require.Equal(t, []uint64{mmr.MMRIndex(uint64(id - 1))}, found)
+	}
+
+	// the massif index has a filter for the value and each extra
+	_, err = CreateFirstMassifContext(ctx, 1, 2, WithBloomParams(bloom.BloomParams{Filters: 2, K: 7, BitsPerElement: 10}))
+	require.ErrorIs(t, err, ErrInvalidOptions)
+}
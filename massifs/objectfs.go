@@ -0,0 +1,430 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+)
+
+// DefaultFSCacheObjects is the most objects an ObjectFS holds, unless set by
+// WithFSCache.
+const DefaultFSCacheObjects = 16
+
+// FSOptions configure the caching and read ahead of an ObjectFS.
+type FSOptions struct {
+	// CacheObjects is the most massif and checkpoint objects held, the least
+	// recently opened is dropped first. Negative disables the cache.
+	CacheObjects int
+	// ReadAhead is the number of following massifs read, in the background,
+	// when a massif is opened. It needs the cache.
+	ReadAhead int
+}
+
+// Validate returns an error wrapping ErrInvalidOptions if the options are out
+// of range.
+func (o *FSOptions) Validate() error {
+	if o.ReadAhead < 0 {
+		return fmt.Errorf("%w: read ahead %d", ErrInvalidOptions, o.ReadAhead)
+	}
+	return nil
+}
+
+// WithFSCache sets the most objects an ObjectFS holds. A negative count
+// disables the cache, and so read ahead.
+func WithFSCache(objects int) Option {
+	return func(a any) {
+		if opts, ok := a.(*FSOptions); ok {
+			opts.CacheObjects = objects
+		}
+	}
+}
+
+// WithFSReadAhead has an ObjectFS read the massifs following one which is
+// opened, in the background, so sequential readers of remote storage do not
+// wait on each fetch.
+func WithFSReadAhead(massifs int) Option {
+	return func(a any) {
+		if opts, ok := a.(*FSOptions); ok {
+			opts.ReadAhead = massifs
+		}
+	}
+}
+
+// objectKey identifies a cached object
+type objectKey struct {
+	otype       storage.ObjectType
+	massifIndex uint32
+}
+
+// ObjectFS is a read-only fs.FS over an ObjectReader. The massifs and
+// checkpoints of the log appear as the files of a local replica, named as
+// storage.FmtMassifPath and storage.FmtCheckpointPath do, directly in the
+// root or, with WithPathScheme, in the directories of the scheme. So file
+// based tooling, and DirReader with WithFS, work over any storage.
+//
+// Directories are listed with ObjectLister where the reader implements it,
+// otherwise every index up to the head is assumed to exist. Objects are read
+// in full when opened, and cached (see FSOptions). A cached object is not
+// read again, so a file opened twice may not show appends made in between.
+//
+// The reader is only used by one goroutine at a time.
+type ObjectFS struct {
+	ctx     context.Context
+	reader  ObjectReader
+	options FSOptions
+
+	// massifDir and checkpointDir are the directories of the objects, "."
+	// for the root
+	massifDir     string
+	checkpointDir string
+
+	mu     sync.Mutex
+	cache  map[objectKey][]byte
+	recent []objectKey
+	wg     sync.WaitGroup
+}
+
+// NewObjectFS returns the file system of the log read by reader. ctx is used
+// for every read.
+func NewObjectFS(ctx context.Context, reader ObjectReader, opts ...Option) (*ObjectFS, error) {
+	storageOptions := StorageOptions{}
+	f := &ObjectFS{
+		ctx:           ctx,
+		reader:        reader,
+		options:       FSOptions{CacheObjects: DefaultFSCacheObjects},
+		massifDir:     ".",
+		checkpointDir: ".",
+		cache:         map[objectKey][]byte{},
+	}
+	if err := ApplyOptions(&storageOptions, opts...); err != nil {
+		return nil, err
+	}
+	if err := ApplyOptions(&f.options, opts...); err != nil {
+		return nil, err
+	}
+	if storageOptions.PathScheme == nil {
+		return f, nil
+	}
+	for otype, dir := range map[storage.ObjectType]*string{
+		storage.ObjectPathMassifs:     &f.massifDir,
+		storage.ObjectPathCheckpoints: &f.checkpointDir,
+	} {
+		prefix, err := storageOptions.PathScheme.ObjectPrefix(
+			storageOptions.LogID, storageOptions.MassifHeight, otype)
+		if err != nil {
+			return nil, err
+		}
+		if prefix != "" {
+			*dir = strings.TrimSuffix(prefix, storage.V1MMRPathSep)
+		}
+	}
+	return f, nil
+}
+
+// Close waits for the outstanding read ahead
+func (f *ObjectFS) Close() error {
+	f.wg.Wait()
+	return nil
+}
+
+// Open opens the named file or directory
+func (f *ObjectFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if f.isDir(name) {
+		entries, err := f.readDir(name)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return &objectDir{info: dirInfo(name), entries: entries}, nil
+	}
+	key, ok := f.object(name)
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	data, err := f.read(key)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if key.otype == storage.ObjectMassifData {
+		f.readAhead(key.massifIndex)
+	}
+	return &objectFile{Reader: bytes.NewReader(data), info: fileInfo(name, len(data))}, nil
+}
+
+// ReadDir lists the named directory, see fs.ReadDirFS
+func (f *ObjectFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	if !f.isDir(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	entries, err := f.readDir(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return entries, nil
+}
+
+// ReadFile returns a copy of the named object, see fs.ReadFileFS
+func (f *ObjectFS) ReadFile(name string) ([]byte, error) {
+	key, ok := f.object(name)
+	if !ok || !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrNotExist}
+	}
+	data, err := f.read(key)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+	}
+	if key.otype == storage.ObjectMassifData {
+		f.readAhead(key.massifIndex)
+	}
+	return bytes.Clone(data), nil
+}
+
+// isDir returns true if name is the directory of the objects, or one of its
+// parents.
+func (f *ObjectFS) isDir(name string) bool {
+	if name == "." {
+		return true
+	}
+	for _, dir := range []string{f.massifDir, f.checkpointDir} {
+		if dir == name || strings.HasPrefix(dir, name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// object returns the object named, if name is the canonical path of a massif
+// or checkpoint.
+func (f *ObjectFS) object(name string) (objectKey, bool) {
+	dir, base := path.Split(name)
+	dir = path.Clean(dir)
+	otype, massifIndex, err := storage.ObjectIndexFromPath(base)
+	if err != nil {
+		return objectKey{}, false
+	}
+	switch otype {
+	case storage.ObjectMassifData:
+		return objectKey{otype, massifIndex}, dir == f.massifDir && base == storage.FmtMassifPath("", massifIndex)
+	case storage.ObjectCheckpoint:
+		return objectKey{otype, massifIndex}, dir == f.checkpointDir && base == storage.FmtCheckpointPath("", massifIndex)
+	default:
+		return objectKey{}, false
+	}
+}
+
+// readDir lists the directory name, which isDir has accepted
+func (f *ObjectFS) readDir(name string) ([]fs.DirEntry, error) {
+	var entries []fs.DirEntry
+	for _, dir := range []string{f.massifDir, f.checkpointDir} {
+		rel := dir
+		if name != "." {
+			rel = strings.TrimPrefix(dir, name+"/")
+		}
+		if dir == "." || dir == name || rel == dir && name != "." {
+			continue
+		}
+		child, _, _ := strings.Cut(rel, "/")
+		entries = append(entries, fs.FileInfoToDirEntry(dirInfo(path.Join(name, child))))
+	}
+	for otype, dir := range map[storage.ObjectType]string{
+		storage.ObjectMassifData: f.massifDir,
+		storage.ObjectCheckpoint: f.checkpointDir,
+	} {
+		if dir != name {
+			continue
+		}
+		indices, err := f.list(otype)
+		if err != nil {
+			return nil, err
+		}
+		for _, massifIndex := range indices {
+			entries = append(entries, &objectDirEntry{fs: f, key: objectKey{otype, massifIndex}})
+		}
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return slices.CompactFunc(entries, func(a, b fs.DirEntry) bool { return a.Name() == b.Name() }), nil
+}
+
+// list returns the indices of the objects of otype
+func (f *ObjectFS) list(otype storage.ObjectType) ([]uint32, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if lister, ok := f.reader.(ObjectLister); ok {
+		page, err := lister.List(f.ctx, otype, 0, 0)
+		return page.Indices, err
+	}
+	head, err := f.reader.HeadIndex(f.ctx, otype)
+	if storage.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	indices := make([]uint32, 0, head+1)
+	for massifIndex := range head + 1 {
+		indices = append(indices, massifIndex)
+	}
+	return indices, nil
+}
+
+// read returns the object, from the cache if it is held
+func (f *ObjectFS) read(key objectKey) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if data, ok := f.cache[key]; ok {
+		f.touch(key)
+		return data, nil
+	}
+	var data []byte
+	var err error
+	if key.otype == storage.ObjectCheckpoint {
+		data, err = f.reader.CheckpointRead(f.ctx, key.massifIndex)
+	} else {
+		data, err = f.reader.MassifReadN(f.ctx, key.massifIndex, -1)
+	}
+	if storage.IsNotFound(err) {
+		return nil, fs.ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.hold(key, data)
+	return data, nil
+}
+
+// readAhead reads the massifs following massifIndex into the cache
+func (f *ObjectFS) readAhead(massifIndex uint32) {
+	if f.options.ReadAhead <= 0 || f.options.CacheObjects < 0 {
+		return
+	}
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		for i := range uint32(f.options.ReadAhead) {
+			// past the head, or failed, the reader will see the error when
+			// it opens the massif itself
+			if _, err := f.read(objectKey{storage.ObjectMassifData, massifIndex + 1 + i}); err != nil {
+				return
+			}
+		}
+	}()
+}
+
+// hold caches the object, dropping the least recently used if the cache is
+// full. f.mu is held.
+func (f *ObjectFS) hold(key objectKey, data []byte) {
+	if f.options.CacheObjects < 0 {
+		return
+	}
+	if len(f.recent) >= max(f.options.CacheObjects, 1) {
+		delete(f.cache, f.recent[0])
+		f.recent = f.recent[1:]
+	}
+	f.cache[key] = data
+	f.recent = append(f.recent, key)
+}
+
+// touch makes the cached object the most recently used. f.mu is held.
+func (f *ObjectFS) touch(key objectKey) {
+	if i := slices.Index(f.recent, key); i >= 0 {
+		f.recent = append(slices.Delete(f.recent, i, i+1), key)
+	}
+}
+
+// objectInfo is the fs.FileInfo of the files and directories of an ObjectFS
+type objectInfo struct {
+	name string
+	size int64
+	mode fs.FileMode
+}
+
+func fileInfo(name string, size int) objectInfo {
+	return objectInfo{name: path.Base(name), size: int64(size), mode: 0o444}
+}
+
+func dirInfo(name string) objectInfo {
+	return objectInfo{name: path.Base(name), mode: fs.ModeDir | 0o555}
+}
+
+func (i objectInfo) Name() string       { return i.name }
+func (i objectInfo) Size() int64        { return i.size }
+func (i objectInfo) Mode() fs.FileMode  { return i.mode }
+func (i objectInfo) ModTime() time.Time { return time.Time{} }
+func (i objectInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i objectInfo) Sys() any           { return nil }
+
+// objectDirEntry is a listed object, it is only read if its Info is asked for
+type objectDirEntry struct {
+	fs  *ObjectFS
+	key objectKey
+}
+
+func (e *objectDirEntry) Name() string {
+	if e.key.otype == storage.ObjectCheckpoint {
+		return storage.FmtCheckpointPath("", e.key.massifIndex)
+	}
+	return storage.FmtMassifPath("", e.key.massifIndex)
+}
+
+func (e *objectDirEntry) IsDir() bool       { return false }
+func (e *objectDirEntry) Type() fs.FileMode { return 0 }
+
+func (e *objectDirEntry) Info() (fs.FileInfo, error) {
+	data, err := e.fs.read(e.key)
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo(e.Name(), len(data)), nil
+}
+
+// objectFile is an open object, it also implements io.Seeker and io.ReaderAt
+type objectFile struct {
+	*bytes.Reader
+	info objectInfo
+}
+
+func (f *objectFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *objectFile) Close() error               { return nil }
+
+// objectDir is an open directory
+type objectDir struct {
+	info    objectInfo
+	entries []fs.DirEntry
+}
+
+func (d *objectDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *objectDir) Close() error               { return nil }
+
+func (d *objectDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: fs.ErrInvalid}
+}
+
+// ReadDir returns the next n entries, see fs.ReadDirFile
+func (d *objectDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
@@ -0,0 +1,104 @@
+package massifs
+
+import (
+	"context"
+	"io/fs"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// countingReader counts the massif reads of the reader it wraps
+type countingReader struct {
+	*memStore
+	massifReads atomic.Int32
+}
+
+func (r *countingReader) MassifReadN(ctx context.Context, massifIndex uint32, n int) ([]byte, error) {
+	r.massifReads.Add(1)
+	return r.memStore.MassifReadN(ctx, massifIndex, n)
+}
+
+func TestObjectFS(t *testing.T) {
+	ctx := context.Background()
+	store, verifier := buildSealedLog(t, 3, 6)
+
+	fsys, err := NewObjectFS(ctx, store)
+	require.NoError(t, err)
+	require.NoError(t, fstest.TestFS(fsys,
+		storage.FmtMassifPath("", 0), storage.FmtMassifPath("", 1),
+		storage.FmtCheckpointPath("", 0), storage.FmtCheckpointPath("", 1)))
+
+	data, err := fs.ReadFile(fsys, storage.FmtMassifPath("", 1))
+	require.NoError(t, err)
+	require.Equal(t, store.massifs[1], data)
+	_, err = fsys.Open(storage.FmtMassifPath("", 2))
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	// the local reader works unchanged over the file system
+	reader, err := NewDirReader(".", WithFS(fsys))
+	require.NoError(t, err)
+	vc, err := GetContextVerified(ctx, reader, verifier, 1)
+	require.NoError(t, err)
+	require.Equal(t, mmr.MMRIndex(6), vc.Checkpoint.MMRSize)
+}
+
+func TestObjectFSPathScheme(t *testing.T) {
+	ctx := context.Background()
+	store, verifier := buildSealedLog(t, 3, 6)
+	id := uuid.New()
+	logID := storage.LogID(id[:])
+	scheme := WithPathScheme(storage.DataTrailsPathScheme{}, logID, 3)
+
+	fsys, err := NewObjectFS(ctx, store, scheme)
+	require.NoError(t, err)
+	massifs, err := storage.SchemeObjectPath(storage.DataTrailsPathScheme{}, logID, 3, 1, storage.ObjectMassifData)
+	require.NoError(t, err)
+	checkpoints, err := storage.SchemeObjectPath(storage.DataTrailsPathScheme{}, logID, 3, 1, storage.ObjectCheckpoint)
+	require.NoError(t, err)
+	require.NoError(t, fstest.TestFS(fsys, massifs, checkpoints))
+
+	// the root only holds the directories of the scheme
+	_, err = fsys.Open(storage.FmtMassifPath("", 1))
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	reader, err := NewDirReader(".", WithFS(fsys), scheme)
+	require.NoError(t, err)
+	_, err = GetContextVerified(ctx, reader, verifier, 1)
+	require.NoError(t, err)
+}
+
+func TestObjectFSReadAhead(t *testing.T) {
+	ctx := context.Background()
+	store, _ := buildSealedLog(t, 3, 12)
+	reader := &countingReader{memStore: store}
+
+	fsys, err := NewObjectFS(ctx, reader, WithFSReadAhead(1))
+	require.NoError(t, err)
+	_, err = fs.ReadFile(fsys, storage.FmtMassifPath("", 0))
+	require.NoError(t, err)
+	require.NoError(t, fsys.Close())
+	require.Equal(t, int32(2), reader.massifReads.Load())
+
+	// massif 1 was read ahead, and reading it reads massif 2 ahead
+	_, err = fs.ReadFile(fsys, storage.FmtMassifPath("", 1))
+	require.NoError(t, err)
+	require.NoError(t, fsys.Close())
+	require.Equal(t, int32(3), reader.massifReads.Load())
+
+	// without the cache every open reads the object
+	reader = &countingReader{memStore: store}
+	fsys, err = NewObjectFS(ctx, reader, WithFSCache(-1), WithFSReadAhead(1))
+	require.NoError(t, err)
+	for range 2 {
+		_, err = fs.ReadFile(fsys, storage.FmtMassifPath("", 0))
+		require.NoError(t, err)
+	}
+	require.NoError(t, fsys.Close())
+	require.Equal(t, int32(2), reader.massifReads.Load())
+}
@@ -0,0 +1,126 @@
+package massifs
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+)
+
+// DefaultListLimit is the page size ListGaps lists with
+const DefaultListLimit = 1000
+
+// listTokenVersion is the first byte of an encoded continuation token
+const listTokenVersion = 1
+
+var ErrListTokenInvalid = errors.New("the list continuation token is invalid")
+
+// ObjectPage is a page of the massif indices of the stored objects of a type,
+// in ascending order.
+type ObjectPage struct {
+	Indices []uint32
+	// Continuation is empty if there are no more objects, otherwise it is
+	// passed to ListContinue for the next page. It is opaque, but stable, so
+	// it can be persisted or returned to a client of an api.
+	Continuation string
+}
+
+// ObjectLister is implemented by storage that can enumerate the objects of a
+// log. Replication uses it to find the massifs missing below the head, which
+// HeadIndex alone can not show.
+type ObjectLister interface {
+	// List returns the indices of the objects of otype at or after
+	// fromIndex, at most limit of them. A limit < 1 returns all of them.
+	List(ctx context.Context, otype storage.ObjectType, fromIndex uint32, limit int) (ObjectPage, error)
+}
+
+// ListContinue returns the page following the one the continuation token was
+// returned with.
+func ListContinue(ctx context.Context, lister ObjectLister, continuation string, limit int) (ObjectPage, error) {
+	otype, fromIndex, err := decodeListToken(continuation)
+	if err != nil {
+		return ObjectPage{}, err
+	}
+	return lister.List(ctx, otype, fromIndex, limit)
+}
+
+// ListGaps returns the indices, up to the highest listed, of the objects of
+// otype which are missing. A log with no objects of the type has no gaps.
+func ListGaps(ctx context.Context, lister ObjectLister, otype storage.ObjectType) ([]uint32, error) {
+	var gaps []uint32
+	next := uint32(0)
+	page, err := lister.List(ctx, otype, 0, DefaultListLimit)
+	for {
+		if err != nil {
+			return nil, err
+		}
+		for _, massifIndex := range page.Indices {
+			for ; next < massifIndex; next++ {
+				gaps = append(gaps, next)
+			}
+			next = massifIndex + 1
+		}
+		if page.Continuation == "" {
+			return gaps, nil
+		}
+		page, err = ListContinue(ctx, lister, page.Continuation, DefaultListLimit)
+	}
+}
+
+// listObjectType maps the object types which can be listed to the type
+// stored, as HeadIndex does.
+func listObjectType(otype storage.ObjectType) (storage.ObjectType, error) {
+	switch otype {
+	case storage.ObjectMassifData, storage.ObjectMassifStart:
+		return storage.ObjectMassifData, nil
+	case storage.ObjectCheckpoint:
+		return storage.ObjectCheckpoint, nil
+	default:
+		return 0, fmt.Errorf("%w: object type %v", storage.ErrUnsupportedCap, otype)
+	}
+}
+
+// pageIndices returns the page of the ascending indices at or after
+// fromIndex.
+func pageIndices(indices []uint32, otype storage.ObjectType, fromIndex uint32, limit int) ObjectPage {
+	i, _ := slices.BinarySearch(indices, fromIndex)
+	indices = indices[i:]
+	if limit < 1 || len(indices) <= limit {
+		return ObjectPage{Indices: slices.Clone(indices)}
+	}
+	return ObjectPage{
+		Indices:      slices.Clone(indices[:limit]),
+		Continuation: encodeListToken(otype, indices[limit]),
+	}
+}
+
+// sortedIndices returns the keys of the map in ascending order
+func sortedIndices[V any](m map[uint32]V) []uint32 {
+	indices := make([]uint32, 0, len(m))
+	for massifIndex := range m {
+		indices = append(indices, massifIndex)
+	}
+	slices.Sort(indices)
+	return indices
+}
+
+// encodeListToken encodes the version, the object type and the next index
+func encodeListToken(otype storage.ObjectType, fromIndex uint32) string {
+	var raw [6]byte
+	raw[0] = listTokenVersion
+	raw[1] = byte(otype)
+	binary.BigEndian.PutUint32(raw[2:], fromIndex)
+	return base64.RawURLEncoding.EncodeToString(raw[:])
+}
+
+func decodeListToken(token string) (storage.ObjectType, uint32, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(raw) != 6 || raw[0] != listTokenVersion {
+		return 0, 0, fmt.Errorf("%w: %q", ErrListTokenInvalid, token)
+	}
+	return storage.ObjectType(raw[1]), binary.BigEndian.Uint32(raw[2:]), nil
+}
@@ -0,0 +1,84 @@
+package massifs
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObjectLister(t *testing.T) {
+	ctx := context.Background()
+
+	// massifs 0-5 less 2 and 4, checkpoints 0 and 3
+	dir := t.TempDir()
+	for _, i := range []uint32{0, 1, 3, 5} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, storage.FmtMassifPath("", i)), []byte("m"), 0o644))
+	}
+	for _, i := range []uint32{0, 3} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, storage.FmtCheckpointPath("", i)), []byte("c"), 0o644))
+	}
+	reader, err := NewDirReader(dir)
+	require.NoError(t, err)
+
+	page, err := reader.List(ctx, storage.ObjectMassifData, 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, []uint32{0, 1, 3, 5}, page.Indices)
+	require.Empty(t, page.Continuation)
+
+	page, err = reader.List(ctx, storage.ObjectMassifStart, 1, 2)
+	require.NoError(t, err)
+	require.Equal(t, []uint32{1, 3}, page.Indices)
+	require.NotEmpty(t, page.Continuation)
+	page, err = ListContinue(ctx, reader, page.Continuation, 2)
+	require.NoError(t, err)
+	require.Equal(t, []uint32{5}, page.Indices)
+	require.Empty(t, page.Continuation)
+
+	_, err = ListContinue(ctx, reader, "not-a-token", 2)
+	require.ErrorIs(t, err, ErrListTokenInvalid)
+	_, err = reader.List(ctx, storage.ObjectLogClosure, 0, 0)
+	require.ErrorIs(t, err, storage.ErrUnsupportedCap)
+
+	gaps, err := ListGaps(ctx, reader, storage.ObjectMassifData)
+	require.NoError(t, err)
+	require.Equal(t, []uint32{2, 4}, gaps)
+	gaps, err = ListGaps(ctx, reader, storage.ObjectCheckpoint)
+	require.NoError(t, err)
+	require.Equal(t, []uint32{1, 2}, gaps)
+
+	// a replica with checkpoints 0, 1 and 3 agrees with the first on 0 and 3
+	replica := t.TempDir()
+	for _, i := range []uint32{0, 1, 3} {
+		require.NoError(t, os.WriteFile(filepath.Join(replica, storage.FmtCheckpointPath("", i)), []byte("c"), 0o644))
+	}
+	other, err := NewDirReader(replica)
+	require.NoError(t, err)
+	quorum, err := NewQuorumReader(2, reader, other)
+	require.NoError(t, err)
+	page, err = quorum.List(ctx, storage.ObjectCheckpoint, 0, 1)
+	require.NoError(t, err)
+	require.Equal(t, []uint32{0}, page.Indices)
+	page, err = ListContinue(ctx, quorum, page.Continuation, 1)
+	require.NoError(t, err)
+	require.Equal(t, []uint32{3}, page.Indices)
+
+	// http storage can only report the contiguous objects up to the head
+	server := httptest.NewServer(http.FileServer(http.Dir(replica)))
+	defer server.Close()
+	_, err = NewHTTPReader(server.URL, WithPathScheme(storage.FlatPathScheme{}, nil, 0))
+	require.ErrorIs(t, err, ErrInvalidOptions)
+	httpReader, err := NewHTTPReader(server.URL)
+	require.NoError(t, err)
+	page, err = httpReader.List(ctx, storage.ObjectCheckpoint, 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, []uint32{0, 1}, page.Indices)
+	page, err = httpReader.List(ctx, storage.ObjectMassifData, 0, 0)
+	require.NoError(t, err)
+	require.Empty(t, page.Indices)
+}
@@ -2,6 +2,7 @@ package massifs
 
 import (
 	"context"
+	"errors"
 
 	"github.com/forestrie/go-merklelog/massifs/storage"
 )
@@ -28,3 +29,39 @@ type ObjectReaderWriter interface {
 	ObjectReader
 	ObjectWriter
 }
+
+// ObjectLocker is implemented by writers that can exclude other writers
+// while the objects for a massif are replaced. Where a writer implements it,
+// ReplaceVerifiedContext holds the lock across the massif and checkpoint
+// writes, so concurrent replicators can not interleave them.
+type ObjectLocker interface {
+	Lock(ctx context.Context, massifIndex uint32) (unlock func() error, err error)
+}
+
+// ErrAppendBaseMismatch is returned by an ObjectAppender when the stored
+// massif is not the one the writes were computed from.
+var ErrAppendBaseMismatch = errors.New("the stored massif is not the base of the append")
+
+// MassifBase identifies the stored massif data an append is computed from.
+type MassifBase struct {
+	// Size is the length of the stored data
+	Size uint64
+	// Tail is the last ValueBytes of the stored data, the last log node
+	Tail []byte
+}
+
+// ObjectAppender is implemented by writers whose backend can update a stored
+// massif in place, rather than replace it. CommitContext uses it to write
+// only the new log nodes and the words of the header and index that changed,
+// so the cost of a commit does not grow with the size of the massif.
+type ObjectAppender interface {
+	// AppendMassif applies the writes, in order, to the stored massif data.
+	// One write extends the data, the others overwrite bytes before
+	// base.Size. The order matters, the committed length marker is written
+	// after the data it covers. Before writing, the stored data is checked
+	// against base. If it differs ErrAppendBaseMismatch is returned and
+	// nothing is written.
+	//
+	// Unlike Put the update is not atomic, readers may see part of it.
+	AppendMassif(ctx context.Context, massifIndex uint32, base MassifBase, writes []ManifestRange) error
+}
@@ -1,18 +1,69 @@
 package massifs
 
 import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"time"
+
+	"github.com/forestrie/go-merklelog/bloom"
 	commoncbor "github.com/forestrie/go-merklelog/massifs/cbor"
+	"github.com/forestrie/go-merklelog/massifs/snowflakeid"
 	"github.com/forestrie/go-merklelog/massifs/storage"
 	"github.com/veraison/go-cose"
 )
 
+// StorageOptions configures the readers and writers of stored logs, such as
+// DirReader, DirWriter, HTTPReader and GCSStore.
 type StorageOptions struct {
 	LogID           storage.LogID
 	CommitmentEpoch uint8
 	MassifHeight    uint8
 	CBORCodec       *commoncbor.CBORCodec
 	COSEVerifier    cose.Verifier
+	// Durability is honoured by local writers, see DirWriter.
+	Durability Durability
+	// PathScheme names the objects of LogID, whose massifs have MassifHeight,
+	// under the storage root. See WithPathScheme.
+	PathScheme storage.PathScheme
+	// MemoryMap selects memory mapped massif reads, see WithMemoryMap.
+	MemoryMap bool
+	// FS, if set, is read by DirReader in place of the local file system,
+	// see WithFS.
+	FS fs.FS
+	// HTTPClient is used by readers of HTTP hosted logs, and by GCSStore, it
+	// defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// CommitOptions configures the statistics block maintained by CommitContext,
+// see MassifStats.
+type CommitOptions struct {
+	BuilderVersion BuilderVersion
+	// Clock defaults to the system clock
+	Clock snowflakeid.Clock
+	// DeadlineMargin is the time CommitBatches reserves, before the context
+	// deadline, for its final write.
+	DeadlineMargin time.Duration
+	// IntegrityChecksums adds the integrity block to massifs which do not
+	// have one, see MassifContext.SetIntegrity.
+	IntegrityChecksums bool
+	// IndexCommitment adds the index commitment to massifs which do not have
+	// one, see MassifContext.SetIndexCommitment.
+	IndexCommitment bool
 }
+
+// CreateOptions configures the first massif of a new log, see
+// CreateFirstMassifContext. The massifs which follow it are laid out the same.
+type CreateOptions struct {
+	// BloomParams, if set, gives the index a V2 bloom region with these
+	// parameters, see WithBloomParams. Otherwise it has the V1 region.
+	BloomParams *bloom.BloomParams
+}
+
+// VerifyOptions configures the verification of a massif against its
+// checkpoint, see GetContextVerified and MassifContext.VerifyContext.
 type VerifyOptions struct {
 	// Check is the checkpoint to verify against. If nil, the verification
 	// entry points fetch the checkpoint for the massif being verified.
@@ -23,6 +74,51 @@ type VerifyOptions struct {
 	// COSEVerifier verifies the checkpoint receipt signature. Required:
 	// format-v3 receipts carry no key material.
 	COSEVerifier cose.Verifier
+	// TrustedKeys, if set, are the keys checkpoints may be signed with, see
+	// WithTrustedKeys.
+	TrustedKeys []TrustedKey
+	// Cache, if set, skips the consistency checks of completed massifs whose
+	// content has already been verified against the same checkpoint content.
+	// The checkpoint signature is always checked.
+	Cache *VerificationCache
+	// SignatureCache, if set, skips the signature check of a checkpoint
+	// receipt whose signature has already been verified.
+	SignatureCache *SignatureCache
+	// LatestSeen, if set, refuses checkpoints older than one already accepted
+	// for LogID, and records those accepted.
+	LatestSeen *LatestSeenStore
+	LogID      storage.LogID
+	// AllowRollback accepts an older checkpoint and resets the latest seen
+	// state to it. It is for intentional restores.
+	AllowRollback bool
+	// RequireSealSubject refuses checkpoints whose CWT subject does not name
+	// LogID and the massif's commitment epoch, see SealClaims.
+	RequireSealSubject bool
+	// MinSealVersion, if set, refuses checkpoints which do not attest a seal
+	// version at least this, or whose format version is not that of the
+	// massif, see SealVersion.
+	MinSealVersion *SealVersion
+	// RequireIndexCommitment refuses checkpoints which do not carry the
+	// commitment to the urkle leaf records they seal, see
+	// WithSealIndexCommitment.
+	RequireIndexCommitment bool
+	// RequireIndexConfig refuses checkpoints which do not carry the index
+	// configuration of the massif, see WithSealIndexConfig. A checkpoint which
+	// carries one is always checked.
+	RequireIndexConfig bool
+	// Equivocations, if set, is given every checkpoint verified for LogID,
+	// and refuses one which equivocates with a checkpoint already given.
+	Equivocations *EquivocationCollector
+	// ReadOnly marks the context verified, and so the VerifiedContext, read
+	// only, see MassifContext.ReadOnly.
+	ReadOnly bool
+	// RefreshSource, if set, is read for a newer checkpoint when the seal
+	// verified is older than RefreshMaxAge, see WithSealRefresh.
+	RefreshSource ObjectReader
+	RefreshMaxAge time.Duration
+	// RefreshSink, if set, is given the massif and checkpoint read from
+	// RefreshSource once they are verified, see WithSealRefreshSink.
+	RefreshSink ObjectWriter
 }
 
 // Option is a generic option type used for storage implementations.
@@ -30,6 +126,89 @@ type VerifyOptions struct {
 // expectation they ignore the options
 type Option func(any)
 
+// ErrInvalidOptions is returned when the options configured for an entry
+// point are inconsistent, or out of range.
+var ErrInvalidOptions = errors.New("the options are invalid")
+
+// OptionsValidator is implemented by the options records which can check
+// their configuration once every option is applied.
+type OptionsValidator interface {
+	Validate() error
+}
+
+// ApplyOptions applies opts to target, a pointer to an options record such as
+// StorageOptions, and validates the result if the record implements
+// OptionsValidator. Options for other records are ignored. The entry points
+// of the package configure themselves with it, it is exported for code which
+// wraps or mocks them.
+func ApplyOptions(target any, opts ...Option) error {
+	for _, opt := range opts {
+		opt(target)
+	}
+	if v, ok := target.(OptionsValidator); ok {
+		return v.Validate()
+	}
+	return nil
+}
+
+// Validate returns an error wrapping ErrInvalidOptions if the options are out
+// of range.
+func (o *StorageOptions) Validate() error {
+	if o.MassifHeight > MaxMMRHeight {
+		return fmt.Errorf("%w: massif height %d", ErrInvalidOptions, o.MassifHeight)
+	}
+	if o.PathScheme != nil && o.MassifHeight == 0 {
+		return fmt.Errorf("%w: a path scheme needs the massif height", ErrInvalidOptions)
+	}
+	return nil
+}
+
+// Validate returns an error wrapping ErrInvalidOptions if the options are out
+// of range.
+func (o *CommitOptions) Validate() error {
+	if o.DeadlineMargin < 0 {
+		return fmt.Errorf("%w: deadline margin %v", ErrInvalidOptions, o.DeadlineMargin)
+	}
+	return nil
+}
+
+// Validate returns an error wrapping ErrInvalidOptions if the bloom
+// parameters can not be used for the massif index.
+func (o *CreateOptions) Validate() error {
+	if o.BloomParams == nil {
+		return nil
+	}
+	if err := o.BloomParams.Validate(); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidOptions, err)
+	}
+	if o.BloomParams.Filters != bloom.Filters {
+		return fmt.Errorf("%w: %d bloom filters, the massif index has %d",
+			ErrInvalidOptions, o.BloomParams.Filters, bloom.Filters)
+	}
+	return nil
+}
+
+// Validate returns an error wrapping ErrInvalidOptions if a check which needs
+// the log id is configured without it.
+func (o *VerifyOptions) Validate() error {
+	if o.RefreshMaxAge < 0 {
+		return fmt.Errorf("%w: seal refresh max age %v", ErrInvalidOptions, o.RefreshMaxAge)
+	}
+	if o.RefreshSink != nil && o.RefreshSource == nil {
+		return fmt.Errorf("%w: a seal refresh sink needs a source, see WithSealRefresh", ErrInvalidOptions)
+	}
+	if len(o.LogID) > 0 {
+		return nil
+	}
+	if o.LatestSeen != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidOptions, ErrLatestSeenLogIDRequired)
+	}
+	if o.RequireSealSubject || o.Equivocations != nil {
+		return fmt.Errorf("%w: the seal subject and equivocation checks need the log id", ErrInvalidOptions)
+	}
+	return nil
+}
+
 func WithCBORCodec(codec *commoncbor.CBORCodec) func(any) {
 	return func(opts any) {
 		if storageOpts, ok := opts.(*StorageOptions); ok {
@@ -46,6 +225,133 @@ func WithCOSEVerifier(verifier cose.Verifier) func(any) {
 	}
 }
 
+// WithDurability sets the crash durability of objects stored by local
+// writers.
+func WithDurability(durability Durability) Option {
+	return func(a any) {
+		if storageOpts, ok := a.(*StorageOptions); ok {
+			storageOpts.Durability = durability
+		}
+	}
+}
+
+// WithPathScheme selects the layout of the objects under the root of a local
+// reader or writer, and the log they are for. Without it DirReader and
+// DirWriter keep the objects of a single log directly in the root, as
+// storage.FlatPathScheme does. A nil scheme selects storage.DefaultPathScheme.
+func WithPathScheme(scheme storage.PathScheme, logID storage.LogID, massifHeight uint8) Option {
+	return func(a any) {
+		if storageOpts, ok := a.(*StorageOptions); ok {
+			if scheme == nil {
+				scheme = storage.DefaultPathScheme
+			}
+			storageOpts.PathScheme = scheme
+			storageOpts.LogID = logID
+			storageOpts.MassifHeight = massifHeight
+		}
+	}
+}
+
+// WithMemoryMap makes DirReader memory map the massif files it reads, rather
+// than read them into memory, leaving the operating system page cache to
+// manage which parts are resident. Where memory mapping is not supported the
+// files are read as usual.
+func WithMemoryMap() Option {
+	return func(a any) {
+		if storageOpts, ok := a.(*StorageOptions); ok {
+			storageOpts.MemoryMap = true
+		}
+	}
+}
+
+// WithFS makes DirReader read its directory from fsys rather than the local
+// file system, for example from an ObjectFS over remote storage. The
+// directory is then a slash separated path within fsys, "." for its root.
+// Files read from fsys are not memory mapped.
+func WithFS(fsys fs.FS) Option {
+	return func(a any) {
+		if storageOpts, ok := a.(*StorageOptions); ok {
+			storageOpts.FS = fsys
+		}
+	}
+}
+
+// WithHTTPClient sets the client used by readers of HTTP hosted logs, see
+// HTTPReader, and by GCSStore.
+func WithHTTPClient(client *http.Client) Option {
+	return func(a any) {
+		if storageOpts, ok := a.(*StorageOptions); ok {
+			storageOpts.HTTPClient = client
+		}
+	}
+}
+
+// WithBloomParams sizes the bloom filters of the index of a new log with p,
+// for example from bloom.ParamsForFalsePositiveRate, rather than the V1
+// BloomBitsPerElementV1 and BloomKV1. The massif index has a filter for the
+// leaf value and one for each leaf extra, so p must have bloom.Filters
+// filters. The parameters are recorded in the start header of every massif,
+// they are ignored for a log which already exists.
+func WithBloomParams(p bloom.BloomParams) Option {
+	return func(a any) {
+		if createOpts, ok := a.(*CreateOptions); ok {
+			createOpts.BloomParams = &p
+		}
+	}
+}
+
+// WithBuilderVersion records the committing software release in the massif
+// statistics block.
+func WithBuilderVersion(version BuilderVersion) Option {
+	return func(a any) {
+		if commitOpts, ok := a.(*CommitOptions); ok {
+			commitOpts.BuilderVersion = version
+		}
+	}
+}
+
+// WithIntegrityChecksums has CommitContext maintain the massif integrity
+// block. Once a massif has the block it is maintained regardless.
+func WithIntegrityChecksums() Option {
+	return func(a any) {
+		if commitOpts, ok := a.(*CommitOptions); ok {
+			commitOpts.IntegrityChecksums = true
+		}
+	}
+}
+
+// WithIndexCommitment maintains the index commitment, see
+// MassifContext.SetIndexCommitment. Once a massif has one it is maintained
+// regardless.
+func WithIndexCommitment() Option {
+	return func(a any) {
+		if commitOpts, ok := a.(*CommitOptions); ok {
+			commitOpts.IndexCommitment = true
+		}
+	}
+}
+
+// WithCommitClock sets the clock CommitContext measures the build duration
+// with.
+func WithCommitClock(clock snowflakeid.Clock) Option {
+	return func(a any) {
+		if commitOpts, ok := a.(*CommitOptions); ok {
+			commitOpts.Clock = clock
+		}
+	}
+}
+
+// WithCommitDeadlineMargin sets the time CommitBatches reserves before the
+// context deadline for its final write. It should exceed the time the store
+// takes to write a massif.
+func WithCommitDeadlineMargin(margin time.Duration) Option {
+	return func(a any) {
+		if commitOpts, ok := a.(*CommitOptions); ok {
+			commitOpts.DeadlineMargin = margin
+		}
+	}
+}
+
 func WithVerifyCheckpoint(check *Checkpoint) Option {
 	return func(a any) {
 		opts, ok := a.(*VerifyOptions)
@@ -65,6 +371,154 @@ func WithVerifyTrustedState(state MMRState) Option {
 		opts.TrustedBaseState = &state
 	}
 }
+
+// WithVerificationCache enables skipping the consistency checks of completed
+// massifs that have been verified before, see VerificationCache.
+func WithVerificationCache(cache *VerificationCache) Option {
+	return func(a any) {
+		opts, ok := a.(*VerifyOptions)
+		if !ok {
+			return
+		}
+		opts.Cache = cache
+	}
+}
+
+// WithSignatureCache enables skipping the signature check of checkpoint
+// receipts whose signature has been verified before, see SignatureCache.
+func WithSignatureCache(cache *SignatureCache) Option {
+	return func(a any) {
+		opts, ok := a.(*VerifyOptions)
+		if !ok {
+			return
+		}
+		opts.SignatureCache = cache
+	}
+}
+
+// WithLatestSeenStore enables rollback detection for the log identified by
+// logID, see LatestSeenStore.
+func WithLatestSeenStore(store *LatestSeenStore, logID storage.LogID) Option {
+	return func(a any) {
+		opts, ok := a.(*VerifyOptions)
+		if !ok {
+			return
+		}
+		opts.LatestSeen = store
+		opts.LogID = logID
+	}
+}
+
+// WithEquivocationCollector collects the evidence of equivocating seals for
+// the log identified by logID, see EquivocationCollector. A checkpoint which
+// equivocates is refused with ErrEquivocation.
+func WithEquivocationCollector(collector *EquivocationCollector, logID storage.LogID) Option {
+	return func(a any) {
+		opts, ok := a.(*VerifyOptions)
+		if !ok {
+			return
+		}
+		opts.Equivocations = collector
+		opts.LogID = logID
+	}
+}
+
+// WithVerifyReadOnly marks the verified context read only, so the index and
+// header helpers can not change the bytes which were verified. Use
+// MassifContext.Writable for a copy to change.
+func WithVerifyReadOnly() Option {
+	return func(a any) {
+		if opts, ok := a.(*VerifyOptions); ok {
+			opts.ReadOnly = true
+		}
+	}
+}
+
+// WithVerifyIndexCommitment refuses checkpoints which do not carry the index
+// commitment of the urkle leaf records they seal, so a replica can not alter
+// the idtimestamps or extra bytes of sealed leaves undetected.
+func WithVerifyIndexCommitment() Option {
+	return func(a any) {
+		if opts, ok := a.(*VerifyOptions); ok {
+			opts.RequireIndexCommitment = true
+		}
+	}
+}
+
+// WithVerifyIndexConfig refuses checkpoints which do not carry the index
+// configuration of the massif they seal, so a replica can not substitute
+// index regions of another format undetected.
+func WithVerifyIndexConfig() Option {
+	return func(a any) {
+		if opts, ok := a.(*VerifyOptions); ok {
+			opts.RequireIndexConfig = true
+		}
+	}
+}
+
+// WithVerifySealSubject requires the checkpoint's CWT subject to name the
+// log being verified, and the massif's commitment epoch. A valid seal for one
+// log can then not be presented for another.
+func WithVerifySealSubject(logID storage.LogID) Option {
+	return func(a any) {
+		opts, ok := a.(*VerifyOptions)
+		if !ok {
+			return
+		}
+		opts.RequireSealSubject = true
+		opts.LogID = logID
+	}
+}
+
+// WithRequireMinSealVersion requires the checkpoint to attest a builder and
+// massif format version no older than version. Checkpoints sealed without an
+// attestation are refused.
+func WithRequireMinSealVersion(version SealVersion) Option {
+	return func(a any) {
+		opts, ok := a.(*VerifyOptions)
+		if !ok {
+			return
+		}
+		opts.MinSealVersion = &version
+	}
+}
+
+// WithAllowRollback accepts a checkpoint older than the latest seen, for an
+// intentional restore of the log. The latest seen state is reset to it.
+func WithAllowRollback() Option {
+	return func(a any) {
+		opts, ok := a.(*VerifyOptions)
+		if !ok {
+			return
+		}
+		opts.AllowRollback = true
+	}
+}
+
+// WithSealRefresh has GetContextVerified, when the replica's seal is older
+// than maxAge, read the massif and its checkpoint from source and return them
+// instead, if they are sealed later and verify as consistent with the
+// replica. The age of a seal is the time since the idtimestamp of the last
+// leaf it covers. See WithSealRefreshSink to update the replica as well.
+func WithSealRefresh(source ObjectReader, maxAge time.Duration) Option {
+	return func(a any) {
+		if opts, ok := a.(*VerifyOptions); ok {
+			opts.RefreshSource = source
+			opts.RefreshMaxAge = maxAge
+		}
+	}
+}
+
+// WithSealRefreshSink has a seal refresh, see WithSealRefresh, put the
+// massif and checkpoint it verifies to sink, typically the replica itself.
+func WithSealRefreshSink(sink ObjectWriter) Option {
+	return func(a any) {
+		if opts, ok := a.(*VerifyOptions); ok {
+			opts.RefreshSink = sink
+		}
+	}
+}
+
 func VerifyWithCOSEVerifier(verifier cose.Verifier) func(any) {
 	return func(opts any) {
 		if verifyOpts, ok := opts.(*VerifyOptions); ok {
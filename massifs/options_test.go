@@ -0,0 +1,49 @@
+package massifs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyOptions(t *testing.T) {
+	var storageOptions StorageOptions
+	require.NoError(t, ApplyOptions(&storageOptions,
+		WithPathScheme(storage.FlatPathScheme{}, nil, 3), WithIndexCommitment(), WithMemoryMap()))
+	require.Equal(t, uint8(3), storageOptions.MassifHeight)
+	require.True(t, storageOptions.MemoryMap)
+
+	err := ApplyOptions(&storageOptions, WithPathScheme(storage.FlatPathScheme{}, nil, 0))
+	require.ErrorIs(t, err, ErrInvalidOptions)
+	err = ApplyOptions(&CommitOptions{}, WithCommitDeadlineMargin(-time.Second))
+	require.ErrorIs(t, err, ErrInvalidOptions)
+	err = ApplyOptions(&VerifyOptions{}, WithVerifySealSubject(nil))
+	require.ErrorIs(t, err, ErrInvalidOptions)
+	err = ApplyOptions(&VerifyOptions{}, WithLatestSeenStore(NewLatestSeenStore(), nil))
+	require.ErrorIs(t, err, ErrLatestSeenLogIDRequired)
+	err = ApplyOptions(&PrefetchOptions{}, WithPrefetchDepth(2, 1))
+	require.ErrorIs(t, err, ErrInvalidOptions)
+	// records without a validator only apply the options
+	require.NoError(t, ApplyOptions(&LookupOptions{}, WithLookupScanAll()))
+}
+
+func TestCheckpointSignOptions(t *testing.T) {
+	options, err := NewCheckpointSignOptions(WithPeakReceipts([]byte("kid")), WithSignConcurrency(4))
+	require.NoError(t, err)
+	require.True(t, options.PeakReceipts)
+	require.Equal(t, []byte("kid"), options.KID)
+	require.Equal(t, 4, options.Concurrency)
+
+	_, err = NewCheckpointSignOptions(WithSignConcurrency(-1))
+	require.ErrorIs(t, err, ErrInvalidOptions)
+	_, err = NewCheckpointSignOptions(WithUnprotectedExtras(map[int64]cbor.RawMessage{SealPeakReceiptsLabel: nil}))
+	require.ErrorIs(t, err, ErrInvalidOptions)
+
+	// the adapter carries sign options through the generic plumbing
+	var adapted CheckpointSignOptions
+	require.NoError(t, ApplyOptions(&adapted, WithCheckpointSignOptions(WithPeakReceipts(nil)), WithMemoryMap()))
+	require.True(t, adapted.PeakReceipts)
+}
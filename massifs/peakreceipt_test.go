@@ -1,6 +1,7 @@
 package massifs
 
 import (
+	"bytes"
 	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
@@ -144,6 +145,62 @@ func TestNewReceiptRequiresPeakReceipts(t *testing.T) {
 	require.ErrorContains(t, err, "no pre-signed peak receipts")
 }
 
+func TestNewContextReceipt(t *testing.T) {
+	mc := buildLegacyBlobMassif0(t, 1, 3, 3)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer := commoncose.NewTestCoseSigner(t, *key)
+	verifier := newES256Verifier(t, &key.PublicKey)
+
+	proof, err := BuildConsistencyProof(&mc, 0, mc.RangeCount())
+	require.NoError(t, err)
+	accumulator, err := mmr.PeakHashes(&mc, mc.RangeCount()-1)
+	require.NoError(t, err)
+	signed, err := SignCheckpointReceipt(signer, proof, accumulator, WithPeakReceipts([]byte("log-key-1")))
+	require.NoError(t, err)
+	check, err := NewCheckpoint(signed)
+	require.NoError(t, err)
+
+	for mmrIndex := range mc.RangeCount() {
+		candidate, err := mc.Get(mmrIndex)
+		require.NoError(t, err)
+		receipt, err := NewContextReceipt(&mc, mmrIndex, &check)
+		require.NoError(t, err)
+		ok, _, err := VerifySignedInclusionReceipt(context.Background(), roundTripReceipt(t, receipt), verifier, candidate)
+		require.NoError(t, err, "receipt for mmr index %d", mmrIndex)
+		require.True(t, ok)
+	}
+
+	_, err = NewContextReceipt(&mc, mc.RangeCount(), &check)
+	require.ErrorContains(t, err, "is not covered by the checkpoint")
+	_, err = NewContextReceipt(&mc, 0, nil)
+	require.ErrorIs(t, err, ErrSealNotFound)
+
+	// data the checkpoint did not seal mints a receipt which does not verify
+	candidate, err := mc.Get(0)
+	require.NoError(t, err)
+	tampered := mc
+	tampered.Data = bytes.Clone(mc.Data)
+	tampered.Data[tampered.LogStart()+ValueBytes] ^= 0x01
+	receipt, err := NewContextReceipt(&tampered, 0, &check)
+	require.NoError(t, err)
+	ok, _, err := VerifySignedInclusionReceipt(context.Background(), roundTripReceipt(t, receipt), verifier, candidate)
+	require.False(t, ok)
+	require.Error(t, err)
+}
+
+// roundTripReceipt encodes and decodes a receipt, as a relying party would
+// receive it
+func roundTripReceipt(t *testing.T, receipt *commoncose.CoseSign1Message) *commoncose.CoseSign1Message {
+	encoded, err := receipt.MarshalCBOR()
+	require.NoError(t, err)
+	decoded, err := commoncose.NewCoseSign1MessageFromCBOR(
+		encoded, commoncose.WithDecOptions(commoncbor.DecOptions))
+	require.NoError(t, err)
+	return decoded
+}
+
 // Unmodelled unprotected labels (delegation material) round-trip through
 // encode/decode via Extras, without affecting the checkpoint signature.
 func TestCheckpointReceiptUnprotectedExtrasRoundTrip(t *testing.T) {
@@ -0,0 +1,334 @@
+package massifs
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/fxamacker/cbor/v2"
+)
+
+// SealPeakReceiptRefsLabel is the private-use unprotected header label under
+// which a stored checkpoint carries the SHA-256 digests of its peak receipts
+// in place of the receipts, see PeakReceiptDedupStore. It is never present in
+// a checkpoint as returned to readers.
+const SealPeakReceiptRefsLabel int64 = SealPeakReceiptsLabel - 1
+
+var (
+	ErrPeakReceiptNotFound = errors.New("the referenced peak receipt is not in the store")
+	ErrPeakReceiptRefs     = errors.New("the checkpoint peak receipt references are invalid")
+)
+
+// PeakReceiptStore is a content addressed store of encoded peak receipts,
+// keyed by the SHA-256 of the receipt bytes, which counts the references to
+// each receipt.
+type PeakReceiptStore interface {
+	// AddPeakReceipt stores the receipt, if it is not already held, and adds
+	// a reference to it.
+	AddPeakReceipt(ctx context.Context, digest [32]byte, receipt []byte) error
+	// GetPeakReceipt returns the receipt, or ErrPeakReceiptNotFound
+	GetPeakReceipt(ctx context.Context, digest [32]byte) ([]byte, error)
+	// ReleasePeakReceipt removes a reference, the receipt is discarded when
+	// the last is removed.
+	ReleasePeakReceipt(ctx context.Context, digest [32]byte) error
+}
+
+// MemPeakReceiptStore is an in memory PeakReceiptStore. It is safe for
+// concurrent use.
+type MemPeakReceiptStore struct {
+	mu       sync.Mutex
+	receipts map[[32]byte][]byte
+	refs     map[[32]byte]int
+}
+
+func NewMemPeakReceiptStore() *MemPeakReceiptStore {
+	return &MemPeakReceiptStore{
+		receipts: map[[32]byte][]byte{},
+		refs:     map[[32]byte]int{},
+	}
+}
+
+func (s *MemPeakReceiptStore) AddPeakReceipt(ctx context.Context, digest [32]byte, receipt []byte) error {
+	if sha256.Sum256(receipt) != digest {
+		return fmt.Errorf("%w: digest %x does not match the receipt", ErrPeakReceiptRefs, digest)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.receipts[digest]; !ok {
+		s.receipts[digest] = append([]byte(nil), receipt...)
+	}
+	s.refs[digest]++
+	return nil
+}
+
+func (s *MemPeakReceiptStore) GetPeakReceipt(ctx context.Context, digest [32]byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	receipt, ok := s.receipts[digest]
+	if !ok {
+		return nil, fmt.Errorf("%w: %x", ErrPeakReceiptNotFound, digest)
+	}
+	return receipt, nil
+}
+
+func (s *MemPeakReceiptStore) ReleasePeakReceipt(ctx context.Context, digest [32]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.refs[digest] == 0 {
+		return fmt.Errorf("%w: %x", ErrPeakReceiptNotFound, digest)
+	}
+	s.refs[digest]--
+	if s.refs[digest] == 0 {
+		delete(s.refs, digest)
+		delete(s.receipts, digest)
+	}
+	return nil
+}
+
+// Len returns the number of distinct receipts held
+func (s *MemPeakReceiptStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.receipts)
+}
+
+// References returns the number of references to the receipt
+func (s *MemPeakReceiptStore) References(digest [32]byte) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.refs[digest]
+}
+
+// PeakReceiptDedupStore stores checkpoints with their peak receipts moved to
+// a PeakReceiptStore. Under the low update frequency property consecutive
+// seals mostly carry the same peak receipts, see WithPreviousPeakReceipts, so
+// each distinct receipt is stored once however many seals carry it.
+//
+// Put of a checkpoint replaces its peak receipts with references to them,
+// under SealPeakReceiptRefsLabel, and adds the references to the store. If a
+// checkpoint is replaced, the references of the checkpoint it replaces are
+// released. Checkpoint reads reassemble the checkpoint, byte for byte, so the
+// deduplication is not visible to readers. The peak receipts are carried in
+// the unprotected header, the checkpoint signature is unaffected.
+//
+// Other objects pass through unchanged. The wrapped store is only used
+// through ObjectReaderWriter, wrap it after any appender or locker is
+// selected.
+type PeakReceiptDedupStore struct {
+	ObjectReaderWriter
+	Receipts PeakReceiptStore
+}
+
+func NewPeakReceiptDedupStore(store ObjectReaderWriter, receipts PeakReceiptStore) *PeakReceiptDedupStore {
+	return &PeakReceiptDedupStore{ObjectReaderWriter: store, Receipts: receipts}
+}
+
+func (s *PeakReceiptDedupStore) Put(
+	ctx context.Context, massifIndex uint32, ty storage.ObjectType, data []byte, failIfExists bool,
+) error {
+	if ty != storage.ObjectCheckpoint {
+		return s.ObjectReaderWriter.Put(ctx, massifIndex, ty, data, failIfExists)
+	}
+	replaced, err := s.ObjectReaderWriter.CheckpointRead(ctx, massifIndex)
+	if err != nil && !storage.IsNotFound(err) {
+		return err
+	}
+
+	stored, digests, receipts, err := dedupPeakReceipts(data)
+	if err != nil {
+		return err
+	}
+	added := 0
+	release := func() {
+		for _, digest := range digests[:added] {
+			_ = s.Receipts.ReleasePeakReceipt(ctx, digest)
+		}
+	}
+	for i, digest := range digests {
+		if err = s.Receipts.AddPeakReceipt(ctx, digest, receipts[i]); err != nil {
+			release()
+			return err
+		}
+		added++
+	}
+	if err = s.ObjectReaderWriter.Put(ctx, massifIndex, ty, stored, failIfExists); err != nil {
+		release()
+		return err
+	}
+
+	if replaced == nil {
+		return nil
+	}
+	return s.ReleasePeakReceipts(ctx, replaced)
+}
+
+// ReleasePeakReceipts releases the references of a stored checkpoint. It is
+// for use when a stored checkpoint is deleted.
+func (s *PeakReceiptDedupStore) ReleasePeakReceipts(ctx context.Context, stored []byte) error {
+	digests, err := checkpointPeakReceiptRefs(stored)
+	if err != nil {
+		return err
+	}
+	for _, digest := range digests {
+		if err = s.Receipts.ReleasePeakReceipt(ctx, digest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *PeakReceiptDedupStore) CheckpointRead(ctx context.Context, massifIndex uint32) ([]byte, error) {
+	data, err := s.ObjectReaderWriter.CheckpointRead(ctx, massifIndex)
+	if err != nil {
+		return nil, err
+	}
+	return ReassemblePeakReceipts(ctx, s.Receipts, data)
+}
+
+func (s *PeakReceiptDedupStore) CheckpointData(massifIndex uint32) ([]byte, bool, error) {
+	data, ok, err := s.ObjectReaderWriter.CheckpointData(massifIndex)
+	if err != nil || !ok {
+		return data, ok, err
+	}
+	data, err = ReassemblePeakReceipts(context.Background(), s.Receipts, data)
+	return data, err == nil, err
+}
+
+// DedupPeakReceipts returns the checkpoint with its peak receipts replaced by
+// their digests, and the digests, in accumulator order. A checkpoint without
+// peak receipts is returned unchanged, with no digests. The receipts must be
+// added to a PeakReceiptStore for ReassemblePeakReceipts to restore them.
+func DedupPeakReceipts(data []byte) ([]byte, [][32]byte, error) {
+	out, digests, _, err := dedupPeakReceipts(data)
+	return out, digests, err
+}
+
+// dedupPeakReceipts is DedupPeakReceipts also returning the receipts
+func dedupPeakReceipts(data []byte) ([]byte, [][32]byte, [][]byte, error) {
+	envelope, err := decodeCheckpointEnvelope(data)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	raw, ok := envelope.unprotected[SealPeakReceiptsLabel]
+	if !ok {
+		return data, nil, nil, nil
+	}
+	var receipts [][]byte
+	if err = cbor.Unmarshal(raw, &receipts); err != nil {
+		return nil, nil, nil, fmt.Errorf("decode peak receipts: %w", err)
+	}
+	digests := make([][32]byte, len(receipts))
+	refs := make([][]byte, len(receipts))
+	for i, receipt := range receipts {
+		digests[i] = sha256.Sum256(receipt)
+		refs[i] = digests[i][:]
+	}
+	if envelope.unprotected[SealPeakReceiptRefsLabel], err = canonicalReceiptCBOR.Marshal(refs); err != nil {
+		return nil, nil, nil, fmt.Errorf("encode peak receipt refs: %w", err)
+	}
+	delete(envelope.unprotected, SealPeakReceiptsLabel)
+	out, err := envelope.encode()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return out, digests, receipts, nil
+}
+
+// ReassemblePeakReceipts reverses DedupPeakReceipts, reading the receipts
+// from the store. A checkpoint without references is returned unchanged.
+func ReassemblePeakReceipts(ctx context.Context, store PeakReceiptStore, data []byte) ([]byte, error) {
+	digests, err := checkpointPeakReceiptRefs(data)
+	if err != nil || digests == nil {
+		return data, err
+	}
+	receipts := make([][]byte, len(digests))
+	for i, digest := range digests {
+		if receipts[i], err = store.GetPeakReceipt(ctx, digest); err != nil {
+			return nil, err
+		}
+	}
+	envelope, err := decodeCheckpointEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+	if envelope.unprotected[SealPeakReceiptsLabel], err = canonicalReceiptCBOR.Marshal(receipts); err != nil {
+		return nil, fmt.Errorf("encode peak receipts: %w", err)
+	}
+	delete(envelope.unprotected, SealPeakReceiptRefsLabel)
+	return envelope.encode()
+}
+
+// checkpointPeakReceiptRefs returns the peak receipt digests of a stored
+// checkpoint, nil if it has none.
+func checkpointPeakReceiptRefs(data []byte) ([][32]byte, error) {
+	envelope, err := decodeCheckpointEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := envelope.unprotected[SealPeakReceiptRefsLabel]
+	if !ok {
+		return nil, nil
+	}
+	var refs [][]byte
+	if err = cbor.Unmarshal(raw, &refs); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPeakReceiptRefs, err)
+	}
+	digests := make([][32]byte, len(refs))
+	for i, ref := range refs {
+		if len(ref) != sha256.Size {
+			return nil, fmt.Errorf("%w: ref %d is %d bytes", ErrPeakReceiptRefs, i, len(ref))
+		}
+		digests[i] = [32]byte(ref)
+	}
+	return digests, nil
+}
+
+// checkpointEnvelope is the COSE_Sign1 of a checkpoint, with the values of
+// its unprotected header verbatim.
+type checkpointEnvelope struct {
+	tagged      bool
+	sign1       []cbor.RawMessage
+	unprotected map[int64]cbor.RawMessage
+}
+
+func decodeCheckpointEnvelope(data []byte) (checkpointEnvelope, error) {
+	envelope := checkpointEnvelope{tagged: len(data) > 0 && data[0] == coseSign1Tag}
+	if envelope.tagged {
+		var tag cbor.RawTag
+		if err := cbor.Unmarshal(data, &tag); err != nil {
+			return checkpointEnvelope{}, fmt.Errorf("decode COSE_Sign1 tag: %w", err)
+		}
+		data = tag.Content
+	}
+	if err := cbor.Unmarshal(data, &envelope.sign1); err != nil {
+		return checkpointEnvelope{}, fmt.Errorf("decode COSE Sign1 array: %w", err)
+	}
+	if len(envelope.sign1) != 4 {
+		return checkpointEnvelope{}, fmt.Errorf("COSE Sign1 must have 4 elements, got %d", len(envelope.sign1))
+	}
+	if err := cbor.Unmarshal(envelope.sign1[1], &envelope.unprotected); err != nil {
+		return checkpointEnvelope{}, fmt.Errorf("decode unprotected header: %w", err)
+	}
+	return envelope, nil
+}
+
+// encode re-encodes the checkpoint with the unprotected header as it now is.
+// The encoding is canonical, as EncodeCheckpointReceipt produces.
+func (e checkpointEnvelope) encode() ([]byte, error) {
+	header, err := canonicalReceiptCBOR.Marshal(e.unprotected)
+	if err != nil {
+		return nil, fmt.Errorf("encode unprotected header: %w", err)
+	}
+	var content any = []cbor.RawMessage{e.sign1[0], header, e.sign1[2], e.sign1[3]}
+	if e.tagged {
+		content = cbor.Tag{Number: 18, Content: content}
+	}
+	out, err := canonicalReceiptCBOR.Marshal(content)
+	if err != nil {
+		return nil, fmt.Errorf("encode checkpoint receipt: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,87 @@
+package massifs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+func TestPeakReceiptDedupStore(t *testing.T) {
+	ctx := context.Background()
+	source, _ := buildSealedLog(t, 4, 6)
+	mc, err := GetMassifContext(ctx, source, 0)
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := cose.NewSigner(cose.AlgorithmES256, key)
+	require.NoError(t, err)
+	verifier := newES256Verifier(t, &key.PublicKey)
+
+	// seals at 4 and 6 leaves share the peak of the first 4
+	seal := func(from, to uint64, opts ...CheckpointSignOption) ([]byte, [][]byte) {
+		proof, err := BuildConsistencyProof(&mc, from, to)
+		require.NoError(t, err)
+		accumulator, err := mmr.PeakHashes(&mc, to-1)
+		require.NoError(t, err)
+		data, err := SignCheckpointReceipt(signer, proof, accumulator, append(opts, WithPeakReceipts(nil))...)
+		require.NoError(t, err)
+		return data, accumulator
+	}
+	first, firstAccumulator := seal(0, 7)
+	firstCheck, err := NewCheckpoint(first)
+	require.NoError(t, err)
+	second, _ := seal(7, 10, WithPreviousPeakReceipts(verifier, firstAccumulator, firstCheck.Receipt.PeakReceipts))
+	secondCheck, err := NewCheckpoint(second)
+	require.NoError(t, err)
+	require.Len(t, secondCheck.Receipt.PeakReceipts, 2)
+	require.Equal(t, firstCheck.Receipt.PeakReceipts[0], secondCheck.Receipt.PeakReceipts[0])
+
+	receipts := NewMemPeakReceiptStore()
+	inner := newMemStore(nil, nil)
+	store := NewPeakReceiptDedupStore(inner, receipts)
+	require.NoError(t, store.Put(ctx, 0, storage.ObjectCheckpoint, first, false))
+	require.NoError(t, store.Put(ctx, 1, storage.ObjectCheckpoint, second, false))
+
+	shared := sha256.Sum256(firstCheck.Receipt.PeakReceipts[0])
+	require.Equal(t, 2, receipts.Len())
+	require.Equal(t, 2, receipts.References(shared))
+	require.Less(t, len(inner.checkpoint[1]), len(second))
+	stored, err := NewCheckpoint(inner.checkpoint[1])
+	require.NoError(t, err)
+	require.Nil(t, stored.Receipt.PeakReceipts)
+	require.Contains(t, stored.Receipt.Extras, SealPeakReceiptRefsLabel)
+
+	// reads are reassembled byte for byte
+	data, err := store.CheckpointRead(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, second, data)
+	data, ok, err := store.CheckpointData(0)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, first, data)
+
+	// replacing a checkpoint releases the references of the one replaced
+	require.NoError(t, store.Put(ctx, 1, storage.ObjectCheckpoint, first, false))
+	require.Equal(t, 1, receipts.Len())
+	require.Equal(t, 2, receipts.References(shared))
+
+	require.NoError(t, store.ReleasePeakReceipts(ctx, inner.checkpoint[1]))
+	require.NoError(t, store.ReleasePeakReceipts(ctx, inner.checkpoint[0]))
+	require.Equal(t, 0, receipts.Len())
+	_, err = store.CheckpointRead(ctx, 0)
+	require.ErrorIs(t, err, ErrPeakReceiptNotFound)
+
+	// checkpoints without peak receipts pass through unchanged
+	plain, _ := buildSealedLog(t, 2, 4)
+	require.NoError(t, store.Put(ctx, 2, storage.ObjectCheckpoint, plain.checkpoint[0], false))
+	require.Equal(t, plain.checkpoint[0], inner.checkpoint[2])
+}
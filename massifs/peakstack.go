@@ -1,6 +1,10 @@
 package massifs
 
-import "github.com/forestrie/go-merklelog/mmr"
+import (
+	"fmt"
+
+	"github.com/forestrie/go-merklelog/mmr"
+)
 
 // Methods for working with the mmrblob peak stack
 
@@ -25,3 +29,46 @@ func PeakStackMap(massifHeight uint8, mmrIndex uint64) map[uint64]int {
 
 	return stackMap
 }
+
+// PeakStackEntry is an ancestor peak carried in the peak stack of a massif.
+type PeakStackEntry struct {
+	// StackIndex is the position of the entry in the stack
+	StackIndex int
+	MMRIndex   uint64
+	// Height is the zero based height of the peak, as mmr.IndexHeight
+	Height uint64
+	Hash   []byte
+}
+
+// PeakStackEntries returns the ancestor peak stack of the massif, in stack
+// order, with the mmr index and height of each peak. The mmr indices are
+// assigned exactly as PeakStackMap assigns them, so the result can be
+// compared directly with the stack of another massif or replica. The first
+// massif has an empty stack.
+func (mc MassifContext) PeakStackEntries() ([]PeakStackEntry, error) {
+	stackMap := PeakStackMap(mc.Start.MassifHeight, mc.Start.FirstIndex)
+	if stackMap == nil {
+		return nil, fmt.Errorf("%w: invalid massif height", ErrAncestorStackInvalid)
+	}
+	if uint64(len(stackMap)) != mc.Start.PeakStackLen {
+		return nil, fmt.Errorf(
+			"%w: %d ancestor peaks, the stack length is %d", ErrAncestorStackInvalid, len(stackMap), mc.Start.PeakStackLen)
+	}
+	entries := make([]PeakStackEntry, len(stackMap))
+	for mmrIndex, stackIndex := range stackMap {
+		if stackIndex < 0 || stackIndex >= len(entries) {
+			return nil, fmt.Errorf("%w: peak %d has stack index %d", ErrAncestorStackInvalid, mmrIndex, stackIndex)
+		}
+		hash, err := mc.GetStackedPeak(stackIndex)
+		if err != nil {
+			return nil, err
+		}
+		entries[stackIndex] = PeakStackEntry{
+			StackIndex: stackIndex,
+			MMRIndex:   mmrIndex,
+			Height:     mmr.IndexHeight(mmrIndex),
+			Hash:       append([]byte(nil), hash...),
+		}
+	}
+	return entries, nil
+}
@@ -1,12 +1,15 @@
 package massifs
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"reflect"
 	"testing"
 
 	"github.com/forestrie/go-merklelog/mmr"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestPeakStackMap(t *testing.T) {
@@ -132,3 +135,36 @@ func TestPeakStackPopArithmetic(t *testing.T) {
 		})
 	}
 }
+
+func TestPeakStackEntries(t *testing.T) {
+	ctx := context.Background()
+	// height 2 massifs of 2 leaves, so the stacks grow and shrink
+	store, _ := buildSealedLog(t, 2, 16)
+
+	for massifIndex := range uint32(8) {
+		mc, err := GetMassifContext(ctx, store, massifIndex)
+		require.NoError(t, err)
+		entries, err := mc.PeakStackEntries()
+		require.NoError(t, err)
+		require.Len(t, entries, int(mc.Start.PeakStackLen))
+
+		raw, err := mc.GetAncestorPeakStack()
+		require.NoError(t, err)
+		var stacked [][]byte
+		for i, entry := range entries {
+			require.Equal(t, i, entry.StackIndex)
+			require.Equal(t, mc.PeakStackMap[entry.MMRIndex], i)
+			require.Equal(t, mmr.IndexHeight(entry.MMRIndex), entry.Height)
+			require.Less(t, entry.MMRIndex, mc.Start.FirstIndex)
+			stacked = append(stacked, entry.Hash)
+
+			// each entry is the node committed by the earlier massif
+			owner, err := GetMassifContext(ctx, store, uint32(MassifIndexFromMMRIndex(2, entry.MMRIndex)))
+			require.NoError(t, err)
+			want, err := owner.Get(entry.MMRIndex)
+			require.NoError(t, err)
+			require.Equal(t, want, entry.Hash)
+		}
+		require.True(t, bytes.Equal(raw, bytes.Join(stacked, nil)))
+	}
+}
@@ -0,0 +1,439 @@
+package massifs
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+)
+
+const (
+	// DefaultPrefetchMaxDepth is the most massifs a PrefetchReader reads
+	// ahead of the consumer, unless set by WithPrefetchDepth.
+	DefaultPrefetchMaxDepth = 8
+	// DefaultPrefetchMinReadSize is the smallest ranged read a PrefetchReader
+	// makes, unless set by WithPrefetchMinReadSize. It covers the start
+	// header and the index header.
+	DefaultPrefetchMinReadSize = StartHeaderEnd + IndexHeaderBytes
+
+	// prefetchSmoothing is the weight of a new sample in the moving averages
+	prefetchSmoothing = 0.25
+)
+
+// PrefetchOptions bound the adaptation of a PrefetchReader.
+type PrefetchOptions struct {
+	MinDepth    int
+	MaxDepth    int
+	MinReadSize int
+	// RegionMetrics, if set, accounts the bytes read from the source to the
+	// massif regions they fall in.
+	RegionMetrics *RegionReadMetrics
+}
+
+// Validate returns an error wrapping ErrInvalidOptions if the options are out
+// of range.
+func (o *PrefetchOptions) Validate() error {
+	if o.MinDepth < 0 || o.MaxDepth < o.MinDepth {
+		return fmt.Errorf("%w: prefetch depth [%d, %d]", ErrInvalidOptions, o.MinDepth, o.MaxDepth)
+	}
+	if o.MinReadSize < 0 {
+		return fmt.Errorf("%w: prefetch read size %d", ErrInvalidOptions, o.MinReadSize)
+	}
+	return nil
+}
+
+// WithPrefetchDepth bounds the number of massifs a PrefetchReader reads ahead
+// of the consumer.
+func WithPrefetchDepth(minDepth, maxDepth int) Option {
+	return func(a any) {
+		if opts, ok := a.(*PrefetchOptions); ok {
+			opts.MinDepth = minDepth
+			opts.MaxDepth = maxDepth
+		}
+	}
+}
+
+// WithPrefetchMinReadSize sets the smallest ranged read a PrefetchReader
+// makes.
+func WithPrefetchMinReadSize(n int) Option {
+	return func(a any) {
+		if opts, ok := a.(*PrefetchOptions); ok {
+			opts.MinReadSize = n
+		}
+	}
+}
+
+// WithRegionReadMetrics accounts the bytes a PrefetchReader reads from its
+// source to the massif regions, see RegionReadMetrics.
+func WithRegionReadMetrics(metrics *RegionReadMetrics) Option {
+	return func(a any) {
+		if opts, ok := a.(*PrefetchOptions); ok {
+			opts.RegionMetrics = metrics
+		}
+	}
+}
+
+// PrefetchStats is a snapshot of the measurements a PrefetchReader adapts to.
+type PrefetchStats struct {
+	// Depth is the current read ahead depth, in massifs
+	Depth int
+	// ReadSize is the current minimum size of a ranged read
+	ReadSize int
+	// Latency is the average time taken to fetch an object, in full
+	Latency time.Duration
+	// Overhead is the average time taken by a small ranged read, it
+	// approximates the per request cost of the storage
+	Overhead time.Duration
+	// Throughput is the average bytes per second of full object fetches
+	Throughput float64
+	// Interval is the average time the consumer spends on a massif, from
+	// reading it to asking for the next
+	Interval time.Duration
+	Hits     uint64
+	Misses   uint64
+}
+
+type prefetchKey struct {
+	massifIndex uint32
+	ty          storage.ObjectType
+}
+
+// prefetchEntry is a full object, fetched or being fetched
+type prefetchEntry struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// PrefetchReader is an ObjectReader which reads massifs, and their
+// checkpoints, ahead of a consumer working through the log in order, such as
+// a replicator. It measures the storage as it goes and adapts to it:
+//
+//   - The read ahead depth is the number of massifs that can be fetched in
+//     the time the consumer takes to process one, so fetching keeps pace
+//     with the consumer. For local storage this is typically the minimum, for
+//     cross region object storage it approaches the maximum.
+//   - Small ranged reads, such as of the start header, are enlarged to the
+//     number of bytes the storage transfers in the time a request costs.
+//     Reading that much more costs at most one request's time, and later
+//     reads of the same massif are served from it.
+//
+// Objects are cached for the life of the reader, less those well behind the
+// consumer, so a reader should be used for one pass over the log. Close
+// stops any read ahead still in progress.
+type PrefetchReader struct {
+	Source ObjectReader
+
+	options PrefetchOptions
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	mu      sync.Mutex
+	full    map[prefetchKey]*prefetchEntry
+	ranged  map[uint32][]byte
+	heads   map[storage.ObjectType]uint32
+	current uint32
+
+	latency, overhead, throughput, interval float64
+	intervalSampled                         bool
+	lastConsumed                            time.Time
+	hits, misses                            uint64
+}
+
+// NewPrefetchReader returns a reader of source. The options honoured are
+// WithPrefetchDepth, WithPrefetchMinReadSize and WithRegionReadMetrics.
+func NewPrefetchReader(source ObjectReader, opts ...Option) (*PrefetchReader, error) {
+	options := PrefetchOptions{MinDepth: 1, MaxDepth: DefaultPrefetchMaxDepth, MinReadSize: DefaultPrefetchMinReadSize}
+	if err := ApplyOptions(&options, opts...); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &PrefetchReader{
+		Source:  source,
+		options: options,
+		ctx:     ctx,
+		cancel:  cancel,
+		full:    map[prefetchKey]*prefetchEntry{},
+		ranged:  map[uint32][]byte{},
+		heads:   map[storage.ObjectType]uint32{},
+	}, nil
+}
+
+// Close cancels the read ahead in progress
+func (r *PrefetchReader) Close() {
+	r.cancel()
+}
+
+// Stats returns the current measurements and the adaptations made from them
+func (r *PrefetchReader) Stats() PrefetchStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return PrefetchStats{
+		Depth:      r.depthLocked(),
+		ReadSize:   r.readSizeLocked(0),
+		Latency:    time.Duration(r.latency * float64(time.Second)),
+		Overhead:   time.Duration(r.overhead * float64(time.Second)),
+		Throughput: r.throughput,
+		Interval:   time.Duration(r.interval * float64(time.Second)),
+		Hits:       r.hits,
+		Misses:     r.misses,
+	}
+}
+
+func (r *PrefetchReader) HeadIndex(ctx context.Context, otype storage.ObjectType) (uint32, error) {
+	head, err := r.Source.HeadIndex(ctx, otype)
+	if err == nil {
+		r.mu.Lock()
+		r.heads[otype] = head
+		r.mu.Unlock()
+	}
+	return head, err
+}
+
+// List lists the source, which must be an ObjectLister
+func (r *PrefetchReader) List(ctx context.Context, otype storage.ObjectType, fromIndex uint32, limit int) (ObjectPage, error) {
+	lister, ok := r.Source.(ObjectLister)
+	if !ok {
+		return ObjectPage{}, fmt.Errorf("%w: the source can not list objects", storage.ErrUnsupportedCap)
+	}
+	return lister.List(ctx, otype, fromIndex, limit)
+}
+
+// MassifData returns the whole massif, read ahead or fetched now, and reads
+// ahead of it.
+func (r *PrefetchReader) MassifData(massifIndex uint32) ([]byte, bool, error) {
+	data, err := r.MassifReadN(r.ctx, massifIndex, -1)
+	return data, err == nil, err
+}
+
+// CheckpointData returns the checkpoint, read ahead or fetched now
+func (r *PrefetchReader) CheckpointData(massifIndex uint32) ([]byte, bool, error) {
+	data, err := r.CheckpointRead(r.ctx, massifIndex)
+	return data, err == nil, err
+}
+
+func (r *PrefetchReader) MassifReadN(ctx context.Context, massifIndex uint32, n int) ([]byte, error) {
+	if n < 0 {
+		requested := time.Now()
+		data, err := r.read(ctx, prefetchKey{massifIndex, storage.ObjectMassifData})
+		if err == nil {
+			r.consumed(massifIndex, requested)
+		}
+		return data, err
+	}
+	return r.readRange(ctx, massifIndex, n)
+}
+
+func (r *PrefetchReader) CheckpointRead(ctx context.Context, massifIndex uint32) ([]byte, error) {
+	return r.read(ctx, prefetchKey{massifIndex, storage.ObjectCheckpoint})
+}
+
+// cached returns a completed full object, if there is one
+func (r *PrefetchReader) cached(key prefetchKey) ([]byte, bool) {
+	r.mu.Lock()
+	e, ok := r.full[key]
+	r.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	select {
+	case <-e.done:
+		return e.data, e.err == nil
+	default:
+		return nil, false
+	}
+}
+
+// read returns the full object, waiting for a read ahead in progress or
+// fetching it now.
+func (r *PrefetchReader) read(ctx context.Context, key prefetchKey) ([]byte, error) {
+	r.mu.Lock()
+	e, ok := r.full[key]
+	if ok {
+		r.hits++
+	} else {
+		r.misses++
+		e = &prefetchEntry{done: make(chan struct{})}
+		r.full[key] = e
+	}
+	r.mu.Unlock()
+
+	if !ok {
+		r.fetch(ctx, key, e)
+	}
+	select {
+	case <-e.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return e.data, e.err
+}
+
+// fetch reads the object into the entry. A failed entry is removed, so a
+// later read tries again.
+func (r *PrefetchReader) fetch(ctx context.Context, key prefetchKey, e *prefetchEntry) {
+	start := time.Now()
+	if key.ty == storage.ObjectCheckpoint {
+		e.data, e.err = r.Source.CheckpointRead(ctx, key.massifIndex)
+	} else {
+		e.data, e.err = r.Source.MassifReadN(ctx, key.massifIndex, -1)
+	}
+	elapsed := time.Since(start).Seconds()
+	r.recordRead(key.ty, e.data, e.err)
+
+	r.mu.Lock()
+	if e.err != nil {
+		if r.full[key] == e {
+			delete(r.full, key)
+		}
+	} else if key.ty == storage.ObjectMassifData {
+		r.latency = prefetchAverage(r.latency, elapsed)
+		if elapsed > 0 {
+			r.throughput = prefetchAverage(r.throughput, float64(len(e.data))/elapsed)
+		}
+	}
+	r.mu.Unlock()
+	close(e.done)
+}
+
+// readRange serves a ranged read from a full or ranged read already made, or
+// makes one of at least the adapted read size.
+func (r *PrefetchReader) readRange(ctx context.Context, massifIndex uint32, n int) ([]byte, error) {
+	if data, ok := r.cached(prefetchKey{massifIndex, storage.ObjectMassifData}); ok {
+		r.countHit()
+		return data[:min(n, len(data))], nil
+	}
+	r.mu.Lock()
+	data, ok := r.ranged[massifIndex]
+	size := r.readSizeLocked(n)
+	r.mu.Unlock()
+	if ok && len(data) >= n {
+		r.countHit()
+		return data[:n], nil
+	}
+
+	start := time.Now()
+	data, err := r.Source.MassifReadN(ctx, massifIndex, size)
+	if err != nil {
+		return nil, err
+	}
+	elapsed := time.Since(start).Seconds()
+	r.recordRead(storage.ObjectMassifData, data, nil)
+
+	r.mu.Lock()
+	r.misses++
+	r.overhead = prefetchAverage(r.overhead, elapsed)
+	if len(data) == size {
+		// A short read is the whole object, which may yet grow, so only full
+		// ranges are kept
+		r.ranged[massifIndex] = data
+	}
+	r.mu.Unlock()
+	return data[:min(n, len(data))], nil
+}
+
+// recordRead accounts a successful read from the source to the regions read
+func (r *PrefetchReader) recordRead(ty storage.ObjectType, data []byte, err error) {
+	if r.options.RegionMetrics == nil || err != nil {
+		return
+	}
+	if ty == storage.ObjectCheckpoint {
+		r.options.RegionMetrics.RecordCheckpointRead(len(data))
+		return
+	}
+	r.options.RegionMetrics.RecordMassifRead(data)
+}
+
+func (r *PrefetchReader) countHit() {
+	r.mu.Lock()
+	r.hits++
+	r.mu.Unlock()
+}
+
+// consumed notes the consumer has read the massif, having requested it at
+// requested, and reads ahead of it.
+func (r *PrefetchReader) consumed(massifIndex uint32, requested time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// The time the consumer spent on the massifs since the last, excluding
+	// any time waiting for the storage.
+	if massifIndex > r.current && !r.lastConsumed.IsZero() {
+		busy := requested.Sub(r.lastConsumed).Seconds() / float64(massifIndex-r.current)
+		r.interval = prefetchAverage(r.interval, busy)
+		r.intervalSampled = true
+	}
+	if massifIndex > r.current || r.lastConsumed.IsZero() {
+		r.lastConsumed = time.Now()
+		r.current = massifIndex
+	}
+
+	// forget the objects well behind the consumer
+	for key := range r.full {
+		if uint64(key.massifIndex)+uint64(r.options.MaxDepth) < uint64(r.current) {
+			delete(r.full, key)
+		}
+	}
+	for i := range r.ranged {
+		if i < r.current {
+			delete(r.ranged, i)
+		}
+	}
+
+	depth := r.depthLocked()
+	for ahead := 1; ahead <= depth; ahead++ {
+		i := uint64(massifIndex) + uint64(ahead)
+		if i > math.MaxUint32 {
+			break
+		}
+		for _, ty := range []storage.ObjectType{storage.ObjectCheckpoint, storage.ObjectMassifData} {
+			if head, ok := r.heads[ty]; ok && uint32(i) > head {
+				continue
+			}
+			key := prefetchKey{uint32(i), ty}
+			if _, ok := r.full[key]; ok {
+				continue
+			}
+			e := &prefetchEntry{done: make(chan struct{})}
+			r.full[key] = e
+			go r.fetch(r.ctx, key, e)
+		}
+	}
+}
+
+// depthLocked returns the number of massifs to read ahead: enough that the
+// fetches complete in the time the consumer takes to reach them.
+func (r *PrefetchReader) depthLocked() int {
+	depth := r.options.MinDepth
+	if r.intervalSampled && r.latency > 0 {
+		if r.interval <= 0 || r.latency/r.interval > float64(r.options.MaxDepth) {
+			return r.options.MaxDepth
+		}
+		depth = max(depth, int(math.Ceil(r.latency/r.interval)))
+	}
+	return min(depth, r.options.MaxDepth)
+}
+
+// readSizeLocked returns the size of a ranged read for n bytes: the bytes the
+// storage transfers in the time a request costs, and at least n.
+func (r *PrefetchReader) readSizeLocked(n int) int {
+	size := max(n, r.options.MinReadSize)
+	if r.overhead > 0 && r.throughput > 0 {
+		bdp := r.overhead * r.throughput
+		if bdp < float64(math.MaxInt32) {
+			size = max(size, int(bdp))
+		}
+	}
+	// Round up to whole log entries
+	return (size + ValueBytes - 1) / ValueBytes * ValueBytes
+}
+
+func prefetchAverage(average, sample float64) float64 {
+	if average == 0 {
+		return sample
+	}
+	return average + prefetchSmoothing*(sample-average)
+}
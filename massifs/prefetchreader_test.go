@@ -0,0 +1,115 @@
+package massifs
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/stretchr/testify/require"
+)
+
+// slowReader delays every read, and records the sizes of the ranged reads
+type slowReader struct {
+	*memStore
+	delay time.Duration
+
+	mu     sync.Mutex
+	full   map[uint32]int
+	ranged []int
+}
+
+func newSlowReader(store *memStore, delay time.Duration) *slowReader {
+	return &slowReader{memStore: store, delay: delay, full: map[uint32]int{}}
+}
+
+func (s *slowReader) MassifReadN(ctx context.Context, massifIndex uint32, n int) ([]byte, error) {
+	time.Sleep(s.delay)
+	s.mu.Lock()
+	if n < 0 {
+		s.full[massifIndex]++
+	} else {
+		s.ranged = append(s.ranged, n)
+	}
+	s.mu.Unlock()
+	return s.memStore.MassifReadN(ctx, massifIndex, n)
+}
+
+func (s *slowReader) CheckpointRead(ctx context.Context, massifIndex uint32) ([]byte, error) {
+	time.Sleep(s.delay)
+	return s.memStore.CheckpointRead(ctx, massifIndex)
+}
+
+func TestPrefetchReaderAdaptsDepth(t *testing.T) {
+	ctx := context.Background()
+	store, verifier := buildSealedLog(t, 3, 40)
+
+	// slow storage and a fast consumer: the reader reads further ahead
+	source := newSlowReader(store, 20*time.Millisecond)
+	r, err := NewPrefetchReader(source, WithPrefetchDepth(1, 4))
+	require.NoError(t, err)
+	defer r.Close()
+	head, err := r.HeadIndex(ctx, storage.ObjectMassifData)
+	require.NoError(t, err)
+	_, err = r.HeadIndex(ctx, storage.ObjectCheckpoint)
+	require.NoError(t, err)
+	for i := range head + 1 {
+		vc, err := GetContextVerified(ctx, r, verifier, i)
+		require.NoError(t, err)
+		require.Equal(t, store.massifs[i], vc.Data)
+	}
+	stats := r.Stats()
+	require.Equal(t, 4, stats.Depth)
+	require.Positive(t, stats.Hits)
+	source.mu.Lock()
+	for i := range head + 1 {
+		require.Equal(t, 1, source.full[i], "massif %d", i)
+	}
+	source.mu.Unlock()
+
+	// fast storage and a slow consumer: the minimum is enough
+	r, err = NewPrefetchReader(newSlowReader(store, 0), WithPrefetchDepth(1, 4))
+	require.NoError(t, err)
+	defer r.Close()
+	for i := range uint32(4) {
+		_, err = r.MassifReadN(ctx, i, -1)
+		require.NoError(t, err)
+		time.Sleep(5 * time.Millisecond)
+	}
+	require.Equal(t, 1, r.Stats().Depth)
+}
+
+func TestPrefetchReaderRangedReads(t *testing.T) {
+	ctx := context.Background()
+	store, _ := buildSealedLog(t, 3, 12)
+	source := newSlowReader(store, time.Millisecond)
+	_, err := NewPrefetchReader(source, WithPrefetchDepth(2, 1))
+	require.ErrorIs(t, err, ErrInvalidOptions)
+	r, err := NewPrefetchReader(source, WithPrefetchDepth(0, 0))
+	require.NoError(t, err)
+	defer r.Close()
+
+	header, err := r.MassifReadN(ctx, 0, StartHeaderEnd)
+	require.NoError(t, err)
+	require.Equal(t, store.massifs[0][:StartHeaderEnd], header)
+	// served from the first read, which covered the index header
+	_, err = r.MassifReadN(ctx, 0, StartHeaderEnd+IndexHeaderBytes)
+	require.NoError(t, err)
+	require.Len(t, source.ranged, 1)
+	require.Equal(t, DefaultPrefetchMinReadSize, source.ranged[0])
+
+	// once throughput is measured, small reads are enlarged
+	_, err = r.MassifReadN(ctx, 1, -1)
+	require.NoError(t, err)
+	_, err = r.MassifReadN(ctx, 2, StartHeaderEnd)
+	require.NoError(t, err)
+	require.Len(t, source.ranged, 2)
+	require.Greater(t, source.ranged[1], DefaultPrefetchMinReadSize)
+
+	// a read of the whole object serves ranged reads
+	data, err := r.MassifReadN(ctx, 1, 100)
+	require.NoError(t, err)
+	require.Equal(t, store.massifs[1][:100], data)
+	require.Len(t, source.ranged, 2)
+}
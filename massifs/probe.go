@@ -0,0 +1,252 @@
+package massifs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+)
+
+// ObjectInfo is the metadata of a stored object, as returned by a HEAD or
+// equivalent request.
+type ObjectInfo struct {
+	Size         int64
+	LastModified time.Time
+}
+
+// ObjectStater is implemented by storage that can return object metadata
+// without reading the object content.
+type ObjectStater interface {
+	Stat(ctx context.Context, massifIndex uint32, otype storage.ObjectType) (ObjectInfo, error)
+}
+
+// LogProber is implemented by storage that can answer Probe for many logs
+// using listing and metadata requests only.
+type LogProber interface {
+	SelectLog(ctx context.Context, logID storage.LogID) error
+	HeadIndex(ctx context.Context, otype storage.ObjectType) (uint32, error)
+	ObjectStater
+}
+
+// LogProbe is the liveness and freshness summary of one log.
+type LogProbe struct {
+	// Exists is false if the log has no massifs, in which case no other field
+	// is set.
+	Exists             bool
+	MassifIndex        uint32
+	MassifLastModified time.Time
+	// HasCheckpoint is false if no massif has been sealed yet
+	HasCheckpoint          bool
+	CheckpointIndex        uint32
+	CheckpointLastModified time.Time
+}
+
+// Probe returns the head massif and head checkpoint indices of the log, and
+// when each was last modified. No object content is read, so it is cheap
+// enough to poll thousands of logs for a dashboard.
+//
+// A log which does not exist is not an error, the result has Exists false.
+func Probe(ctx context.Context, prober LogProber, logID storage.LogID) (LogProbe, error) {
+	if err := prober.SelectLog(ctx, logID); err != nil {
+		return LogProbe{}, err
+	}
+
+	var probe LogProbe
+	massifIndex, info, ok, err := probeHead(ctx, prober, storage.ObjectMassifData)
+	if err != nil || !ok {
+		return probe, err
+	}
+	probe.Exists = true
+	probe.MassifIndex = massifIndex
+	probe.MassifLastModified = info.LastModified
+
+	checkpointIndex, info, ok, err := probeHead(ctx, prober, storage.ObjectCheckpoint)
+	if err != nil || !ok {
+		return probe, err
+	}
+	probe.HasCheckpoint = true
+	probe.CheckpointIndex = checkpointIndex
+	probe.CheckpointLastModified = info.LastModified
+	return probe, nil
+}
+
+// probeHead returns the head index and metadata for otype, ok is false if
+// there are no objects of that type.
+func probeHead(ctx context.Context, prober LogProber, otype storage.ObjectType) (uint32, ObjectInfo, bool, error) {
+	head, err := prober.HeadIndex(ctx, otype)
+	if storage.IsNotFound(err) {
+		return 0, ObjectInfo{}, false, nil
+	}
+	if err != nil {
+		return 0, ObjectInfo{}, false, err
+	}
+	info, err := prober.Stat(ctx, head, otype)
+	if err != nil {
+		return 0, ObjectInfo{}, false, err
+	}
+	return head, info, true, nil
+}
+
+// Stat returns the metadata of a massif or checkpoint file.
+func (r *DirReader) Stat(ctx context.Context, massifIndex uint32, otype storage.ObjectType) (ObjectInfo, error) {
+	var path string
+	var ok bool
+	switch otype {
+	case storage.ObjectMassifData, storage.ObjectMassifStart:
+		path, ok = r.massifPaths[massifIndex]
+	case storage.ObjectCheckpoint:
+		path, ok = r.checkpointPaths[massifIndex]
+	default:
+		return ObjectInfo{}, fmt.Errorf("%w: object type %v", storage.ErrUnsupportedCap, otype)
+	}
+	if !ok {
+		return ObjectInfo{}, storage.NewNotFoundError(r.logID, otype, massifIndex)
+	}
+	info, err := statFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ObjectInfo{}, storage.NewNotFoundError(r.logID, otype, massifIndex)
+	}
+	return info, err
+}
+
+// DirProber is a LogProber over a local tree of many logs. The logs are laid
+// out by PathScheme, which defaults to storage.DefaultPathScheme, as in v2
+// storage: Root/v2/merklelog/massifs/{height}/{uuid}/ and
+// Root/v2/merklelog/checkpoints/{height}/{uuid}/.
+type DirProber struct {
+	Root         string
+	MassifHeight uint8
+	PathScheme   storage.PathScheme
+
+	logID         storage.LogID
+	massifDir     string
+	checkpointDir string
+}
+
+func (p *DirProber) SelectLog(ctx context.Context, logID storage.LogID) error {
+	scheme := p.PathScheme
+	if scheme == nil {
+		scheme = storage.DefaultPathScheme
+	}
+	massifPrefix, err := scheme.ObjectPrefix(logID, p.MassifHeight, storage.ObjectPathMassifs)
+	if err != nil {
+		return err
+	}
+	checkpointPrefix, err := scheme.ObjectPrefix(logID, p.MassifHeight, storage.ObjectPathCheckpoints)
+	if err != nil {
+		return err
+	}
+	p.logID = logID
+	p.massifDir = filepath.Join(p.Root, filepath.FromSlash(massifPrefix))
+	p.checkpointDir = filepath.Join(p.Root, filepath.FromSlash(checkpointPrefix))
+	return nil
+}
+
+func (p *DirProber) dir(otype storage.ObjectType) (string, error) {
+	if p.massifDir == "" {
+		return "", storage.ErrLogNotSelected
+	}
+	switch otype {
+	case storage.ObjectMassifData, storage.ObjectMassifStart:
+		return p.massifDir, nil
+	case storage.ObjectCheckpoint:
+		return p.checkpointDir, nil
+	default:
+		return "", fmt.Errorf("%w: object type %v", storage.ErrUnsupportedCap, otype)
+	}
+}
+
+// HeadIndex lists the log directory for otype, no files are opened.
+func (p *DirProber) HeadIndex(ctx context.Context, otype storage.ObjectType) (uint32, error) {
+	dir, err := p.dir(otype)
+	if err != nil {
+		return 0, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+	if otype == storage.ObjectMassifStart {
+		otype = storage.ObjectMassifData
+	}
+	var head uint32
+	found := false
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		got, massifIndex, err := storage.ObjectIndexFromPath(entry.Name())
+		if err != nil || got != otype {
+			continue
+		}
+		head = max(head, massifIndex)
+		found = true
+	}
+	if !found {
+		if otype == storage.ObjectCheckpoint {
+			return 0, storage.NewNotFoundError(p.logID, otype, storage.HeadMassifIndex)
+		}
+		return 0, storage.NewLogEmptyError(p.logID)
+	}
+	return head, nil
+}
+
+// List lists the log directory for otype, no files are opened.
+func (p *DirProber) List(ctx context.Context, otype storage.ObjectType, fromIndex uint32, limit int) (ObjectPage, error) {
+	otype, err := listObjectType(otype)
+	if err != nil {
+		return ObjectPage{}, err
+	}
+	dir, err := p.dir(otype)
+	if err != nil {
+		return ObjectPage{}, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return ObjectPage{}, err
+	}
+	var indices []uint32
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		got, massifIndex, err := storage.ObjectIndexFromPath(entry.Name())
+		if err != nil || got != otype {
+			continue
+		}
+		indices = append(indices, massifIndex)
+	}
+	slices.Sort(indices)
+	return pageIndices(indices, otype, fromIndex, limit), nil
+}
+
+func (p *DirProber) Stat(ctx context.Context, massifIndex uint32, otype storage.ObjectType) (ObjectInfo, error) {
+	dir, err := p.dir(otype)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	var name string
+	if otype == storage.ObjectCheckpoint {
+		name = storage.FmtCheckpointPath("", massifIndex)
+	} else {
+		name = storage.FmtMassifPath("", massifIndex)
+	}
+	info, err := statFile(filepath.Join(dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return ObjectInfo{}, storage.NewNotFoundError(p.logID, otype, massifIndex)
+	}
+	return info, err
+}
+
+func statFile(path string) (ObjectInfo, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Size: fi.Size(), LastModified: fi.ModTime()}, nil
+}
@@ -0,0 +1,88 @@
+package massifs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbe_DirProber(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	const height = 3
+
+	writeObject := func(logID storage.LogID, otype storage.ObjectType, massifIndex uint32, modified time.Time) {
+		prefix, err := storage.StorageObjectPrefixWithHeight(logID, height, otype)
+		require.NoError(t, err)
+		base := storage.V2MerklelogMassifsPrefix
+		if otype == storage.ObjectCheckpoint {
+			base = storage.V2MerklelogCheckpointsPrefix
+		}
+		path, err := storage.ObjectPath(filepath.Join(root, base, prefix)+"/", logID, massifIndex, otype)
+		require.NoError(t, err)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte("content is never read"), 0o644))
+		require.NoError(t, os.Chtimes(path, modified, modified))
+	}
+
+	sealedLog := uuid.New()
+	unsealedLog := uuid.New()
+	missingLog := uuid.New()
+
+	t0 := time.Unix(1700000000, 0)
+	writeObject(sealedLog[:], storage.ObjectMassifData, 0, t0)
+	writeObject(sealedLog[:], storage.ObjectMassifData, 1, t0.Add(2*time.Minute))
+	writeObject(sealedLog[:], storage.ObjectCheckpoint, 0, t0.Add(time.Minute))
+	writeObject(unsealedLog[:], storage.ObjectMassifData, 0, t0)
+
+	prober := &DirProber{Root: root, MassifHeight: height}
+
+	probe, err := Probe(ctx, prober, sealedLog[:])
+	require.NoError(t, err)
+	require.Equal(t, LogProbe{
+		Exists:                 true,
+		MassifIndex:            1,
+		MassifLastModified:     t0.Add(2 * time.Minute),
+		HasCheckpoint:          true,
+		CheckpointIndex:        0,
+		CheckpointLastModified: t0.Add(time.Minute),
+	}, probe)
+
+	probe, err = Probe(ctx, prober, unsealedLog[:])
+	require.NoError(t, err)
+	require.True(t, probe.Exists)
+	require.False(t, probe.HasCheckpoint)
+
+	probe, err = Probe(ctx, prober, missingLog[:])
+	require.NoError(t, err)
+	require.Equal(t, LogProbe{}, probe)
+}
+
+func TestDirReader_Stat(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, storage.FmtMassifPath("", 0))
+	require.NoError(t, os.WriteFile(path, make([]byte, 10), 0o644))
+	reader, err := NewDirReader(dir)
+	require.NoError(t, err)
+
+	info, err := reader.Stat(context.Background(), 0, storage.ObjectMassifData)
+	require.NoError(t, err)
+	require.Equal(t, int64(10), info.Size)
+
+	_, err = reader.Stat(context.Background(), 0, storage.ObjectCheckpoint)
+	require.ErrorIs(t, err, storage.ErrDoesNotExist)
+	var notFound *storage.NotFoundError
+	require.ErrorAs(t, err, &notFound)
+	require.Equal(t, storage.ObjectCheckpoint, notFound.Type)
+
+	_, err = GetMassifContext(context.Background(), reader, 1)
+	require.ErrorAs(t, err, &notFound)
+	require.Equal(t, storage.ObjectMassifData, notFound.Type)
+	require.Equal(t, uint32(1), notFound.MassifIndex)
+}
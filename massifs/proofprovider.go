@@ -0,0 +1,231 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/veraison/go-cose"
+)
+
+// ProofContentType is the content type of the proof service responses. The
+// inclusion proof is a CBOR array of byte strings, the consistency proof is
+// as EncodeConsistencyProof, and the receipt is the COSE Receipt.
+const ProofContentType = "application/cbor"
+
+var ErrProofService = errors.New("the proof service request failed")
+
+// ProofProvider produces proofs over a log. Applications which depend on the
+// interface can verify against a local replica, with LocalProofProvider, or
+// delegate to a proof service, with HTTPProofProvider, without code changes.
+// Either way the proofs are verified by the caller, against an accumulator it
+// trusts, so a delegated provider need not be trusted.
+type ProofProvider interface {
+	// GetInclusionProof returns the inclusion path of mmrIndex in the mmr of
+	// mmrSize nodes.
+	GetInclusionProof(ctx context.Context, mmrIndex uint64, mmrSize uint64) ([][]byte, error)
+	// GetConsistencyProof returns the proof that MMR(toSize) extends
+	// MMR(fromSize), see BuildConsistencyProof.
+	GetConsistencyProof(ctx context.Context, fromSize uint64, toSize uint64) (ConsistencyProof, error)
+	// GetReceipt returns the encoded COSE Receipt of inclusion for mmrIndex,
+	// see NewReceipt.
+	GetReceipt(ctx context.Context, mmrIndex uint64) ([]byte, error)
+}
+
+// LocalProofProvider is the ProofProvider over a replica of the log, such as
+// a DirReader over a directory kept up to date by the replicator.
+type LocalProofProvider struct {
+	reader       ObjectReader
+	verifier     cose.Verifier
+	massifHeight uint8
+}
+
+// NewLocalProofProvider returns a provider reading the log from reader. The
+// verifier is used to verify the massif a receipt is minted from against its
+// checkpoint.
+func NewLocalProofProvider(reader ObjectReader, verifier cose.Verifier, massifHeight uint8) *LocalProofProvider {
+	return &LocalProofProvider{reader: reader, verifier: verifier, massifHeight: massifHeight}
+}
+
+func (p *LocalProofProvider) GetInclusionProof(ctx context.Context, mmrIndex uint64, mmrSize uint64) ([][]byte, error) {
+	if mmrSize == 0 || mmrIndex >= mmrSize {
+		return nil, fmt.Errorf("mmr index %d is not in MMR(%d)", mmrIndex, mmrSize)
+	}
+	return mmr.InclusionProof(newLogNodeStore(ctx, p.reader), mmrSize-1, mmrIndex)
+}
+
+func (p *LocalProofProvider) GetConsistencyProof(ctx context.Context, fromSize uint64, toSize uint64) (ConsistencyProof, error) {
+	return BuildConsistencyProof(newLogNodeStore(ctx, p.reader), fromSize, toSize)
+}
+
+func (p *LocalProofProvider) GetReceipt(ctx context.Context, mmrIndex uint64) ([]byte, error) {
+	receipt, err := NewReceipt(ctx, p.reader, p.verifier, p.massifHeight, mmrIndex)
+	if err != nil {
+		return nil, err
+	}
+	return receipt.MarshalCBOR()
+}
+
+// HTTPProofProvider is the ProofProvider delegating to a proof service, such
+// as one serving NewProofHandler. The service is asked for
+//
+//	GET {BaseURL}/inclusion/{mmrIndex}?size={mmrSize}
+//	GET {BaseURL}/consistency/{fromSize}/{toSize}
+//	GET {BaseURL}/receipt/{mmrIndex}
+type HTTPProofProvider struct {
+	BaseURL string
+	// Client defaults to http.DefaultClient
+	Client *http.Client
+}
+
+// NewHTTPProofProvider returns a provider for the service at baseURL
+func NewHTTPProofProvider(baseURL string, client *http.Client) *HTTPProofProvider {
+	return &HTTPProofProvider{BaseURL: baseURL, Client: client}
+}
+
+func (p *HTTPProofProvider) GetInclusionProof(ctx context.Context, mmrIndex uint64, mmrSize uint64) ([][]byte, error) {
+	query := url.Values{"size": {strconv.FormatUint(mmrSize, 10)}}
+	data, err := p.get(ctx, fmt.Sprintf("inclusion/%d", mmrIndex), query)
+	if err != nil {
+		return nil, err
+	}
+	var proof [][]byte
+	if err := cbor.Unmarshal(data, &proof); err != nil {
+		return nil, fmt.Errorf("%w: decode inclusion proof: %v", ErrProofService, err)
+	}
+	return proof, nil
+}
+
+func (p *HTTPProofProvider) GetConsistencyProof(ctx context.Context, fromSize uint64, toSize uint64) (ConsistencyProof, error) {
+	data, err := p.get(ctx, fmt.Sprintf("consistency/%d/%d", fromSize, toSize), nil)
+	if err != nil {
+		return ConsistencyProof{}, err
+	}
+	proof, err := DecodeConsistencyProof(data)
+	if err != nil {
+		return ConsistencyProof{}, fmt.Errorf("%w: %v", ErrProofService, err)
+	}
+	return proof, nil
+}
+
+func (p *HTTPProofProvider) GetReceipt(ctx context.Context, mmrIndex uint64) ([]byte, error) {
+	return p.get(ctx, fmt.Sprintf("receipt/%d", mmrIndex), nil)
+}
+
+// get reads the response body of a successful request. A not found response
+// wraps storage.ErrDoesNotExist, so storage.IsNotFound behaves as it does for
+// a local provider.
+func (p *HTTPProofProvider) get(ctx context.Context, path string, query url.Values) ([]byte, error) {
+	target := strings.TrimSuffix(p.BaseURL, "/") + "/" + path
+	if len(query) != 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", ProofContentType)
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrProofService, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrProofService, err)
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return data, nil
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %s: %w", ErrProofService, path, storage.ErrDoesNotExist)
+	default:
+		return nil, fmt.Errorf("%w: %s: %s: %s",
+			ErrProofService, path, resp.Status, bytes.TrimSpace(data))
+	}
+}
+
+// NewProofHandler serves the requests of HTTPProofProvider from provider,
+// typically a LocalProofProvider. Mount it with http.StripPrefix if the
+// service base URL has a path.
+func NewProofHandler(provider ProofProvider) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /inclusion/{index}", func(w http.ResponseWriter, r *http.Request) {
+		index, err1 := strconv.ParseUint(r.PathValue("index"), 10, 64)
+		size, err2 := strconv.ParseUint(r.URL.Query().Get("size"), 10, 64)
+		if err := errors.Join(err1, err2); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		proof, err := provider.GetInclusionProof(r.Context(), index, size)
+		if err != nil {
+			writeProofError(w, err)
+			return
+		}
+		data, err := canonicalReceiptCBOR.Marshal(proof)
+		if err != nil {
+			writeProofError(w, err)
+			return
+		}
+		writeProof(w, data)
+	})
+	mux.HandleFunc("GET /consistency/{from}/{to}", func(w http.ResponseWriter, r *http.Request) {
+		from, err1 := strconv.ParseUint(r.PathValue("from"), 10, 64)
+		to, err2 := strconv.ParseUint(r.PathValue("to"), 10, 64)
+		if err := errors.Join(err1, err2); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		proof, err := provider.GetConsistencyProof(r.Context(), from, to)
+		if err != nil {
+			writeProofError(w, err)
+			return
+		}
+		data, err := EncodeConsistencyProof(proof)
+		if err != nil {
+			writeProofError(w, err)
+			return
+		}
+		writeProof(w, data)
+	})
+	mux.HandleFunc("GET /receipt/{index}", func(w http.ResponseWriter, r *http.Request) {
+		index, err := strconv.ParseUint(r.PathValue("index"), 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, err := provider.GetReceipt(r.Context(), index)
+		if err != nil {
+			writeProofError(w, err)
+			return
+		}
+		writeProof(w, data)
+	})
+	return mux
+}
+
+func writeProof(w http.ResponseWriter, data []byte) {
+	w.Header().Set("Content-Type", ProofContentType)
+	_, _ = w.Write(data)
+}
+
+func writeProofError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if storage.IsNotFound(err) {
+		status = http.StatusNotFound
+	}
+	http.Error(w, err.Error(), status)
+}
@@ -0,0 +1,95 @@
+package massifs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"net/http/httptest"
+	"testing"
+
+	commoncbor "github.com/forestrie/go-merklelog/massifs/cbor"
+	commoncose "github.com/forestrie/go-merklelog/massifs/cose"
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProofProviderLocalAndRemoteAgree(t *testing.T) {
+	ctx := context.Background()
+	store, verifier := buildSealedLog(t, 3, 11)
+	head, err := GetMassifContext(ctx, store, 2)
+	require.NoError(t, err)
+	mmrSize := head.RangeCount()
+
+	local := NewLocalProofProvider(store, verifier, 3)
+	server := httptest.NewServer(NewProofHandler(local))
+	defer server.Close()
+	remote := NewHTTPProofProvider(server.URL, server.Client())
+
+	for _, provider := range []ProofProvider{local, remote} {
+		// the proofs span massifs
+		for _, mmrIndex := range []uint64{0, 4, 7, 10, mmrSize - 1} {
+			proof, err := provider.GetInclusionProof(ctx, mmrIndex, mmrSize)
+			require.NoError(t, err)
+			value, err := newLogNodeStore(ctx, store).Get(mmrIndex)
+			require.NoError(t, err)
+			ok, err := mmr.VerifyInclusion(&head, sha256.New(), mmrSize, value, mmrIndex, proof)
+			require.NoError(t, err)
+			require.True(t, ok)
+		}
+		_, err = provider.GetInclusionProof(ctx, mmrSize, mmrSize)
+		require.Error(t, err)
+	}
+
+	first, err := GetMassifContext(ctx, store, 0)
+	require.NoError(t, err)
+	want, err := local.GetConsistencyProof(ctx, first.RangeCount(), mmrSize)
+	require.NoError(t, err)
+	got, err := remote.GetConsistencyProof(ctx, first.RangeCount(), mmrSize)
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	_, err = remote.GetConsistencyProof(ctx, mmrSize, first.RangeCount())
+	require.ErrorIs(t, err, ErrProofService)
+}
+
+func TestProofProviderReceipt(t *testing.T) {
+	ctx := context.Background()
+	mc := buildLegacyBlobMassif0(t, 1, 3, 3)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer := commoncose.NewTestCoseSigner(t, *key)
+	verifier := newES256Verifier(t, &key.PublicKey)
+	proof, err := BuildConsistencyProof(&mc, 0, mc.RangeCount())
+	require.NoError(t, err)
+	accumulator, err := mmr.PeakHashes(&mc, mc.RangeCount()-1)
+	require.NoError(t, err)
+	signed, err := SignCheckpointReceipt(signer, proof, accumulator, WithPeakReceipts([]byte("log-key-1")))
+	require.NoError(t, err)
+	store := newMemStore(mc.Data, signed)
+
+	local := NewLocalProofProvider(store, verifier, 3)
+	server := httptest.NewServer(NewProofHandler(local))
+	defer server.Close()
+	remote := NewHTTPProofProvider(server.URL+"/", nil)
+
+	candidate, err := mc.Get(1)
+	require.NoError(t, err)
+	for _, provider := range []ProofProvider{local, remote} {
+		encoded, err := provider.GetReceipt(ctx, 1)
+		require.NoError(t, err)
+		decoded, err := commoncose.NewCoseSign1MessageFromCBOR(
+			encoded, commoncose.WithDecOptions(commoncbor.DecOptions))
+		require.NoError(t, err)
+		ok, _, err := VerifySignedInclusionReceipt(ctx, decoded, verifier, candidate)
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		// a massif which does not exist is not found, locally or remotely
+		_, err = provider.GetReceipt(ctx, 1000)
+		require.True(t, storage.IsNotFound(err), "%v", err)
+	}
+}
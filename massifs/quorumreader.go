@@ -0,0 +1,275 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+)
+
+var (
+	ErrQuorumNotMet  = errors.New("too few storage backends agreed on the object")
+	ErrQuorumInvalid = errors.New("the quorum must be between one and the number of backends")
+)
+
+// QuorumResponse is the outcome of reading an object from one backend.
+type QuorumResponse struct {
+	Backend int
+	// Length and SHA256 describe the data read, they are zero if Err is set
+	Length int
+	SHA256 []byte
+	Err    error
+}
+
+// QuorumError is returned by QuorumReader when fewer than the required number
+// of backends agree. Responses has the outcome from every backend, so the
+// divergent or failing replicas can be identified.
+type QuorumError struct {
+	MassifIndex uint32
+	Type        storage.ObjectType
+	Required    int
+	// Matched is the size of the largest group of backends that agreed
+	Matched   int
+	Responses []QuorumResponse
+}
+
+func (e *QuorumError) Error() string {
+	details := make([]string, len(e.Responses))
+	for i, r := range e.Responses {
+		if r.Err != nil {
+			details[i] = fmt.Sprintf("backend %d: %v", r.Backend, r.Err)
+			continue
+		}
+		details[i] = fmt.Sprintf("backend %d: %d bytes sha256 %x", r.Backend, r.Length, r.SHA256)
+	}
+	return fmt.Sprintf("%v: massif %d %v, %d of %d required agreed (%s)",
+		ErrQuorumNotMet, e.MassifIndex, e.Type, e.Matched, e.Required, strings.Join(details, "; "))
+}
+
+func (e *QuorumError) Unwrap() error {
+	return ErrQuorumNotMet
+}
+
+// QuorumReader is an ObjectReader which reads every object from all of its
+// backends, replicas of the same log, and only returns content that at least
+// Required of them agree on exactly. Agreement that an object does not exist
+// also counts, so a log missing from a quorum of replicas reads as not found.
+// Any other backend error counts as a disagreement.
+//
+// A massif still being appended to can be read at different sizes from
+// replicas that are moments apart. Reads of such a massif fail the quorum
+// until the replicas catch up, and should be retried.
+//
+// Agreed objects are cached for the life of the reader.
+type QuorumReader struct {
+	Backends []ObjectReader
+	Required int
+
+	mu          sync.Mutex
+	massifs     map[uint32][]byte
+	checkpoints map[uint32][]byte
+}
+
+// NewQuorumReader returns a reader requiring required of the backends to
+// agree.
+func NewQuorumReader(required int, backends ...ObjectReader) (*QuorumReader, error) {
+	if required < 1 || required > len(backends) {
+		return nil, fmt.Errorf("%w: %d of %d", ErrQuorumInvalid, required, len(backends))
+	}
+	return &QuorumReader{
+		Backends:    backends,
+		Required:    required,
+		massifs:     map[uint32][]byte{},
+		checkpoints: map[uint32][]byte{},
+	}, nil
+}
+
+// HeadIndex returns the highest massif index held by at least Required of
+// the backends. Replicas which lag do not prevent the quorum, provided enough
+// of them have caught up.
+func (r *QuorumReader) HeadIndex(ctx context.Context, otype storage.ObjectType) (uint32, error) {
+	heads := make([]uint32, len(r.Backends))
+	errs := make([]error, len(r.Backends))
+	var wg sync.WaitGroup
+	for i, backend := range r.Backends {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			heads[i], errs[i] = backend.HeadIndex(ctx, otype)
+		}()
+	}
+	wg.Wait()
+
+	var found []uint32
+	var notFound []error
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			found = append(found, heads[i])
+		case storage.IsNotFound(err):
+			notFound = append(notFound, err)
+		}
+	}
+	if len(found) >= r.Required {
+		sort.Slice(found, func(i, j int) bool { return found[i] > found[j] })
+		return found[r.Required-1], nil
+	}
+	if len(notFound) >= r.Required {
+		return 0, notFound[0]
+	}
+	responses := make([]QuorumResponse, len(r.Backends))
+	for i := range r.Backends {
+		responses[i] = QuorumResponse{Backend: i, Err: errs[i]}
+	}
+	return 0, &QuorumError{
+		MassifIndex: storage.HeadMassifIndex, Type: otype, Required: r.Required,
+		Matched: max(len(found), len(notFound)), Responses: responses,
+	}
+}
+
+// List returns the indices listed by at least Required of the backends. Every
+// backend must be an ObjectLister. Each lists everything from fromIndex, the
+// limit is applied to the agreed indices.
+func (r *QuorumReader) List(ctx context.Context, otype storage.ObjectType, fromIndex uint32, limit int) (ObjectPage, error) {
+	otype, err := listObjectType(otype)
+	if err != nil {
+		return ObjectPage{}, err
+	}
+	counts := map[uint32]int{}
+	for i, backend := range r.Backends {
+		lister, ok := backend.(ObjectLister)
+		if !ok {
+			return ObjectPage{}, fmt.Errorf("%w: backend %d can not list objects", storage.ErrUnsupportedCap, i)
+		}
+		page, err := lister.List(ctx, otype, fromIndex, 0)
+		if err != nil {
+			return ObjectPage{}, fmt.Errorf("backend %d: %w", i, err)
+		}
+		for _, massifIndex := range page.Indices {
+			counts[massifIndex]++
+		}
+	}
+	var agreed []uint32
+	for massifIndex, n := range counts {
+		if n >= r.Required {
+			agreed = append(agreed, massifIndex)
+		}
+	}
+	slices.Sort(agreed)
+	return pageIndices(agreed, otype, fromIndex, limit), nil
+}
+
+// MassifData returns the agreed massif data, or nil if it has not been read
+// yet.
+func (r *QuorumReader) MassifData(massifIndex uint32) ([]byte, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	data, ok := r.massifs[massifIndex]
+	return data, ok, nil
+}
+
+// CheckpointData returns the agreed checkpoint data, or nil if it has not been
+// read yet.
+func (r *QuorumReader) CheckpointData(massifIndex uint32) ([]byte, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	data, ok := r.checkpoints[massifIndex]
+	return data, ok, nil
+}
+
+func (r *QuorumReader) MassifReadN(ctx context.Context, massifIndex uint32, n int) ([]byte, error) {
+	data, err := r.read(massifIndex, storage.ObjectMassifData, func(backend ObjectReader) ([]byte, error) {
+		return backend.MassifReadN(ctx, massifIndex, n)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// only complete reads are cached, MassifData must not return a prefix
+	if n < 0 {
+		r.mu.Lock()
+		r.massifs[massifIndex] = data
+		r.mu.Unlock()
+	}
+	return data, nil
+}
+
+func (r *QuorumReader) CheckpointRead(ctx context.Context, massifIndex uint32) ([]byte, error) {
+	data, err := r.read(massifIndex, storage.ObjectCheckpoint, func(backend ObjectReader) ([]byte, error) {
+		return backend.CheckpointRead(ctx, massifIndex)
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	r.checkpoints[massifIndex] = data
+	r.mu.Unlock()
+	return data, nil
+}
+
+// read reads the object from every backend and returns the content at least
+// Required of them agree on. If enough agree the object is not found, the
+// first of their errors is returned.
+func (r *QuorumReader) read(
+	massifIndex uint32, otype storage.ObjectType, readFn func(ObjectReader) ([]byte, error),
+) ([]byte, error) {
+	datas := make([][]byte, len(r.Backends))
+	responses := make([]QuorumResponse, len(r.Backends))
+	var wg sync.WaitGroup
+	for i, backend := range r.Backends {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, err := readFn(backend)
+			responses[i] = QuorumResponse{Backend: i, Err: err}
+			if err != nil {
+				return
+			}
+			sum := sha256.Sum256(data)
+			datas[i] = data
+			responses[i].Length = len(data)
+			responses[i].SHA256 = sum[:]
+		}()
+	}
+	wg.Wait()
+
+	// group the backends by content hash, all not found responses agree
+	var groups [][]int
+	var notFound []int
+	for i, resp := range responses {
+		if resp.Err != nil {
+			if storage.IsNotFound(resp.Err) {
+				notFound = append(notFound, i)
+			}
+			continue
+		}
+		g := slices.IndexFunc(groups, func(group []int) bool {
+			return bytes.Equal(responses[group[0]].SHA256, resp.SHA256)
+		})
+		if g < 0 {
+			groups = append(groups, []int{i})
+			continue
+		}
+		groups[g] = append(groups[g], i)
+	}
+
+	matched := len(notFound)
+	for _, group := range groups {
+		if len(group) >= r.Required {
+			return datas[group[0]], nil
+		}
+		matched = max(matched, len(group))
+	}
+	if len(notFound) >= r.Required {
+		return nil, responses[notFound[0]].Err
+	}
+	return nil, &QuorumError{
+		MassifIndex: massifIndex, Type: otype, Required: r.Required, Matched: matched, Responses: responses,
+	}
+}
@@ -0,0 +1,97 @@
+package massifs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"maps"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/stretchr/testify/require"
+)
+
+// cloneMemStore returns an independent replica of the store
+func cloneMemStore(src *memStore) *memStore {
+	dst := newMemStore(nil, nil)
+	for i, data := range src.massifs {
+		dst.massifs[i] = append([]byte(nil), data...)
+	}
+	maps.Copy(dst.checkpoint, src.checkpoint)
+	return dst
+}
+
+func TestQuorumReader(t *testing.T) {
+	ctx := context.Background()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	verifier := newES256Verifier(t, &key.PublicKey)
+	a := buildSealedLogWithKey(t, key, 3, 9)
+	b, c := cloneMemStore(a), cloneMemStore(a)
+
+	// replica c has a corrupted node in massif 1
+	c.massifs[1][len(c.massifs[1])-1] ^= 0x01
+
+	r, err := NewQuorumReader(2, a, b, c)
+	require.NoError(t, err)
+	for massifIndex := range uint32(3) {
+		_, err = GetContextVerified(ctx, r, verifier, massifIndex)
+		require.NoError(t, err)
+	}
+
+	r, err = NewQuorumReader(3, a, b, c)
+	require.NoError(t, err)
+	_, err = GetContextVerified(ctx, r, verifier, 0)
+	require.NoError(t, err)
+	_, err = GetContextVerified(ctx, r, verifier, 1)
+	require.ErrorIs(t, err, ErrQuorumNotMet)
+	var quorumErr *QuorumError
+	require.True(t, errors.As(err, &quorumErr))
+	require.Equal(t, uint32(1), quorumErr.MassifIndex)
+	require.Equal(t, storage.ObjectMassifData, quorumErr.Type)
+	require.Equal(t, 2, quorumErr.Matched)
+	require.Len(t, quorumErr.Responses, 3)
+	require.Equal(t, quorumErr.Responses[0].SHA256, quorumErr.Responses[1].SHA256)
+	require.NotEqual(t, quorumErr.Responses[0].SHA256, quorumErr.Responses[2].SHA256)
+
+	_, err = NewQuorumReader(4, a, b, c)
+	require.ErrorIs(t, err, ErrQuorumInvalid)
+	_, err = NewQuorumReader(0, a)
+	require.ErrorIs(t, err, ErrQuorumInvalid)
+}
+
+func TestQuorumReaderHeadAndNotFound(t *testing.T) {
+	ctx := context.Background()
+	a, _ := buildSealedLog(t, 3, 9)
+	b := cloneMemStore(a)
+	// replica c lags a massif behind
+	c := cloneMemStore(a)
+	delete(c.massifs, 2)
+	delete(c.checkpoint, 2)
+
+	r, err := NewQuorumReader(2, a, b, c)
+	require.NoError(t, err)
+	head, err := r.HeadIndex(ctx, storage.ObjectMassifData)
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), head)
+
+	r, err = NewQuorumReader(3, a, b, c)
+	require.NoError(t, err)
+	head, err = r.HeadIndex(ctx, storage.ObjectMassifData)
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), head)
+
+	// absence agreed by a quorum is reported as not found
+	r, err = NewQuorumReader(2, a, b, c)
+	require.NoError(t, err)
+	_, err = r.MassifReadN(ctx, 7, -1)
+	require.True(t, storage.IsNotFound(err))
+
+	empty := []ObjectReader{newMemStore(nil, nil), newMemStore(nil, nil), a}
+	r, err = NewQuorumReader(2, empty...)
+	require.NoError(t, err)
+	_, err = r.HeadIndex(ctx, storage.ObjectMassifData)
+	require.ErrorIs(t, err, storage.ErrLogEmpty)
+}
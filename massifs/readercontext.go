@@ -0,0 +1,157 @@
+package massifs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/forestrie/go-merklelog/mmr"
+)
+
+// ReaderContext is an immutable, read only, view of a massif. Unlike
+// MassifContext, whose methods maintain internal state for the benefit of
+// appends, every ReaderContext method is safe to call from any number of
+// goroutines at once. Services can share one ReaderContext per massif across
+// their request handlers.
+//
+// The context owns a private copy of the massif data, and every value it
+// returns is a copy, so neither the caller's buffer nor a returned value can
+// be used to change what other goroutines see.
+type ReaderContext struct {
+	start MassifStart
+	data  []byte
+	// peakStackMap is never modified after construction
+	peakStackMap map[uint64]int
+}
+
+// VerifiedState is the outcome of ReaderContext.Verify, it has the same
+// meaning as the corresponding VerifiedContext fields.
+type VerifiedState struct {
+	Checkpoint      Checkpoint
+	Accumulator     [][]byte
+	ConsistentRoots [][]byte
+}
+
+// NewReaderContext creates a reader context over a copy of the massif data.
+// The data is checked, and limited to its committed length, exactly as it is
+// by GetMassifContext.
+func NewReaderContext(data []byte) (*ReaderContext, error) {
+	owned := append([]byte(nil), data...)
+	mc, err := newStoredMassifContext(owned)
+	if err != nil {
+		return nil, err
+	}
+	peakStackMap := PeakStackMap(mc.Start.MassifHeight, mc.Start.FirstIndex)
+	if peakStackMap == nil {
+		return nil, fmt.Errorf("invalid massif height or first index in start record")
+	}
+	return &ReaderContext{
+		start: mc.Start,
+		// the capacity is capped, so not even an append to a view can write to
+		// the shared data
+		data:         mc.Data[:len(mc.Data):len(mc.Data)],
+		peakStackMap: peakStackMap,
+	}, nil
+}
+
+// GetReaderContext reads the complete massif and returns a reader context for
+// it.
+func GetReaderContext(ctx context.Context, reader ObjectReader, massifIndex uint32) (*ReaderContext, error) {
+	data, err := GetMassifData(ctx, reader, massifIndex)
+	if err != nil {
+		return nil, err
+	}
+	return NewReaderContext(data)
+}
+
+// ReaderContext returns an immutable snapshot of the context, see
+// ReaderContext.
+func (mc *MassifContext) ReaderContext() (*ReaderContext, error) {
+	return NewReaderContext(mc.Data)
+}
+
+// view returns a MassifContext over the shared data. The peak stack map is
+// set, so reads never touch the append state. It is only used internally, by
+// methods that don't write to the context or leak its buffers.
+func (rc *ReaderContext) view() MassifContext {
+	return MassifContext{
+		MassifData:   MassifData{Data: rc.data},
+		Start:        rc.start,
+		PeakStackMap: rc.peakStackMap,
+	}
+}
+
+func (rc *ReaderContext) Start() MassifStart {
+	return rc.start
+}
+
+// Count returns the number of log entries in the massif
+func (rc *ReaderContext) Count() uint64 {
+	return rc.view().Count()
+}
+
+// RangeCount returns the mmr size at the end of the massif data
+func (rc *ReaderContext) RangeCount() uint64 {
+	return rc.view().RangeCount()
+}
+
+// MassifLeafCount returns the number of leaves in the massif
+func (rc *ReaderContext) MassifLeafCount() uint64 {
+	return rc.view().MassifLeafCount()
+}
+
+// LastIDTimestamp returns the idtimestamp of the last entry in the massif
+func (rc *ReaderContext) LastIDTimestamp() uint64 {
+	return rc.start.LastID
+}
+
+// Get returns a copy of the value for mmr index i. Indices before the massif
+// are available if they are in the ancestor peak stack. This satisfies the
+// store interface expected by the mmr package.
+func (rc *ReaderContext) Get(i uint64) ([]byte, error) {
+	mc := rc.view()
+	value, err := mc.Get(i)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), value...), nil
+}
+
+// InclusionProof returns the proof of inclusion for mmr index i in the mmr
+// identified by mmrLastIndex, which must be in this massif.
+func (rc *ReaderContext) InclusionProof(mmrLastIndex uint64, i uint64) ([][]byte, error) {
+	return mmr.InclusionProof(rc, mmrLastIndex, i)
+}
+
+// PeakHashes returns the accumulator for the mmr identified by mmrLastIndex
+func (rc *ReaderContext) PeakHashes(mmrLastIndex uint64) ([][]byte, error) {
+	return mmr.PeakHashes(rc, mmrLastIndex)
+}
+
+// Verify verifies the massif against a checkpoint, exactly as
+// MassifContext.VerifyContext does, but returns only the verified state. The
+// checkpoint must be provided with WithVerifyCheckpoint, and a verifier with
+// VerifyWithCOSEVerifier.
+func (rc *ReaderContext) Verify(ctx context.Context, opts ...Option) (*VerifiedState, error) {
+	options := VerifyOptions{}
+	if err := ApplyOptions(&options, opts...); err != nil {
+		return nil, err
+	}
+	mc := rc.view()
+	vc, err := mc.VerifyContext(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	return &VerifiedState{
+		Checkpoint:      vc.Checkpoint,
+		Accumulator:     copyValues(vc.Accumulator),
+		ConsistentRoots: copyValues(vc.ConsistentRoots),
+	}, nil
+}
+
+func copyValues(values [][]byte) [][]byte {
+	out := make([][]byte, len(values))
+	for i, v := range values {
+		out[i] = append([]byte(nil), v...)
+	}
+	return out
+}
@@ -0,0 +1,120 @@
+package massifs
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReaderContextConcurrentUse(t *testing.T) {
+	ctx := context.Background()
+	store, verifier := buildSealedLog(t, 3, 9)
+
+	// massif 2 has ancestors in the peak stack, so Get exercises the map
+	rc, err := GetReaderContext(ctx, store, 2)
+	require.NoError(t, err)
+	check, err := GetCheckpoint(ctx, store, 2)
+	require.NoError(t, err)
+
+	mc, err := GetMassifContext(ctx, store, 2)
+	require.NoError(t, err)
+	want, err := mc.VerifyContext(ctx, VerifyOptions{Check: &check, COSEVerifier: verifier})
+	require.NoError(t, err)
+
+	last := rc.RangeCount() - 1
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := rc.Start().FirstIndex; i <= last; i++ {
+				if mmr.IndexHeight(i) != 0 {
+					continue
+				}
+				proof, err := rc.InclusionProof(last, i)
+				if err != nil {
+					errs <- err
+					return
+				}
+				value, err := rc.Get(i)
+				if err != nil {
+					errs <- err
+					return
+				}
+				ok, err := mmr.VerifyInclusion(rc, sha256.New(), last+1, value, i, proof)
+				if !ok || err != nil {
+					errs <- fmt.Errorf("inclusion of %d: %v", i, err)
+					return
+				}
+			}
+			state, err := rc.Verify(ctx, WithVerifyCheckpoint(&check), VerifyWithCOSEVerifier(verifier))
+			if err != nil {
+				errs <- err
+				return
+			}
+			if !reflect.DeepEqual(want.Accumulator, state.Accumulator) ||
+				!reflect.DeepEqual(want.ConsistentRoots, state.ConsistentRoots) {
+				errs <- fmt.Errorf("verified state differs")
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+}
+
+func TestReaderContextIsolatedFromCaller(t *testing.T) {
+	ctx := context.Background()
+	store, _ := buildSealedLog(t, 3, 2)
+
+	mc, err := GetMassifContext(ctx, store, 0)
+	require.NoError(t, err)
+	rc, err := mc.ReaderContext()
+	require.NoError(t, err)
+
+	before, err := rc.Get(0)
+	require.NoError(t, err)
+
+	// Neither the source buffer nor a returned value alias the shared data
+	clear(mc.Data[mc.LogStart():])
+	before[0] ^= 0xff
+	after, err := rc.Get(0)
+	require.NoError(t, err)
+	require.NotEqual(t, before, after)
+	before[0] ^= 0xff
+	require.Equal(t, before, after)
+}
+
+func TestReaderContextChecksStoredData(t *testing.T) {
+	ctx := context.Background()
+	store, _ := buildSealedLog(t, 3, 6)
+	committed := store.massifs[1]
+	want, err := GetReaderContext(ctx, store, 1)
+	require.NoError(t, err)
+
+	// part of a commit in progress is not seen
+	partial := append(append([]byte(nil), committed...), make([]byte, ValueBytes+7)...)
+	rc, err := NewReaderContext(partial)
+	require.NoError(t, err)
+	require.Equal(t, want.RangeCount(), rc.RangeCount())
+	store.massifs[1] = partial
+	rc, err = GetReaderContext(ctx, store, 1)
+	require.NoError(t, err)
+	require.Equal(t, want.RangeCount(), rc.RangeCount())
+	store.massifs[1] = committed
+
+	// nor are the offsets of a corrupt header trusted
+	corrupt := append([]byte(nil), committed...)
+	corrupt[MassifStartKeyMassifHeightFirstByte] = 12
+	_, err = NewReaderContext(corrupt)
+	require.ErrorIs(t, err, ErrRegionBounds)
+}
@@ -0,0 +1,68 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadOnlyVerifiedContext(t *testing.T) {
+	ctx := context.Background()
+	store, verifier := buildSealedLog(t, 3, 3)
+
+	vc, err := GetContextVerified(ctx, store, verifier, 0, WithVerifyReadOnly())
+	require.NoError(t, err)
+	require.True(t, vc.ReadOnly)
+	verified := bytes.Clone(vc.Data)
+
+	leaf := sha256.Sum256([]byte("read-only-leaf"))
+	mutations := map[string]func(mc *MassifContext) error{
+		"AddHashedLeaf": func(mc *MassifContext) error {
+			_, err := mc.AddHashedLeaf(sha256.New(), 100, nil, nil, nil, leaf[:])
+			return err
+		},
+		"Append": func(mc *MassifContext) error {
+			_, err := mc.Append(leaf[:])
+			return err
+		},
+		"InsertUrkleMonotone": func(mc *MassifContext) error {
+			_, err := mc.InsertUrkleMonotone(100, leaf[:])
+			return err
+		},
+		"UpdateBloomFilters": func(mc *MassifContext) error { return mc.UpdateBloomFilters(leaf[:]) },
+		"SetUrkleRootHash":   func(mc *MassifContext) error { return mc.SetUrkleRootHash(leaf[:]) },
+		"SetLastIDTimestamp": func(mc *MassifContext) error { return mc.SetLastIDTimestamp(100) },
+		"SetIndexCommitment": func(mc *MassifContext) error { return mc.SetIndexCommitment() },
+		"SetIntegrity":       func(mc *MassifContext) error { return mc.SetIntegrity() },
+		"SetStats":           func(mc *MassifContext) error { return mc.SetStats(MassifStats{}) },
+		"UpdateTrieEntriesExtra": func(mc *MassifContext) error {
+			return UpdateTrieEntriesExtra(mc, []TrieExtraUpdate{{LeafOrdinal: 0, Field: 2, Extra: []byte{1}}})
+		},
+		"setCommittedLength": func(mc *MassifContext) error { return mc.setCommittedLength() },
+		"CommitContext":      func(mc *MassifContext) error { return CommitContext(ctx, store, mc) },
+		"TruncateToSealedState": func(mc *MassifContext) error {
+			return TruncateToSealedState(mc, &Checkpoint{MMRSize: 1})
+		},
+	}
+	for name, mutate := range mutations {
+		require.ErrorIs(t, mutate(&vc.MassifContext), ErrMassifReadOnly, name)
+		require.Equal(t, verified, vc.Data, name)
+	}
+	require.Equal(t, verified, store.massifs[0])
+
+	// a writable copy can change, without changing the verified bytes
+	w := vc.Writable()
+	require.False(t, w.ReadOnly)
+	_, err = w.AddHashedLeaf(sha256.New(), 100, nil, nil, nil, leaf[:])
+	require.NoError(t, err)
+	require.NotEqual(t, verified, w.Data)
+	require.Equal(t, verified, vc.Data)
+
+	// by default verification leaves the context writable
+	vc, err = GetContextVerified(ctx, store, verifier, 0)
+	require.NoError(t, err)
+	require.False(t, vc.ReadOnly)
+}
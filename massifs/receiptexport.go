@@ -0,0 +1,135 @@
+package massifs
+
+import (
+	"context"
+	"fmt"
+
+	commoncbor "github.com/forestrie/go-merklelog/massifs/cbor"
+	commoncose "github.com/forestrie/go-merklelog/massifs/cose"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/veraison/go-cose"
+)
+
+// ReceiptSink receives each receipt minted by ExportMassifReceipts, encoded as
+// a COSE_Sign1, in ascending leaf order. Returning an error stops the export.
+type ReceiptSink func(leafIndex uint64, mmrIndex uint64, receipt []byte) error
+
+// ExportMassifReceipts mints a receipt of inclusion, as NewReceipt does, for
+// every leaf of the massif covered by its checkpoint, and passes each to the
+// sink. The massif is verified against the checkpoint once, and the proofs are
+// generated by a single walk down each peak, so every node value is read once
+// however many leaves share it. For a completed massif this is the receipt for
+// every leaf it holds.
+//
+// The checkpoint must carry pre-signed peak receipts, see WithPeakReceipts.
+// The options are those of GetContextVerified. Returns the count of receipts
+// passed to the sink.
+func ExportMassifReceipts(
+	ctx context.Context,
+	reader ObjectReader,
+	verifier cose.Verifier,
+	massifIndex uint32,
+	sink ReceiptSink,
+	opts ...Option,
+) (uint64, error) {
+	verified, err := GetContextVerified(ctx, reader, verifier, massifIndex, opts...)
+	if err != nil {
+		return 0, fmt.Errorf(
+			"%w: failed to get verified context %d", err, massifIndex)
+	}
+	check := verified.Checkpoint
+	if len(check.Receipt.PeakReceipts) == 0 {
+		return 0, fmt.Errorf(
+			"checkpoint for massif %d carries no pre-signed peak receipts (label %d)",
+			massifIndex, SealPeakReceiptsLabel)
+	}
+
+	peaks := mmr.Peaks(check.MMRSize - 1)
+	if len(peaks) != len(check.Receipt.PeakReceipts) {
+		return 0, fmt.Errorf(
+			"checkpoint for massif %d has %d peak receipts for %d peaks",
+			massifIndex, len(check.Receipt.PeakReceipts), len(peaks))
+	}
+
+	x := receiptExporter{
+		ctx:  ctx,
+		mc:   &verified.MassifContext,
+		sink: sink,
+	}
+	for i, peak := range peaks {
+		// peaks committing only earlier massifs have no leaves to export
+		if peak < x.mc.Start.FirstIndex {
+			continue
+		}
+		x.receipt, err = commoncose.NewCoseSign1MessageFromCBOR(
+			check.Receipt.PeakReceipts[i],
+			commoncose.WithDecOptions(commoncbor.DecOptions))
+		if err != nil {
+			return x.count, fmt.Errorf(
+				"%w: failed to decode pre-signed peak receipt %d of MMR(%d)",
+				err, i, check.MMRSize)
+		}
+		if err = x.descend(peak, mmr.IndexHeight(peak), nil); err != nil {
+			return x.count, err
+		}
+	}
+	return x.count, nil
+}
+
+// receiptExporter walks down a peak, accumulating the inclusion path from the
+// peak to each node it visits, so that the path above a node is shared by all
+// the leaves beneath it.
+type receiptExporter struct {
+	ctx     context.Context
+	mc      *MassifContext
+	sink    ReceiptSink
+	receipt *commoncose.CoseSign1Message
+	count   uint64
+}
+
+// descend exports the receipts for the leaves of the massif under node i.
+// path is the inclusion path of i in the peak, ordered from i upwards.
+func (x *receiptExporter) descend(i uint64, height uint64, path [][]byte) error {
+	// the subtree is entirely in earlier massifs
+	if i < x.mc.Start.FirstIndex {
+		return nil
+	}
+	if height == 0 {
+		return x.export(i, path)
+	}
+	if err := x.ctx.Err(); err != nil {
+		return err
+	}
+
+	left, right := i-(uint64(1)<<height), i-1
+	leftValue, err := x.mc.Get(left)
+	if err != nil {
+		return err
+	}
+	rightValue, err := x.mc.Get(right)
+	if err != nil {
+		return err
+	}
+	if err = x.descend(left, height-1, prependPath(rightValue, path)); err != nil {
+		return err
+	}
+	return x.descend(right, height-1, prependPath(leftValue, path))
+}
+
+func (x *receiptExporter) export(mmrIndex uint64, path [][]byte) error {
+	attachInclusionProof(x.receipt, mmrIndex, path)
+	encoded, err := x.receipt.MarshalCBOR()
+	if err != nil {
+		return fmt.Errorf("%w: failed to encode the receipt for mmr index %d", err, mmrIndex)
+	}
+	if err = x.sink(mmr.LeafIndex(mmrIndex), mmrIndex, encoded); err != nil {
+		return err
+	}
+	x.count++
+	return nil
+}
+
+// prependPath returns a new path, value followed by path
+func prependPath(value []byte, path [][]byte) [][]byte {
+	return append([][]byte{value}, path...)
+}
@@ -0,0 +1,115 @@
+package massifs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	commoncbor "github.com/forestrie/go-merklelog/massifs/cbor"
+	commoncose "github.com/forestrie/go-merklelog/massifs/cose"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+func TestExportMassifReceipts(t *testing.T) {
+	ctx := context.Background()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	verifier := newES256Verifier(t, &key.PublicKey)
+	signer, err := cose.NewSigner(cose.AlgorithmES256, key)
+	require.NoError(t, err)
+
+	// 11 leaves in massifs of 4, massif 2 is partial and has ancestor peaks
+	store := buildSealedLogWithKey(t, key, 3, 11)
+
+	for massifIndex := range uint32(3) {
+		// re-seal the massif with peak receipts
+		mc, err := GetMassifContext(ctx, store, massifIndex)
+		require.NoError(t, err)
+		fromSize := mc.Start.FirstIndex
+		if fromSize == 0 {
+			fromSize = 1
+		}
+		proof, err := BuildConsistencyProof(&mc, fromSize, mc.RangeCount())
+		require.NoError(t, err)
+		accumulator, err := mmr.PeakHashes(&mc, mc.RangeCount()-1)
+		require.NoError(t, err)
+		store.checkpoint[massifIndex], err = SignCheckpointReceipt(
+			signer, proof, accumulator, WithPeakReceipts([]byte("log-key-1")))
+		require.NoError(t, err)
+
+		var leaves []uint64
+		n, err := ExportMassifReceipts(ctx, store, verifier, massifIndex,
+			func(leafIndex uint64, mmrIndex uint64, receipt []byte) error {
+				require.Equal(t, leafIndex, mmr.LeafIndex(mmrIndex))
+				leaves = append(leaves, leafIndex)
+
+				want, err := mmr.InclusionProof(&mc, mc.RangeCount()-1, mmrIndex)
+				require.NoError(t, err)
+				decoded, err := commoncose.NewCoseSign1MessageFromCBOR(
+					receipt, commoncose.WithDecOptions(commoncbor.DecOptions))
+				require.NoError(t, err)
+				candidate, err := mc.Get(mmrIndex)
+				require.NoError(t, err)
+				ok, _, err := VerifySignedInclusionReceipt(ctx, decoded, verifier, candidate)
+				require.NoError(t, err, "receipt for mmr index %d", mmrIndex)
+				require.True(t, ok)
+
+				// the shared walk must produce exactly the proof NewReceipt would
+				single, err := NewReceipt(ctx, store, verifier, 3, mmrIndex)
+				require.NoError(t, err)
+				proofs := single.Headers.Unprotected[checkpointLabelVDP].(MMRiverVerifiableProofs)
+				require.Equal(t, want, proofs.InclusionProofs[0].InclusionPath)
+				encoded, err := single.MarshalCBOR()
+				require.NoError(t, err)
+				require.Equal(t, encoded, receipt)
+				return nil
+			})
+		require.NoError(t, err)
+
+		first := uint64(massifIndex) * 4
+		wantLeaves := []uint64{first, first + 1, first + 2, first + 3}
+		if massifIndex == 2 {
+			wantLeaves = wantLeaves[:3]
+		}
+		require.Equal(t, wantLeaves, leaves)
+		require.Equal(t, uint64(len(wantLeaves)), n)
+	}
+}
+
+func TestExportMassifReceiptsSinkError(t *testing.T) {
+	ctx := context.Background()
+	mc := buildLegacyBlobMassif0(t, 1, 3, 4)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer := commoncose.NewTestCoseSigner(t, *key)
+	verifier := newES256Verifier(t, &key.PublicKey)
+
+	proof, err := BuildConsistencyProof(&mc, 0, mc.RangeCount())
+	require.NoError(t, err)
+	accumulator, err := mmr.PeakHashes(&mc, mc.RangeCount()-1)
+	require.NoError(t, err)
+
+	signed, err := SignCheckpointReceipt(signer, proof, accumulator)
+	require.NoError(t, err)
+	_, err = ExportMassifReceipts(ctx, newMemStore(mc.Data, signed), verifier, 0,
+		func(uint64, uint64, []byte) error { return nil })
+	require.ErrorContains(t, err, "no pre-signed peak receipts")
+
+	signed, err = SignCheckpointReceipt(signer, proof, accumulator, WithPeakReceipts(nil))
+	require.NoError(t, err)
+	errStop := errors.New("stop")
+	n, err := ExportMassifReceipts(ctx, newMemStore(mc.Data, signed), verifier, 0,
+		func(leafIndex uint64, _ uint64, _ []byte) error {
+			if leafIndex == 2 {
+				return errStop
+			}
+			return nil
+		})
+	require.ErrorIs(t, err, errStop)
+	require.Equal(t, uint64(2), n)
+}
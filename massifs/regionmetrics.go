@@ -0,0 +1,98 @@
+package massifs
+
+import (
+	"sync"
+)
+
+// RegionCheckpoint names the checkpoint objects in RegionReadMetrics. It is
+// not a region of the massif data.
+const RegionCheckpoint = "checkpoint"
+
+// RegionReadCount is the reads of one region
+type RegionReadCount struct {
+	// Reads is the number of reads which included bytes of the region
+	Reads uint64
+	// Bytes is the number of bytes of the region read
+	Bytes uint64
+}
+
+// RegionReadMetrics accounts the bytes read from storage to the massif
+// regions they fall in, see MassifFormat. It shows what fraction of the
+// bandwidth goes to the index, and what fraction to the log nodes, which is
+// the measure needed to tune the massif height and the index formats.
+//
+// It is safe for concurrent use, and may be shared by several readers.
+type RegionReadMetrics struct {
+	mu      sync.Mutex
+	regions map[string]RegionReadCount
+}
+
+func NewRegionReadMetrics() *RegionReadMetrics {
+	return &RegionReadMetrics{regions: map[string]RegionReadCount{}}
+}
+
+// RecordMassifRead accounts a read of the first len(data) bytes of a massif.
+// The layout is taken from the start header in data. A read too short to
+// include it is accounted to the start header.
+func (m *RegionReadMetrics) RecordMassifRead(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	var ms MassifStart
+	var f MassifFormat
+	err := DecodeMassifStart(&ms, data)
+	if err == nil {
+		f, err = ms.Format()
+	}
+	if err != nil {
+		m.record(RegionStartHeader, uint64(len(data)))
+		return
+	}
+
+	n := uint64(len(data))
+	for _, r := range f.Regions {
+		if r.Offset >= n {
+			break
+		}
+		m.record(r.Name, min(r.End(), n)-r.Offset)
+	}
+	// Bytes past the size of a complete massif are accounted to the log
+	if size := f.Size(); n > size {
+		m.record(RegionLog, n-size)
+	}
+}
+
+// RecordCheckpointRead accounts a read of a checkpoint object of n bytes
+func (m *RegionReadMetrics) RecordCheckpointRead(n int) {
+	m.record(RegionCheckpoint, uint64(n))
+}
+
+func (m *RegionReadMetrics) record(region string, n uint64) {
+	if n == 0 {
+		return
+	}
+	m.mu.Lock()
+	c := m.regions[region]
+	c.Reads++
+	c.Bytes += n
+	m.regions[region] = c
+	m.mu.Unlock()
+}
+
+// Snapshot returns the reads of each region read so far
+func (m *RegionReadMetrics) Snapshot() map[string]RegionReadCount {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snapshot := make(map[string]RegionReadCount, len(m.regions))
+	for name, c := range m.regions {
+		snapshot[name] = c
+	}
+	return snapshot
+}
+
+// Reset discards the counts
+func (m *RegionReadMetrics) Reset() {
+	m.mu.Lock()
+	m.regions = map[string]RegionReadCount{}
+	m.mu.Unlock()
+}
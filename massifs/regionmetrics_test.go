@@ -0,0 +1,70 @@
+package massifs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegionReadMetrics(t *testing.T) {
+	store, _ := buildSealedLog(t, 3, 6)
+	data := store.massifs[1]
+	mc, err := GetMassifContext(context.Background(), store, 1)
+	require.NoError(t, err)
+	f, err := mc.Format()
+	require.NoError(t, err)
+
+	m := NewRegionReadMetrics()
+	m.RecordMassifRead(data)
+	snapshot := m.Snapshot()
+	var total uint64
+	for name, c := range snapshot {
+		require.Equal(t, uint64(1), c.Reads, name)
+		total += c.Bytes
+	}
+	require.Equal(t, uint64(len(data)), total)
+	log, ok := f.Region(RegionLog)
+	require.True(t, ok)
+	require.Equal(t, uint64(len(data))-log.Offset, snapshot[RegionLog].Bytes)
+	bloom, ok := f.Region(RegionBloomBitsets)
+	require.True(t, ok)
+	require.Equal(t, bloom.Size, snapshot[RegionBloomBitsets].Bytes)
+
+	// a ranged read of the headers touches nothing after them
+	m.Reset()
+	m.RecordMassifRead(data[:StartHeaderEnd+IndexHeaderBytes])
+	m.RecordMassifRead(data[:8])
+	m.RecordCheckpointRead(100)
+	snapshot = m.Snapshot()
+	require.Equal(t, RegionReadCount{Reads: 2, Bytes: ValueBytes + 8}, snapshot[RegionStartHeader])
+	require.Equal(t, RegionReadCount{Reads: 1, Bytes: IndexHeaderBytes}, snapshot[RegionIndexHeader])
+	require.Equal(t, RegionReadCount{Reads: 1, Bytes: 100}, snapshot[RegionCheckpoint])
+	require.NotContains(t, snapshot, RegionLog)
+}
+
+func TestPrefetchReaderRegionMetrics(t *testing.T) {
+	ctx := context.Background()
+	store, verifier := buildSealedLog(t, 3, 12)
+	metrics := NewRegionReadMetrics()
+	r, err := NewPrefetchReader(store, WithPrefetchDepth(0, 0), WithRegionReadMetrics(metrics))
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = GetContextVerified(ctx, r, verifier, 0)
+	require.NoError(t, err)
+	snapshot := metrics.Snapshot()
+	require.Equal(t, uint64(len(store.checkpoint[0])), snapshot[RegionCheckpoint].Bytes)
+	var massifBytes uint64
+	for name, c := range snapshot {
+		if name != RegionCheckpoint {
+			massifBytes += c.Bytes
+		}
+	}
+	require.Equal(t, uint64(len(store.massifs[0])), massifBytes)
+
+	// reads served from the cache are not storage reads
+	_, err = r.MassifReadN(ctx, 0, StartHeaderEnd)
+	require.NoError(t, err)
+	require.Equal(t, snapshot, metrics.Snapshot())
+}
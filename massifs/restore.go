@@ -0,0 +1,193 @@
+package massifs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/forestrie/go-merklelog/urkle"
+)
+
+var (
+	ErrRestoreAhead    = errors.New("the restored log is ahead of the expected state")
+	ErrRestoreDiverged = errors.New("the restored log does not match the expected state")
+)
+
+// RestoreExpectation is the state a log should be in, typically recorded by
+// the application which builds it alongside its own database. After blob
+// storage is restored from a provider snapshot, the log may be behind it.
+type RestoreExpectation struct {
+	// MassifIndex is the index of the last massif
+	MassifIndex uint32
+	// LastID is the idtimestamp of the last leaf
+	LastID uint64
+	// LeafCount is the number of leaves in the log. It is optional, but
+	// without it the leaves to replay are only identified by idtimestamp.
+	LeafCount uint64
+}
+
+// ReplayMassif is a massif the replay builder must append to, or create
+type ReplayMassif struct {
+	MassifIndex uint32
+	// Exists is true if the restored log has the massif, partially filled,
+	// and the replay appends to it. Otherwise the replay creates it.
+	Exists bool
+	// FirstLeaf and LeafCount are the leaves to replay into the massif. They
+	// are only set if the expectation has a LeafCount.
+	FirstLeaf uint64
+	LeafCount uint64
+}
+
+// RestoreReconciliation is the difference between a restored log and its
+// expected state, see ReconcileRestore. Replaying the entries with
+// idtimestamps after ReplayAfterID, up to and including ReplayThroughID, in
+// order, through the deterministic builder brings the log up to date.
+type RestoreReconciliation struct {
+	MassifHeight uint8
+	// Head is the index of the last massif of the restored log
+	Head uint32
+	// LastID is the idtimestamp of the last leaf of the restored log, zero if
+	// it is empty
+	LastID uint64
+	// LeafCount is the number of leaves in the restored log
+	LeafCount uint64
+	// SealedMMRSize is the size sealed by the latest restored checkpoint, zero
+	// if there is none. If the checkpoints were restored from a later
+	// snapshot than the massifs it may exceed the size of the log data, and
+	// the replay must then reproduce the sealed leaves exactly, or the log
+	// will fail verification.
+	SealedMMRSize uint64
+
+	ReplayAfterID   uint64
+	ReplayThroughID uint64
+	// FirstLeaf and ReplayCount are the leaves to replay, ReplayCount is only
+	// set if the expectation has a LeafCount.
+	FirstLeaf   uint64
+	ReplayCount uint64
+	// Massifs are the massifs the replay appends to, in order
+	Massifs []ReplayMassif
+}
+
+// UpToDate returns true if there is nothing to replay
+func (r *RestoreReconciliation) UpToDate() bool {
+	return len(r.Massifs) == 0
+}
+
+// SealedBeyondData returns true if the restored checkpoint seals leaves which
+// the restored massifs do not have.
+func (r *RestoreReconciliation) SealedBeyondData() bool {
+	// the mmr index of the next leaf is the size of the mmr before it
+	return r.SealedMMRSize > mmr.MMRIndex(r.LeafCount)
+}
+
+// ReconcileRestore compares the head of a restored log with the expected
+// state, and returns the massifs and leaves the replay builder must append.
+// massifHeight is that of the log, it is checked against the restored data.
+//
+// A restore can only lose the latest entries. If the restored log has
+// entries after those expected, it fails with ErrRestoreAhead, and if its
+// head is inconsistent with the expectation, with ErrRestoreDiverged.
+func ReconcileRestore(
+	ctx context.Context, reader ObjectReader, massifHeight uint8, expected RestoreExpectation,
+) (*RestoreReconciliation, error) {
+	leavesPerMassif := urkle.LeafCountForMassifHeight(massifHeight)
+	if leavesPerMassif == 0 {
+		return nil, fmt.Errorf("invalid massifHeight=0")
+	}
+	r := &RestoreReconciliation{MassifHeight: massifHeight, ReplayThroughID: expected.LastID}
+
+	// the restored head, an empty log has none
+	headExists := false
+	head, err := reader.HeadIndex(ctx, storage.ObjectMassifData)
+	switch {
+	case storage.IsNotFound(err):
+	case err != nil:
+		return nil, err
+	default:
+		mc, err := GetMassifContext(ctx, reader, head)
+		if err != nil {
+			return nil, err
+		}
+		if mc.Start.MassifHeight != massifHeight {
+			return nil, fmt.Errorf("%w: the restored log has massif height %d, not %d",
+				ErrRestoreDiverged, mc.Start.MassifHeight, massifHeight)
+		}
+		headExists = true
+		r.Head = head
+		r.LastID = mc.Start.LastID
+		r.LeafCount = mmr.LeafCount(mc.RangeCount())
+	}
+
+	checkHead, err := reader.HeadIndex(ctx, storage.ObjectCheckpoint)
+	switch {
+	case storage.IsNotFound(err):
+	case err != nil:
+		return nil, err
+	default:
+		data, err := reader.CheckpointRead(ctx, checkHead)
+		if err != nil {
+			return nil, err
+		}
+		check, err := NewCheckpoint(data)
+		if err != nil {
+			return nil, err
+		}
+		r.SealedMMRSize = check.MMRSize
+	}
+
+	if err = r.check(expected, leavesPerMassif); err != nil {
+		return nil, err
+	}
+	if r.LastID == expected.LastID && r.Head == expected.MassifIndex {
+		return r, nil
+	}
+
+	r.ReplayAfterID = r.LastID
+	r.FirstLeaf = r.LeafCount
+	if expected.LeafCount > 0 {
+		r.ReplayCount = expected.LeafCount - r.LeafCount
+	}
+	// a full head massif is not appended to, the replay starts the next
+	first := r.Head
+	if headExists && r.LeafCount == uint64(r.Head+1)*leavesPerMassif {
+		first++
+	}
+	for i := first; i <= expected.MassifIndex; i++ {
+		m := ReplayMassif{MassifIndex: i, Exists: headExists && i == r.Head}
+		if expected.LeafCount > 0 {
+			m.FirstLeaf = max(r.LeafCount, uint64(i)*leavesPerMassif)
+			m.LeafCount = min(expected.LeafCount, uint64(i+1)*leavesPerMassif) - m.FirstLeaf
+		}
+		r.Massifs = append(r.Massifs, m)
+	}
+	return r, nil
+}
+
+// check returns an error unless the restored head can be brought to the
+// expected state by appending.
+func (r *RestoreReconciliation) check(expected RestoreExpectation, leavesPerMassif uint64) error {
+	if r.LastID > expected.LastID || r.Head > expected.MassifIndex {
+		return fmt.Errorf("%w: restored massif %d, last id %d, expected massif %d, last id %d",
+			ErrRestoreAhead, r.Head, r.LastID, expected.MassifIndex, expected.LastID)
+	}
+	if expected.LeafCount == 0 {
+		return nil
+	}
+	if r.LeafCount > expected.LeafCount {
+		return fmt.Errorf("%w: restored %d leaves, expected %d", ErrRestoreAhead, r.LeafCount, expected.LeafCount)
+	}
+	// the expected massif holds the last leaf, or is the empty massif after a
+	// full one
+	if expected.LeafCount > uint64(expected.MassifIndex+1)*leavesPerMassif ||
+		expected.LeafCount < uint64(expected.MassifIndex)*leavesPerMassif {
+		return fmt.Errorf("%w: %d leaves are not in massif %d",
+			ErrRestoreDiverged, expected.LeafCount, expected.MassifIndex)
+	}
+	if (r.LastID == expected.LastID) != (r.LeafCount == expected.LeafCount) {
+		return fmt.Errorf("%w: restored %d leaves to last id %d, expected %d to last id %d",
+			ErrRestoreDiverged, r.LeafCount, r.LastID, expected.LeafCount, expected.LastID)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package massifs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconcileRestore(t *testing.T) {
+	ctx := context.Background()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	// the log as the database knows it, and as restored from an earlier
+	// snapshot. Each leaf i has idtimestamp i+1.
+	current := buildSealedLogWithKey(t, key, 3, 6)
+	restored := buildSealedLogWithKey(t, key, 3, 3)
+	expected := RestoreExpectation{MassifIndex: 1, LastID: 6, LeafCount: 6}
+
+	r, err := ReconcileRestore(ctx, restored, 3, expected)
+	require.NoError(t, err)
+	require.False(t, r.UpToDate())
+	require.False(t, r.SealedBeyondData())
+	require.Equal(t, uint64(3), r.LastID)
+	require.Equal(t, uint64(3), r.ReplayAfterID)
+	require.Equal(t, uint64(6), r.ReplayThroughID)
+	require.Equal(t, uint64(3), r.FirstLeaf)
+	require.Equal(t, uint64(3), r.ReplayCount)
+	require.Equal(t, []ReplayMassif{
+		{MassifIndex: 0, Exists: true, FirstLeaf: 3, LeafCount: 1},
+		{MassifIndex: 1, FirstLeaf: 4, LeafCount: 2},
+	}, r.Massifs)
+
+	// without a leaf count, only the massifs and idtimestamps are known
+	r, err = ReconcileRestore(ctx, restored, 3, RestoreExpectation{MassifIndex: 1, LastID: 6})
+	require.NoError(t, err)
+	require.Equal(t, []ReplayMassif{{MassifIndex: 0, Exists: true}, {MassifIndex: 1}}, r.Massifs)
+
+	// replaying the leaves listed restores the log exactly
+	r, err = ReconcileRestore(ctx, restored, 3, expected)
+	require.NoError(t, err)
+	for _, m := range r.Massifs {
+		for i := m.FirstLeaf; i < m.FirstLeaf+m.LeafCount; i++ {
+			mc, err := GetAppendContext(ctx, restored, 1, 3)
+			require.NoError(t, err)
+			require.Equal(t, m.MassifIndex, mc.Start.MassifIndex)
+			leaf := sha256.Sum256(fmt.Appendf(nil, "sealed-log-leaf-%d", i))
+			_, err = mc.AddHashedLeaf(sha256.New(), i+1, nil, nil, nil, leaf[:])
+			require.NoError(t, err)
+			require.NoError(t, CommitContext(ctx, restored, &mc))
+		}
+	}
+	// the statistics block records when it was written, the log and its
+	// index are the same
+	for i := range uint32(2) {
+		want, err := GetMassifContext(ctx, current, i)
+		require.NoError(t, err)
+		got, err := GetMassifContext(ctx, restored, i)
+		require.NoError(t, err)
+		require.Equal(t, want.Start, got.Start)
+		require.Equal(t, want.Data[want.IndexHeaderStart():], got.Data[got.IndexHeaderStart():])
+	}
+	r, err = ReconcileRestore(ctx, restored, 3, expected)
+	require.NoError(t, err)
+	require.True(t, r.UpToDate())
+
+	// an empty log replays everything
+	r, err = ReconcileRestore(ctx, newMemStore(nil, nil), 3, expected)
+	require.NoError(t, err)
+	require.Equal(t, []ReplayMassif{
+		{MassifIndex: 0, FirstLeaf: 0, LeafCount: 4},
+		{MassifIndex: 1, FirstLeaf: 4, LeafCount: 2},
+	}, r.Massifs)
+}
+
+func TestReconcileRestoreRefused(t *testing.T) {
+	ctx := context.Background()
+	restored, _ := buildSealedLog(t, 3, 3)
+
+	_, err := ReconcileRestore(ctx, restored, 3, RestoreExpectation{MassifIndex: 0, LastID: 2, LeafCount: 2})
+	require.ErrorIs(t, err, ErrRestoreAhead)
+	_, err = ReconcileRestore(ctx, restored, 3, RestoreExpectation{MassifIndex: 0, LastID: 3, LeafCount: 4})
+	require.ErrorIs(t, err, ErrRestoreDiverged)
+	_, err = ReconcileRestore(ctx, restored, 3, RestoreExpectation{MassifIndex: 0, LastID: 9, LeafCount: 5})
+	require.ErrorIs(t, err, ErrRestoreDiverged)
+	_, err = ReconcileRestore(ctx, restored, 4, RestoreExpectation{MassifIndex: 0, LastID: 9})
+	require.ErrorIs(t, err, ErrRestoreDiverged)
+
+	// checkpoints restored from a later snapshot than the massifs
+	current, _ := buildSealedLog(t, 3, 4)
+	restored.checkpoint[0] = current.checkpoint[0]
+	r, err := ReconcileRestore(ctx, restored, 3, RestoreExpectation{MassifIndex: 0, LastID: 4, LeafCount: 4})
+	require.NoError(t, err)
+	require.True(t, r.SealedBeyondData())
+}
@@ -0,0 +1,125 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"sync"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/veraison/go-cose"
+)
+
+// SealRequest is one checkpoint to sign in a batch, see
+// SignCheckpointReceipts.
+type SealRequest struct {
+	// LogID identifies the log the seal is for. It is not signed, it
+	// identifies the corresponding SealResult.
+	LogID       storage.LogID
+	Proof       ConsistencyProof
+	Accumulator [][]byte
+	// Options apply to this seal only, after the batch options. Typically
+	// WithPreviousPeakReceipts.
+	Options []CheckpointSignOption
+}
+
+// SealResult is the outcome of signing one SealRequest.
+type SealResult struct {
+	LogID      storage.LogID
+	Checkpoint []byte
+	Err        error
+}
+
+// SignCheckpointReceipts signs the checkpoints for many logs in one pass. The
+// protected headers are encoded once for the batch, and with
+// WithSignConcurrency several seals are signed at once. The results are in
+// request order, a failure to sign one seal does not prevent the others.
+//
+// The batch options apply to every seal, each as for SignCheckpointReceipt.
+// If ctx is done, the seals not yet started fail with its error.
+func SignCheckpointReceipts(
+	ctx context.Context, signer cose.Signer, requests []SealRequest, opts ...CheckpointSignOption,
+) ([]SealResult, error) {
+	options, err := NewCheckpointSignOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	cs, err := newCheckpointSigner(signer, &options)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]SealResult, len(requests))
+	sign := func(i int) {
+		req := requests[i]
+		results[i].LogID = req.LogID
+		if err := ctx.Err(); err != nil {
+			results[i].Err = err
+			return
+		}
+		reqOptions := options
+		for _, opt := range req.Options {
+			opt(&reqOptions)
+		}
+		if err := reqOptions.Validate(); err != nil {
+			results[i].Err = err
+			return
+		}
+		seal := cs
+		if !sameProtectedHeaders(&reqOptions, &options) {
+			// the protected headers differ for this request
+			var err error
+			if seal, err = newCheckpointSigner(signer, &reqOptions); err != nil {
+				results[i].Err = err
+				return
+			}
+		}
+		results[i].Checkpoint, results[i].Err = seal.sign(req.Proof, req.Accumulator, &reqOptions)
+	}
+
+	concurrency := max(options.Concurrency, 1)
+	if concurrency == 1 {
+		for i := range requests {
+			sign(i)
+		}
+		return results, nil
+	}
+
+	var wg sync.WaitGroup
+	next := make(chan int)
+	for range min(concurrency, len(requests)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				sign(i)
+			}
+		}()
+	}
+	for i := range requests {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results, nil
+}
+
+// sameProtectedHeaders returns true if the options select the same protected
+// headers, see newCheckpointSigner. The values are compared, options set
+// again for a request are usually equal but never the same pointer.
+func sameProtectedHeaders(a, b *CheckpointSignOptions) bool {
+	if !bytes.Equal(a.KID, b.KID) || a.SealKID != b.SealKID || !bytes.Equal(a.IndexCommitment, b.IndexCommitment) ||
+		a.SignMMRSize != b.SignMMRSize {
+		return false
+	}
+	if (a.Claims == nil) != (b.Claims == nil) || (a.Claims != nil && *a.Claims != *b.Claims) {
+		return false
+	}
+	if (a.Version == nil) != (b.Version == nil) || (a.Version != nil && *a.Version != *b.Version) {
+		return false
+	}
+	aConfig, bConfig := a.IndexConfig, b.IndexConfig
+	if aConfig == nil || aConfig.IsZero() || bConfig == nil || bConfig.IsZero() {
+		return (aConfig == nil || aConfig.IsZero()) == (bConfig == nil || bConfig.IsZero())
+	}
+	return bytes.Equal(aConfig.Bloom, bConfig.Bloom) && bytes.Equal(aConfig.Urkle, bConfig.Urkle)
+}
@@ -0,0 +1,247 @@
+package massifs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"io"
+	"sync/atomic"
+	"testing"
+
+	commoncbor "github.com/forestrie/go-merklelog/massifs/cbor"
+	commoncose "github.com/forestrie/go-merklelog/massifs/cose"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+type countingSigner struct {
+	cose.Signer
+	count atomic.Int64
+}
+
+func (s *countingSigner) Sign(rand io.Reader, content []byte) ([]byte, error) {
+	s.count.Add(1)
+	return s.Signer.Sign(rand, content)
+}
+
+func TestSignCheckpointReceiptsBatch(t *testing.T) {
+	store, sizes := newFixtureMMR(t, 7)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer := commoncose.NewTestCoseSigner(t, *key)
+	verifier := newES256Verifier(t, &key.PublicKey)
+
+	// Stand in for many logs with many states of the one fixture
+	var requests []SealRequest
+	for i, size := range sizes {
+		proof, err := BuildConsistencyProof(store, 0, size)
+		require.NoError(t, err)
+		accumulator, err := mmr.PeakHashes(store, size-1)
+		require.NoError(t, err)
+		requests = append(requests, SealRequest{LogID: []byte{byte(i)}, Proof: proof, Accumulator: accumulator})
+	}
+
+	results, err := SignCheckpointReceipts(context.Background(), signer, requests,
+		WithPeakReceipts([]byte("log-key-1")), WithSignConcurrency(3))
+	require.NoError(t, err)
+	require.Len(t, results, len(requests))
+
+	for i, result := range results {
+		require.Equal(t, requests[i].LogID, result.LogID)
+		require.NoError(t, result.Err)
+		receipt, err := DecodeCheckpointReceipt(result.Checkpoint)
+		require.NoError(t, err)
+		accumulator, err := VerifyCheckpointReceipt(store, &receipt, verifier)
+		require.NoError(t, err)
+		require.Equal(t, requests[i].Accumulator, accumulator)
+		require.Len(t, receipt.PeakReceipts, len(accumulator))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err = SignCheckpointReceipts(ctx, signer, requests[:1])
+	require.NoError(t, err)
+	require.ErrorIs(t, results[0].Err, context.Canceled)
+}
+
+func TestSignCheckpointReceiptReusesUnchangedPeakReceipts(t *testing.T) {
+	store, sizes := newFixtureMMR(t, 7)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer := &countingSigner{Signer: commoncose.NewTestCoseSigner(t, *key)}
+	verifier := newES256Verifier(t, &key.PublicKey)
+	kid := []byte("log-key-1")
+
+	seal := func(from, to uint64, opts ...CheckpointSignOption) (CheckpointReceipt, [][]byte) {
+		proof, err := BuildConsistencyProof(store, from, to)
+		require.NoError(t, err)
+		accumulator, err := mmr.PeakHashes(store, to-1)
+		require.NoError(t, err)
+		data, err := SignCheckpointReceipt(signer, proof, accumulator, opts...)
+		require.NoError(t, err)
+		receipt, err := DecodeCheckpointReceipt(data)
+		require.NoError(t, err)
+		return receipt, accumulator
+	}
+
+	// 6 leaves has two peaks, 7 leaves adds a third
+	first, firstAccumulator := seal(0, sizes[5], WithPeakReceipts(kid))
+	require.Len(t, firstAccumulator, 2)
+
+	signer.count.Store(0)
+	second, secondAccumulator := seal(sizes[5], sizes[6],
+		WithPeakReceipts(kid), WithPreviousPeakReceipts(verifier, firstAccumulator, first.PeakReceipts))
+	require.Len(t, secondAccumulator, 3)
+	require.Equal(t, int64(2), signer.count.Load(), "only the checkpoint and the new peak are signed")
+	require.Equal(t, first.PeakReceipts, second.PeakReceipts[:2])
+
+	for i, receiptBytes := range second.PeakReceipts {
+		msg, err := commoncose.NewCoseSign1MessageFromCBOR(
+			receiptBytes, commoncose.WithDecOptions(commoncbor.DecOptions))
+		require.NoError(t, err)
+		msg.Payload = secondAccumulator[i]
+		require.NoError(t, msg.Verify(nil, verifier), "peak receipt %d signature", i)
+	}
+
+	// A receipt for a different key id is not reused
+	signer.count.Store(0)
+	_, _ = seal(sizes[5], sizes[6],
+		WithPeakReceipts([]byte("log-key-2")), WithPreviousPeakReceipts(verifier, firstAccumulator, first.PeakReceipts))
+	require.Equal(t, int64(4), signer.count.Load())
+
+	// Nor is one signed by another key with the same protected header, as
+	// after a rotation without a kid
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer.count.Store(0)
+	_, _ = seal(sizes[5], sizes[6], WithPeakReceipts(kid),
+		WithPreviousPeakReceipts(newES256Verifier(t, &otherKey.PublicKey), firstAccumulator, first.PeakReceipts))
+	require.Equal(t, int64(4), signer.count.Load())
+
+	// Nor a corrupt receipt
+	corrupt := [][]byte{append([]byte(nil), first.PeakReceipts[0]...), first.PeakReceipts[1]}
+	corrupt[0][len(corrupt[0])-1] ^= 0x01
+	signer.count.Store(0)
+	third, _ := seal(sizes[5], sizes[6], WithPeakReceipts(kid), WithPreviousPeakReceipts(verifier, firstAccumulator, corrupt))
+	require.Equal(t, int64(3), signer.count.Load())
+	require.Equal(t, first.PeakReceipts[1], third.PeakReceipts[1])
+
+	// And without a verifier nothing is reused
+	signer.count.Store(0)
+	_, _ = seal(sizes[5], sizes[6], WithPeakReceipts(kid), WithPreviousPeakReceipts(nil, firstAccumulator, first.PeakReceipts))
+	require.Equal(t, int64(4), signer.count.Load())
+
+	// With a cache, the receipts signed are not verified when they are
+	// reused, and those verified are verified once
+	cache := NewSignatureCache(0)
+	counting := &countingVerifier{Verifier: verifier}
+	cached, cachedAccumulator := seal(0, sizes[5], WithPeakReceipts(kid), WithPeakReceiptCache(cache),
+		WithPreviousPeakReceipts(counting, nil, nil))
+	signer.count.Store(0)
+	for range 2 {
+		_, _ = seal(sizes[5], sizes[6], WithPeakReceipts(kid), WithPeakReceiptCache(cache),
+			WithPreviousPeakReceipts(counting, cachedAccumulator, cached.PeakReceipts))
+	}
+	require.Equal(t, int64(4), signer.count.Load(), "only the checkpoints and the new peaks are signed")
+	require.Equal(t, 0, counting.verifies)
+	for range 2 {
+		_, _ = seal(sizes[5], sizes[6], WithPeakReceipts(kid), WithPeakReceiptCache(cache),
+			WithPreviousPeakReceipts(counting, firstAccumulator, first.PeakReceipts))
+	}
+	require.Equal(t, 2, counting.verifies)
+}
+
+// BenchmarkSignCheckpointReceiptPeakReceipts compares signing every peak
+// receipt of a seal with reusing the unchanged receipts of the previous seal,
+// with and without a WithPeakReceiptCache.
+func BenchmarkSignCheckpointReceiptPeakReceipts(b *testing.B) {
+	store, sizes := newFixtureMMR(b, 255)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(b, err)
+	signer, err := cose.NewSigner(cose.AlgorithmES256, key)
+	require.NoError(b, err)
+	verifier, err := cose.NewVerifier(cose.AlgorithmES256, &key.PublicKey)
+	require.NoError(b, err)
+	kid := []byte("log-key-1")
+
+	// 254 leaves has seven peaks, 255 adds an eighth
+	from, to := sizes[253], sizes[254]
+	previousAccumulator, err := mmr.PeakHashes(store, from-1)
+	require.NoError(b, err)
+	proof, err := BuildConsistencyProof(store, 0, from)
+	require.NoError(b, err)
+	data, err := SignCheckpointReceipt(signer, proof, previousAccumulator, WithPeakReceipts(kid))
+	require.NoError(b, err)
+	previous, err := DecodeCheckpointReceipt(data)
+	require.NoError(b, err)
+
+	proof, err = BuildConsistencyProof(store, from, to)
+	require.NoError(b, err)
+	accumulator, err := mmr.PeakHashes(store, to-1)
+	require.NoError(b, err)
+
+	cache := NewSignatureCache(0)
+	for _, bench := range []struct {
+		name string
+		opts []CheckpointSignOption
+	}{
+		{"sign", nil},
+		{"reuse", []CheckpointSignOption{WithPreviousPeakReceipts(verifier, previousAccumulator, previous.PeakReceipts)}},
+		{"reuse-cached", []CheckpointSignOption{
+			WithPreviousPeakReceipts(verifier, previousAccumulator, previous.PeakReceipts), WithPeakReceiptCache(cache)}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			opts := append([]CheckpointSignOption{WithPeakReceipts(kid)}, bench.opts...)
+			for b.Loop() {
+				if _, err := SignCheckpointReceipt(signer, proof, accumulator, opts...); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestSignCheckpointReceiptsValidatesRequestOptions(t *testing.T) {
+	store, sizes := newFixtureMMR(t, 3)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer := commoncose.NewTestCoseSigner(t, *key)
+
+	proof, err := BuildConsistencyProof(store, 0, sizes[0])
+	require.NoError(t, err)
+	accumulator, err := mmr.PeakHashes(store, sizes[0]-1)
+	require.NoError(t, err)
+	requests := []SealRequest{{
+		LogID: []byte{1}, Proof: proof, Accumulator: accumulator,
+		Options: []CheckpointSignOption{
+			WithUnprotectedExtras(map[int64]cbor.RawMessage{SealPeakReceiptsLabel: nil}),
+		},
+	}}
+	results, err := SignCheckpointReceipts(context.Background(), signer, requests)
+	require.NoError(t, err)
+	require.ErrorIs(t, results[0].Err, ErrInvalidOptions)
+}
+
+func TestSameProtectedHeaders(t *testing.T) {
+	claims := func() CheckpointSignOption {
+		return WithSealClaims(SealClaims{Issuer: "issuer", Subject: "subject"})
+	}
+	a, b := CheckpointSignOptions{}, CheckpointSignOptions{}
+	claims()(&a)
+	claims()(&b)
+	a.IndexConfig = &IndexConfig{Bloom: []byte{1}}
+	b.IndexConfig = &IndexConfig{Bloom: []byte{1}}
+	require.True(t, sameProtectedHeaders(&a, &b))
+
+	b.IndexConfig = &IndexConfig{Bloom: []byte{2}}
+	require.False(t, sameProtectedHeaders(&a, &b))
+
+	b.IndexConfig = &IndexConfig{Bloom: []byte{1}}
+	b.Claims = &SealClaims{Issuer: "issuer", Subject: "other"}
+	require.False(t, sameProtectedHeaders(&a, &b))
+}
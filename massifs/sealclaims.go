@@ -0,0 +1,129 @@
+package massifs
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/google/uuid"
+)
+
+const (
+	// SealIssuerPrefix starts the issuer of a seal, it is followed by the
+	// tenant identity.
+	SealIssuerPrefix = "tenant/"
+	// SealSubjectPrefix starts the subject of a seal, it is followed by the
+	// log uuid, "/epoch/" and the commitment epoch in decimal.
+	SealSubjectPrefix = "log/"
+	sealSubjectEpoch  = "/epoch/"
+
+	cwtClaimIssuer  int64 = 1
+	cwtClaimSubject int64 = 2
+)
+
+var (
+	ErrSealClaimsInvalid   = errors.New("the seal cwt claims do not follow the naming conventions")
+	ErrSealSubjectMismatch = errors.New("the seal subject does not identify the log being verified")
+)
+
+// SealClaims are the CWT issuer and subject claims of a seal. By convention
+// the issuer names the tenant that owns the log,
+//
+//	tenant/{tenant}
+//
+// and the subject names the log and the commitment epoch it was sealed in,
+//
+//	log/{log uuid}/epoch/{epoch}
+//
+// A seal carrying them can only be presented for the log it was made for, see
+// WithVerifySealSubject.
+type SealClaims struct {
+	Issuer  string
+	Subject string
+}
+
+// NewSealClaims returns the conventional claims for a seal of the log. The
+// log id must be a 16 byte uuid.
+func NewSealClaims(tenant string, logID storage.LogID, epoch uint32) (SealClaims, error) {
+	if tenant == "" || strings.ContainsAny(tenant, " \t\n") {
+		return SealClaims{}, fmt.Errorf("%w: tenant %q", ErrSealClaimsInvalid, tenant)
+	}
+	if len(logID) != 16 {
+		return SealClaims{}, fmt.Errorf("%w: log id must be a 16 byte uuid", ErrSealClaimsInvalid)
+	}
+	return SealClaims{
+		Issuer:  SealIssuerPrefix + tenant,
+		Subject: fmt.Sprintf("%s%s%s%d", SealSubjectPrefix, uuid.UUID(logID), sealSubjectEpoch, epoch),
+	}, nil
+}
+
+// Tenant returns the tenant identity named by the issuer.
+func (c SealClaims) Tenant() (string, error) {
+	tenant, ok := strings.CutPrefix(c.Issuer, SealIssuerPrefix)
+	if !ok || tenant == "" {
+		return "", fmt.Errorf("%w: issuer %q", ErrSealClaimsInvalid, c.Issuer)
+	}
+	return tenant, nil
+}
+
+// Log returns the log id and commitment epoch named by the subject.
+func (c SealClaims) Log() (storage.LogID, uint32, error) {
+	rest, ok := strings.CutPrefix(c.Subject, SealSubjectPrefix)
+	if !ok {
+		return nil, 0, fmt.Errorf("%w: subject %q", ErrSealClaimsInvalid, c.Subject)
+	}
+	id, epoch, ok := strings.Cut(rest, sealSubjectEpoch)
+	if !ok {
+		return nil, 0, fmt.Errorf("%w: subject %q has no epoch", ErrSealClaimsInvalid, c.Subject)
+	}
+	logID, err := uuid.Parse(id)
+	if err != nil || len(id) != storage.LenUUIDString {
+		return nil, 0, fmt.Errorf("%w: subject %q has no log uuid", ErrSealClaimsInvalid, c.Subject)
+	}
+	n, err := strconv.ParseUint(epoch, 10, 32)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: subject %q epoch: %v", ErrSealClaimsInvalid, c.Subject, err)
+	}
+	return storage.LogID(logID[:]), uint32(n), nil
+}
+
+// Validate checks both claims follow the naming conventions.
+func (c SealClaims) Validate() error {
+	if _, err := c.Tenant(); err != nil {
+		return err
+	}
+	_, _, err := c.Log()
+	return err
+}
+
+// ReadSealClaims returns the claims from a checkpoint's protected header, see
+// SealIdentity.
+func ReadSealClaims(protectedHeader []byte) (SealClaims, error) {
+	issuer, subject, err := SealIdentity(protectedHeader)
+	if err != nil {
+		return SealClaims{}, err
+	}
+	return SealClaims{Issuer: issuer, Subject: subject}, nil
+}
+
+// checkSealSubject returns an error unless the checkpoint claims name the log
+// and the epoch.
+func checkSealSubject(check *Checkpoint, logID storage.LogID, epoch uint32) error {
+	claims, err := ReadSealClaims(check.Receipt.ProtectedHeader)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSealSubjectMismatch, err)
+	}
+	sealedLogID, sealedEpoch, err := claims.Log()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSealSubjectMismatch, err)
+	}
+	if string(sealedLogID) != string(logID) {
+		return fmt.Errorf("%w: sealed for log %x, not %x", ErrSealSubjectMismatch, []byte(sealedLogID), []byte(logID))
+	}
+	if sealedEpoch != epoch {
+		return fmt.Errorf("%w: sealed in epoch %d, the massif is epoch %d", ErrSealSubjectMismatch, sealedEpoch, epoch)
+	}
+	return nil
+}
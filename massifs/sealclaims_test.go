@@ -0,0 +1,95 @@
+package massifs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealClaimsConventions(t *testing.T) {
+	id := uuid.MustParse("01947000-3456-780f-bfa9-29881e3bac88")
+	logID := storage.LogID(id[:])
+
+	claims, err := NewSealClaims("acme", logID, 7)
+	require.NoError(t, err)
+	require.Equal(t, "tenant/acme", claims.Issuer)
+	require.Equal(t, "log/01947000-3456-780f-bfa9-29881e3bac88/epoch/7", claims.Subject)
+	require.NoError(t, claims.Validate())
+
+	tenant, err := claims.Tenant()
+	require.NoError(t, err)
+	require.Equal(t, "acme", tenant)
+	gotID, epoch, err := claims.Log()
+	require.NoError(t, err)
+	require.Equal(t, logID, gotID)
+	require.Equal(t, uint32(7), epoch)
+
+	_, err = NewSealClaims("", logID, 7)
+	require.ErrorIs(t, err, ErrSealClaimsInvalid)
+	_, err = NewSealClaims("acme", logID[:8], 7)
+	require.ErrorIs(t, err, ErrSealClaimsInvalid)
+
+	for _, bad := range []SealClaims{
+		{Issuer: "acme", Subject: claims.Subject},
+		{Issuer: claims.Issuer, Subject: "01947000-3456-780f-bfa9-29881e3bac88/epoch/7"},
+		{Issuer: claims.Issuer, Subject: "log/01947000-3456-780f-bfa9-29881e3bac88"},
+		{Issuer: claims.Issuer, Subject: "log/not-a-uuid/epoch/7"},
+		{Issuer: claims.Issuer, Subject: "log/01947000-3456-780f-bfa9-29881e3bac88/epoch/x"},
+	} {
+		require.ErrorIs(t, bad.Validate(), ErrSealClaimsInvalid, "%+v", bad)
+	}
+}
+
+func TestVerifyContextSealSubject(t *testing.T) {
+	ctx := context.Background()
+	mc, signer, verifier := newReplicatorFixture(t, 3)
+
+	idA, idB := uuid.New(), uuid.New()
+	logA, logB := storage.LogID(idA[:]), storage.LogID(idB[:])
+
+	proof, err := BuildConsistencyProof(mc, 0, mc.RangeCount())
+	require.NoError(t, err)
+	accumulator, err := mmr.PeakHashes(mc, mc.RangeCount()-1)
+	require.NoError(t, err)
+
+	sign := func(opts ...CheckpointSignOption) *Checkpoint {
+		signed, err := SignCheckpointReceipt(signer, proof, accumulator, opts...)
+		require.NoError(t, err)
+		check, err := NewCheckpoint(signed)
+		require.NoError(t, err)
+		return &check
+	}
+
+	claims, err := NewSealClaims("acme", logA, mc.Start.CommitmentEpoch)
+	require.NoError(t, err)
+	check := sign(WithSealClaims(claims))
+
+	got, err := ReadSealClaims(check.Receipt.ProtectedHeader)
+	require.NoError(t, err)
+	require.Equal(t, claims, got)
+
+	verify := func(check *Checkpoint, logID storage.LogID) error {
+		_, err := mc.VerifyContext(ctx, VerifyOptions{Check: check, COSEVerifier: verifier})
+		if err != nil {
+			return err
+		}
+		options := VerifyOptions{Check: check, COSEVerifier: verifier}
+		WithVerifySealSubject(logID)(&options)
+		_, err = mc.VerifyContext(ctx, options)
+		return err
+	}
+
+	require.NoError(t, verify(check, logA))
+	// a valid seal for log A is refused for log B
+	require.ErrorIs(t, verify(check, logB), ErrSealSubjectMismatch)
+	// as is a seal made in another epoch
+	other, err := NewSealClaims("acme", logA, mc.Start.CommitmentEpoch+1)
+	require.NoError(t, err)
+	require.ErrorIs(t, verify(sign(WithSealClaims(other)), logA), ErrSealSubjectMismatch)
+	// and a seal without claims, when the subject is required
+	require.ErrorIs(t, verify(sign(), logA), ErrSealSubjectMismatch)
+}
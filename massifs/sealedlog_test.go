@@ -0,0 +1,64 @@
+package massifs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+// buildSealedLog appends leafCount v2 leaves to a new in-memory log, spilling
+// over as many massifs as needed. Each massif is sealed when it is completed,
+// and the head massif is sealed at the end. Every seal chains its consistency
+// proof from the previous seal, which is always a massif boundary.
+func buildSealedLog(t *testing.T, massifHeight uint8, leafCount int) (*memStore, cose.Verifier) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return buildSealedLogWithKey(t, key, massifHeight, leafCount), newES256Verifier(t, &key.PublicKey)
+}
+
+// buildSealedLogWithKey is buildSealedLog with the log key provided by the
+// caller.
+func buildSealedLogWithKey(t *testing.T, key *ecdsa.PrivateKey, massifHeight uint8, leafCount int) *memStore {
+	t.Helper()
+	ctx := context.Background()
+
+	signer, err := cose.NewSigner(cose.AlgorithmES256, key)
+	require.NoError(t, err)
+
+	store := newMemStore(nil, nil)
+	var sealedSize uint64
+	seal := func(mc *MassifContext) {
+		if mc.RangeCount() == sealedSize {
+			return
+		}
+		store.checkpoint[mc.Start.MassifIndex] = signCheckpointV3WithSigner(t, mc, signer, sealedSize)
+		sealedSize = mc.RangeCount()
+	}
+
+	var mc MassifContext
+	for i := range leafCount {
+		mc, err = GetAppendContext(ctx, store, 1, massifHeight)
+		require.NoError(t, err)
+
+		leaf := sha256.Sum256(fmt.Appendf(nil, "sealed-log-leaf-%d", i))
+		_, err = mc.AddHashedLeaf(sha256.New(), uint64(i+1), nil, nil, nil, leaf[:])
+		require.NoError(t, err)
+		require.NoError(t, CommitContext(ctx, store, &mc))
+
+		if mc.Count() >= TreeCount(massifHeight) {
+			seal(&mc)
+		}
+	}
+	if leafCount > 0 {
+		seal(&mc)
+	}
+	return store
+}
@@ -0,0 +1,143 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/veraison/go-cose"
+)
+
+// ErrUntrustedKey is returned when a checkpoint names, by its kid, a key
+// which is not among the trusted keys.
+var ErrUntrustedKey = errors.New("the checkpoint is signed by a key which is not trusted")
+
+// TrustedKey is a key seals may be signed with, see WithTrustedKeys. KID is
+// the key id the seals signed with it carry, see WithSealKID.
+type TrustedKey struct {
+	KID      []byte
+	Verifier cose.Verifier
+}
+
+// WithTrustedKeys verifies checkpoints against a set of keys rather than a
+// single verifier, so the seals signed before a key rotation still verify
+// after it. A checkpoint which carries a kid is verified with the key of
+// that kid, and one which names a key not in the set is refused with
+// ErrUntrustedKey, unless a verifier is also given with
+// VerifyWithCOSEVerifier, which is then used. A checkpoint without a kid
+// verifies if any of the keys, or the verifier, verifies it.
+func WithTrustedKeys(keys ...TrustedKey) Option {
+	return func(a any) {
+		if opts, ok := a.(*VerifyOptions); ok {
+			opts.TrustedKeys = append(opts.TrustedKeys, keys...)
+		}
+	}
+}
+
+// WithSealKID puts kid in the checkpoint protected header (label 4), so
+// verifiers trusting several keys select the key by it, see WithTrustedKeys.
+// It is also the kid of the peak receipts, if they are requested.
+func WithSealKID(kid []byte) CheckpointSignOption {
+	return func(o *CheckpointSignOptions) {
+		o.KID = kid
+		o.SealKID = true
+	}
+}
+
+// checkpointVerifier returns the verifier for the receipt, selected from the
+// trusted keys by the receipt's kid. Without trusted keys it is the
+// COSEVerifier.
+func (o *VerifyOptions) checkpointVerifier(receipt *CheckpointReceipt) (cose.Verifier, error) {
+	if len(o.TrustedKeys) == 0 {
+		return o.COSEVerifier, nil
+	}
+	kid, err := protectedHeaderKid(receipt.ProtectedHeader)
+	if err != nil {
+		return nil, err
+	}
+	if kid != nil {
+		for _, key := range o.TrustedKeys {
+			if bytes.Equal(key.KID, kid) {
+				return key.Verifier, nil
+			}
+		}
+		if o.COSEVerifier != nil {
+			return o.COSEVerifier, nil
+		}
+		return nil, fmt.Errorf("%w: kid %x", ErrUntrustedKey, kid)
+	}
+	var ring keyRingVerifier
+	if o.COSEVerifier != nil {
+		ring = append(ring, o.COSEVerifier)
+	}
+	for _, key := range o.TrustedKeys {
+		if key.Verifier != nil {
+			ring = append(ring, key.Verifier)
+		}
+	}
+	return ring, nil
+}
+
+// keyRingVerifier verifies a signature made by any of its verifiers. It is
+// used for checkpoints which do not say which key signed them.
+type keyRingVerifier []cose.Verifier
+
+// Algorithm returns that of the first verifier, the verifiers need not share
+// one
+func (r keyRingVerifier) Algorithm() cose.Algorithm {
+	if len(r) == 0 {
+		return 0
+	}
+	return r[0].Algorithm()
+}
+
+func (r keyRingVerifier) Verify(content, signature []byte) error {
+	errs := make([]error, 0, len(r))
+	for _, verifier := range r {
+		err := verifier.Verify(content, signature)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return fmt.Errorf("no trusted key verifies the signature: %w", errors.Join(errs...))
+}
+
+// ResealCheckpoint re-signs the checkpoint of the massif with signer,
+// typically a new key after a rotation, and replaces the stored checkpoint
+// with it. The current checkpoint is verified first, with the verification
+// options in opts, which must trust the key it was signed with, see
+// WithTrustedKeys. The new seal commits to the same accumulator with the same
+// consistency proof, so the chain of consistency from earlier seals is
+// retained, only the signature and protected header change.
+//
+// The content of the new seal is configured by the checkpoint sign options in
+// opts, see WithCheckpointSignOptions, nothing is carried over from the old
+// one. Use WithSealKID so verifiers trusting both keys select the new one.
+// Returns the new checkpoint.
+func ResealCheckpoint(
+	ctx context.Context, store ObjectReaderWriter, massifIndex uint32, signer cose.Signer, opts ...Option,
+) ([]byte, error) {
+	signOptions := CheckpointSignOptions{}
+	if err := ApplyOptions(&signOptions, opts...); err != nil {
+		return nil, err
+	}
+	vc, err := GetContextVerified(ctx, store, nil, massifIndex, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("the checkpoint of massif %d to reseal: %w", massifIndex, err)
+	}
+	cs, err := newCheckpointSigner(signer, &signOptions)
+	if err != nil {
+		return nil, err
+	}
+	data, err := cs.sign(vc.Checkpoint.Receipt.Proof, vc.Accumulator, &signOptions)
+	if err != nil {
+		return nil, err
+	}
+	if err = store.Put(ctx, massifIndex, storage.ObjectCheckpoint, data, false); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
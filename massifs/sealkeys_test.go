@@ -0,0 +1,73 @@
+package massifs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+func TestResealCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	oldKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	store := buildSealedLogWithKey(t, oldKey, 3, 10)
+	head, err := store.HeadIndex(ctx, storage.ObjectCheckpoint)
+	require.NoError(t, err)
+	oldTrusted := TrustedKey{KID: []byte("old"), Verifier: newES256Verifier(t, &oldKey.PublicKey)}
+	newTrusted := TrustedKey{KID: []byte("new"), Verifier: newES256Verifier(t, &newKey.PublicKey)}
+	newSigner, err := cose.NewSigner(cose.AlgorithmES256, newKey)
+	require.NoError(t, err)
+
+	// the old seals carry no kid, any trusted key which verifies them will do
+	_, err = GetContextVerified(ctx, store, nil, head, WithTrustedKeys(newTrusted, oldTrusted))
+	require.NoError(t, err)
+	_, err = GetContextVerified(ctx, store, nil, head, WithTrustedKeys(newTrusted))
+	require.ErrorIs(t, err, ErrSealVerifyFailed)
+
+	// a reseal must verify the seal it replaces
+	before, err := GetCheckpoint(ctx, store, head)
+	require.NoError(t, err)
+	_, err = ResealCheckpoint(ctx, store, head, newSigner, WithTrustedKeys(newTrusted))
+	require.ErrorIs(t, err, ErrSealVerifyFailed)
+	unchanged, err := GetCheckpoint(ctx, store, head)
+	require.NoError(t, err)
+	require.Equal(t, before.Raw, unchanged.Raw)
+
+	_, err = ResealCheckpoint(ctx, store, head, newSigner,
+		WithTrustedKeys(oldTrusted), WithCheckpointSignOptions(WithSealKID(newTrusted.KID)))
+	require.NoError(t, err)
+	after, err := GetCheckpoint(ctx, store, head)
+	require.NoError(t, err)
+	require.Equal(t, before.Receipt.Proof, after.Receipt.Proof)
+	kid, err := protectedHeaderKid(after.Receipt.ProtectedHeader)
+	require.NoError(t, err)
+	require.Equal(t, newTrusted.KID, kid)
+
+	// the resealed massif is verified by its kid, the others by the old key
+	trustBoth := WithTrustedKeys(oldTrusted, newTrusted)
+	vc, err := GetContextVerified(ctx, store, nil, head, trustBoth)
+	require.NoError(t, err)
+	require.Equal(t, before.MMRSize, vc.Checkpoint.MMRSize)
+	for i := range head {
+		_, err = GetContextVerified(ctx, store, nil, i, trustBoth)
+		require.NoError(t, err)
+	}
+
+	// a kid which is not trusted is refused, unless a verifier is also given
+	_, err = GetContextVerified(ctx, store, nil, head, WithTrustedKeys(oldTrusted))
+	require.ErrorIs(t, err, ErrUntrustedKey)
+	_, err = GetContextVerified(ctx, store, newTrusted.Verifier, head, WithTrustedKeys(oldTrusted))
+	require.NoError(t, err)
+	// and a trusted kid is verified only with its own key
+	_, err = GetContextVerified(ctx, store, nil, head,
+		WithTrustedKeys(TrustedKey{KID: newTrusted.KID, Verifier: oldTrusted.Verifier}))
+	require.ErrorIs(t, err, ErrSealVerifyFailed)
+}
@@ -0,0 +1,65 @@
+package massifs
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// SealMMRSizeLabel is the private-use protected header label under which a
+// checkpoint signs the mmr size it seals. The signature is otherwise over the
+// accumulator alone, and the size is only carried in the unprotected
+// consistency proof, so seals of different sizes with the same number of
+// peaks can not be told apart by their signatures. The 1005 offset follows
+// the receipt disclosures label.
+const SealMMRSizeLabel int64 = COSEPrivateStart - 1005
+
+var (
+	ErrNoSealMMRSize       = errors.New("the checkpoint protected header carries no mmr size")
+	ErrSealMMRSizeMismatch = errors.New("the signed mmr size is not the size of the consistency proof")
+)
+
+// WithSealMMRSize signs the mmr size of each seal, the tree-size-2 of its
+// consistency proof, in the checkpoint protected header under
+// SealMMRSizeLabel. Only seals signed with it can be evidence of
+// equivocation, see VerifyEquivocationProof.
+func WithSealMMRSize() CheckpointSignOption {
+	return func(o *CheckpointSignOptions) {
+		o.SignMMRSize = true
+	}
+}
+
+// ReadSealMMRSize returns the mmr size signed by a checkpoint's protected
+// header, ErrNoSealMMRSize if there is none.
+func ReadSealMMRSize(protectedHeader []byte) (uint64, error) {
+	var header map[int64]cbor.RawMessage
+	if err := cbor.Unmarshal(protectedHeader, &header); err != nil {
+		return 0, fmt.Errorf("decode protected header: %w", err)
+	}
+	raw, ok := header[SealMMRSizeLabel]
+	if !ok {
+		return 0, ErrNoSealMMRSize
+	}
+	var size uint64
+	if err := cbor.Unmarshal(raw, &size); err != nil {
+		return 0, fmt.Errorf("decode mmr size: %w", err)
+	}
+	return size, nil
+}
+
+// checkSealMMRSize returns an error if the checkpoint signs an mmr size which
+// is not that of its consistency proof.
+func checkSealMMRSize(receipt *CheckpointReceipt) error {
+	size, err := ReadSealMMRSize(receipt.ProtectedHeader)
+	if errors.Is(err, ErrNoSealMMRSize) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSealMMRSizeMismatch, err)
+	}
+	if size != receipt.Proof.TreeSize2 {
+		return fmt.Errorf("%w: signed %d, the proof is to %d", ErrSealMMRSizeMismatch, size, receipt.Proof.TreeSize2)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package massifs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+)
+
+// ErrSealRefresh is returned, with the replica's verified context, when a
+// stale seal could not be refreshed from the source, see WithSealRefresh.
+var ErrSealRefresh = errors.New("the stale seal could not be refreshed from the source")
+
+// SealAge returns the age, at now, of the seal of the massif for mmrSize: the
+// time since the idtimestamp of the last leaf it covers, which must be in the
+// massif.
+func SealAge(mc *MassifContext, mmrSize uint64, now time.Time) (time.Duration, error) {
+	leafCount := mmr.LeafCount(mmrSize)
+	if leafCount == 0 {
+		return 0, fmt.Errorf("%w: the seal of massif %d covers no leaves", ErrLeafRange, mc.Start.MassifIndex)
+	}
+	id, err := leafIDTimestamp(mc, leafCount-1)
+	if err != nil {
+		return 0, err
+	}
+	sealed, err := idTimestampTime(id, mc.Start.CommitmentEpoch)
+	if err != nil {
+		return 0, err
+	}
+	return now.Sub(sealed), nil
+}
+
+// refreshVerifiedContext returns vc unless its seal is older than
+// options.RefreshMaxAge. A stale massif is read again from
+// options.RefreshSource, with its checkpoint, and if that is sealed later it
+// is verified, as consistent with vc as well as against its own checkpoint,
+// and returned instead.
+//
+// A failure to find the age of the replica's seal, to read the source, or to
+// put to the sink, returns vc, or the refreshed context, with an error
+// wrapping ErrSealRefresh: the context returned is verified, the caller
+// decides whether a stale one will do. A
+// source which does not verify, or is not consistent with the replica, is a
+// plain verification error.
+func refreshVerifiedContext(ctx context.Context, vc *VerifiedContext, options VerifyOptions) (*VerifiedContext, error) {
+	age, err := SealAge(&vc.MassifContext, vc.Checkpoint.MMRSize, time.Now())
+	if err != nil {
+		return vc, fmt.Errorf("%w: massif %d: %w", ErrSealRefresh, vc.Start.MassifIndex, err)
+	}
+	if age <= options.RefreshMaxAge {
+		return vc, nil
+	}
+
+	massifIndex := vc.Start.MassifIndex
+	check, err := GetCheckpoint(ctx, options.RefreshSource, massifIndex)
+	if err != nil {
+		return vc, fmt.Errorf("%w: massif %d: %w", ErrSealRefresh, massifIndex, err)
+	}
+	if check.MMRSize <= vc.Checkpoint.MMRSize {
+		return vc, nil
+	}
+	mc, err := GetMassifContext(ctx, options.RefreshSource, massifIndex)
+	if err != nil {
+		return vc, fmt.Errorf("%w: massif %d: %w", ErrSealRefresh, massifIndex, err)
+	}
+
+	// The replica's unsealed data may extend past its seal, and the caller's
+	// trusted state may cover some of it, the larger is the base the source
+	// must be consistent with.
+	trusted := &MMRState{MMRSize: vc.Checkpoint.MMRSize, Peaks: vc.Accumulator}
+	if options.TrustedBaseState != nil && options.TrustedBaseState.MMRSize > trusted.MMRSize {
+		trusted = options.TrustedBaseState
+	}
+	options.Check = &check
+	options.TrustedBaseState = trusted
+	fresh, err := mc.VerifyContext(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.RefreshSink == nil {
+		return fresh, nil
+	}
+	// The massif first, so the sink never has a checkpoint for data it does
+	// not hold
+	if err = options.RefreshSink.Put(ctx, massifIndex, storage.ObjectMassifData, mc.Data, false); err != nil {
+		return fresh, fmt.Errorf("%w: massif %d: %w", ErrSealRefresh, massifIndex, err)
+	}
+	if err = options.RefreshSink.Put(ctx, massifIndex, storage.ObjectCheckpoint, check.Raw, false); err != nil {
+		return fresh, fmt.Errorf("%w: massif %d: %w", ErrSealRefresh, massifIndex, err)
+	}
+	return fresh, nil
+}
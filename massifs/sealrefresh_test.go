@@ -0,0 +1,97 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+func TestSealRefresh(t *testing.T) {
+	ctx := context.Background()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := cose.NewSigner(cose.AlgorithmES256, key)
+	require.NoError(t, err)
+	verifier := newES256Verifier(t, &key.PublicKey)
+
+	appendLeaves := func(l *Log, first, n int) {
+		var entries []LogEntry
+		for i := first; i < first+n; i++ {
+			leaf := sha256.Sum256(fmt.Appendf(nil, "refresh-leaf-%d", i))
+			entries = append(entries, LogEntry{IDTimestamp: uint64(i+1) * 10, Value: leaf[:]})
+		}
+		_, err := l.Append(ctx, entries...)
+		require.NoError(t, err)
+		_, err = l.Seal(ctx)
+		require.NoError(t, err)
+	}
+
+	source := newMemStore(nil, nil)
+	l, err := OpenLog(ctx, source, WithLogMassifHeight(3), WithLogSigner(signer))
+	require.NoError(t, err)
+	appendLeaves(l, 0, 2)
+	replica := newMemStore(bytes.Clone(source.massifs[0]), bytes.Clone(source.checkpoint[0]))
+	appendLeaves(l, 2, 1)
+	staleSize, freshSize := mmr.FirstMMRSize(mmr.MMRIndex(1)), mmr.FirstMMRSize(mmr.MMRIndex(2))
+
+	// the test idtimestamps are from 2004, so every seal is older than a day,
+	// and none older than a century
+	vc, err := GetContextVerified(ctx, replica, verifier, 0, WithSealRefresh(source, 100*365*24*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, staleSize, vc.Checkpoint.MMRSize)
+	age, err := SealAge(&vc.MassifContext, vc.Checkpoint.MMRSize, time.Now())
+	require.NoError(t, err)
+	require.Greater(t, age, 24*time.Hour)
+
+	vc, err = GetContextVerified(ctx, replica, verifier, 0, WithSealRefresh(source, 24*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, freshSize, vc.Checkpoint.MMRSize)
+	require.Equal(t, freshSize, vc.RangeCount())
+	// without a sink the replica is unchanged
+	check, err := GetCheckpoint(ctx, replica, 0)
+	require.NoError(t, err)
+	require.Equal(t, staleSize, check.MMRSize)
+
+	_, err = GetContextVerified(ctx, replica, verifier, 0,
+		WithSealRefresh(source, 24*time.Hour), WithSealRefreshSink(replica))
+	require.NoError(t, err)
+	require.Equal(t, source.massifs[0], replica.massifs[0])
+	require.Equal(t, source.checkpoint[0], replica.checkpoint[0])
+
+	// a source which is unavailable leaves the verified replica context
+	vc, err = GetContextVerified(ctx, replica, verifier, 0, WithSealRefresh(newMemStore(nil, nil), 24*time.Hour))
+	require.ErrorIs(t, err, ErrSealRefresh)
+	require.NotNil(t, vc)
+	require.Equal(t, freshSize, vc.Checkpoint.MMRSize)
+
+	// a source which has forked from the replica is refused
+	forked := newMemStore(nil, nil)
+	fl, err := OpenLog(ctx, forked, WithLogMassifHeight(3), WithLogSigner(signer))
+	require.NoError(t, err)
+	appendLeaves(fl, 1, 4)
+	_, err = GetContextVerified(ctx, replica, verifier, 0, WithSealRefresh(forked, 24*time.Hour))
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrSealRefresh)
+
+	_, err = GetContextVerified(ctx, replica, verifier, 0, WithSealRefreshSink(replica))
+	require.ErrorIs(t, err, ErrInvalidOptions)
+	// the refresh options are checked whether or not the log id is given
+	logID := storage.LogID(make([]byte, 16))
+	_, err = GetContextVerified(ctx, replica, verifier, 0,
+		WithVerifySealSubject(logID), WithSealRefreshSink(replica))
+	require.ErrorIs(t, err, ErrInvalidOptions)
+	_, err = GetContextVerified(ctx, replica, verifier, 0,
+		WithVerifySealSubject(logID), WithSealRefresh(source, -time.Hour))
+	require.ErrorIs(t, err, ErrInvalidOptions)
+}
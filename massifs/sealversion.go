@@ -0,0 +1,108 @@
+package massifs
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// SealVersionLabel is the private-use protected header label under which a
+// checkpoint attests the version of the software that sealed it, and the
+// massif format version of the sealed data. Being protected, the attestation
+// is covered by the checkpoint signature. The 1001 offset follows the
+// delegation proof label.
+const SealVersionLabel int64 = COSEPrivateStart - 1001
+
+var (
+	ErrNoSealVersion      = errors.New("the checkpoint protected header carries no seal version")
+	ErrSealVersionTooOld  = errors.New("the seal version is older than the minimum required")
+	ErrSealFormatMismatch = errors.New("the seal format version does not match the massif data")
+)
+
+// SealVersion is the attestation carried under SealVersionLabel. Auditing the
+// attestations across a population of logs shows which have been sealed by
+// software, and in a format, recent enough for a coordinated migration.
+type SealVersion struct {
+	// Builder is the release of the software which signed the seal
+	Builder BuilderVersion
+	// FormatVersion is the massif format version, see MassifStart.Version,
+	// of the data the seal commits to.
+	FormatVersion uint16
+}
+
+// sealVersionCBOR is the wire encoding of SealVersion: the builder version
+// is a [major, minor, patch] array.
+type sealVersionCBOR struct {
+	Builder       [3]uint8 `cbor:"1,keyasint"`
+	FormatVersion uint16   `cbor:"2,keyasint"`
+}
+
+// Less returns true if v is an earlier release than other
+func (v BuilderVersion) Less(other BuilderVersion) bool {
+	if v.Major != other.Major {
+		return v.Major < other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor < other.Minor
+	}
+	return v.Patch < other.Patch
+}
+
+// WithSealVersion attests the builder version and the massif format version
+// in the checkpoint protected header, under SealVersionLabel.
+func WithSealVersion(version SealVersion) CheckpointSignOption {
+	return func(o *CheckpointSignOptions) {
+		o.Version = &version
+	}
+}
+
+// ReadSealVersion returns the version attested by a checkpoint's protected
+// header. ErrNoSealVersion is returned for checkpoints sealed without one.
+func ReadSealVersion(protectedHeader []byte) (SealVersion, error) {
+	var header map[int64]cbor.RawMessage
+	if err := cbor.Unmarshal(protectedHeader, &header); err != nil {
+		return SealVersion{}, fmt.Errorf("decode protected header: %w", err)
+	}
+	raw, ok := header[SealVersionLabel]
+	if !ok {
+		return SealVersion{}, ErrNoSealVersion
+	}
+	var encoded sealVersionCBOR
+	if err := cbor.Unmarshal(raw, &encoded); err != nil {
+		return SealVersion{}, fmt.Errorf("decode seal version: %w", err)
+	}
+	return SealVersion{
+		Builder: BuilderVersion{
+			Major: encoded.Builder[0], Minor: encoded.Builder[1], Patch: encoded.Builder[2],
+		},
+		FormatVersion: encoded.FormatVersion,
+	}, nil
+}
+
+func (v SealVersion) encoded() sealVersionCBOR {
+	return sealVersionCBOR{
+		Builder:       [3]uint8{v.Builder.Major, v.Builder.Minor, v.Builder.Patch},
+		FormatVersion: v.FormatVersion,
+	}
+}
+
+// checkSealVersion returns an error unless the checkpoint attests a version
+// at least min, and a format version matching the massif data.
+func checkSealVersion(check *Checkpoint, min SealVersion, formatVersion uint16) error {
+	version, err := ReadSealVersion(check.Receipt.ProtectedHeader)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSealVersionTooOld, err)
+	}
+	if version.Builder.Less(min.Builder) {
+		return fmt.Errorf("%w: builder %s, require %s", ErrSealVersionTooOld, version.Builder, min.Builder)
+	}
+	if version.FormatVersion < min.FormatVersion {
+		return fmt.Errorf("%w: format %d, require %d", ErrSealVersionTooOld, version.FormatVersion, min.FormatVersion)
+	}
+	if version.FormatVersion != formatVersion {
+		return fmt.Errorf("%w: sealed format %d, the massif is format %d",
+			ErrSealFormatMismatch, version.FormatVersion, formatVersion)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package massifs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuilderVersionLess(t *testing.T) {
+	v := BuilderVersion{Major: 1, Minor: 2, Patch: 3}
+	require.True(t, v.Less(BuilderVersion{Major: 1, Minor: 2, Patch: 4}))
+	require.True(t, v.Less(BuilderVersion{Major: 1, Minor: 3}))
+	require.True(t, v.Less(BuilderVersion{Major: 2}))
+	require.False(t, v.Less(v))
+	require.False(t, v.Less(BuilderVersion{Major: 1, Minor: 1, Patch: 9}))
+}
+
+func TestVerifyContextSealVersion(t *testing.T) {
+	ctx := context.Background()
+	mc, signer, verifier := newReplicatorFixture(t, 3)
+
+	proof, err := BuildConsistencyProof(mc, 0, mc.RangeCount())
+	require.NoError(t, err)
+	accumulator, err := mmr.PeakHashes(mc, mc.RangeCount()-1)
+	require.NoError(t, err)
+
+	sign := func(opts ...CheckpointSignOption) *Checkpoint {
+		signed, err := SignCheckpointReceipt(signer, proof, accumulator, opts...)
+		require.NoError(t, err)
+		check, err := NewCheckpoint(signed)
+		require.NoError(t, err)
+		return &check
+	}
+
+	sealed := SealVersion{Builder: BuilderVersion{Major: 1, Minor: 4, Patch: 2}, FormatVersion: mc.Start.Version}
+	check := sign(WithSealVersion(sealed))
+
+	got, err := ReadSealVersion(check.Receipt.ProtectedHeader)
+	require.NoError(t, err)
+	require.Equal(t, sealed, got)
+	_, err = ReadSealVersion(sign().Receipt.ProtectedHeader)
+	require.ErrorIs(t, err, ErrNoSealVersion)
+
+	verify := func(check *Checkpoint, min SealVersion) error {
+		options := VerifyOptions{Check: check, COSEVerifier: verifier}
+		WithRequireMinSealVersion(min)(&options)
+		_, err := mc.VerifyContext(ctx, options)
+		return err
+	}
+
+	// the attestation is protected, so the seal still verifies without the option
+	_, err = mc.VerifyContext(ctx, VerifyOptions{Check: check, COSEVerifier: verifier})
+	require.NoError(t, err)
+
+	require.NoError(t, verify(check, SealVersion{Builder: BuilderVersion{Major: 1, Minor: 4}}))
+	require.NoError(t, verify(check, sealed))
+	require.ErrorIs(t, verify(check, SealVersion{Builder: BuilderVersion{Major: 1, Minor: 5}}), ErrSealVersionTooOld)
+	require.ErrorIs(t, verify(check, SealVersion{FormatVersion: mc.Start.Version + 1}), ErrSealVersionTooOld)
+	// a seal without the attestation is refused when a minimum is required
+	require.ErrorIs(t, verify(sign(), SealVersion{}), ErrSealVersionTooOld)
+	// as is a seal attesting a different format to the data
+	other := sign(WithSealVersion(SealVersion{Builder: sealed.Builder, FormatVersion: mc.Start.Version + 1}))
+	require.ErrorIs(t, verify(other, SealVersion{}), ErrSealFormatMismatch)
+}
@@ -0,0 +1,168 @@
+package massifs
+
+import (
+	"container/list"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"reflect"
+	"sync"
+
+	"github.com/veraison/go-cose"
+)
+
+// DefaultSignatureCacheSize is the capacity of a SignatureCache created with
+// a size of zero.
+const DefaultSignatureCacheSize = 1024
+
+// SignatureCache is a bounded record of successful COSE signature
+// verifications. Services verifying the same hot checkpoint many times a
+// second can skip the signature check after the first success. A cache hit
+// requires the same signature over the same signed content, the
+// Sig_structure, which includes the protected header and so any kid, checked
+// by the same verifier. Only successes are recorded, and the least recently
+// used entry is evicted when the cache is full.
+//
+// The verifier is part of every entry, so one cache can be shared by
+// verifications trusting different keys. A verifier which exposes its public
+// key, with a Public() crypto.PublicKey method, is identified by the key.
+// Others are identified by the verifier value, so the entries of one verifier
+// are only shared with copies of it, create a verifier once per key rather
+// than once per verification.
+type SignatureCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[[32]byte]*list.Element
+	// order holds the keys, most recently used first
+	order *list.List
+	// identities are those assigned to verifiers which do not expose their
+	// public key
+	identities map[cose.Verifier]uint64
+	next       uint64
+}
+
+// NewSignatureCache returns an empty cache holding at most size entries. Zero
+// selects DefaultSignatureCacheSize.
+func NewSignatureCache(size int) *SignatureCache {
+	if size <= 0 {
+		size = DefaultSignatureCacheSize
+	}
+	return &SignatureCache{
+		capacity:   size,
+		entries:    make(map[[32]byte]*list.Element, size),
+		order:      list.New(),
+		identities: map[cose.Verifier]uint64{},
+	}
+}
+
+// verifierIdentity returns the identity of the verifier, false if it has
+// none and its verifications can not be cached
+func (c *SignatureCache) verifierIdentity(verifier cose.Verifier) ([]byte, bool) {
+	alg := binary.BigEndian.AppendUint64(nil, uint64(verifier.Algorithm()))
+	if keyed, ok := verifier.(interface{ Public() crypto.PublicKey }); ok {
+		if der, err := x509.MarshalPKIXPublicKey(keyed.Public()); err == nil {
+			return append(append([]byte("key"), alg...), der...), true
+		}
+	}
+	if !reflect.TypeOf(verifier).Comparable() {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id, ok := c.identities[verifier]
+	if !ok {
+		// The identities of discarded verifiers are only forgotten when the
+		// map is cleared, their entries then age out.
+		if len(c.identities) >= c.capacity {
+			clear(c.identities)
+		}
+		c.next++
+		id = c.next
+		c.identities[verifier] = id
+	}
+	return binary.BigEndian.AppendUint64(append([]byte("instance"), alg...), id), true
+}
+
+// signatureCacheKey is H(H(verifier identity) || H(toBeSigned) || signature)
+func signatureCacheKey(identity, toBeSigned, signature []byte) [32]byte {
+	ih := sha256.Sum256(identity)
+	th := sha256.Sum256(toBeSigned)
+	return sha256.Sum256(append(append(ih[:], th[:]...), signature...))
+}
+
+// Verified returns true if the signature over toBeSigned has previously
+// been verified by verifier.
+func (c *SignatureCache) Verified(verifier cose.Verifier, toBeSigned, signature []byte) bool {
+	identity, ok := c.verifierIdentity(verifier)
+	if !ok {
+		return false
+	}
+	key := signatureCacheKey(identity, toBeSigned, signature)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if ok {
+		c.order.MoveToFront(e)
+	}
+	return ok
+}
+
+// Record notes a successful verification of the signature over toBeSigned by
+// verifier.
+func (c *SignatureCache) Record(verifier cose.Verifier, toBeSigned, signature []byte) {
+	identity, ok := c.verifierIdentity(verifier)
+	if !ok {
+		return
+	}
+	key := signatureCacheKey(identity, toBeSigned, signature)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(key)
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.([32]byte))
+	}
+}
+
+// Len returns the number of recorded verifications
+func (c *SignatureCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Verifier returns a cose.Verifier which consults the cache before verifier,
+// and records its successes. The verifiers of a key ring, as used for
+// checkpoints without a kid, are each cached.
+func (c *SignatureCache) Verifier(verifier cose.Verifier) cose.Verifier {
+	if ring, ok := verifier.(keyRingVerifier); ok {
+		cached := make(keyRingVerifier, len(ring))
+		for i, member := range ring {
+			cached[i] = c.Verifier(member)
+		}
+		return cached
+	}
+	return &cachingVerifier{Verifier: verifier, cache: c}
+}
+
+type cachingVerifier struct {
+	cose.Verifier
+	cache *SignatureCache
+}
+
+func (v *cachingVerifier) Verify(content, signature []byte) error {
+	if v.cache.Verified(v.Verifier, content, signature) {
+		return nil
+	}
+	if err := v.Verifier.Verify(content, signature); err != nil {
+		return err
+	}
+	v.cache.Record(v.Verifier, content, signature)
+	return nil
+}
@@ -0,0 +1,90 @@
+package massifs
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+// countingVerifier counts the signature checks made
+type countingVerifier struct {
+	cose.Verifier
+	verifies int
+}
+
+func (v *countingVerifier) Verify(content, signature []byte) error {
+	v.verifies++
+	return v.Verifier.Verify(content, signature)
+}
+
+func TestSignatureCache(t *testing.T) {
+	ctx := context.Background()
+	store, verifier := buildSealedLog(t, 3, 10)
+	counting := &countingVerifier{Verifier: verifier}
+	cache := NewSignatureCache(2)
+
+	verify := func(massifIndex uint32) {
+		_, err := GetContextVerified(ctx, store, counting, massifIndex, WithSignatureCache(cache))
+		require.NoError(t, err)
+	}
+	for range 3 {
+		verify(0)
+		verify(1)
+	}
+	require.Equal(t, 2, counting.verifies)
+
+	// massif 0 is the least recently used, so it is evicted
+	verify(2)
+	verify(1)
+	require.Equal(t, 3, counting.verifies)
+	verify(0)
+	require.Equal(t, 4, counting.verifies)
+	require.Equal(t, 2, cache.Len())
+
+	// a bad signature is never recorded, or accepted
+	check, err := NewCheckpoint(store.checkpoint[1])
+	require.NoError(t, err)
+	toBeSigned := SigStructure(check.Receipt.ProtectedHeader, []byte("other content"))
+	cached := cache.Verifier(verifier)
+	require.Error(t, cached.Verify(toBeSigned, check.Receipt.Signature))
+	require.Error(t, cached.Verify(toBeSigned, check.Receipt.Signature))
+	require.False(t, cache.Verified(verifier, toBeSigned, check.Receipt.Signature))
+
+	// a signature verified by one key is not accepted for another
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	other := newES256Verifier(t, &otherKey.PublicKey)
+	vc, err := GetContextVerified(ctx, store, verifier, 1)
+	require.NoError(t, err)
+	toBeSigned = SigStructure(check.Receipt.ProtectedHeader, DetachedPayload(vc.Accumulator))
+	require.NoError(t, cached.Verify(toBeSigned, check.Receipt.Signature))
+	require.True(t, cache.Verified(verifier, toBeSigned, check.Receipt.Signature))
+	require.False(t, cache.Verified(other, toBeSigned, check.Receipt.Signature))
+	require.Error(t, cache.Verifier(other).Verify(toBeSigned, check.Receipt.Signature))
+	_, err = GetContextVerified(ctx, store, other, 1, WithSignatureCache(cache))
+	require.Error(t, err)
+
+	// a verifier exposing its key shares the entries of every verifier of
+	// that key
+	keyed := &publicKeyVerifier{Verifier: newES256Verifier(t, &otherKey.PublicKey), key: &otherKey.PublicKey}
+	again := &publicKeyVerifier{Verifier: newES256Verifier(t, &otherKey.PublicKey), key: &otherKey.PublicKey}
+	cache.Record(keyed, toBeSigned, check.Receipt.Signature)
+	require.True(t, cache.Verified(again, toBeSigned, check.Receipt.Signature))
+	require.False(t, cache.Verified(other, toBeSigned, check.Receipt.Signature))
+}
+
+// publicKeyVerifier exposes the public key of the verifier
+type publicKeyVerifier struct {
+	cose.Verifier
+	key crypto.PublicKey
+}
+
+func (v *publicKeyVerifier) Public() crypto.PublicKey {
+	return v.key
+}
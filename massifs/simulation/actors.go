@@ -0,0 +1,146 @@
+package simulation
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/forestrie/go-merklelog/massifs"
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/veraison/go-cose"
+)
+
+// Builder appends one leaf per step, committing each, until it has added
+// Leaves. Leaf values are derived from the builder name and the leaf ordinal,
+// so the log built is the same for every schedule.
+type Builder struct {
+	ActorName    string
+	Store        *Store
+	Epoch        uint32
+	MassifHeight uint8
+	Leaves       int
+	CommitOpts   []massifs.Option
+
+	added int
+}
+
+func (b *Builder) Name() string { return b.ActorName }
+
+// Added returns the number of leaves committed
+func (b *Builder) Added() int { return b.added }
+
+func (b *Builder) Step(ctx context.Context) error {
+	if b.added >= b.Leaves {
+		return nil
+	}
+	view := b.Store.As(b.ActorName)
+	mc, err := massifs.GetAppendContext(ctx, view, b.Epoch, b.MassifHeight)
+	if err != nil {
+		return err
+	}
+	leaf := sha256.Sum256(fmt.Appendf(nil, "%s-leaf-%d", b.ActorName, b.added))
+	if _, err = mc.AddHashedLeaf(sha256.New(), uint64(b.added+1), nil, nil, nil, leaf[:]); err != nil {
+		return err
+	}
+	if err = massifs.CommitContext(ctx, view, &mc, b.CommitOpts...); err != nil {
+		return err
+	}
+	b.added++
+	return nil
+}
+
+// Sealer signs a checkpoint per step for the first massif with unsealed
+// nodes. It keeps no state of its own, the last checkpoint stored is the
+// state it seals on from, and it only moves on from a massif once the massif
+// is full and sealed.
+type Sealer struct {
+	ActorName string
+	Store     *Store
+	Signer    cose.Signer
+	SignOpts  []massifs.CheckpointSignOption
+}
+
+func (s *Sealer) Name() string { return s.ActorName }
+
+func (s *Sealer) Step(ctx context.Context) error {
+	view := s.Store.As(s.ActorName)
+
+	var sealedSize uint64
+	massifIndex, err := view.HeadIndex(ctx, storage.ObjectCheckpoint)
+	switch {
+	case storage.IsNotFound(err):
+		massifIndex = 0
+	case err != nil:
+		return err
+	default:
+		check, err := massifs.GetCheckpoint(ctx, view, massifIndex)
+		if err != nil {
+			return err
+		}
+		sealedSize = check.MMRSize
+	}
+
+	mc, err := massifs.GetMassifContext(ctx, view, massifIndex)
+	if storage.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if mc.RangeCount() == sealedSize && mc.Count() >= massifs.TreeCount(mc.Start.MassifHeight) {
+		massifIndex++
+		mc, err = massifs.GetMassifContext(ctx, view, massifIndex)
+		if storage.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if mc.RangeCount() == sealedSize {
+		return nil
+	}
+
+	proof, err := massifs.BuildConsistencyProof(&mc, sealedSize, mc.RangeCount())
+	if err != nil {
+		return err
+	}
+	accumulator, err := mmr.PeakHashes(&mc, mc.RangeCount()-1)
+	if err != nil {
+		return err
+	}
+	data, err := massifs.SignCheckpointReceipt(s.Signer, proof, accumulator, s.SignOpts...)
+	if err != nil {
+		return err
+	}
+	return view.Put(ctx, massifIndex, storage.ObjectCheckpoint, data, false)
+}
+
+// Replicator runs a VerifyingReplicator from Source to Sink each step, over
+// every massif the source has sealed.
+type Replicator struct {
+	ActorName    string
+	Source       *Store
+	Sink         *Store
+	COSEVerifier cose.Verifier
+}
+
+func (r *Replicator) Name() string { return r.ActorName }
+
+func (r *Replicator) Step(ctx context.Context) error {
+	source := r.Source.As(r.ActorName)
+	end, err := source.HeadIndex(ctx, storage.ObjectCheckpoint)
+	if storage.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	v := massifs.VerifyingReplicator{
+		COSEVerifier: r.COSEVerifier,
+		Source:       source,
+		Sink:         r.Sink.As(r.ActorName),
+	}
+	return v.ReplicateVerifiedUpdates(ctx, 0, end)
+}
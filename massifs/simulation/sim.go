@@ -0,0 +1,201 @@
+package simulation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+)
+
+var (
+	ErrUnknownActor  = errors.New("there is no actor of that name")
+	ErrNotQuiescent  = errors.New("the simulation did not reach quiescence in the steps allowed")
+	ErrActorsMissing = errors.New("a simulation needs at least one actor")
+)
+
+// Actor is a participant in a simulation. A step is one unit of its work, a
+// commit by a builder for example, and reaches storage only through a View of
+// an attached Store. Steps must be deterministic given the state of storage.
+type Actor interface {
+	Name() string
+	Step(ctx context.Context) error
+}
+
+// StepError is returned when an actor's step fails. The trace of the attached
+// stores shows the operations which led to it.
+type StepError struct {
+	Actor string
+	// Step counts the steps of the simulation, including preempting steps
+	Step int
+	Err  error
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("step %d of %s: %v", e.Step, e.Actor, e.Err)
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// Sim schedules the steps of its actors. Run chooses the order from the seed,
+// and may preempt a step after any storage operation it makes to run the
+// step of another actor. RunScript follows the order given, and preempts
+// only where a FaultPreempt is injected.
+type Sim struct {
+	// Preempt is the probability, in Run, that a storage operation is
+	// followed by the step of another actor before the operation returns.
+	Preempt float64
+
+	rng     *rand.Rand
+	actors  []Actor
+	running map[string]bool
+	random  bool
+	steps   int
+	writes  int
+	err     error
+}
+
+// New creates a simulation of the actors. The same seed and the same actors
+// give the same schedule.
+func New(seed uint64, actors ...Actor) *Sim {
+	return &Sim{
+		rng:     rand.New(rand.NewPCG(seed, seed)),
+		actors:  actors,
+		running: map[string]bool{},
+	}
+}
+
+// Attach schedules preemption on the operations of the stores, and counts
+// their writes towards progress. Every store the actors use should be
+// attached.
+func (s *Sim) Attach(stores ...*Store) {
+	for _, store := range stores {
+		store.mu.Lock()
+		store.onOp = s.onOp
+		store.mu.Unlock()
+	}
+}
+
+// Steps returns the number of steps taken so far
+func (s *Sim) Steps() int {
+	return s.steps
+}
+
+// Step runs one step of the named actor
+func (s *Sim) Step(ctx context.Context, name string) error {
+	actor, err := s.actor(name)
+	if err != nil {
+		return err
+	}
+	return s.step(ctx, actor)
+}
+
+// RunScript runs one step of each named actor, in order, stopping at the
+// first which fails.
+func (s *Sim) RunScript(ctx context.Context, names ...string) error {
+	for _, name := range names {
+		if err := s.Step(ctx, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run steps actors chosen at random until the simulation is quiescent: every
+// actor has taken a step, which wrote nothing, since the last write to an
+// attached store. It stops at the first step which fails, and returns
+// ErrNotQuiescent if the actors are still writing after maxSteps.
+func (s *Sim) Run(ctx context.Context, maxSteps int) error {
+	if len(s.actors) == 0 {
+		return ErrActorsMissing
+	}
+	s.random = true
+	defer func() { s.random = false }()
+
+	idle := map[string]bool{}
+	for range maxSteps {
+		actor := s.actors[s.rng.IntN(len(s.actors))]
+		writes := s.writes
+		if err := s.step(ctx, actor); err != nil {
+			return err
+		}
+		// a write during the step, by the actor or by one preempting it,
+		// may be work for any of them
+		if s.writes != writes {
+			clear(idle)
+			continue
+		}
+		idle[actor.Name()] = true
+		if len(idle) == len(s.actors) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %d steps", ErrNotQuiescent, maxSteps)
+}
+
+func (s *Sim) actor(name string) (Actor, error) {
+	i := slices.IndexFunc(s.actors, func(a Actor) bool { return a.Name() == name })
+	if i < 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownActor, name)
+	}
+	return s.actors[i], nil
+}
+
+// step runs a step of the actor. A failure of a step which preempted it is
+// returned in preference to its own, as it is the cause.
+func (s *Sim) step(ctx context.Context, actor Actor) error {
+	name := actor.Name()
+	s.running[name] = true
+	defer delete(s.running, name)
+	s.steps++
+	step := s.steps
+	err := actor.Step(ctx)
+	if s.err != nil {
+		err, s.err = s.err, nil
+		return err
+	}
+	if err != nil {
+		return &StepError{Actor: name, Step: step, Err: err}
+	}
+	return nil
+}
+
+// onOp is the hook of the attached stores. An actor can not preempt itself,
+// so preemption nests at most once per actor.
+func (s *Sim) onOp(ctx context.Context, op Op) {
+	if op.Kind == OpWrite && op.Err == nil {
+		s.writes++
+	}
+	var preempt []Actor
+	switch {
+	case op.Fault != nil && op.Fault.Action == FaultPreempt:
+		for _, name := range op.Fault.Preempt {
+			actor, err := s.actor(name)
+			if err != nil {
+				s.fail(err)
+				return
+			}
+			preempt = append(preempt, actor)
+		}
+	case s.random && s.rng.Float64() < s.Preempt:
+		preempt = append(preempt, s.actors[s.rng.IntN(len(s.actors))])
+	}
+	for _, actor := range preempt {
+		if s.running[actor.Name()] {
+			continue
+		}
+		if err := s.step(ctx, actor); err != nil {
+			s.fail(err)
+			return
+		}
+	}
+}
+
+// fail records the first failure of a preempting step
+func (s *Sim) fail(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+}
@@ -0,0 +1,200 @@
+package simulation
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/massifs"
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+type fixture struct {
+	source, sink *Store
+	builder      *Builder
+	sealer       *Sealer
+	replicator   *Replicator
+	verifier     cose.Verifier
+}
+
+// newFixture creates a builder, sealer and replicator for a log of massif
+// height 3, 4 leaves per massif.
+func newFixture(t *testing.T, leaves int) *fixture {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := cose.NewSigner(cose.AlgorithmES256, key)
+	require.NoError(t, err)
+	verifier, err := cose.NewVerifier(cose.AlgorithmES256, &key.PublicKey)
+	require.NoError(t, err)
+
+	f := &fixture{source: NewStore(), sink: NewStore(), verifier: verifier}
+	f.builder = &Builder{ActorName: "builder", Store: f.source, Epoch: 1, MassifHeight: 3, Leaves: leaves}
+	f.sealer = &Sealer{ActorName: "sealer", Store: f.source, Signer: signer}
+	f.replicator = &Replicator{ActorName: "replicator", Source: f.source, Sink: f.sink, COSEVerifier: verifier}
+	return f
+}
+
+func (f *fixture) sim(seed uint64, extra ...Actor) *Sim {
+	sim := New(seed, append([]Actor{f.builder, f.sealer, f.replicator}, extra...)...)
+	sim.Attach(f.source, f.sink)
+	return sim
+}
+
+// requireReplicated requires the latest objects of the sink to be those of
+// the source.
+func (f *fixture) requireReplicated(t *testing.T) {
+	t.Helper()
+	for _, otype := range []storage.ObjectType{storage.ObjectMassifData, storage.ObjectCheckpoint} {
+		head, err := f.source.head(otype)
+		require.NoError(t, err)
+		for i := range head + 1 {
+			want, err := f.source.read(context.Background(), "test", otype, i)
+			require.NoError(t, err)
+			got, err := f.sink.read(context.Background(), "test", otype, i)
+			require.NoError(t, err, "%v %d", otype, i)
+			require.Equal(t, want, got, "%v %d", otype, i)
+		}
+	}
+}
+
+// naiveReplicator reads the massif before its seal, which is the order
+// bug#10530 was fixed by reversing.
+type naiveReplicator struct {
+	source   *Store
+	verifier cose.Verifier
+}
+
+func (r *naiveReplicator) Name() string { return "naive" }
+
+func (r *naiveReplicator) Step(ctx context.Context) error {
+	view := r.source.As(r.Name())
+	mc, err := massifs.GetMassifContext(ctx, view, 0)
+	if err != nil {
+		return err
+	}
+	check, err := massifs.GetCheckpoint(ctx, view, 0)
+	if err != nil {
+		return err
+	}
+	_, err = mc.VerifyContext(ctx, massifs.VerifyOptions{Check: &check, COSEVerifier: r.verifier})
+	return err
+}
+
+func TestRandomSchedules(t *testing.T) {
+	ctx := context.Background()
+	for seed := range uint64(24) {
+		t.Run(fmt.Sprintf("seed-%d", seed), func(t *testing.T) {
+			f := newFixture(t, 10)
+			sim := f.sim(seed)
+			sim.Preempt = 0.25
+			require.NoError(t, sim.Run(ctx, 2000))
+			require.Equal(t, 10, f.builder.Added())
+			f.requireReplicated(t)
+		})
+	}
+}
+
+func TestScheduleIsDeterministic(t *testing.T) {
+	ctx := context.Background()
+	run := func() []string {
+		f := newFixture(t, 6)
+		sim := f.sim(7)
+		sim.Preempt = 0.5
+		require.NoError(t, sim.Run(ctx, 2000))
+		var ops []string
+		for _, op := range append(f.source.Trace(), f.sink.Trace()...) {
+			ops = append(ops, op.String())
+		}
+		return ops
+	}
+	require.Equal(t, run(), run())
+}
+
+func TestBug10530SealReadOrder(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t, 3)
+	naive := &naiveReplicator{source: f.source, verifier: f.verifier}
+	sim := f.sim(0, naive)
+	require.NoError(t, sim.RunScript(ctx, "builder", "sealer"))
+
+	// the builder commits, and the sealer seals the larger log, between the
+	// reads of the massif and of its seal
+	f.source.Inject(Fault{
+		Actor: "naive", Kind: OpRead, Type: storage.ObjectMassifData, MassifIndex: 0,
+		Action: FaultPreempt, Preempt: []string{"builder", "sealer"},
+	})
+	err := sim.Step(ctx, "naive")
+	require.ErrorIs(t, err, massifs.ErrStateSizeExceedsData)
+
+	// reading the seal first, the same interleaving verifies
+	f.source.Inject(Fault{
+		Actor: "replicator", Kind: OpRead, Type: storage.ObjectCheckpoint, MassifIndex: 0,
+		Action: FaultPreempt, Preempt: []string{"builder", "sealer"},
+	})
+	require.NoError(t, sim.Step(ctx, "replicator"))
+	require.Equal(t, 3, f.builder.Added())
+	require.Equal(t, 3, f.source.Versions(storage.ObjectCheckpoint, 0))
+	require.NoError(t, sim.RunScript(ctx, "replicator"))
+	f.requireReplicated(t)
+}
+
+func TestSinkWriteFailureRecovers(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t, 6)
+	sim := f.sim(0)
+	require.NoError(t, sim.RunScript(ctx, "builder", "builder", "sealer", "replicator"))
+
+	// the massif data lands, its checkpoint does not
+	f.sink.Inject(Fault{Kind: OpWrite, Type: storage.ObjectCheckpoint, MassifIndex: AnyMassif})
+	require.NoError(t, sim.RunScript(ctx, "builder", "builder", "builder", "sealer"))
+	err := sim.Step(ctx, "replicator")
+	require.ErrorIs(t, err, ErrInjected)
+	var stepErr *StepError
+	require.ErrorAs(t, err, &stepErr)
+	require.Equal(t, "replicator", stepErr.Actor)
+
+	require.NoError(t, sim.Run(ctx, 2000))
+	f.requireReplicated(t)
+}
+
+func TestStaleSourceReadIsRejected(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t, 3)
+	sim := f.sim(0)
+	require.NoError(t, sim.RunScript(ctx, "builder", "sealer", "replicator", "builder", "builder", "sealer"))
+
+	// a lagging replica of the source serves the massif as it was before
+	// the last two commits, while serving the latest seal
+	f.source.Inject(Fault{Actor: "replicator", Kind: OpRead, Type: storage.ObjectMassifData, MassifIndex: 0, Action: FaultStale})
+	err := sim.Step(ctx, "replicator")
+	require.ErrorIs(t, err, massifs.ErrStateSizeExceedsData)
+
+	require.NoError(t, sim.Run(ctx, 2000))
+	f.requireReplicated(t)
+}
+
+func TestDelayedWritesReorder(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t, 2)
+	sim := f.sim(0)
+
+	// the first seal becomes visible after the second
+	f.source.Inject(Fault{Kind: OpWrite, Type: storage.ObjectCheckpoint, MassifIndex: 0, Action: FaultDelay})
+	require.NoError(t, sim.RunScript(ctx, "builder", "sealer", "builder"))
+	require.Equal(t, 0, f.source.Versions(storage.ObjectCheckpoint, 0))
+	require.NoError(t, sim.RunScript(ctx, "sealer"))
+	f.source.Release()
+	require.Equal(t, 2, f.source.Versions(storage.ObjectCheckpoint, 0))
+
+	// the replica follows the older seal, which is still a valid one
+	require.NoError(t, sim.RunScript(ctx, "replicator"))
+	check, err := massifs.GetCheckpoint(ctx, f.sink.As("test"), 0)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), check.MMRSize)
+}
@@ -0,0 +1,333 @@
+// Package simulation is a deterministic harness for the races between log
+// builders, sealers and replicators. The actors share a Store, an in memory
+// object store which records every operation and into which reorderings and
+// failures can be injected, and a Sim interleaves their steps, either as
+// scripted or in an order chosen from a seed. A failing seed reproduces the
+// same interleaving every time it is run.
+package simulation
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+)
+
+// ErrInjected is the default error of a Fault
+var ErrInjected = errors.New("injected storage failure")
+
+// OpKind distinguishes the operations a Fault matches
+type OpKind uint8
+
+const (
+	OpRead OpKind = iota
+	OpWrite
+)
+
+func (k OpKind) String() string {
+	if k == OpWrite {
+		return "write"
+	}
+	return "read"
+}
+
+// AnyMassif matches every massif index in a Fault
+const AnyMassif = storage.HeadMassifIndex
+
+// FaultAction is what happens to an operation matched by a Fault
+type FaultAction uint8
+
+const (
+	// FaultFail fails the operation with the fault's Err
+	FaultFail FaultAction = iota
+	// FaultStale serves a read from the version of the object before the
+	// current one, as an eventually consistent store may. A read of an
+	// object with only one version fails as not found.
+	FaultStale
+	// FaultDelay accepts a write but does not make it visible until
+	// Store.Release, so later writes can become visible first.
+	FaultDelay
+	// FaultPreempt lets the operation complete, then steps the actors named
+	// by the fault's Preempt before returning to the caller. This places the
+	// steps of other actors at an exact point within a step of the caller.
+	FaultPreempt
+)
+
+// Fault injects an action into the operations it matches. Skip matching
+// operations are let through first, then the next Count are acted on. Count
+// defaults to 1.
+type Fault struct {
+	// Actor matches the operations of one actor, all actors if empty
+	Actor       string
+	Kind        OpKind
+	Type        storage.ObjectType
+	MassifIndex uint32
+	Action      FaultAction
+	Skip        int
+	Count       int
+	// Err is returned by FaultFail, ErrInjected if nil
+	Err error
+	// Preempt names the actors FaultPreempt steps, in order
+	Preempt []string
+}
+
+// Op is the record of one storage operation
+type Op struct {
+	Seq         int
+	Actor       string
+	Kind        OpKind
+	Type        storage.ObjectType
+	MassifIndex uint32
+	Size        int
+	// Fault is set if the operation was acted on by a fault
+	Fault *Fault
+	Err   error
+}
+
+func (op Op) String() string {
+	s := fmt.Sprintf("%d %s %s %v %d (%d bytes)", op.Seq, op.Actor, op.Kind, op.Type, op.MassifIndex, op.Size)
+	if op.Fault != nil {
+		s += fmt.Sprintf(" fault=%d", op.Fault.Action)
+	}
+	if op.Err != nil {
+		s += " err=" + op.Err.Error()
+	}
+	return s
+}
+
+type objectKey struct {
+	otype       storage.ObjectType
+	massifIndex uint32
+}
+
+type delayedWrite struct {
+	key  objectKey
+	data []byte
+}
+
+// Store is an in memory massifs.ObjectReaderWriter shared by the actors of a
+// simulation. Every object keeps all its versions, reads return copies, and
+// every operation is appended to the trace. Each actor uses a view of the
+// store, see As, so the trace records who did what.
+type Store struct {
+	mu       sync.Mutex
+	versions map[objectKey][][]byte
+	faults   []*faultState
+	delayed  []delayedWrite
+	trace    []Op
+
+	// onOp is called, without the lock held, after each operation. A Sim
+	// uses it to preempt the actor making the operation.
+	onOp func(ctx context.Context, op Op)
+}
+
+type faultState struct {
+	Fault
+	seen int
+}
+
+func NewStore() *Store {
+	return &Store{versions: map[objectKey][][]byte{}}
+}
+
+// Inject adds a fault. Faults are matched in the order they were added, the
+// first which acts on an operation wins.
+func (s *Store) Inject(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f.Count == 0 {
+		f.Count = 1
+	}
+	if f.Err == nil {
+		f.Err = ErrInjected
+	}
+	s.faults = append(s.faults, &faultState{Fault: f})
+}
+
+// Release makes the delayed writes visible, last delayed first, so they are
+// reordered with respect to each other as well as to the writes made since.
+func (s *Store) Release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.delayed) - 1; i >= 0; i-- {
+		w := s.delayed[i]
+		s.versions[w.key] = append(s.versions[w.key], w.data)
+	}
+	s.delayed = nil
+}
+
+// Trace returns the operations made so far
+func (s *Store) Trace() []Op {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.trace)
+}
+
+// Versions returns the number of visible versions of the object
+func (s *Store) Versions(otype storage.ObjectType, massifIndex uint32) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.versions[objectKey{normalType(otype), massifIndex}])
+}
+
+// As returns a view of the store whose operations are traced as by actor
+func (s *Store) As(actor string) *View {
+	return &View{store: s, actor: actor}
+}
+
+// match returns the fault which acts on the operation, if any
+func (s *Store) match(actor string, kind OpKind, key objectKey) *Fault {
+	for _, f := range s.faults {
+		if (f.Actor != "" && f.Actor != actor) || f.Kind != kind || f.Type != key.otype ||
+			(f.MassifIndex != AnyMassif && f.MassifIndex != key.massifIndex) {
+			continue
+		}
+		f.seen++
+		if f.seen <= f.Skip || f.seen > f.Skip+f.Count {
+			continue
+		}
+		fault := f.Fault
+		return &fault
+	}
+	return nil
+}
+
+func (s *Store) record(op Op) Op {
+	op.Seq = len(s.trace)
+	s.trace = append(s.trace, op)
+	return op
+}
+
+// notify passes the operation to the hook, if there is one
+func (s *Store) notify(ctx context.Context, op Op) {
+	s.mu.Lock()
+	onOp := s.onOp
+	s.mu.Unlock()
+	if onOp != nil {
+		onOp(ctx, op)
+	}
+}
+
+func (s *Store) read(ctx context.Context, actor string, otype storage.ObjectType, massifIndex uint32) ([]byte, error) {
+	s.mu.Lock()
+	key := objectKey{normalType(otype), massifIndex}
+	op := Op{Actor: actor, Kind: OpRead, Type: key.otype, MassifIndex: massifIndex}
+	op.Fault = s.match(actor, OpRead, key)
+
+	versions := s.versions[key]
+	if op.Fault != nil {
+		switch op.Fault.Action {
+		case FaultFail:
+			op.Err = op.Fault.Err
+		case FaultStale:
+			versions = versions[:max(len(versions)-1, 0)]
+		}
+	}
+	if op.Err == nil && len(versions) == 0 {
+		op.Err = storage.NewNotFoundError(nil, key.otype, massifIndex)
+	}
+	var data []byte
+	if op.Err == nil {
+		data = bytes.Clone(versions[len(versions)-1])
+		op.Size = len(data)
+	}
+	op = s.record(op)
+	s.mu.Unlock()
+	s.notify(ctx, op)
+	return data, op.Err
+}
+
+func (s *Store) write(
+	ctx context.Context, actor string, otype storage.ObjectType, massifIndex uint32, data []byte, failIfExists bool,
+) error {
+	s.mu.Lock()
+	key := objectKey{normalType(otype), massifIndex}
+	op := Op{Actor: actor, Kind: OpWrite, Type: key.otype, MassifIndex: massifIndex, Size: len(data)}
+	op.Fault = s.match(actor, OpWrite, key)
+	switch {
+	case op.Fault != nil && op.Fault.Action == FaultFail:
+		op.Err = op.Fault.Err
+	case failIfExists && len(s.versions[key]) > 0:
+		op.Err = fmt.Errorf("%w: %v %d", storage.ErrExistsOC, key.otype, massifIndex)
+	case op.Fault != nil && op.Fault.Action == FaultDelay:
+		s.delayed = append(s.delayed, delayedWrite{key: key, data: bytes.Clone(data)})
+	default:
+		s.versions[key] = append(s.versions[key], bytes.Clone(data))
+	}
+	op = s.record(op)
+	s.mu.Unlock()
+	s.notify(ctx, op)
+	return op.Err
+}
+
+func (s *Store) head(otype storage.ObjectType) (uint32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	otype = normalType(otype)
+	found := false
+	var head uint32
+	for key := range s.versions {
+		if key.otype == otype {
+			head = max(head, key.massifIndex)
+			found = true
+		}
+	}
+	if !found {
+		if otype == storage.ObjectCheckpoint {
+			return 0, storage.NewNotFoundError(nil, otype, storage.HeadMassifIndex)
+		}
+		return 0, storage.NewLogEmptyError(nil)
+	}
+	return head, nil
+}
+
+func normalType(otype storage.ObjectType) storage.ObjectType {
+	if otype == storage.ObjectMassifStart {
+		return storage.ObjectMassifData
+	}
+	return otype
+}
+
+// View is the massifs.ObjectReaderWriter an actor uses to reach a Store.
+// Nothing is cached, every read is an operation on the store.
+type View struct {
+	store *Store
+	actor string
+}
+
+func (v *View) HeadIndex(ctx context.Context, otype storage.ObjectType) (uint32, error) {
+	return v.store.head(otype)
+}
+
+func (v *View) MassifData(massifIndex uint32) ([]byte, bool, error) {
+	data, err := v.store.read(context.Background(), v.actor, storage.ObjectMassifData, massifIndex)
+	return data, err == nil, err
+}
+
+func (v *View) CheckpointData(massifIndex uint32) ([]byte, bool, error) {
+	data, err := v.store.read(context.Background(), v.actor, storage.ObjectCheckpoint, massifIndex)
+	return data, err == nil, err
+}
+
+func (v *View) MassifReadN(ctx context.Context, massifIndex uint32, n int) ([]byte, error) {
+	data, err := v.store.read(ctx, v.actor, storage.ObjectMassifData, massifIndex)
+	if err != nil {
+		return nil, err
+	}
+	if n >= 0 && n < len(data) {
+		return data[:n], nil
+	}
+	return data, nil
+}
+
+func (v *View) CheckpointRead(ctx context.Context, massifIndex uint32) ([]byte, error) {
+	return v.store.read(ctx, v.actor, storage.ObjectCheckpoint, massifIndex)
+}
+
+func (v *View) Put(ctx context.Context, massifIndex uint32, ty storage.ObjectType, data []byte, failIfExists bool) error {
+	return v.store.write(ctx, v.actor, ty, massifIndex, data, failIfExists)
+}
@@ -0,0 +1,93 @@
+package snowflakeid
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the time source for the id generator. The generator reads the wall
+// clock once, when it is initialized, to align with the commitment epoch.
+// After that it only ever reads the monotonic clock, see
+// IDState.millisecondMonotonicNow.
+//
+// Service code should leave Config.Clock unset, which selects the system
+// clock. Tests and load simulators can supply their own implementation (see
+// ManualClock) to drive the generator deterministically.
+type Clock interface {
+	// Wall returns the current wall clock time.
+	Wall() time.Time
+	// Monotonic returns the time elapsed since an arbitrary, fixed, origin. It
+	// must never go backwards.
+	Monotonic() time.Duration
+}
+
+// systemClock is the default Clock, based on time.Now
+type systemClock struct {
+	origin time.Time // includes the monotonic clock reading
+}
+
+func newSystemClock() *systemClock {
+	return &systemClock{origin: time.Now()}
+}
+
+// NewSystemClock returns the Clock the generator uses when Config.Clock is
+// unset, for code which reads the time the generator does.
+func NewSystemClock() Clock {
+	return newSystemClock()
+}
+
+func (c *systemClock) Wall() time.Time {
+	// DONT do UTC() here, as that strips the monotonic time sample
+	return time.Now()
+}
+
+func (c *systemClock) Monotonic() time.Duration {
+	return time.Since(c.origin)
+}
+
+// ManualClock is a Clock which only moves when told to. It is safe for
+// concurrent use. Not advancing it simulates a clock pause, setting the wall
+// clock before the generator is created simulates any point in the epoch,
+// including its end.
+type ManualClock struct {
+	mu        sync.Mutex
+	wall      time.Time
+	monotonic time.Duration
+}
+
+// NewManualClock returns a ManualClock reading wall
+func NewManualClock(wall time.Time) *ManualClock {
+	return &ManualClock{wall: wall}
+}
+
+func (c *ManualClock) Wall() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.wall
+}
+
+func (c *ManualClock) Monotonic() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.monotonic
+}
+
+// Advance moves both the wall and the monotonic clock forward by d. Negative
+// durations are ignored, the monotonic clock can not go backwards.
+func (c *ManualClock) Advance(d time.Duration) {
+	if d < 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.wall = c.wall.Add(d)
+	c.monotonic += d
+}
+
+// SetWall adjusts the wall clock only, as an ntp correction would. The
+// generator is unaffected once initialized.
+func (c *ManualClock) SetWall(wall time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.wall = wall
+}
@@ -0,0 +1,103 @@
+package snowflakeid
+
+import (
+	"testing"
+	"time"
+)
+
+func newManualIDState(t *testing.T, clock Clock) *IDState {
+	t.Helper()
+	s, err := NewIDState(Config{
+		CommitmentEpoch: 1,
+		WorkerCIDR:      "0.0.0.0/24", // 8 sequence bits
+		PodIP:           "10.0.0.1",
+		AllowSpins:      MaxSpins,
+		Clock:           clock,
+	})
+	if err != nil {
+		t.Fatalf("NewIDState: %v", err)
+	}
+	return s
+}
+
+func TestManualClock_Deterministic(t *testing.T) {
+	start := EpochTimeUTC(1).Add(1000 * time.Millisecond)
+
+	gen := func() []uint64 {
+		s := newManualIDState(t, NewManualClock(start))
+		var ids []uint64
+		for range 3 {
+			id, err := s.NextID()
+			if err != nil {
+				t.Fatalf("NextID: %v", err)
+			}
+			ids = append(ids, id)
+		}
+		return ids
+	}
+
+	a, b := gen(), gen()
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("id %d differs: %016x != %016x", i, a[i], b[i])
+		}
+	}
+	if ms, _ := IDMilliSplit(a[0]); ms != 1000 {
+		t.Fatalf("expected the first id at epoch millisecond 1000, got %d", ms)
+	}
+}
+
+func TestManualClock_PauseAndSequenceExhaustion(t *testing.T) {
+	clock := NewManualClock(EpochTimeUTC(1))
+	s := newManualIDState(t, clock)
+	clock.Advance(time.Millisecond)
+
+	// With the clock paused, every id comes from the same millisecond until
+	// the sequence is exhausted.
+	var last uint64
+	for i := uint64(0); i <= s.seqMask; i++ {
+		id, err := s.NextID()
+		if err != nil {
+			t.Fatalf("NextID: %v", err)
+		}
+		if ms, _ := IDMilliSplit(id); ms != 1 {
+			t.Fatalf("id %d: expected millisecond 1, got %d", i, ms)
+		}
+		if id <= last {
+			t.Fatalf("id %d: not monotonic", i)
+		}
+		last = id
+	}
+
+	// The generator forces the next millisecond rather than overflow.
+	id, err := s.NextID()
+	if err != nil {
+		t.Fatalf("NextID: %v", err)
+	}
+	if ms, _ := IDMilliSplit(id); ms != 2 {
+		t.Fatalf("expected the forced millisecond 2, got %d", ms)
+	}
+
+	// A wall clock adjustment after initialization has no effect.
+	clock.SetWall(EpochTimeUTC(1).Add(-time.Hour))
+	clock.Advance(10 * time.Millisecond)
+	id, err = s.NextID()
+	if err != nil {
+		t.Fatalf("NextID: %v", err)
+	}
+	if ms, _ := IDMilliSplit(id); ms != 11 {
+		t.Fatalf("expected millisecond 11, got %d", ms)
+	}
+}
+
+func TestManualClock_EpochEndIsRejected(t *testing.T) {
+	_, err := NewIDState(Config{
+		CommitmentEpoch: 1,
+		WorkerCIDR:      "0.0.0.0/24",
+		PodIP:           "10.0.0.1",
+		Clock:           NewManualClock(UnixNanoEpochEndSentinel.Add(time.Hour)),
+	})
+	if err == nil {
+		t.Fatalf("expected a clock error")
+	}
+}
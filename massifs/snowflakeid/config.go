@@ -21,6 +21,15 @@ type Config struct {
 	// to error when there is high contention. We do not support an infinite
 	// number of spins, and for that reason we use a narrow type
 	AllowSpins uint8
+
+	// Clock is the time source for the generator. Leave it nil to use the
+	// system clock, it is provided so that tests and simulations can drive the
+	// generator deterministically (see ManualClock).
+	Clock Clock
+
+	// Observer, if set, is told of the CAS retries, overloads and sequence
+	// exhaustion of every call to NextID, see Observer.
+	Observer Observer
 }
 
 const (
@@ -1,6 +1,7 @@
 package snowflakeid
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync/atomic"
@@ -28,9 +29,10 @@ type IDState struct {
 	seqMask uint64
 	seqBits int
 
+	clock                    Clock
 	epochStartWallClock      time.Time     // will *not* include the monotonic clock reading
-	generatorStart           time.Time     // Will include the monotonic clock reading
-	generatorStartWallOffset time.Duration // generatorStart - epochStart, does NOT include monotonic reading
+	generatorStart           time.Duration // the monotonic clock reading when the generator was initialized
+	generatorStartWallOffset time.Duration // generator start wall time - epochStart, does NOT include monotonic reading
 
 	// monotonic is our state variable which includes the timestamp and the
 	// sequence number but *not* the machine id.
@@ -44,6 +46,9 @@ type IDState struct {
 	// than overflow the sequence counter into the machine field. The impact of
 	// that error is simply to slow us down.
 	monotonic atomic.Uint64
+
+	// observer, if set, is told of the contention events, see Observer
+	observer Observer
 }
 
 var (
@@ -64,7 +69,10 @@ func NewIDState(cfg Config) (*IDState, error) {
 		return nil, err
 	}
 
-	s := &IDState{}
+	s := &IDState{clock: cfg.Clock, observer: cfg.Observer}
+	if s.clock == nil {
+		s.clock = newSystemClock()
+	}
 	err = s.initTime(cfg.CommitmentEpoch)
 	if err != nil {
 		return nil, err
@@ -99,14 +107,14 @@ func EpochTimeUTC(epoch uint8) time.Time {
 // a reference wall clock time read when the process initialized the IDState
 func (s *IDState) millisecondMonotonicNow() uint64 {
 
-	now := time.Now()
+	now := s.clock.Monotonic()
 
-	// Both now & generatorStart have a monotonic sample, so Sub gives a
-	// duration result which preserves that. This means NextID would not see
-	// negative time adjustments. On systems that sleep, it may however see
-	// clock 'pauses'. The same mechanism that makes NextID robust in the face
-	// of using wall clock time also guards against this.
-	epochNow := now.Sub(s.generatorStart) + s.generatorStartWallOffset
+	// Both now & generatorStart are monotonic samples, so the difference
+	// preserves that. This means NextID would not see negative time
+	// adjustments. On systems that sleep, it may however see clock 'pauses'.
+	// The same mechanism that makes NextID robust in the face of using wall
+	// clock time also guards against this.
+	epochNow := now - s.generatorStart + s.generatorStartWallOffset
 	return uint64(epochNow / time.Millisecond)
 }
 
@@ -116,6 +124,16 @@ func (s *IDState) millisecondMonotonicNow() uint64 {
 // error condition is likely to hit due to high load, a sleep with jitter is
 // considered the best approach as this will avoid thundering herd issues.
 func (s *IDState) NextID() (uint64, error) {
+	return s.nextID(nil)
+}
+
+// NextIDContext is NextID, and also reports the contention events to the
+// Observer carried by ctx, see WithObserver.
+func (s *IDState) NextIDContext(ctx context.Context) (uint64, error) {
+	return s.nextID(ObserverFromContext(ctx))
+}
+
+func (s *IDState) nextID(ctxObserver Observer) (uint64, error) {
 
 	// We do a read/modify/write on the monotonic state variable. The
 	// sync/atomic primitives guarantee the memory model for each operation. In
@@ -155,9 +173,12 @@ func (s *IDState) NextID() (uint64, error) {
 	// https://github.com/godruoyi/go-snowflake/blob/master/atomic_resolver.go
 
 	var next uint64
+	var spins int
+	var exhausted bool
 
 	// note: allowSpins == 0 is supported and simply means try once
-	for i := 0; i <= s.allowSpins; i++ {
+	for ; spins <= s.allowSpins; spins++ {
+		exhausted = false
 
 		// The following line would use wall clock time always and this would
 		// produce timestamps with a smoother relationship to wall clock (ntp
@@ -209,6 +230,7 @@ func (s *IDState) NextID() (uint64, error) {
 			// this case.
 
 			next = (lastTime + 1) << TimeShift
+			exhausted = true
 		default:
 			// In this case the sequence is not exhausted (and now is <=
 			// lastTime). As the sequence is in the lowest order bits, simple
@@ -249,11 +271,37 @@ func (s *IDState) NextID() (uint64, error) {
 		// ever get the load that trips this, the answer is horizontal scaling
 		// in the first instance, and sequence counter size increase secondarily.
 		// next = s.monotonic.Add(1)
+		s.observeOverloaded(ctxObserver, spins)
 		return 0, ErrOverloaded
 	}
+	s.observeIssued(ctxObserver, spins, exhausted)
 	return next | s.maskedWorkerID, nil
 }
 
+// observeIssued reports an issued id to the observers. spins counts the
+// failed attempts, the loop leaves it at the successful one.
+func (s *IDState) observeIssued(ctxObserver Observer, spins int, exhausted bool) {
+	for _, observer := range [2]Observer{s.observer, ctxObserver} {
+		if observer == nil {
+			continue
+		}
+		if exhausted {
+			observer.SequenceExhausted()
+		}
+		observer.Issued(spins)
+	}
+}
+
+// observeOverloaded reports ErrOverloaded to the observers. spins counts the
+// failed attempts, which is all of those allowed.
+func (s *IDState) observeOverloaded(ctxObserver Observer, spins int) {
+	for _, observer := range [2]Observer{s.observer, ctxObserver} {
+		if observer != nil {
+			observer.Overloaded(spins)
+		}
+	}
+}
+
 func (s *IDState) EpochStart() time.Time {
 	return s.epochStartWallClock
 }
@@ -271,18 +319,19 @@ func (s *IDState) initTime(epoch uint8) error {
 	// Processes restart often enough that we don't need to be concerned with
 	// drift against wall clock time.
 
-	s.generatorStart = time.Now() // DONT do UTC() here, as that strips the monotonic time sample
+	s.generatorStart = s.clock.Monotonic()
+	wallStart := s.clock.Wall()
 
 	// The practical value of this guard is defending against clock
 	// configuration issues (which may manifest during VM maintenance cycles for
 	// example)
-	if s.generatorStart.After(UnixNanoEpochEndSentinel) {
+	if wallStart.After(UnixNanoEpochEndSentinel) {
 		return fmt.Errorf("the clock reading is close to overflowing the limit of an int64: %w", ErrClockError)
 	}
 
 	startMS := EpochMS(epoch)
 	s.epochStartWallClock = time.UnixMilli(startMS).UTC()
-	s.generatorStartWallOffset = s.generatorStart.Sub(s.epochStartWallClock)
+	s.generatorStartWallOffset = wallStart.Sub(s.epochStartWallClock)
 
 	return nil
 }
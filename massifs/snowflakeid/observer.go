@@ -0,0 +1,105 @@
+package snowflakeid
+
+import (
+	"context"
+	"math/bits"
+	"sync/atomic"
+)
+
+// Observer receives the contention events of an IDState, so capacity planning
+// for the generator can be based on measurement. The methods are called
+// synchronously from NextID, on its hot path, and must be cheap and safe for
+// concurrent use. Counters is a ready made implementation.
+type Observer interface {
+	// Issued is called for each id issued, with the number of CAS attempts
+	// which failed before it was.
+	Issued(spins int)
+	// Overloaded is called when NextID fails with ErrOverloaded, after spins
+	// failed attempts.
+	Overloaded(spins int)
+	// SequenceExhausted is called when the sequence of a millisecond is
+	// exhausted, and an id is issued in the following millisecond instead.
+	SequenceExhausted()
+}
+
+type observerKey struct{}
+
+// WithObserver returns a context carrying the observer. NextIDContext reports
+// to it as well as to the observer of the generator's Config, so the
+// contention of one request path can be measured on its own.
+func WithObserver(ctx context.Context, observer Observer) context.Context {
+	return context.WithValue(ctx, observerKey{}, observer)
+}
+
+// ObserverFromContext returns the observer carried by ctx, nil if there is none
+func ObserverFromContext(ctx context.Context) Observer {
+	observer, _ := ctx.Value(observerKey{}).(Observer)
+	return observer
+}
+
+// SpinBuckets is the number of buckets in the spins distribution of
+// Counters. Bucket 0 counts calls which did not spin, bucket i counts calls
+// which spun [2^(i-1), 2^i) times, and the last bucket all calls which spun
+// more.
+const SpinBuckets = 8
+
+// Counters is an Observer which counts the events, with atomic counters, for
+// export to a metrics system. The zero value is ready to use.
+type Counters struct {
+	issued            atomic.Uint64
+	overloaded        atomic.Uint64
+	sequenceExhausted atomic.Uint64
+	spins             atomic.Uint64
+	spinBuckets       [SpinBuckets]atomic.Uint64
+}
+
+// CountersSnapshot is a copy of the counts of Counters
+type CountersSnapshot struct {
+	Issued            uint64
+	Overloaded        uint64
+	SequenceExhausted uint64
+	// Spins is the total of the failed CAS attempts, of issued and overloaded
+	// calls
+	Spins uint64
+	// SpinBuckets is the distribution of the spins per call, see SpinBuckets
+	SpinBuckets [SpinBuckets]uint64
+}
+
+func (c *Counters) Issued(spins int) {
+	c.issued.Add(1)
+	c.observeSpins(spins)
+}
+
+func (c *Counters) Overloaded(spins int) {
+	c.overloaded.Add(1)
+	c.observeSpins(spins)
+}
+
+func (c *Counters) SequenceExhausted() {
+	c.sequenceExhausted.Add(1)
+}
+
+// Snapshot returns the current counts. The counters are read one at a time,
+// so a snapshot taken while ids are issued may not be exactly consistent.
+func (c *Counters) Snapshot() CountersSnapshot {
+	snapshot := CountersSnapshot{
+		Issued:            c.issued.Load(),
+		Overloaded:        c.overloaded.Load(),
+		SequenceExhausted: c.sequenceExhausted.Load(),
+		Spins:             c.spins.Load(),
+	}
+	for i := range snapshot.SpinBuckets {
+		snapshot.SpinBuckets[i] = c.spinBuckets[i].Load()
+	}
+	return snapshot
+}
+
+func (c *Counters) observeSpins(spins int) {
+	c.spins.Add(uint64(spins))
+	c.spinBuckets[spinBucket(spins)].Add(1)
+}
+
+// spinBucket returns the bucket of the spins distribution for a call
+func spinBucket(spins int) int {
+	return min(bits.Len(uint(spins)), SpinBuckets-1)
+}
@@ -0,0 +1,65 @@
+package snowflakeid
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestObserver(t *testing.T) {
+	clock := NewManualClock(EpochTimeUTC(1))
+	var counters Counters
+	s, err := NewIDState(Config{
+		CommitmentEpoch: 1,
+		WorkerCIDR:      "0.0.0.0/24", // 8 sequence bits
+		PodIP:           "10.0.0.1",
+		AllowSpins:      MaxSpins,
+		Clock:           clock,
+		Observer:        &counters,
+	})
+	if err != nil {
+		t.Fatalf("NewIDState: %v", err)
+	}
+	clock.Advance(time.Millisecond)
+
+	// with the clock paused the sequence is exhausted once, by the last id
+	n := s.seqMask + 2
+	for range n - 1 {
+		if _, err = s.NextID(); err != nil {
+			t.Fatalf("NextID: %v", err)
+		}
+	}
+	var scoped Counters
+	if _, err = s.NextIDContext(WithObserver(context.Background(), &scoped)); err != nil {
+		t.Fatalf("NextIDContext: %v", err)
+	}
+
+	got := counters.Snapshot()
+	if got.Issued != n || got.SequenceExhausted != 1 || got.Overloaded != 0 {
+		t.Fatalf("unexpected counts: %+v", got)
+	}
+	// without concurrent callers there is no contention
+	if got.Spins != 0 || got.SpinBuckets[0] != n {
+		t.Fatalf("unexpected spins: %+v", got)
+	}
+	want := CountersSnapshot{Issued: 1, SequenceExhausted: 1}
+	want.SpinBuckets[0] = 1
+	if scoped.Snapshot() != want {
+		t.Fatalf("the context observer saw %+v, not %+v", scoped.Snapshot(), want)
+	}
+}
+
+func TestCounters(t *testing.T) {
+	var counters Counters
+	for _, spins := range []int{0, 1, 2, 3, 4, 100} {
+		counters.Issued(spins)
+	}
+	counters.Overloaded(MaxSpins + 1)
+
+	got := counters.Snapshot()
+	want := CountersSnapshot{Issued: 6, Overloaded: 1, Spins: 110 + MaxSpins + 1}
+	want.SpinBuckets = [SpinBuckets]uint64{1, 1, 2, 1, 0, 0, 0, 2}
+	if got != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
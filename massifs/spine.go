@@ -0,0 +1,278 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/veraison/go-cose"
+)
+
+var (
+	ErrSpineDataInvalid    = errors.New("the spine data is not a start header followed by a whole peak stack")
+	ErrSpineUnverifiable   = errors.New("the checkpoint can not be verified from the spine data available")
+	ErrSpinePeakStackDiffs = errors.New("the spine peak stack does not match the verified accumulator")
+)
+
+// MassifSpine is the restricted view of a massif held by a spine replica: the
+// start header and the ancestor peak stack, a few KB regardless of the massif
+// height. Monitors that only check the consistency of a log (and never serve
+// leaf proofs) can replicate spines and checkpoints rather than full massifs.
+//
+// The peak stack of massif i is exactly the accumulator of the log when massif
+// i-1 was completed, so a spine is enough to verify any checkpoint whose
+// consistency proof starts from a massif boundary or from a previously
+// verified state. See VerifySpineCheckpoint.
+type MassifSpine struct {
+	Start MassifStart
+	// Header is the encoded start header, StartHeaderEnd bytes.
+	Header []byte
+	// PeakStack is the ancestor peak stack, Start.PeakStackLen entries.
+	PeakStack [][]byte
+}
+
+// NewMassifSpine extracts the spine from massif data. The data need only
+// extend to the end of the peak stack, the log entries are not required.
+func NewMassifSpine(data []byte) (MassifSpine, error) {
+	if len(data) < StartHeaderEnd {
+		return MassifSpine{}, fmt.Errorf("%w: start header incomplete", ErrSpineDataInvalid)
+	}
+	mc := MassifContext{MassifData: MassifData{Data: data}, Start: MakeMassifStart(data)}
+	if mc.Start.PeakStackLen > MaxMMRHeight {
+		return MassifSpine{}, fmt.Errorf("%w: %d peaks", ErrSpineDataInvalid, mc.Start.PeakStackLen)
+	}
+	start := mc.PeakStackStart()
+	end := start + mc.Start.PeakStackLen*ValueBytes
+	if uint64(len(data)) < end {
+		return MassifSpine{}, fmt.Errorf("%w: peak stack incomplete", ErrSpineDataInvalid)
+	}
+	spine := MassifSpine{
+		Start:  mc.Start,
+		Header: append([]byte(nil), data[:StartHeaderEnd]...),
+	}
+	for i := start; i < end; i += ValueBytes {
+		spine.PeakStack = append(spine.PeakStack, append([]byte(nil), data[i:i+ValueBytes]...))
+	}
+	return spine, nil
+}
+
+// SpineDataLen returns the number of massif data bytes NewMassifSpine needs,
+// given the start header.
+func SpineDataLen(start MassifStart) uint64 {
+	mc := MassifContext{Start: start}
+	return mc.PeakStackStart() + start.PeakStackLen*ValueBytes
+}
+
+// MarshalBinary encodes the spine as the start header followed by the peak
+// stack. This is the storage.ObjectMassifSpine object format.
+func (s MassifSpine) MarshalBinary() ([]byte, error) {
+	out := make([]byte, 0, len(s.Header)+len(s.PeakStack)*ValueBytes)
+	out = append(out, s.Header...)
+	for _, peak := range s.PeakStack {
+		out = append(out, peak...)
+	}
+	return out, nil
+}
+
+// DecodeMassifSpine decodes a spine object produced by MarshalBinary.
+func DecodeMassifSpine(data []byte) (MassifSpine, error) {
+	if len(data) < StartHeaderEnd {
+		return MassifSpine{}, fmt.Errorf("%w: start header incomplete", ErrSpineDataInvalid)
+	}
+	start := MakeMassifStart(data)
+	// the length check alone could be satisfied by a wrapped multiplication
+	if start.PeakStackLen > MaxMMRHeight || uint64(len(data)) != StartHeaderEnd+start.PeakStackLen*ValueBytes {
+		return MassifSpine{}, fmt.Errorf("%w: %d bytes for %d peaks", ErrSpineDataInvalid, len(data), start.PeakStackLen)
+	}
+	spine := MassifSpine{Start: start, Header: append([]byte(nil), data[:StartHeaderEnd]...)}
+	for i := uint64(StartHeaderEnd); i < uint64(len(data)); i += ValueBytes {
+		spine.PeakStack = append(spine.PeakStack, append([]byte(nil), data[i:i+ValueBytes]...))
+	}
+	return spine, nil
+}
+
+// CheckpointAccumulator reconstructs the accumulator a checkpoint receipt
+// signs from the accumulator of its proof's tree-size-1 (nil for a first
+// checkpoint, which carries the whole accumulator as right peaks).
+func CheckpointAccumulator(from [][]byte, proof ConsistencyProof) ([][]byte, error) {
+	var accumulator [][]byte
+	if proof.TreeSize1 > 0 {
+		roots, err := mmr.ConsistentRoots(sha256.New(), proof.TreeSize1-1, from, proof.Paths)
+		if err != nil {
+			return nil, err
+		}
+		accumulator = roots
+	}
+	accumulator = append(accumulator, proof.RightPeaks...)
+	if proof.TreeSize2 == 0 || len(accumulator) != len(mmr.Peaks(proof.TreeSize2-1)) {
+		return nil, fmt.Errorf("%w: the proof does not produce the accumulator for size %d",
+			mmr.ErrConsistencyCheck, proof.TreeSize2)
+	}
+	return accumulator, nil
+}
+
+// VerifySpineCheckpoint verifies a checkpoint for the spine's massif without
+// the massif log data. The accumulator the checkpoint signs is reconstructed
+// from its consistency proof, starting from one of:
+//
+//   - nothing, for a first checkpoint (tree-size-1 is zero)
+//   - trusted, a previously verified state, if its size is tree-size-1
+//   - the spine peak stack, if tree-size-1 is the first index of the massif
+//
+// In the last case a valid signature also authenticates the peak stack. If
+// trusted is the state at the start of the massif, the peak stack is checked
+// against it. Returns the verified sealed state.
+func VerifySpineCheckpoint(
+	spine *MassifSpine, trusted *MMRState, check *Checkpoint, verifier cose.Verifier,
+) (MMRState, error) {
+	if verifier == nil {
+		return MMRState{}, ErrVerifierRequired
+	}
+	proof := check.Receipt.Proof
+
+	if proof.TreeSize2 <= spine.Start.FirstIndex {
+		return MMRState{}, fmt.Errorf("%w: sealed size %d precedes massif %d",
+			ErrStateSizeBeforeMassifStart, proof.TreeSize2, spine.Start.MassifIndex)
+	}
+
+	if trusted != nil && trusted.MMRSize == spine.Start.FirstIndex {
+		if err := checkSpinePeakStack(spine, trusted.Peaks); err != nil {
+			return MMRState{}, err
+		}
+	}
+
+	var from [][]byte
+	switch {
+	case proof.TreeSize1 == 0:
+	case trusted != nil && proof.TreeSize1 == trusted.MMRSize:
+		from = trusted.Peaks
+	case proof.TreeSize1 == spine.Start.FirstIndex:
+		from = spine.PeakStack
+	default:
+		return MMRState{}, fmt.Errorf("%w: proof from size %d, massif %d starts at %d",
+			ErrSpineUnverifiable, proof.TreeSize1, spine.Start.MassifIndex, spine.Start.FirstIndex)
+	}
+
+	accumulator, err := CheckpointAccumulator(from, proof)
+	if err != nil {
+		return MMRState{}, err
+	}
+	err = verifier.Verify(
+		SigStructure(check.Receipt.ProtectedHeader, DetachedPayload(accumulator)),
+		check.Receipt.Signature,
+	)
+	if err != nil {
+		return MMRState{}, fmt.Errorf(
+			"%w: checkpoint receipt for sealed size %d: %v", ErrSealVerifyFailed, proof.TreeSize2, err)
+	}
+	return MMRState{MMRSize: proof.TreeSize2, Peaks: accumulator}, nil
+}
+
+func checkSpinePeakStack(spine *MassifSpine, accumulator [][]byte) error {
+	if len(spine.PeakStack) != len(accumulator) {
+		return fmt.Errorf("%w: massif %d", ErrSpinePeakStackDiffs, spine.Start.MassifIndex)
+	}
+	for i := range accumulator {
+		if !bytes.Equal(spine.PeakStack[i], accumulator[i]) {
+			return fmt.Errorf("%w: massif %d", ErrSpinePeakStackDiffs, spine.Start.MassifIndex)
+		}
+	}
+	return nil
+}
+
+// SpineReplicator replicates only the spine (see MassifSpine) and checkpoint
+// of each massif, verifying each checkpoint from the spine data alone.
+type SpineReplicator struct {
+	COSEVerifier cose.Verifier
+
+	// Source provides the upstream (source of truth) log to replicate from.
+	Source ObjectReader
+	// Sink receives storage.ObjectMassifSpine and storage.ObjectCheckpoint
+	// objects.
+	Sink ObjectWriter
+}
+
+// ReplicateSpine verifies and replicates the spines for the massif index
+// range [startMassif, endMassif]. Only the start header and peak stack of each
+// source massif are read. trusted may be nil, or a previously verified state
+// from which the first checkpoint in the range can be verified. Returns the
+// latest verified state, which the caller can retain for the next pass.
+func (r *SpineReplicator) ReplicateSpine(
+	ctx context.Context, trusted *MMRState, startMassif, endMassif uint32,
+) (*MMRState, error) {
+	for i := startMassif; i <= endMassif; i++ {
+
+		// Fetch the seal before the massif so we can't lose a race with the
+		// builder
+		check, err := GetCheckpoint(ctx, r.Source, i)
+		if err != nil {
+			return nil, err
+		}
+
+		header, err := r.Source.MassifReadN(ctx, i, StartHeaderEnd)
+		if err != nil {
+			return nil, err
+		}
+		if len(header) < StartHeaderEnd {
+			return nil, fmt.Errorf("%w: massif %d", ErrSpineDataInvalid, i)
+		}
+		n, err := ReadLen(SpineDataLen(MakeMassifStart(header)))
+		if err != nil {
+			return nil, err
+		}
+		data, err := r.Source.MassifReadN(ctx, i, n)
+		if err != nil {
+			return nil, err
+		}
+		spine, err := NewMassifSpine(data)
+		if err != nil {
+			return nil, err
+		}
+
+		state, err := VerifySpineCheckpoint(&spine, trusted, &check, r.COSEVerifier)
+		if err != nil {
+			return nil, fmt.Errorf("massif %d: %w", i, err)
+		}
+
+		if err = r.putSpine(ctx, &spine, &check); err != nil {
+			return nil, err
+		}
+		trusted = &state
+	}
+	return trusted, nil
+}
+
+// putSpine stores the spine then the checkpoint, holding the sink's massif
+// lock across both if it implements ObjectLocker.
+func (r *SpineReplicator) putSpine(ctx context.Context, spine *MassifSpine, check *Checkpoint) (err error) {
+	massifIndex := spine.Start.MassifIndex
+	if locker, ok := r.Sink.(ObjectLocker); ok {
+		var unlock func() error
+		unlock, err = locker.Lock(ctx, massifIndex)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if uerr := unlock(); err == nil {
+				err = uerr
+			}
+		}()
+	}
+
+	encoded, err := spine.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	// put the spine first, a racy seal read will still be valid
+	if err = r.Sink.Put(ctx, massifIndex, storage.ObjectMassifSpine, encoded, false); err != nil {
+		return fmt.Errorf("failed to store massif spine: %w", err)
+	}
+	if err = r.Sink.Put(ctx, massifIndex, storage.ObjectCheckpoint, check.Raw, false); err != nil {
+		return fmt.Errorf("failed to store checkpoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package massifs
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpineRoundTrip(t *testing.T) {
+	source, _ := buildSealedLog(t, 3, 10)
+
+	for massifIndex, data := range source.massifs {
+		spine, err := NewMassifSpine(data)
+		require.NoError(t, err)
+		require.Equal(t, massifIndex, spine.Start.MassifIndex)
+		require.Len(t, spine.PeakStack, int(spine.Start.PeakStackLen))
+
+		encoded, err := spine.MarshalBinary()
+		require.NoError(t, err)
+		decoded, err := DecodeMassifSpine(encoded)
+		require.NoError(t, err)
+		require.Equal(t, spine, decoded)
+	}
+}
+
+func TestReplicateSpine(t *testing.T) {
+	source, verifier := buildSealedLog(t, 3, 10)
+	head, err := source.HeadIndex(context.Background(), storage.ObjectMassifData)
+	require.NoError(t, err)
+	require.Greater(t, head, uint32(1))
+
+	sink := newMemStore(nil, nil)
+	r := &SpineReplicator{COSEVerifier: verifier, Source: source, Sink: sink}
+	state, err := r.ReplicateSpine(context.Background(), nil, 0, head)
+	require.NoError(t, err)
+	require.NotNil(t, state)
+
+	// The final state is the head seal, and only spines were stored.
+	headCheck, err := NewCheckpoint(source.checkpoint[head])
+	require.NoError(t, err)
+	require.Equal(t, headCheck.MMRSize, state.MMRSize)
+	require.Empty(t, sink.massifs)
+	require.Len(t, sink.spines, int(head)+1)
+	require.Len(t, sink.checkpoint, int(head)+1)
+	for i, spine := range sink.spines {
+		require.Less(t, len(spine), len(source.massifs[i]))
+	}
+
+	// Resuming from the retained state needs no earlier massifs.
+	state, err = r.ReplicateSpine(context.Background(), state, head, head)
+	require.NoError(t, err)
+	require.Equal(t, headCheck.MMRSize, state.MMRSize)
+}
+
+func TestVerifySpineCheckpoint_TamperedPeakStack(t *testing.T) {
+	source, verifier := buildSealedLog(t, 3, 10)
+
+	spine, err := NewMassifSpine(source.massifs[1])
+	require.NoError(t, err)
+	require.NotEmpty(t, spine.PeakStack)
+	spine.PeakStack[0] = make([]byte, ValueBytes)
+
+	check, err := NewCheckpoint(source.checkpoint[1])
+	require.NoError(t, err)
+	_, err = VerifySpineCheckpoint(&spine, nil, &check, verifier)
+	require.True(t, errors.Is(err, ErrSealVerifyFailed))
+}
@@ -7,6 +7,16 @@ const (
 	V1MMRBlobNameFmt               = "%016d.log"
 	V1MMRSignedTreeHeadBlobNameFmt = "%016d.sth"
 	V1MMRSealSignedRootExt         = "sth" // Signed Tree Head
+	V1MMRSpineBlobNameFmt          = "%016d.spine"
+	V1MMRSpineExt                  = "spine" // start header and peak stack only
+	V1MMRClosureBlobNameFmt        = "%016d.closure"
+	V1MMRClosureExt                = "closure" // the closure statement of a deleted log
+	V1MMRTimestampIndexBlobNameFmt = "%016d.tsidx"
+	V1MMRTimestampIndexExt         = "tsidx" // the idtimestamp secondary index of a massif
+	V1MMRLegacySealBlobNameFmt     = "%016d.sth0"
+	V1MMRLegacySealExt             = "sth0" // a V0 (bagged root) seal emitted alongside the checkpoint
+	V1MMRBridgeBlobNameFmt         = "%016d.bridge"
+	V1MMRBridgeExt                 = "bridge" // the consistency bridge of a completed massif
 	// LogInstanceN refers to the approach for handling blob size and format changes discussed at
 	// [Changing the massifheight for a log](https://github.com/datatrails/epic-8120-scalable-proof-mechanisms/blob/1cb966cc10af03ae041fea4bca44b10979fb1eda/mmr/forestrie-mmrblobs.md#changing-the-massifheight-for-a-log)
 
@@ -4,6 +4,7 @@ import "errors"
 
 var (
 	ErrLogEmpty             = errors.New("the log is empty")
+	ErrLogClosed            = errors.New("the log has been closed and its data deleted")
 	ErrExistsOC             = errors.New("optimistic concurrency failure, subject already exists")
 	ErrContentOC            = errors.New("optimistic concurrency failure, content to replace does not match expected content")
 	ErrLogNotSelected       = errors.New("no log selected, please call SelectLog first")
@@ -12,4 +13,5 @@ var (
 	ErrDoesNotExist         = errors.New("object does not exist")
 	ErrOpConfigMissing      = errors.New("required configuration missing for the selected operation")
 	ErrUnsupportedCap       = errors.New("operation not supported by this storage implementation")
+	ErrLogIDRequired        = errors.New("a log id is required by the path scheme")
 )
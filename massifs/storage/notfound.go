@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// NotFoundError is returned by readers when an object, or the whole log, does
+// not exist. It identifies the object, and wraps ErrDoesNotExist, or
+// ErrLogEmpty when no massif exists, or ErrLogClosed when the log was deleted
+// and only its closure statement remains, so errors.Is checks against those
+// continue to work. Use IsNotFound to classify errors.
+type NotFoundError struct {
+	// LogID is nil if the reader does not know the log identity
+	LogID LogID
+	Type  ObjectType
+	// MassifIndex is HeadMassifIndex if the head object was requested
+	MassifIndex uint32
+	// Err is ErrDoesNotExist, ErrLogEmpty or ErrLogClosed, nil means
+	// ErrDoesNotExist
+	Err error
+}
+
+// NewNotFoundError returns a NotFoundError wrapping ErrDoesNotExist.
+func NewNotFoundError(logID LogID, otype ObjectType, massifIndex uint32) *NotFoundError {
+	return &NotFoundError{LogID: logID, Type: otype, MassifIndex: massifIndex, Err: ErrDoesNotExist}
+}
+
+// NewLogEmptyError returns a NotFoundError wrapping ErrLogEmpty, for the head
+// of a log with no massifs.
+func NewLogEmptyError(logID LogID) *NotFoundError {
+	return &NotFoundError{LogID: logID, Type: ObjectMassifData, MassifIndex: HeadMassifIndex, Err: ErrLogEmpty}
+}
+
+// NewLogClosedError returns a NotFoundError wrapping ErrLogClosed, for any
+// massif object of a log which has been closed. Readers return it rather than
+// ErrDoesNotExist so a deleted log can be told apart from one which never
+// existed.
+func NewLogClosedError(logID LogID, otype ObjectType, massifIndex uint32) *NotFoundError {
+	return &NotFoundError{LogID: logID, Type: otype, MassifIndex: massifIndex, Err: ErrLogClosed}
+}
+
+func (e *NotFoundError) Error() string {
+	index := fmt.Sprint(e.MassifIndex)
+	if e.MassifIndex == HeadMassifIndex {
+		index = "head"
+	}
+	if len(e.LogID) == 0 {
+		return fmt.Sprintf("%v: type %d, massif %s", e.Unwrap(), e.Type, index)
+	}
+	return fmt.Sprintf("%v: log %s, type %d, massif %s", e.Unwrap(), hex.EncodeToString(e.LogID), e.Type, index)
+}
+
+func (e *NotFoundError) Unwrap() error {
+	if e.Err == nil {
+		return ErrDoesNotExist
+	}
+	return e.Err
+}
+
+// IsNotFound returns true if err reports that an object, or the log, does not
+// exist. Besides NotFoundError it recognizes the plain ErrDoesNotExist and
+// ErrLogEmpty returned by older readers.
+func IsNotFound(err error) bool {
+	var notFound *NotFoundError
+	return errors.As(err, &notFound) || errors.Is(err, ErrDoesNotExist) || errors.Is(err, ErrLogEmpty)
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestNotFoundError(t *testing.T) {
+	err := fmt.Errorf("reading: %w", NewNotFoundError(LogID{0xab, 0xcd}, ObjectCheckpoint, 3))
+
+	var notFound *NotFoundError
+	if !errors.As(err, &notFound) {
+		t.Fatalf("errors.As failed for %v", err)
+	}
+	if notFound.Type != ObjectCheckpoint || notFound.MassifIndex != 3 {
+		t.Errorf("unexpected identity %+v", notFound)
+	}
+	if !errors.Is(err, ErrDoesNotExist) || errors.Is(err, ErrLogEmpty) {
+		t.Errorf("%v must only wrap ErrDoesNotExist", err)
+	}
+	if want := "reading: object does not exist: log abcd, type 3, massif 3"; err.Error() != want {
+		t.Errorf("got %q, want %q", err.Error(), want)
+	}
+
+	empty := NewLogEmptyError(nil)
+	if !errors.Is(empty, ErrLogEmpty) || errors.Is(empty, ErrDoesNotExist) {
+		t.Errorf("%v must only wrap ErrLogEmpty", empty)
+	}
+	if want := "the log is empty: type 2, massif head"; empty.Error() != want {
+		t.Errorf("got %q, want %q", empty.Error(), want)
+	}
+
+	closed := NewLogClosedError(nil, ObjectMassifData, 2)
+	if !errors.Is(closed, ErrLogClosed) || errors.Is(closed, ErrDoesNotExist) {
+		t.Errorf("%v must only wrap ErrLogClosed", closed)
+	}
+
+	for _, err := range []error{err, empty, closed, ErrDoesNotExist, fmt.Errorf("x: %w", ErrLogEmpty)} {
+		if !IsNotFound(err) {
+			t.Errorf("IsNotFound(%v) = false", err)
+		}
+	}
+	if IsNotFound(ErrNotAvailable) || IsNotFound(nil) {
+		t.Error("IsNotFound must be false for other errors")
+	}
+}
@@ -21,11 +21,21 @@ func ObjectIndexFromPath(storagePath string) (ObjectType, uint32, error) {
 		otypes := []ObjectType{
 			ObjectMassifData,
 			ObjectCheckpoint,
+			ObjectMassifSpine,
+			ObjectLogClosure,
+			ObjectTimestampIndex,
+			ObjectLegacyCheckpoint,
+			ObjectMassifBridge,
 		}
 
 		for itype, suffix := range []string{
 			V1MMRExtSep + V1MMRMassifExt,
 			V1MMRExtSep + V1MMRSealSignedRootExt,
+			V1MMRExtSep + V1MMRSpineExt,
+			V1MMRExtSep + V1MMRClosureExt,
+			V1MMRExtSep + V1MMRTimestampIndexExt,
+			V1MMRExtSep + V1MMRLegacySealExt,
+			V1MMRExtSep + V1MMRBridgeExt,
 		} {
 			if !strings.HasSuffix(baseName, suffix) {
 				continue
@@ -45,11 +55,21 @@ func ObjectIndexFromPath(storagePath string) (ObjectType, uint32, error) {
 	otypes := []ObjectType{
 		ObjectMassifData,
 		ObjectCheckpoint,
+		ObjectMassifSpine,
+		ObjectLogClosure,
+		ObjectTimestampIndex,
+		ObjectLegacyCheckpoint,
+		ObjectMassifBridge,
 	}
 
 	for itype, suffix := range []string{
 		V1MMRExtSep + V1MMRMassifExt,
 		V1MMRExtSep + V1MMRSealSignedRootExt,
+		V1MMRExtSep + V1MMRSpineExt,
+		V1MMRExtSep + V1MMRClosureExt,
+		V1MMRExtSep + V1MMRTimestampIndexExt,
+		V1MMRExtSep + V1MMRLegacySealExt,
+		V1MMRExtSep + V1MMRBridgeExt,
 	} {
 		if !strings.HasSuffix(baseName, suffix) {
 			continue
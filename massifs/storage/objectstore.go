@@ -14,6 +14,21 @@ const (
 	ObjectCheckpoint
 	ObjectPathMassifs
 	ObjectPathCheckpoints
+	// ObjectMassifSpine is the start header and peak stack of a massif,
+	// without the index or log data. See massifs.MassifSpine
+	ObjectMassifSpine
+	// ObjectLogClosure is the signed closure statement of a deleted log, see
+	// massifs.ClosureStatement. It is named for the last massif of the log.
+	ObjectLogClosure
+	// ObjectTimestampIndex is the idtimestamp secondary index of a massif,
+	// see massifs.TimestampIndex
+	ObjectTimestampIndex
+	// ObjectLegacyCheckpoint is a V0 seal of a massif, emitted alongside its
+	// checkpoint while verifiers migrate, see massifs.WithLogDualSeal
+	ObjectLegacyCheckpoint
+	// ObjectMassifBridge is the consistency bridge across the start of a
+	// massif, see massifs.MassifBridge
+	ObjectMassifBridge
 )
 
 const (
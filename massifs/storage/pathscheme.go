@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+
+	"github.com/google/uuid"
+)
+
+// PathScheme names the objects of a log in path based storage. Every scheme
+// keeps all the objects of one type, for one log, in a single directory (the
+// prefix) and names them within it as FmtMassifPath, FmtCheckpointPath,
+// FmtSpinePath, FmtClosurePath, FmtTimestampIndexPath, FmtLegacySealPath and
+// FmtBridgePath do. So ObjectIndexFromPath recovers the object type and index
+// from the base name whatever the scheme.
+type PathScheme interface {
+	// ObjectPrefix returns the slash separated directory holding the objects
+	// of otype for the log, relative to the storage root. It is empty, or ends
+	// with a "/".
+	ObjectPrefix(logID LogID, massifHeight uint8, otype ObjectType) (string, error)
+}
+
+// DefaultPathScheme is the scheme used where a log identity is available and
+// no scheme is configured.
+var DefaultPathScheme PathScheme = DataTrailsPathScheme{}
+
+// SchemeObjectPath returns the slash separated path of the object, relative to
+// the storage root.
+func SchemeObjectPath(
+	scheme PathScheme, logID LogID, massifHeight uint8, massifIndex uint32, otype ObjectType,
+) (string, error) {
+	prefix, err := scheme.ObjectPrefix(logID, massifHeight, otype)
+	if err != nil {
+		return "", err
+	}
+	switch otype {
+	case ObjectPathMassifs, ObjectPathCheckpoints:
+		return prefix, nil
+	case ObjectCheckpoint:
+		return FmtCheckpointPath(prefix, massifIndex), nil
+	case ObjectMassifSpine:
+		return FmtSpinePath(prefix, massifIndex), nil
+	case ObjectLogClosure:
+		return FmtClosurePath(prefix, massifIndex), nil
+	case ObjectTimestampIndex:
+		return FmtTimestampIndexPath(prefix, massifIndex), nil
+	case ObjectLegacyCheckpoint:
+		return FmtLegacySealPath(prefix, massifIndex), nil
+	case ObjectMassifBridge:
+		return FmtBridgePath(prefix, massifIndex), nil
+	case ObjectMassifStart, ObjectMassifData:
+		return FmtMassifPath(prefix, massifIndex), nil
+	default:
+		return "", fmt.Errorf("%w: object type %v", ErrUnsupportedCap, otype)
+	}
+}
+
+// DataTrailsPathScheme is the v2 storage layout,
+//
+//	v2/merklelog/massifs/{height}/{uuid}/     massif data, spines and timestamp indexes
+//	v2/merklelog/checkpoints/{height}/{uuid}/ checkpoints, V0 seals, bridges and closures
+//
+// The log id must be a 16 byte uuid.
+type DataTrailsPathScheme struct{}
+
+func (DataTrailsPathScheme) ObjectPrefix(logID LogID, massifHeight uint8, otype ObjectType) (string, error) {
+	if len(logID) != 16 {
+		return "", fmt.Errorf("%w: log id must be a 16 byte uuid", ErrLogIDRequired)
+	}
+	base, err := StorageObjectPrefixWithHeight(logID, massifHeight, otype)
+	if err != nil {
+		return "", err
+	}
+	switch otype {
+	case ObjectCheckpoint, ObjectLegacyCheckpoint, ObjectMassifBridge, ObjectLogClosure, ObjectPathCheckpoints:
+		return V2MerklelogCheckpointsPrefix + V1MMRPathSep + base, nil
+	default:
+		return V2MerklelogMassifsPrefix + V1MMRPathSep + base, nil
+	}
+}
+
+// FlatPathScheme puts every object directly in the storage root, as a local
+// replica of a single log does. See DirReader.
+type FlatPathScheme struct{}
+
+func (FlatPathScheme) ObjectPrefix(logID LogID, massifHeight uint8, otype ObjectType) (string, error) {
+	return "", nil
+}
+
+// HashShardedPathScheme spreads logs over 256 top level directories, so that
+// no single directory lists every log,
+//
+//	{shard}/{log id hex}/{height}/
+//
+// where shard is the first byte of SHA-256(log id) as two hex digits. All
+// object types share the directory.
+type HashShardedPathScheme struct{}
+
+func (HashShardedPathScheme) ObjectPrefix(logID LogID, massifHeight uint8, otype ObjectType) (string, error) {
+	if len(logID) == 0 {
+		return "", ErrLogIDRequired
+	}
+	sum := sha256.Sum256(logID)
+	id := hex.EncodeToString(logID)
+	if len(logID) == 16 {
+		id = uuid.UUID(logID).String()
+	}
+	return path.Join(hex.EncodeToString(sum[:1]), id, fmt.Sprint(massifHeight)) + V1MMRPathSep, nil
+}
+
+// EpochPathScheme places the objects named by Scheme under a directory for
+// the commitment epoch, epoch/{epoch}/. Logs written across an epoch change
+// keep each epoch's objects apart. A nil Scheme selects DefaultPathScheme.
+type EpochPathScheme struct {
+	Epoch  uint32
+	Scheme PathScheme
+}
+
+func (s EpochPathScheme) ObjectPrefix(logID LogID, massifHeight uint8, otype ObjectType) (string, error) {
+	scheme := s.Scheme
+	if scheme == nil {
+		scheme = DefaultPathScheme
+	}
+	prefix, err := scheme.ObjectPrefix(logID, massifHeight, otype)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("epoch/%d/%s", s.Epoch, prefix), nil
+}
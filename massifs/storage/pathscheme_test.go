@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPathSchemes(t *testing.T) {
+	logID := LogID{
+		0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08,
+		0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10,
+	}
+	const uuid = "01020304-0506-0708-090a-0b0c0d0e0f10"
+
+	for _, tc := range []struct {
+		name   string
+		scheme PathScheme
+		otype  ObjectType
+		want   string
+	}{
+		{"datatrails massif", DataTrailsPathScheme{}, ObjectMassifData,
+			"v2/merklelog/massifs/14/" + uuid + "/0000000000000003.log"},
+		{"datatrails checkpoint", DataTrailsPathScheme{}, ObjectCheckpoint,
+			"v2/merklelog/checkpoints/14/" + uuid + "/0000000000000003.sth"},
+		{"datatrails spine", DataTrailsPathScheme{}, ObjectMassifSpine,
+			"v2/merklelog/massifs/14/" + uuid + "/0000000000000003.spine"},
+		{"datatrails closure", DataTrailsPathScheme{}, ObjectLogClosure,
+			"v2/merklelog/checkpoints/14/" + uuid + "/0000000000000003.closure"},
+		{"datatrails timestamp index", DataTrailsPathScheme{}, ObjectTimestampIndex,
+			"v2/merklelog/massifs/14/" + uuid + "/0000000000000003.tsidx"},
+		{"datatrails legacy seal", DataTrailsPathScheme{}, ObjectLegacyCheckpoint,
+			"v2/merklelog/checkpoints/14/" + uuid + "/0000000000000003.sth0"},
+		{"datatrails bridge", DataTrailsPathScheme{}, ObjectMassifBridge,
+			"v2/merklelog/checkpoints/14/" + uuid + "/0000000000000003.bridge"},
+		{"flat", FlatPathScheme{}, ObjectCheckpoint, "0000000000000003.sth"},
+		{"sharded", HashShardedPathScheme{}, ObjectMassifData,
+			"5d/" + uuid + "/14/0000000000000003.log"},
+		{"epoch", EpochPathScheme{Epoch: 2}, ObjectCheckpoint,
+			"epoch/2/v2/merklelog/checkpoints/14/" + uuid + "/0000000000000003.sth"},
+		{"epoch flat", EpochPathScheme{Epoch: 1, Scheme: FlatPathScheme{}}, ObjectMassifData,
+			"epoch/1/0000000000000003.log"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := SchemeObjectPath(tc.scheme, logID, 14, 3, tc.otype)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+			otype, massifIndex, err := ObjectIndexFromPath(got)
+			if err != nil || otype != tc.otype || massifIndex != 3 {
+				t.Errorf("ObjectIndexFromPath(%q) = %v, %d, %v", got, otype, massifIndex, err)
+			}
+		})
+	}
+
+	if _, err := SchemeObjectPath(DataTrailsPathScheme{}, LogID{1}, 14, 0, ObjectMassifData); !errors.Is(err, ErrLogIDRequired) {
+		t.Errorf("short log id: got %v", err)
+	}
+	if _, err := SchemeObjectPath(HashShardedPathScheme{}, nil, 14, 0, ObjectMassifData); !errors.Is(err, ErrLogIDRequired) {
+		t.Errorf("nil log id: got %v", err)
+	}
+}
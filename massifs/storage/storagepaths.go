@@ -17,6 +17,36 @@ func FmtCheckpointPath(prefix string, massifIndex uint32) string {
 	)
 }
 
+func FmtSpinePath(prefix string, massifIndex uint32) string {
+	return fmt.Sprintf(
+		"%s%s", prefix, fmt.Sprintf(V1MMRSpineBlobNameFmt, massifIndex),
+	)
+}
+
+func FmtClosurePath(prefix string, massifIndex uint32) string {
+	return fmt.Sprintf(
+		"%s%s", prefix, fmt.Sprintf(V1MMRClosureBlobNameFmt, massifIndex),
+	)
+}
+
+func FmtTimestampIndexPath(prefix string, massifIndex uint32) string {
+	return fmt.Sprintf(
+		"%s%s", prefix, fmt.Sprintf(V1MMRTimestampIndexBlobNameFmt, massifIndex),
+	)
+}
+
+func FmtLegacySealPath(prefix string, massifIndex uint32) string {
+	return fmt.Sprintf(
+		"%s%s", prefix, fmt.Sprintf(V1MMRLegacySealBlobNameFmt, massifIndex),
+	)
+}
+
+func FmtBridgePath(prefix string, massifIndex uint32) string {
+	return fmt.Sprintf(
+		"%s%s", prefix, fmt.Sprintf(V1MMRBridgeBlobNameFmt, massifIndex),
+	)
+}
+
 func ObjectPath(prefix string, logID LogID, massifIndex uint32, otype ObjectType) (string, error) {
 
 	switch otype {
@@ -24,6 +54,16 @@ func ObjectPath(prefix string, logID LogID, massifIndex uint32, otype ObjectType
 		return prefix, nil
 	case ObjectCheckpoint:
 		return FmtCheckpointPath(prefix, massifIndex), nil
+	case ObjectMassifSpine:
+		return FmtSpinePath(prefix, massifIndex), nil
+	case ObjectLogClosure:
+		return FmtClosurePath(prefix, massifIndex), nil
+	case ObjectTimestampIndex:
+		return FmtTimestampIndexPath(prefix, massifIndex), nil
+	case ObjectLegacyCheckpoint:
+		return FmtLegacySealPath(prefix, massifIndex), nil
+	case ObjectMassifBridge:
+		return FmtBridgePath(prefix, massifIndex), nil
 	case ObjectMassifStart:
 		fallthrough
 	case ObjectMassifData:
@@ -56,10 +96,10 @@ func StorageObjectPrefixWithHeight(logID LogID, massifHeight uint8, otype Object
 	uuidStr := uuid.UUID(logID).String()
 
 	switch otype {
-	case ObjectMassifStart, ObjectMassifData, ObjectPathMassifs:
+	case ObjectMassifStart, ObjectMassifData, ObjectMassifSpine, ObjectTimestampIndex, ObjectPathMassifs:
 		// Base format: {massifHeight}/{uuid}/
 		return fmt.Sprintf("%d/%s/", massifHeight, uuidStr), nil
-	case ObjectCheckpoint, ObjectPathCheckpoints:
+	case ObjectCheckpoint, ObjectLegacyCheckpoint, ObjectMassifBridge, ObjectLogClosure, ObjectPathCheckpoints:
 		// Base format: {massifHeight}/{uuid}/ (same for checkpoints)
 		return fmt.Sprintf("%d/%s/", massifHeight, uuidStr), nil
 	default:
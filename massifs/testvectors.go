@@ -0,0 +1,412 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/veraison/go-cose"
+)
+
+// TestVectorsFormat is the version of the test vector layout, the vectors
+// are written to a directory named for it, see GenerateTestVectors. It is
+// incremented when the layout of vectors.json changes, or when the massif or
+// checkpoint formats the vectors are generated in change.
+const TestVectorsFormat = 1
+
+// TestVectorsFile is the name of the file describing the vectors
+const TestVectorsFile = "vectors.json"
+
+// testVectorsBase is the time of the first leaf of every log, each following
+// leaf is a second later.
+var testVectorsBase = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// TestVectorSpec describes one of the logs generated as test vectors
+type TestVectorSpec struct {
+	Name         string
+	MassifHeight uint8
+	LeafCount    int
+}
+
+// DefaultTestVectorSpecs are small logs covering a single partial massif, a
+// log which spans several massifs, and a log ending exactly on a massif
+// boundary.
+var DefaultTestVectorSpecs = []TestVectorSpec{
+	{Name: "h3-partial", MassifHeight: 3, LeafCount: 3},
+	{Name: "h3-multi", MassifHeight: 3, LeafCount: 11},
+	{Name: "h2-boundary", MassifHeight: 2, LeafCount: 8},
+}
+
+// TestVectors is the content of vectors.json. Byte strings are lower case
+// hex, and idtimestamps are hex as they do not survive JSON numbers in every
+// language.
+type TestVectors struct {
+	Format       int    `json:"format"`
+	MassifFormat uint16 `json:"massifFormat"`
+	Algorithm    string `json:"alg"`
+	// PublicKeyX and PublicKeyY are the P-256 public key the checkpoints are
+	// signed with.
+	PublicKeyX string          `json:"publicKeyX"`
+	PublicKeyY string          `json:"publicKeyY"`
+	Logs       []TestVectorLog `json:"logs"`
+}
+
+// TestVectorLog is a generated log, its objects are also written, as a
+// DirReader replica, to the directory named Dir.
+type TestVectorLog struct {
+	Name         string                  `json:"name"`
+	MassifHeight uint8                   `json:"massifHeight"`
+	Dir          string                  `json:"dir"`
+	Leaves       []TestVectorLeaf        `json:"leaves"`
+	Massifs      []TestVectorObject      `json:"massifs"`
+	Checkpoints  []TestVectorCheckpoint  `json:"checkpoints"`
+	Inclusion    []TestVectorInclusion   `json:"inclusion"`
+	Consistency  []TestVectorConsistency `json:"consistency"`
+}
+
+type TestVectorLeaf struct {
+	LeafIndex   uint64 `json:"leafIndex"`
+	MMRIndex    uint64 `json:"mmrIndex"`
+	IDTimestamp string `json:"idTimestamp"`
+	Value       string `json:"value"`
+}
+
+type TestVectorObject struct {
+	MassifIndex uint32 `json:"massifIndex"`
+	File        string `json:"file"`
+	SHA256      string `json:"sha256"`
+	Data        string `json:"data"`
+}
+
+// TestVectorCheckpoint is a checkpoint and the outcome expected from
+// verifying it. Tampered checkpoints are not written to Dir, File is empty
+// for them.
+type TestVectorCheckpoint struct {
+	TestVectorObject
+	MMRSize     uint64   `json:"mmrSize"`
+	Accumulator []string `json:"accumulator"`
+	Valid       bool     `json:"valid"`
+	Description string   `json:"description"`
+}
+
+// TestVectorInclusion is an inclusion proof for the leaf node at MMRIndex,
+// the proof leads to the peak at PeakIndex of the accumulator for MMRSize.
+type TestVectorInclusion struct {
+	MMRIndex    uint64   `json:"mmrIndex"`
+	MMRSize     uint64   `json:"mmrSize"`
+	Node        string   `json:"node"`
+	Proof       []string `json:"proof"`
+	PeakIndex   int      `json:"peakIndex"`
+	Valid       bool     `json:"valid"`
+	Description string   `json:"description"`
+}
+
+// TestVectorConsistency is the consistency proof between two consecutive
+// checkpoints, and the accumulators at each size.
+type TestVectorConsistency struct {
+	FromSize        uint64     `json:"fromSize"`
+	ToSize          uint64     `json:"toSize"`
+	FromAccumulator []string   `json:"fromAccumulator"`
+	ToAccumulator   []string   `json:"toAccumulator"`
+	Paths           [][]string `json:"paths"`
+	RightPeaks      []string   `json:"rightPeaks"`
+	Valid           bool       `json:"valid"`
+	Description     string     `json:"description"`
+}
+
+// GenerateTestVectors builds each of the logs described by specs, or
+// DefaultTestVectorSpecs if there are none, sealing every massif as it fills
+// and the last massif at the end, and writes them as test vectors for
+// verifier implementations in other languages. The vectors are written to
+// the directory "v{TestVectorsFormat}" under dir: vectors.json, and a
+// directory per log holding its massif and checkpoint objects.
+//
+// The log content is deterministic, the signatures are not, as ES256 signing
+// is randomized. Each set of vectors is self consistent and carries the
+// public key of the key it was signed with.
+func GenerateTestVectors(ctx context.Context, dir string, key *ecdsa.PrivateKey, specs ...TestVectorSpec) (*TestVectors, error) {
+	if len(specs) == 0 {
+		specs = DefaultTestVectorSpecs
+	}
+	signer, err := cose.NewSigner(cose.AlgorithmES256, key)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := cose.NewVerifier(cose.AlgorithmES256, &key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if key.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("test vectors are signed with a P-256 key")
+	}
+	x, y := key.PublicKey.X.FillBytes(make([]byte, 32)), key.PublicKey.Y.FillBytes(make([]byte, 32))
+
+	root := filepath.Join(dir, fmt.Sprintf("v%d", TestVectorsFormat))
+	vectors := &TestVectors{
+		Format:       TestVectorsFormat,
+		MassifFormat: MassifCurrentVersion,
+		Algorithm:    cose.AlgorithmES256.String(),
+		PublicKeyX:   hex.EncodeToString(x),
+		PublicKeyY:   hex.EncodeToString(y),
+	}
+	for _, spec := range specs {
+		log, err := generateTestVectorLog(ctx, filepath.Join(root, spec.Name), spec, signer, verifier)
+		if err != nil {
+			return nil, fmt.Errorf("test vector log %s: %w", spec.Name, err)
+		}
+		log.Dir = spec.Name
+		vectors.Logs = append(vectors.Logs, *log)
+	}
+
+	data, err := json.MarshalIndent(vectors, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err = os.WriteFile(filepath.Join(root, TestVectorsFile), append(data, '\n'), 0o644); err != nil {
+		return nil, err
+	}
+	return vectors, nil
+}
+
+func generateTestVectorLog(
+	ctx context.Context, dir string, spec TestVectorSpec, signer cose.Signer, verifier cose.Verifier,
+) (*TestVectorLog, error) {
+	writer, err := NewDirWriter(dir)
+	if err != nil {
+		return nil, err
+	}
+	log := &TestVectorLog{Name: spec.Name, MassifHeight: spec.MassifHeight}
+
+	var sealed []MMRState
+	seal := func(mc *MassifContext) error {
+		var fromSize uint64
+		if len(sealed) > 0 {
+			fromSize = sealed[len(sealed)-1].MMRSize
+		}
+		if mc.RangeCount() == fromSize {
+			return nil
+		}
+		proof, err := BuildConsistencyProof(mc, fromSize, mc.RangeCount())
+		if err != nil {
+			return err
+		}
+		accumulator, err := mmr.PeakHashes(mc, mc.RangeCount()-1)
+		if err != nil {
+			return err
+		}
+		signed, err := SignCheckpointReceipt(signer, proof, accumulator)
+		if err != nil {
+			return err
+		}
+		if err = writer.Put(ctx, mc.Start.MassifIndex, storage.ObjectCheckpoint, signed, false); err != nil {
+			return err
+		}
+		if len(sealed) > 0 {
+			log.Consistency = append(log.Consistency, TestVectorConsistency{
+				FromSize:        fromSize,
+				ToSize:          proof.TreeSize2,
+				FromAccumulator: hexList(sealed[len(sealed)-1].Peaks),
+				ToAccumulator:   hexList(accumulator),
+				Paths:           hexPaths(proof.Paths),
+				RightPeaks:      hexList(proof.RightPeaks),
+				Valid:           true,
+				Description:     "consistency between consecutive checkpoints",
+			})
+		}
+		sealed = append(sealed, MMRState{MMRSize: proof.TreeSize2, Peaks: accumulator})
+		return nil
+	}
+
+	var mc MassifContext
+	for i := range spec.LeafCount {
+		reader, err := NewDirReader(dir)
+		if err != nil {
+			return nil, err
+		}
+		if mc, err = GetAppendContext(ctx, reader, 1, spec.MassifHeight); err != nil {
+			return nil, err
+		}
+		id, _ := IDTimestampFromTime(testVectorsBase.Add(time.Duration(i) * time.Second))
+		value := sha256.Sum256(fmt.Appendf(nil, "test-vector-leaf-%d", i))
+		if _, err = mc.AddHashedLeaf(sha256.New(), id, nil, nil, nil, value[:]); err != nil {
+			return nil, err
+		}
+		if err = CommitContext(ctx, writer, &mc); err != nil {
+			return nil, err
+		}
+		log.Leaves = append(log.Leaves, TestVectorLeaf{
+			LeafIndex:   uint64(i),
+			MMRIndex:    mmr.MMRIndex(uint64(i)),
+			IDTimestamp: fmt.Sprintf("%016x", id),
+			Value:       hex.EncodeToString(value[:]),
+		})
+		if mc.Count() >= TreeCount(spec.MassifHeight) {
+			if err = seal(&mc); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err = seal(&mc); err != nil {
+		return nil, err
+	}
+
+	// the vectors are read back from the written replica, and each
+	// checkpoint is verified, so the expectations are those of this
+	// implementation.
+	reader, err := NewDirReader(dir)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint32(0); i <= mc.Start.MassifIndex; i++ {
+		if err = log.addObjects(ctx, reader, verifier, i); err != nil {
+			return nil, fmt.Errorf("massif %d: %w", i, err)
+		}
+	}
+	if err = log.addInclusion(ctx, reader, sealed[len(sealed)-1].MMRSize); err != nil {
+		return nil, err
+	}
+	if n := len(log.Consistency); n > 0 {
+		tampered := log.Consistency[n-1]
+		tampered.RightPeaks = append([]string{}, tampered.RightPeaks...)
+		tampered.Paths = append([][]string{}, tampered.Paths...)
+		if len(tampered.Paths) > 0 && len(tampered.Paths[0]) > 0 {
+			tampered.Paths[0] = append([]string{}, tampered.Paths[0]...)
+			tampered.Paths[0][0] = flipHexByte(tampered.Paths[0][0])
+		} else {
+			tampered.RightPeaks[0] = flipHexByte(tampered.RightPeaks[0])
+		}
+		tampered.Valid = false
+		tampered.Description = "a proof node is altered"
+		log.Consistency = append(log.Consistency, tampered)
+	}
+	return log, nil
+}
+
+func (log *TestVectorLog) addObjects(ctx context.Context, reader ObjectReader, verifier cose.Verifier, massifIndex uint32) error {
+	vc, err := GetContextVerified(ctx, reader, verifier, massifIndex)
+	if err != nil {
+		return err
+	}
+	massifFile, err := storage.SchemeObjectPath(storage.FlatPathScheme{}, nil, log.MassifHeight, massifIndex, storage.ObjectMassifData)
+	if err != nil {
+		return err
+	}
+	checkpointFile, err := storage.SchemeObjectPath(storage.FlatPathScheme{}, nil, log.MassifHeight, massifIndex, storage.ObjectCheckpoint)
+	if err != nil {
+		return err
+	}
+	log.Massifs = append(log.Massifs, newTestVectorObject(massifIndex, massifFile, vc.Data))
+
+	checkpoint := TestVectorCheckpoint{
+		TestVectorObject: newTestVectorObject(massifIndex, checkpointFile, vc.Checkpoint.Raw),
+		MMRSize:          vc.Checkpoint.MMRSize,
+		Accumulator:      hexList(vc.Accumulator),
+		Valid:            true,
+		Description:      "the checkpoint sealing the massif",
+	}
+	log.Checkpoints = append(log.Checkpoints, checkpoint)
+
+	// the same receipt with its signature altered
+	receipt := vc.Checkpoint.Receipt
+	receipt.Signature = bytes.Clone(receipt.Signature)
+	receipt.Signature[0] ^= 0x01
+	tampered, err := EncodeCheckpointReceipt(receipt.ProtectedHeader, receipt.Proof, receipt.Signature)
+	if err != nil {
+		return err
+	}
+	if _, err = VerifyCheckpointReceipt(&vc.MassifContext, &receipt, verifier); err == nil {
+		return fmt.Errorf("the tampered checkpoint verified")
+	}
+	checkpoint.TestVectorObject = newTestVectorObject(massifIndex, "", tampered)
+	checkpoint.Valid = false
+	checkpoint.Description = "the checkpoint signature is altered"
+	log.Checkpoints = append(log.Checkpoints, checkpoint)
+	return nil
+}
+
+// addInclusion adds a proof for every leaf against the final checkpoint, and
+// an altered copy of the first proof which has any nodes.
+func (log *TestVectorLog) addInclusion(ctx context.Context, reader ObjectReader, mmrSize uint64) error {
+	store := newLogNodeStore(ctx, reader)
+	tampered := false
+	for _, leaf := range log.Leaves {
+		proof, err := mmr.InclusionProof(store, mmrSize-1, leaf.MMRIndex)
+		if err != nil {
+			return fmt.Errorf("leaf %d: %w", leaf.LeafIndex, err)
+		}
+		value, err := hex.DecodeString(leaf.Value)
+		if err != nil {
+			return err
+		}
+		ok, err := mmr.VerifyInclusion(store, sha256.New(), mmrSize, value, leaf.MMRIndex, proof)
+		if !ok || err != nil {
+			return fmt.Errorf("leaf %d: the inclusion proof does not verify: %v", leaf.LeafIndex, err)
+		}
+		v := TestVectorInclusion{
+			MMRIndex:    leaf.MMRIndex,
+			MMRSize:     mmrSize,
+			Node:        leaf.Value,
+			Proof:       hexList(proof),
+			PeakIndex:   mmr.PeakIndex(mmr.LeafCount(mmrSize), len(proof)),
+			Valid:       true,
+			Description: "leaf inclusion in the final checkpoint",
+		}
+		log.Inclusion = append(log.Inclusion, v)
+		if tampered || len(proof) == 0 {
+			continue
+		}
+		tampered = true
+		v.Proof = append([]string{}, v.Proof...)
+		v.Proof[0] = flipHexByte(v.Proof[0])
+		v.Valid = false
+		v.Description = "a proof node is altered"
+		log.Inclusion = append(log.Inclusion, v)
+	}
+	return nil
+}
+
+func newTestVectorObject(massifIndex uint32, file string, data []byte) TestVectorObject {
+	sum := sha256.Sum256(data)
+	return TestVectorObject{
+		MassifIndex: massifIndex,
+		File:        file,
+		SHA256:      hex.EncodeToString(sum[:]),
+		Data:        hex.EncodeToString(data),
+	}
+}
+
+func hexList(values [][]byte) []string {
+	encoded := make([]string, len(values))
+	for i, v := range values {
+		encoded[i] = hex.EncodeToString(v)
+	}
+	return encoded
+}
+
+func hexPaths(paths [][][]byte) [][]string {
+	encoded := make([][]string, len(paths))
+	for i, path := range paths {
+		encoded[i] = hexList(path)
+	}
+	return encoded
+}
+
+// flipHexByte returns the hex encoded node with the low bit of its first
+// byte flipped.
+func flipHexByte(s string) string {
+	b, _ := hex.DecodeString(s)
+	if len(b) > 0 {
+		b[0] ^= 0x01
+	}
+	return hex.EncodeToString(b)
+}
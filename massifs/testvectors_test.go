@@ -0,0 +1,96 @@
+package massifs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGenerateTestVectors checks the generated vectors against their stated
+// expectations. Set MERKLELOG_TEST_VECTORS_DIR to keep them, for use as the
+// interop fixtures of other verifier implementations.
+func TestGenerateTestVectors(t *testing.T) {
+	ctx := context.Background()
+	dir := os.Getenv("MERKLELOG_TEST_VECTORS_DIR")
+	if dir == "" {
+		dir = t.TempDir()
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	vectors, err := GenerateTestVectors(ctx, dir, key)
+	require.NoError(t, err)
+	require.Len(t, vectors.Logs, len(DefaultTestVectorSpecs))
+
+	root := filepath.Join(dir, "v1")
+	data, err := os.ReadFile(filepath.Join(root, TestVectorsFile))
+	require.NoError(t, err)
+	var decoded TestVectors
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, *vectors, decoded)
+
+	verifier := newES256Verifier(t, &key.PublicKey)
+	for _, log := range decoded.Logs {
+		// the written objects are a replica of the log
+		reader, err := NewDirReader(filepath.Join(root, log.Dir))
+		require.NoError(t, err)
+		for _, massif := range log.Massifs {
+			_, err = GetContextVerified(ctx, reader, verifier, massif.MassifIndex)
+			require.NoError(t, err, log.Name)
+			written, err := os.ReadFile(filepath.Join(root, log.Dir, massif.File))
+			require.NoError(t, err)
+			require.Equal(t, massif.Data, hex.EncodeToString(written))
+		}
+
+		for _, c := range log.Checkpoints {
+			raw, err := hex.DecodeString(c.Data)
+			require.NoError(t, err)
+			check, err := NewCheckpoint(raw)
+			require.NoError(t, err)
+			mc, err := GetMassifContext(ctx, reader, c.MassifIndex)
+			require.NoError(t, err)
+			_, err = VerifyCheckpointReceipt(&mc, &check.Receipt, verifier)
+			require.Equal(t, c.Valid, err == nil, "%s massif %d: %s", log.Name, c.MassifIndex, c.Description)
+		}
+
+		store := newLogNodeStore(ctx, reader)
+		require.NotEmpty(t, log.Inclusion)
+		for _, v := range log.Inclusion {
+			node, err := hex.DecodeString(v.Node)
+			require.NoError(t, err)
+			ok, _ := mmr.VerifyInclusion(store, sha256.New(), v.MMRSize, node, v.MMRIndex, mustDecodeHexList(t, v.Proof))
+			require.Equal(t, v.Valid, ok, "%s node %d: %s", log.Name, v.MMRIndex, v.Description)
+		}
+
+		for _, v := range log.Consistency {
+			paths := make([][][]byte, len(v.Paths))
+			for i, path := range v.Paths {
+				paths[i] = mustDecodeHexList(t, path)
+			}
+			roots, err := mmr.ConsistentRoots(sha256.New(), v.FromSize-1, mustDecodeHexList(t, v.FromAccumulator), paths)
+			ok := err == nil
+			if ok {
+				roots = append(roots, mustDecodeHexList(t, v.RightPeaks)...)
+				ok = reflect.DeepEqual(roots, mustDecodeHexList(t, v.ToAccumulator))
+			}
+			require.Equal(t, v.Valid, ok, "%s %d-%d: %s", log.Name, v.FromSize, v.ToSize, v.Description)
+		}
+	}
+}
+
+func mustDecodeHexList(t *testing.T, encoded []string) [][]byte {
+	t.Helper()
+	values, err := decodeHexList(encoded)
+	require.NoError(t, err)
+	return values
+}
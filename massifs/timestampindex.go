@@ -0,0 +1,197 @@
+package massifs
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/forestrie/go-merklelog/urkle"
+)
+
+const (
+	// TimestampIndexVersion is the first byte of a storage.ObjectTimestampIndex
+	// object
+	TimestampIndexVersion uint8 = 1
+	// TimestampIndexHeaderBytes is the version, the massif index and the
+	// index of the first leaf
+	TimestampIndexHeaderBytes = 1 + 4 + 8
+)
+
+var (
+	ErrTimestampIndexInvalid  = errors.New("the timestamp index data is invalid")
+	ErrTimestampIndexMismatch = errors.New("the timestamp index does not match the urkle leaf table")
+)
+
+// TimestampIndex is the optional secondary index of a massif's leaves by
+// idtimestamp. It is the idtimestamps of the leaves in leaf order, which as
+// idtimestamps increase is also idtimestamp order, so an idtimestamp is
+// located by a binary search of a compact array rather than of the massif's
+// v2 index region. The object is a few bytes per leaf, and is written when
+// the massif is sealed, see PutTimestampIndex.
+//
+// The index is not committed by the checkpoint, Verify checks it against the
+// urkle leaf table it was derived from.
+type TimestampIndex struct {
+	MassifIndex uint32
+	// FirstLeaf is the leaf index of the first leaf of the massif
+	FirstLeaf uint64
+	// IDTimestamps are the idtimestamps of the leaves indexed, IDTimestamps[i]
+	// is the idtimestamp of leaf FirstLeaf+i
+	IDTimestamps []uint64
+}
+
+// TimestampIndexReader is implemented by readers which can read the
+// storage.ObjectTimestampIndex objects of a log.
+type TimestampIndexReader interface {
+	// TimestampIndexRead returns the timestamp index object of the massif. A
+	// NotFoundError is returned if there is none.
+	TimestampIndexRead(ctx context.Context, massifIndex uint32) ([]byte, error)
+}
+
+// NewTimestampIndex indexes the first leafCount leaves of the massif, which
+// must be in the current format.
+func NewTimestampIndex(mc *MassifContext, leafCount uint64) (*TimestampIndex, error) {
+	if leafCount > mc.MassifLeafCount() {
+		return nil, fmt.Errorf("%w: %d leaves, massif %d has %d",
+			ErrLeafRange, leafCount, mc.Start.MassifIndex, mc.MassifLeafCount())
+	}
+	leafTable, err := mc.UrkleLeafTableRegion()
+	if err != nil {
+		return nil, err
+	}
+	ix := &TimestampIndex{
+		MassifIndex:  mc.Start.MassifIndex,
+		FirstLeaf:    mmr.LeafCount(mc.Start.FirstIndex),
+		IDTimestamps: make([]uint64, leafCount),
+	}
+	for i := range ix.IDTimestamps {
+		ix.IDTimestamps[i] = urkle.LeafKey(leafTable, uint32(i))
+	}
+	return ix, nil
+}
+
+// MarshalBinary encodes the index as the storage.ObjectTimestampIndex object,
+// the header followed by each idtimestamp, big endian.
+func (ix *TimestampIndex) MarshalBinary() ([]byte, error) {
+	out := make([]byte, TimestampIndexHeaderBytes, TimestampIndexHeaderBytes+len(ix.IDTimestamps)*8)
+	out[0] = TimestampIndexVersion
+	binary.BigEndian.PutUint32(out[1:5], ix.MassifIndex)
+	binary.BigEndian.PutUint64(out[5:13], ix.FirstLeaf)
+	for _, id := range ix.IDTimestamps {
+		out = binary.BigEndian.AppendUint64(out, id)
+	}
+	return out, nil
+}
+
+// DecodeTimestampIndex decodes an index produced by MarshalBinary
+func DecodeTimestampIndex(data []byte) (*TimestampIndex, error) {
+	if len(data) < TimestampIndexHeaderBytes || (len(data)-TimestampIndexHeaderBytes)%8 != 0 {
+		return nil, fmt.Errorf("%w: %d bytes", ErrTimestampIndexInvalid, len(data))
+	}
+	if data[0] != TimestampIndexVersion {
+		return nil, fmt.Errorf("%w: version %d", ErrTimestampIndexInvalid, data[0])
+	}
+	ix := &TimestampIndex{
+		MassifIndex:  binary.BigEndian.Uint32(data[1:5]),
+		FirstLeaf:    binary.BigEndian.Uint64(data[5:13]),
+		IDTimestamps: make([]uint64, (len(data)-TimestampIndexHeaderBytes)/8),
+	}
+	for i := range ix.IDTimestamps {
+		ix.IDTimestamps[i] = binary.BigEndian.Uint64(data[TimestampIndexHeaderBytes+i*8:])
+		// the searches rely on the order
+		if i > 0 && ix.IDTimestamps[i] <= ix.IDTimestamps[i-1] {
+			return nil, fmt.Errorf("%w: idtimestamps out of order at leaf %d", ErrTimestampIndexInvalid, i)
+		}
+	}
+	return ix, nil
+}
+
+// Verify returns ErrTimestampIndexMismatch unless the index is exactly the
+// idtimestamps of the leaves of the massif's urkle leaf table. The massif may
+// have more leaves than were indexed.
+func (ix *TimestampIndex) Verify(mc *MassifContext) error {
+	if ix.MassifIndex != mc.Start.MassifIndex || ix.FirstLeaf != mmr.LeafCount(mc.Start.FirstIndex) {
+		return fmt.Errorf("%w: the index is for massif %d, leaf %d, not massif %d",
+			ErrTimestampIndexMismatch, ix.MassifIndex, ix.FirstLeaf, mc.Start.MassifIndex)
+	}
+	if uint64(len(ix.IDTimestamps)) > mc.MassifLeafCount() {
+		return fmt.Errorf("%w: %d leaves indexed, massif %d has %d",
+			ErrTimestampIndexMismatch, len(ix.IDTimestamps), mc.Start.MassifIndex, mc.MassifLeafCount())
+	}
+	leafTable, err := mc.UrkleLeafTableRegion()
+	if err != nil {
+		return err
+	}
+	for i, id := range ix.IDTimestamps {
+		if urkle.LeafKey(leafTable, uint32(i)) != id {
+			return fmt.Errorf("%w: leaf %d", ErrTimestampIndexMismatch, ix.FirstLeaf+uint64(i))
+		}
+	}
+	return nil
+}
+
+// LeafIndex returns the leaf index of the leaf with the idtimestamp, false if
+// no leaf indexed has it.
+func (ix *TimestampIndex) LeafIndex(idTimestamp uint64) (uint64, bool) {
+	i := sort.Search(len(ix.IDTimestamps), func(i int) bool {
+		return ix.IDTimestamps[i] >= idTimestamp
+	})
+	if i == len(ix.IDTimestamps) || ix.IDTimestamps[i] != idTimestamp {
+		return 0, false
+	}
+	return ix.FirstLeaf + uint64(i), true
+}
+
+// LeafAtOrBefore returns the leaf index of the last leaf whose idtimestamp is
+// at or before idTimestamp, false if every leaf indexed is later.
+func (ix *TimestampIndex) LeafAtOrBefore(idTimestamp uint64) (uint64, bool) {
+	i := sort.Search(len(ix.IDTimestamps), func(i int) bool {
+		return ix.IDTimestamps[i] > idTimestamp
+	})
+	if i == 0 {
+		return 0, false
+	}
+	return ix.FirstLeaf + uint64(i-1), true
+}
+
+// GetTimestampIndex reads and decodes the timestamp index of the massif.
+// storage.ErrUnsupportedCap is returned if the reader is not a
+// TimestampIndexReader.
+func GetTimestampIndex(ctx context.Context, reader ObjectReader, massifIndex uint32) (*TimestampIndex, error) {
+	indexes, ok := reader.(TimestampIndexReader)
+	if !ok {
+		return nil, fmt.Errorf("%w: the reader can not read timestamp indexes", storage.ErrUnsupportedCap)
+	}
+	data, err := indexes.TimestampIndexRead(ctx, massifIndex)
+	if err != nil {
+		return nil, err
+	}
+	ix, err := DecodeTimestampIndex(data)
+	if err != nil {
+		return nil, err
+	}
+	if ix.MassifIndex != massifIndex {
+		return nil, fmt.Errorf("%w: the index for massif %d is stored as massif %d",
+			ErrTimestampIndexInvalid, ix.MassifIndex, massifIndex)
+	}
+	return ix, nil
+}
+
+// PutTimestampIndex indexes the first leafCount leaves of the massif and puts
+// the index as its storage.ObjectTimestampIndex object. It is called once the
+// leaves are sealed, typically with the leaf count of the checkpoint.
+func PutTimestampIndex(ctx context.Context, writer ObjectWriter, mc *MassifContext, leafCount uint64) error {
+	ix, err := NewTimestampIndex(mc, leafCount)
+	if err != nil {
+		return err
+	}
+	data, err := ix.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return writer.Put(ctx, mc.Start.MassifIndex, storage.ObjectTimestampIndex, data, false)
+}
@@ -0,0 +1,94 @@
+package massifs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+func (m *memStore) TimestampIndexRead(ctx context.Context, massifIndex uint32) ([]byte, error) {
+	b, ok := m.timestampIndexes[massifIndex]
+	if !ok {
+		return nil, storage.NewNotFoundError(nil, storage.ObjectTimestampIndex, massifIndex)
+	}
+	return b, nil
+}
+
+func TestTimestampIndex(t *testing.T) {
+	ctx := context.Background()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := cose.NewSigner(cose.AlgorithmES256, key)
+	require.NoError(t, err)
+
+	store := newMemStore(nil, nil)
+	l, err := OpenLog(ctx, store, WithLogMassifHeight(3), WithLogSigner(signer), WithLogTimestampIndex())
+	require.NoError(t, err)
+	var entries []LogEntry
+	for i := range 6 {
+		leaf := sha256.Sum256(fmt.Appendf(nil, "tsidx-leaf-%d", i))
+		entries = append(entries, LogEntry{IDTimestamp: uint64(i+1) * 10, Value: leaf[:]})
+	}
+	_, err = l.Append(ctx, entries...)
+	require.NoError(t, err)
+	_, err = l.Seal(ctx)
+	require.NoError(t, err)
+	require.Len(t, store.timestampIndexes, 2)
+
+	// 4 leaves fill a massif of height 3
+	ix, err := GetTimestampIndex(ctx, store, 1)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), ix.FirstLeaf)
+	require.Equal(t, []uint64{50, 60}, ix.IDTimestamps)
+
+	leafIndex, ok := ix.LeafIndex(50)
+	require.True(t, ok)
+	require.Equal(t, uint64(4), leafIndex)
+	_, ok = ix.LeafIndex(55)
+	require.False(t, ok)
+	leafIndex, ok = ix.LeafAtOrBefore(65)
+	require.True(t, ok)
+	require.Equal(t, uint64(5), leafIndex)
+	_, ok = ix.LeafAtOrBefore(45)
+	require.False(t, ok)
+
+	mc, err := GetMassifContext(ctx, store, 1)
+	require.NoError(t, err)
+	require.NoError(t, ix.Verify(&mc))
+	ix.IDTimestamps[1]++
+	require.ErrorIs(t, ix.Verify(&mc), ErrTimestampIndexMismatch)
+	mc0, err := GetMassifContext(ctx, store, 0)
+	require.NoError(t, err)
+	require.ErrorIs(t, ix.Verify(&mc0), ErrTimestampIndexMismatch)
+
+	// the order the searches rely on is checked when decoding
+	ix.IDTimestamps[1] = 40
+	data, err := ix.MarshalBinary()
+	require.NoError(t, err)
+	_, err = DecodeTimestampIndex(data)
+	require.ErrorIs(t, err, ErrTimestampIndexInvalid)
+	_, err = DecodeTimestampIndex(data[:len(data)-1])
+	require.ErrorIs(t, err, ErrTimestampIndexInvalid)
+
+	// a local replica reads the indexes put alongside the massifs
+	dir := t.TempDir()
+	writer, err := NewDirWriter(dir)
+	require.NoError(t, err)
+	require.NoError(t, writer.Put(ctx, 1, storage.ObjectMassifData, store.massifs[1], false))
+	require.NoError(t, PutTimestampIndex(ctx, writer, &mc, mc.MassifLeafCount()))
+	reader, err := NewDirReader(dir)
+	require.NoError(t, err)
+	ix, err = GetTimestampIndex(ctx, reader, 1)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{50, 60}, ix.IDTimestamps)
+	_, err = GetTimestampIndex(ctx, reader, 0)
+	require.True(t, storage.IsNotFound(err))
+}
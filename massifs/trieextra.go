@@ -0,0 +1,110 @@
+package massifs
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/forestrie/go-merklelog/urkle"
+)
+
+var (
+	ErrTrieExtraRange     = errors.New("the trie extra update is out of range")
+	ErrTrieExtraBound     = errors.New("the trie extra is bound by the urkle leaf hash")
+	ErrTrieExtraCommitted = errors.New("the trie extra is bound by the index commitment")
+)
+
+// TrieExtraUpdate replaces one stored extra field of the Urkle trie entry of
+// a leaf. Field is in [0, urkle.LeafExtraFields), field 0 holds at most 24
+// bytes and the others at most ValueBytes. Shorter values are zero filled.
+type TrieExtraUpdate struct {
+	// LeafOrdinal is the leaf index relative to the first leaf of the massif
+	LeafOrdinal uint32
+	Field       uint8
+	Extra       []byte
+}
+
+// UpdateTrieEntriesExtra applies the updates to the Urkle leaf table of the
+// massif, for example to record the confirmation status of entries. Every
+// update is checked before any is applied, so either all or none of them are
+// made. Later updates of the same field win.
+//
+// The extras of leaves hashed with urkle.LeafHashV1, the default, are not
+// committed by the log nodes, nor by the urkle root, so they can change after
+// the massif is sealed, unless the massif has an index commitment. The extras
+// of leaves appended with BindUrkleExtras are committed by the urkle root,
+// and updating them fails with ErrTrieExtraBound.
+//
+// The index commitment, see WithIndexCommitment, is over the leaf records
+// verbatim, extras included, and a seal carrying it under
+// SealIndexCommitmentLabel binds them. Changing an extra would break those
+// seals, and CommitContext would record a commitment no earlier seal agrees
+// with, so the extras of a massif with a stored index commitment can not be
+// updated, that fails with ErrTrieExtraCommitted. A log whose seals carry the
+// index commitment should record it in the massif too, so this is enforced.
+// The leaf table is covered by the integrity checksums, if the massif has
+// them, which CommitContext brings up to date.
+func UpdateTrieEntriesExtra(mc *MassifContext, updates []TrieExtraUpdate) error {
+	if err := mc.checkWritable("urkle leaf table"); err != nil {
+		return err
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	if _, ok, err := mc.StoredIndexCommitment(); err != nil {
+		return err
+	} else if ok {
+		return fmt.Errorf("%w: massif %d", ErrTrieExtraCommitted, mc.Start.MassifIndex)
+	}
+	leafTable, err := mc.UrkleLeafTableRegion()
+	if err != nil {
+		return err
+	}
+	nodeStore, err := mc.UrkleNodeStoreRegion()
+	if err != nil {
+		return err
+	}
+
+	leafCount := mc.MassifLeafCount()
+	ordinals := make(map[uint32]bool, len(updates))
+	for i, u := range updates {
+		if uint64(u.LeafOrdinal) >= leafCount {
+			return fmt.Errorf("%w: update %d: leaf %d, the massif has %d leaves",
+				ErrTrieExtraRange, i, u.LeafOrdinal, leafCount)
+		}
+		if u.Field >= urkle.LeafExtraFields {
+			return fmt.Errorf("%w: update %d: field %d", ErrTrieExtraRange, i, u.Field)
+		}
+		if limit := trieExtraFieldBytes(u.Field); len(u.Extra) > limit {
+			return fmt.Errorf("%w: update %d: %d bytes, field %d holds %d",
+				ErrTrieExtraRange, i, len(u.Extra), u.Field, limit)
+		}
+		ordinals[u.LeafOrdinal] = true
+	}
+
+	// The leaf records of the node store carry the hash format of each leaf,
+	// a single pass finds any of the updated leaves which bind their extras.
+	for off := uint64(0); off+urkle.NodeRecordBytes <= uint64(len(nodeStore)); off += urkle.NodeRecordBytes {
+		ref := urkle.Ref(off / urkle.NodeRecordBytes)
+		if urkle.NodeKindAt(nodeStore, ref) != urkle.KindLeaf {
+			continue
+		}
+		ordinal := urkle.NodeLeafOrdinal(nodeStore, ref)
+		if ordinals[ordinal] && urkle.NodeLeafHashFormat(nodeStore, ref) == urkle.LeafHashV2 {
+			return fmt.Errorf("%w: leaf %d", ErrTrieExtraBound, ordinal)
+		}
+	}
+
+	for _, u := range updates {
+		urkle.LeafSetExtra(leafTable, u.LeafOrdinal, u.Field, u.Extra)
+	}
+	return nil
+}
+
+// trieExtraFieldBytes returns the bytes the extra field holds, the first is
+// short so that the leaf record fits urkle.LeafRecordBytes.
+func trieExtraFieldBytes(field uint8) int {
+	if field == 0 {
+		return ValueBytes - 8
+	}
+	return ValueBytes
+}
@@ -0,0 +1,94 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/urkle"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateTrieEntriesExtra(t *testing.T) {
+	ctx := context.Background()
+	store, verifier := buildSealedLog(t, 3, 11)
+
+	mc, err := GetMassifContext(ctx, store, 1)
+	require.NoError(t, err)
+	before, ok, err := mc.UrkleRootHash()
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	confirmed := bytes.Repeat([]byte{0xc0}, ValueBytes)
+	require.NoError(t, UpdateTrieEntriesExtra(&mc, []TrieExtraUpdate{
+		{LeafOrdinal: 0, Field: 2, Extra: confirmed},
+		{LeafOrdinal: 3, Field: 0, Extra: []byte{1}},
+		{LeafOrdinal: 3, Field: 0, Extra: []byte{2}},
+	}))
+	leafTable, err := mc.UrkleLeafTableRegion()
+	require.NoError(t, err)
+	extra := urkle.LeafExtra(leafTable, 0, 2)
+	require.Equal(t, confirmed, extra[:])
+	extra = urkle.LeafExtra(leafTable, 3, 0)
+	require.Equal(t, byte(2), extra[0])
+	// the other fields are untouched
+	extra = urkle.LeafExtra(leafTable, 3, 1)
+	require.Equal(t, make([]byte, ValueBytes), extra[:])
+
+	// the extras are outside the hashed data
+	after, _, err := mc.UrkleRootHash()
+	require.NoError(t, err)
+	require.Equal(t, before, after)
+	store.massifs[1] = mc.Data
+	_, err = GetContextVerified(ctx, store, verifier, 1)
+	require.NoError(t, err)
+
+	// a bad update fails the batch before anything is changed
+	snapshot := bytes.Clone(mc.Data)
+	for _, bad := range []TrieExtraUpdate{
+		{LeafOrdinal: 4, Field: 1},
+		{LeafOrdinal: 0, Field: urkle.LeafExtraFields},
+		{LeafOrdinal: 0, Field: 0, Extra: make([]byte, ValueBytes)},
+		{LeafOrdinal: 0, Field: 1, Extra: make([]byte, ValueBytes+1)},
+	} {
+		err = UpdateTrieEntriesExtra(&mc, []TrieExtraUpdate{{LeafOrdinal: 1, Field: 1, Extra: confirmed}, bad})
+		require.ErrorIs(t, err, ErrTrieExtraRange)
+		require.Equal(t, snapshot, mc.Data)
+	}
+}
+
+func TestUpdateTrieEntriesExtraBound(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore(nil, nil)
+	mc, err := GetAppendContext(ctx, store, 1, 3)
+	require.NoError(t, err)
+	mc.BindUrkleExtras = true
+	value := sha256.Sum256([]byte("bound-extras"))
+	_, err = mc.AddHashedLeaf(sha256.New(), 1, nil, nil, testTrieKey(0), value[:])
+	require.NoError(t, err)
+
+	err = UpdateTrieEntriesExtra(&mc, []TrieExtraUpdate{{LeafOrdinal: 0, Field: 2, Extra: []byte{1}}})
+	require.ErrorIs(t, err, ErrTrieExtraBound)
+}
+
+func TestUpdateTrieEntriesExtraCommitted(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore(nil, nil)
+	mc, err := GetAppendContext(ctx, store, 1, 3)
+	require.NoError(t, err)
+	value := sha256.Sum256([]byte("committed-extras"))
+	_, err = mc.AddHashedLeaf(sha256.New(), 1, nil, nil, nil, value[:])
+	require.NoError(t, err)
+	require.NoError(t, CommitContext(ctx, store, &mc, WithIndexCommitment()))
+
+	mc, err = GetMassifContext(ctx, store, 0)
+	require.NoError(t, err)
+	snapshot := bytes.Clone(mc.Data)
+	err = UpdateTrieEntriesExtra(&mc, []TrieExtraUpdate{{LeafOrdinal: 0, Field: 2, Extra: []byte{1}}})
+	require.ErrorIs(t, err, ErrTrieExtraCommitted)
+	require.Equal(t, snapshot, mc.Data)
+	ok, err := mc.CheckIndexCommitment()
+	require.NoError(t, err)
+	require.True(t, ok)
+}
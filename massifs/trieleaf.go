@@ -0,0 +1,138 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/forestrie/go-merklelog/urkle"
+	"github.com/veraison/go-cose"
+)
+
+// ErrTrieKeyNotFound is returned by GetLeafByTrieKey when no leaf has the key.
+var ErrTrieKeyNotFound = errors.New("no leaf has the trie key")
+
+// TrieKeyLeaf is a leaf found by its trie key, with the proof of its
+// inclusion in the log.
+type TrieKeyLeaf struct {
+	MMRIndex  uint64
+	LeafIndex uint64
+	// Value is the leaf value, it is the node in the log
+	Value []byte
+
+	// IDTimestamp and Extras are the leaf's Urkle trie entry. Extras are the
+	// stored extra fields, zero if unset.
+	IDTimestamp uint64
+	Extras      [urkle.LeafExtraFields][]byte
+
+	// Checkpoint is the latest checkpoint of the log, it was verified before
+	// the proof was made
+	Checkpoint *Checkpoint
+	// Proof is the inclusion proof of the leaf in Checkpoint.MMRSize
+	Proof [][]byte
+}
+
+// GetLeafByTrieKey finds the first leaf with the trie key and proves it is
+// included in the log, so 'prove my event' is a single call. The reader
+// identifies the log, as for GetMassifContext.
+//
+// Massifs are shortlisted with bloom filter 0, which holds the trie key when
+// it is passed as extraBytes0 to AddHashedLeaf, or otherwise the leaf value.
+// The Urkle leaf table of each shortlisted massif is then searched for a leaf
+// whose value, or one of whose stored extras, is the trie key. So the key
+// must be both the bloom 0 element of the leaf and recorded in its trie
+// entry.
+//
+// The latest checkpoint is verified with the verifier, and the proof is made
+// and checked against its accumulator. Leaves added after the latest
+// checkpoint are not found. The options are those of GetContextVerified.
+func GetLeafByTrieKey(
+	ctx context.Context, reader ObjectReader, verifier cose.Verifier, trieKey []byte, opts ...Option,
+) (*TrieKeyLeaf, error) {
+	if len(trieKey) != ValueBytes {
+		return nil, ErrLogValueBadSize
+	}
+
+	head, err := reader.HeadIndex(ctx, storage.ObjectCheckpoint)
+	if err != nil {
+		return nil, err
+	}
+	verified, err := GetContextVerified(ctx, reader, verifier, head, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to get verified context %d", err, head)
+	}
+	check := verified.Checkpoint
+
+	for i := uint32(0); i <= head; i++ {
+		maybe, err := massifMaybeContains(ctx, reader, i, trieKey)
+		if err != nil {
+			return nil, err
+		}
+		if !maybe {
+			continue
+		}
+		mc, err := GetMassifContext(ctx, reader, i)
+		if err != nil {
+			return nil, err
+		}
+		leaf, err := findTrieKeyLeaf(&mc, trieKey, check.MMRSize)
+		if err != nil {
+			return nil, err
+		}
+		if leaf == nil {
+			continue
+		}
+
+		store := newLogNodeStore(ctx, reader)
+		store.massifs[i] = &mc
+		store.massifs[head] = &verified.MassifContext
+		leaf.Proof, err = mmr.InclusionProof(store, check.MMRSize-1, leaf.MMRIndex)
+		if err != nil {
+			return nil, err
+		}
+		if err = verifyAccumulatorInclusion(
+			check.MMRSize, verified.Accumulator, leaf.MMRIndex, leaf.Value, leaf.Proof); err != nil {
+			return nil, err
+		}
+		leaf.Checkpoint = &check
+		return leaf, nil
+	}
+	return nil, fmt.Errorf("%w: %x", ErrTrieKeyNotFound, trieKey)
+}
+
+// findTrieKeyLeaf searches the massif's Urkle leaf table for the first leaf,
+// below mmrSize, whose value or a stored extra is the trie key. It returns nil
+// if there is none.
+func findTrieKeyLeaf(mc *MassifContext, trieKey []byte, mmrSize uint64) (*TrieKeyLeaf, error) {
+	leaves, err := mc.Leaves()
+	if err != nil {
+		return nil, err
+	}
+	for leaf := range leaves {
+		if leaf.MMRIndex >= mmrSize {
+			return nil, nil
+		}
+		match := bytes.Equal(leaf.TrieKey[:], trieKey)
+		for _, extra := range leaf.Extras {
+			match = match || bytes.Equal(extra[:], trieKey)
+		}
+		if !match {
+			continue
+		}
+
+		found := &TrieKeyLeaf{
+			MMRIndex:    leaf.MMRIndex,
+			LeafIndex:   leaf.LeafIndex,
+			IDTimestamp: leaf.IDTimestamp,
+			Value:       bytes.Clone(leaf.Value),
+		}
+		for i := range leaf.Extras {
+			found.Extras[i] = bytes.Clone(leaf.Extras[i][:])
+		}
+		return found, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,72 @@
+package massifs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+func testTrieKey(i int) []byte {
+	key := sha256.Sum256(fmt.Appendf(nil, "trie-key-%d", i))
+	return key[:]
+}
+
+// buildTrieKeyLog appends leafCount leaves, each with its trie key as both the
+// bloom 0 element and the app id, and seals the head massif.
+func buildTrieKeyLog(t *testing.T, massifHeight uint8, leafCount int) (*memStore, cose.Verifier) {
+	t.Helper()
+	ctx := context.Background()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := cose.NewSigner(cose.AlgorithmES256, key)
+	require.NoError(t, err)
+
+	store := newMemStore(nil, nil)
+	var mc MassifContext
+	for i := range leafCount {
+		mc, err = GetAppendContext(ctx, store, 1, massifHeight)
+		require.NoError(t, err)
+		value := sha256.Sum256(fmt.Appendf(nil, "trie-key-log-leaf-%d", i))
+		trieKey := testTrieKey(i)
+		_, err = mc.AddHashedLeaf(sha256.New(), uint64(i+1), trieKey, nil, trieKey, value[:])
+		require.NoError(t, err)
+		require.NoError(t, CommitContext(ctx, store, &mc))
+	}
+	store.checkpoint[mc.Start.MassifIndex] = signCheckpointV3WithSigner(t, &mc, signer, mc.Start.FirstIndex)
+	return store, newES256Verifier(t, &key.PublicKey)
+}
+
+func TestGetLeafByTrieKey(t *testing.T) {
+	ctx := context.Background()
+	store, verifier := buildTrieKeyLog(t, 3, 11)
+
+	for _, leafIndex := range []int{0, 3, 5, 10} {
+		leaf, err := GetLeafByTrieKey(ctx, store, verifier, testTrieKey(leafIndex))
+		require.NoError(t, err)
+		require.Equal(t, uint64(leafIndex), leaf.LeafIndex)
+		require.Equal(t, mmr.MMRIndex(uint64(leafIndex)), leaf.MMRIndex)
+		require.Equal(t, uint64(leafIndex+1), leaf.IDTimestamp)
+		require.Equal(t, testTrieKey(leafIndex), leaf.Extras[1])
+		value := sha256.Sum256(fmt.Appendf(nil, "trie-key-log-leaf-%d", leafIndex))
+		require.Equal(t, value[:], leaf.Value)
+
+		// the proof reaches a peak of the latest checkpoint
+		head, err := GetMassifContext(ctx, store, 2)
+		require.NoError(t, err)
+		require.Equal(t, head.RangeCount(), leaf.Checkpoint.MMRSize)
+		peaks, err := mmr.PeakHashes(&head, leaf.Checkpoint.MMRSize-1)
+		require.NoError(t, err)
+		require.Contains(t, peaks, mmr.IncludedRoot(sha256.New(), leaf.MMRIndex, leaf.Value, leaf.Proof))
+	}
+
+	_, err := GetLeafByTrieKey(ctx, store, verifier, testTrieKey(11))
+	require.ErrorIs(t, err, ErrTrieKeyNotFound)
+}
@@ -0,0 +1,155 @@
+package massifs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/forestrie/go-merklelog/massifs/logformat"
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/forestrie/go-merklelog/urkle"
+)
+
+var ErrTruncateBelowStart = errors.New("the truncation target is before the start of the massif")
+
+// TruncateToSealedState discards the unsealed tail of the massif, the log
+// nodes after checkpoint.MMRSize, so that the context is exactly the state
+// the checkpoint seals. It is for rolling back appends made in error, before
+// they are sealed. The checkpoint should already be verified against the
+// massif, typically it is the Checkpoint of a VerifiedContext for it.
+//
+// The Urkle trie is rebuilt from the entries of the leaves which remain, its
+// root is cleared as the trie is no longer complete, and the last idtimestamp
+// is set to that of the last remaining leaf. If no leaves remain it is left as it was. The bloom filters can only
+// have elements added, and the elements of the discarded leaves can not be
+// removed, so they are left in place. This only makes false positives more
+// likely. The statistics, index commitment, committed length and integrity
+// blocks are brought up to date by CommitContext, which must Put the whole
+// massif.
+//
+// It fails with ErrTruncateBelowStart if the checkpoint does not reach this
+// massif, and it requires the current massif format. The context is unchanged
+// if it fails.
+func TruncateToSealedState(mc *MassifContext, checkpoint *Checkpoint) error {
+	if err := mc.checkWritable("log data"); err != nil {
+		return err
+	}
+	if err := mc.requireV2Index(); err != nil {
+		return err
+	}
+	target := checkpoint.MMRSize
+	if target < mc.Start.FirstIndex {
+		return fmt.Errorf("%w: sealed size %d, massif %d starts at %d",
+			ErrTruncateBelowStart, target, mc.Start.MassifIndex, mc.Start.FirstIndex)
+	}
+	if target > mc.RangeCount() {
+		return fmt.Errorf("%w: sealed size %d, massif %d has size %d",
+			ErrStateSizeExceedsData, target, mc.Start.MassifIndex, mc.RangeCount())
+	}
+	if target != 0 && mmr.Peaks(target-1) == nil {
+		return fmt.Errorf("sealed size %d is not a complete mmr size", target)
+	}
+	if target == mc.RangeCount() {
+		return nil
+	}
+
+	keep := mmr.LeafCount(target) - mmr.LeafCount(mc.Start.FirstIndex)
+	prefix := bytes.Clone(mc.Data[:mc.LogStart()])
+	if err := mc.rebuildUrkle(keep); err != nil {
+		copy(mc.Data, prefix)
+		return err
+	}
+	if keep > 0 {
+		leafTable, err := mc.UrkleLeafTableRegion()
+		if err != nil {
+			return err
+		}
+		if err := mc.SetLastIDTimestamp(urkle.LeafKey(leafTable, uint32(keep-1))); err != nil {
+			return err
+		}
+	}
+
+	mc.Data = mc.Data[:mc.LogStart()+(target-mc.Start.FirstIndex)*ValueBytes]
+	// the stored massif is longer, so the next commit can't be an append
+	mc.committed = nil
+	return nil
+}
+
+// rebuildUrkle rebuilds the trie from the first keep entries of the leaf
+// table, each leaf is hashed in the format it was originally.
+func (mc *MassifContext) rebuildUrkle(keep uint64) error {
+	leafTable, err := mc.UrkleLeafTableRegion()
+	if err != nil {
+		return err
+	}
+	nodeStore, err := mc.UrkleNodeStoreRegion()
+	if err != nil {
+		return err
+	}
+	frontier, err := mc.UrkleFrontierRegion()
+	if err != nil {
+		return err
+	}
+
+	type entry struct {
+		key    uint64
+		value  [urkle.HashBytes]byte
+		extras [urkle.LeafExtraFields][urkle.HashBytes]byte
+		format urkle.LeafHashFormat
+	}
+	entries := make([]entry, keep)
+	for i := range entries {
+		entries[i] = entry{
+			key:    urkle.LeafKey(leafTable, uint32(i)),
+			value:  urkle.LeafValue(leafTable, uint32(i)),
+			extras: urkle.LeafExtras(leafTable, uint32(i)),
+		}
+	}
+	for off := uint64(0); off+urkle.NodeRecordBytes <= uint64(len(nodeStore)); off += urkle.NodeRecordBytes {
+		ref := urkle.Ref(off / urkle.NodeRecordBytes)
+		if urkle.NodeKindAt(nodeStore, ref) != urkle.KindLeaf {
+			continue
+		}
+		if ordinal := uint64(urkle.NodeLeafOrdinal(nodeStore, ref)); ordinal < keep {
+			entries[ordinal].format = urkle.NodeLeafHashFormat(nodeStore, ref)
+		}
+	}
+
+	clear(leafTable)
+	clear(nodeStore)
+	clear(frontier)
+	start, end, err := startHeaderWordRange(logformat.UrkleRootWord)
+	if err != nil {
+		return err
+	}
+	clear(mc.Data[start:end])
+
+	b, err := urkle.NewBuilder(sha256.New(), leafTable, nodeStore)
+	if err != nil {
+		return err
+	}
+	for i, e := range entries {
+		extras := make([][]byte, urkle.LeafExtraFields)
+		for j := range e.extras {
+			extras[j] = e.extras[j][:]
+		}
+		if e.format == urkle.LeafHashV2 {
+			_, err = b.InsertMonotoneExtras(e.key, e.value[:], extras...)
+		} else {
+			_, err = b.InsertMonotone(e.key, e.value[:])
+		}
+		if err != nil {
+			return fmt.Errorf("failed to rebuild the urkle trie at leaf %d: %w", i, err)
+		}
+		if e.format != urkle.LeafHashV2 {
+			for j, extra := range extras {
+				urkle.LeafSetExtra(leafTable, uint32(i), uint8(j), extra)
+			}
+		}
+	}
+	if keep == 0 {
+		return nil
+	}
+	return b.SaveFrontier(frontier)
+}
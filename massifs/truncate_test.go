@@ -0,0 +1,88 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTruncateToSealedState(t *testing.T) {
+	ctx := context.Background()
+	// massif 1 is sealed with one leaf
+	store, verifier := buildSealedLog(t, 3, 5)
+	sealed, err := GetMassifContext(ctx, store, 1)
+	require.NoError(t, err)
+	sealed.Data = bytes.Clone(sealed.Data)
+
+	// two unsealed leaves are added in error
+	for i := range 2 {
+		mc, err := GetAppendContext(ctx, store, 1, 3)
+		require.NoError(t, err)
+		leaf := sha256.Sum256(fmt.Appendf(nil, "unsealed-leaf-%d", i))
+		_, err = mc.AddHashedLeaf(sha256.New(), uint64(100+i), nil, nil, nil, leaf[:])
+		require.NoError(t, err)
+		require.NoError(t, CommitContext(ctx, store, &mc))
+	}
+
+	vc, err := GetContextVerified(ctx, store, verifier, 1)
+	require.NoError(t, err)
+	mc := vc.MassifContext
+	require.NoError(t, TruncateToSealedState(&mc, &vc.Checkpoint))
+	require.Equal(t, len(sealed.Data), len(mc.Data))
+	require.Equal(t, uint64(5), mc.GetLastIDTimestamp())
+	require.Equal(t, sealed.Data[mc.LogStart():], mc.Data[mc.LogStart():])
+
+	// the trie is as it was when the massif was sealed
+	for _, region := range []func(MassifContext) ([]byte, error){
+		MassifContext.UrkleLeafTableRegion,
+		MassifContext.UrkleNodeStoreRegion,
+		MassifContext.UrkleFrontierRegion,
+	} {
+		want, err := region(sealed)
+		require.NoError(t, err)
+		got, err := region(mc)
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+	}
+
+	// the truncated massif is committed, and appends continue from it
+	require.NoError(t, CommitContext(ctx, store, &mc))
+	_, err = GetContextVerified(ctx, store, verifier, 1)
+	require.NoError(t, err)
+	mc, err = GetAppendContext(ctx, store, 1, 3)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), mc.MassifLeafCount())
+	leaf := sha256.Sum256([]byte("after-truncation"))
+	_, err = mc.AddHashedLeaf(sha256.New(), 6, nil, nil, nil, leaf[:])
+	require.NoError(t, err)
+
+	// truncating to the current state changes nothing
+	before := bytes.Clone(vc.Data)
+	require.NoError(t, TruncateToSealedState(&vc.MassifContext, &Checkpoint{MMRSize: vc.RangeCount()}))
+	require.Equal(t, before, vc.Data)
+}
+
+func TestTruncateToSealedStateBelowStart(t *testing.T) {
+	ctx := context.Background()
+	store, _ := buildSealedLog(t, 3, 6)
+	mc, err := GetMassifContext(ctx, store, 1)
+	require.NoError(t, err)
+	before := bytes.Clone(mc.Data)
+
+	err = TruncateToSealedState(&mc, &Checkpoint{MMRSize: mc.Start.FirstIndex - 1})
+	require.ErrorIs(t, err, ErrTruncateBelowStart)
+	err = TruncateToSealedState(&mc, &Checkpoint{MMRSize: mc.RangeCount() + 1})
+	require.ErrorIs(t, err, ErrStateSizeExceedsData)
+	require.Equal(t, before, mc.Data)
+
+	// the massif start is a valid target, no leaves remain
+	require.NoError(t, TruncateToSealedState(&mc, &Checkpoint{MMRSize: mc.Start.FirstIndex}))
+	require.Equal(t, uint64(0), mc.Count())
+	_, ok, err := mc.UrkleRootHash()
+	require.NoError(t, err)
+	require.False(t, ok)
+}
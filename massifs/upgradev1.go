@@ -0,0 +1,131 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/forestrie/go-merklelog/mmr"
+)
+
+var (
+	ErrUpgradeUnsupported = errors.New("the massif can not be upgraded")
+	ErrUpgradeMismatch    = errors.New("the trie entries do not match the massif")
+)
+
+// V1TrieEntry is the index entry a version 1 massif kept for each leaf. The
+// trie key becomes the element of bloom filter 0, as extraBytes0 does for
+// AddHashedLeaf, and is also kept as the first extra of the Urkle leaf record,
+// where the version 1 index kept it.
+type V1TrieEntry struct {
+	TrieKey     []byte
+	IDTimestamp uint64
+}
+
+// UpgradeMassifV1 returns the data of a version 1 massif rewritten in the
+// current format. The v2 index region (bloom filters, Urkle leaf table, node
+// store and frontier) is computed from the trie entries, one per leaf in leaf
+// order, and the leaf values read from the log. The ancestor peak stack and
+// the mmr nodes are copied unchanged, and are checked to be byte for byte
+// identical once the index is written, so existing checkpoints for the massif
+// remain valid.
+//
+// The massif start header keeps its first word, the version is set to
+// MassifCurrentVersion and the last id to the last entry's id timestamp. If
+// the version 1 header records a last id it must agree.
+func UpgradeMassifV1(data []byte, entries []V1TrieEntry) ([]byte, error) {
+	if len(data) < StartHeaderEnd {
+		return nil, ErrMassifFixedHeaderMissing
+	}
+	v1 := MassifContext{Start: MakeMassifStart(data), MassifData: MassifData{Data: data}}
+	if v1.Start.Version != 1 {
+		return nil, fmt.Errorf("%w: version %d is not 1", ErrUpgradeUnsupported, v1.Start.Version)
+	}
+	if err := CheckMassifHeightV2(v1.Start.MassifHeight); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUpgradeUnsupported, err)
+	}
+	if uint64(len(data)) < v1.LogStart() || (uint64(len(data))-v1.LogStart())%ValueBytes != 0 {
+		return nil, fmt.Errorf("%w: %d bytes is not a version 1 massif", ErrMassifDataLengthInvalid, len(data))
+	}
+	if err := v1.CreatePeakStackMap(); err != nil {
+		return nil, err
+	}
+
+	first, last := v1.Start.FirstIndex, v1.RangeCount()
+	leafCount := mmr.LeafCount(last) - mmr.LeafCount(first)
+	if uint64(len(entries)) != leafCount {
+		return nil, fmt.Errorf("%w: %d entries for %d leaves", ErrUpgradeMismatch, len(entries), leafCount)
+	}
+
+	v2 := MassifContext{Start: v1.Start}
+	v2.Start.Version = MassifCurrentVersion
+	header, err := v2.Start.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	copy(header[:MassifStartKeyLastIDFirstByte], data[:MassifStartKeyLastIDFirstByte])
+
+	v2.Data = append(header, v2.InitIndexData()...)
+	v2.Data = append(v2.Data, data[v1.PeakStackStart():]...)
+	if err = v2.initIndexV2(); err != nil {
+		return nil, fmt.Errorf("failed to init v2 index: %w", err)
+	}
+
+	e := 0
+	for i := first; i < last; i++ {
+		if mmr.IndexHeight(i) != 0 {
+			continue
+		}
+		value, err := v1.Get(i)
+		if err != nil {
+			return nil, err
+		}
+		entry := entries[e]
+		ordinal, err := v2.indexHashedLeaf(entry.IDTimestamp, entry.TrieKey, value, [][]byte{entry.TrieKey})
+		if err != nil {
+			return nil, fmt.Errorf("%w: leaf %d: %w", ErrUpgradeMismatch, mmr.LeafIndex(i), err)
+		}
+		if ordinal != uint32(e) {
+			return nil, fmt.Errorf("%w: leaf %d has urkle ordinal %d", ErrUpgradeMismatch, mmr.LeafIndex(i), ordinal)
+		}
+		e++
+	}
+	if leafCount > 0 {
+		lastID := entries[leafCount-1].IDTimestamp
+		if v1.Start.LastID != 0 && v1.Start.LastID != lastID {
+			return nil, fmt.Errorf(
+				"%w: the massif last id %d is not the last entry id %d", ErrUpgradeMismatch, v1.Start.LastID, lastID)
+		}
+		if err := v2.SetLastIDTimestamp(lastID); err != nil {
+			return nil, err
+		}
+	}
+
+	if !bytes.Equal(v2.Data[v2.PeakStackStart():], data[v1.PeakStackStart():]) {
+		return nil, fmt.Errorf("%w: the mmr node region changed", ErrUpgradeMismatch)
+	}
+	return v2.Data, nil
+}
+
+// UpgradeMassifV1InPlace reads the version 1 massif from the store, upgrades
+// it with UpgradeMassifV1 and writes it back in its place. Massifs already in
+// the current format are left alone. Readers holding the massif's checkpoint
+// can verify the upgraded massif against it without change.
+func UpgradeMassifV1InPlace(
+	ctx context.Context, store ObjectReaderWriter, massifIndex uint32, entries []V1TrieEntry,
+) error {
+	data, err := store.MassifReadN(ctx, massifIndex, -1)
+	if err != nil {
+		return err
+	}
+	if len(data) >= StartHeaderEnd && MakeMassifStart(data).Version == MassifCurrentVersion {
+		return nil
+	}
+	upgraded, err := UpgradeMassifV1(data, entries)
+	if err != nil {
+		return err
+	}
+	return store.Put(ctx, massifIndex, storage.ObjectMassifData, upgraded, false)
+}
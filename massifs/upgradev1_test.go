@@ -0,0 +1,96 @@
+package massifs
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/mmr"
+	"github.com/stretchr/testify/require"
+)
+
+func upgradeTestEntries(n int) []V1TrieEntry {
+	entries := make([]V1TrieEntry, n)
+	for i := range entries {
+		key := sha256.Sum256(fmt.Appendf(nil, "trie-key-%d", i))
+		entries[i] = V1TrieEntry{TrieKey: key[:], IDTimestamp: uint64(1000 + i)}
+	}
+	return entries
+}
+
+func TestUpgradeMassifV1(t *testing.T) {
+	ctx := context.Background()
+	for _, leafCount := range []int{0, 2, 4} {
+		t.Run(fmt.Sprintf("leaves=%d", leafCount), func(t *testing.T) {
+			v1 := buildLegacyBlobMassif0(t, 1 /*blobVersion*/, 3 /*massifHeight*/, leafCount)
+			entries := upgradeTestEntries(leafCount)
+
+			upgraded, err := UpgradeMassifV1(v1.Data, entries)
+			require.NoError(t, err)
+			mc := MassifContext{Start: MakeMassifStart(upgraded), MassifData: MassifData{Data: upgraded}}
+			require.Equal(t, MassifCurrentVersion, mc.Start.Version)
+			require.Equal(t, v1.Data[v1.PeakStackStart():], upgraded[mc.PeakStackStart():])
+			require.Equal(t, v1.RangeCount(), mc.RangeCount())
+
+			// the index is exactly what appending the same leaves would build
+			want, err := CreateFirstMassifContext(ctx, 1, 3)
+			require.NoError(t, err)
+			for i, entry := range entries {
+				value, err := v1.Get(mmr.MMRIndex(uint64(i)))
+				require.NoError(t, err)
+				_, err = want.AddHashedLeaf(sha256.New(), entry.IDTimestamp, entry.TrieKey, entry.TrieKey, nil, value)
+				require.NoError(t, err)
+			}
+			require.Equal(t, want.Data, upgraded)
+
+			if leafCount == 0 {
+				return
+			}
+			// existing seals remain valid
+			signed, verifier := signCheckpointV3(t, &v1)
+			store := newMemStore(upgraded, signed)
+			vc, err := GetContextVerified(ctx, store, verifier, 0)
+			require.NoError(t, err)
+			require.Equal(t, MassifCurrentVersion, vc.Start.Version)
+		})
+	}
+}
+
+func TestUpgradeMassifV1Rejects(t *testing.T) {
+	v1 := buildLegacyBlobMassif0(t, 1, 3, 3)
+
+	_, err := UpgradeMassifV1(v1.Data, upgradeTestEntries(2))
+	require.ErrorIs(t, err, ErrUpgradeMismatch)
+
+	entries := upgradeTestEntries(3)
+	entries[2].IDTimestamp = entries[1].IDTimestamp
+	_, err = UpgradeMassifV1(v1.Data, entries)
+	require.ErrorIs(t, err, ErrUpgradeMismatch)
+
+	v0 := buildLegacyBlobMassif0(t, 0, 3, 3)
+	_, err = UpgradeMassifV1(v0.Data, upgradeTestEntries(3))
+	require.ErrorIs(t, err, ErrUpgradeUnsupported)
+
+	upgraded, err := UpgradeMassifV1(v1.Data, upgradeTestEntries(3))
+	require.NoError(t, err)
+	_, err = UpgradeMassifV1(upgraded, upgradeTestEntries(3))
+	require.ErrorIs(t, err, ErrUpgradeUnsupported)
+}
+
+func TestUpgradeMassifV1InPlace(t *testing.T) {
+	ctx := context.Background()
+	v1 := buildLegacyBlobMassif0(t, 1, 3, 3)
+	store := newMemStore(v1.Data, nil)
+
+	require.NoError(t, UpgradeMassifV1InPlace(ctx, store, 0, upgradeTestEntries(3)))
+	mc, err := GetMassifContext(ctx, store, 0)
+	require.NoError(t, err)
+	require.Equal(t, MassifCurrentVersion, mc.Start.Version)
+	require.Equal(t, uint64(1002), mc.Start.LastID)
+
+	// a second upgrade is a no-op
+	upgraded := store.massifs[0]
+	require.NoError(t, UpgradeMassifV1InPlace(ctx, store, 0, nil))
+	require.Equal(t, upgraded, store.massifs[0])
+}
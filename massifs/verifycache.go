@@ -0,0 +1,145 @@
+package massifs
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// VerificationCache records successful verifications of massif data against
+// a checkpoint, keyed by the content hashes of both. Because the key is the
+// content, not the storage path, a hit is valid wherever the same bytes are
+// found: in another replica, or in a later process when the cache is
+// persisted.
+//
+// Only completed massifs are recorded. They are immutable, so once verified
+// their consistency with the checkpoint never needs checking again, while the
+// head massif changes with every append.
+//
+// The cache does not know which key verified the checkpoint, so a hit does
+// not skip the signature check, which is made against the keys trusted by
+// each verification. Use a SignatureCache to make that cheap too.
+type VerificationCache struct {
+	mu      sync.Mutex
+	path    string
+	entries map[[32]byte]struct{}
+}
+
+// NewVerificationCache returns an empty, in memory, cache.
+func NewVerificationCache() *VerificationCache {
+	return &VerificationCache{entries: map[[32]byte]struct{}{}}
+}
+
+// OpenVerificationCache loads the cache persisted at path, if there is one.
+// Save writes the cache back to the same path.
+func OpenVerificationCache(path string) (*VerificationCache, error) {
+	c := NewVerificationCache()
+	c.path = path
+
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		b, err := hex.DecodeString(line)
+		if err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("verification cache %s: bad entry %q", path, line)
+		}
+		c.entries[[32]byte(b)] = struct{}{}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// verificationCacheKey is H(H(massif data) || H(checkpoint))
+func verificationCacheKey(massifData, checkpoint []byte) [32]byte {
+	dh := sha256.Sum256(massifData)
+	ch := sha256.Sum256(checkpoint)
+	return sha256.Sum256(append(dh[:], ch[:]...))
+}
+
+// Verified returns true if the massif data has previously been verified
+// against the checkpoint.
+func (c *VerificationCache) Verified(massifData, checkpoint []byte) bool {
+	key := verificationCacheKey(massifData, checkpoint)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.entries[key]
+	return ok
+}
+
+// Record notes a successful verification of the massif data against the
+// checkpoint.
+func (c *VerificationCache) Record(massifData, checkpoint []byte) {
+	key := verificationCacheKey(massifData, checkpoint)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = struct{}{}
+}
+
+// Len returns the number of recorded verifications
+func (c *VerificationCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Save persists the cache to the path it was opened from, replacing the file
+// atomically. It is a no-op for an in memory cache.
+func (c *VerificationCache) Save() error {
+	if c.path == "" {
+		return nil
+	}
+	c.mu.Lock()
+	lines := make([]string, 0, len(c.entries))
+	for key := range c.entries {
+		lines = append(lines, hex.EncodeToString(key[:]))
+	}
+	c.mu.Unlock()
+	// sorted for a stable file, which is friendlier to diff and backup tools
+	sort.Strings(lines)
+
+	f, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	w := bufio.NewWriter(f)
+	for _, line := range lines {
+		if _, err = w.WriteString(line + "\n"); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, c.path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
+}
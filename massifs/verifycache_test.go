@@ -0,0 +1,61 @@
+package massifs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerificationCache_SkipsCompletedMassifs(t *testing.T) {
+	ctx := context.Background()
+	store, verifier := buildSealedLog(t, 3, 10)
+	path := filepath.Join(t.TempDir(), "verified.cache")
+
+	cache, err := OpenVerificationCache(path)
+	require.NoError(t, err)
+
+	var first []*VerifiedContext
+	for i := range uint32(3) {
+		vc, err := GetContextVerified(ctx, store, verifier, i, WithVerificationCache(cache))
+		require.NoError(t, err)
+		first = append(first, vc)
+	}
+	// massifs 0 and 1 are complete, the head massif is never recorded
+	require.Equal(t, 2, cache.Len())
+	require.NoError(t, cache.Save())
+
+	cache, err = OpenVerificationCache(path)
+	require.NoError(t, err)
+	require.Equal(t, 2, cache.Len())
+
+	for i := range uint32(3) {
+		vc, err := GetContextVerified(ctx, store, verifier, i, WithVerificationCache(cache))
+		require.NoError(t, err)
+		require.Equal(t, first[i].Accumulator, vc.Accumulator)
+		require.Equal(t, first[i].ConsistentRoots, vc.ConsistentRoots)
+	}
+
+	// A hit still checks the signature, against the keys this caller trusts
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	other := newES256Verifier(t, &otherKey.PublicKey)
+	for i := range uint32(2) {
+		require.True(t, cache.Verified(store.massifs[i], store.checkpoint[i]))
+		_, err = GetContextVerified(ctx, store, other, i, WithVerificationCache(cache))
+		require.Error(t, err)
+		_, err = GetContextVerified(ctx, store, other, i,
+			WithVerificationCache(cache), WithTrustedKeys(TrustedKey{KID: []byte("other"), Verifier: other}))
+		require.Error(t, err)
+	}
+
+	// Different content is a miss.
+	tampered := append([]byte(nil), store.massifs[0]...)
+	tampered[len(tampered)-1] ^= 1
+	require.False(t, cache.Verified(tampered, store.checkpoint[0]))
+	require.True(t, cache.Verified(store.massifs[0], store.checkpoint[0]))
+}
@@ -0,0 +1,127 @@
+package massifs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/veraison/go-cose"
+)
+
+var (
+	ErrCursorLogMismatch = errors.New("the verification cursor is for a different log")
+	ErrCursorRollback    = errors.New("the log is sealed at a size before the verification cursor")
+)
+
+// VerificationCursor records how far a full verification of a log has got.
+// Callers persist it, CBOR encoded, between runs of ResumeVerification, so
+// that a scheduled audit of a very large log only reads the massifs sealed
+// since the previous run. The zero cursor starts from the first massif.
+//
+// The cursor is trusted: the state it records is used as the base the rest
+// of the log must be consistent with, in the same way as
+// WithVerifyTrustedState. It should be kept where the log's builder can not
+// modify it.
+type VerificationCursor struct {
+	LogID storage.LogID `cbor:"1,keyasint,omitempty"`
+	// MassifIndex is the last massif verified
+	MassifIndex uint32 `cbor:"2,keyasint"`
+	// MMRSize is the sealed size verified, MMRSize-1 is the last mmr index
+	// covered. Zero if nothing has been verified.
+	MMRSize uint64 `cbor:"3,keyasint"`
+	// Peaks is the verified accumulator for MMRSize
+	Peaks [][]byte `cbor:"4,keyasint"`
+	// CheckpointSHA256 is the digest of the checkpoint object MMRSize was
+	// verified against
+	CheckpointSHA256 []byte `cbor:"5,keyasint"`
+}
+
+// State returns the verified state recorded by the cursor
+func (c *VerificationCursor) State() MMRState {
+	return MMRState{MMRSize: c.MMRSize, Peaks: c.Peaks}
+}
+
+// ResumeVerification continues the verification of the log from the cursor
+// up to its last checkpoint, and returns the cursor for the new position.
+// Each massif is verified against its checkpoint, and as consistent with the
+// state verified before it, starting with the state of the cursor. Massifs
+// before the cursor are not read. The massif of the cursor is only read
+// again if it has been sealed again since.
+//
+// On error the cursor for the last massif verified is returned with it, so
+// the work done is not lost. The opts are the VerifyOptions for every massif
+// verified. If they name a log, the cursor must be for the same log.
+func ResumeVerification(
+	ctx context.Context, reader ObjectReader, verifier cose.Verifier,
+	cursor VerificationCursor, opts ...Option,
+) (VerificationCursor, error) {
+	var verifyOpts VerifyOptions
+	if err := ApplyOptions(&verifyOpts, opts...); err != nil {
+		return cursor, err
+	}
+	if len(verifyOpts.LogID) > 0 {
+		if len(cursor.LogID) > 0 && !bytes.Equal(cursor.LogID, verifyOpts.LogID) {
+			return cursor, fmt.Errorf("%w: %x, verifying %x", ErrCursorLogMismatch, cursor.LogID, verifyOpts.LogID)
+		}
+		cursor.LogID = verifyOpts.LogID
+	}
+
+	head, err := reader.HeadIndex(ctx, storage.ObjectCheckpoint)
+	if err != nil {
+		return cursor, err
+	}
+	if head < cursor.MassifIndex {
+		return cursor, fmt.Errorf("%w: the last checkpoint is for massif %d, the cursor is at massif %d",
+			ErrCursorRollback, head, cursor.MassifIndex)
+	}
+
+	start := cursor.MassifIndex
+	if cursor.MMRSize > 0 {
+		// Note: we have to fetch the seal before the massif, otherwise we can
+		// lose a race with the builder
+		check, err := GetCheckpoint(ctx, reader, start)
+		if err != nil {
+			return cursor, err
+		}
+		sum := sha256.Sum256(check.Raw)
+		if bytes.Equal(sum[:], cursor.CheckpointSHA256) {
+			if start == head {
+				return cursor, nil
+			}
+			start++
+		}
+	}
+
+	for i := start; i <= head; i++ {
+		check, err := GetCheckpoint(ctx, reader, i)
+		if err != nil {
+			return cursor, err
+		}
+		if check.MMRSize < cursor.MMRSize {
+			return cursor, fmt.Errorf("%w: massif %d is sealed at size %d, the cursor is at %d",
+				ErrCursorRollback, i, check.MMRSize, cursor.MMRSize)
+		}
+
+		massifOpts := append(opts[:len(opts):len(opts)], WithVerifyCheckpoint(&check))
+		if cursor.MMRSize > 0 {
+			massifOpts = append(massifOpts, WithVerifyTrustedState(cursor.State()))
+		}
+		vc, err := GetContextVerified(ctx, reader, verifier, i, massifOpts...)
+		if err != nil {
+			return cursor, fmt.Errorf("massif %d: %w", i, err)
+		}
+
+		sum := sha256.Sum256(check.Raw)
+		cursor = VerificationCursor{
+			LogID:            cursor.LogID,
+			MassifIndex:      i,
+			MMRSize:          check.MMRSize,
+			Peaks:            vc.Accumulator,
+			CheckpointSHA256: sum[:],
+		}
+	}
+	return cursor, nil
+}
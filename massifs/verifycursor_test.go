@@ -0,0 +1,116 @@
+package massifs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/massifs/storage"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+// massifReadsReader records the massifs whose data is read
+type massifReadsReader struct {
+	*memStore
+	reads map[uint32]int
+}
+
+func (r *massifReadsReader) MassifData(massifIndex uint32) ([]byte, bool, error) {
+	r.reads[massifIndex]++
+	return r.memStore.MassifData(massifIndex)
+}
+
+func (r *massifReadsReader) MassifReadN(ctx context.Context, massifIndex uint32, n int) ([]byte, error) {
+	r.reads[massifIndex]++
+	return r.memStore.MassifReadN(ctx, massifIndex, n)
+}
+
+func TestResumeVerification(t *testing.T) {
+	ctx := context.Background()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := cose.NewSigner(cose.AlgorithmES256, key)
+	require.NoError(t, err)
+	verifier := newES256Verifier(t, &key.PublicKey)
+
+	store := newMemStore(nil, nil)
+	l, err := OpenLog(ctx, store, WithLogMassifHeight(3), WithLogSigner(signer), WithLogVerifier(verifier))
+	require.NoError(t, err)
+	appendSealed := func(first, n int) {
+		var entries []LogEntry
+		for i := first; i < first+n; i++ {
+			leaf := sha256.Sum256(fmt.Appendf(nil, "cursor-leaf-%d", i))
+			entries = append(entries, LogEntry{IDTimestamp: uint64(i + 1), Value: leaf[:]})
+		}
+		_, err := l.Append(ctx, entries...)
+		require.NoError(t, err)
+		_, err = l.Seal(ctx)
+		require.NoError(t, err)
+	}
+	reader := &massifReadsReader{memStore: store, reads: map[uint32]int{}}
+	logID := storage.LogID{15: 1}
+
+	// 4 leaves fill a massif of height 3, massif 1 is partially full
+	appendSealed(0, 6)
+	cursor, err := ResumeVerification(ctx, reader, verifier, VerificationCursor{LogID: logID})
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), cursor.MassifIndex)
+	require.Equal(t, store.checkpointSize(t, 1), cursor.MMRSize)
+	require.Equal(t, logID, cursor.LogID)
+
+	// the cursor round trips through its encoding
+	data, err := cbor.Marshal(cursor)
+	require.NoError(t, err)
+	var decoded VerificationCursor
+	require.NoError(t, cbor.Unmarshal(data, &decoded))
+	require.Equal(t, cursor, decoded)
+
+	// nothing has changed, so nothing is read
+	clear(reader.reads)
+	resumed, err := ResumeVerification(ctx, reader, verifier, decoded)
+	require.NoError(t, err)
+	require.Equal(t, cursor, resumed)
+	require.Empty(t, reader.reads)
+
+	// massif 1 is sealed again and massif 2 is started, massif 0 is not read
+	appendSealed(6, 4)
+	clear(reader.reads)
+	cursor, err = ResumeVerification(ctx, reader, verifier, decoded)
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), cursor.MassifIndex)
+	require.Equal(t, store.checkpointSize(t, 2), cursor.MMRSize)
+	require.Zero(t, reader.reads[0])
+	require.NotZero(t, reader.reads[1])
+	require.NotZero(t, reader.reads[2])
+
+	// a cursor which is not consistent with the log is refused
+	forged := cursor
+	forged.MassifIndex = 1
+	forged.CheckpointSHA256 = nil
+	forged.Peaks = [][]byte{make([]byte, 32)}
+	forged.MMRSize = 7
+	_, err = ResumeVerification(ctx, reader, verifier, forged)
+	require.Error(t, err)
+
+	_, err = ResumeVerification(ctx, reader, verifier, cursor, WithVerifySealSubject(storage.LogID{15: 2}))
+	require.ErrorIs(t, err, ErrCursorLogMismatch)
+
+	ahead := cursor
+	ahead.MassifIndex = 3
+	_, err = ResumeVerification(ctx, reader, verifier, ahead)
+	require.ErrorIs(t, err, ErrCursorRollback)
+}
+
+// checkpointSize returns the size sealed by the checkpoint of the massif
+func (s *memStore) checkpointSize(t *testing.T, massifIndex uint32) uint64 {
+	t.Helper()
+	check, err := NewCheckpoint(s.checkpoint[massifIndex])
+	require.NoError(t, err)
+	return check.MMRSize
+}
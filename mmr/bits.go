@@ -16,6 +16,7 @@ func Log2Uint32(num uint32) uint32 {
 	return uint32(bits.Len32(num) - 1)
 }
 
+// AllOnes returns true if num is of the form 2^k - 1, including zero
 func AllOnes(num uint64) bool {
-	return (1<<bits.OnesCount64(num) - 1) == num
+	return num&(num+1) == 0
 }
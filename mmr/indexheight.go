@@ -45,8 +45,17 @@ func JumpLeftPerfect(pos uint64) uint64 {
 // is the basis for the entire MMR implementation. See the extended remarks in
 // doc.go for exposition on why & how it works.
 func IndexHeight(i uint64) uint64 {
-	// convert from zero based index to 1 based position, else the encoding doesn't work out
-	return PosHeight(i + 1)
+	// This is the constant time equivalent of iterating JumpLeftPerfect. The
+	// largest valid mmr of at most i + 1 nodes either ends exactly at i, in
+	// which case i is the root of its lowest peak, or it is followed by the
+	// next leaf and then that leaf's ancestors in order of height. In that
+	// case the height of i is its offset from the end of the mmr.
+	leafCount := PeaksBitmap(i + 1)
+	size := 2*leafCount - uint64(bits.OnesCount64(leafCount))
+	if size == i+1 {
+		return uint64(bits.TrailingZeros64(leafCount))
+	}
+	return i - size
 }
 
 // MaxPeakHeight obtains the hight index of the highest (and left most peak)
@@ -86,10 +95,7 @@ func HeightIndexLeafCount(heightIndex uint64) uint64 {
 
 // PosHeight is used when position is a 1 based count
 func PosHeight(pos uint64) uint64 {
-	for !AllOnes(pos) {
-		pos = JumpLeftPerfect(pos)
-	}
-	return BitLength64(pos) - 1
+	return IndexHeight(pos - 1)
 }
 
 // JumpRightSibling moves from pos to the next sibling at the same height
@@ -0,0 +1,154 @@
+package mmr
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// The reference implementations below are the straight forward iterative
+// forms of the index math. The optimized implementations must agree with them
+// exactly, including for incomplete mmr sizes.
+
+func posHeightReference(pos uint64) uint64 {
+	for !AllOnes(pos) {
+		pos = JumpLeftPerfect(pos)
+	}
+	return BitLength64(pos) - 1
+}
+
+func peaksReference(mmrIndex uint64) []uint64 {
+	mmrSize := mmrIndex + 1
+	if posHeightReference(mmrSize+1) > posHeightReference(mmrSize) {
+		return nil
+	}
+	peak := uint64(0)
+	var peaks []uint64
+	for mmrSize != 0 {
+		peakSize := TopPeak(mmrSize-1) + 1
+		peak = peak + peakSize
+		peaks = append(peaks, peak-1)
+		mmrSize -= peakSize
+	}
+	return peaks
+}
+
+func leafMinusSpurSumReference(leafIndex uint64) uint64 {
+	sum := leafIndex
+	leafIndex >>= 1
+	for ; leafIndex > 0; leafIndex >>= 1 {
+		sum -= leafIndex
+	}
+	return sum
+}
+
+func mmrIndexReference(leafIndex uint64) uint64 {
+	sum := uint64(0)
+	for leafIndex > 0 {
+		h := BitLength(leafIndex)
+		sum += (1 << h) - 1
+		leafIndex -= uint64(1) << (h - 1)
+	}
+	return sum
+}
+
+// indexMathSamples returns every value below 1<<16 and a spread of random
+// values up to the largest sizes PeaksBitmap computes directly.
+func indexMathSamples() []uint64 {
+	var samples []uint64
+	for i := uint64(0); i < 1<<16; i++ {
+		samples = append(samples, i)
+	}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1<<16; i++ {
+		samples = append(samples, r.Uint64()>>(1+r.Intn(63)))
+	}
+	return samples
+}
+
+func TestIndexMathMatchesReference(t *testing.T) {
+	for _, v := range indexMathSamples() {
+		if got, want := PeaksBitmap(v), peaksBitmapScan(v); got != want {
+			t.Fatalf("PeaksBitmap(%d) = %b, want %b", v, got, want)
+		}
+		if got, want := IndexHeight(v), posHeightReference(v+1); got != want {
+			t.Fatalf("IndexHeight(%d) = %d, want %d", v, got, want)
+		}
+		if got, want := LeafMinusSpurSum(v), leafMinusSpurSumReference(v); got != want {
+			t.Fatalf("LeafMinusSpurSum(%d) = %d, want %d", v, got, want)
+		}
+		if got, want := MMRIndex(v), mmrIndexReference(v); got != want {
+			t.Fatalf("MMRIndex(%d) = %d, want %d", v, got, want)
+		}
+		if got, want := Peaks(v), peaksReference(v); !slices.Equal(got, want) {
+			t.Fatalf("Peaks(%d) = %v, want %v", v, got, want)
+		}
+	}
+}
+
+func TestPeaksBitmapLargeSizes(t *testing.T) {
+	for _, v := range []uint64{
+		maxFastPeaksBitmapSize - 1, maxFastPeaksBitmapSize, maxFastPeaksBitmapSize + 1,
+		1<<64 - 2, 1<<64 - 1,
+	} {
+		if got, want := PeaksBitmap(v), peaksBitmapScan(v); got != want {
+			t.Fatalf("PeaksBitmap(%d) = %b, want %b", v, got, want)
+		}
+	}
+}
+
+var benchSink uint64
+
+// benchIndexes spans a realistic range of mmr indices, from the first massif
+// to logs with hundreds of millions of entries.
+var benchIndexes = func() []uint64 {
+	r := rand.New(rand.NewSource(1))
+	indexes := make([]uint64, 1024)
+	for i := range indexes {
+		indexes[i] = r.Uint64() >> (34 + r.Intn(20))
+	}
+	return indexes
+}()
+
+func BenchmarkIndexHeight(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		benchSink += IndexHeight(benchIndexes[i&1023])
+	}
+}
+
+func BenchmarkIndexHeightReference(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		benchSink += posHeightReference(benchIndexes[i&1023] + 1)
+	}
+}
+
+func BenchmarkLeafCount(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		benchSink += LeafCount(benchIndexes[i&1023] + 1)
+	}
+}
+
+func BenchmarkLeafCountReference(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		benchSink += peaksBitmapScan(benchIndexes[i&1023] + 1)
+	}
+}
+
+func BenchmarkMMRIndex(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		benchSink += MMRIndex(benchIndexes[i&1023])
+	}
+}
+
+func BenchmarkPeaks(b *testing.B) {
+	// Peaks needs complete mmrs, so use the mmr size for each sample leaf count
+	for i := 0; i < b.N; i++ {
+		benchSink += uint64(len(Peaks(MMRIndex(benchIndexes[i&1023]) - 1)))
+	}
+}
+
+func BenchmarkPeaksReference(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		benchSink += uint64(len(peaksReference(MMRIndex(benchIndexes[i&1023]) - 1)))
+	}
+}
@@ -1,7 +1,5 @@
 package mmr
 
-import "math/bits"
-
 // MMRIndex returns the node index for the leaf e
 //
 // Args:
@@ -11,13 +9,8 @@ import "math/bits"
 //
 //	The mmr index for the element leafIndex
 func MMRIndex(leafIndex uint64) uint64 {
-
-	sum := uint64(0)
-	for leafIndex > 0 {
-		h := bits.Len64(leafIndex)
-		sum += (1 << h) - 1
-		half := 1 << (h - 1)
-		leafIndex -= uint64(half)
-	}
-	return sum
+	// Each set bit, at height h, in the leaf index contributes a perfect tree of
+	// (1 << (h+1)) - 1 nodes preceding the leaf. Summed over the set bits that
+	// is 2 * leafIndex - popcount(leafIndex)
+	return leafCountSize(leafIndex)
 }
@@ -0,0 +1,280 @@
+// Package mmrtest implements conformance tests for the mmr index math, and
+// for node stores used with it. Alternative store implementations, and
+// refactors of the arithmetic everything else depends on, should pass them.
+//
+//	func TestMyStore(t *testing.T) {
+//		mmrtest.TestIndexMath(t)
+//		mmrtest.TestNodeStore(t, func() mmr.NodeAppender { return newMyStore() })
+//	}
+package mmrtest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/bits"
+	"math/rand"
+	"testing"
+
+	"github.com/forestrie/go-merklelog/mmr"
+)
+
+// MaxStoreLeaves is the number of leaves TestNodeStore adds
+const MaxStoreLeaves = 67
+
+// Samples returns the mmr indices, leaf indices and sizes the index math is
+// checked at: every value below 1<<14, the values either side of each power
+// of two, and a deterministic spread of random values.
+func Samples() []uint64 {
+	var samples []uint64
+	for i := range uint64(1 << 14) {
+		samples = append(samples, i)
+	}
+	for b := 14; b < 62; b++ {
+		samples = append(samples, uint64(1)<<b-1, uint64(1)<<b, uint64(1)<<b+1)
+	}
+	r := rand.New(rand.NewSource(1))
+	for range 1 << 14 {
+		samples = append(samples, r.Uint64()>>(2+r.Intn(62)))
+	}
+	return samples
+}
+
+// TestIndexMath checks the invariants relating the index math functions to
+// each other, at each of Samples.
+func TestIndexMath(t *testing.T) {
+	t.Helper()
+	samples := Samples()
+	t.Run("IndexHeight", func(t *testing.T) {
+		for _, i := range samples {
+			checkIndexHeight(t, i)
+		}
+	})
+	t.Run("LeafCount", func(t *testing.T) {
+		for _, v := range samples {
+			checkLeafCount(t, v)
+		}
+	})
+	t.Run("Peaks", func(t *testing.T) {
+		for _, v := range samples {
+			checkPeaks(t, v)
+		}
+	})
+	t.Run("Spurs", func(t *testing.T) {
+		for _, v := range samples {
+			checkSpurs(t, v)
+		}
+	})
+}
+
+// checkIndexHeight checks IndexHeight is PosHeight of the position, and
+// agrees with the alternative forms.
+func checkIndexHeight(t *testing.T, i uint64) {
+	t.Helper()
+	h := mmr.IndexHeight(i)
+	if got := mmr.PosHeight(i + 1); got != h {
+		t.Fatalf("PosHeight(%d) = %d, IndexHeight(%d) = %d", i+1, got, i, h)
+	}
+	if i < 1<<20 {
+		if got := mmr.IndexHeight2(i); got != h {
+			t.Fatalf("IndexHeight2(%d) = %d, IndexHeight = %d", i, got, h)
+		}
+	}
+	// a node is the parent of the two nodes preceding it exactly when its
+	// height is greater than that of its predecessor
+	if h > 0 {
+		left := i - mmr.SiblingOffset(h-1) - 1
+		if got := mmr.IndexHeight(left); got != h-1 {
+			t.Fatalf("left child %d of %d has height %d, want %d", left, i, got, h-1)
+		}
+		if got := mmr.IndexHeight(i - 1); got != h-1 {
+			t.Fatalf("right child %d of %d has height %d, want %d", i-1, i, got, h-1)
+		}
+	}
+}
+
+// checkLeafCount checks that MMRIndex and LeafCount round trip, and that
+// LeafIndex recovers the leaf index from the mmr index of a leaf.
+func checkLeafCount(t *testing.T, leafIndex uint64) {
+	t.Helper()
+	if leafIndex >= 1<<62 {
+		return
+	}
+	i := mmr.MMRIndex(leafIndex)
+	// the mmr index of a leaf is the size of the mmr preceding it
+	if got := mmr.LeafCount(i); got != leafIndex {
+		t.Fatalf("LeafCount(MMRIndex(%d)) = %d", leafIndex, got)
+	}
+	if got := mmr.IndexHeight(i); got != 0 {
+		t.Fatalf("leaf %d at mmr index %d has height %d", leafIndex, i, got)
+	}
+	if got := mmr.LeafIndex(i); got != leafIndex {
+		t.Fatalf("LeafIndex(MMRIndex(%d)) = %d", leafIndex, got)
+	}
+	size := mmr.FirstMMRSize(i)
+	if got := mmr.LeafCount(size); got != leafIndex+1 {
+		t.Fatalf("LeafCount(FirstMMRSize(%d)) = %d, want %d", i, got, leafIndex+1)
+	}
+	if got := mmr.MMRIndex(leafIndex + 1); got != size {
+		t.Fatalf("MMRIndex(%d) = %d, FirstMMRSize(%d) = %d", leafIndex+1, got, i, size)
+	}
+}
+
+// checkPeaks checks that the bits of PeaksBitmap are the heights of Peaks,
+// for complete mmr sizes, and that Peaks rejects incomplete sizes.
+func checkPeaks(t *testing.T, mmrSize uint64) {
+	t.Helper()
+	if mmrSize == 0 {
+		return
+	}
+	bitmap := mmr.PeaksBitmap(mmrSize)
+	if bitmap != mmr.LeafCount(mmrSize) {
+		t.Fatalf("PeaksBitmap(%d) = %d, LeafCount = %d", mmrSize, bitmap, mmr.LeafCount(mmrSize))
+	}
+	peaks := mmr.Peaks(mmrSize - 1)
+	if mmr.MMRIndex(bitmap) != mmrSize {
+		if peaks != nil {
+			t.Fatalf("Peaks(%d) = %v for incomplete mmr size %d", mmrSize-1, peaks, mmrSize)
+		}
+		return
+	}
+	if len(peaks) != bits.OnesCount64(bitmap) {
+		t.Fatalf("Peaks(%d) has %d peaks, PeaksBitmap is %b", mmrSize-1, len(peaks), bitmap)
+	}
+	remaining := bitmap
+	for j, p := range peaks {
+		want := uint64(bits.Len64(remaining) - 1)
+		if got := mmr.IndexHeight(p); got != want {
+			t.Fatalf("peak %d of MMR(%d) at %d has height %d, PeaksBitmap is %b", j, mmrSize, p, got, bitmap)
+		}
+		// PeakIndex is given the proof length of a leaf, which is the height
+		// of the peak committing it
+		if got := mmr.PeakIndex(bitmap, int(want)); got != j {
+			t.Fatalf("PeakIndex(%b, %d) = %d, want %d", bitmap, want, got, j)
+		}
+		remaining &^= 1 << want
+	}
+	if peaks[len(peaks)-1] != mmrSize-1 {
+		t.Fatalf("the last peak of MMR(%d) is %d", mmrSize, peaks[len(peaks)-1])
+	}
+}
+
+// checkSpurs checks the spur arithmetic against MMRIndex
+func checkSpurs(t *testing.T, leafIndex uint64) {
+	t.Helper()
+	if leafIndex >= 1<<62 {
+		return
+	}
+	i := mmr.MMRIndex(leafIndex)
+	if got := 2*leafIndex - mmr.LeafMinusSpurSum(leafIndex); got != i {
+		t.Fatalf("2 * %d - LeafMinusSpurSum = %d, MMRIndex = %d", leafIndex, got, i)
+	}
+	// the spur of a leaf is the interior nodes added after it
+	if got := mmr.MMRIndex(leafIndex+1) - i - 1; got != mmr.SpurHeightLeaf(leafIndex) {
+		t.Fatalf("leaf %d is followed by %d interior nodes, SpurHeightLeaf = %d",
+			leafIndex, got, mmr.SpurHeightLeaf(leafIndex))
+	}
+	if leafIndex < 1<<20 {
+		if got := mmr.TreeIndexOld(leafIndex); got != i {
+			t.Fatalf("TreeIndexOld(%d) = %d, MMRIndex = %d", leafIndex, got, i)
+		}
+	}
+	// the perfect tree of height h is the mmr preceding leaf 1 << (h-1), the
+	// spur sum and the last spur account for all of its nodes
+	if h := uint64(bits.Len64(leafIndex)); h > 0 && leafIndex == uint64(1)<<(h-1) {
+		if got := mmr.SpurSumHeight(h) + h; got != i || got != mmr.HeightSize(h) {
+			t.Fatalf("SpurSumHeight(%d) + %d = %d, MMRIndex(%d) = %d", h, h, got, leafIndex, i)
+		}
+	}
+}
+
+// TestNodeStore adds MaxStoreLeaves leaves, one at a time, to a store from
+// newStore, checking after each that the store holds the same nodes as a
+// reference store, that its peaks are those Peaks identifies, and that the
+// inclusion proof of every node reaches the peak committing it.
+func TestNodeStore(t *testing.T, newStore func() mmr.NodeAppender) {
+	t.Helper()
+	store := newStore()
+	reference := &referenceStore{}
+	for leafIndex := range uint64(MaxStoreLeaves) {
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], leafIndex)
+		leaf := sha256.Sum256(b[:])
+
+		size, err := mmr.AddHashedLeaf(store, sha256.New(), leaf[:])
+		if err != nil {
+			t.Fatalf("AddHashedLeaf(%d): %v", leafIndex, err)
+		}
+		want, _ := mmr.AddHashedLeaf(reference, sha256.New(), leaf[:])
+		if size != want || size != mmr.MMRIndex(leafIndex+1) {
+			t.Fatalf("AddHashedLeaf(%d) returned size %d, want %d", leafIndex, size, want)
+		}
+		for i := range size {
+			got, err := store.Get(i)
+			if err != nil {
+				t.Fatalf("Get(%d) in MMR(%d): %v", i, size, err)
+			}
+			if !bytes.Equal(got, reference.nodes[i]) {
+				t.Fatalf("Get(%d) in MMR(%d) = %x, want %x", i, size, got, reference.nodes[i])
+			}
+		}
+		checkStoreProofs(t, store, size)
+	}
+}
+
+func checkStoreProofs(t *testing.T, store mmr.NodeAppender, mmrSize uint64) {
+	t.Helper()
+	peaks, err := mmr.PeakHashes(store, mmrSize-1)
+	if err != nil {
+		t.Fatalf("PeakHashes(%d): %v", mmrSize-1, err)
+	}
+	positions := mmr.Peaks(mmrSize - 1)
+	if len(peaks) != len(positions) {
+		t.Fatalf("PeakHashes(%d) has %d peaks, Peaks has %d", mmrSize-1, len(peaks), len(positions))
+	}
+	for j, p := range positions {
+		value, _ := store.Get(p)
+		if !bytes.Equal(value, peaks[j]) {
+			t.Fatalf("peak %d of MMR(%d) is not the node at %d", j, mmrSize, p)
+		}
+	}
+	for i := range mmrSize {
+		proof, err := mmr.InclusionProof(store, mmrSize-1, i)
+		if err != nil {
+			t.Fatalf("InclusionProof(%d, %d): %v", mmrSize-1, i, err)
+		}
+		value, _ := store.Get(i)
+		// the peak committing a node is the first at or after it
+		j := 0
+		for positions[j] < i {
+			j++
+		}
+		if root := mmr.IncludedRoot(sha256.New(), i, value, proof); !bytes.Equal(root, peaks[j]) {
+			t.Fatalf("the inclusion proof of %d in MMR(%d) does not reach peak %d", i, mmrSize, j)
+		}
+		if mmr.IndexHeight(i) != 0 {
+			continue
+		}
+		ok, err := mmr.VerifyInclusion(store, sha256.New(), mmrSize, value, i, proof)
+		if !ok || err != nil {
+			t.Fatalf("VerifyInclusion of %d in MMR(%d): %v", i, mmrSize, err)
+		}
+	}
+}
+
+// referenceStore is the simplest possible node store
+type referenceStore struct {
+	nodes [][]byte
+}
+
+func (s *referenceStore) Get(i uint64) ([]byte, error) {
+	if i >= uint64(len(s.nodes)) {
+		return nil, mmr.ErrNotFound
+	}
+	return s.nodes[i], nil
+}
+
+func (s *referenceStore) Append(value []byte) (uint64, error) {
+	s.nodes = append(s.nodes, append([]byte(nil), value...))
+	return uint64(len(s.nodes)), nil
+}
@@ -0,0 +1,12 @@
+package mmrtest
+
+import (
+	"testing"
+
+	"github.com/forestrie/go-merklelog/mmr"
+)
+
+func TestConformance(t *testing.T) {
+	TestIndexMath(t)
+	TestNodeStore(t, func() mmr.NodeAppender { return &referenceStore{} })
+}
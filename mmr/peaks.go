@@ -1,6 +1,7 @@
 package mmr
 
 import (
+	"math"
 	"math/bits"
 )
 
@@ -27,27 +28,24 @@ func Peaks(mmrIndex uint64) []uint64 {
 
 	mmrSize := mmrIndex + 1
 
-	// catch invalid range, where siblings exist but no parent exists
-	if PosHeight(mmrSize+1) > PosHeight(mmrSize) {
+	// Each set bit in the leaf count is a peak, and the bit position is its
+	// height. Any size which doesn't round trip is not a complete mmr.
+	leafCount := PeaksBitmap(mmrSize)
+	if leafCount == 0 || leafCountSize(leafCount) != mmrSize {
 		return nil
 	}
 
 	peak := uint64(0)
-	var peaks []uint64
+	peaks := make([]uint64, 0, bits.OnesCount64(leafCount))
 	// The top peak is always the left most and, when counting from 1, will have all binary '1's
-	for mmrSize != 0 {
-		// This next step computes the ^2 floor of the bits in mmrSize, which
-		// picks out the highest peak (and also left most) remaining peak in
-		// mmrSize (See TopPeak)
-		peakSize := TopPeak(mmrSize-1) + 1 // + 1 to recover position form
-
-		// Because we *subtract* the computed peak size from mmrSize, we need to
-		// recover the actual peak position. The arithmetic all works out so we
-		// just accumulate the peakSizes as we go, and the result is always the
-		// peak value against the original mmrSize we were given.
-		peak = peak + peakSize
+	for leafCount != 0 {
+		height := bits.Len64(leafCount) - 1
+
+		// Accumulating the peak sizes, highest first, gives the position of
+		// each peak against the original mmrSize.
+		peak += (2 << height) - 1
 		peaks = append(peaks, peak-1)
-		mmrSize -= peakSize
+		leafCount &^= 1 << height
 	}
 	return peaks
 }
@@ -66,6 +64,13 @@ func PosPeaks(mmrSize uint64) []uint64 {
 }
 
 func PeakHashes(store indexStoreGetter, mmrIndex uint64) ([][]byte, error) {
+	memo, _ := store.(peakHashesMemo)
+	if memo != nil {
+		if peaks, ok := memo.PeakHashesMemo(mmrIndex); ok {
+			return clonePeakHashes(peaks), nil
+		}
+	}
+
 	// Note: we can implement this directly any time we want, but lets re-use the testing for Peaks
 	var path [][]byte
 	for _, i := range Peaks(mmrIndex) {
@@ -80,9 +85,21 @@ func PeakHashes(store indexStoreGetter, mmrIndex uint64) ([][]byte, error) {
 		// Note: we create a copy here to ensure the value is not modified under the callers feet
 		path = append(path, value)
 	}
+	if memo != nil {
+		memo.MemoizePeakHashes(mmrIndex, clonePeakHashes(path))
+	}
 	return path, nil
 }
 
+// clonePeakHashes returns a deep copy of the peak hashes
+func clonePeakHashes(peaks [][]byte) [][]byte {
+	clone := make([][]byte, len(peaks))
+	for i, peak := range peaks {
+		clone[i] = append([]byte(nil), peak...)
+	}
+	return clone
+}
+
 // PeakIndex returns the index of the peak accumulator for the peak with the provided proof length.
 //
 // Given:
@@ -204,11 +221,43 @@ func TopHeight(i uint64) uint64 {
 // If the provided mmr size is invalid, the returned map will be for the largest
 // valid mmr size < the provided invalid size.
 func PeaksBitmap(mmrSize uint64) uint64 {
+	if mmrSize > maxFastPeaksBitmapSize {
+		return peaksBitmapScan(mmrSize)
+	}
+
+	// An mmr with n leaves has 2n - popcount(n) nodes, and that is strictly
+	// increasing in n. So the result is the largest n whose mmr size is <=
+	// mmrSize. Starting from mmrSize / 2, two rounds of n = (mmrSize +
+	// popcount(n)) / 2 land within a few leaves of it, and the final
+	// adjustments are bounded by a small constant.
+	n := mmrSize >> 1
+	n = (mmrSize + uint64(bits.OnesCount64(n))) >> 1
+	n = (mmrSize + uint64(bits.OnesCount64(n))) >> 1
+	for leafCountSize(n) > mmrSize {
+		n--
+	}
+	for leafCountSize(n+1) <= mmrSize {
+		n++
+	}
+	return n
+}
+
+// maxFastPeaksBitmapSize guards against overflow in leafCountSize. Sizes above
+// this can't occur in practice but are still handled, by peaksBitmapScan.
+const maxFastPeaksBitmapSize = math.MaxUint64 >> 1
+
+// leafCountSize returns the size of the mmr with exactly leafCount leaves
+func leafCountSize(leafCount uint64) uint64 {
+	return 2*leafCount - uint64(bits.OnesCount64(leafCount))
+}
+
+// peaksBitmapScan computes PeaksBitmap by trying each possible peak, from the
+// highest, in turn.
+func peaksBitmapScan(mmrSize uint64) uint64 {
 	if mmrSize == 0 {
 		return 0
 	}
 	pos := mmrSize
-	// peakSize := uint64(math.MaxUint64) >> bits.LeadingZeros64(mmrSize)
 	peakSize := (uint64(1) << bits.Len64(mmrSize)) - 1
 	peakMap := uint64(0)
 	for peakSize > 0 {
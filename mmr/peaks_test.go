@@ -1,11 +1,14 @@
 package mmr
 
 import (
+	"context"
+	"crypto/sha256"
 	"fmt"
 	"reflect"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestPosPeaks(t *testing.T) {
@@ -303,3 +306,62 @@ func TestPeaksBitmap(t *testing.T) {
 		})
 	}
 }
+
+// memoStore is a store with a peak hashes memo, counting its reads
+type memoStore struct {
+	*testDb
+	memo  map[uint64][][]byte
+	reads int
+}
+
+func (s *memoStore) Get(i uint64) ([]byte, error) {
+	s.reads++
+	return s.testDb.Get(i)
+}
+
+func (s *memoStore) PeakHashesMemo(mmrIndex uint64) ([][]byte, bool) {
+	peaks, ok := s.memo[mmrIndex]
+	return peaks, ok
+}
+
+func (s *memoStore) MemoizePeakHashes(mmrIndex uint64, peaks [][]byte) {
+	s.memo[mmrIndex] = peaks
+}
+
+func TestPeakHashesMemo(t *testing.T) {
+	db := NewGeneratedTestDB(t, 63)
+	store := &memoStore{testDb: db, memo: map[uint64][][]byte{}}
+
+	for _, mmrSize := range []uint64{1, 3, 4, 11, 26, 63} {
+		want, err := PeakHashes(db, mmrSize-1)
+		require.NoError(t, err)
+		got, err := PeakHashes(store, mmrSize-1)
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+
+		// the second time the memo is used, and what it returns is a copy
+		reads := store.reads
+		got[0][0] ^= 1
+		got, err = PeakHashes(store, mmrSize-1)
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+		require.Equal(t, reads, store.reads)
+
+		// the root of a store with a memo is bagged from the memoized peaks
+		wantRoot, err := GetRoot(mmrSize, db, sha256.New())
+		require.NoError(t, err)
+		gotRoot, err := GetRoot(mmrSize, store, sha256.New())
+		require.NoError(t, err)
+		require.Equal(t, wantRoot, gotRoot)
+		require.Equal(t, reads, store.reads)
+
+		// the memo is reached through the context aware variants too
+		got, err = PeakHashesCtx(context.Background(), store, mmrSize-1)
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+		gotRoot, err = GetRootCtx(context.Background(), mmrSize, db, sha256.New())
+		require.NoError(t, err)
+		require.Equal(t, wantRoot, gotRoot)
+		require.Equal(t, reads, store.reads)
+	}
+}
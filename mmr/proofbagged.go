@@ -12,6 +12,14 @@ import (
 // The root is defined as the 'bagging' of all peaks, starting with the highest.
 // So its simply a call to BagPeaksRHS for _all_ peaks in the MMR of the provided size.
 func GetRoot(mmrSize uint64, store indexStoreGetter, hasher hash.Hash) ([]byte, error) {
+	// A store with a memo likely has the peak hashes already
+	if _, ok := store.(peakHashesMemo); ok {
+		peakHashes, err := PeakHashes(store, mmrSize-1)
+		if err != nil {
+			return nil, err
+		}
+		return HashPeaksRHS(hasher, peakHashes), nil
+	}
 	peaks := PosPeaks(mmrSize)
 	// The root is ALL the peaks. Note that bagging essentially accumulates them in a binary tree.
 	return BagPeaksRHS(store, hasher, 0, peaks)
@@ -0,0 +1,94 @@
+package mmr
+
+import (
+	"context"
+	"sync"
+)
+
+// ProofBatch returns the inclusion proofs, in mmrLastIndex, of each of the
+// indices, in the order given. Proof generation is shared across parallelism
+// workers, one if parallelism is less than one.
+//
+// The nodes read from the store are cached for the batch, proofs for nearby
+// indices share most of their upper path, so each is read once. The store
+// must be safe for concurrent use when parallelism is more than one.
+//
+// The first error stops the batch and is returned, as is ctx.Err() if the
+// context is done before the batch completes.
+func ProofBatch(
+	ctx context.Context, store indexStoreGetter, mmrLastIndex uint64, indices []uint64, parallelism int,
+) ([][][]byte, error) {
+	parallelism = max(1, min(parallelism, len(indices)))
+	proofs := make([][][]byte, len(indices))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cache := &batchNodeCache{store: ctxStore{ctx: ctx, store: store}, nodes: map[uint64][]byte{}}
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	work := make(chan int)
+	for range parallelism {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				proof, err := InclusionProof(cache, mmrLastIndex, indices[i])
+				if err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					continue
+				}
+				proofs[i] = proof
+			}
+		}()
+	}
+
+feed:
+	for i := range indices {
+		select {
+		case work <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return proofs, nil
+}
+
+// batchNodeCache is a concurrency safe read through cache of store
+type batchNodeCache struct {
+	store indexStoreGetter
+	mu    sync.RWMutex
+	nodes map[uint64][]byte
+}
+
+func (c *batchNodeCache) Get(i uint64) ([]byte, error) {
+	c.mu.RLock()
+	value, ok := c.nodes[i]
+	c.mu.RUnlock()
+	if ok {
+		return value, nil
+	}
+	value, err := c.store.Get(i)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.nodes[i] = value
+	c.mu.Unlock()
+	return value, nil
+}
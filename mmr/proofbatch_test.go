@@ -0,0 +1,36 @@
+package mmr
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProofBatch(t *testing.T) {
+	db := NewGeneratedTestDB(t, 63)
+	mmrLastIndex := uint64(62)
+
+	var indices []uint64
+	for i := int(mmrLastIndex); i >= 0; i -= 3 {
+		indices = append(indices, uint64(i))
+	}
+	for _, parallelism := range []int{0, 1, 4, 100} {
+		proofs, err := ProofBatch(context.Background(), db, mmrLastIndex, indices, parallelism)
+		require.NoError(t, err)
+		require.Len(t, proofs, len(indices))
+		for i, mmrIndex := range indices {
+			want, err := InclusionProof(db, mmrLastIndex, mmrIndex)
+			require.NoError(t, err)
+			require.Equal(t, want, proofs[i], "mmr index %d", mmrIndex)
+		}
+	}
+
+	_, err := ProofBatch(context.Background(), db, mmrLastIndex, []uint64{1, 63, 2}, 2)
+	require.Error(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = ProofBatch(ctx, db, mmrLastIndex, indices, 2)
+	require.ErrorIs(t, err, context.Canceled)
+}
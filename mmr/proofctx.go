@@ -0,0 +1,52 @@
+package mmr
+
+import (
+	"context"
+	"hash"
+)
+
+// The Ctx variants read the store through the context: they return the
+// context's error once it is done, and read with GetCtx where the store
+// implements it, so proofs over remote-backed stores can be cancelled and
+// time-bounded. Otherwise they are exactly the functions they wrap.
+
+// PeakHashesCtx is PeakHashes, honouring ctx
+func PeakHashesCtx(ctx context.Context, store indexStoreGetter, mmrIndex uint64) ([][]byte, error) {
+	return PeakHashes(ctxStore{ctx: ctx, store: store}, mmrIndex)
+}
+
+// InclusionProofCtx is InclusionProof, honouring ctx
+func InclusionProofCtx(ctx context.Context, store indexStoreGetter, mmrLastIndex uint64, i uint64) ([][]byte, error) {
+	return InclusionProof(ctxStore{ctx: ctx, store: store}, mmrLastIndex, i)
+}
+
+// InclusionProofRangeCtx is InclusionProofRange, honouring ctx
+func InclusionProofRangeCtx(
+	ctx context.Context, store indexStoreGetter, mmrSize uint64, firstLeaf, lastLeaf uint64,
+) ([][]byte, error) {
+	return InclusionProofRange(ctxStore{ctx: ctx, store: store}, mmrSize, firstLeaf, lastLeaf)
+}
+
+// IndexConsistencyProofCtx is IndexConsistencyProof, honouring ctx
+func IndexConsistencyProofCtx(
+	ctx context.Context, store indexStoreGetter, mmrIndexA, mmrIndexB uint64,
+) (ConsistencyProof, error) {
+	return IndexConsistencyProof(ctxStore{ctx: ctx, store: store}, mmrIndexA, mmrIndexB)
+}
+
+// ProveConsistencyCtx is ProveConsistency, honouring ctx
+func ProveConsistencyCtx(ctx context.Context, store indexStoreGetter, mmrSizeA, mmrSizeB uint64) (ConsistencyProof, error) {
+	return ProveConsistency(ctxStore{ctx: ctx, store: store}, mmrSizeA, mmrSizeB)
+}
+
+// GetRootCtx is GetRoot, honouring ctx
+func GetRootCtx(ctx context.Context, mmrSize uint64, store indexStoreGetter, hasher hash.Hash) ([]byte, error) {
+	return GetRoot(mmrSize, ctxStore{ctx: ctx, store: store}, hasher)
+}
+
+// InclusionProofBaggedCtx is InclusionProofBagged, honouring ctx
+func InclusionProofBaggedCtx(
+	ctx context.Context, mmrSize uint64, store indexStoreGetter, hasher hash.Hash, i uint64,
+) ([][]byte, error) {
+	return InclusionProofBagged(mmrSize, ctxStore{ctx: ctx, store: store}, hasher, i)
+}
@@ -0,0 +1,95 @@
+package mmr
+
+import (
+	"context"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// cancellingStore cancels its context after a number of reads, and records
+// whether the reads were made with GetCtx
+type cancellingStore struct {
+	*testDb
+	cancel     context.CancelFunc
+	readsLeft  int
+	ctxReads   int
+	plainReads int
+}
+
+func (s *cancellingStore) read() {
+	s.readsLeft--
+	if s.readsLeft == 0 {
+		s.cancel()
+	}
+}
+
+func (s *cancellingStore) Get(i uint64) ([]byte, error) {
+	s.plainReads++
+	s.read()
+	return s.testDb.Get(i)
+}
+
+func (s *cancellingStore) GetCtx(ctx context.Context, i uint64) ([]byte, error) {
+	s.ctxReads++
+	s.read()
+	return s.testDb.Get(i)
+}
+
+func TestProofCtx(t *testing.T) {
+	db := NewGeneratedTestDB(t, 63)
+	hasher := sha256.New()
+
+	// with a live context the results are those of the plain functions
+	ctx := context.Background()
+	store := &cancellingStore{testDb: db, cancel: func() {}, readsLeft: -1}
+	proof, err := InclusionProofCtx(ctx, store, 62, 15)
+	require.NoError(t, err)
+	want, err := InclusionProof(db, 62, 15)
+	require.NoError(t, err)
+	require.Equal(t, want, proof)
+	require.Zero(t, store.plainReads)
+	require.NotZero(t, store.ctxReads)
+
+	peaks, err := PeakHashesCtx(ctx, store, 25)
+	require.NoError(t, err)
+	wantPeaks, err := PeakHashes(db, 25)
+	require.NoError(t, err)
+	require.Equal(t, wantPeaks, peaks)
+
+	root, err := GetRootCtx(ctx, 26, store, hasher)
+	require.NoError(t, err)
+	wantRoot, err := GetRoot(26, db, hasher)
+	require.NoError(t, err)
+	require.Equal(t, wantRoot, root)
+
+	// once the context is done no more reads are made
+	for i, prove := range []func(ctx context.Context, store indexStoreGetter) error{
+		func(ctx context.Context, store indexStoreGetter) error {
+			_, err := InclusionProofCtx(ctx, store, 62, 15)
+			return err
+		},
+		func(ctx context.Context, store indexStoreGetter) error {
+			_, err := PeakHashesCtx(ctx, store, 25)
+			return err
+		},
+		func(ctx context.Context, store indexStoreGetter) error {
+			_, err := InclusionProofRangeCtx(ctx, store, 26, 3, 9)
+			return err
+		},
+		func(ctx context.Context, store indexStoreGetter) error {
+			_, err := ProveConsistencyCtx(ctx, store, 11, 63)
+			return err
+		},
+		func(ctx context.Context, store indexStoreGetter) error {
+			_, err := InclusionProofBaggedCtx(ctx, 26, store, hasher, 15)
+			return err
+		},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		store := &cancellingStore{testDb: db, cancel: cancel, readsLeft: 2}
+		require.ErrorIs(t, prove(ctx, store), context.Canceled, "case %d", i)
+		require.Equal(t, 2, store.ctxReads)
+	}
+}
@@ -15,6 +15,10 @@ type ConsistencyProof struct {
 	// legacy proof format
 	PathBagged [][]byte   `cbor:"3,keyasint"`
 	Path       [][][]byte `cbor:"4,keyasint"`
+	// RightPeaks are the peaks of MMR(B) which commit none of the peaks of
+	// MMR(A). ProveConsistency sets them so the proof can be verified without
+	// the MMR(B) accumulator, IndexConsistencyProof does not.
+	RightPeaks [][]byte `cbor:"5,keyasint,omitempty"`
 }
 
 // IndexConsistencyProof creates a proof that mmr B appends to mmr A.
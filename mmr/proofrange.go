@@ -0,0 +1,161 @@
+package mmr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash"
+	"slices"
+)
+
+var ErrInclusionRange = errors.New("the leaf range is not in the mmr")
+
+// rangeStep derives parent from its children, at least one of which is
+// derived from the leaves of a range proof
+type rangeStep struct {
+	parent, left, right uint64
+}
+
+// inclusionRangeNodes walks up from the leaves firstLeaf to lastLeaf,
+// inclusive, of the mmr ending at mmrLastIndex. It returns, in ascending
+// order, the witnesses, which are the nodes that can not be derived from the
+// leaves. And the steps which derive the nodes that can, in an order where
+// the children of each step come before it. And, in ascending order, the
+// peaks the leaves reach.
+//
+// The leaves are a contiguous run of height zero nodes, so the nodes derived
+// at each height are also a contiguous run, and a node's sibling is derived
+// if and only if it is next to the node in the run.
+func inclusionRangeNodes(
+	mmrLastIndex uint64, firstLeaf, lastLeaf uint64,
+) (witnesses []uint64, steps []rangeStep, peaks []uint64, err error) {
+	if Peaks(mmrLastIndex) == nil {
+		return nil, nil, nil, fmt.Errorf("%w: %d is not the last index of a complete mmr",
+			ErrInclusionRange, mmrLastIndex)
+	}
+	if lastLeaf < firstLeaf || lastLeaf >= LeafCount(mmrLastIndex+1) {
+		return nil, nil, nil, fmt.Errorf("%w: leaves %d to %d, mmr size %d",
+			ErrInclusionRange, firstLeaf, lastLeaf, mmrLastIndex+1)
+	}
+
+	run := make([]uint64, 0, lastLeaf-firstLeaf+1)
+	for leaf := firstLeaf; leaf <= lastLeaf; leaf++ {
+		run = append(run, MMRIndex(leaf))
+	}
+	for len(run) > 0 {
+		var parents []uint64
+		for k := 0; k < len(run); k++ {
+			i := run[k]
+			g := IndexHeight(i)
+			siblingOffset := uint64(2 << g)
+
+			// If the index after i is higher, it is the left parent, and i is
+			// the right sibling. The left sibling of a derived right sibling
+			// is not derived, otherwise the step was taken for it.
+			if IndexHeight(i+1) > g {
+				step := rangeStep{parent: i + 1, left: i - siblingOffset + 1, right: i}
+				witnesses = append(witnesses, step.left)
+				steps = append(steps, step)
+				parents = append(parents, step.parent)
+				continue
+			}
+
+			// i is the left sibling, when its right sibling is outside the mmr
+			// it is a peak
+			step := rangeStep{parent: i + siblingOffset, left: i, right: i + siblingOffset - 1}
+			if step.right > mmrLastIndex {
+				peaks = append(peaks, i)
+				continue
+			}
+			if k+1 < len(run) && run[k+1] == step.right {
+				k++
+			} else {
+				witnesses = append(witnesses, step.right)
+			}
+			steps = append(steps, step)
+			parents = append(parents, step.parent)
+		}
+		run = parents
+	}
+	slices.Sort(witnesses)
+	slices.Sort(peaks)
+	return witnesses, steps, peaks, nil
+}
+
+// InclusionProofRangePath returns the mmr indices of the nodes in the range
+// proof of the leaves firstLeaf to lastLeaf, inclusive, in the mmr of
+// mmrSize. They are in ascending order, which is the order of the proof
+// InclusionProofRange returns.
+func InclusionProofRangePath(mmrSize uint64, firstLeaf, lastLeaf uint64) ([]uint64, error) {
+	witnesses, _, _, err := inclusionRangeNodes(mmrSize-1, firstLeaf, lastLeaf)
+	return witnesses, err
+}
+
+// InclusionProofRange returns a single proof of inclusion, in the mmr of
+// mmrSize, for the contiguous leaves firstLeaf to lastLeaf, inclusive. It has
+// only the nodes which can not be derived from the leaves, so it is much
+// smaller than the individual proofs of the leaves, which repeat the nodes
+// they share and include nodes the other leaves derive. Verify it with
+// VerifyInclusionRange.
+func InclusionProofRange(store indexStoreGetter, mmrSize uint64, firstLeaf, lastLeaf uint64) ([][]byte, error) {
+	witnesses, _, _, err := inclusionRangeNodes(mmrSize-1, firstLeaf, lastLeaf)
+	if err != nil {
+		return nil, err
+	}
+	proof := make([][]byte, 0, len(witnesses))
+	for _, i := range witnesses {
+		value, err := store.Get(i)
+		if err != nil {
+			return nil, err
+		}
+		proof = append(proof, value)
+	}
+	return proof, nil
+}
+
+// VerifyInclusionRange verifies a proof from InclusionProofRange. The leaf
+// hashes are those of the contiguous leaves from firstLeaf, and peaks is the
+// accumulator of the mmr of mmrSize, as PeakHashes returns it. It returns
+// true if every peak derived from the leaves and the proof is the peak in the
+// accumulator.
+func VerifyInclusionRange(
+	hasher hash.Hash, mmrSize uint64, firstLeaf uint64, leafHashes [][]byte, proof [][]byte, peaks [][]byte,
+) (bool, error) {
+	if len(leafHashes) == 0 {
+		return false, fmt.Errorf("%w: no leaves", ErrVerifyInclusionFailed)
+	}
+	witnesses, steps, reached, err := inclusionRangeNodes(mmrSize-1, firstLeaf, firstLeaf+uint64(len(leafHashes))-1)
+	if err != nil {
+		return false, err
+	}
+	if len(proof) != len(witnesses) {
+		return false, fmt.Errorf("%w: %d proof nodes, %d are required",
+			ErrVerifyInclusionFailed, len(proof), len(witnesses))
+	}
+	accumulator := Peaks(mmrSize - 1)
+	if len(peaks) != len(accumulator) {
+		return false, fmt.Errorf("%w: %d peaks for mmr size %d", ErrVerifyInclusionFailed, len(peaks), mmrSize)
+	}
+
+	nodes := make(map[uint64][]byte, len(leafHashes)+len(proof)+len(steps))
+	for k, leafHash := range leafHashes {
+		nodes[MMRIndex(firstLeaf+uint64(k))] = leafHash
+	}
+	for k, i := range witnesses {
+		nodes[i] = proof[k]
+	}
+	for _, step := range steps {
+		nodes[step.parent] = HashPosPair64(hasher, step.parent+1, nodes[step.left], nodes[step.right])
+	}
+	for _, i := range reached {
+		ipeak, ok := slices.BinarySearch(accumulator, i)
+		if !ok {
+			return false, fmt.Errorf("%w: %d is not a peak of mmr size %d", ErrVerifyInclusionFailed, i, mmrSize)
+		}
+		if !bytes.Equal(nodes[i], peaks[ipeak]) {
+			return false, fmt.Errorf(
+				"%w: proven root not present in the accumulator", ErrVerifyInclusionFailed)
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,73 @@
+package mmr
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInclusionProofRange(t *testing.T) {
+	db := NewGeneratedTestDB(t, 63)
+	hasher := sha256.New()
+
+	for mmrSize := uint64(1); mmrSize <= 63; mmrSize++ {
+		if Peaks(mmrSize-1) == nil {
+			continue
+		}
+		peaks, err := PeakHashes(db, mmrSize-1)
+		require.NoError(t, err)
+		leafCount := LeafCount(mmrSize)
+		for firstLeaf := range leafCount {
+			for lastLeaf := firstLeaf; lastLeaf < leafCount; lastLeaf++ {
+				proof, err := InclusionProofRange(db, mmrSize, firstLeaf, lastLeaf)
+				require.NoError(t, err)
+
+				// the proof has none of the nodes the leaves derive, and no
+				// more nodes than the individual proofs
+				var leaves [][]byte
+				individual := map[string]bool{}
+				for leaf := firstLeaf; leaf <= lastLeaf; leaf++ {
+					leaves = append(leaves, db.mustGet(MMRIndex(leaf)))
+					leafProof, err := InclusionProof(db, mmrSize-1, MMRIndex(leaf))
+					require.NoError(t, err)
+					for _, node := range leafProof {
+						individual[string(node)] = true
+					}
+				}
+				require.LessOrEqual(t, len(proof), len(individual))
+				for _, node := range proof {
+					require.True(t, individual[string(node)])
+				}
+
+				ok, err := VerifyInclusionRange(hasher, mmrSize, firstLeaf, leaves, proof, peaks)
+				require.NoError(t, err, "size %d leaves %d to %d", mmrSize, firstLeaf, lastLeaf)
+				require.True(t, ok)
+			}
+		}
+	}
+
+	// leaves 3 to 9 of 26 derive the peak 14, and 17, see the tree at InclusionProof
+	path, err := InclusionProofRangePath(26, 3, 9)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{2, 3, 20}, path)
+
+	proof, err := InclusionProofRange(db, 26, 3, 9)
+	require.NoError(t, err)
+	peaks, err := PeakHashes(db, 25)
+	require.NoError(t, err)
+	var leaves [][]byte
+	for leaf := uint64(3); leaf <= 9; leaf++ {
+		leaves = append(leaves, db.mustGet(MMRIndex(leaf)))
+	}
+	leaves[2] = db.mustGet(0)
+	_, err = VerifyInclusionRange(hasher, 26, 3, leaves, proof, peaks)
+	require.ErrorIs(t, err, ErrVerifyInclusionFailed)
+	_, err = VerifyInclusionRange(hasher, 26, 3, leaves[:1], proof, peaks)
+	require.ErrorIs(t, err, ErrVerifyInclusionFailed)
+
+	_, err = InclusionProofRange(db, 26, 3, 15)
+	require.ErrorIs(t, err, ErrInclusionRange)
+	_, err = InclusionProofRange(db, 12, 0, 1)
+	require.ErrorIs(t, err, ErrInclusionRange)
+}
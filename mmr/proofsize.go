@@ -0,0 +1,81 @@
+package mmr
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrNodeNotInMMR = errors.New("the node is not in the mmr")
+
+// ProofLength returns the number of nodes in the inclusion proof of the node
+// at mmrIndex, in the mmr of mmrSize, which is also the number of store reads
+// InclusionProof makes for it. Nothing is read, so it is for sizing read
+// budgets and buffers ahead of the proof. mmrSize must be complete.
+//
+// The proof climbs from the node to the peak of mmrSize which commits it, one
+// sibling for each height, so its length is the difference in height of the
+// node and that peak.
+func ProofLength(mmrIndex uint64, mmrSize uint64) (int, error) {
+	if mmrIndex >= mmrSize {
+		return 0, fmt.Errorf("%w: %d, mmr size %d", ErrNodeNotInMMR, mmrIndex, mmrSize)
+	}
+	peaks := Peaks(mmrSize - 1)
+	if peaks == nil {
+		return 0, fmt.Errorf("%w: %d is not a complete mmr size", ErrNodeNotInMMR, mmrSize)
+	}
+	// The peaks are ascending and each commits every node after the peak
+	// before it, so the first at or after the node commits it.
+	for _, peak := range peaks {
+		if peak >= mmrIndex {
+			return int(IndexHeight(peak) - IndexHeight(mmrIndex)), nil
+		}
+	}
+	// not reached, the last peak is mmrSize - 1
+	return 0, fmt.Errorf("%w: %d, mmr size %d", ErrNodeNotInMMR, mmrIndex, mmrSize)
+}
+
+// ConsistencyProofCounts are the node counts of a consistency proof, see
+// ConsistencyProofSize
+type ConsistencyProofCounts struct {
+	// Paths is the number of nodes in the inclusion paths of the peaks of the
+	// smaller mmr, which is the number of store reads IndexConsistencyProof
+	// makes
+	Paths int
+	// RightPeaks is the number of right peaks ProveConsistency adds to the
+	// proof
+	RightPeaks int
+	// Reads is the number of store reads ProveConsistency makes, it reads
+	// every peak of the larger mmr
+	Reads int
+}
+
+// Nodes returns the number of nodes in a proof from ProveConsistency
+func (c ConsistencyProofCounts) Nodes() int {
+	return c.Paths + c.RightPeaks
+}
+
+// ConsistencyProofSize returns the node counts of the proof that the mmr of
+// toSize appends to the mmr of fromSize, without reading the store. Both sizes
+// must be complete.
+func ConsistencyProofSize(fromSize, toSize uint64) (ConsistencyProofCounts, error) {
+	if err := checkConsistencySizes(fromSize, toSize); err != nil {
+		return ConsistencyProofCounts{}, err
+	}
+	var counts ConsistencyProofCounts
+	for _, peak := range Peaks(fromSize - 1) {
+		n, err := ProofLength(peak, toSize)
+		if err != nil {
+			return ConsistencyProofCounts{}, err
+		}
+		counts.Paths += n
+	}
+	peaksTo := Peaks(toSize - 1)
+	for i, peak := range peaksTo {
+		if peak+1-HeightSize(IndexHeight(peak)+1) >= fromSize {
+			counts.RightPeaks = len(peaksTo) - i
+			break
+		}
+	}
+	counts.Reads = counts.Paths + len(peaksTo)
+	return counts, nil
+}
@@ -0,0 +1,61 @@
+package mmr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// countingStore counts the reads of the store it wraps
+type countingStore struct {
+	store indexStoreGetter
+	reads int
+}
+
+func (s *countingStore) Get(i uint64) ([]byte, error) {
+	s.reads++
+	return s.store.Get(i)
+}
+
+func TestProofLength(t *testing.T) {
+	db := NewGeneratedTestDB(t, 63)
+	for mmrSize := uint64(1); mmrSize <= 63; mmrSize = FirstMMRSize(mmrSize + 1) {
+		for i := range mmrSize {
+			n, err := ProofLength(i, mmrSize)
+			require.NoError(t, err)
+			store := &countingStore{store: db}
+			proof, err := InclusionProof(store, mmrSize-1, i)
+			require.NoError(t, err)
+			require.Len(t, proof, n, "node %d, mmr size %d", i, mmrSize)
+			require.Equal(t, n, store.reads)
+		}
+		_, err := ProofLength(mmrSize, mmrSize)
+		require.ErrorIs(t, err, ErrNodeNotInMMR)
+	}
+	// mmr size 2 is not complete
+	_, err := ProofLength(0, 2)
+	require.ErrorIs(t, err, ErrNodeNotInMMR)
+}
+
+func TestConsistencyProofSize(t *testing.T) {
+	db := NewGeneratedTestDB(t, 63)
+	for fromSize := uint64(1); fromSize <= 63; fromSize = FirstMMRSize(fromSize + 1) {
+		for toSize := fromSize; toSize <= 63; toSize = FirstMMRSize(toSize + 1) {
+			counts, err := ConsistencyProofSize(fromSize, toSize)
+			require.NoError(t, err)
+			store := &countingStore{store: db}
+			cp, err := ProveConsistency(store, fromSize, toSize)
+			require.NoError(t, err)
+			paths := 0
+			for _, path := range cp.Path {
+				paths += len(path)
+			}
+			require.Equal(t, paths, counts.Paths, "mmr sizes %d, %d", fromSize, toSize)
+			require.Len(t, cp.RightPeaks, counts.RightPeaks, "mmr sizes %d, %d", fromSize, toSize)
+			require.Equal(t, paths+len(cp.RightPeaks), counts.Nodes())
+			require.Equal(t, counts.Reads, store.reads)
+		}
+	}
+	_, err := ConsistencyProofSize(11, 10)
+	require.ErrorIs(t, err, ErrConsistencyCheck)
+}
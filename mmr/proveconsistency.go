@@ -0,0 +1,82 @@
+package mmr
+
+import (
+	"fmt"
+	"hash"
+	"slices"
+)
+
+// checkConsistencySizes returns an error unless mmrSizeA and mmrSizeB are
+// complete mmr sizes and mmrSizeB is not smaller
+func checkConsistencySizes(mmrSizeA, mmrSizeB uint64) error {
+	if mmrSizeA == 0 || mmrSizeB < mmrSizeA {
+		return fmt.Errorf(
+			"%w: mmr size %d can not be consistent with mmr size %d", ErrConsistencyCheck, mmrSizeB, mmrSizeA)
+	}
+	if Peaks(mmrSizeA-1) == nil || Peaks(mmrSizeB-1) == nil {
+		return fmt.Errorf(
+			"%w: mmr sizes %d and %d must both be complete", ErrConsistencyCheck, mmrSizeA, mmrSizeB)
+	}
+	return nil
+}
+
+// ProveConsistency returns the proof that the mmr of mmrSizeB appends to the
+// mmr of mmrSizeA. Unlike IndexConsistencyProof it includes the right peaks,
+// so the proof carries everything needed to derive the MMR(B) accumulator
+// from the MMR(A) accumulator, and VerifyConsistencyProof can check it without
+// access to the store. Both sizes must be complete.
+func ProveConsistency(store indexStoreGetter, mmrSizeA, mmrSizeB uint64) (ConsistencyProof, error) {
+	if err := checkConsistencySizes(mmrSizeA, mmrSizeB); err != nil {
+		return ConsistencyProof{}, err
+	}
+	cp, err := IndexConsistencyProof(store, mmrSizeA-1, mmrSizeB-1)
+	if err != nil {
+		return ConsistencyProof{}, err
+	}
+	peaksB, err := PeakHashes(store, mmrSizeB-1)
+	if err != nil {
+		return ConsistencyProof{}, err
+	}
+
+	// The MMR(B) peaks committing the MMR(A) peaks are those whose trees
+	// start before mmrSizeA, the rest are entirely new
+	for i, peak := range Peaks(mmrSizeB - 1) {
+		if peak+1-HeightSize(IndexHeight(peak)+1) >= mmrSizeA {
+			cp.RightPeaks = peaksB[i:]
+			break
+		}
+	}
+	return cp, nil
+}
+
+// VerifyConsistencyProof verifies a proof from ProveConsistency using only
+// the accumulator peaksFrom, taken from a trusted source for MMR(A). It
+// returns the MMR(B) accumulator the proof shows MMR(A) is consistent with.
+// The proof itself is not trusted, so the caller must check the returned
+// accumulator against a trusted one for MMR(B), typically a signed mmr state,
+// before relying on it.
+//
+// Failures wrap ErrConsistencyCheck.
+func VerifyConsistencyProof(hasher hash.Hash, cp ConsistencyProof, peaksFrom [][]byte) ([][]byte, error) {
+	if err := checkConsistencySizes(cp.MMRSizeA, cp.MMRSizeB); err != nil {
+		return nil, err
+	}
+	roots, err := ConsistentRoots(hasher, cp.MMRSizeA-1, peaksFrom, cp.Path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrConsistencyCheck, err)
+	}
+	accumulator := slices.Concat(roots, cp.RightPeaks)
+
+	// The roots reached are a prefix of the accumulator. Checking each peak
+	// reaches the peak the tree structure requires ensures the right peaks
+	// are placed after them, and not substituted for them.
+	mapping, err := VerifyConsistencyPath(hasher, cp, peaksFrom, accumulator)
+	if err != nil {
+		return nil, err
+	}
+	if mapping.RightPeaks != len(cp.RightPeaks) {
+		return nil, fmt.Errorf("%w: %d right peaks, mmr size %d has %d",
+			ErrConsistencyCheck, len(cp.RightPeaks), cp.MMRSizeB, mapping.RightPeaks)
+	}
+	return accumulator, nil
+}
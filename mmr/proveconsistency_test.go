@@ -0,0 +1,88 @@
+package mmr
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProveConsistency(t *testing.T) {
+	hasher := sha256.New()
+	db := NewGeneratedTestDB(t, 63)
+
+	for sizeB := uint64(1); sizeB <= 63; sizeB++ {
+		if Peaks(sizeB-1) == nil {
+			continue
+		}
+		peaksB, err := PeakHashes(db, sizeB-1)
+		require.NoError(t, err)
+
+		for sizeA := uint64(1); sizeA <= sizeB; sizeA++ {
+			if Peaks(sizeA-1) == nil {
+				continue
+			}
+			peaksA, err := PeakHashes(db, sizeA-1)
+			require.NoError(t, err)
+
+			cp, err := ProveConsistency(db, sizeA, sizeB)
+			require.NoError(t, err)
+
+			// the auditor has only the proof and the MMR(A) peaks
+			require.Equal(t, sizeA, cp.MMRSizeA)
+			require.Equal(t, sizeB, cp.MMRSizeB)
+			accumulator, err := VerifyConsistencyProof(hasher, cp, peaksA)
+			require.NoError(t, err, "%d -> %d", sizeA, sizeB)
+			require.Equal(t, peaksB, accumulator, "%d -> %d", sizeA, sizeB)
+		}
+	}
+}
+
+func TestProveConsistencyRightPeaks(t *testing.T) {
+	db := NewGeneratedTestDB(t, 63)
+
+	// MMR(11) peaks [6, 9, 10], MMR(26) peaks [14, 21, 24, 25]. All of the
+	// MMR(11) peaks reach 14, and 21, 24 and 25 are new.
+	cp, err := ProveConsistency(db, 11, 26)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{db.mustGet(21), db.mustGet(24), db.mustGet(25)}, cp.RightPeaks)
+
+	cp, err = ProveConsistency(db, 26, 26)
+	require.NoError(t, err)
+	require.Empty(t, cp.RightPeaks)
+
+	_, err = ProveConsistency(db, 11, 12)
+	require.ErrorIs(t, err, ErrConsistencyCheck)
+	_, err = ProveConsistency(db, 26, 11)
+	require.ErrorIs(t, err, ErrConsistencyCheck)
+}
+
+func TestVerifyConsistencyProofTampered(t *testing.T) {
+	hasher := sha256.New()
+	db := NewGeneratedTestDB(t, 63)
+	peaksA, err := PeakHashes(db, 10)
+	require.NoError(t, err)
+
+	cp, err := ProveConsistency(db, 11, 26)
+	require.NoError(t, err)
+	_, err = VerifyConsistencyProof(hasher, cp, peaksA)
+	require.NoError(t, err)
+
+	// a path node changed
+	tampered := cp
+	tampered.Path = [][][]byte{cp.Path[0], {db.mustGet(0)}, cp.Path[2]}
+	_, err = VerifyConsistencyProof(hasher, tampered, peaksA)
+	require.ErrorIs(t, err, ErrConsistencyCheck)
+
+	// a right peak dropped
+	tampered = cp
+	tampered.RightPeaks = cp.RightPeaks[:1]
+	_, err = VerifyConsistencyProof(hasher, tampered, peaksA)
+	require.ErrorIs(t, err, ErrConsistencyCheck)
+
+	// a path for a missing peak
+	tampered = cp
+	tampered.Path = cp.Path[:2]
+	_, err = VerifyConsistencyProof(hasher, tampered, peaksA)
+	require.ErrorIs(t, err, ErrConsistencyCheck)
+}
@@ -88,20 +88,11 @@ func SpurSumHeight(height uint64) uint64 {
 // Due to the binary nature of the tree, the set reduction is just dividing the
 // current number of spurs by 2 and the count to subtract is exactly the result
 // of that.
+//
+// The sum of leafIndex >> k for all k > 0 is leafIndex - popcount(leafIndex),
+// so the result is simply the count of set bits.
 func LeafMinusSpurSum(leafIndex uint64) uint64 {
-
-	// XXX: TODO: I think there is a more efficient approach which recursively
-	// splits the leaf index into perfect sub trees based on the most sig bit
-	// set, and then uses sum = 2i at each round. But this approach, especially
-	// given it is used mostly for the much smaller logical massif connecting
-	// tree, is fine too.
-
-	sum := leafIndex
-	leafIndex >>= 1
-	for ; leafIndex > 0; leafIndex >>= 1 {
-		sum -= leafIndex
-	}
-	return sum
+	return uint64(bits.OnesCount64(leafIndex))
 }
 
 // SpurHeightLeaf returns the number of nodes 'above' and to the *left* of the provided leaf index
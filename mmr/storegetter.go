@@ -1,5 +1,56 @@
 package mmr
 
+import "context"
+
 type indexStoreGetter interface {
 	Get(i uint64) ([]byte, error)
 }
+
+// indexStoreGetterCtx is implemented by stores whose reads can be cancelled,
+// typically those backed by remote storage. The Ctx variants of the proof
+// functions use it in preference to Get.
+type indexStoreGetterCtx interface {
+	GetCtx(ctx context.Context, i uint64) ([]byte, error)
+}
+
+// peakHashesMemo is implemented by stores which remember the peak hashes
+// computed from them, for as long as the nodes they were computed from are
+// unchanged. PeakHashes asks it first, and gives it the peak hashes it reads.
+// The values are copied both ways, a memo can keep what it is given.
+type peakHashesMemo interface {
+	PeakHashesMemo(mmrIndex uint64) ([][]byte, bool)
+	MemoizePeakHashes(mmrIndex uint64, peaks [][]byte)
+}
+
+// ctxStore adapts a store so every read first checks the context, and is
+// made with GetCtx if the store implements it. The functions of this package
+// read through it to honour a context without changing their logic.
+type ctxStore struct {
+	ctx   context.Context
+	store indexStoreGetter
+}
+
+func (s ctxStore) Get(i uint64) ([]byte, error) {
+	if err := s.ctx.Err(); err != nil {
+		return nil, err
+	}
+	if store, ok := s.store.(indexStoreGetterCtx); ok {
+		return store.GetCtx(s.ctx, i)
+	}
+	return s.store.Get(i)
+}
+
+// PeakHashesMemo forwards to the store's memo, if it has one
+func (s ctxStore) PeakHashesMemo(mmrIndex uint64) ([][]byte, bool) {
+	if memo, ok := s.store.(peakHashesMemo); ok {
+		return memo.PeakHashesMemo(mmrIndex)
+	}
+	return nil, false
+}
+
+// MemoizePeakHashes forwards to the store's memo, if it has one
+func (s ctxStore) MemoizePeakHashes(mmrIndex uint64, peaks [][]byte) {
+	if memo, ok := s.store.(peakHashesMemo); ok {
+		memo.MemoizePeakHashes(mmrIndex, peaks)
+	}
+}
@@ -54,6 +54,9 @@ func CheckConsistency(
 //		7 in MMR(B) -> []
 //		8 in MMR(B) -> [9]
 //		Path = [[], [9]]
+//
+// See VerifyConsistencyPath for the mapping from each MMR(A) peak to its MMR(B)
+// peak.
 func VerifyConsistency(
 	hasher hash.Hash,
 	cp ConsistencyProof, peaksFrom [][]byte, peaksTo [][]byte) (bool, [][]byte, error) {
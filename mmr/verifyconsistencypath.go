@@ -0,0 +1,94 @@
+package mmr
+
+import (
+	"bytes"
+	"fmt"
+	"hash"
+)
+
+// PeakMapping records how one peak of MMR(A) is committed by MMR(B).
+type PeakMapping struct {
+	// From is the position of the peak in the MMR(A) accumulator
+	From int
+	// FromIndex is the mmr index of the MMR(A) peak
+	FromIndex uint64
+	// To is the position, in the MMR(B) accumulator, of the peak committing
+	// the MMR(A) peak. Many MMR(A) peaks may share the same MMR(B) peak.
+	To int
+	// ToIndex is the mmr index of that MMR(B) peak
+	ToIndex uint64
+	// Path is the inclusion proof of the MMR(A) peak in the MMR(B) peak, it is
+	// empty if the peak is unchanged.
+	Path [][]byte
+}
+
+// ConsistencyMapping is the full outcome of VerifyConsistencyPath.
+type ConsistencyMapping struct {
+	// Peaks has an entry for every MMR(A) peak, in accumulator order
+	Peaks []PeakMapping
+	// Accumulator is the MMR(B) accumulator
+	Accumulator [][]byte
+	// RightPeaks is the count of MMR(B) peaks, at the end of Accumulator, that
+	// commit none of the MMR(A) peaks. They are entirely new.
+	RightPeaks int
+}
+
+// VerifyConsistencyPath verifies the consistency proof exactly as
+// VerifyConsistency does, but returns the mapping from each MMR(A) peak to the
+// MMR(B) peak that commits it, and the path between them. The MMR(B) peak for
+// each MMR(A) peak is determined by the tree structure, not by searching for
+// the proven root, so a failure identifies the peak and the expected position
+// in MMR(B). Failures wrap ErrConsistencyCheck.
+func VerifyConsistencyPath(
+	hasher hash.Hash,
+	cp ConsistencyProof, peaksFrom [][]byte, peaksTo [][]byte,
+) (ConsistencyMapping, error) {
+	if cp.MMRSizeA == 0 || cp.MMRSizeB < cp.MMRSizeA {
+		return ConsistencyMapping{}, fmt.Errorf(
+			"%w: mmr size %d can not be consistent with mmr size %d", ErrConsistencyCheck, cp.MMRSizeB, cp.MMRSizeA)
+	}
+	indicesFrom := Peaks(cp.MMRSizeA - 1)
+	indicesTo := Peaks(cp.MMRSizeB - 1)
+	if len(peaksFrom) != len(indicesFrom) || len(cp.Path) != len(indicesFrom) {
+		return ConsistencyMapping{}, fmt.Errorf(
+			"%w: mmr size %d has %d peaks, got %d peaks and %d paths",
+			ErrConsistencyCheck, cp.MMRSizeA, len(indicesFrom), len(peaksFrom), len(cp.Path))
+	}
+	if len(peaksTo) != len(indicesTo) {
+		return ConsistencyMapping{}, fmt.Errorf(
+			"%w: mmr size %d has %d peaks, got %d",
+			ErrConsistencyCheck, cp.MMRSizeB, len(indicesTo), len(peaksTo))
+	}
+
+	mapping := ConsistencyMapping{
+		Peaks:       make([]PeakMapping, len(indicesFrom)),
+		Accumulator: peaksTo,
+	}
+	to := 0
+	for from, iFrom := range indicesFrom {
+		// Both peak lists are in ascending index order, the committing peak is
+		// the first MMR(B) peak at or after the MMR(A) peak.
+		for to < len(indicesTo) && indicesTo[to] < iFrom {
+			to++
+		}
+		if to == len(indicesTo) {
+			return ConsistencyMapping{}, fmt.Errorf(
+				"%w: peak %d (mmr index %d) is beyond mmr size %d", ErrConsistencyCheck, from, iFrom, cp.MMRSizeB)
+		}
+		root := IncludedRoot(hasher, iFrom, peaksFrom[from], cp.Path[from])
+		if !bytes.Equal(root, peaksTo[to]) {
+			return ConsistencyMapping{}, fmt.Errorf(
+				"%w: peak %d (mmr index %d) with a path of length %d does not reach peak %d (mmr index %d)",
+				ErrConsistencyCheck, from, iFrom, len(cp.Path[from]), to, indicesTo[to])
+		}
+		mapping.Peaks[from] = PeakMapping{
+			From:      from,
+			FromIndex: iFrom,
+			To:        to,
+			ToIndex:   indicesTo[to],
+			Path:      cp.Path[from],
+		}
+	}
+	mapping.RightPeaks = len(indicesTo) - 1 - to
+	return mapping, nil
+}
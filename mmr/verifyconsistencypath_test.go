@@ -0,0 +1,63 @@
+package mmr
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyConsistencyPath(t *testing.T) {
+	hasher := sha256.New()
+	store := NewCanonicalTestDB(t)
+
+	// every pair of complete mmr sizes in the canonical 39 node mmr
+	for leavesA := uint64(1); leavesA <= 21; leavesA++ {
+		for leavesB := leavesA; leavesB <= 21; leavesB++ {
+			sizeA, sizeB := MMRIndex(leavesA), MMRIndex(leavesB)
+			cp, err := IndexConsistencyProof(store, sizeA-1, sizeB-1)
+			require.NoError(t, err)
+			peaksA, err := PeakHashes(store, sizeA-1)
+			require.NoError(t, err)
+			peaksB, err := PeakHashes(store, sizeB-1)
+			require.NoError(t, err)
+
+			mapping, err := VerifyConsistencyPath(hasher, cp, peaksA, peaksB)
+			require.NoError(t, err, "%d -> %d", sizeA, sizeB)
+			require.Equal(t, peaksB, mapping.Accumulator)
+			require.Len(t, mapping.Peaks, len(peaksA))
+
+			indicesB := Peaks(sizeB - 1)
+			for _, m := range mapping.Peaks {
+				assert.Equal(t, indicesB[m.To], m.ToIndex)
+				assert.GreaterOrEqual(t, m.ToIndex, m.FromIndex)
+				assert.Equal(t, m.FromIndex == m.ToIndex, len(m.Path) == 0)
+			}
+			last := mapping.Peaks[len(mapping.Peaks)-1]
+			assert.Equal(t, len(indicesB)-1-last.To, mapping.RightPeaks)
+		}
+	}
+
+	// MMR(11) [6, 9, 10] -> MMR(15) [14], every peak is buried under 14
+	cp, err := IndexConsistencyProof(store, 10, 14)
+	require.NoError(t, err)
+	peaksA, err := PeakHashes(store, 10)
+	require.NoError(t, err)
+	peaksB, err := PeakHashes(store, 14)
+	require.NoError(t, err)
+	mapping, err := VerifyConsistencyPath(hasher, cp, peaksA, peaksB)
+	require.NoError(t, err)
+	for i, m := range mapping.Peaks {
+		assert.Equal(t, i, m.From)
+		assert.Equal(t, 0, m.To)
+		assert.Equal(t, uint64(14), m.ToIndex)
+	}
+	assert.Equal(t, 0, mapping.RightPeaks)
+
+	// a bad peak is identified in the error
+	peaksA[1] = hashNum(1000)
+	_, err = VerifyConsistencyPath(hasher, cp, peaksA, peaksB)
+	require.ErrorIs(t, err, ErrConsistencyCheck)
+	assert.Contains(t, err.Error(), "peak 1 (mmr index 9)")
+}
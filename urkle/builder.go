@@ -131,6 +131,68 @@ func (b *Builder) SaveFrontier(dst []byte) error {
 //
 // key MUST be strictly increasing across calls.
 func (b *Builder) InsertMonotone(key uint64, valueBytes []byte) (leafOrdinal uint32, err error) {
+	return b.insertMonotone(key, valueBytes, LeafHashV1, nil)
+}
+
+// InsertMonotoneExtras inserts (key,valueBytes) into the trie and stores up to
+// LeafExtraFields extras in the leaf record, as LeafSetExtra does. The leaf is
+// hashed with LeafHashV2, so the extras are committed by the trie root and are
+// covered by the leaf's proofs. nil extras are stored, and committed, as zero.
+//
+// key MUST be strictly increasing across calls.
+func (b *Builder) InsertMonotoneExtras(key uint64, valueBytes []byte, extras ...[]byte) (leafOrdinal uint32, err error) {
+	if len(extras) > LeafExtraFields {
+		return 0, ErrTooManyExtras
+	}
+	for _, extra := range extras {
+		if len(extra) > HashBytes {
+			return 0, ErrBadValueSize
+		}
+	}
+	return b.insertMonotone(key, valueBytes, LeafHashV2, extras)
+}
+
+// InsertMonotoneBatch inserts the (key, value) pairs in order, as successive
+// InsertMonotone calls would, and returns the leaf ordinal of the first. The
+// whole batch is validated before anything is inserted: the keys must be
+// strictly increasing and follow the last key inserted, every value must be
+// HashBytes long, and the leaf table must have room for all of them. The node
+// store always has room for the leaves the table can hold.
+//
+// A failed batch leaves the builder as it was. An empty batch does nothing
+// and returns the ordinal the next leaf would have.
+func (b *Builder) InsertMonotoneBatch(keys []uint64, values [][]byte) (firstOrdinal uint32, err error) {
+	if len(keys) != len(values) {
+		return 0, fmt.Errorf("%w: %d keys, %d values", ErrBatchLengthMismatch, len(keys), len(values))
+	}
+	firstOrdinal = b.st.NextLeaf
+	if uint64(b.st.NextLeaf)+uint64(len(keys)) > uint64(b.leafCap) {
+		return 0, fmt.Errorf("%w: %d leaves do not fit, %d of %d used",
+			ErrInvalidLeafOrdinal, len(keys), b.st.NextLeaf, b.leafCap)
+	}
+	last, haveLast := b.st.LastKey, b.st.NextLeaf != 0
+	for i, key := range keys {
+		if len(values[i]) != HashBytes {
+			return 0, fmt.Errorf("%w: batch entry %d", ErrBadValueSize, i)
+		}
+		if haveLast && key < last {
+			return 0, fmt.Errorf("%w: batch entry %d", ErrOutOfOrderKey, i)
+		}
+		if haveLast && key == last {
+			return 0, fmt.Errorf("%w: batch entry %d", ErrDuplicateKey, i)
+		}
+		last, haveLast = key, true
+	}
+
+	for i, key := range keys {
+		if _, err = b.insertValidated(key, values[i], LeafHashV1, nil); err != nil {
+			return 0, err
+		}
+	}
+	return firstOrdinal, nil
+}
+
+func (b *Builder) insertMonotone(key uint64, valueBytes []byte, format LeafHashFormat, extras [][]byte) (leafOrdinal uint32, err error) {
 	if len(valueBytes) != HashBytes {
 		return 0, ErrBadValueSize
 	}
@@ -147,21 +209,37 @@ func (b *Builder) InsertMonotone(key uint64, valueBytes []byte) (leafOrdinal uin
 	if b.st.NextLeaf >= b.leafCap {
 		return 0, ErrInvalidLeafOrdinal
 	}
+	return b.insertValidated(key, valueBytes, format, extras)
+}
+
+// insertValidated inserts a leaf whose value size, key order and capacity
+// have been checked by the caller.
+func (b *Builder) insertValidated(key uint64, valueBytes []byte, format LeafHashFormat, extras [][]byte) (leafOrdinal uint32, err error) {
 	leafOrdinal = b.st.NextLeaf
 
 	// Persist leaf payload.
 	LeafSet(b.leafTable, leafOrdinal, key, valueBytes)
+	for i, extra := range extras {
+		if extra != nil {
+			LeafSetExtra(b.leafTable, leafOrdinal, uint8(i), extra)
+		}
+	}
+	var leafExtras [LeafExtraFields][HashBytes]byte
+	if format == LeafHashV2 {
+		// read back, so the hash commits to exactly what is stored
+		leafExtras = LeafExtras(b.leafTable, leafOrdinal)
+	}
 
 	// Precompute leaf hash; we may delay emitting the leaf node record until
 	// after we close any completed frames to preserve B′ postorder contiguity.
-	leafHash, err := HashLeaf(b.hasher, key, leafOrdinal, valueBytes)
+	leafHash, err := hashLeafFormat(b.hasher, format, key, leafOrdinal, valueBytes, leafExtras)
 	if err != nil {
 		return 0, err
 	}
 
 	// First insert is trivial: pending points at the only subtree.
 	if b.st.NextLeaf == 0 {
-		leafRef, err := b.emitLeaf(leafOrdinal, leafHash)
+		leafRef, err := b.emitLeaf(leafOrdinal, format, leafHash)
 		if err != nil {
 			return 0, err
 		}
@@ -200,7 +278,7 @@ func (b *Builder) InsertMonotone(key uint64, valueBytes []byte) (leafOrdinal uin
 	}
 
 	// The new key is now the rightmost subtree.
-	leafRef, err := b.emitLeaf(leafOrdinal, leafHash)
+	leafRef, err := b.emitLeaf(leafOrdinal, format, leafHash)
 	if err != nil {
 		return 0, err
 	}
@@ -231,12 +309,12 @@ func (b *Builder) Finalize() (Ref, [HashBytes]byte, error) {
 	return root, NodeHash(b.nodeStore, root), nil
 }
 
-func (b *Builder) emitLeaf(leafOrdinal uint32, leafHash [HashBytes]byte) (Ref, error) {
+func (b *Builder) emitLeaf(leafOrdinal uint32, format LeafHashFormat, leafHash [HashBytes]byte) (Ref, error) {
 	if uint32(b.st.Next) >= b.nodeCap {
 		return 0, ErrNodeStoreBadSize
 	}
 	ref := b.st.Next
-	NodeWriteLeaf(b.nodeStore, ref, leafOrdinal, leafHash)
+	NodeWriteLeafFormat(b.nodeStore, ref, leafOrdinal, format, leafHash)
 	b.st.Next++
 	return ref, nil
 }
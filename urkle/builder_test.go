@@ -93,3 +93,73 @@ func TestBuilderFrontierRoundTripResumeMatchesNoBoundaryBuild(t *testing.T) {
 		require.Equal(t, root1, root2)
 	}
 }
+
+func TestBuilderInsertMonotoneBatchMatchesSingleInserts(t *testing.T) {
+	leafCount := uint64(16)
+	keys := make([]uint64, 11)
+	values := make([][]byte, len(keys))
+	for i := range keys {
+		keys[i] = uint64(i*i*7 + 3)
+		v := sha256.Sum256([]byte{byte(i)})
+		values[i] = v[:]
+	}
+
+	singleLeaves := make([]byte, LeafTableBytes(leafCount))
+	singleNodes := make([]byte, NodeStoreBytes(leafCount))
+	single, err := NewBuilder(sha256.New(), singleLeaves, singleNodes)
+	require.NoError(t, err)
+	for i, key := range keys {
+		_, err = single.InsertMonotone(key, values[i])
+		require.NoError(t, err)
+	}
+
+	batchLeaves := make([]byte, LeafTableBytes(leafCount))
+	batchNodes := make([]byte, NodeStoreBytes(leafCount))
+	batch, err := NewBuilder(sha256.New(), batchLeaves, batchNodes)
+	require.NoError(t, err)
+	first, err := batch.InsertMonotoneBatch(keys[:4], values[:4])
+	require.NoError(t, err)
+	require.Equal(t, uint32(0), first)
+	first, err = batch.InsertMonotoneBatch(keys[4:], values[4:])
+	require.NoError(t, err)
+	require.Equal(t, uint32(4), first)
+
+	require.Equal(t, single.Frontier(), batch.Frontier())
+	require.Equal(t, singleLeaves, batchLeaves)
+	require.Equal(t, singleNodes, batchNodes)
+	_, want, err := single.Finalize()
+	require.NoError(t, err)
+	_, got, err := batch.Finalize()
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+}
+
+func TestBuilderInsertMonotoneBatchRejectsWholeBatch(t *testing.T) {
+	leafCount := uint64(4)
+	leafTable := make([]byte, LeafTableBytes(leafCount))
+	nodeStore := make([]byte, NodeStoreBytes(leafCount))
+	b, err := NewBuilder(sha256.New(), leafTable, nodeStore)
+	require.NoError(t, err)
+
+	var v [HashBytes]byte
+	_, err = b.InsertMonotone(10, v[:])
+	require.NoError(t, err)
+	before := b.Frontier()
+
+	for _, tc := range []struct {
+		keys   []uint64
+		values [][]byte
+		err    error
+	}{
+		{[]uint64{11, 12}, [][]byte{v[:]}, ErrBatchLengthMismatch},
+		{[]uint64{11, 12, 13, 14}, [][]byte{v[:], v[:], v[:], v[:]}, ErrInvalidLeafOrdinal},
+		{[]uint64{11, 10}, [][]byte{v[:], v[:]}, ErrOutOfOrderKey},
+		{[]uint64{11, 11}, [][]byte{v[:], v[:]}, ErrDuplicateKey},
+		{[]uint64{10}, [][]byte{v[:]}, ErrDuplicateKey},
+		{[]uint64{11, 12}, [][]byte{v[:], v[:1]}, ErrBadValueSize},
+	} {
+		_, err = b.InsertMonotoneBatch(tc.keys, tc.values)
+		require.ErrorIs(t, err, tc.err)
+		require.Equal(t, before, b.Frontier())
+	}
+}
@@ -51,6 +51,16 @@ The package standardizes record formats for:
 - a fixed-size `nodeStore` storing postorder node records
 - a fixed-size `FrontierStateV1` snapshot to resume building across batches
 
+Leaf records carry three auxiliary extra fields. Leaves inserted with
+`InsertMonotone` are hashed with `LeafHashV1`, which leaves the extras
+advisory. Leaves inserted with `InsertMonotoneExtras` are hashed with
+`LeafHashV2`, which commits to the extras, and their inclusion and exclusion
+proofs carry them. The format is recorded in each leaf node record.
+
+`ProveKey` proves a key is present or absent given only the trie's root hash,
+such as the one in the massif start header, and `VerifyKeyProof` checks the
+proof against that hash without the trie.
+
 See `arbor/docs/arc-urkle-format-and-support.md` for the full rationale.
 
 ## Capacity limits and massif height
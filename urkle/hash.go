@@ -41,3 +41,47 @@ func HashBranch(hasher hash.Hash, bit uint8, left, right [HashBytes]byte) ([Hash
 	copy(out[:], sum)
 	return out, nil
 }
+
+// HashLeafV2 computes the leaf hash for LeafHashV2, which binds the leaf
+// record extra fields:
+//
+//	H( 0x02 || key_be8 || leafOrdinal_be4 || valueBytes[32] || extra1[32] || extra2[32] || extra3[32] )
+//
+// extras are as returned by LeafExtra, extra1 is zero padded from its 24
+// stored bytes.
+func HashLeafV2(hasher hash.Hash, key uint64, leafOrdinal uint32, valueBytes []byte, extras [LeafExtraFields][HashBytes]byte) ([HashBytes]byte, error) {
+	if len(valueBytes) != HashBytes {
+		return [HashBytes]byte{}, ErrBadValueSize
+	}
+	hasher.Reset()
+	_, _ = hasher.Write([]byte{0x02})
+	HashWriteUint64(hasher, key)
+	HashWriteUint32(hasher, leafOrdinal)
+	_, _ = hasher.Write(valueBytes)
+	for i := range extras {
+		_, _ = hasher.Write(extras[i][:])
+	}
+
+	var out [HashBytes]byte
+	sum := hasher.Sum(out[:0])
+	if len(sum) != HashBytes {
+		return [HashBytes]byte{}, ErrBadHashSize
+	}
+	copy(out[:], sum)
+	return out, nil
+}
+
+// hashLeafFormat computes the leaf hash according to format.
+func hashLeafFormat(
+	hasher hash.Hash, format LeafHashFormat,
+	key uint64, leafOrdinal uint32, valueBytes []byte, extras [LeafExtraFields][HashBytes]byte,
+) ([HashBytes]byte, error) {
+	switch format {
+	case LeafHashV1:
+		return HashLeaf(hasher, key, leafOrdinal, valueBytes)
+	case LeafHashV2:
+		return HashLeafV2(hasher, key, leafOrdinal, valueBytes, extras)
+	default:
+		return [HashBytes]byte{}, ErrInvalidLeafHashFormat
+	}
+}
@@ -0,0 +1,113 @@
+package urkle
+
+import (
+	"fmt"
+	"hash"
+)
+
+// KeyProof proves whether Key is present in a trie. It is the membership proof
+// of the leaf reached by searching for Key: if the leaf's key is Key then Key
+// is present, otherwise the trie has no other leaf Key could be at, and Key is
+// absent.
+//
+// Steps are ordered from leaf -> root, each has the bit the branch tests and
+// the hash of the sibling subtree. LeafHash and Extras are as for
+// InclusionProof.
+type KeyProof struct {
+	Key         uint64
+	LeafKey     uint64
+	LeafOrdinal uint32
+	Value       [HashBytes]byte
+	LeafHash    LeafHashFormat
+	Extras      [LeafExtraFields][HashBytes]byte
+	Steps       []ProofStep
+}
+
+// Present returns true if the proof is of inclusion, and false if it is of
+// exclusion
+func (p KeyProof) Present() bool {
+	return p.LeafKey == p.Key
+}
+
+// ProveKey generates the proof of inclusion, or of exclusion, for key in the
+// trie whose root hash is rootHash. The root is located in the node store by
+// its hash, so only the finalized root, such as the one stored in the massif
+// start header, is needed. Returns ErrRootNotFound if no node has the hash.
+func ProveKey(leafTable, nodeStore []byte, rootHash [HashBytes]byte, key uint64) (KeyProof, error) {
+	root, err := findRootRef(nodeStore, rootHash)
+	if err != nil {
+		return KeyProof{}, err
+	}
+
+	leafRef, stepsRT, err := provePath(nodeStore, root, key)
+	if err != nil {
+		return KeyProof{}, err
+	}
+
+	leafOrdinal := NodeLeafOrdinal(nodeStore, leafRef)
+	if LeafRecordOffset(leafOrdinal)+LeafRecordBytes > uint64(len(leafTable)) {
+		return KeyProof{}, fmt.Errorf("%w: leafOrdinal=%d", ErrInvalidLeafOrdinal, leafOrdinal)
+	}
+	format, extras := proveLeafExtras(leafTable, nodeStore, leafRef, leafOrdinal)
+	return KeyProof{
+		Key:         key,
+		LeafKey:     LeafKey(leafTable, leafOrdinal),
+		LeafOrdinal: leafOrdinal,
+		Value:       LeafValue(leafTable, leafOrdinal),
+		LeafHash:    format,
+		Extras:      extras,
+		Steps:       reverseSteps(stepsRT),
+	}, nil
+}
+
+// VerifyKeyProof verifies a proof from ProveKey against expectedRoot, and
+// returns whether it shows the key is present. The value of a present key is
+// p.Value. A proof which does not reach expectedRoot returns
+// ErrVerifyInclusionFailed, or ErrVerifyExclusionFailed if the key is absent.
+func VerifyKeyProof(hasher hash.Hash, expectedRoot [HashBytes]byte, p KeyProof) (bool, error) {
+	if p.Present() {
+		_, _, _, err := VerifyInclusion(hasher, expectedRoot, InclusionProof{
+			Key:         p.Key,
+			LeafOrdinal: p.LeafOrdinal,
+			Value:       p.Value,
+			LeafHash:    p.LeafHash,
+			Extras:      p.Extras,
+			Steps:       p.Steps,
+		})
+		if err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	_, _, _, _, err := VerifyExclusion(hasher, expectedRoot, ExclusionProof{
+		TargetKey:      p.Key,
+		EncounteredKey: p.LeafKey,
+		LeafOrdinal:    p.LeafOrdinal,
+		Value:          p.Value,
+		LeafHash:       p.LeafHash,
+		Extras:         p.Extras,
+		Steps:          p.Steps,
+	})
+	if err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+// findRootRef returns the ref of the node whose hash is rootHash. Nodes are
+// stored in postorder, so the root of a finalized trie is the last node
+// written, and the search is from the end of the store.
+func findRootRef(nodeStore []byte, rootHash [HashBytes]byte) (Ref, error) {
+	for ref := Ref(len(nodeStore) / NodeRecordBytes); ref > 0; {
+		ref--
+		kind := NodeKindAt(nodeStore, ref)
+		if kind != KindLeaf && kind != KindBranch {
+			continue
+		}
+		if NodeHash(nodeStore, ref) == rootHash {
+			return ref, nil
+		}
+	}
+	return NoRef, ErrRootNotFound
+}
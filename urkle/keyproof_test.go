@@ -0,0 +1,74 @@
+package urkle
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProveKey(t *testing.T) {
+	keys := []uint64{10, 20, 30, 40, 50, 60, 70, 80}
+	leafCount := uint64(len(keys))
+
+	leafTable := make([]byte, LeafTableBytes(leafCount))
+	nodeStore := make([]byte, NodeStoreBytes(leafCount))
+
+	b, err := NewBuilder(sha256.New(), leafTable, nodeStore)
+	require.NoError(t, err)
+	var v [HashBytes]byte
+	for i, k := range keys {
+		v[0] = byte(k)
+		if i%2 == 0 {
+			_, err = b.InsertMonotone(k, v[:])
+		} else {
+			_, err = b.InsertMonotoneExtras(k, v[:], []byte{byte(k)})
+		}
+		require.NoError(t, err)
+	}
+	_, rootHash, err := b.Finalize()
+	require.NoError(t, err)
+
+	for _, k := range keys {
+		p, err := ProveKey(leafTable, nodeStore, rootHash, k)
+		require.NoError(t, err)
+		require.True(t, p.Present())
+		require.Equal(t, byte(k), p.Value[0])
+
+		present, err := VerifyKeyProof(sha256.New(), rootHash, p)
+		require.NoError(t, err)
+		require.True(t, present)
+
+		// the value is proven
+		tampered := p
+		tampered.Value[1] ^= 1
+		_, err = VerifyKeyProof(sha256.New(), rootHash, tampered)
+		require.ErrorIs(t, err, ErrVerifyInclusionFailed)
+	}
+
+	for _, k := range []uint64{0, 15, 45, 81, ^uint64(0)} {
+		p, err := ProveKey(leafTable, nodeStore, rootHash, k)
+		require.NoError(t, err)
+		require.False(t, p.Present())
+
+		present, err := VerifyKeyProof(sha256.New(), rootHash, p)
+		require.NoError(t, err, "key %d", k)
+		require.False(t, present)
+
+		// the leaf reached must be the one the key's path leads to
+		for _, other := range keys {
+			if other == p.LeafKey {
+				continue
+			}
+			tampered := p
+			tampered.LeafKey = other
+			_, err = VerifyKeyProof(sha256.New(), rootHash, tampered)
+			require.ErrorIs(t, err, ErrVerifyExclusionFailed)
+		}
+	}
+
+	_, err = ProveKey(leafTable, nodeStore, [HashBytes]byte{1}, 10)
+	require.ErrorIs(t, err, ErrRootNotFound)
+	_, err = ProveKey(leafTable, make([]byte, len(nodeStore)), rootHash, 10)
+	require.ErrorIs(t, err, ErrRootNotFound)
+}
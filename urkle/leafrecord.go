@@ -13,7 +13,7 @@ const (
 	leafExtra2Off = leafExtra1Off + leafExtra1Bytes
 	leafExtra3Off = leafExtra2Off + leafExtraBytes
 
-	leafExtraFields = 3
+	leafExtraFields = LeafExtraFields
 )
 
 // LeafRecordOffset returns the byte offset of leafOrdinal in leafTable.
@@ -117,3 +117,13 @@ func LeafSetExtra(leafTable []byte, leafOrdinal uint32, idx uint8, extra []byte)
 		panic("urkle: leaf extra index out of range")
 	}
 }
+
+// LeafExtras returns all the extra fields for leafOrdinal, as LeafExtra does.
+// Caller must ensure leafTable is large enough.
+func LeafExtras(leafTable []byte, leafOrdinal uint32) [LeafExtraFields][HashBytes]byte {
+	var out [LeafExtraFields][HashBytes]byte
+	for i := range out {
+		out[i] = LeafExtra(leafTable, leafOrdinal, uint8(i))
+	}
+	return out
+}
@@ -30,6 +30,13 @@ func NodeSubtreeSize(nodeStore []byte, ref Ref) uint32 {
 	return readU32BE(nodeRec(nodeStore, ref)[8:12])
 }
 
+// NodeLeafHashFormat returns the leaf hash format (only meaningful for
+// KindLeaf). Leaf records written before the format was introduced read as
+// LeafHashV1.
+func NodeLeafHashFormat(nodeStore []byte, ref Ref) LeafHashFormat {
+	return LeafHashFormat(nodeRec(nodeStore, ref)[2])
+}
+
 // NodeLeafOrdinal returns leafOrdinal (only meaningful for KindLeaf).
 func NodeLeafOrdinal(nodeStore []byte, ref Ref) uint32 {
 	return readU32BE(nodeRec(nodeStore, ref)[12:16])
@@ -46,11 +53,18 @@ func nodeWriteHash(rec []byte, h [HashBytes]byte) {
 	copy(rec[32:32+HashBytes], h[:])
 }
 
-// NodeWriteLeaf writes a leaf record in-place.
+// NodeWriteLeaf writes a LeafHashV1 leaf record in-place.
 func NodeWriteLeaf(nodeStore []byte, ref Ref, leafOrdinal uint32, h [HashBytes]byte) {
+	NodeWriteLeafFormat(nodeStore, ref, leafOrdinal, LeafHashV1, h)
+}
+
+// NodeWriteLeafFormat writes a leaf record, hashed according to format,
+// in-place.
+func NodeWriteLeafFormat(nodeStore []byte, ref Ref, leafOrdinal uint32, format LeafHashFormat, h [HashBytes]byte) {
 	rec := nodeRec(nodeStore, ref)
 	rec[0] = byte(KindLeaf)
 	rec[1] = 0
+	rec[2] = byte(format)
 	writeU32BE(rec[4:8], 0)  // rightSpan
 	writeU32BE(rec[8:12], 1) // subtreeSize
 	writeU32BE(rec[12:16], leafOrdinal)
@@ -14,22 +14,30 @@ type ProofStep struct {
 
 // InclusionProof proves that Key is present and yields (LeafOrdinal, Value).
 // Steps are ordered from leaf -> root.
+//
+// If LeafHash is LeafHashV2 the proof also yields the leaf record Extras,
+// otherwise Extras are zero and are not proven.
 type InclusionProof struct {
 	Key         uint64
 	LeafOrdinal uint32
 	Value       [HashBytes]byte
+	LeafHash    LeafHashFormat
+	Extras      [LeafExtraFields][HashBytes]byte
 	Steps       []ProofStep
 }
 
 // ExclusionProof proves that TargetKey is absent by returning the membership proof
 // for the encountered leaf reached by traversing with TargetKey.
 //
-// Steps are ordered from leaf -> root.
+// Steps are ordered from leaf -> root. LeafHash and Extras are as for
+// InclusionProof, they are needed to hash the encountered leaf.
 type ExclusionProof struct {
 	TargetKey      uint64
 	EncounteredKey uint64
 	LeafOrdinal    uint32
 	Value          [HashBytes]byte
+	LeafHash       LeafHashFormat
+	Extras         [LeafExtraFields][HashBytes]byte
 	Steps          []ProofStep
 }
 
@@ -50,12 +58,15 @@ func ProveInclusion(leafTable, nodeStore []byte, root Ref, key uint64) (Inclusio
 		return InclusionProof{}, ErrKeyNotFound
 	}
 	val := LeafValue(leafTable, leafOrdinal)
+	format, extras := proveLeafExtras(leafTable, nodeStore, leafRef, leafOrdinal)
 
 	steps := reverseSteps(stepsRT)
 	return InclusionProof{
 		Key:         key,
 		LeafOrdinal: leafOrdinal,
 		Value:       val,
+		LeafHash:    format,
+		Extras:      extras,
 		Steps:       steps,
 	}, nil
 }
@@ -77,6 +88,7 @@ func ProveExclusion(leafTable, nodeStore []byte, root Ref, targetKey uint64) (Ex
 		return ExclusionProof{}, ErrKeyPresent
 	}
 	val := LeafValue(leafTable, leafOrdinal)
+	format, extras := proveLeafExtras(leafTable, nodeStore, leafRef, leafOrdinal)
 
 	steps := reverseSteps(stepsRT)
 	return ExclusionProof{
@@ -84,15 +96,28 @@ func ProveExclusion(leafTable, nodeStore []byte, root Ref, targetKey uint64) (Ex
 		EncounteredKey: encKey,
 		LeafOrdinal:    leafOrdinal,
 		Value:          val,
+		LeafHash:       format,
+		Extras:         extras,
 		Steps:          steps,
 	}, nil
 }
 
+// proveLeafExtras returns the leaf hash format of leafRef, and the extras if
+// the format commits to them.
+func proveLeafExtras(leafTable, nodeStore []byte, leafRef Ref, leafOrdinal uint32) (LeafHashFormat, [LeafExtraFields][HashBytes]byte) {
+	format := NodeLeafHashFormat(nodeStore, leafRef)
+	if format != LeafHashV2 {
+		return format, [LeafExtraFields][HashBytes]byte{}
+	}
+	return format, LeafExtras(leafTable, leafOrdinal)
+}
+
 // VerifyInclusion verifies an inclusion proof against expectedRoot.
 //
-// On success, returns (true, leafOrdinal, valueBytes, nil).
+// On success, returns (true, leafOrdinal, valueBytes, nil). For a LeafHashV2
+// proof, p.Extras are verified too.
 func VerifyInclusion(hasher hash.Hash, expectedRoot [HashBytes]byte, p InclusionProof) (bool, uint32, [HashBytes]byte, error) {
-	leafHash, err := HashLeaf(hasher, p.Key, p.LeafOrdinal, p.Value[:])
+	leafHash, err := hashLeafFormat(hasher, p.LeafHash, p.Key, p.LeafOrdinal, p.Value[:], p.Extras)
 	if err != nil {
 		return false, 0, [HashBytes]byte{}, err
 	}
@@ -130,7 +155,7 @@ func VerifyExclusion(hasher hash.Hash, expectedRoot [HashBytes]byte, p Exclusion
 		return false, 0, 0, [HashBytes]byte{}, ErrVerifyExclusionFailed
 	}
 
-	leafHash, err := HashLeaf(hasher, p.EncounteredKey, p.LeafOrdinal, p.Value[:])
+	leafHash, err := hashLeafFormat(hasher, p.LeafHash, p.EncounteredKey, p.LeafOrdinal, p.Value[:], p.Extras)
 	if err != nil {
 		return false, 0, 0, [HashBytes]byte{}, err
 	}
@@ -0,0 +1,112 @@
+package urkle
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProofExtrasBoundByLeafHashV2(t *testing.T) {
+	keys := []uint64{10, 20, 30, 40, 50}
+	leafCount := uint64(len(keys))
+
+	leafTable := make([]byte, LeafTableBytes(leafCount))
+	nodeStore := make([]byte, NodeStoreBytes(leafCount))
+
+	b, err := NewBuilder(sha256.New(), leafTable, nodeStore)
+	require.NoError(t, err)
+
+	var v [HashBytes]byte
+	for i, k := range keys {
+		v[0] = byte(k)
+		if i%2 == 0 {
+			// mix formats in the one trie
+			_, err = b.InsertMonotone(k, v[:])
+		} else {
+			_, err = b.InsertMonotoneExtras(k, v[:], []byte{byte(k)}, nil, []byte{0xEE, byte(k)})
+		}
+		require.NoError(t, err)
+	}
+	rootRef, rootHash, err := b.Finalize()
+	require.NoError(t, err)
+	checkNodeStoreInvariants(t, nodeStore, rootRef)
+
+	// v1 leaf, extras are not proven
+	p, err := ProveInclusion(leafTable, nodeStore, rootRef, 10)
+	require.NoError(t, err)
+	require.Equal(t, LeafHashV1, p.LeafHash)
+	require.Equal(t, [LeafExtraFields][HashBytes]byte{}, p.Extras)
+	ok, _, _, err := VerifyInclusion(sha256.New(), rootHash, p)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// v2 leaf, extras are proven
+	p, err = ProveInclusion(leafTable, nodeStore, rootRef, 20)
+	require.NoError(t, err)
+	require.Equal(t, LeafHashV2, p.LeafHash)
+	require.Equal(t, byte(20), p.Extras[0][0])
+	require.Equal(t, [HashBytes]byte{}, p.Extras[1])
+	require.Equal(t, []byte{0xEE, 20}, p.Extras[2][:2])
+	ok, _, _, err = VerifyInclusion(sha256.New(), rootHash, p)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	for i := range p.Extras {
+		tampered := p
+		tampered.Extras[i][5] ^= 0xFF
+		ok, _, _, err = VerifyInclusion(sha256.New(), rootHash, tampered)
+		require.ErrorIs(t, err, ErrVerifyInclusionFailed)
+		require.False(t, ok)
+	}
+
+	// Presenting a v2 leaf as v1 must not verify
+	downgraded := p
+	downgraded.LeafHash = LeafHashV1
+	ok, _, _, err = VerifyInclusion(sha256.New(), rootHash, downgraded)
+	require.ErrorIs(t, err, ErrVerifyInclusionFailed)
+	require.False(t, ok)
+
+	// Exclusion via an encountered v2 leaf
+	xp, err := ProveExclusion(leafTable, nodeStore, rootRef, 41)
+	require.NoError(t, err)
+	require.Equal(t, uint64(40), xp.EncounteredKey)
+	require.Equal(t, LeafHashV2, xp.LeafHash)
+	ok, _, _, _, err = VerifyExclusion(sha256.New(), rootHash, xp)
+	require.NoError(t, err)
+	require.True(t, ok)
+	xp.Extras[0][0] ^= 0xFF
+	ok, _, _, _, err = VerifyExclusion(sha256.New(), rootHash, xp)
+	require.ErrorIs(t, err, ErrVerifyExclusionFailed)
+	require.False(t, ok)
+}
+
+func TestInsertMonotoneExtrasRejectsBadExtras(t *testing.T) {
+	leafTable := make([]byte, LeafTableBytes(2))
+	nodeStore := make([]byte, NodeStoreBytes(2))
+	b, err := NewBuilder(sha256.New(), leafTable, nodeStore)
+	require.NoError(t, err)
+
+	var v [HashBytes]byte
+	_, err = b.InsertMonotoneExtras(1, v[:], nil, nil, nil, nil)
+	require.ErrorIs(t, err, ErrTooManyExtras)
+	_, err = b.InsertMonotoneExtras(1, v[:], make([]byte, HashBytes+1))
+	require.ErrorIs(t, err, ErrBadValueSize)
+
+	// extra1 stores 24 bytes, the hash commits to what is stored
+	long := make([]byte, HashBytes)
+	for i := range long {
+		long[i] = 0xAB
+	}
+	_, err = b.InsertMonotoneExtras(1, v[:], long)
+	require.NoError(t, err)
+	rootRef, rootHash, err := b.Finalize()
+	require.NoError(t, err)
+	p, err := ProveInclusion(leafTable, nodeStore, rootRef, 1)
+	require.NoError(t, err)
+	require.Equal(t, [HashBytes - 8]byte(long[:HashBytes-8]), [HashBytes - 8]byte(p.Extras[0][:HashBytes-8]))
+	require.Equal(t, [8]byte{}, [8]byte(p.Extras[0][HashBytes-8:]))
+	ok, _, _, err := VerifyInclusion(sha256.New(), rootHash, p)
+	require.NoError(t, err)
+	require.True(t, ok)
+}
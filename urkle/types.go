@@ -14,9 +14,9 @@ const LeafOrdinalBytes = 4
 // v1 layout (extended for Forestrie v2 index needs):
 //   - key_be8 (uint64)
 //   - valueBytes[32]
-//   - extra1[24] (auxiliary; not committed by the trie hash)
-//   - extra2[32] (auxiliary; not committed by the trie hash)
-//   - extra3[32] (auxiliary; not committed by the trie hash)
+//   - extra1[24] (auxiliary; committed only by LeafHashV2 leaves)
+//   - extra2[32] (auxiliary; committed only by LeafHashV2 leaves)
+//   - extra3[32] (auxiliary; committed only by LeafHashV2 leaves)
 //
 // NOTE: The record size is intentionally a multiple of 32 bytes. To achieve this
 // without truncating valueBytes (which is committed by the trie hash), we
@@ -39,22 +39,41 @@ const (
 	KindBranch NodeKind = 2
 )
 
+// LeafExtraFields is the number of auxiliary extra fields in a leaf record.
+const LeafExtraFields = 3
+
+// LeafHashFormat selects how a leaf hash is computed. It is recorded per leaf
+// in the node record, so a trie may mix formats.
+type LeafHashFormat uint8
+
+const (
+	// LeafHashV1 commits to (key, leafOrdinal, valueBytes), see HashLeaf. The
+	// leaf record extras are advisory.
+	LeafHashV1 LeafHashFormat = 0
+	// LeafHashV2 additionally commits to the three leaf record extras, see
+	// HashLeafV2.
+	LeafHashV2 LeafHashFormat = 1
+)
+
 var (
-	ErrBadHashSize        = errors.New("urkle: hasher output must be 32 bytes")
-	ErrBadValueSize       = errors.New("urkle: valueBytes must be 32 bytes")
-	ErrLeafTableBadSize   = errors.New("urkle: leaf table buffer size invalid")
-	ErrNodeStoreBadSize   = errors.New("urkle: node store buffer size invalid")
-	ErrFrontierBadSize    = errors.New("urkle: frontier buffer size invalid")
-	ErrFrontierBadMagic   = errors.New("urkle: frontier magic invalid")
-	ErrFrontierBadVersion = errors.New("urkle: frontier version invalid")
-	ErrFrontierBadState   = errors.New("urkle: frontier state invalid")
-	ErrOutOfOrderKey      = errors.New("urkle: key out of order")
-	ErrDuplicateKey       = errors.New("urkle: duplicate key")
-	ErrInvalidNodeKind    = errors.New("urkle: invalid node kind")
-	ErrInvalidBranchBit   = errors.New("urkle: invalid branch bit")
-	ErrInvalidSubtreeSize = errors.New("urkle: invalid subtree size")
-	ErrInvalidRightSpan   = errors.New("urkle: invalid right span")
-	ErrInvalidLeafOrdinal = errors.New("urkle: invalid leaf ordinal")
+	ErrBadHashSize           = errors.New("urkle: hasher output must be 32 bytes")
+	ErrBadValueSize          = errors.New("urkle: valueBytes must be 32 bytes")
+	ErrLeafTableBadSize      = errors.New("urkle: leaf table buffer size invalid")
+	ErrNodeStoreBadSize      = errors.New("urkle: node store buffer size invalid")
+	ErrFrontierBadSize       = errors.New("urkle: frontier buffer size invalid")
+	ErrFrontierBadMagic      = errors.New("urkle: frontier magic invalid")
+	ErrFrontierBadVersion    = errors.New("urkle: frontier version invalid")
+	ErrFrontierBadState      = errors.New("urkle: frontier state invalid")
+	ErrOutOfOrderKey         = errors.New("urkle: key out of order")
+	ErrDuplicateKey          = errors.New("urkle: duplicate key")
+	ErrInvalidNodeKind       = errors.New("urkle: invalid node kind")
+	ErrInvalidBranchBit      = errors.New("urkle: invalid branch bit")
+	ErrInvalidSubtreeSize    = errors.New("urkle: invalid subtree size")
+	ErrInvalidRightSpan      = errors.New("urkle: invalid right span")
+	ErrInvalidLeafOrdinal    = errors.New("urkle: invalid leaf ordinal")
+	ErrInvalidLeafHashFormat = errors.New("urkle: invalid leaf hash format")
+	ErrTooManyExtras         = errors.New("urkle: too many leaf extra fields")
+	ErrBatchLengthMismatch   = errors.New("urkle: batch keys and values differ in length")
 
 	// ErrLeafOrdinalDoesNotFit is the base error for any situation where a
 	// leaf ordinal or related capacity cannot be represented in the
@@ -66,6 +85,7 @@ var (
 	ErrLeafOrdinalDoesNotFit = errors.New("urkle: leaf ordinal / capacity does not fit configuration")
 
 	ErrEmptyTrie             = errors.New("urkle: empty trie")
+	ErrRootNotFound          = errors.New("urkle: root hash not found in node store")
 	ErrKeyNotFound           = errors.New("urkle: key not found")
 	ErrKeyPresent            = errors.New("urkle: key present")
 	ErrVerifyInclusionFailed = errors.New("urkle: verify inclusion failed")